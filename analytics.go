@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// AnalyticsRequest - JSON body posted to the call analytics service, with
+// the claims of the identity and the result of its verification
+type AnalyticsRequest struct {
+	OrigTN string   `json:"origtn"`
+	DestTN []string `json:"desttn,omitempty"`
+	Attest string   `json:"attest,omitempty"`
+	OrigID string   `json:"origid,omitempty"`
+	CallID string   `json:"callid,omitempty"`
+	Result string   `json:"result"`
+	Code   int      `json:"code"`
+}
+
+// AnalyticsVerdict - the verdict of the call analytics service (e.g., spam,
+// scam or clean), merged in the result of the check; Error is set instead
+// if the service could not be queried
+type AnalyticsVerdict struct {
+	Verdict string  `json:"verdict,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+	Label   string  `json:"label,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+type analyticsEntry struct {
+	verdict *AnalyticsVerdict
+	expires time.Time
+}
+
+// Analytics - hook to get the verdict of the call analytics service via
+// HTTP callout, with the results cached per orig tn, attestation and code
+type Analytics struct {
+	target  string
+	expire  time.Duration
+	timeout time.Duration
+	mu      sync.Mutex
+	cache   map[string]analyticsEntry
+}
+
+var analytics *Analytics = nil
+
+// NewAnalytics - target is the http(s) URL of the service, the timeout is in
+// milliseconds
+func NewAnalytics(target string, expire int, timeout int) (*Analytics, error) {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		return nil, fmt.Errorf("invalid call analytics target: %s", target)
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid call analytics timeout: %d", timeout)
+	}
+	return &Analytics{
+		target:  target,
+		expire:  time.Duration(expire) * time.Second,
+		timeout: time.Duration(timeout) * time.Millisecond,
+		cache:   make(map[string]analyticsEntry),
+	}, nil
+}
+
+func (a *Analytics) fetch(areq *AnalyticsRequest) (*AnalyticsVerdict, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	body, _ := json.Marshal(areq)
+	req, err := http.NewRequestWithContext(ctx, "POST", a.target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("call analytics http failure: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("call analytics http status error: %v", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	verdict := &AnalyticsVerdict{}
+	if err = json.Unmarshal(data, verdict); err != nil {
+		return nil, fmt.Errorf("invalid call analytics response: %v", err)
+	}
+	verdict.Error = ""
+	return verdict, nil
+}
+
+// Verdict - the verdict for the call, using the cached value if not expired
+func (a *Analytics) Verdict(areq *AnalyticsRequest) *AnalyticsVerdict {
+	key := fmt.Sprintf("%s;%s;%d", areq.OrigTN, areq.Attest, areq.Code)
+	a.mu.Lock()
+	entry, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.verdict
+	}
+
+	verdict, err := a.fetch(areq)
+	if err != nil {
+		return &AnalyticsVerdict{Error: err.Error()}
+	}
+	if a.expire > 0 {
+		a.mu.Lock()
+		a.cache[key] = analyticsEntry{verdict: verdict, expires: time.Now().Add(a.expire)}
+		a.mu.Unlock()
+	}
+	return verdict
+}
+
+// checkAnalytics - the verdict of the call analytics service for the checked
+// identity, nil if the hook is not enabled
+func checkAnalytics(identityVal string, callID string, result string, ret int) *AnalyticsVerdict {
+	if analytics == nil {
+		return nil
+	}
+	payload := identityPayload(identityVal)
+	if len(payload.Orig.TN) == 0 {
+		return nil
+	}
+	return analytics.Verdict(&AnalyticsRequest{OrigTN: payload.Orig.TN, DestTN: payload.Dest.TN,
+		Attest: payload.ATTest, OrigID: payload.OrigID, CallID: callID, Result: result, Code: ret})
+}
+
+// checkResultName - the result of the check for the analytics service
+func checkResultName(ret int) string {
+	if ret == secsipid.SJWTRetOK {
+		return "OK"
+	}
+	if checkUnavailable(ret) {
+		return checkResultUnavailable
+	}
+	return "FAILED"
+}
+
+// httpAnalytics - the verdict of the call analytics service for the checked
+// identity, also set in the X-Analytics-Verdict response header
+func httpAnalytics(w http.ResponseWriter, r *http.Request, identityVal string, ret int) *AnalyticsVerdict {
+	av := checkAnalytics(identityVal, httpRequestCallID(r), checkResultName(ret), ret)
+	if av == nil {
+		return nil
+	}
+	if len(av.Error) > 0 {
+		httpLogf(r, "failed to get the call analytics verdict: %s\n", av.Error)
+	} else if len(av.Verdict) > 0 {
+		w.Header().Set("X-Analytics-Verdict", av.Verdict)
+	}
+	return av
+}
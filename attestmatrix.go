@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// SignAttrs - attributes of a sign request used to decide the attestation level
+type SignAttrs struct {
+	OrigTN string
+	Trunk  string
+	APIKey string
+	Attest string
+}
+
+// AttestRule - one rule of the attestation decision matrix, empty or "*"
+// fields match any value
+type AttestRule struct {
+	Trunk  string `json:"trunk"`
+	APIKey string `json:"apikey"`
+	Class  string `json:"class"`
+	Attest string `json:"attest"`
+}
+
+// AttestMatrix - attestation decision matrix, first matching rule wins
+type AttestMatrix struct {
+	Rules   []AttestRule `json:"rules"`
+	Default string       `json:"default"`
+}
+
+var attestMatrix *AttestMatrix = nil
+
+// LoadAttestMatrix - load the decision matrix from JSON file
+func LoadAttestMatrix(filePath string) (*AttestMatrix, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	m := &AttestMatrix{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid attestation matrix: %v", err)
+	}
+	for i, rule := range m.Rules {
+		if !validAttestLevel(rule.Attest) {
+			return nil, fmt.Errorf("invalid attestation level in rule %d: %s", i, rule.Attest)
+		}
+	}
+	if len(m.Default) > 0 && !validAttestLevel(m.Default) {
+		return nil, fmt.Errorf("invalid default attestation level: %s", m.Default)
+	}
+	return m, nil
+}
+
+func validAttestLevel(v string) bool {
+	return v == "A" || v == "B" || v == "C"
+}
+
+func attestRuleMatch(ruleVal string, val string) bool {
+	return len(ruleVal) == 0 || ruleVal == "*" || ruleVal == val
+}
+
+// Decide - the attestation level for the request attributes
+func (m *AttestMatrix) Decide(attrs *SignAttrs) string {
+	class := ""
+	for _, rule := range m.Rules {
+		if !attestRuleMatch(rule.Trunk, attrs.Trunk) || !attestRuleMatch(rule.APIKey, attrs.APIKey) {
+			continue
+		}
+		if len(rule.Class) > 0 && rule.Class != "*" {
+			if len(class) == 0 {
+				class = signTNClass(attrs.OrigTN)
+			}
+			if rule.Class != class {
+				continue
+			}
+		}
+		return rule.Attest
+	}
+	if len(m.Default) > 0 {
+		return m.Default
+	}
+	return attrs.Attest
+}
+
+// signTNClass - the classification of the tn, unknown if no lookup hook or on failure
+func signTNClass(tn string) string {
+	if tnLookup == nil {
+		return tnClassUnknown
+	}
+	class, err := tnLookup.Classify(tn)
+	if err != nil {
+		fmt.Printf("failed to classify tn %s: %v\n", tn, err)
+		return tnClassUnknown
+	}
+	return class
+}
+
+// httpSignAttrs - sign attributes with source trunk and api key from http headers
+func httpSignAttrs(r *http.Request, origTN string, attestVal string) *SignAttrs {
+	return &SignAttrs{
+		OrigTN: origTN,
+		Trunk:  r.Header.Get("X-Source-Trunk"),
+		APIKey: r.Header.Get("X-API-Key"),
+		Attest: attestVal,
+	}
+}
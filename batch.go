@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// batchMaxLine - the maximum size of a line of the batch input
+const batchMaxLine = 1024 * 1024
+
+// batchItem - an item of the batch input with its index (line number, from 0)
+type batchItem struct {
+	index int
+	item  json.RawMessage
+}
+
+// batchReadItems - send the items of the input lines, identity values for
+// check and SignRequest objects for sign (with -x5u if not set in the item),
+// skipping the empty lines
+func batchReadItems(r io.Reader, op string, items chan<- batchItem) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), batchMaxLine)
+	index := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var item json.RawMessage
+		if op == "check" {
+			item, _ = json.Marshal(line)
+		} else {
+			item = json.RawMessage(line)
+			signReq := SignRequest{}
+			if err := json.Unmarshal(item, &signReq); err == nil && len(signReq.X5u) == 0 {
+				signReq.X5u = cliops.x5u
+				item, _ = json.Marshal(signReq)
+			}
+		}
+		items <- batchItem{index: index, item: item}
+		index++
+	}
+	return scanner.Err()
+}
+
+// batchWriteResults - write the results as JSON lines, in the input order if
+// ordered, otherwise in the completion order; returns the number of failed items
+func batchWriteResults(w io.Writer, results <-chan *JobItemResult, ordered bool) int {
+	enc := json.NewEncoder(w)
+	failed := 0
+	next := 0
+	pending := map[int]*JobItemResult{}
+	for result := range results {
+		if result.Code != secsipid.SJWTRetOK {
+			failed++
+		}
+		if !ordered {
+			enc.Encode(result)
+			continue
+		}
+		pending[result.Index] = result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			enc.Encode(r)
+			delete(pending, next)
+			next++
+		}
+	}
+	return failed
+}
+
+// secsipidxCLIBatch - check or sign the items of the batch input (file or
+// '-' for stdin) with -jobs workers, writing the results to stdout
+func secsipidxCLIBatch(op string) int {
+	if cliops.jobs <= 0 {
+		fmt.Printf("invalid number of jobs: %d\n", cliops.jobs)
+		return cliExitArgs
+	}
+	if cliops.batchorder != "ordered" && cliops.batchorder != "unordered" {
+		fmt.Printf("invalid batch order: %s (ordered or unordered)\n", cliops.batchorder)
+		return cliExitArgs
+	}
+	in := os.Stdin
+	if cliops.batch != "-" {
+		f, err := os.Open(cliops.batch)
+		if err != nil {
+			fmt.Printf("failed to open the batch file: %v\n", err)
+			return secsipid.SJWTRetErrFileRead
+		}
+		defer f.Close()
+		in = f
+	}
+	attrs := &SignAttrs{Trunk: cliops.trunk, Attest: cliops.attest}
+
+	items := make(chan batchItem, cliops.jobs)
+	results := make(chan *JobItemResult, cliops.jobs)
+	var readErr error
+	go func() {
+		readErr = batchReadItems(in, op, items)
+		close(items)
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < cliops.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bi := range items {
+				results <- jobProcessItem(op, bi.item, attrs, nil, bi.index)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	out := bufio.NewWriter(os.Stdout)
+	failed := batchWriteResults(out, results, cliops.batchorder == "ordered")
+	out.Flush()
+
+	if readErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to read the batch input: %v\n", readErr)
+		return secsipid.SJWTRetErrFileRead
+	}
+	if failed > 0 {
+		return -1
+	}
+	return 0
+}
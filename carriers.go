@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// CarrierNames - the carrier names by service provider code (SPC or OCN),
+// loaded from a CSV file and reloaded when the file is modified
+type CarrierNames struct {
+	path    string
+	mu      sync.RWMutex
+	names   map[string]string
+	modTime time.Time
+}
+
+var carrierNames *CarrierNames = nil
+
+// LoadCarrierNames - load the carrier names from the CSV file with lines
+// like 'code,name'; empty lines and lines starting with '#' are ignored
+func LoadCarrierNames(filePath string) (*CarrierNames, error) {
+	c := &CarrierNames{path: filePath}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *CarrierNames) load() error {
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	names := make(map[string]string)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid carrier names file: %v", err)
+		}
+		names[strings.ToUpper(strings.TrimSpace(record[0]))] = strings.TrimSpace(record[1])
+	}
+	c.mu.Lock()
+	c.names = names
+	c.modTime = fi.ModTime()
+	c.mu.Unlock()
+	return nil
+}
+
+// Refresh - reload the file if it was modified, keeping the current names
+// if it cannot be loaded
+func (c *CarrierNames) Refresh() {
+	fi, err := os.Stat(c.path)
+	if err != nil {
+		log.Printf("unable to check carrier names file: %v", err)
+		return
+	}
+	c.mu.RLock()
+	modified := !fi.ModTime().Equal(c.modTime)
+	c.mu.RUnlock()
+	if !modified {
+		return
+	}
+	if err = c.load(); err != nil {
+		log.Printf("unable to reload carrier names from %s: %v", c.path, err)
+		return
+	}
+	log.Printf("carrier names reloaded from: %s", c.path)
+}
+
+// StartRefresh - check periodically if the file was modified
+func (c *CarrierNames) StartRefresh(interval int) {
+	go func() {
+		for {
+			time.Sleep(time.Duration(interval) * time.Second)
+			c.Refresh()
+		}
+	}()
+}
+
+// Name - the carrier name for the service provider code, empty if unknown
+func (c *CarrierNames) Name(code string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.names[strings.ToUpper(code)]
+}
+
+// identityCertSPC - the service provider code of the certificate the identity
+// was checked with, empty if not available
+func identityCertSPC(info *secsipid.SJWTCheckInfo) string {
+	if info == nil {
+		return ""
+	}
+	spc, _, _ := secsipid.SJWTGetCertSPC(info.Cert)
+	return spc
+}
+
+// identityCarrier - the service provider code of the certificate the identity
+// was checked with and the carrier name for it
+func identityCarrier(info *secsipid.SJWTCheckInfo) (string, string) {
+	if carrierNames == nil {
+		return "", ""
+	}
+	spc := identityCertSPC(info)
+	if len(spc) == 0 {
+		return "", ""
+	}
+	return spc, carrierNames.Name(spc)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// CAStats - the verifications with the certificates of an issuing CA and a
+// service provider code, with the carrier name if known
+type CAStats struct {
+	Issuer   string            `json:"issuer"`
+	SPC      string            `json:"spc"`
+	Carrier  string            `json:"carrier,omitempty"`
+	Checks   uint64            `json:"checks"`
+	Failed   uint64            `json:"failed"`
+	FailRate float64           `json:"failrate"`
+	Failures map[string]uint64 `json:"failures,omitempty"`
+}
+
+// CAStatsResult - JSON response of the stats per CA endpoint
+type CAStatsResult struct {
+	CA []CAStats `json:"ca"`
+}
+
+// caStatsSnapshot - the counters of the library per issuing CA and SPC, with
+// the carrier names and the failures by return code
+func caStatsSnapshot() *CAStatsResult {
+	result := &CAStatsResult{CA: []CAStats{}}
+	for _, cs := range secsipid.SJWTCAGetStats() {
+		item := CAStats{Issuer: cs.Issuer, SPC: cs.SPC, Checks: cs.Checks, Failed: cs.Failed,
+			FailRate: statsFailRate(cs.Failed, cs.Checks)}
+		if carrierNames != nil && len(cs.SPC) > 0 {
+			item.Carrier = carrierNames.Name(cs.SPC)
+		}
+		if len(cs.Failures) > 0 {
+			item.Failures = make(map[string]uint64, len(cs.Failures))
+			for code, count := range cs.Failures {
+				item.Failures[fmt.Sprint(code)] = count
+			}
+		}
+		result.CA = append(result.CA, item)
+	}
+	return result
+}
+
+// httpHandleV1StatsCA - GET /v1/stats/ca for the verifications and the
+// failures per issuing CA and SPC, DELETE for resetting them
+func httpHandleV1StatsCA(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(caStatsSnapshot())
+	case "DELETE":
+		httpLogf(r, "resetting the statistics per CA\n")
+		secsipid.SJWTCAStatsReset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+	}
+}
+
+// caStatsWriteMetrics - the verifications and the failures (by return code)
+// per issuing CA and SPC in the Prometheus text format
+func caStatsWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	stats := caStatsSnapshot()
+	counter := func(name string, help string) string {
+		family := name
+		if openMetrics {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, help, family)
+		return name
+	}
+	name := counter("secsipidx_ca_verifications_total", "Identity verifications per issuing CA and SPC.")
+	for _, cs := range stats.CA {
+		fmt.Fprintf(w, "%s{issuer=%q,spc=%q} %d\n", name, cs.Issuer, cs.SPC, cs.Checks)
+	}
+	name = counter("secsipidx_ca_failures_total", "Failed identity verifications per issuing CA, SPC and return code (with its name).")
+	for _, cs := range stats.CA {
+		codes := make([]string, 0, len(cs.Failures))
+		for code := range cs.Failures {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			ret, _ := strconv.Atoi(code)
+			fmt.Fprintf(w, "%s{issuer=%q,spc=%q,code=%q,reason=%q} %d\n", name, cs.Issuer, cs.SPC, code,
+				secsipid.SJWTRetName(ret), cs.Failures[code])
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/x509"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// certChainSubjects - the subjects of the certificates of the chain, from the
+// leaf certificate to the root CA
+func certChainSubjects(chain []*x509.Certificate) []string {
+	subjects := make([]string, 0, len(chain))
+	for _, cert := range chain {
+		subjects = append(subjects, cert.Subject.String())
+	}
+	return subjects
+}
+
+// identityCertChain - the subjects of the chain the certificate of the
+// identity was verified with, empty if -result-chain is not set or the
+// certificate is not verified
+func identityCertChain(info *secsipid.SJWTCheckInfo) []string {
+	if !cliops.resultchain || info == nil || len(info.Chain) == 0 {
+		return nil
+	}
+	return certChainSubjects(info.Chain)
+}
+
+// identityRevocation - the decisions of the revocation checks done when the
+// certificate of the identity was verified, nil if no revocation check is
+// enabled or the certificate is not verified
+func identityRevocation(info *secsipid.SJWTCheckInfo) *secsipid.SJWTRevocation {
+	if (cliops.certverify&(secsipid.CertVerifyOptCRL|secsipid.CertVerifyOptOCSP)) == 0 ||
+		(cliops.certverify&secsipid.CertVerifyOptTimeOnly) != 0 || info == nil {
+		return nil
+	}
+	return info.Revocation
+}
+
+// revocationStatus - the decision of the revocation check for printing, '-'
+// if the check is not enabled
+func revocationStatus(status string) string {
+	if len(status) == 0 {
+		return "-"
+	}
+	return status
+}
+
+// identityFinalURL - the URL the certificate of the identity was fetched from
+// after following the redirects, empty if the fetch was not redirected
+func identityFinalURL(identityVal string) string {
+	parts, _, err := secsipid.SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return ""
+	}
+	return secsipid.SJWTGetURLFinalURL(parts.Info)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// cliFlagsHidden - the options for testing, not listed in help output and
+// shell completion
+var cliFlagsHidden = []string{"chaos", "chaos-fetch-delay", "chaos-fetch-fail", "chaos-clock-skew"}
+
+func cliFlagHidden(name string) bool {
+	for _, n := range cliFlagsHidden {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// chaosInit - set the failures injected in the verification from the options
+func chaosInit() {
+	opts := secsipid.SJWTChaosOptions{FetchDelay: cliops.chaosdelay, FetchFail: cliops.chaosfail,
+		ClockSkew: cliops.chaosskew}
+	if opts != (secsipid.SJWTChaosOptions{}) {
+		log.Printf("warning: chaos test mode - fetch delay: %dms, fetch fail: %d%%, clock skew: %ds",
+			opts.FetchDelay, opts.FetchFail, opts.ClockSkew)
+	}
+	secsipid.SJWTSetChaos(opts)
+}
+
+// httpHandleV1Chaos - GET /v1/chaos for the failures injected in the
+// verification, PUT /v1/chaos to set them (enabled with -chaos)
+func httpHandleV1Chaos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT", "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+			return
+		}
+		opts := secsipid.SJWTChaosOptions{}
+		if err = json.Unmarshal(body, &opts); err != nil || opts.FetchFail < 0 || opts.FetchFail > 100 {
+			httpLogf(r, "invalid chaos options: %s\n", string(body))
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid chaos options")
+			return
+		}
+		httpLogf(r, "warning: chaos test mode - fetch delay: %dms, fetch fail: %d%%, clock skew: %ds\n",
+			opts.FetchDelay, opts.FetchFail, opts.ClockSkew)
+		secsipid.SJWTSetChaos(opts)
+	default:
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(secsipid.SJWTGetChaos())
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cliFlagsCommands - the legacy options selecting the operation to run
+var cliFlagsCommands = []string{"check", "c", "sign", "s", "sign-full", "S", "div", "redirect", "resign", "check-chain",
+	"sign-connected", "check-connected", "rcdi", "db-query", "ltest", "l", "version"}
+
+// cliHelpGroups - functional areas for grouping the options in help output,
+// an option is listed in the first group including it
+var cliHelpGroups = []struct {
+	Title string
+	Flags [][]string
+}{
+	{"Commands", [][]string{cliFlagsCommands}},
+	{"Signing", [][]string{cliFlagsSign, {"header", "fheader", "payload", "fpayload", "json-parse"}}},
+	{"Checking", [][]string{cliFlagsCheck, {"print-claims", "check-chain"}}},
+	{"Rich call data", [][]string{{"rcdi-src", "rcdi-alg", "rcdi-digest"}}},
+	{"Certificates", [][]string{cliFlagsCert}},
+	{"HTTP server", [][]string{cliFlagsServe}},
+	{"Events and tracing", [][]string{cliFlagsEvents, {"otel-url", "otel-service"}}},
+	{"Database records", [][]string{{"db-since", "db-until", "db-limit"}}},
+	{"General", [][]string{cliFlagsCommon}},
+}
+
+// cliPrintFlag - print the option in the format of flag.PrintDefaults()
+func cliPrintFlag(w io.Writer, f *flag.Flag) {
+	name, usage := flag.UnquoteUsage(f)
+	line := "  -" + f.Name
+	if len(name) > 0 {
+		line += " " + name
+	}
+	if len(line) <= 4 {
+		line += "\t"
+	} else {
+		line += "\n    \t"
+	}
+	line += strings.ReplaceAll(usage, "\n", "\n    \t")
+	if len(f.DefValue) > 0 && f.DefValue != "false" && f.DefValue != "0" {
+		if name == "string" {
+			line += fmt.Sprintf(" (default %q)", f.DefValue)
+		} else {
+			line += fmt.Sprintf(" (default %v)", f.DefValue)
+		}
+	}
+	fmt.Fprintln(w, line)
+}
+
+// cliPrintGroupedDefaults - print the options grouped by functional area
+func cliPrintGroupedDefaults() {
+	w := flag.CommandLine.Output()
+	printed := map[string]bool{}
+	for _, group := range cliHelpGroups {
+		var flags []*flag.Flag
+		for _, names := range group.Flags {
+			for _, name := range names {
+				if f := flag.Lookup(name); f != nil && !printed[name] && !cliFlagHidden(name) {
+					printed[name] = true
+					flags = append(flags, f)
+				}
+			}
+		}
+		if len(flags) == 0 {
+			continue
+		}
+		sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+		fmt.Fprintf(w, "%s:\n", group.Title)
+		for _, f := range flags {
+			cliPrintFlag(w, f)
+		}
+	}
+	header := false
+	flag.VisitAll(func(f *flag.Flag) {
+		if printed[f.Name] || cliFlagHidden(f.Name) {
+			return
+		}
+		if !header {
+			fmt.Fprintf(w, "Other:\n")
+			header = true
+		}
+		cliPrintFlag(w, f)
+	})
+}
+
+// cliAllFlags - names of all legacy options
+func cliAllFlags() []string {
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if !cliFlagHidden(f.Name) {
+			names = append(names, "-"+f.Name)
+		}
+	})
+	return names
+}
+
+func cliCompletionBash(w io.Writer, prog string) {
+	fmt.Fprintf(w, "# bash completion for %s\n", prog)
+	fmt.Fprintf(w, "_%s() {\n", prog)
+	fmt.Fprintf(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]}\n")
+	fmt.Fprintf(w, "\tlocal opts\n")
+	fmt.Fprintf(w, "\tif [ $COMP_CWORD -eq 1 ]; then\n")
+	fmt.Fprintf(w, "\t\topts=\"%s %s\"\n", cliSubcommandNames(" "), strings.Join(cliAllFlags(), " "))
+	fmt.Fprintf(w, "\telse\n")
+	fmt.Fprintf(w, "\t\tcase ${COMP_WORDS[1]} in\n")
+	for _, sc := range cliSubcommands {
+		opts := cliSubcommandFlags(sc)
+		for i := range opts {
+			opts[i] = "-" + opts[i]
+		}
+		if sc.Name == "cache" {
+			opts = append(opts, "list", "purge")
+		} else if sc.Name == "keys" {
+			opts = append(opts, "import", "export", "fingerprints")
+		} else if sc.Name == "completion" {
+			opts = append(opts, "bash", "zsh", "fish")
+		}
+		fmt.Fprintf(w, "\t\t%s) opts=\"%s\" ;;\n", sc.Name, strings.Join(opts, " "))
+	}
+	fmt.Fprintf(w, "\t\t*) opts=\"%s\" ;;\n", strings.Join(cliAllFlags(), " "))
+	fmt.Fprintf(w, "\t\tesac\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "\tCOMPREPLY=($(compgen -W \"$opts\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o default -F _%s %s\n", prog, prog)
+}
+
+func cliCompletionZsh(w io.Writer, prog string) {
+	fmt.Fprintf(w, "#compdef %s\n", prog)
+	fmt.Fprintf(w, "_%s() {\n", prog)
+	fmt.Fprintf(w, "\tlocal -a opts\n")
+	fmt.Fprintf(w, "\tif (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(w, "\t\topts=(%s %s)\n", cliSubcommandNames(" "), strings.Join(cliAllFlags(), " "))
+	fmt.Fprintf(w, "\telse\n")
+	fmt.Fprintf(w, "\t\tcase $words[2] in\n")
+	for _, sc := range cliSubcommands {
+		opts := cliSubcommandFlags(sc)
+		for i := range opts {
+			opts[i] = "-" + opts[i]
+		}
+		fmt.Fprintf(w, "\t\t%s) opts=(%s) ;;\n", sc.Name, strings.Join(opts, " "))
+	}
+	fmt.Fprintf(w, "\t\t*) opts=(%s) ;;\n", strings.Join(cliAllFlags(), " "))
+	fmt.Fprintf(w, "\t\tesac\n")
+	fmt.Fprintf(w, "\tfi\n")
+	fmt.Fprintf(w, "\tcompadd -- $opts\n")
+	fmt.Fprintf(w, "\t_files\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "compdef _%s %s\n", prog, prog)
+}
+
+// fishQuote - quote the text for fish shell
+func fishQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
+
+func cliCompletionFish(w io.Writer, prog string) {
+	fmt.Fprintf(w, "# fish completion for %s\n", prog)
+	for _, sc := range cliSubcommands {
+		fmt.Fprintf(w, "complete -c %s -f -n __fish_use_subcommand -a %s -d %s\n", prog, sc.Name,
+			fishQuote(sc.Description))
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -o %s -d %s\n", prog, f.Name,
+			fishQuote(strings.Split(f.Usage, "\n")[0]))
+	})
+	for _, sc := range cliSubcommands {
+		for _, name := range cliSubcommandFlags(sc) {
+			fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from %s' -o %s -d %s\n", prog, sc.Name, name,
+				fishQuote(strings.Split(flag.Lookup(name).Usage, "\n")[0]))
+		}
+	}
+}
+
+func secsipidxCLICompletion() int {
+	prog := filepath.Base(os.Args[0])
+	switch cliops.completion {
+	case "bash":
+		cliCompletionBash(os.Stdout, prog)
+	case "zsh":
+		cliCompletionZsh(os.Stdout, prog)
+	case "fish":
+		cliCompletionFish(os.Stdout, prog)
+	default:
+		fmt.Printf("unsupported shell: %s\n", cliops.completion)
+		return cliExitArgs
+	}
+	return 0
+}
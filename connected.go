@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// secsipidxCLISignConnected - connected identity for the call from orig-tn
+// (caller) answered by dest-tn (connected party)
+func secsipidxCLISignConnected() int {
+	if len(cliops.origtn) == 0 || len(cliops.desttn) == 0 {
+		fmt.Printf("caller (orig-tn) and connected (dest-tn) numbers have to be provided\n")
+		return cliExitArgs
+	}
+	prvkeyPath, x5uVal, err := signKey(cliops.keyname, cliops.x5u)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return cliExitKey
+	}
+	attestVal := signAttestation(&SignAttrs{OrigTN: cliops.desttn, Trunk: cliops.trunk, Attest: cliops.attest})
+	token, ret, err := secsipid.SJWTGetConnectedIdentity(cliops.origtn, cliops.desttn, attestVal, cliops.origid, x5uVal, prvkeyPath)
+
+	emitEvent(&EventRecord{Event: "sign-connected", Code: ret, OrigTN: cliops.desttn, DestTN: cliops.origtn,
+		OrigID: identityPayload(token).OrigID, CallID: cliops.callid, Message: errorMessage(err)}, "", "")
+
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return ret
+	}
+	fmt.Printf("%s\n", token)
+	return 0
+}
+
+// secsipidxCLICheckConnected - verify the connected identity for the call
+// from orig-tn (caller), optionally matching dest-tn as connected party
+func secsipidxCLICheckConnected() int {
+	var sIdentity string
+
+	if len(cliops.fidentity) > 0 {
+		vIdentity, _ := ioutil.ReadFile(cliops.fidentity)
+		sIdentity = string(vIdentity)
+	} else if len(cliops.identity) > 0 {
+		sIdentity = cliops.identity
+	} else {
+		fmt.Printf("Identity value not provided\n")
+		return cliExitArgs
+	}
+	if len(cliops.origtn) == 0 {
+		fmt.Printf("caller number (orig-tn) not provided\n")
+		return cliExitArgs
+	}
+
+	ret, err := secsipid.SJWTCheckConnectedIdentity(sIdentity, cliops.origtn, cliops.desttn, cliops.expire, cliops.fpubkey, cliops.timeout)
+
+	payload := identityPayload(sIdentity)
+	emitEvent(&EventRecord{Event: "check-connected", Code: ret, OrigTN: payload.Orig.TN, DestTN: strings.Join(payload.Dest.TN, ","),
+		OrigID: payload.OrigID, CallID: cliops.callid, Message: errorMessage(err)}, "", "")
+
+	if err != nil {
+		fmt.Printf("error message: %v\n", err)
+	}
+	return ret
+}
+
+// httpHandleV1SignConnectedCSV - body: CallerTN,ConnectedTN,ATTEST,OrigID,X5U
+func httpHandleV1SignConnectedCSV(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for building connected identity ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+
+	token, err := httpRequestSignTokens(r, body)
+	if err != nil || len(token) < 5 {
+		httpLogf(r, "too few tokens in input body: %d\n", len(token))
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "too few tokens")
+		return
+	}
+
+	prvkeyPath, x5uVal, err := signKey(httpSignKeyName(r), httpSignX5u(r, token[4]))
+	if err != nil {
+		httpLogf(r, "invalid signing key: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+		return
+	}
+	attestVal := signAttestation(httpSignAttrs(r, token[1], token[2]))
+	hdr, ret, err := secsipid.SJWTGetConnectedIdentity(token[0], token[1], attestVal, token[3], x5uVal, prvkeyPath)
+
+	if eventsEnabled() {
+		srcAddr, dstAddr := httpRequestAddrs(r)
+		emitEvent(&EventRecord{Event: "sign-connected", Code: ret, OrigTN: token[1], DestTN: token[0],
+			OrigID: identityPayload(hdr).OrigID, CallID: httpRequestCallID(r), ReqID: httpRequestID(r), Message: errorMessage(err)}, srcAddr, dstAddr)
+	}
+
+	if err != nil {
+		httpLogf(r, "failed building connected identity: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	httpWriteIdentity(w, r, hdr, &IdentityResult{Identity: hdr})
+}
+
+// httpHandleV1CheckConnected - body is the connected identity, the caller number
+// is given by X-Caller-TN header and the expected connected number by X-Connected-TN
+func httpHandleV1CheckConnected(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for connected identity check ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	identityVal, err := httpRequestIdentity(r, body)
+	if err != nil {
+		httpLogf(r, "invalid json body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+	callerTN := r.Header.Get("X-Caller-TN")
+	if len(callerTN) == 0 {
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "caller number not provided")
+		return
+	}
+
+	ret, err := secsipid.SJWTCheckConnectedIdentity(identityVal, callerTN, r.Header.Get("X-Connected-TN"),
+		cliops.expire, cliops.fpubkey, cliops.timeout)
+
+	if eventsEnabled() {
+		payload := identityPayload(identityVal)
+		srcAddr, dstAddr := httpRequestAddrs(r)
+		emitEvent(&EventRecord{Event: "check-connected", Code: ret, OrigTN: payload.Orig.TN, DestTN: strings.Join(payload.Dest.TN, ","),
+			OrigID: payload.OrigID, CallID: httpRequestCallID(r), ReqID: httpRequestID(r), Message: errorMessage(err)}, srcAddr, dstAddr)
+	}
+
+	if err != nil {
+		httpLogf(r, "failed checking connected identity: (%d) %v\n", ret, err)
+		httpError(w, http.StatusInternalServerError, httpErrCheckFailed, ret, err.Error())
+		return
+	}
+	httpLogf(r, "valid connected identity - return code: %d\n", ret)
+	httpWriteResult(w, r, "OK", &CheckResult{Result: "OK", Code: ret})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// CPSPassports - body of the CPS publish request and retrieve response
+type CPSPassports struct {
+	Passports []string `json:"passports"`
+}
+
+// CPSClient - client for out-of-band Call Placement Service (RFC 8816)
+type CPSClient struct {
+	baseURL    string
+	prvkeyPath string
+	x5u        string
+	httpClient *http.Client
+}
+
+var cpsClient *CPSClient = nil
+
+// NewCPSClient --
+func NewCPSClient(baseURL string, prvkeyPath string, x5u string, timeout int) (*CPSClient, error) {
+	if !strings.HasPrefix(baseURL, "https://") && !strings.HasPrefix(baseURL, "http://") {
+		return nil, fmt.Errorf("invalid cps url: %s", baseURL)
+	}
+	return &CPSClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		prvkeyPath: prvkeyPath,
+		x5u:        x5u,
+		httpClient: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}, nil
+}
+
+// passportsURL - the CPS resource for the call: {base}/passports/{dest}/{orig}
+func (c *CPSClient) passportsURL(origTN string, destTN string) string {
+	return c.baseURL + "/passports/" + url.PathEscape(secsipid.SJWTNormalizeTN(destTN)) +
+		"/" + url.PathEscape(secsipid.SJWTNormalizeTN(origTN))
+}
+
+// authToken - bearer token for the CPS request, signed with the private key
+func (c *CPSClient) authToken(method string, urlVal string, origTN string, destTN string) (string, error) {
+	if len(c.prvkeyPath) == 0 {
+		return "", nil
+	}
+	header := map[string]string{"alg": "ES256", "typ": "JWT", "x5u": c.x5u}
+	payload := map[string]interface{}{"iat": time.Now().Unix(), "htm": method, "htu": urlVal,
+		"orig": secsipid.SJWTOrig{TN: secsipid.SJWTNormalizeTN(origTN)},
+		"dest": secsipid.SJWTDest{TN: []string{secsipid.SJWTNormalizeTN(destTN)}}}
+	hdrJSON, _ := json.Marshal(header)
+	payloadJSON, _ := json.Marshal(payload)
+	token, _, err := secsipid.SJWTEncodeText(string(hdrJSON), string(payloadJSON), c.prvkeyPath)
+	return token, err
+}
+
+func (c *CPSClient) do(method string, origTN string, destTN string, body []byte) ([]byte, error) {
+	urlVal := c.passportsURL(origTN, destTN)
+	req, err := http.NewRequest(method, urlVal, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token, err := c.authToken(method, urlVal, origTN, destTN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build cps auth token: %v", err)
+	}
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cps request failure: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read cps body failure: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("cps status error: %v", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// Publish - send the PASSporT of the identity to the CPS
+func (c *CPSClient) Publish(origTN string, destTN string, identityVal string) error {
+	passport := strings.TrimSpace(strings.Split(identityVal, ";")[0])
+	body, _ := json.Marshal(&CPSPassports{Passports: []string{passport}})
+	_, err := c.do("POST", origTN, destTN, body)
+	return err
+}
+
+// Retrieve - get the PASSporTs published for the call
+func (c *CPSClient) Retrieve(origTN string, destTN string) ([]string, error) {
+	data, err := c.do("GET", origTN, destTN, nil)
+	if err != nil {
+		return nil, err
+	}
+	passports := CPSPassports{}
+	if err = json.Unmarshal(data, &passports); err != nil {
+		return nil, fmt.Errorf("invalid cps response: %v", err)
+	}
+	return passports.Passports, nil
+}
+
+// passportIdentity - build the identity header value for a PASSporT, using
+// the x5u from its header as info parameter
+func passportIdentity(passport string) (string, error) {
+	btoken := strings.Split(passport, ".")
+	if len(btoken) != 3 {
+		return "", errors.New("invalid passport")
+	}
+	vHeader, err := secsipid.SJWTBase64DecodeString(btoken[0])
+	if err != nil {
+		return "", err
+	}
+	header := secsipid.SJWTHeader{}
+	if err = json.Unmarshal([]byte(vHeader), &header); err != nil {
+		return "", err
+	}
+	if len(header.X5u) == 0 {
+		return "", errors.New("no x5u in passport header")
+	}
+	return passport + ";info=<" + header.X5u + ">;alg=" + header.Alg + ";ppt=" + header.Ppt, nil
+}
+
+// CheckCall - retrieve the PASSporTs for the call and verify them, the first
+// valid PASSporT matching the orig and dest TNs is returned
+func (c *CPSClient) CheckCall(origTN string, destTN string, expireVal int, pubkeyPath string, timeoutVal int) (string, int, error) {
+	passports, err := c.Retrieve(origTN, destTN)
+	if err != nil {
+		return "", secsipid.SJWTRetErrHTTPGet, err
+	}
+	if len(passports) == 0 {
+		return "", secsipid.SJWTRetErrSIPHdrEmpty, errors.New("no passport published for the call")
+	}
+	ret := secsipid.SJWTRetErr
+	err = errors.New("no valid passport for the call")
+	for _, passport := range passports {
+		payload := identityPayload(passport)
+		if secsipid.SJWTNormalizeTN(payload.Orig.TN) != secsipid.SJWTNormalizeTN(origTN) ||
+			len(payload.Dest.TN) == 0 || secsipid.SJWTNormalizeTN(payload.Dest.TN[0]) != secsipid.SJWTNormalizeTN(destTN) {
+			continue
+		}
+		var identityVal string
+		if len(pubkeyPath) > 0 {
+			identityVal = passport
+			ret, err = secsipid.SJWTCheckIdentity(identityVal, expireVal, pubkeyPath, timeoutVal)
+		} else {
+			if identityVal, err = passportIdentity(passport); err != nil {
+				continue
+			}
+			ret, err = secsipid.SJWTCheckFullIdentity(identityVal, expireVal, "", timeoutVal)
+		}
+		if ret == secsipid.SJWTRetOK {
+			return identityVal, ret, nil
+		}
+	}
+	return "", ret, err
+}
+
+// cpsPublish - publish the signed identity if the CPS client is enabled, errors are only logged
+func cpsPublish(origTN string, destTN string, identityVal string) {
+	if cpsClient == nil || !cliops.cpspublish || len(identityVal) == 0 {
+		return
+	}
+	if err := cpsClient.Publish(origTN, destTN, identityVal); err != nil {
+		log.Printf("failed to publish passport to cps: %v", err)
+	}
+}
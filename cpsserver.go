@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+type cpsStoreEntry struct {
+	passport string
+	stored   time.Time
+}
+
+// CPSStore - in-memory store of PASSporTs published to the CPS server,
+// the PASSporTs are kept opaque, so they can be encrypted by the publisher
+type CPSStore struct {
+	mu        sync.Mutex
+	entries   map[string][]cpsStoreEntry
+	retention time.Duration
+	maxPerKey int
+	maxTotal  int
+	total     int
+}
+
+var cpsStore *CPSStore = nil
+
+// NewCPSStore --
+func NewCPSStore(retention int, maxPerKey int, maxTotal int) *CPSStore {
+	s := &CPSStore{
+		entries:   make(map[string][]cpsStoreEntry),
+		retention: time.Duration(retention) * time.Second,
+		maxPerKey: maxPerKey,
+		maxTotal:  maxTotal,
+	}
+	go func() {
+		for range time.Tick(time.Second) {
+			s.Purge(time.Now())
+		}
+	}()
+	return s
+}
+
+func cpsStoreKey(destTN string, origTN string) string {
+	return secsipid.SJWTNormalizeTN(destTN) + "/" + secsipid.SJWTNormalizeTN(origTN)
+}
+
+// Add - store the PASSporTs for the call, the oldest ones for the same
+// call are dropped when the limit per call is exceeded
+func (s *CPSStore) Add(destTN string, origTN string, passports []string) error {
+	key := cpsStoreKey(destTN, origTN)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxTotal > 0 && s.total+len(passports) > s.maxTotal {
+		return fmt.Errorf("cps store is full")
+	}
+	list := s.entries[key]
+	for _, passport := range passports {
+		list = append(list, cpsStoreEntry{passport: passport, stored: now})
+	}
+	s.total += len(passports)
+	if s.maxPerKey > 0 && len(list) > s.maxPerKey {
+		s.total -= len(list) - s.maxPerKey
+		list = list[len(list)-s.maxPerKey:]
+	}
+	s.entries[key] = list
+	return nil
+}
+
+// Get - the PASSporTs stored for the call within the retention window
+func (s *CPSStore) Get(destTN string, origTN string) []string {
+	key := cpsStoreKey(destTN, origTN)
+	since := time.Now().Add(-s.retention)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	passports := []string{}
+	for _, entry := range s.entries[key] {
+		if entry.stored.After(since) {
+			passports = append(passports, entry.passport)
+		}
+	}
+	return passports
+}
+
+// Purge - remove the PASSporTs older than the retention window
+func (s *CPSStore) Purge(now time.Time) {
+	since := now.Add(-s.retention)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, list := range s.entries {
+		i := 0
+		for i < len(list) && !list[i].stored.After(since) {
+			i++
+		}
+		s.total -= i
+		if i == len(list) {
+			delete(s.entries, key)
+		} else if i > 0 {
+			s.entries[key] = list[i:]
+		}
+	}
+}
+
+// httpHandleV1CPSPassports - CPS resource: /v1/cps/passports/{DestTN}/{OrigTN}
+// cpsAuthorize - verify the bearer token of the CPS request: signed with the
+// certificate of its x5u, not expired, for the method of the request and with
+// the orig and dest claims of the passports resource
+func cpsAuthorize(r *http.Request, destTN string, origTN string) (int, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return secsipid.SJWTRetErr, errors.New("missing bearer token")
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	btoken := strings.Split(token, ".")
+	if len(btoken) != 3 {
+		return secsipid.SJWTRetErrSIPHdrParse, errors.New("invalid bearer token")
+	}
+	vHeader, err := secsipid.SJWTBase64DecodeString(btoken[0])
+	if err != nil {
+		return secsipid.SJWTRetErrJSONHdrParse, err
+	}
+	header := secsipid.SJWTHeader{}
+	if err = json.Unmarshal([]byte(vHeader), &header); err != nil {
+		return secsipid.SJWTRetErrJSONHdrParse, err
+	}
+	// only remote certificates, the x5u must not refer to local files
+	if !strings.HasPrefix(header.X5u, "https://") && !strings.HasPrefix(header.X5u, "http://") {
+		return secsipid.SJWTRetErrHTTPInvalidURL, fmt.Errorf("invalid x5u in bearer token: %s", header.X5u)
+	}
+	if ret, err := secsipid.SJWTCheckIdentityPKMode(token, cliops.expire, header.X5u, 0, cliops.timeout); err != nil {
+		return ret, err
+	}
+	vPayload, err := secsipid.SJWTBase64DecodeString(btoken[1])
+	if err != nil {
+		return secsipid.SJWTRetErrJSONPayloadParse, err
+	}
+	payload := struct {
+		Htm  string            `json:"htm"`
+		Orig secsipid.SJWTOrig `json:"orig"`
+		Dest secsipid.SJWTDest `json:"dest"`
+	}{}
+	if err = json.Unmarshal([]byte(vPayload), &payload); err != nil {
+		return secsipid.SJWTRetErrJSONPayloadParse, err
+	}
+	if payload.Htm != r.Method {
+		return secsipid.SJWTRetErr, fmt.Errorf("mismatching method in bearer token: %s", payload.Htm)
+	}
+	if secsipid.SJWTNormalizeTN(payload.Orig.TN) != secsipid.SJWTNormalizeTN(origTN) ||
+		len(payload.Dest.TN) != 1 || secsipid.SJWTNormalizeTN(payload.Dest.TN[0]) != secsipid.SJWTNormalizeTN(destTN) {
+		return secsipid.SJWTRetErr, errors.New("mismatching orig or dest in bearer token")
+	}
+	return secsipid.SJWTRetOK, nil
+}
+
+func httpHandleV1CPSPassports(w http.ResponseWriter, r *http.Request) {
+	tns := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/cps/passports/"), "/")
+	if len(tns) != 2 || len(tns[0]) == 0 || len(tns[1]) == 0 {
+		httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "invalid passports resource")
+		return
+	}
+	if ret, err := cpsAuthorize(r, tns[0], tns[1]); err != nil {
+		httpLogf(r, "cps request not authorized: %v\n", err)
+		httpError(w, http.StatusUnauthorized, httpErrUnauthorized, ret, "invalid bearer token")
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+			return
+		}
+		passports := CPSPassports{}
+		if err = json.Unmarshal(body, &passports); err != nil || len(passports.Passports) == 0 {
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid passports body")
+			return
+		}
+		if err = cpsStore.Add(tns[0], tns[1], passports.Passports); err != nil {
+			httpLogf(r, "failed to store passports: %v\n", err)
+			httpError(w, http.StatusServiceUnavailable, httpErrUnavailable, secsipid.SJWTRetErr, "cannot store passports")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&CPSPassports{Passports: cpsStore.Get(tns[0], tns[1])})
+	default:
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomagedon/expectate"
+)
+
+func TestHTTPHandleV1CPSPassports(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	prvBytes, _ := x509.MarshalECPrivateKey(key)
+	prvkeyPath := filepath.Join(t.TempDir(), "prvkey.pem")
+	os.WriteFile(prvkeyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes}), 0600)
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2024),
+		Subject:      pkix.Name{Organization: []string{"Carrier, Inc."}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certBytes, _ := x509.CreateCertificate(rand.Reader, cert, cert, &key.PublicKey, key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(certPEM)
+	}))
+	defer server.Close()
+
+	saved := cpsStore
+	defer func() { cpsStore = saved }()
+	cpsStore = NewCPSStore(60, 10, 100)
+	client, _ := NewCPSClient("http://cps.example.com/v1/cps", prvkeyPath, server.URL+"/cert.pem", 5)
+	localClient, _ := NewCPSClient("http://cps.example.com/v1/cps", prvkeyPath, certFileURL(t, certPEM), 5)
+	path := "/v1/cps/passports/493022222222/493011111111"
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		token  func() string
+		status int
+	}{
+		{"publish with valid token", "POST", func() string {
+			token, _ := client.authToken("POST", "", "493011111111", "493022222222")
+			return token
+		}, http.StatusCreated},
+		{"retrieve with valid token", "GET", func() string {
+			token, _ := client.authToken("GET", "", "+493011111111", "493022222222")
+			return token
+		}, http.StatusOK},
+		{"without token", "GET", func() string { return "" }, http.StatusUnauthorized},
+		{"token for another call", "GET", func() string {
+			token, _ := client.authToken("GET", "", "493011111111", "493033333333")
+			return token
+		}, http.StatusUnauthorized},
+		{"token for another method", "POST", func() string {
+			token, _ := client.authToken("GET", "", "493011111111", "493022222222")
+			return token
+		}, http.StatusUnauthorized},
+		{"token with local x5u", "GET", func() string {
+			token, _ := localClient.authToken("GET", "", "493011111111", "493022222222")
+			return token
+		}, http.StatusUnauthorized},
+		{"token with invalid signature", "GET", func() string {
+			token, _ := client.authToken("GET", "", "493011111111", "493022222222")
+			return token[:len(token)-4] + "AAAA"
+		}, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			r := httptest.NewRequest(tc.method, path, strings.NewReader(`{"passports":["a.b.c"]}`))
+			if token := tc.token(); len(token) > 0 {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			httpHandleV1CPSPassports(w, r)
+			expect(w.Code).ToBe(tc.status)
+		})
+	}
+}
+
+// certFileURL - write the certificate to a local file, returning its file URL
+func certFileURL(t *testing.T, certPEM []byte) string {
+	certPath := filepath.Join(t.TempDir(), "cert.pem")
+	os.WriteFile(certPath, certPEM, 0600)
+	return "file://" + certPath
+}
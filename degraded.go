@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// degradedSampleInterval - the interval to sample the counters of the
+// degraded paths
+const degradedSampleInterval = 10 * time.Second
+
+// degradedPaths - the degraded paths of the verifications, in output order
+var degradedPaths = []string{"cache", "softfail", "pin"}
+
+// degradedCount - the counter of the degraded path
+func degradedCount(stats secsipid.SJWTDegradedStats, path string) uint64 {
+	switch path {
+	case "cache":
+		return stats.Cache
+	case "softfail":
+		return stats.SoftFail
+	case "pin":
+		return stats.Pin
+	}
+	return 0
+}
+
+// DegradedMonitor - the fraction of the verifications done via the degraded
+// paths over the sliding window, with the warning thresholds per path
+type DegradedMonitor struct {
+	mu         sync.Mutex
+	thresholds map[string]float64
+	samples    []secsipid.SJWTDegradedStats
+	size       int
+	ratios     map[string]float64
+	warning    map[string]bool
+}
+
+var degradedMonitor *DegradedMonitor = nil
+
+// parseDegradedThresholds - the warning thresholds given as 'path=fraction,...'
+func parseDegradedThresholds(val string) (map[string]float64, error) {
+	thresholds := map[string]float64{}
+	for _, item := range strings.Split(val, ",") {
+		pathVal := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		known := false
+		for _, path := range degradedPaths {
+			known = known || (len(pathVal) == 2 && pathVal[0] == path)
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid degraded threshold: %s", item)
+		}
+		threshold, err := strconv.ParseFloat(pathVal[1], 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return nil, fmt.Errorf("invalid degraded threshold: %s", item)
+		}
+		thresholds[pathVal[0]] = threshold
+	}
+	return thresholds, nil
+}
+
+// NewDegradedMonitor - create the monitor with the thresholds and the window
+// (in seconds)
+func NewDegradedMonitor(thresholds map[string]float64, window int) *DegradedMonitor {
+	size := int(time.Duration(window)*time.Second/degradedSampleInterval) + 1
+	if size < 2 {
+		size = 2
+	}
+	return &DegradedMonitor{thresholds: thresholds, size: size, ratios: map[string]float64{},
+		warning: map[string]bool{}}
+}
+
+// Sample - add the current counters, updating the fractions over the window
+// and logging the changes of the warning state
+func (dm *DegradedMonitor) Sample(stats secsipid.SJWTDegradedStats) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.samples = append(dm.samples, stats)
+	if len(dm.samples) > dm.size {
+		dm.samples = dm.samples[len(dm.samples)-dm.size:]
+	}
+	first := dm.samples[0]
+	checks := stats.Checks - first.Checks
+	for _, path := range degradedPaths {
+		ratio := 0.0
+		if checks > 0 {
+			ratio = float64(degradedCount(stats, path)-degradedCount(first, path)) / float64(checks)
+		}
+		dm.ratios[path] = ratio
+		threshold, ok := dm.thresholds[path]
+		if !ok {
+			continue
+		}
+		if ratio > threshold && !dm.warning[path] {
+			log.Printf("degraded verifications via %s over threshold: %.4f > %.4f", path, ratio, threshold)
+		} else if ratio <= threshold && dm.warning[path] {
+			log.Printf("degraded verifications via %s back under threshold: %.4f <= %.4f", path, ratio, threshold)
+		}
+		dm.warning[path] = ratio > threshold
+	}
+}
+
+// Start - sample the counters periodically
+func (dm *DegradedMonitor) Start() {
+	dm.Sample(secsipid.SJWTDegradedGetStats())
+	go func() {
+		for range time.Tick(degradedSampleInterval) {
+			dm.Sample(secsipid.SJWTDegradedGetStats())
+		}
+	}()
+}
+
+// degradedWriteMetrics - the counters of the degraded paths and, if the
+// monitor is enabled, their fractions over the window, the burn rates (the
+// fraction divided by the threshold) and the warning states, in the
+// Prometheus text format
+func degradedWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	stats := secsipid.SJWTDegradedGetStats()
+	counter := func(name string, help string) string {
+		family := name
+		if openMetrics {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, help, family)
+		return name
+	}
+	name := counter("secsipidx_verifications_total", "Identity verifications with certificate fetching.")
+	fmt.Fprintf(w, "%s %d\n", name, stats.Checks)
+	name = counter("secsipidx_degraded_total", "Identity verifications via degraded paths, by path (cache, softfail, pin).")
+	for _, path := range degradedPaths {
+		fmt.Fprintf(w, "%s{path=%q} %d\n", name, path, degradedCount(stats, path))
+	}
+	if degradedMonitor == nil {
+		return
+	}
+	degradedMonitor.mu.Lock()
+	defer degradedMonitor.mu.Unlock()
+	fmt.Fprintf(w, "# HELP secsipidx_degraded_ratio Fraction of the verifications via degraded paths over the window.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_degraded_ratio gauge\n")
+	for _, path := range degradedPaths {
+		fmt.Fprintf(w, "secsipidx_degraded_ratio{path=%q} %g\n", path, degradedMonitor.ratios[path])
+	}
+	fmt.Fprintf(w, "# HELP secsipidx_degraded_burn_rate Fraction of the verifications via degraded paths divided by the threshold.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_degraded_burn_rate gauge\n")
+	for _, path := range degradedPaths {
+		if threshold, ok := degradedMonitor.thresholds[path]; ok {
+			fmt.Fprintf(w, "secsipidx_degraded_burn_rate{path=%q} %g\n", path, degradedMonitor.ratios[path]/threshold)
+		}
+	}
+	fmt.Fprintf(w, "# HELP secsipidx_degraded_warning Fraction of the verifications via degraded paths over the threshold (1 - yes, 0 - no).\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_degraded_warning gauge\n")
+	for _, path := range degradedPaths {
+		if _, ok := degradedMonitor.thresholds[path]; ok {
+			warning := 0
+			if degradedMonitor.warning[path] {
+				warning = 1
+			}
+			fmt.Fprintf(w, "secsipidx_degraded_warning{path=%q} %d\n", path, warning)
+		}
+	}
+}
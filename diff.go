@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// identityFields - the flattened fields of the Identity header value, with the
+// header members prefixed by 'header.', the claims by 'claims.' and the
+// parameters by 'param.'; the values are JSON encoded
+func identityFields(identityVal string) (map[string]string, error) {
+	fields := map[string]string{}
+	hdrtoken := strings.Split(secsipid.SJWTRemoveWhiteSpaces(identityVal), ";")
+	for _, param := range hdrtoken[1:] {
+		ptoken := strings.SplitN(param, "=", 2)
+		if len(ptoken) == 2 {
+			fields["param."+ptoken[0]] = strconv.Quote(ptoken[1])
+		}
+	}
+	btoken := strings.Split(hdrtoken[0], ".")
+	if len(btoken) != 3 {
+		return fields, fmt.Errorf("invalid token - must contain header, payload and signature")
+	}
+	for i, prefix := range []string{"header", "claims"} {
+		decoded, err := secsipid.SJWTBase64DecodeString(btoken[i])
+		if err != nil {
+			return fields, fmt.Errorf("invalid %s encoding: %v", prefix, err)
+		}
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(decoded)))
+		decoder.UseNumber()
+		if err = decoder.Decode(&value); err != nil {
+			return fields, fmt.Errorf("invalid %s json: %v", prefix, err)
+		}
+		flattenJSON(prefix, value, fields)
+	}
+	return fields, nil
+}
+
+// flattenJSON - add the leaf values of the JSON document to fields, with the
+// path of object members separated by '.' and the array indexes in brackets
+func flattenJSON(path string, value interface{}, fields map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for name, member := range v {
+			flattenJSON(path+"."+name, member, fields)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenJSON(path+"["+strconv.Itoa(i)+"]", item, fields)
+		}
+	default:
+		data, _ := json.Marshal(v)
+		fields[path] = string(data)
+	}
+}
+
+// diffIdentityValue - the identity value given as argument, which can be also
+// the path to a file with the identity, expanded if it is in compact form
+func diffIdentityValue(arg string) (string, error) {
+	identityVal := arg
+	if _, err := os.Stat(arg); err == nil {
+		data, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return "", err
+		}
+		identityVal = strings.TrimSpace(string(data))
+	}
+	if secsipid.SJWTIdentityIsCompact(identityVal) && len(cliops.pptclaims) > 0 {
+		expanded, _, err := secsipid.SJWTIdentityExpand(identityVal, []byte(cliops.pptclaims))
+		if err != nil {
+			return "", err
+		}
+		identityVal = expanded
+	}
+	return identityVal, nil
+}
+
+// secsipidxCLIDiff - print the differences between the header, the claims
+// and the parameters of two identity values and the result of checking them;
+// returns 0 if there are no differences, 1 otherwise
+func secsipidxCLIDiff() int {
+	if len(cliops.subargs) != 2 {
+		fmt.Printf("two identity values (or files) must be provided\n")
+		return cliExitArgs
+	}
+	var fields [2]map[string]string
+	var results [2]string
+	for i, arg := range cliops.subargs {
+		identityVal, err := diffIdentityValue(arg)
+		if err != nil {
+			fmt.Printf("identity %c: %v\n", 'A'+i, err)
+			return -1
+		}
+		if fields[i], err = identityFields(identityVal); err != nil {
+			fmt.Printf("identity %c: %v\n", 'A'+i, err)
+		}
+		ret, err := checkFullIdentity(identityVal)
+		results[i] = "ok"
+		if err != nil {
+			results[i] = fmt.Sprintf("failed (%d) %v", ret, err)
+		}
+	}
+
+	var names []string
+	for name := range fields[0] {
+		names = append(names, name)
+	}
+	for name := range fields[1] {
+		if _, ok := fields[0][name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Printf("--- A\n+++ B\n")
+	differences := 0
+	for _, name := range names {
+		valA, okA := fields[0][name]
+		valB, okB := fields[1][name]
+		if okA && okB && valA == valB {
+			if cliops.verbosity > 0 {
+				fmt.Printf("  %s: %s\n", name, valA)
+			}
+			continue
+		}
+		differences++
+		if okA {
+			fmt.Printf("- %s: %s\n", name, valA)
+		}
+		if okB {
+			fmt.Printf("+ %s: %s\n", name, valB)
+		}
+	}
+	if results[0] != results[1] {
+		differences++
+	}
+	fmt.Printf("check A: %s\n", results[0])
+	fmt.Printf("check B: %s\n", results[1])
+	if differences > 0 {
+		fmt.Printf("differences: %d\n", differences)
+		return 1
+	}
+	return 0
+}
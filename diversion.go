@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// DivRequest - body of the request to build the div identity
+type DivRequest struct {
+	Identities []string `json:"identities"`
+	Dest       string   `json:"dest"`
+	X5u        string   `json:"x5u,omitempty"`
+}
+
+// DivResponse - body of the response with the updated identities
+type DivResponse struct {
+	Identities []string `json:"identities"`
+}
+
+// verifyShakenIdentity - check the shaken identity out of the list
+func verifyShakenIdentity(identityVals []string) (int, error) {
+	for _, identityVal := range identityVals {
+		parts, ret, err := secsipid.SJWTParseIdentityParts(identityVal)
+		if err != nil {
+			return ret, err
+		}
+		if parts.Header.Ppt == "shaken" {
+			return checkFullIdentity(identityVal)
+		}
+	}
+	return secsipid.SJWTRetErrSIPHdrNoShaken, fmt.Errorf("no shaken identity")
+}
+
+// buildDivIdentities - verify the incoming shaken identity and add the div identity
+func buildDivIdentities(identityVals []string, destTN string, x5uVal string, keyName string) ([]string, int, error) {
+	prvkeyPath, x5uVal, err := signKey(keyName, x5uVal)
+	if err != nil {
+		return nil, secsipid.SJWTRetErr, err
+	}
+	ret, err := verifyShakenIdentity(identityVals)
+	if ret != secsipid.SJWTRetOK {
+		if err == nil {
+			err = fmt.Errorf("failed to verify shaken identity")
+		}
+		return nil, ret, err
+	}
+	return secsipid.SJWTGetDivIdentity(identityVals, destTN, x5uVal, prvkeyPath)
+}
+
+// readIdentityList - identities from file (one per line) or from cli parameter
+func readIdentityList() []string {
+	var identityVals []string
+	if len(cliops.fidentity) > 0 {
+		vIdentity, _ := ioutil.ReadFile(cliops.fidentity)
+		for _, line := range strings.Split(string(vIdentity), "\n") {
+			if len(strings.TrimSpace(line)) > 0 {
+				identityVals = append(identityVals, strings.TrimSpace(line))
+			}
+		}
+	} else if len(cliops.identity) > 0 {
+		identityVals = append(identityVals, cliops.identity)
+	}
+	return identityVals
+}
+
+func secsipidxCLIDiv() int {
+	identityVals := readIdentityList()
+	if len(identityVals) == 0 {
+		fmt.Printf("Identity value not provided\n")
+		return cliExitArgs
+	}
+	if len(cliops.desttn) == 0 {
+		fmt.Printf("new destination number not provided\n")
+		return cliExitArgs
+	}
+	identityOut, ret, err := buildDivIdentities(identityVals, cliops.desttn, cliops.x5u, cliops.keyname)
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	for _, identityVal := range identityOut {
+		fmt.Printf("%s\n", identityVal)
+	}
+	return 0
+}
+
+func httpHandleV1Div(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for building div identity ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	divReq := DivRequest{}
+	if err = json.Unmarshal(body, &divReq); err != nil || len(divReq.Identities) == 0 || len(divReq.Dest) == 0 {
+		httpLogf(r, "invalid div request body\n")
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+
+	identityOut, ret, err := buildDivIdentities(divReq.Identities, divReq.Dest, httpSignX5u(r, divReq.X5u), httpSignKeyName(r))
+	if err != nil {
+		httpLogf(r, "failed building div identity: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&DivResponse{Identities: identityOut})
+}
+
+// DivChainRequest - body of the request to check the diversion chain
+type DivChainRequest struct {
+	Identities []string `json:"identities"`
+}
+
+func secsipidxCLICheckChain() int {
+	identityVals := readIdentityList()
+	if len(identityVals) == 0 {
+		fmt.Printf("Identity value not provided\n")
+		return cliExitArgs
+	}
+	result, ret, _ := secsipid.SJWTCheckDivChain(identityVals, cliops.expire, cliops.fpubkey, cliops.timeout)
+	jresult, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Printf("%s\n", jresult)
+	return ret
+}
+
+func httpHandleV1CheckChain(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for diversion chain check ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	chainReq := DivChainRequest{}
+	if err = json.Unmarshal(body, &chainReq); err != nil || len(chainReq.Identities) == 0 {
+		httpLogf(r, "invalid diversion chain request body\n")
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+
+	result, ret, err := secsipid.SJWTCheckDivChain(chainReq.Identities, cliops.expire, cliops.fpubkey, cliops.timeout)
+	if err != nil {
+		httpLogf(r, "failed checking diversion chain: (%d) %v\n", ret, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RedirectRequest - body of the request to build the identities for the
+// INVITE recursed on a 3xx redirect
+type RedirectRequest struct {
+	Identities []string `json:"identities"`
+	Target     string   `json:"target"`
+	Policy     string   `json:"policy,omitempty"`
+	X5u        string   `json:"x5u,omitempty"`
+}
+
+// redirectPolicy - the library value of the redirect policy name, with div
+// as default
+func redirectPolicy(name string) (int, error) {
+	switch name {
+	case "", "div":
+		return secsipid.RedirectPolicyDiv, nil
+	case "resign":
+		return secsipid.RedirectPolicyResign, nil
+	case "keep":
+		return secsipid.RedirectPolicyKeep, nil
+	}
+	return 0, fmt.Errorf("unknown redirect policy: %s", name)
+}
+
+// buildRedirectIdentities - verify the incoming shaken identity and build the
+// identities for the redirect target
+func buildRedirectIdentities(identityVals []string, target string, policyName string, x5uVal string,
+	keyName string) ([]string, int, error) {
+	policy, err := redirectPolicy(policyName)
+	if err != nil {
+		return nil, secsipid.SJWTRetErr, err
+	}
+	prvkeyPath, x5uVal, err := signKey(keyName, x5uVal)
+	if err != nil {
+		return nil, secsipid.SJWTRetErr, err
+	}
+	ret, err := verifyShakenIdentity(identityVals)
+	if ret != secsipid.SJWTRetOK {
+		if err == nil {
+			err = fmt.Errorf("failed to verify shaken identity")
+		}
+		return nil, ret, err
+	}
+	return secsipid.SJWTGetRedirectIdentity(identityVals, target, policy, cliops.resignage, x5uVal, prvkeyPath)
+}
+
+func secsipidxCLIRedirect() int {
+	identityVals := readIdentityList()
+	if len(identityVals) == 0 {
+		fmt.Printf("Identity value not provided\n")
+		return cliExitArgs
+	}
+	if len(cliops.redirtarget) == 0 {
+		fmt.Printf("redirect target not provided\n")
+		return cliExitArgs
+	}
+	identityOut, ret, err := buildRedirectIdentities(identityVals, cliops.redirtarget, cliops.redirpolicy, cliops.x5u, cliops.keyname)
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	for _, identityVal := range identityOut {
+		fmt.Printf("%s\n", identityVal)
+	}
+	return 0
+}
+
+func httpHandleV1Redirect(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for building redirect identities ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	redirReq := RedirectRequest{}
+	if err = json.Unmarshal(body, &redirReq); err != nil || len(redirReq.Identities) == 0 || len(redirReq.Target) == 0 {
+		httpLogf(r, "invalid redirect request body\n")
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+	if len(redirReq.Policy) == 0 {
+		redirReq.Policy = cliops.redirpolicy
+	}
+
+	identityOut, ret, err := buildRedirectIdentities(redirReq.Identities, redirReq.Target, redirReq.Policy, httpSignX5u(r, redirReq.X5u), httpSignKeyName(r))
+	if err != nil {
+		httpLogf(r, "failed building redirect identities: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&DivResponse{Identities: identityOut})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// EventRecord - sign or check event sent to the HEP capture server or stored in database
+type EventRecord struct {
+	Event   string `json:"event"`
+	Code    int    `json:"code"`
+	Result  string `json:"result"`
+	OrigTN  string `json:"origtn,omitempty"`
+	DestTN  string `json:"desttn,omitempty"`
+	OrigID  string `json:"origid,omitempty"`
+	CallID  string `json:"callid,omitempty"`
+	ReqID   string `json:"requestid,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// eventsEnabled - true if there is any destination for the events
+func eventsEnabled() bool {
+	return hepClient != nil || dbStore != nil
+}
+
+// emitEvent - send the event to all enabled destinations
+func emitEvent(ev *EventRecord, srcAddr string, dstAddr string) {
+	if !eventsEnabled() {
+		return
+	}
+	if ev.Code == 0 {
+		ev.Result = "ok"
+	} else {
+		ev.Result = "failed"
+	}
+	hepSendEvent(ev, srcAddr, dstAddr)
+	dbStoreEvent(ev)
+}
+
+// httpRequestAddrs - source and destination addresses of an http request
+func httpRequestAddrs(r *http.Request) (string, string) {
+	dstAddr := ""
+	if laddr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		dstAddr = laddr.String()
+	}
+	return r.RemoteAddr, dstAddr
+}
+
+// httpRequestID - the request id of an http request, provided with X-Request-ID
+// header or generated when the request is received
+func httpRequestID(r *http.Request) string {
+	return r.Header.Get("X-Request-ID")
+}
+
+// httpLogf - print the log message prefixed with the request id
+func httpLogf(r *http.Request, format string, a ...interface{}) {
+	fmt.Printf("[%s] "+format, append([]interface{}{httpRequestID(r)}, a...)...)
+}
+
+// httpRequestCallID - the Call-ID provided with an http request
+func httpRequestCallID(r *http.Request) string {
+	if v := r.Header.Get("X-Call-ID"); len(v) > 0 {
+		return v
+	}
+	return r.Header.Get("Call-ID")
+}
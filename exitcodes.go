@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// exit codes of the CLI by class of failure, for the shell scripts
+const (
+	cliExitOK        = 0
+	cliExitFailure   = 1
+	cliExitArgs      = 2
+	cliExitKey       = 3
+	cliExitSignature = 4
+	cliExitExpired   = 5
+	cliExitCert      = 6
+	cliExitNetwork   = 7
+	cliExitInvalid   = 8
+)
+
+// cliExitCode - the exit code for the result of a subcommand, the library
+// return codes (negative) being mapped to their class of failure, the exit
+// codes (positive) returned as they are
+func cliExitCode(ret int) int {
+	if ret >= 0 {
+		return ret
+	}
+	switch ret {
+	case secsipid.SJWTRetErrPrvKeyInvalid, secsipid.SJWTRetErrPrvKeyInvalidFormat,
+		secsipid.SJWTRetErrJSONSignatureFailure:
+		return cliExitKey
+	case secsipid.SJWTRetErrCertOCSPUnavailable:
+		return cliExitNetwork
+	case secsipid.SJWTRetErrFileRead:
+		return cliExitFailure
+	}
+	switch secsipid.SJWTRetClass(ret) {
+	case "signature":
+		return cliExitSignature
+	case "freshness":
+		return cliExitExpired
+	case "certificate":
+		return cliExitCert
+	case "fetch":
+		return cliExitNetwork
+	case "header", "payload", "identity", "policy":
+		return cliExitInvalid
+	}
+	return cliExitFailure
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// TNAuthList certificate extension (RFC 8226)
+var fixturesOIDTNAuthList = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 26}
+
+// Fixture - test certificate of the fixtures mode, issued by the fixtures CA,
+// with the matching key used for signing
+type Fixture struct {
+	Name string `json:"name"`
+	SPC  string `json:"spc,omitempty"`
+	X5u  string `json:"x5u"`
+
+	cert []byte
+}
+
+// FixturesInfo - the fixtures CA and certificates, returned by /v1/fixtures
+type FixturesInfo struct {
+	CA       string    `json:"ca"`
+	Dir      string    `json:"dir"`
+	Fixtures []Fixture `json:"fixtures"`
+
+	caCert []byte
+}
+
+var fixtures *FixturesInfo = nil
+
+// fixturesBaseURL - the base URL of the fixtures, by default the address of
+// the http server
+func fixturesBaseURL() string {
+	if len(cliops.fixturesurl) > 0 {
+		return strings.TrimSuffix(cliops.fixturesurl, "/")
+	}
+	scheme, addr := "http", cliops.httpsrv
+	if len(addr) == 0 {
+		scheme, addr = "https", cliops.httpssrv
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "127.0.0.1" + addr
+	}
+	return scheme + "://" + addr
+}
+
+// fixturesKeyCert - load the key and the certificate with the name from the
+// directory, generating them if they do not exist, are expired, are not
+// issued by parent or renew is set; the certificate is self-signed if parent
+// is nil
+func fixturesKeyCert(dir string, name string, spc string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+	renew bool) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	keyPath := filepath.Join(dir, name+"-private.pem")
+	certPath := filepath.Join(dir, name+".pem")
+	if !renew {
+		keyData, kerr := ioutil.ReadFile(keyPath)
+		certData, cerr := ioutil.ReadFile(certPath)
+		if kerr == nil && cerr == nil {
+			keyBlock, _ := pem.Decode(keyData)
+			certBlock, _ := pem.Decode(certData)
+			if keyBlock != nil && certBlock != nil {
+				key, kerr := x509.ParseECPrivateKey(keyBlock.Bytes)
+				cert, cerr := x509.ParseCertificate(certBlock.Bytes)
+				if kerr == nil && cerr == nil && time.Now().Add(24*time.Hour).Before(cert.NotAfter) &&
+					(parent == nil || cert.CheckSignatureFrom(parent) == nil) {
+					return cert, key, nil
+				}
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "SHAKEN " + name, Organization: []string{"secsipidx fixtures"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		template.NotAfter = time.Now().AddDate(10, 0, 0)
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	if len(spc) > 0 {
+		spcValue, _ := asn1.MarshalWithParams(spc, "ia5")
+		extValue, _ := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: spcValue}})
+		template.ExtraExtensions = []pkix.Extension{{Id: fixturesOIDTNAuthList, Value: extValue}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	if err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, nil, err
+	}
+	if err = ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// fixturesInit - load or generate the fixtures CA and the certificates given
+// as 'name[:spc],...', set the keyring to sign with their keys and trust the
+// fixtures CA if no other CA file is set
+func fixturesInit(spec string) error {
+	if len(cliops.keyringfile) > 0 {
+		return errors.New("fixtures cannot be used with a keyring")
+	}
+	dir := cliops.fixturesdir
+	if len(dir) == 0 {
+		var err error
+		if dir, err = ioutil.TempDir("", "secsipidx-fixtures"); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	caCert, caKey, err := fixturesKeyCert(dir, "ca", "", nil, nil, false)
+	if err != nil {
+		return fmt.Errorf("fixtures CA: %v", err)
+	}
+
+	baseURL := fixturesBaseURL()
+	info := &FixturesInfo{CA: baseURL + "/v1/fixtures/ca.pem", Dir: dir,
+		caCert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})}
+	ring := &Keyring{}
+	for _, item := range strings.Split(spec, ",") {
+		nameSPC := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		fixture := Fixture{Name: nameSPC[0]}
+		if len(nameSPC) == 2 {
+			fixture.SPC = nameSPC[1]
+		}
+		if len(fixture.Name) == 0 || fixture.Name == "ca" || strings.ContainsAny(fixture.Name, "/\\.") {
+			return fmt.Errorf("invalid fixture name: %s", item)
+		}
+		cert, _, err := fixturesKeyCert(dir, fixture.Name, fixture.SPC, caCert, caKey, false)
+		if err != nil {
+			return fmt.Errorf("fixture %s: %v", fixture.Name, err)
+		}
+		spc, _, _ := secsipid.SJWTGetCertSPC(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		if spc != fixture.SPC {
+			// the spc was changed, the certificate is issued again
+			if cert, _, err = fixturesKeyCert(dir, fixture.Name, fixture.SPC, caCert, caKey, true); err != nil {
+				return fmt.Errorf("fixture %s: %v", fixture.Name, err)
+			}
+		}
+		fixture.X5u = baseURL + "/v1/fixtures/" + fixture.Name + ".pem"
+		fixture.cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		info.Fixtures = append(info.Fixtures, fixture)
+		ring.Keys = append(ring.Keys, KeyringKey{Name: fixture.Name,
+			PrvKey: filepath.Join(dir, fixture.Name+"-private.pem"), X5u: fixture.X5u})
+	}
+	ring.Default = ring.Keys[0].Name
+
+	// the keyring is written to be reused by other instances signing with the fixtures
+	ringPath := filepath.Join(dir, "keyring.json")
+	ringData, _ := json.MarshalIndent(ring, "", "  ")
+	if err = ioutil.WriteFile(ringPath, ringData, 0644); err != nil {
+		return err
+	}
+	if keyring, err = LoadKeyring(ringPath); err != nil {
+		return err
+	}
+	if len(cliops.cafile) == 0 {
+		secsipid.SJWTLibOptSetS("CertCAFile", filepath.Join(dir, "ca.pem"))
+	}
+	fixtures = info
+	return nil
+}
+
+// httpHandleV1Fixtures - GET /v1/fixtures for the list of the fixtures and
+// GET /v1/fixtures/{name}.pem for the certificates (ca.pem for the CA)
+func httpHandleV1Fixtures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/v1/fixtures"), "/")
+	if len(name) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(fixtures)
+		return
+	}
+	var cert []byte
+	if name == "ca.pem" {
+		cert = fixtures.caCert
+	}
+	for _, fixture := range fixtures.Fixtures {
+		if name == fixture.Name+".pem" {
+			cert = fixture.cert
+		}
+	}
+	if cert == nil {
+		httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "certificate not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(cert)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// fuzzMutations - the mutations of the PASSporTs, in output order
+var fuzzMutations = []string{"bitflip", "truncate", "segments", "params", "claim-type", "header-type"}
+
+// fuzzTypeValues - the values replacing the claims for the type confusion
+var fuzzTypeValues = []interface{}{"4930123", 4930123, true, []interface{}{}, map[string]interface{}{},
+	[]interface{}{"4930123"}, map[string]interface{}{"tn": "4930123"}, -1}
+
+// fuzzKind - the JSON type of the decoded value
+func fuzzKind(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case int, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "null"
+}
+
+// FuzzFinding - a mutated PASSporT that crashed the verifier or got an
+// inconsistent verdict
+type FuzzFinding struct {
+	Iteration int    `json:"iteration"`
+	Mutation  string `json:"mutation"`
+	Finding   string `json:"finding"`
+	Code      int    `json:"code"`
+	Message   string `json:"message,omitempty"`
+	Identity  string `json:"identity"`
+}
+
+// fuzzer - the signing key and the original PASSporT to mutate
+type fuzzer struct {
+	rnd      *mrand.Rand
+	prvkey   []byte
+	pubkey   string
+	header   map[string]interface{}
+	payload  map[string]interface{}
+	identity string
+	params   string
+}
+
+// newFuzzer - a fuzzer with an ephemeral key and a valid PASSporT
+func newFuzzer(seed int64) (*fuzzer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	prvDer, _ := x509.MarshalECPrivateKey(key)
+	pubDer, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	fz := &fuzzer{rnd: mrand.New(mrand.NewSource(seed)),
+		prvkey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvDer}),
+		pubkey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}))}
+	identityVal, _, err := secsipid.SJWTGetIdentityPrvKey("493044442222", "493088886666", "A", "",
+		"https://certs.example.com/fuzz.pem", fz.prvkey)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(identityVal, ";", 2)
+	fz.identity, fz.params = parts[0], parts[1]
+	segments := strings.Split(fz.identity, ".")
+	for i, target := range []*map[string]interface{}{&fz.header, &fz.payload} {
+		data, err := secsipid.SJWTBase64DecodeBytes(segments[i])
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, target); err != nil {
+			return nil, err
+		}
+	}
+	return fz, nil
+}
+
+// sign - the PASSporT with the header and the payload, signed with the key
+func (fz *fuzzer) sign(header map[string]interface{}, payload map[string]interface{}) string {
+	headerJSON, _ := json.Marshal(header)
+	payloadJSON, _ := json.Marshal(payload)
+	token, _, err := secsipid.SJWTEncodeTextWithPrvKey(string(headerJSON), string(payloadJSON), string(fz.prvkey))
+	if err != nil {
+		return fz.identity
+	}
+	return token
+}
+
+// confuseValue - a value of another JSON type than the one of the claim
+func (fz *fuzzer) confuseValue(claim interface{}) interface{} {
+	for {
+		value := fuzzTypeValues[fz.rnd.Intn(len(fuzzTypeValues))]
+		if fuzzKind(value) != fuzzKind(claim) {
+			return value
+		}
+	}
+}
+
+// confuse - a copy of the claims with one (or a nested one) replaced by a
+// value of another type
+func (fz *fuzzer) confuse(claims map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(claims)
+	mutated := map[string]interface{}{}
+	json.Unmarshal(data, &mutated)
+	names := make([]string, 0, len(mutated))
+	for name := range mutated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	name := names[fz.rnd.Intn(len(names))]
+	if nested, ok := mutated[name].(map[string]interface{}); ok && len(nested) > 0 && fz.rnd.Intn(2) == 0 {
+		for sub := range nested {
+			nested[sub] = fz.confuseValue(nested[sub])
+			break
+		}
+	} else {
+		mutated[name] = fz.confuseValue(mutated[name])
+	}
+	return mutated
+}
+
+// mutate - the mutated identity for the mutation
+func (fz *fuzzer) mutate(mutation string) string {
+	token, params := fz.identity, fz.params
+	switch mutation {
+	case "bitflip":
+		data := []byte(token)
+		for n := 1 + fz.rnd.Intn(3); n > 0; n-- {
+			data[fz.rnd.Intn(len(data))] ^= 1 << uint(fz.rnd.Intn(8))
+		}
+		token = string(data)
+	case "truncate":
+		segments := strings.Split(token, ".")
+		i := fz.rnd.Intn(len(segments))
+		segments[i] = segments[i][:fz.rnd.Intn(len(segments[i])+1)]
+		token = strings.Join(segments, ".")
+	case "segments":
+		segments := strings.Split(token, ".")
+		i := fz.rnd.Intn(len(segments))
+		switch fz.rnd.Intn(3) {
+		case 0:
+			segments = append(segments[:i], segments[i+1:]...)
+		case 1:
+			segments = append(segments[:i+1], segments[i:]...)
+		default:
+			j := fz.rnd.Intn(len(segments))
+			segments[i], segments[j] = segments[j], segments[i]
+		}
+		token = strings.Join(segments, ".")
+	case "params":
+		items := strings.Split(params, ";")
+		i := fz.rnd.Intn(len(items))
+		switch fz.rnd.Intn(3) {
+		case 0:
+			items = append(items[:i], items[i+1:]...)
+		case 1:
+			items = append(items, items[i])
+		default:
+			items[i] = strings.SplitN(items[i], "=", 2)[0] + "=" + fmt.Sprint(fuzzTypeValues[fz.rnd.Intn(len(fuzzTypeValues))])
+		}
+		params = strings.Join(items, ";")
+	case "claim-type":
+		token = fz.sign(fz.header, fz.confuse(fz.payload))
+	case "header-type":
+		token = fz.sign(fz.confuse(fz.header), fz.payload)
+	}
+	return token + ";" + params
+}
+
+// fuzzSame - true if the decoded segments of the token are the ones of the
+// original PASSporT, the mutation being then only in the encoding
+func fuzzSame(token string, original string) bool {
+	a, b := strings.Split(token, "."), strings.Split(original, ".")
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		da, erra := secsipid.SJWTBase64DecodeBytes(a[i])
+		db, _ := secsipid.SJWTBase64DecodeBytes(b[i])
+		if erra != nil || string(da) != string(db) {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzCheck - verify the identity, catching the crashes
+func fuzzCheck(identityVal string, pubkey string) (ret int, err error, crash string) {
+	defer func() {
+		if r := recover(); r != nil {
+			crash = fmt.Sprint(r)
+		}
+	}()
+	ret, err = secsipid.SJWTCheckFullIdentityPubKey(identityVal, cliops.expire, pubkey)
+	return ret, err, ""
+}
+
+// fuzzIteration - mutate the PASSporT and verify it, returning the finding
+// or nil if the verdict is consistent
+func (fz *fuzzer) fuzzIteration(iteration int, mutation string) (*FuzzFinding, bool) {
+	identityVal := fz.mutate(mutation)
+	finding := &FuzzFinding{Iteration: iteration, Mutation: mutation, Identity: identityVal}
+	ret, err, crash := fuzzCheck(identityVal, fz.pubkey)
+	finding.Code, finding.Message = ret, errorMessage(err)
+	switch {
+	case len(crash) > 0:
+		finding.Finding, finding.Message = "crash", crash
+	case (ret == secsipid.SJWTRetOK) != (err == nil):
+		finding.Finding = "inconsistent return code and error"
+	case ret == secsipid.SJWTRetOK && (mutation == "claim-type" || mutation == "header-type"):
+		finding.Finding = "accepted claim of wrong type"
+	case ret == secsipid.SJWTRetOK && mutation != "params" &&
+		!fuzzSame(strings.SplitN(identityVal, ";", 2)[0], fz.identity):
+		finding.Finding = "accepted mutated passport"
+	default:
+		if ret2, _, _ := fuzzCheck(identityVal, fz.pubkey); ret2 != ret {
+			finding.Finding = fmt.Sprintf("non-deterministic verdict (%d, then %d)", ret, ret2)
+			break
+		}
+		return nil, ret == secsipid.SJWTRetOK
+	}
+	return finding, ret == secsipid.SJWTRetOK
+}
+
+// secsipidxCLIFuzz - verify structurally mutated PASSporTs, writing the
+// findings as JSON lines and a summary per mutation
+func secsipidxCLIFuzz() int {
+	if cliops.fuzziter <= 0 {
+		fmt.Printf("invalid number of fuzzing iterations: %d\n", cliops.fuzziter)
+		return cliExitArgs
+	}
+	seed := cliops.fuzzseed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	fz, err := newFuzzer(seed)
+	if err != nil {
+		fmt.Printf("failed to build the passport: %v\n", err)
+		return -1
+	}
+	if ret, err, _ := fuzzCheck(fz.identity+";"+fz.params, fz.pubkey); ret != secsipid.SJWTRetOK {
+		fmt.Printf("the original passport is not valid: (%d) %v\n", ret, err)
+		return ret
+	}
+	out := os.Stdout
+	if len(cliops.fuzzout) > 0 {
+		if out, err = os.Create(cliops.fuzzout); err != nil {
+			fmt.Printf("failed to create the findings file: %v\n", err)
+			return -1
+		}
+		defer out.Close()
+	}
+	enc := json.NewEncoder(out)
+	accepted := map[string]int{}
+	findings := map[string]int{}
+	for i := 0; i < cliops.fuzziter; i++ {
+		mutation := fuzzMutations[i%len(fuzzMutations)]
+		finding, ok := fz.fuzzIteration(i, mutation)
+		if ok {
+			accepted[mutation]++
+		}
+		if finding != nil {
+			findings[mutation]++
+			enc.Encode(finding)
+		}
+	}
+	total := 0
+	fmt.Fprintf(os.Stderr, "seed: %d, iterations: %d\n", seed, cliops.fuzziter)
+	for _, mutation := range fuzzMutations {
+		fmt.Fprintf(os.Stderr, "%-12s accepted: %d, findings: %d\n", mutation, accepted[mutation], findings[mutation])
+		total += findings[mutation]
+	}
+	if total > 0 {
+		return -1
+	}
+	return 0
+}
@@ -5,4 +5,7 @@ go 1.16
 require (
 	github.com/gomagedon/expectate v1.1.0
 	github.com/google/uuid v1.4.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.16
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da
 )
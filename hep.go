@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HEPv3 chunk types (generic chunks, vendor id 0)
+const (
+	hepChunkIPFamily    = 0x0001
+	hepChunkIPProto     = 0x0002
+	hepChunkSrcIPv4     = 0x0003
+	hepChunkDstIPv4     = 0x0004
+	hepChunkSrcIPv6     = 0x0005
+	hepChunkDstIPv6     = 0x0006
+	hepChunkSrcPort     = 0x0007
+	hepChunkDstPort     = 0x0008
+	hepChunkTimeSec     = 0x0009
+	hepChunkTimeUSec    = 0x000a
+	hepChunkProtoType   = 0x000b
+	hepChunkCaptureID   = 0x000c
+	hepChunkCapturePass = 0x000e
+	hepChunkPayload     = 0x000f
+	hepChunkCorrelation = 0x0011
+)
+
+// HEP protocol type used for the events (JSON/log data)
+const hepProtoTypeLog = 100
+
+// hepDialTimeout - the timeout to connect to the capture server
+const hepDialTimeout = 2 * time.Second
+
+// hepWriteTimeout - the timeout to write a packet to the capture server
+const hepWriteTimeout = 2 * time.Second
+
+// hepQueueSize - the number of packets waiting to be sent in server mode,
+// the events are dropped when it is full
+const hepQueueSize = 1024
+
+// HEPClient - sender of HEPv3 packets to a Homer capture server, the
+// connection being opened again after a write error (e.g., the server was
+// restarted)
+type HEPClient struct {
+	mu        sync.Mutex
+	queue     chan []byte
+	conn      net.Conn
+	addr      string
+	proto     string
+	captureID uint32
+	password  string
+}
+
+var hepClient *HEPClient = nil
+
+// NewHEPClient - the packets are sent in background through a queue of the
+// given size, or directly by HEPSend() if the size is 0
+func NewHEPClient(addr string, proto string, captureID int, password string, queueSize int) (*HEPClient, error) {
+	if proto != "udp" && proto != "tcp" {
+		return nil, fmt.Errorf("invalid hep transport: %s", proto)
+	}
+	conn, err := net.DialTimeout(proto, addr, hepDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &HEPClient{
+		conn:      conn,
+		addr:      addr,
+		proto:     proto,
+		captureID: uint32(captureID),
+		password:  password,
+	}
+	if queueSize > 0 {
+		c.queue = make(chan []byte, queueSize)
+		go c.run()
+	}
+	return c, nil
+}
+
+// ipProto - the IP protocol number of the transport to the capture server
+func (c *HEPClient) ipProto() uint8 {
+	if c.proto == "tcp" {
+		return 6
+	}
+	return 17
+}
+
+func hepAppendChunk(buf *bytes.Buffer, ctype uint16, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint16(0))
+	binary.Write(buf, binary.BigEndian, ctype)
+	binary.Write(buf, binary.BigEndian, uint16(6+len(data)))
+	buf.Write(data)
+}
+
+func hepAppendUint8(buf *bytes.Buffer, ctype uint16, v uint8) {
+	hepAppendChunk(buf, ctype, []byte{v})
+}
+
+func hepAppendUint16(buf *bytes.Buffer, ctype uint16, v uint16) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	hepAppendChunk(buf, ctype, b)
+}
+
+func hepAppendUint32(buf *bytes.Buffer, ctype uint16, v uint32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	hepAppendChunk(buf, ctype, b)
+}
+
+func hepSplitHostPort(addr string) (net.IP, uint16) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	nport, _ := strconv.Atoi(port)
+	return ip, uint16(nport)
+}
+
+// HEPEncode - build the HEPv3 packet for the event
+func (c *HEPClient) HEPEncode(ev *EventRecord, srcAddr string, dstAddr string, tv time.Time) ([]byte, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	srcIP, srcPort := hepSplitHostPort(srcAddr)
+	dstIP, dstPort := hepSplitHostPort(dstAddr)
+
+	var chunks bytes.Buffer
+	if srcIP.To4() != nil && dstIP.To4() != nil {
+		hepAppendUint8(&chunks, hepChunkIPFamily, 2)
+		hepAppendUint8(&chunks, hepChunkIPProto, c.ipProto())
+		hepAppendChunk(&chunks, hepChunkSrcIPv4, srcIP.To4())
+		hepAppendChunk(&chunks, hepChunkDstIPv4, dstIP.To4())
+	} else {
+		hepAppendUint8(&chunks, hepChunkIPFamily, 10)
+		hepAppendUint8(&chunks, hepChunkIPProto, c.ipProto())
+		hepAppendChunk(&chunks, hepChunkSrcIPv6, srcIP.To16())
+		hepAppendChunk(&chunks, hepChunkDstIPv6, dstIP.To16())
+	}
+	hepAppendUint16(&chunks, hepChunkSrcPort, srcPort)
+	hepAppendUint16(&chunks, hepChunkDstPort, dstPort)
+	hepAppendUint32(&chunks, hepChunkTimeSec, uint32(tv.Unix()))
+	hepAppendUint32(&chunks, hepChunkTimeUSec, uint32(tv.Nanosecond()/1000))
+	hepAppendUint8(&chunks, hepChunkProtoType, hepProtoTypeLog)
+	hepAppendUint32(&chunks, hepChunkCaptureID, c.captureID)
+	if len(c.password) > 0 {
+		hepAppendChunk(&chunks, hepChunkCapturePass, []byte(c.password))
+	}
+	if len(ev.CallID) > 0 {
+		hepAppendChunk(&chunks, hepChunkCorrelation, []byte(ev.CallID))
+	}
+	hepAppendChunk(&chunks, hepChunkPayload, payload)
+
+	if chunks.Len()+6 > 0xffff {
+		return nil, fmt.Errorf("hep packet too large: %d", chunks.Len()+6)
+	}
+	var pkt bytes.Buffer
+	pkt.WriteString("HEP3")
+	binary.Write(&pkt, binary.BigEndian, uint16(chunks.Len()+6))
+	pkt.Write(chunks.Bytes())
+
+	return pkt.Bytes(), nil
+}
+
+// HEPSend - encode the event and queue it for sending, without waiting for
+// the capture server, or send it directly if there is no queue
+func (c *HEPClient) HEPSend(ev *EventRecord, srcAddr string, dstAddr string) error {
+	pkt, err := c.HEPEncode(ev, srcAddr, dstAddr, time.Now())
+	if err != nil {
+		return err
+	}
+	if c.queue == nil {
+		return c.write(pkt)
+	}
+	select {
+	case c.queue <- pkt:
+		return nil
+	default:
+		return errors.New("hep queue full, event dropped")
+	}
+}
+
+// run - send the queued packets
+func (c *HEPClient) run() {
+	for pkt := range c.queue {
+		if err := c.write(pkt); err != nil {
+			log.Printf("failed to send hep event: %v", err)
+		}
+	}
+}
+
+// write - send the packet, connecting again and retrying once if it fails,
+// the next packets try again if it fails
+func (c *HEPClient) write(pkt []byte) error {
+	var err error
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.SetWriteDeadline(time.Now().Add(hepWriteTimeout))
+		if _, err = c.conn.Write(pkt); err == nil {
+			return nil
+		}
+		c.conn.Close()
+		c.conn = nil
+	}
+	if c.conn, err = net.DialTimeout(c.proto, c.addr, hepDialTimeout); err != nil {
+		c.conn = nil
+		return err
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(hepWriteTimeout))
+	_, err = c.conn.Write(pkt)
+	return err
+}
+
+// hepSendEvent - send the event if the HEP client is enabled, errors are only logged
+func hepSendEvent(ev *EventRecord, srcAddr string, dstAddr string) {
+	if hepClient == nil {
+		return
+	}
+	if err := hepClient.HEPSend(ev, srcAddr, dstAddr); err != nil {
+		log.Printf("failed to send hep event: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomagedon/expectate"
+)
+
+func TestHEPSend(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+	received := func() int {
+		count := 0
+		buf := make([]byte, 65535)
+		for {
+			server.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			if _, _, err := server.ReadFrom(buf); err != nil {
+				return count
+			}
+			count++
+		}
+	}
+	ev := &EventRecord{Event: "check", CallID: "c1"}
+
+	for _, tc := range []struct {
+		name      string
+		queueSize int
+	}{
+		{"sent directly", 0},
+		{"sent through the queue", 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			client, err := NewHEPClient(server.LocalAddr().String(), "udp", 2001, "", tc.queueSize)
+			expect(err).ToBe(nil)
+			expect(client.HEPSend(ev, "127.0.0.1:8090", "127.0.0.1:5060")).ToBe(nil)
+			expect(client.HEPSend(ev, "127.0.0.1:8090", "127.0.0.1:5060")).ToBe(nil)
+			expect(received()).ToBe(2)
+		})
+	}
+
+	t.Run("dropped when the queue is full", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		client := &HEPClient{queue: make(chan []byte, 1), addr: server.LocalAddr().String(), proto: "udp"}
+		expect(client.HEPSend(ev, "127.0.0.1:8090", "127.0.0.1:5060")).ToBe(nil)
+		expect(client.HEPSend(ev, "127.0.0.1:8090", "127.0.0.1:5060") == nil).ToBe(false)
+		expect(len(client.queue)).ToBe(1)
+	})
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/google/uuid"
+)
+
+// httpGzipWriter - response writer compressing the body with gzip
+type httpGzipWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w *httpGzipWriter) Write(b []byte) (int, error) {
+	return w.gz.Write(b)
+}
+
+// Flush - write the compressed data buffered so far, needed for streaming
+func (w *httpGzipWriter) Flush() {
+	w.gz.Flush()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *httpGzipWriter) WriteHeader(code int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// httpAcceptsGzip - true if the client accepts gzip encoded response
+func httpAcceptsGzip(r *http.Request) bool {
+	for _, item := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(item, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// httpRequestJSON - true if the request body is a JSON document
+func httpRequestJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// httpAcceptsJSON - true if the client prefers application/json over text/plain
+// for the response; without Accept header, the type of the request body is used
+func httpAcceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if len(accept) == 0 {
+		return httpRequestJSON(r)
+	}
+	qJSON, qText := -1.0, -1.0
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			if q > qJSON {
+				qJSON = q
+			}
+		case "text/plain", "text/*", "*/*":
+			if q > qText {
+				qText = q
+			}
+		}
+	}
+	return qJSON > 0 && qJSON > qText
+}
+
+// httpWriteResult - write the result as JSON document or as text, based on
+// the content negotiation
+func httpWriteResult(w http.ResponseWriter, r *http.Request, text string, jsonResult interface{}) {
+	if httpAcceptsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jsonResult)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s\n", text)
+}
+
+// CheckResult - JSON response of the check endpoints
+type CheckResult struct {
+	Result     string                   `json:"result"`
+	Code       int                      `json:"code"`
+	Verdict    string                   `json:"verdict,omitempty"`
+	SPC        string                   `json:"spc,omitempty"`
+	Carrier    string                   `json:"carrier,omitempty"`
+	X5uFinal   string                   `json:"x5ufinal,omitempty"`
+	Treatment  string                   `json:"treatment,omitempty"`
+	Analytics  *AnalyticsVerdict        `json:"analytics,omitempty"`
+	Chain      []string                 `json:"chain,omitempty"`
+	Revocation *secsipid.SJWTRevocation `json:"revocation,omitempty"`
+}
+
+// IdentityResult - JSON response of the sign endpoints
+type IdentityResult struct {
+	Identity string `json:"identity"`
+	// Compact - the compact form, when both forms are requested
+	Compact string `json:"compact,omitempty"`
+	// Size - the size in bytes of the Identity header field, CompactSize the
+	// one for the compact form when both forms are requested
+	Size        int `json:"size"`
+	CompactSize int `json:"compactsize,omitempty"`
+	// Warning - the guidance when the size is over the budget
+	Warning string `json:"warning,omitempty"`
+}
+
+// IdentityRequest - JSON body of the check endpoints
+type IdentityRequest struct {
+	Identity string `json:"identity"`
+	// Claims - the PASSporT claims for the identity in compact form
+	Claims json.RawMessage `json:"claims,omitempty"`
+}
+
+// SignRequest - JSON body of the sign endpoints, alternative to CSV
+type SignRequest struct {
+	OrigTN string `json:"origtn"`
+	DestTN string `json:"desttn"`
+	Attest string `json:"attest"`
+	OrigID string `json:"origid,omitempty"`
+	X5u    string `json:"x5u,omitempty"`
+	Mky    string `json:"mky,omitempty"`
+	// KeyName - the name of the keyring key for signing (batch jobs)
+	KeyName string `json:"keyname,omitempty"`
+}
+
+// httpRequestIdentity - the identity from the request body, which is either
+// the identity value or a JSON document (IdentityRequest); the identity in
+// compact form is expanded with the claims of the JSON document or of the
+// X-Passport-Claims header
+func httpRequestIdentity(r *http.Request, body []byte) (string, error) {
+	identityReq := IdentityRequest{Identity: string(body)}
+	if httpRequestJSON(r) {
+		if err := json.Unmarshal(body, &identityReq); err != nil {
+			return "", err
+		}
+	}
+	return httpExpandIdentity(r, identityReq.Identity, identityReq.Claims)
+}
+
+// httpExpandIdentity - the identity in full form, expanded with the claims
+// (or the ones of the X-Passport-Claims header) if it is in compact form
+func httpExpandIdentity(r *http.Request, identityVal string, claims []byte) (string, error) {
+	if !secsipid.SJWTIdentityIsCompact(identityVal) {
+		return identityVal, nil
+	}
+	if len(claims) == 0 {
+		claims = []byte(r.Header.Get("X-Passport-Claims"))
+	}
+	if len(claims) == 0 {
+		return "", fmt.Errorf("no claims for identity in compact form")
+	}
+	identityVal, _, err := secsipid.SJWTIdentityExpand(identityVal, claims)
+	return identityVal, err
+}
+
+// httpPassportForm - the form of the PASSporT requested with X-Passport-Form
+// header: full (default), compact or both
+func httpPassportForm(r *http.Request) (string, error) {
+	form := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Passport-Form")))
+	switch form {
+	case "":
+		return "full", nil
+	case "full", "compact", "both":
+		return form, nil
+	}
+	return "", fmt.Errorf("invalid passport form: %s", form)
+}
+
+// httpVerifyTimeout - the verification budget requested with X-Verify-Timeout
+// header (duration like '500ms' or number of milliseconds), bounded by the
+// server maximum; 0 if not requested
+func httpVerifyTimeout(r *http.Request) (time.Duration, error) {
+	hdrVal := strings.TrimSpace(r.Header.Get("X-Verify-Timeout"))
+	if len(hdrVal) == 0 {
+		return 0, nil
+	}
+	budget, err := time.ParseDuration(hdrVal)
+	if err != nil {
+		msecs, nerr := strconv.Atoi(hdrVal)
+		if nerr != nil {
+			return 0, fmt.Errorf("invalid verify timeout: %s", hdrVal)
+		}
+		budget = time.Duration(msecs) * time.Millisecond
+	}
+	if budget <= 0 {
+		return 0, fmt.Errorf("invalid verify timeout: %s", hdrVal)
+	}
+	maxBudget := time.Duration(cliops.verifymax) * time.Millisecond
+	if cliops.verifymax <= 0 {
+		maxBudget = time.Duration(cliops.timeout) * time.Second
+	}
+	if maxBudget > 0 && budget > maxBudget {
+		budget = maxBudget
+	}
+	return budget, nil
+}
+
+// httpCheckFullIdentity - check the identity within the deadline of the
+// request, which is the verification budget if it is set, bounding all the
+// fetches done for it; if it is exceeded, the check fails with the timeout code
+func httpCheckFullIdentity(r *http.Request, identityVal string, budget time.Duration) (*secsipid.SJWTCheckInfo, int, error) {
+	ctx := r.Context()
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+	info, ret, err := checkFullIdentityInfo(ctx, identityVal)
+	if ret == secsipid.SJWTRetErrHTTPTimeout && budget > 0 {
+		err = fmt.Errorf("verification timeout: budget of %s exceeded (%v)", budget, err)
+	}
+	return info, ret, err
+}
+
+// httpRequestSignTokens - the tokens for signing from the request body, which
+// is either a CSV line or a JSON document (SignRequest)
+func httpRequestSignTokens(r *http.Request, body []byte) ([]string, error) {
+	if !httpRequestJSON(r) {
+		return strings.Split(strings.TrimSpace(string(body)), ","), nil
+	}
+	signReq := SignRequest{}
+	if err := json.Unmarshal(body, &signReq); err != nil {
+		return nil, err
+	}
+	return []string{signReq.OrigTN, signReq.DestTN, signReq.Attest, signReq.OrigID, signReq.X5u, signReq.Mky}, nil
+}
+
+// httpCORSOrigin - the value for Access-Control-Allow-Origin if the origin
+// of the request is allowed, otherwise empty string
+func httpCORSOrigin(origin string) string {
+	if len(origin) == 0 || len(cliops.corsorigins) == 0 {
+		return ""
+	}
+	for _, allowed := range strings.Split(cliops.corsorigins, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// httpCORS - add the CORS headers to the response, returns true if the request
+// was a preflight request, which is fully handled
+func httpCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := httpCORSOrigin(r.Header.Get("Origin"))
+	if len(origin) == 0 {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+	if r.Method != "OPTIONS" || len(r.Header.Get("Access-Control-Request-Method")) == 0 {
+		w.Header().Set("Access-Control-Expose-Headers", "X-DNO-Listed, X-Request-ID, X-Verdict, X-Treatment")
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Methods", cliops.corsmethods)
+	w.Header().Set("Access-Control-Allow-Headers", cliops.corsheaders)
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cliops.corsmaxage))
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// httpAdminHandler - reject the requests to the admin endpoints without the
+// API key (X-API-Key) given by -admin-key, all of them if it is not set
+func httpAdminHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "OPTIONS" && (len(cliops.adminkey) == 0 ||
+			subtle.ConstantTimeCompare([]byte(cliops.adminkey), []byte(r.Header.Get("X-API-Key"))) != 1) {
+			httpLogf(r, "unauthorized request for admin endpoint: %s\n", r.URL.Path)
+			httpError(w, http.StatusUnauthorized, httpErrUnauthorized, secsipid.SJWTRetErr, "unauthorized")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// httpV1Handler - wrap the handler of v1 endpoint with request id, CORS headers,
+// decoding of gzip request body and gzip encoding of the response
+func httpV1Handler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r, done := sdWatchdogTrack(r)
+		defer done()
+		reqID := r.Header.Get("X-Request-ID")
+		if len(reqID) == 0 || len(reqID) > 128 || strings.ContainsAny(reqID, " \t\r\n") {
+			reqID = uuid.New().String()
+			r.Header.Set("X-Request-ID", reqID)
+		}
+		w.Header().Set("X-Request-ID", reqID)
+		if callID := httpRequestCallID(r); len(callID) > 0 {
+			w.Header().Set("X-Call-ID", callID)
+			httpLogf(r, "%s %s (call-id: %s)\n", r.Method, r.URL.Path, callID)
+		} else {
+			httpLogf(r, "%s %s\n", r.Method, r.URL.Path)
+		}
+		if otelExporter != nil {
+			var end func()
+			w, end = otelHTTPSpan(w, r)
+			defer end()
+		}
+		if httpCORS(w, r) {
+			return
+		}
+		if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+			gr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid gzip body")
+				return
+			}
+			defer gr.Close()
+			r.Body = gr
+			r.Header.Del("Content-Encoding")
+		}
+		if cliops.httpmaxbody > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(cliops.httpmaxbody))
+		}
+		if httpAcceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Add("Vary", "Accept-Encoding")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			w = &httpGzipWriter{ResponseWriter: w, gz: gz}
+		}
+		h(w, r)
+	}
+}
+
+// identifiers of the errors returned by the HTTP API
+const (
+	httpErrBadRequest   = "bad_request"
+	httpErrNotFound     = "not_found"
+	httpErrMethod       = "method_not_allowed"
+	httpErrUnauthorized = "unauthorized"
+	httpErrQuota        = "quota_exceeded"
+	httpErrUnavailable  = "unavailable"
+	httpErrOverloaded   = "overloaded"
+	httpErrRateLimited  = "rate_limited"
+	httpErrCheckFailed  = "check_failed"
+	httpErrSignFailed   = "sign_failed"
+)
+
+// ErrorResponse - JSON body of the error responses, with the return code of
+// the library and, for verification failures, the check that failed and the
+// recommended treatment
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	Code      int    `json:"code"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message"`
+	Check     string `json:"check,omitempty"`
+	Treatment string `json:"treatment,omitempty"`
+}
+
+// httpError - write the JSON error response
+func httpError(w http.ResponseWriter, status int, errID string, ret int, message string) {
+	errResp := &ErrorResponse{Error: errID, Code: ret, Reason: secsipid.SJWTRetName(ret), Message: message}
+	if errID == httpErrCheckFailed {
+		errResp.Check = secsipid.SJWTRetClass(ret)
+		errResp.Treatment = w.Header().Get("X-Treatment")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errResp)
+}
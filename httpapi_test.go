@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gomagedon/expectate"
+)
+
+func TestHTTPAdminHandler(t *testing.T) {
+	adminkey := cliops.adminkey
+	defer func() { cliops.adminkey = adminkey }()
+	handler := httpAdminHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tc := range []struct {
+		name     string
+		adminkey string
+		apikey   string
+		status   int
+	}{
+		{"with admin key", "secret", "secret", http.StatusOK},
+		{"with wrong api key", "secret", "other", http.StatusUnauthorized},
+		{"without api key", "secret", "", http.StatusUnauthorized},
+		{"admin key not set", "", "", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			cliops.adminkey = tc.adminkey
+			r := httptest.NewRequest("GET", "/v1/origid/abc", nil)
+			if len(tc.apikey) > 0 {
+				r.Header.Set("X-API-Key", tc.apikey)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			expect(w.Code).ToBe(tc.status)
+		})
+	}
+}
+
+func TestHTTPV1HandlerMaxBody(t *testing.T) {
+	httpmaxbody := cliops.httpmaxbody
+	defer func() { cliops.httpmaxbody = httpmaxbody }()
+	var readErr error
+	handler := httpV1Handler(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = ioutil.ReadAll(r.Body)
+	})
+	gzipBody := func(size int) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(make([]byte, size))
+		gz.Close()
+		return buf.Bytes()
+	}
+
+	for _, tc := range []struct {
+		name        string
+		httpmaxbody int
+		body        []byte
+		gzip        bool
+		failed      bool
+	}{
+		{"plain body within the limit", 1024, make([]byte, 1024), false, false},
+		{"plain body over the limit", 1024, make([]byte, 1025), false, true},
+		{"gzip body within the limit", 1024, gzipBody(1024), true, false},
+		{"gzip body over the limit after decompression", 1024, gzipBody(1 << 20), true, true},
+		{"gzip body without limit", 0, gzipBody(1 << 20), true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			cliops.httpmaxbody = tc.httpmaxbody
+			r := httptest.NewRequest("POST", "/v1/check", bytes.NewReader(tc.body))
+			if tc.gzip {
+				r.Header.Set("Content-Encoding", "gzip")
+			}
+			readErr = nil
+			handler(httptest.NewRecorder(), r)
+			expect(readErr != nil).ToBe(tc.failed)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// identitySize - the size in bytes of the Identity header field carrying the
+// identity value in the SIP message (name, value and CRLF)
+func identitySize(identityVal string) int {
+	return len("Identity: \r\n") + len(identityVal)
+}
+
+// identitySizeCheck - the guidance when the size of the Identity header field
+// is over the budget of -identity-size-budget, empty if it fits or there is
+// no budget; with -identity-size-policy fail, the error is also returned
+func identitySizeCheck(identityVal string) (string, int, error) {
+	size := identitySize(identityVal)
+	if cliops.idsizebudg <= 0 || size <= cliops.idsizebudg {
+		return "", secsipid.SJWTRetOK, nil
+	}
+	guidance := fmt.Sprintf("identity header of %d bytes over the budget of %d bytes", size, cliops.idsizebudg)
+	if !secsipid.SJWTIdentityIsCompact(identityVal) {
+		if compact, _, err := secsipid.SJWTIdentityCompact(identityVal); err == nil {
+			guidance += fmt.Sprintf(" (%d bytes in compact form)", identitySize(compact))
+		}
+	}
+	guidance += ", use the compact form or a reliable transport (TCP or TLS)"
+	if cliops.idsizepol == "fail" {
+		return guidance, secsipid.SJWTRetErrSIPHdrTooLong, errors.New(guidance)
+	}
+	return guidance, secsipid.SJWTRetOK, nil
+}
+
+// cliIdentitySizeCheck - check the size of the signed identity, printing the
+// guidance as warning (or error with the fail policy); the return code is
+// not 0 if the identity must not be printed
+func cliIdentitySizeCheck(identityVal string) int {
+	guidance, ret, err := identitySizeCheck(identityVal)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return ret
+	}
+	if len(guidance) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", guidance)
+	}
+	return 0
+}
+
+// httpWriteIdentity - write the result of the sign endpoints, with the size
+// of the signed identity (also in the X-Identity-Size header) and the
+// guidance if it is over the budget; the identity is rejected with the fail
+// policy
+func httpWriteIdentity(w http.ResponseWriter, r *http.Request, text string, result *IdentityResult) {
+	guidance, ret, err := identitySizeCheck(result.Identity)
+	if err != nil {
+		httpLogf(r, "signed identity rejected: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	if len(guidance) > 0 {
+		httpLogf(r, "signed identity warning: %s\n", guidance)
+	}
+	result.Size = identitySize(result.Identity)
+	if len(result.Compact) > 0 {
+		result.CompactSize = identitySize(result.Compact)
+	}
+	result.Warning = guidance
+	w.Header().Set("X-Identity-Size", strconv.Itoa(result.Size))
+	httpWriteResult(w, r, text, result)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// IntrospectCert - the details of the certificate of the issuer of the
+// introspected PASSporT
+type IntrospectCert struct {
+	Subject   string `json:"subject"`
+	Issuer    string `json:"issuer"`
+	Serial    string `json:"serial"`
+	NotBefore int64  `json:"nbf"`
+	NotAfter  int64  `json:"exp"`
+	SPC       string `json:"spc,omitempty"`
+	X5tS256   string `json:"x5t#S256,omitempty"`
+}
+
+// IntrospectResult - JSON response of the introspection endpoint, with the
+// members of RFC 7662 (iss is the x5u, sub the originating identity, aud the
+// destination identities, jti the origid) and the PASSporT specific ones;
+// only active, code and message are set if the PASSporT is not valid
+type IntrospectResult struct {
+	Active    bool                   `json:"active"`
+	TokenType string                 `json:"token_type,omitempty"`
+	Iss       string                 `json:"iss,omitempty"`
+	Sub       string                 `json:"sub,omitempty"`
+	Aud       []string               `json:"aud,omitempty"`
+	Iat       int64                  `json:"iat,omitempty"`
+	Exp       int64                  `json:"exp,omitempty"`
+	Jti       string                 `json:"jti,omitempty"`
+	Ppt       string                 `json:"ppt,omitempty"`
+	Attest    string                 `json:"attest,omitempty"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+	Cert      *IntrospectCert        `json:"cert,omitempty"`
+	Code      int                    `json:"code"`
+	Message   string                 `json:"message,omitempty"`
+}
+
+// introspectCert - the details of the certificate (PEM), nil if it cannot be
+// parsed
+func introspectCert(certPEM []byte) *IntrospectCert {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil
+	}
+	certVal, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	ic := &IntrospectCert{Subject: certVal.Subject.String(), Issuer: certVal.Issuer.String(),
+		Serial: certVal.SerialNumber.Text(16), NotBefore: certVal.NotBefore.Unix(), NotAfter: certVal.NotAfter.Unix()}
+	ic.SPC, _, _ = secsipid.SJWTGetCertSPC(certPEM)
+	ic.X5tS256, _, _ = secsipid.SJWTCertThumbprint(certPEM)
+	return ic
+}
+
+// introspectIdentity - the introspection result of the verified identity,
+// with the certificate it was verified with
+func introspectIdentity(identityVal string, info *secsipid.SJWTCheckInfo) *IntrospectResult {
+	result := &IntrospectResult{Active: true, TokenType: "passport"}
+	parts, _, err := secsipid.SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return result
+	}
+	result.Iss = parts.Info
+	result.Ppt = parts.Header.Ppt
+	json.Unmarshal(parts.Payload, &result.Claims)
+	payload := identityPayload(identityVal)
+	result.Sub = payload.Orig.TN
+	result.Aud = payload.Dest.TN
+	result.Iat = payload.IAT
+	result.Exp = payload.IAT + int64(cliops.expire)
+	result.Jti = payload.OrigID
+	result.Attest = payload.ATTest
+	if info != nil {
+		result.Cert = introspectCert(info.Cert)
+	}
+	return result
+}
+
+// httpHandleV1Introspect - POST /v1/introspect, the PASSporT is given by the
+// 'token' parameter of a form body (like RFC 7662) or like for /v1/check;
+// the response is always JSON with status 200, the verification result being
+// given by 'active'
+func httpHandleV1Introspect(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for identity introspection ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	var identityVal string
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		var form url.Values
+		if form, err = url.ParseQuery(string(body)); err == nil {
+			identityVal, err = httpExpandIdentity(r, strings.TrimSpace(form.Get("token")), nil)
+		}
+	} else {
+		identityVal, err = httpRequestIdentity(r, body)
+	}
+	if err != nil || len(identityVal) == 0 {
+		httpLogf(r, "invalid body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+	budget, err := httpVerifyTimeout(r)
+	if err != nil {
+		httpLogf(r, "%v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+		return
+	}
+
+	info, ret, err := httpCheckFullIdentity(r, identityVal, budget)
+
+	if eventsEnabled() {
+		payload := identityPayload(identityVal)
+		srcAddr, dstAddr := httpRequestAddrs(r)
+		emitEvent(&EventRecord{Event: "introspect", Code: ret, OrigTN: payload.Orig.TN, DestTN: strings.Join(payload.Dest.TN, ","),
+			OrigID: payload.OrigID, CallID: httpRequestCallID(r), ReqID: httpRequestID(r), Message: errorMessage(err)}, srcAddr, dstAddr)
+	}
+
+	result := &IntrospectResult{Code: ret, Message: errorMessage(err)}
+	if err == nil {
+		result = introspectIdentity(identityVal, info)
+		result.Code = ret
+	}
+	httpLogf(r, "introspected identity - active: %v return code: %d\n", result.Active, ret)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
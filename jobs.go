@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/google/uuid"
+)
+
+// JobRequest - body of the request to submit a batch job; the items are
+// identity values for check and SignRequest objects for sign
+type JobRequest struct {
+	Op    string            `json:"op"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// JobItemResult - result for one item of the batch job
+type JobItemResult struct {
+	Index       int    `json:"index"`
+	Code        int    `json:"code"`
+	Identity    string `json:"identity,omitempty"`
+	Size        int    `json:"size,omitempty"`
+	Warning     string `json:"warning,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Unavailable bool   `json:"unavailable,omitempty"`
+}
+
+// JobStatus - state of the batch job, with the results of completed items
+type JobStatus struct {
+	ID        string           `json:"id"`
+	Op        string           `json:"op"`
+	Status    string           `json:"status"`
+	Total     int              `json:"total"`
+	Completed int              `json:"completed"`
+	Created   int64            `json:"created"`
+	Finished  int64            `json:"finished,omitempty"`
+	Results   []*JobItemResult `json:"results,omitempty"`
+}
+
+// Job - batch job, the results are stored in completion order; the items are
+// signed for the tenant of the submit request (nil if none)
+type Job struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	id       string
+	op       string
+	items    []json.RawMessage
+	attrs    *SignAttrs
+	tenant   *Tenant
+	results  []*JobItemResult
+	created  time.Time
+	finished time.Time
+}
+
+// JobStore - in-memory store of batch jobs, the items of all jobs are
+// processed with limited concurrency
+type JobStore struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	sem       chan struct{}
+	retention time.Duration
+	maxItems  int
+}
+
+var jobStore *JobStore = nil
+
+// NewJobStore --
+func NewJobStore(workers int, retention int, maxItems int) *JobStore {
+	if workers <= 0 {
+		workers = 1
+	}
+	s := &JobStore{
+		jobs:      make(map[string]*Job),
+		sem:       make(chan struct{}, workers),
+		retention: time.Duration(retention) * time.Second,
+		maxItems:  maxItems,
+	}
+	go func() {
+		for range time.Tick(10 * time.Second) {
+			s.Purge(time.Now())
+		}
+	}()
+	return s
+}
+
+// Submit - add the job and start processing its items
+func (s *JobStore) Submit(jobReq *JobRequest, attrs *SignAttrs, tenant *Tenant) (*Job, error) {
+	if jobReq.Op != "check" && jobReq.Op != "sign" {
+		return nil, fmt.Errorf("invalid job operation: %s", jobReq.Op)
+	}
+	if len(jobReq.Items) == 0 {
+		return nil, fmt.Errorf("no job items")
+	}
+	if s.maxItems > 0 && len(jobReq.Items) > s.maxItems {
+		return nil, fmt.Errorf("too many job items: %d", len(jobReq.Items))
+	}
+	job := &Job{
+		id:      uuid.New().String(),
+		op:      jobReq.Op,
+		items:   jobReq.Items,
+		attrs:   attrs,
+		tenant:  tenant,
+		created: time.Now(),
+	}
+	job.cond = sync.NewCond(&job.mu)
+
+	s.mu.Lock()
+	s.jobs[job.id] = job
+	s.mu.Unlock()
+
+	go func() {
+		var wg sync.WaitGroup
+		for i := range job.items {
+			s.sem <- struct{}{}
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-s.sem
+					wg.Done()
+				}()
+				job.addResult(job.processItem(i))
+			}(i)
+		}
+		wg.Wait()
+	}()
+	return job, nil
+}
+
+// Get - the job by id
+func (s *JobStore) Get(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// Purge - remove the jobs finished before the retention window
+func (s *JobStore) Purge(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		expired := !job.finished.IsZero() && now.Sub(job.finished) > s.retention
+		job.mu.Unlock()
+		if expired {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (job *Job) processItem(i int) *JobItemResult {
+	return jobProcessItem(job.op, job.items[i], job.attrs, job.tenant, i)
+}
+
+// jobSignKey - the name of the keyring key and the x5u for signing the item,
+// the key of the tenant (the one of the item being ignored) and its x5u if
+// the item has none; with -tenants, the default key is used if the job has no
+// tenant
+func jobSignKey(tenant *Tenant, signReq *SignRequest) (string, string) {
+	if tenant != nil {
+		if len(signReq.X5u) == 0 {
+			return tenant.KeyName, tenant.X5u
+		}
+		return tenant.KeyName, signReq.X5u
+	}
+	if tenants != nil {
+		return "", signReq.X5u
+	}
+	return signReq.KeyName, signReq.X5u
+}
+
+// jobProcessItem - check or sign the item, with the attributes of the
+// request for signing and for the tenant of the job (nil if none)
+func jobProcessItem(op string, item json.RawMessage, jobAttrs *SignAttrs, tenant *Tenant, i int) *JobItemResult {
+	result := &JobItemResult{Index: i}
+	var err error
+	switch op {
+	case "check":
+		var identityVal string
+		if err = json.Unmarshal(item, &identityVal); err != nil {
+			result.Code, result.Error = secsipid.SJWTRetErr, "invalid item"
+			return result
+		}
+		result.Code, err = checkFullIdentity(identityVal)
+		result.Unavailable = checkUnavailable(result.Code)
+	case "sign":
+		signReq := SignRequest{}
+		if err = json.Unmarshal(item, &signReq); err != nil {
+			result.Code, result.Error = secsipid.SJWTRetErr, "invalid item"
+			return result
+		}
+		attrs := *jobAttrs
+		attrs.OrigTN, attrs.Attest = signReq.OrigTN, signReq.Attest
+		var mky []secsipid.SJWTMky
+		if quotaLimited(tenant) {
+			if ok, _ := quotaStore.Reserve(tenant); !ok {
+				result.Code, result.Error = secsipid.SJWTRetErr, "quota exceeded"
+				return result
+			}
+			defer func() {
+				if result.Code != secsipid.SJWTRetOK || len(result.Identity) == 0 {
+					quotaStore.Release(tenant)
+				}
+			}()
+		}
+		var prvkeyPath string
+		keyName, x5uVal := jobSignKey(tenant, &signReq)
+		signRateWait(keyName)
+		if prvkeyPath, x5uVal, err = signKey(keyName, x5uVal); err != nil {
+			result.Code = secsipid.SJWTRetErr
+		} else if mky, result.Code, err = secsipid.SJWTParseMky(signReq.Mky); err == nil {
+			result.Identity, result.Code, err = secsipid.SJWTGetIdentityPayload(secsipid.SJWTPayload{
+				ATTest: signAttestation(&attrs),
+				Dest: secsipid.SJWTDest{
+					TN: []string{signReq.DestTN},
+				},
+				Mky: mky,
+				Orig: secsipid.SJWTOrig{
+					TN: signReq.OrigTN,
+				},
+				OrigID: signReq.OrigID,
+			}, x5uVal, prvkeyPath)
+		}
+		if err == nil {
+			if result.Warning, result.Code, err = identitySizeCheck(result.Identity); err != nil {
+				result.Identity, result.Warning = "", ""
+			} else {
+				result.Size = identitySize(result.Identity)
+			}
+		}
+	}
+	result.Error = errorMessage(err)
+	return result
+}
+
+func (job *Job) addResult(result *JobItemResult) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.results = append(job.results, result)
+	if len(job.results) == len(job.items) {
+		job.finished = time.Now()
+	}
+	job.cond.Broadcast()
+}
+
+// Status - the state of the job, with the results if withResults is true
+func (job *Job) Status(withResults bool) *JobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	status := &JobStatus{
+		ID:        job.id,
+		Op:        job.op,
+		Status:    "running",
+		Total:     len(job.items),
+		Completed: len(job.results),
+		Created:   job.created.Unix(),
+	}
+	if !job.finished.IsZero() {
+		status.Status = "done"
+		status.Finished = job.finished.Unix()
+	}
+	if withResults {
+		status.Results = append(status.Results, job.results...)
+	}
+	return status
+}
+
+// Stream - write the results as JSON lines as they are completed
+func (job *Job) Stream(w http.ResponseWriter) {
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for n := 0; ; {
+		job.mu.Lock()
+		for n == len(job.results) && job.finished.IsZero() {
+			job.cond.Wait()
+		}
+		results := job.results[n:]
+		finished := !job.finished.IsZero()
+		job.mu.Unlock()
+
+		for _, result := range results {
+			encoder.Encode(result)
+		}
+		n += len(results)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if finished && n == len(job.items) {
+			return
+		}
+	}
+}
+
+// httpHandleV1Jobs - POST /v1/jobs to submit a job, GET /v1/jobs/{id} to poll
+// the job status and results, GET /v1/jobs/{id}/results to stream the results;
+// the jobs are visible only for the tenant they were submitted for
+func httpHandleV1Jobs(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/jobs" {
+		if r.Method != "POST" {
+			httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+			return
+		}
+		jobReq := JobRequest{}
+		if err = json.Unmarshal(body, &jobReq); err != nil {
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+			return
+		}
+		tenant := httpTenant(r)
+		if jobReq.Op == "sign" && tenants != nil && tenant == nil {
+			httpLogf(r, "signing job without tenant\n")
+			httpError(w, http.StatusUnauthorized, httpErrUnauthorized, secsipid.SJWTRetErr, "tenant required")
+			return
+		}
+		// the items are counted for the quotas when they are signed
+		if jobReq.Op == "sign" && quotaLimited(tenant) {
+			if ok, retryAfter := quotaStore.Check(tenant); !ok {
+				httpQuotaExceeded(w, r, tenant, retryAfter)
+				return
+			}
+		}
+		job, err := jobStore.Submit(&jobReq, httpSignAttrs(r, "", ""), tenant)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+			return
+		}
+		httpLogf(r, "batch job %s submitted with %d items\n", job.id, len(jobReq.Items))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/jobs/"+job.id)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job.Status(false))
+		return
+	}
+
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	tokens := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/jobs/"), "/"), "/")
+	job := jobStore.Get(tokens[0])
+	if job == nil || job.tenant != httpTenant(r) || len(tokens) > 2 || (len(tokens) == 2 && tokens[1] != "results") {
+		httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "job not found")
+		return
+	}
+	if len(tokens) == 2 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		sdWatchdogRelease(r)
+		job.Stream(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Status(true))
+}
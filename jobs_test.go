@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gomagedon/expectate"
+)
+
+func TestJobSignKey(t *testing.T) {
+	tenant := &Tenant{ID: "reseller-a", KeyName: "carrier-a", X5u: "https://certs.example.com/a.pem"}
+
+	for _, tc := range []struct {
+		name    string
+		tenants bool
+		tenant  *Tenant
+		signReq SignRequest
+		keyName string
+		x5u     string
+	}{
+		{"key of the item without tenants", false, nil,
+			SignRequest{KeyName: "carrier-b", X5u: "https://certs.example.com/b.pem"}, "carrier-b", "https://certs.example.com/b.pem"},
+		{"key of the tenant", true, tenant, SignRequest{KeyName: "carrier-b"}, "carrier-a", "https://certs.example.com/a.pem"},
+		{"key of the tenant with x5u of the item", true, tenant,
+			SignRequest{KeyName: "carrier-b", X5u: "https://certs.example.com/b.pem"}, "carrier-a", "https://certs.example.com/b.pem"},
+		{"default key without tenant", true, nil, SignRequest{KeyName: "carrier-b"}, "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			testTenants(t)
+			if !tc.tenants {
+				tenants = nil
+			}
+			keyName, x5uVal := jobSignKey(tc.tenant, &tc.signReq)
+			expect(keyName).ToBe(tc.keyName)
+			expect(x5uVal).ToBe(tc.x5u)
+		})
+	}
+}
+
+func TestHTTPHandleV1Jobs(t *testing.T) {
+	testTenants(t, Tenant{ID: "reseller-a", APIKeys: []string{"secret-a"}}, Tenant{ID: "reseller-b", APIKeys: []string{"secret-b"}})
+	saved := jobStore
+	defer func() { jobStore = saved }()
+	jobStore = NewJobStore(1, 60, 0)
+	handler := httpTenantHandler(false, httpHandleV1Jobs)
+	request := func(method string, path string, body string, tenantID string, apikey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if len(tenantID) > 0 {
+			r.Header.Set("X-Tenant-ID", tenantID)
+			r.Header.Set("X-API-Key", apikey)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := request("POST", "/v1/jobs", `{"op":"check","items":["invalid"]}`, "reseller-a", "secret-a")
+	status := JobStatus{}
+	json.NewDecoder(w.Body).Decode(&status)
+	if w.Code != http.StatusAccepted || len(status.ID) == 0 {
+		t.Fatalf("failed to submit the job: %d", w.Code)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		tenantID string
+		apikey   string
+		status   int
+	}{
+		{"poll by the tenant of the job", "GET", "/v1/jobs/" + status.ID, "", "reseller-a", "secret-a", http.StatusOK},
+		{"poll by another tenant", "GET", "/v1/jobs/" + status.ID, "", "reseller-b", "secret-b", http.StatusNotFound},
+		{"poll without tenant", "GET", "/v1/jobs/" + status.ID, "", "", "", http.StatusNotFound},
+		{"stream by another tenant", "GET", "/v1/jobs/" + status.ID + "/results", "", "reseller-b", "secret-b", http.StatusNotFound},
+		{"poll without api key", "GET", "/v1/jobs/" + status.ID, "", "reseller-a", "", http.StatusUnauthorized},
+		{"submit with trailing slash", "POST", "/v1/jobs/", `{"op":"sign","items":[{}]}`, "reseller-a", "", http.StatusUnauthorized},
+		{"submit with trailing slash and api key", "POST", "/v1/jobs/", `{"op":"sign","items":[{}]}`, "reseller-a", "secret-a",
+			http.StatusMethodNotAllowed},
+		{"poll without job id", "GET", "/v1/jobs/", "", "reseller-a", "secret-a", http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			expect(request(tc.method, tc.path, tc.body, tc.tenantID, tc.apikey).Code).ToBe(tc.status)
+		})
+	}
+}
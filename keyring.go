@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// KeyringKey - named private key of the keyring, with the x5u of its
+// certificate and the validity window for signing (RFC3339 or unix timestamp,
+// empty - no limit)
+type KeyringKey struct {
+	Name      string  `json:"name"`
+	PrvKey    string  `json:"prvkey"`
+	X5u       string  `json:"x5u"`
+	NotBefore string  `json:"notbefore,omitempty"`
+	NotAfter  string  `json:"notafter,omitempty"`
+	Rate      float64 `json:"rate,omitempty"`
+	Burst     int     `json:"burst,omitempty"`
+
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// Keyring - the named private keys for signing, the default key is used for
+// the requests without a key name
+type Keyring struct {
+	Keys    []KeyringKey `json:"keys"`
+	Default string       `json:"default"`
+
+	byName map[string]*KeyringKey
+}
+
+var keyring *Keyring = nil
+
+// LoadKeyring - load the keyring from JSON file, checking the private keys
+func LoadKeyring(filePath string) (*Keyring, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{}
+	if err = json.Unmarshal(data, k); err != nil {
+		return nil, fmt.Errorf("invalid keyring: %v", err)
+	}
+	k.byName = map[string]*KeyringKey{}
+	for i := range k.Keys {
+		key := &k.Keys[i]
+		if len(key.Name) == 0 {
+			return nil, fmt.Errorf("no name for key %d", i)
+		}
+		if _, ok := k.byName[key.Name]; ok {
+			return nil, fmt.Errorf("duplicate key name: %s", key.Name)
+		}
+		prvkey, err := secsipid.SJWTReadPrvKey(key.PrvKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read key %s: %v", key.Name, err)
+		}
+		if _, _, err = secsipid.SJWTParsePrivateKeyFromPEM(prvkey); err != nil {
+			return nil, fmt.Errorf("invalid key %s: %v", key.Name, err)
+		}
+		if len(key.NotBefore) > 0 {
+			if key.notBefore, err = parseTimestamp(key.NotBefore); err != nil {
+				return nil, fmt.Errorf("invalid notbefore for key %s: %v", key.Name, err)
+			}
+		}
+		if len(key.NotAfter) > 0 {
+			if key.notAfter, err = parseTimestamp(key.NotAfter); err != nil {
+				return nil, fmt.Errorf("invalid notafter for key %s: %v", key.Name, err)
+			}
+		}
+		k.byName[key.Name] = key
+	}
+	if _, ok := k.byName[k.Default]; len(k.Default) > 0 && !ok {
+		return nil, fmt.Errorf("unknown default key: %s", k.Default)
+	}
+	return k, nil
+}
+
+// valid - true if the key can be used for signing at the time
+func (key *KeyringKey) valid(now time.Time) bool {
+	if !key.notBefore.IsZero() && now.Before(key.notBefore) {
+		return false
+	}
+	return key.notAfter.IsZero() || now.Before(key.notAfter)
+}
+
+// Select - the named key, or for the empty name the default key or, if there
+// is no default, the valid key with the latest start of the validity window
+func (k *Keyring) Select(name string, now time.Time) (*KeyringKey, error) {
+	if len(name) == 0 {
+		name = k.Default
+	}
+	if len(name) == 0 {
+		var selected *KeyringKey
+		for i := range k.Keys {
+			if k.Keys[i].valid(now) && (selected == nil || k.Keys[i].notBefore.After(selected.notBefore)) {
+				selected = &k.Keys[i]
+			}
+		}
+		if selected == nil {
+			return nil, fmt.Errorf("no valid key in keyring")
+		}
+		return selected, nil
+	}
+	key, ok := k.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown key: %s", name)
+	}
+	if !key.valid(now) {
+		return nil, fmt.Errorf("key %s not valid at this time", name)
+	}
+	return key, nil
+}
+
+// signKey - the path to the private key and the x5u for signing with the
+// named key of the keyring, or with the signing key (-fprvkey) if there is no
+// keyring; the given x5u has priority over the one of the key
+func signKey(name string, x5uVal string) (string, string, error) {
+	if keyring == nil {
+		if len(name) > 0 {
+			return "", "", fmt.Errorf("no keyring for key: %s", name)
+		}
+		return signPrvKey(), x5uVal, nil
+	}
+	key, err := keyring.Select(name, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	if len(x5uVal) == 0 {
+		x5uVal = key.X5u
+	}
+	return key.PrvKey, x5uVal, nil
+}
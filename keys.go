@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// keyCutover - the time to start signing with the next key
+var keyCutover time.Time
+
+var keyCutoverOnce sync.Once
+
+// keyCerts - the certificates published by the http server, by key id
+var keyCerts = map[string][]byte{}
+
+// parseTimestamp - the time given in RFC3339 format or as unix timestamp
+func parseTimestamp(val string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, val)
+}
+
+// keysInit - load the next signing key, the cutover time and the
+// certificates to be published
+func keysInit() error {
+	if len(cliops.fprvkeynext) > 0 {
+		if len(cliops.keycutover) == 0 {
+			return errors.New("cutover time for the next key not provided")
+		}
+		var err error
+		if keyCutover, err = parseTimestamp(cliops.keycutover); err != nil {
+			return fmt.Errorf("invalid cutover time: %v", err)
+		}
+		prvkey, err := secsipid.SJWTReadPrvKey(cliops.fprvkeynext)
+		if err != nil {
+			return err
+		}
+		if _, _, err = secsipid.SJWTParsePrivateKeyFromPEM(prvkey); err != nil {
+			return fmt.Errorf("invalid next key: %v", err)
+		}
+	}
+	for _, certPath := range []string{cliops.fcert, cliops.fcertnext} {
+		if len(certPath) == 0 {
+			continue
+		}
+		cert, err := os.ReadFile(certPath)
+		if err != nil {
+			return err
+		}
+		keyID, _, err := secsipid.SJWTPubKeyID(cert)
+		if err != nil {
+			return fmt.Errorf("invalid certificate %s: %v", certPath, err)
+		}
+		keyCerts[keyID] = cert
+	}
+	return nil
+}
+
+// signPrvKey - the path to the private key for signing, which is the next key
+// after the cutover time
+func signPrvKey() string {
+	if len(cliops.fprvkeynext) == 0 || time.Now().Before(keyCutover) {
+		return cliops.fprvkey
+	}
+	keyCutoverOnce.Do(func() {
+		log.Printf("signing with the next key from: %s", cliops.fprvkeynext)
+	})
+	return cliops.fprvkeynext
+}
+
+// prevPrvKey - the private key used for signing before the cutover time, if
+// the next key is used
+func prevPrvKey() []byte {
+	if signPrvKey() == cliops.fprvkey {
+		return nil
+	}
+	prvkey, _ := secsipid.SJWTReadPrvKey(cliops.fprvkey)
+	return prvkey
+}
+
+// httpHandleV1Certs - GET /v1/certs/{keyid}.pem for the published certificates
+func httpHandleV1Certs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	keyID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/certs/"), ".pem")
+	cert, ok := keyCerts[keyID]
+	if !ok {
+		httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "certificate not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.Write(cert)
+}
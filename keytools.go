@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// keysPassword - the password of the PKCS#12 bundle, from the environment
+// variable if given as 'env:NAME'
+func keysPassword() string {
+	if strings.HasPrefix(cliops.p12pass, "env:") {
+		return os.Getenv(strings.TrimPrefix(cliops.p12pass, "env:"))
+	}
+	return cliops.p12pass
+}
+
+// keysReadFile - the private key and the certificates of the file, being
+// either PEM data or a PKCS#12 bundle
+func keysReadFile(filePath string) ([]byte, []byte, int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, secsipid.SJWTRetErrFileRead, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		return data, data, secsipid.SJWTRetOK, nil
+	}
+	return secsipid.SJWTParsePKCS12(data, keysPassword())
+}
+
+// keysFingerprint - the SHA-256 digest as colon separated hex values
+func keysFingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	hexVals := make([]string, len(sum))
+	for i, b := range sum {
+		hexVals[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hexVals, ":")
+}
+
+// keysWriteNew - write the file, which must not exist
+func keysWriteNew(filePath string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// secsipidxCLIKeysImport - write the key and the certificate chain of the
+// PKCS#12 bundle to fprvkey and fcert
+func secsipidxCLIKeysImport(filePath string) int {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		fmt.Printf("failed to read bundle: %v\n", err)
+		return secsipid.SJWTRetErrFileRead
+	}
+	prvkey, chain, ret, err := secsipid.SJWTParsePKCS12(data, keysPassword())
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	if len(prvkey) == 0 || len(chain) == 0 {
+		fmt.Printf("error: the bundle must have the private key and its certificate\n")
+		return secsipid.SJWTRetErrPrvKeyInvalidFormat
+	}
+	if _, ret, err = secsipid.SJWTParsePrivateKeyFromPEM(prvkey); err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	prvkeyPath, certPath := cliops.fprvkey, cliops.fcert
+	if len(prvkeyPath) == 0 {
+		prvkeyPath = "ec256-private.pem"
+	}
+	if len(certPath) == 0 {
+		certPath = "ec256-cert.pem"
+	}
+	if err = keysWriteNew(prvkeyPath, prvkey, 0600); err != nil {
+		fmt.Printf("failed to write private key: %v\n", err)
+		return -1
+	}
+	if err = keysWriteNew(certPath, chain, 0644); err != nil {
+		fmt.Printf("failed to write certificate chain: %v\n", err)
+		return -1
+	}
+	keyID, _, _ := secsipid.SJWTKeyID(prvkey)
+	fmt.Printf("private key: %s\ncertificate chain: %s\nkey id: %s\n", prvkeyPath, certPath, keyID)
+	return 0
+}
+
+// secsipidxCLIKeysFingerprints - print the fingerprints of the certificates
+// and the keys of the file
+func secsipidxCLIKeysFingerprints(prvkey []byte, certs []byte) {
+	seen := map[string]bool{}
+	for _, data := range [][]byte{certs, prvkey} {
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			digest := keysFingerprint(block.Bytes)
+			if seen[digest] {
+				continue
+			}
+			seen[digest] = true
+			blockPEM := pem.EncodeToMemory(block)
+			switch {
+			case block.Type == "CERTIFICATE":
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					fmt.Printf("certificate: invalid (%v)\n", err)
+					continue
+				}
+				thumbprint, _, _ := secsipid.SJWTCertThumbprint(blockPEM)
+				keyID, _, _ := secsipid.SJWTPubKeyID(blockPEM)
+				fmt.Printf("certificate: %s\n  sha256: %s\n  x5t#S256: %s\n  key id: %s\n  not after: %s\n",
+					cert.Subject.String(), digest, thumbprint, keyID, cert.NotAfter.UTC().Format("2006-01-02T15:04:05Z"))
+			case block.Type == "PUBLIC KEY":
+				keyID, _, _ := secsipid.SJWTPubKeyID(blockPEM)
+				fmt.Printf("public key:\n  sha256: %s\n  key id: %s\n", digest, keyID)
+			case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+				keyID, _, err := secsipid.SJWTKeyID(blockPEM)
+				if err != nil {
+					fmt.Printf("private key: invalid (%v)\n", err)
+					continue
+				}
+				fmt.Printf("private key:\n  key id: %s\n", keyID)
+			}
+		}
+	}
+}
+
+// secsipidxCLIKeys - import, export or print the fingerprints of the key
+// material
+func secsipidxCLIKeys() int {
+	if len(cliops.subargs) < 2 {
+		fmt.Printf("keys operation and path to file not provided\n")
+		return cliExitArgs
+	}
+	filePath := cliops.subargs[1]
+	switch cliops.keysop {
+	case "import":
+		return secsipidxCLIKeysImport(filePath)
+	case "export", "fingerprints":
+	default:
+		fmt.Printf("invalid keys operation: %s\n", cliops.keysop)
+		return cliExitArgs
+	}
+	prvkey, certs, ret, err := keysReadFile(filePath)
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	if cliops.keysop == "fingerprints" {
+		secsipidxCLIKeysFingerprints(prvkey, certs)
+		return 0
+	}
+	chain, ret, err := secsipid.SJWTCertChainPEM(certs)
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	fmt.Printf("%s", chain)
+	return 0
+}
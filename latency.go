@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// latencyStages - the stages of the verification pipeline, by the name of the
+// operation of the library
+var latencyStages = map[string]string{
+	"secsipid.fetch":       "fetch",
+	"secsipid.cert_verify": "chain",
+	"secsipid.verify":      "crypto",
+	"secsipid.claims":      "claims",
+	"secsipid.check":       "total",
+}
+
+// latencyStageOrder - the order of the stages in the metrics output
+var latencyStageOrder = []string{"fetch", "chain", "crypto", "claims", "total"}
+
+// latencyBuckets - the upper bounds of the histogram buckets (in seconds)
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// latencyExemplar - the trace of the last observation in a bucket
+type latencyExemplar struct {
+	traceID string
+	value   float64
+	time    time.Time
+}
+
+// LatencyHistogram - the durations of a stage, with one extra bucket for the
+// values above the last bound
+type LatencyHistogram struct {
+	counts    []uint64
+	exemplars []*latencyExemplar
+	sum       float64
+	count     uint64
+}
+
+var (
+	latencyMu         sync.Mutex
+	latencyHistograms map[string]*LatencyHistogram
+)
+
+// latencyInit - enable the histograms of the verification stages
+func latencyInit() {
+	latencyHistograms = make(map[string]*LatencyHistogram)
+	for _, stage := range latencyStageOrder {
+		latencyHistograms[stage] = &LatencyHistogram{
+			counts:    make([]uint64, len(latencyBuckets)+1),
+			exemplars: make([]*latencyExemplar, len(latencyBuckets)+1),
+		}
+	}
+}
+
+// latencyObserve - add the duration of the stage, with the trace id as
+// exemplar if not empty
+func latencyObserve(stage string, value float64, traceID string) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	h, ok := latencyHistograms[stage]
+	if !ok {
+		return
+	}
+	i := 0
+	for i < len(latencyBuckets) && value > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += value
+	h.count++
+	if len(traceID) > 0 {
+		h.exemplars[i] = &latencyExemplar{traceID: traceID, value: value, time: time.Now()}
+	}
+}
+
+// libSpanHook - callback for the operations of the library, exporting them
+// as spans and observing the durations of the verification stages
+func libSpanHook(name string, attrs map[string]string) func(err error) {
+	var span *OTelSpan
+	if otelExporter != nil {
+		span = otelExporter.StartLibSpan(name, attrs)
+	}
+	stage, timed := latencyStages[name]
+	if name == "secsipid.check" && attrs["secsipid.result_cache"] == "hit" {
+		// the cached results would skew the duration of the full checks
+		timed = false
+	}
+	start := time.Now()
+	return func(err error) {
+		traceID := ""
+		if span != nil {
+			otelExporter.EndSpan(span, err)
+			traceID = span.TraceID
+		}
+		if timed && latencyHistograms != nil {
+			latencyObserve(stage, time.Since(start).Seconds(), traceID)
+		}
+	}
+}
+
+// latencyInstallHook - set the callback for the operations of the library if
+// tracing or the histograms are enabled
+func latencyInstallHook() {
+	if otelExporter != nil || latencyHistograms != nil {
+		secsipid.SJWTSetSpanHook(libSpanHook)
+	}
+}
+
+func latencyFormatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// latencyWriteMetrics - the histograms in the Prometheus text format, with
+// the exemplars if the OpenMetrics format is used
+func latencyWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	if latencyHistograms == nil {
+		return
+	}
+	name := "secsipidx_check_stage_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Duration of the verification stages (fetch, chain, crypto, claims, total).\n", name)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	for _, stage := range latencyStageOrder {
+		h := latencyHistograms[stage]
+		cumulative := uint64(0)
+		for i := range h.counts {
+			cumulative += h.counts[i]
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = latencyFormatFloat(latencyBuckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{stage=%q,le=%q} %d", name, stage, le, cumulative)
+			if ex := h.exemplars[i]; openMetrics && ex != nil {
+				fmt.Fprintf(w, " # {trace_id=%q} %s %.3f", ex.traceID, latencyFormatFloat(ex.value),
+					float64(ex.time.UnixNano())/1e9)
+			}
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "%s_sum{stage=%q} %s\n", name, stage, latencyFormatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{stage=%q} %d\n", name, stage, h.count)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// VerifyLimiter - the maximum number of concurrent verifications, with the
+// requests over it waiting in a bounded queue
+type VerifyLimiter struct {
+	slots     chan struct{}
+	maxQueued int64
+	queued    int64
+	rejected  uint64
+}
+
+var verifyLimiter *VerifyLimiter = nil
+
+// NewVerifyLimiter - create the limiter for the concurrent verifications and
+// the queued requests (0 - rejected if no verification slot is free)
+func NewVerifyLimiter(maxVerify int, maxQueued int) *VerifyLimiter {
+	return &VerifyLimiter{slots: make(chan struct{}, maxVerify), maxQueued: int64(maxQueued)}
+}
+
+// Acquire - take a verification slot, waiting in the queue if there is room
+// in it, at most for the timeout or until the request is cancelled
+func (vl *VerifyLimiter) Acquire(r *http.Request, timeout time.Duration) bool {
+	select {
+	case vl.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if atomic.AddInt64(&vl.queued, 1) > vl.maxQueued {
+		atomic.AddInt64(&vl.queued, -1)
+		atomic.AddUint64(&vl.rejected, 1)
+		return false
+	}
+	defer atomic.AddInt64(&vl.queued, -1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case vl.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	atomic.AddUint64(&vl.rejected, 1)
+	return false
+}
+
+// Release - free the verification slot
+func (vl *VerifyLimiter) Release() {
+	<-vl.slots
+}
+
+// httpLimitHandler - run the verification handler within the limits of the
+// concurrent verifications, rejecting the requests that cannot be queued
+func httpLimitHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if verifyLimiter == nil || r.Method == "OPTIONS" {
+			h(w, r)
+			return
+		}
+		if !verifyLimiter.Acquire(r, time.Duration(cliops.timeout)*time.Second) {
+			httpLogf(r, "too many concurrent verifications\n")
+			w.Header().Set("Retry-After", "1")
+			httpError(w, http.StatusServiceUnavailable, httpErrOverloaded, secsipid.SJWTRetErr,
+				"too many concurrent verifications")
+			return
+		}
+		defer verifyLimiter.Release()
+		h(w, r)
+	}
+}
+
+// limitsInit - set the soft memory limit and create the limiter of the
+// concurrent verifications, in daemon mode
+func limitsInit() error {
+	if cliops.memlimit < 0 || cliops.maxverify < 0 || cliops.maxqueued < 0 {
+		return fmt.Errorf("invalid limits: negative value")
+	}
+	if cliops.memlimit > 0 {
+		if err := setMemoryLimit(int64(cliops.memlimit) << 20); err != nil {
+			return err
+		}
+	}
+	if cliops.maxverify > 0 {
+		verifyLimiter = NewVerifyLimiter(cliops.maxverify, cliops.maxqueued)
+	}
+	return nil
+}
+
+// limitWriteMetrics - the usage of the verification limits in the Prometheus
+// text format
+func limitWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	if verifyLimiter == nil {
+		return
+	}
+	fmt.Fprintf(w, "# HELP secsipidx_verifications_inflight Verifications being processed.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_verifications_inflight gauge\n")
+	fmt.Fprintf(w, "secsipidx_verifications_inflight %d\n", len(verifyLimiter.slots))
+	fmt.Fprintf(w, "# HELP secsipidx_verifications_queued Verification requests waiting for a free slot.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_verifications_queued gauge\n")
+	fmt.Fprintf(w, "secsipidx_verifications_queued %d\n", atomic.LoadInt64(&verifyLimiter.queued))
+	family := "secsipidx_verifications_rejected_total"
+	if openMetrics {
+		family = strings.TrimSuffix(family, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s Verification requests rejected over the limits.\n# TYPE %s counter\n", family, family)
+	fmt.Fprintf(w, "secsipidx_verifications_rejected_total %d\n", atomic.LoadUint64(&verifyLimiter.rejected))
+}
@@ -0,0 +1,14 @@
+//go:build go1.19
+// +build go1.19
+
+package main
+
+import (
+	"runtime/debug"
+)
+
+// setMemoryLimit - set the soft memory limit of the runtime (in bytes)
+func setMemoryLimit(limit int64) error {
+	debug.SetMemoryLimit(limit)
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !go1.19
+// +build !go1.19
+
+package main
+
+import (
+	"fmt"
+)
+
+// setMemoryLimit - the soft memory limit is not available before Go 1.19
+func setMemoryLimit(limit int64) error {
+	return fmt.Errorf("memory limit requires Go 1.19 or newer")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/json"
 	"flag"
@@ -10,6 +11,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,9 +37,11 @@ type CLIOptions struct {
 	identity    string
 	fidentity   string
 	alg         string
+	signeralgs  string
 	ppt         string
 	typ         string
 	x5u         string
+	x5tcert     string
 	attest      string
 	desttn      string
 	origtn      string
@@ -50,13 +55,197 @@ type CLIOptions struct {
 	timeout     int
 	ltest       bool
 	version     bool
+	fips        bool
 	cachedir    string
 	cacheexpire int
+	cacheinteg  bool
+	cachekey    string
+	cachemaxent int
+	cachemaxkb  int
+	cachejanit  int
+	cachereval  int
+	cachestale  int
 	cafile      string
 	cainter     string
 	crlfile     string
+	crlrefresh  int
+	ocspshared  string
+	crlpolicy   string
+	ocsppolicy  string
+	shortlived  int
+	certpolicy  string
+	certpoloids string
+	certpoleku  string
 	certverify  int
+	aiafetch    bool
+	aiamax      int
+	aiahosts    string
+	resultchain bool
 	verbosity   int
+	hepsrv      string
+	hepproto    string
+	hepid       int
+	heppass     string
+	callid      string
+	dbdriver    string
+	dbdsn       string
+	dbquery     bool
+	origidstor  bool
+	origidmeta  string
+	origidlook  bool
+	dbsince     int
+	dbuntil     int
+	dblimit     int
+	dnofile     string
+	dnomode     string
+	tnlookup    string
+	tnlookupexp int
+	tnlookupatt string
+	tnlookupfb  string
+	cvturl      string
+	cvtexpire   int
+	cvttimeout  int
+	attestmtx   string
+	trunk       string
+	cpsurl      string
+	cpspublish  bool
+	cpssrv      bool
+	cpssrvret   int
+	cpssrvkey   int
+	cpssrvmax   int
+	div         bool
+	checkchain  bool
+	checkids    bool
+	pptpolicy   string
+	prepare     bool
+	finalize    bool
+	finalcert   string
+	siginput    string
+	signature   string
+	signconn    bool
+	checkconn   bool
+	rcdi        bool
+	rcdisrc     string
+	rcdialg     string
+	rcdidigest  string
+	rcdiverify  bool
+	mky         string
+	claims      string
+	printclaims bool
+	pptform     string
+	pptclaims   string
+	canonjson   bool
+	idmaxlen    int
+	idsizebudg  int
+	idsizepol   string
+	segmaxlen   int
+	desttnmax   int
+	iatskew     int
+	expshaken   int
+	expdiv      int
+	exprcd      int
+	rescachettl int
+	rescachemax int
+	corsorigins string
+	corsmethods string
+	corsheaders string
+	corsmaxage  int
+	httpmaxbody int
+	jobsworkers int
+	jobsret     int
+	jobsmax     int
+	otelurl     string
+	otelservice string
+	certinfo    bool
+	diff        bool
+	fixtures    string
+	fixturesdir string
+	fixturesurl string
+	recorddir   string
+	recordmax   int
+	tenantsfile string
+	adminkey    string
+	quotafile   string
+	replay      string
+	cacheop     string
+	keygen      bool
+	keysop      string
+	p12pass     string
+	subargs     []string
+	completion  string
+	codes       string
+	serviceop   string
+	servicename string
+	verdictkey  string
+	verdictx5u  string
+	servicekey  string
+	degradwarn  string
+	degradwin   int
+	memlimit    int
+	maxverify   int
+	maxqueued   int
+	signrate    float64
+	signburst   int
+	signwait    int
+	watchdir    string
+	watchintvl  int
+	probeurls   string
+	probeintvl  int
+	batch       string
+	batchorder  string
+	jobs        int
+	fuzziter    int
+	fuzzseed    int64
+	fuzzout     string
+	fuzz        bool
+	servicex5u  string
+	verdictiss  string
+	stats       bool
+	statsmax    int
+	chaos       bool
+	chaosdelay  int
+	chaosfail   int
+	chaosskew   int
+	resign      bool
+	resignage   int
+	spc         string
+	fprvkeynext string
+	keycutover  string
+	keyringfile string
+	keyname     string
+	fcert       string
+	fcertnext   string
+	selfcheck   int
+	pinfile     string
+	pinpolicy   string
+	carrierfile string
+	carrierrefr int
+	treatment   string
+	latency     bool
+	ipfamily    int
+	ipprefer    int
+	happyeyes   int
+	fetchsrv    bool
+	dnsservers  string
+	dnscache    bool
+	useragent   string
+	fetchhdrs   string
+	fetchredir  int
+	redirstrict bool
+	repoauth    string
+	redirect    bool
+	redirtarget string
+	redirpolicy string
+	fpcap       string
+	pcapreport  string
+	fcdr        string
+	report      string
+	reportbuck  int
+	reportfile  string
+	noidentity  string
+	noidexcept  string
+	softfail    bool
+	verifymax   int
 }
 
 var cliops = CLIOptions{
@@ -74,9 +263,11 @@ var cliops = CLIOptions{
 	identity:    "",
 	fidentity:   "",
 	alg:         "ES256",
+	signeralgs:  "ES256",
 	ppt:         "shaken",
 	typ:         "passport",
 	x5u:         "",
+	x5tcert:     "",
 	attest:      "C",
 	desttn:      "",
 	origtn:      "",
@@ -90,13 +281,195 @@ var cliops = CLIOptions{
 	timeout:     3,
 	ltest:       false,
 	version:     false,
+	fips:        false,
 	cachedir:    "",
 	cacheexpire: 3600,
+	cacheinteg:  false,
+	cachekey:    "",
+	cachemaxent: 0,
+	cachemaxkb:  0,
+	cachejanit:  0,
+	cachereval:  0,
+	cachestale:  0,
 	cafile:      "",
 	cainter:     "",
 	crlfile:     "",
+	crlrefresh:  0,
+	ocspshared:  "",
+	crlpolicy:   "hard-fail",
+	ocsppolicy:  "hard-fail",
+	shortlived:  0,
+	certpolicy:  "off",
+	certpoloids: secsipid.CertPolicySHAKEN,
+	certpoleku:  "",
 	certverify:  0,
+	aiafetch:    false,
+	aiamax:      3,
+	aiahosts:    "",
+	resultchain: false,
 	verbosity:   0,
+	hepsrv:      "",
+	hepproto:    "udp",
+	hepid:       2001,
+	heppass:     "",
+	callid:      "",
+	dbdriver:    "sqlite3",
+	dbdsn:       "",
+	dbquery:     false,
+	origidstor:  false,
+	origidmeta:  "",
+	origidlook:  false,
+	dbsince:     0,
+	dbuntil:     0,
+	dblimit:     100,
+	dnofile:     "",
+	dnomode:     "reject",
+	tnlookup:    "",
+	tnlookupexp: 300,
+	tnlookupatt: "owned=A,customer=B,unknown=C",
+	tnlookupfb:  "C",
+	cvturl:      "",
+	cvtexpire:   300,
+	cvttimeout:  300,
+	attestmtx:   "",
+	trunk:       "",
+	cpsurl:      "",
+	cpspublish:  false,
+	cpssrv:      false,
+	cpssrvret:   60,
+	cpssrvkey:   10,
+	cpssrvmax:   100000,
+	div:         false,
+	checkchain:  false,
+	checkids:    false,
+	pptpolicy:   "",
+	prepare:     false,
+	finalize:    false,
+	finalcert:   "",
+	siginput:    "",
+	signature:   "",
+	signconn:    false,
+	checkconn:   false,
+	rcdi:        false,
+	rcdisrc:     "",
+	rcdialg:     "sha256",
+	rcdidigest:  "",
+	rcdiverify:  false,
+	mky:         "",
+	claims:      "",
+	printclaims: false,
+	pptform:     "full",
+	pptclaims:   "",
+	canonjson:   false,
+	idmaxlen:    0,
+	idsizebudg:  0,
+	idsizepol:   "warn",
+	segmaxlen:   0,
+	desttnmax:   0,
+	iatskew:     0,
+	expshaken:   0,
+	expdiv:      0,
+	rescachettl: 0,
+	rescachemax: 10000,
+	exprcd:      0,
+	corsorigins: "",
+	corsmethods: "GET, POST, OPTIONS",
+	corsheaders: "Content-Type, Content-Encoding, Accept, X-Call-ID, X-Request-ID, X-API-Key, X-Source-Trunk, X-Key-Name, X-Tenant-ID, X-Passport-Form, X-Passport-Claims, X-Verify-Timeout, X-Claims, X-Mky, X-Caller-TN, X-Connected-TN, X-Orig-ID",
+	corsmaxage:  600,
+	httpmaxbody: 10485760,
+	jobsworkers: 8,
+	jobsret:     600,
+	jobsmax:     100000,
+	otelurl:     "",
+	otelservice: "secsipidx",
+	certinfo:    false,
+	diff:        false,
+	fixtures:    "",
+	fixturesdir: "",
+	fixturesurl: "",
+	recorddir:   "",
+	recordmax:   1000,
+	tenantsfile: "",
+	adminkey:    "",
+	quotafile:   "",
+	replay:      "",
+	cacheop:     "",
+	keygen:      false,
+	keysop:      "",
+	p12pass:     "",
+	completion:  "",
+	serviceop:   "",
+	servicename: "secsipidx",
+	verdictkey:  "",
+	verdictx5u:  "",
+	servicekey:  "",
+	degradwarn:  "",
+	degradwin:   300,
+	memlimit:    0,
+	maxverify:   0,
+	maxqueued:   0,
+	signrate:    0,
+	signburst:   0,
+	signwait:    0,
+	watchdir:    "",
+	watchintvl:  2,
+	probeurls:   "",
+	probeintvl:  60,
+	batch:       "",
+	batchorder:  "ordered",
+	jobs:        runtime.NumCPU(),
+	fuzziter:    1000,
+	fuzzseed:    0,
+	fuzzout:     "",
+	fuzz:        false,
+	servicex5u:  "",
+	verdictiss:  "",
+	stats:       false,
+	statsmax:    1000,
+	chaos:       false,
+	chaosdelay:  0,
+	chaosfail:   0,
+	chaosskew:   0,
+	resign:      false,
+	resignage:   3600,
+	spc:         "",
+	fprvkeynext: "",
+	keycutover:  "",
+	keyringfile: "",
+	keyname:     "",
+	fcert:       "",
+	fcertnext:   "",
+	selfcheck:   0,
+	pinfile:     "",
+	pinpolicy:   "",
+	carrierfile: "",
+	carrierrefr: 300,
+	treatment:   "",
+	latency:     false,
+	ipfamily:    0,
+	ipprefer:    0,
+	happyeyes:   300,
+	fetchsrv:    false,
+	dnsservers:  "",
+	dnscache:    false,
+	useragent:   "secsipidx/" + secsipidxVersion,
+	fetchhdrs:   "",
+	fetchredir:  10,
+	redirstrict: false,
+	repoauth:    "",
+	redirect:    false,
+	redirtarget: "",
+	redirpolicy: "div",
+	fpcap:       "",
+	pcapreport:  "",
+	fcdr:        "",
+	report:      "",
+	reportbuck:  3600,
+	reportfile:  "",
+	noidentity:  "error",
+	noidexcept:  "",
+	softfail:    false,
+	verifymax:   0,
 }
 
 // initialize application components
@@ -104,8 +477,9 @@ func init() {
 	// command line arguments
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s (v%s):\n", filepath.Base(os.Args[0]), secsipidxVersion)
+		cliSubcommandsUsage()
 		fmt.Fprintf(os.Stderr, "    (some options have short and long version)\n")
-		flag.PrintDefaults()
+		cliPrintGroupedDefaults()
 		os.Exit(1)
 	}
 
@@ -114,9 +488,24 @@ func init() {
 	flag.StringVar(&cliops.httpssrv, "https-srv", cliops.httpssrv, "https server bind address")
 	flag.StringVar(&cliops.httpspubkey, "https-pubkey", cliops.httpspubkey, "https server public key")
 	flag.StringVar(&cliops.httpsprvkey, "https-prvkey", cliops.httpsprvkey, "https server private key")
+	flag.StringVar(&cliops.servicename, "service-name", cliops.servicename, "name of the Windows service")
+	flag.IntVar(&cliops.jobsworkers, "jobs-workers", cliops.jobsworkers, "number of items of batch jobs processed concurrently")
+	flag.IntVar(&cliops.jobsret, "jobs-retention", cliops.jobsret, "duration of batch job results retention after completion (in seconds)")
+	flag.IntVar(&cliops.jobsmax, "jobs-max-items", cliops.jobsmax, "maximum number of items in a batch job, 0 for no limit")
+	flag.StringVar(&cliops.batch, "batch", cliops.batch, "file with the items to check (identity values) or to sign (JSON sign requests), one per line, '-' for stdin (default: '')")
+	flag.StringVar(&cliops.batchorder, "batch-order", cliops.batchorder, "order of the batch results: ordered (as the input) or unordered (as completed)")
+	flag.IntVar(&cliops.jobs, "jobs", cliops.jobs, "number of batch items processed concurrently, by default the number of CPUs")
+	flag.IntVar(&cliops.fuzziter, "fuzz-iterations", cliops.fuzziter, "number of mutated passports verified by the fuzz subcommand")
+	flag.Int64Var(&cliops.fuzzseed, "fuzz-seed", cliops.fuzzseed, "seed of the mutations of the fuzz subcommand, 0 for a random one")
+	flag.StringVar(&cliops.fuzzout, "fuzz-out", cliops.fuzzout, "path to the file for the findings of the fuzz subcommand (default: stdout)")
+	flag.StringVar(&cliops.corsorigins, "cors-origins", cliops.corsorigins, "comma separated origins allowed for CORS requests to http api, '*' for any (default: '')")
+	flag.StringVar(&cliops.corsmethods, "cors-methods", cliops.corsmethods, "methods allowed for CORS requests to http api")
+	flag.StringVar(&cliops.corsheaders, "cors-headers", cliops.corsheaders, "request headers allowed for CORS requests to http api")
+	flag.IntVar(&cliops.corsmaxage, "cors-max-age", cliops.corsmaxage, "duration of caching CORS preflight results (in seconds)")
+	flag.IntVar(&cliops.httpmaxbody, "http-max-body", cliops.httpmaxbody, "maximum size of the http request body, after decompression (in bytes, 0 for no limit)")
 	flag.StringVar(&cliops.httpdir, "http-dir", cliops.httpdir, "directory to serve over http")
-	flag.StringVar(&cliops.fprvkey, "fprvkey", cliops.fprvkey, "path to private key")
-	flag.StringVar(&cliops.fprvkey, "k", cliops.fprvkey, "path to private key")
+	flag.StringVar(&cliops.fprvkey, "fprvkey", cliops.fprvkey, "path to private key, '-' for stdin, 'fd:N' for file descriptor, 'cred:NAME' for systemd credential")
+	flag.StringVar(&cliops.fprvkey, "k", cliops.fprvkey, "path to private key, '-' for stdin, 'fd:N' for file descriptor, 'cred:NAME' for systemd credential")
 	flag.StringVar(&cliops.fpubkey, "fpubkey", cliops.fpubkey, "path to public key")
 	flag.StringVar(&cliops.fpubkey, "p", cliops.fpubkey, "path to public key")
 	flag.StringVar(&cliops.fheader, "fheader", cliops.fheader, "path to file with header value in JSON format")
@@ -124,11 +513,43 @@ func init() {
 	flag.StringVar(&cliops.fpayload, "fpayload", cliops.fpayload, "path to file with payload value in JSON format")
 	flag.StringVar(&cliops.payload, "payload", cliops.payload, "payload value in JSON format")
 	flag.StringVar(&cliops.fidentity, "fidentity", cliops.fidentity, "path to file with identity value")
+	flag.StringVar(&cliops.fpcap, "fpcap", cliops.fpcap, "path to capture file (pcap or pcapng) to check the identity of the SIP INVITEs, only the ones with call-id if set")
+	flag.StringVar(&cliops.fcdr, "fcdr", cliops.fcdr, "path to CDR export (CSV with header row naming the identity and time columns) to check the identities for the summary report")
+	flag.StringVar(&cliops.report, "report", cliops.report, "format of the summary report of the identities from fpcap or fcdr (json or csv)")
+	flag.IntVar(&cliops.reportbuck, "report-bucket", cliops.reportbuck, "duration of the time intervals of the summary report (in seconds)")
+	flag.StringVar(&cliops.reportfile, "report-file", cliops.reportfile, "path to file to write the summary report (default: stdout)")
+	flag.StringVar(&cliops.noidentity, "no-identity", cliops.noidentity, "result for the SIP INVITEs and CDRs without identity (error or no-tn-validation)")
+	flag.StringVar(&cliops.noidexcept, "no-identity-except", cliops.noidexcept, "comma separated list of source addresses, networks or trunks for which the other no-identity result is used")
+	flag.BoolVar(&cliops.softfail, "soft-fail", cliops.softfail, "report the identities that cannot be verified because of certificate repository or CRL errors as unavailable instead of failed")
+	flag.StringVar(&cliops.pcapreport, "pcap-report", cliops.pcapreport, "path to file to write the JSON report of checking the capture file (default: stdout)")
 	flag.StringVar(&cliops.identity, "identity", cliops.identity, "identity value")
 	flag.StringVar(&cliops.alg, "alg", cliops.alg, "encryption algorithm")
+	flag.StringVar(&cliops.signeralgs, "signer-algs", cliops.signeralgs, "comma separated list of the enabled signature algorithms: ES256, ES384, EdDSA, RS256 (only for lab tests)")
 	flag.StringVar(&cliops.ppt, "ppt", cliops.ppt, "used extension")
 	flag.StringVar(&cliops.typ, "typ", cliops.typ, "token type")
-	flag.StringVar(&cliops.x5u, "x5u", cliops.x5u, "value of the field with the location of the certificate used to sign the token (default: '')")
+	flag.StringVar(&cliops.x5u, "x5u", cliops.x5u, "value of the field with the location of the certificate used to sign the token, with the template variables {spc}, {keyid}, {ppt} and {attest} (default: '')")
+	flag.StringVar(&cliops.fprvkeynext, "fprvkey-next", cliops.fprvkeynext, "path to next private key, used for signing after key-cutover (default: '')")
+	flag.StringVar(&cliops.keycutover, "key-cutover", cliops.keycutover, "time to start signing with fprvkey-next, as RFC3339 or unix timestamp (default: '')")
+	flag.StringVar(&cliops.recorddir, "record-dir", cliops.recorddir, "directory to record the inputs of the failed verifications as bundles for replay (default: '')")
+	flag.IntVar(&cliops.recordmax, "record-max", cliops.recordmax, "maximum number of bundles in the record directory, 0 for no limit")
+	flag.StringVar(&cliops.replay, "replay", cliops.replay, "replay the failed verification recorded in the bundle file")
+	flag.StringVar(&cliops.adminkey, "admin-key", cliops.adminkey, "api key for the admin endpoints of the http server, like /v1/origid (default: '')")
+	flag.StringVar(&cliops.tenantsfile, "tenants", cliops.tenantsfile, "path to JSON file with the tenants of the http server, with their signing profile and api keys (default: '')")
+	flag.StringVar(&cliops.quotafile, "quota-file", cliops.quotafile, "path to JSON file to persist the quota counters of the tenants (default: '')")
+	flag.StringVar(&cliops.fixtures, "fixtures", cliops.fixtures, "test certificates to serve and sign with, as 'name[:spc],...' (default: '')")
+	flag.StringVar(&cliops.fixturesdir, "fixtures-dir", cliops.fixturesdir, "directory to store the keys and certificates of the fixtures (default: temporary directory)")
+	flag.StringVar(&cliops.fixturesurl, "fixtures-url", cliops.fixturesurl, "base URL of the fixtures for the x5u (default: address of the http server)")
+	flag.StringVar(&cliops.keyringfile, "keyring", cliops.keyringfile, "path to JSON file with the named private keys for signing, with their x5u and validity window (default: '')")
+	flag.StringVar(&cliops.keyname, "key-name", cliops.keyname, "name of the keyring key for signing (default: '' - the default key of the keyring)")
+	flag.StringVar(&cliops.fcert, "fcert", cliops.fcert, "path to certificate of fprvkey, published by http server on /v1/certs/{keyid}.pem (default: '')")
+	flag.StringVar(&cliops.p12pass, "p12-password", cliops.p12pass, "password of the PKCS#12 bundle for the keys command, 'env:NAME' to read it from the environment variable (default: '')")
+	flag.StringVar(&cliops.fcertnext, "fcert-next", cliops.fcertnext, "path to certificate of fprvkey-next, published by http server on /v1/certs/{keyid}.pem (default: '')")
+	flag.BoolVar(&cliops.latency, "latency-metrics", cliops.latency, "enable the latency histograms of the verification stages on /metrics")
+	flag.IntVar(&cliops.selfcheck, "self-check-interval", cliops.selfcheck, "interval to sign and verify a synthetic identity, fetching the certificate from x5u (in seconds, 0 - disabled)")
+	flag.StringVar(&cliops.probeurls, "probe-urls", cliops.probeurls, "comma separated list of partner certificate repository URLs (base or certificate URLs) to probe periodically (default: '')")
+	flag.IntVar(&cliops.probeintvl, "probe-interval", cliops.probeintvl, "interval to probe the partner certificate repository URLs (in seconds)")
+	flag.StringVar(&cliops.x5tcert, "x5t-cert", cliops.x5tcert, "certificate whose SHA-256 thumbprint is added as x5t#S256 to the header when signing (default: '')")
+	flag.StringVar(&cliops.spc, "spc", cliops.spc, "service provider code, the value of {spc} variable in x5u template (default: '')")
 	flag.StringVar(&cliops.attest, "attest", cliops.attest, "attestation level")
 	flag.StringVar(&cliops.attest, "a", cliops.attest, "attestation level")
 	flag.StringVar(&cliops.desttn, "dest-tn", cliops.desttn, "destination (called) number (default: '')")
@@ -145,18 +566,146 @@ func init() {
 	flag.BoolVar(&cliops.signfull, "S", cliops.sign, "sign the header and payload, with parameters")
 	flag.BoolVar(&cliops.jsonparse, "json-parse", cliops.jsonparse, "parse and re-serialize JSON header and payload values")
 	flag.IntVar(&cliops.expire, "expire", cliops.expire, "duration of token validity (in seconds)")
-	flag.IntVar(&cliops.timeout, "timeout", cliops.timeout, "http get timeout (in seconds)")
+	flag.IntVar(&cliops.expshaken, "expire-shaken", cliops.expshaken, "duration of shaken token validity, overriding expire (in seconds, default 0)")
+	flag.IntVar(&cliops.expdiv, "expire-div", cliops.expdiv, "duration of div token validity, overriding expire (in seconds, default 0)")
+	flag.IntVar(&cliops.exprcd, "expire-rcd", cliops.exprcd, "duration of rcd token validity, overriding expire (in seconds, default 0)")
+	flag.IntVar(&cliops.timeout, "timeout", cliops.timeout, "http get timeout, also the deadline of the whole verification (in seconds)")
+	flag.IntVar(&cliops.verifymax, "verify-timeout-max", cliops.verifymax, "maximum verification budget requested with X-Verify-Timeout header (in milliseconds, default: timeout)")
 	flag.BoolVar(&cliops.ltest, "ltest", cliops.ltest, "run local basic test")
 	flag.BoolVar(&cliops.ltest, "l", cliops.ltest, "run local basic test")
 	flag.BoolVar(&cliops.version, "version", cliops.version, "print version")
+	flag.BoolVar(&cliops.fips, "fips", cliops.fips, "require a FIPS 140 validated crypto backend (boringcrypto or the Go Cryptographic Module), exit at startup if it is not active")
 	flag.StringVar(&cliops.cachedir, "cache-dir", cliops.cachedir, "path to the directory with cached certificates (default: '')")
+	flag.BoolVar(&cliops.cacheinteg, "cache-integrity", cliops.cacheinteg, "store the digests of the cached certificates and discard the entries not matching them")
+	flag.IntVar(&cliops.cachemaxent, "cache-max-entries", cliops.cachemaxent, "maximum number of cached certificates, the least recently used ones are removed (default: 0 - no limit)")
+	flag.IntVar(&cliops.cachemaxkb, "cache-max-size", cliops.cachemaxkb, "maximum size of the cached certificates in KB, the least recently used ones are removed (default: 0 - no limit)")
+	flag.IntVar(&cliops.cachereval, "cache-revalidate", cliops.cachereval, "seconds to keep the expired cached certificates to revalidate them with conditional requests (default: 0 - disabled)")
+	flag.IntVar(&cliops.cachestale, "cache-stale-if-error", cliops.cachestale, "seconds to use the expired cached certificates when they cannot be fetched (default: 0 - disabled)")
+	flag.IntVar(&cliops.cachejanit, "cache-janitor", cliops.cachejanit, "interval in seconds to remove the expired cached certificates (default: 0 - disabled)")
+	flag.StringVar(&cliops.cachekey, "cache-key-file", cliops.cachekey, "path to file with the key for signing the digests of the cached certificates (HMAC-SHA256)")
 	flag.IntVar(&cliops.cacheexpire, "cache-expire", cliops.cacheexpire, "duration of cached certificates (in seconds)")
 	flag.StringVar(&cliops.cafile, "ca-file", cliops.cafile, "file with root CA certificates in pem format")
 	flag.StringVar(&cliops.cainter, "ca-inter", cliops.cainter, "file with intermediate CA certificates in pem format")
 	flag.StringVar(&cliops.crlfile, "crl-file", cliops.crlfile, "file with CRL in pem format")
+	flag.IntVar(&cliops.crlrefresh, "crl-refresh", cliops.crlrefresh, "interval in seconds to check the CRL file for changes in background (default: 0 - checked at each use)")
+	flag.StringVar(&cliops.ocspshared, "ocsp-shared", cliops.ocspshared, "address of the shared cache (Redis) for the OCSP responses, as host:port or redis://[:password@]host:port[/db]")
+	flag.StringVar(&cliops.crlpolicy, "crl-policy", cliops.crlpolicy, "policy for the CRL check: hard-fail (reject if the status cannot be obtained), soft-fail (accept with warning) or skip")
+	flag.StringVar(&cliops.ocsppolicy, "ocsp-policy", cliops.ocsppolicy, "policy for the OCSP check: hard-fail (reject if the status cannot be obtained), soft-fail (accept with warning) or skip")
+	flag.IntVar(&cliops.shortlived, "short-lived-max", cliops.shortlived, "maximum validity period in seconds of the short-lived certificates, for which the revocation checks are skipped (default: 0 - disabled)")
+	flag.StringVar(&cliops.certpolicy, "cert-policy", cliops.certpolicy, "mode of the policy checks of the signer certificate: off, lenient (check the extensions present in the certificate) or strict (the extensions are also required)")
+	flag.StringVar(&cliops.certpoloids, "cert-policy-oids", cliops.certpoloids, "comma separated list of the allowed certificate policy OIDs for the signer certificate (empty - not checked)")
+	flag.StringVar(&cliops.certpoleku, "cert-policy-eku", cliops.certpoleku, "comma separated list of the allowed extended key usage OIDs for the signer certificate (empty - not checked)")
 	flag.IntVar(&cliops.certverify, "cert-verify", cliops.certverify, "certificate verification mode (default 0)")
+	flag.BoolVar(&cliops.aiafetch, "aia-fetch", cliops.aiafetch, "fetch the missing intermediate CA certificates from the AIA URLs of the certificates")
+	flag.IntVar(&cliops.aiamax, "aia-max", cliops.aiamax, "maximum number of intermediate CA levels fetched from AIA URLs")
+	flag.BoolVar(&cliops.resultchain, "result-chain", cliops.resultchain, "add the subjects of the certificate chain used for verification to the check results")
+	flag.StringVar(&cliops.aiahosts, "aia-hosts", cliops.aiahosts, "comma separated list of hosts allowed for AIA URLs (default: any)")
 	flag.IntVar(&cliops.verbosity, "verbosity", cliops.verbosity, "verbosity level (default 0)")
 	flag.IntVar(&cliops.verbosity, "vl", cliops.verbosity, "verbosity level (default 0)")
+	flag.StringVar(&cliops.otelurl, "otel-url", cliops.otelurl, "URL of OpenTelemetry collector to export traces with OTLP/HTTP, like 'http://127.0.0.1:4318/v1/traces' (default: '')")
+	flag.StringVar(&cliops.otelservice, "otel-service", cliops.otelservice, "service name for the exported traces")
+	flag.StringVar(&cliops.verdictkey, "verdict-key", cliops.verdictkey, "path to service private key for signing the verdicts of the HTTP check endpoint (default: '')")
+	flag.StringVar(&cliops.verdictx5u, "verdict-x5u", cliops.verdictx5u, "value of x5u field in the header of the signed verdicts (default: '')")
+	flag.BoolVar(&cliops.stats, "stats", cliops.stats, "track the sign and check requests per source IP and API key, exposed on /v1/stats and /metrics, and the verifications per issuing CA on /v1/stats/ca")
+	flag.IntVar(&cliops.statsmax, "stats-max-clients", cliops.statsmax, "maximum number of tracked clients per type, the others are counted as 'other' (0 - no limit)")
+	flag.BoolVar(&cliops.chaos, "chaos", cliops.chaos, "enable the admin endpoint /v1/chaos for injecting failures (testing only)")
+	flag.IntVar(&cliops.chaosdelay, "chaos-fetch-delay", cliops.chaosdelay, "latency added to the retrieval of certificates, in milliseconds (testing only)")
+	flag.IntVar(&cliops.chaosfail, "chaos-fetch-fail", cliops.chaosfail, "percent of failed retrievals of certificates (testing only)")
+	flag.IntVar(&cliops.chaosskew, "chaos-clock-skew", cliops.chaosskew, "offset of the clock used for verification, in seconds (testing only)")
+	flag.StringVar(&cliops.servicekey, "service-key", cliops.servicekey, "path to service private key for the signatures other than the PASSporTs (verdicts, CPS requests) (default: '')")
+	flag.StringVar(&cliops.servicex5u, "service-x5u", cliops.servicex5u, "value of x5u field in the header of the signatures with the service key (default: '')")
+	flag.StringVar(&cliops.degradwarn, "degraded-warn", cliops.degradwarn, "warning thresholds of the fraction of verifications via degraded paths, as 'path=fraction,...' with path being cache, softfail or pin (default: '')")
+	flag.IntVar(&cliops.degradwin, "degraded-window", cliops.degradwin, "window for the fraction of verifications via degraded paths (in seconds)")
+	flag.IntVar(&cliops.memlimit, "mem-limit", cliops.memlimit, "soft memory limit of the http server in MB, the garbage collection running more often near it (0 - no limit)")
+	flag.IntVar(&cliops.maxverify, "max-verifications", cliops.maxverify, "maximum number of concurrent verification requests of the http server (0 - no limit)")
+	flag.IntVar(&cliops.maxqueued, "max-queued", cliops.maxqueued, "maximum number of verification requests waiting for a free slot, the others are rejected (0 - no queue)")
+	flag.Float64Var(&cliops.signrate, "sign-rate", cliops.signrate, "maximum number of signing operations per second, for all the keys (0 - no limit)")
+	flag.IntVar(&cliops.signburst, "sign-burst", cliops.signburst, "maximum number of signing operations at once within the signing rate (0 - the rate rounded up)")
+	flag.IntVar(&cliops.signwait, "sign-max-wait", cliops.signwait, "maximum time in milliseconds to delay the signing requests over the rate, the others are rejected (0 - no delay)")
+	flag.StringVar(&cliops.watchdir, "watch-dir", cliops.watchdir, "spool directory to watch for identity files, moved after checking to the pass or fail subdirectory with a result file (default: '')")
+	flag.IntVar(&cliops.watchintvl, "watch-interval", cliops.watchintvl, "interval to scan the spool directory for new identity files (in seconds)")
+	flag.StringVar(&cliops.verdictiss, "verdict-iss", cliops.verdictiss, "value of iss field in the payload of the signed verdicts (default: '')")
+	flag.StringVar(&cliops.hepsrv, "hep-srv", cliops.hepsrv, "address of HEP capture server to send sign and check events (default: '')")
+	flag.StringVar(&cliops.hepproto, "hep-proto", cliops.hepproto, "transport protocol for HEP packets (udp or tcp)")
+	flag.IntVar(&cliops.hepid, "hep-id", cliops.hepid, "HEP capture agent id")
+	flag.StringVar(&cliops.heppass, "hep-pass", cliops.heppass, "HEP capture agent password (default: '')")
+	flag.StringVar(&cliops.callid, "call-id", cliops.callid, "SIP Call-ID used to correlate HEP events (default: '')")
+	flag.StringVar(&cliops.dbdriver, "db-driver", cliops.dbdriver, "database driver for storing sign and check records (sqlite3 or postgres)")
+	flag.StringVar(&cliops.dbdsn, "db-dsn", cliops.dbdsn, "database connection string, storing records is enabled if set (default: '')")
+	flag.BoolVar(&cliops.origidstor, "origid-store", cliops.origidstor, "store the origids of the signed identities with the call metadata in the database, for the traceback lookups")
+	flag.StringVar(&cliops.origidmeta, "origid-meta", cliops.origidmeta, "JSON object with the call metadata stored for the origid of the signed identity (default: '')")
+	flag.BoolVar(&cliops.dbquery, "db-query", cliops.dbquery, "print stored records filtered by orig-tn, dest-tn, orig-id, db-since and db-until")
+	flag.IntVar(&cliops.dbsince, "db-since", cliops.dbsince, "query records stored after the timestamp (default 0)")
+	flag.IntVar(&cliops.dbuntil, "db-until", cliops.dbuntil, "query records stored before the timestamp (default 0)")
+	flag.IntVar(&cliops.dblimit, "db-limit", cliops.dblimit, "maximum number of records printed by db query")
+	flag.StringVar(&cliops.dnofile, "dno-file", cliops.dnofile, "file with do-not-originate numbers, one per line (default: '')")
+	flag.IntVar(&cliops.ipfamily, "fetch-ip-family", cliops.ipfamily, "address family for fetching the certificates (0 - any, 4 - IPv4 only, 6 - IPv6 only)")
+	flag.IntVar(&cliops.ipprefer, "fetch-ip-prefer", cliops.ipprefer, "preferred address family for fetching the certificates (0 - resolver order, 4 - IPv4, 6 - IPv6)")
+	flag.IntVar(&cliops.happyeyes, "fetch-happy-eyeballs", cliops.happyeyes, "delay to try in parallel the other address family for fetching the certificates (in milliseconds, 0 - disabled)")
+	flag.BoolVar(&cliops.fetchsrv, "fetch-srv", cliops.fetchsrv, "use the SRV records (_https._tcp or _http._tcp) of the x5u host for fetching the certificates")
+	flag.StringVar(&cliops.dnsservers, "dns-servers", cliops.dnsservers, "comma separated list of DNS servers (ip[:port]) for resolving the hosts of the certificate URLs (default: '' - system resolver)")
+	flag.BoolVar(&cliops.dnscache, "dns-cache", cliops.dnscache, "cache the addresses of the hosts of the certificate URLs for the TTL of the DNS records")
+	flag.StringVar(&cliops.useragent, "fetch-user-agent", cliops.useragent, "User-Agent header for fetching the certificates")
+	flag.StringVar(&cliops.fetchhdrs, "fetch-headers-file", cliops.fetchhdrs, "file with extra headers for fetching the certificates, one 'Name: value' per line (default: '')")
+	flag.IntVar(&cliops.fetchredir, "fetch-redirects", cliops.fetchredir, "maximum number of redirects followed for fetching the certificates (0 - redirects not allowed)")
+	flag.BoolVar(&cliops.redirstrict, "fetch-redirect-strict", cliops.redirstrict, "fail fetching the certificates if a redirect goes to a different host")
+	flag.StringVar(&cliops.repoauth, "repo-auth-file", cliops.repoauth, "file with the credentials (bearer token, mTLS client certificate) for the private certificate repositories, one x5u host per line (default: '')")
+	flag.StringVar(&cliops.pinfile, "pin-file", cliops.pinfile, "file with the pinned public keys, one per line as x5u host (or spc:<code>) and PEM file path (default: '')")
+	flag.StringVar(&cliops.pinpolicy, "pin-policy", cliops.pinpolicy, "policy for the pinned public keys, required with -pin-file (fallback - used when the certificate cannot be fetched, enforce - also must match the fetched certificate)")
+	flag.StringVar(&cliops.dnomode, "dno-mode", cliops.dnomode, "action for orig tn in do-not-originate list (reject or flag)")
+	flag.StringVar(&cliops.tnlookup, "tn-lookup", cliops.tnlookup, "http(s) URL or 'exec:/path/to/helper' to classify orig tn for attestation level (default: '')")
+	flag.IntVar(&cliops.tnlookupexp, "tn-lookup-expire", cliops.tnlookupexp, "duration of cached tn lookup results (in seconds)")
+	flag.StringVar(&cliops.tnlookupatt, "tn-lookup-attest", cliops.tnlookupatt, "mapping of tn classification to attestation level")
+	flag.StringVar(&cliops.tnlookupfb, "tn-lookup-fallback", cliops.tnlookupfb, "attestation level if the tn lookup fails or the classification is not mapped")
+	flag.StringVar(&cliops.cvturl, "cvt-url", cliops.cvturl, "http(s) URL of the call analytics service queried for the verdict of the checked identities (default: '')")
+	flag.IntVar(&cliops.cvtexpire, "cvt-expire", cliops.cvtexpire, "duration of cached call analytics verdicts (in seconds)")
+	flag.IntVar(&cliops.cvttimeout, "cvt-timeout", cliops.cvttimeout, "timeout for querying the call analytics service (in milliseconds)")
+	flag.StringVar(&cliops.carrierfile, "carrier-file", cliops.carrierfile, "CSV file with the carrier names by service provider code (SPC or OCN), as 'code,name' lines (default: '')")
+	flag.IntVar(&cliops.carrierrefr, "carrier-refresh", cliops.carrierrefr, "interval to check if the carrier names file was modified and reload it (in seconds)")
+	flag.StringVar(&cliops.treatment, "treatment-policy", cliops.treatment, "path to JSON file with the policy for the recommended call treatment of the check results (default: '')")
+	flag.StringVar(&cliops.attestmtx, "attest-matrix", cliops.attestmtx, "path to JSON file with attestation decision matrix (default: '')")
+	flag.StringVar(&cliops.trunk, "trunk", cliops.trunk, "source trunk used by attestation decision matrix (default: '')")
+	flag.StringVar(&cliops.cpsurl, "cps-url", cliops.cpsurl, "base URL of out-of-band call placement service (default: '')")
+	flag.BoolVar(&cliops.cpspublish, "cps-publish", cliops.cpspublish, "publish signed passports to call placement service")
+	flag.BoolVar(&cliops.cpssrv, "cps-srv", cliops.cpssrv, "run call placement service in http server mode")
+	flag.IntVar(&cliops.cpssrvret, "cps-srv-retention", cliops.cpssrvret, "duration of passports retention in call placement service (in seconds)")
+	flag.IntVar(&cliops.cpssrvkey, "cps-srv-max-call", cliops.cpssrvkey, "maximum number of passports stored per call in call placement service")
+	flag.IntVar(&cliops.cpssrvmax, "cps-srv-max", cliops.cpssrvmax, "maximum number of passports stored in call placement service")
+	flag.BoolVar(&cliops.div, "div", cliops.div, "add div identity for retargeting the call in identity to dest-tn")
+	flag.BoolVar(&cliops.resign, "resign", cliops.resign, "re-issue the identity signed with fprvkey, with a fresh iat and the orig-id if set")
+	flag.IntVar(&cliops.resignage, "resign-max-age", cliops.resignage, "maximum age of the identity to be re-issued (in seconds)")
+	flag.BoolVar(&cliops.redirect, "redirect", cliops.redirect, "build the identities for the INVITE recursed on a 3xx redirect to redirect-target")
+	flag.StringVar(&cliops.redirtarget, "redirect-target", cliops.redirtarget, "contact uri of the 3xx redirect")
+	flag.StringVar(&cliops.redirpolicy, "redirect-policy", cliops.redirpolicy, "policy for the identities on redirect (div - add div identity, resign - re-issue the shaken identity with the new dest, keep - unchanged)")
+	flag.BoolVar(&cliops.checkchain, "check-chain", cliops.checkchain, "check the shaken and div identities as diversion chain")
+	flag.BoolVar(&cliops.checkids, "check-identities", cliops.checkids, "check the identities of the call from trunk with the ppt policy")
+	flag.StringVar(&cliops.pptpolicy, "ppt-policy", cliops.pptpolicy, "path to JSON file with the ppt extensions required, optional, ignored and forbidden per trunk (default: '' - shaken required)")
+	flag.BoolVar(&cliops.prepare, "prepare", cliops.prepare, "build the canonical header and payload JSON and the signing input of the identity, without signing it")
+	flag.BoolVar(&cliops.finalize, "finalize", cliops.finalize, "build the identity from the signing input and its ES256 signature done elsewhere, verifying the signature with the certificate of the signer")
+	flag.StringVar(&cliops.finalcert, "finalize-cert", cliops.finalcert, "certificate of the signer for verifying the signatures to finalize (default: '' - the one of x5t-cert)")
+	flag.StringVar(&cliops.siginput, "signing-input", cliops.siginput, "signing input of the identity to finalize, as given by prepare")
+	flag.StringVar(&cliops.signature, "signature", cliops.signature, "ES256 signature of the signing input to finalize, base64url encoded as r and s values or DER")
+	flag.BoolVar(&cliops.signconn, "sign-connected", cliops.signconn, "build connected identity of the answering party dest-tn for the call from orig-tn")
+	flag.BoolVar(&cliops.checkconn, "check-connected", cliops.checkconn, "check connected identity for the call from orig-tn, answered by dest-tn if set")
+	flag.BoolVar(&cliops.rcdi, "rcdi", cliops.rcdi, "compute rcdi digest of rcd resource, verifying it if rcdi-digest is set")
+	flag.StringVar(&cliops.rcdisrc, "rcdi-src", cliops.rcdisrc, "http(s) URL or path of rcd resource (logo, jCard) (default: '')")
+	flag.StringVar(&cliops.rcdialg, "rcdi-alg", cliops.rcdialg, "hash algorithm for rcdi digest (sha256, sha384 or sha512)")
+	flag.StringVar(&cliops.rcdidigest, "rcdi-digest", cliops.rcdidigest, "expected rcdi digest of rcd resource (default: '')")
+	flag.BoolVar(&cliops.rcdiverify, "rcdi-verify", cliops.rcdiverify, "verify rcd resources against rcdi digests when checking identity")
+	flag.StringVar(&cliops.mky, "mky", cliops.mky, "media key fingerprints for mky claim, separated by ';', like 'sha-256 4A:AD:...' (default: '')")
+	flag.StringVar(&cliops.claims, "claims", cliops.claims, "additional payload claims as JSON object to be merged at signing (default: '')")
+	flag.BoolVar(&cliops.canonjson, "canonical-json", cliops.canonjson, "serialize header and payload with ordered members and without white spaces")
+	flag.IntVar(&cliops.idmaxlen, "identity-max-len", cliops.idmaxlen, "maximum length of identity value to be checked (0 - no limit)")
+	flag.IntVar(&cliops.segmaxlen, "segment-max-len", cliops.segmaxlen, "maximum length of each token segment of identity value (0 - no limit)")
+	flag.IntVar(&cliops.desttnmax, "dest-tn-max", cliops.desttnmax, "maximum number of dest tn values in payload (0 - no limit)")
+	flag.IntVar(&cliops.iatskew, "iat-skew", cliops.iatskew, "allowed clock skew for iat in the future (in seconds, 0 - no check)")
+	flag.IntVar(&cliops.rescachettl, "result-cache-ttl", cliops.rescachettl, "time to cache the successful results of checking the identity (in seconds, 0 - no cache)")
+	flag.IntVar(&cliops.rescachemax, "result-cache-max", cliops.rescachemax, "maximum number of cached check results (0 - no limit)")
+	flag.BoolVar(&cliops.printclaims, "print-claims", cliops.printclaims, "print the payload claims of the valid identity at check")
+	flag.IntVar(&cliops.idsizebudg, "identity-size-budget", cliops.idsizebudg, "size budget in bytes of the Identity header field of the signed identities (default: 0 - no budget)")
+	flag.StringVar(&cliops.idsizepol, "identity-size-policy", cliops.idsizepol, "action for the signed identities over the size budget (warn or fail)")
+	flag.StringVar(&cliops.pptform, "passport-form", cliops.pptform, "form of the signed identity: full, compact or both")
+	flag.StringVar(&cliops.pptclaims, "passport-claims", cliops.pptclaims, "payload claims as JSON object for checking the identity in compact form (default: '')")
 }
 
 func localTest() {
@@ -210,13 +759,72 @@ func localTest() {
 
 func secsipidxCLISignFull() int {
 
-	token, _, err := secsipid.SJWTGetIdentity(cliops.origtn, cliops.desttn, cliops.attest, cliops.origid, cliops.x5u, cliops.fprvkey)
+	mky, ret, err := secsipid.SJWTParseMky(cliops.mky)
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return cliExitArgs
+	}
+	claims, err := parseClaims(cliops.claims)
+	if err != nil {
+		fmt.Printf("error: invalid claims: %v\n", err)
+		return cliExitArgs
+	}
+	meta, err := origidParseMeta(cliops.origidmeta)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return cliExitArgs
+	}
+	prvkeyPath, x5uVal, err := signKey(cliops.keyname, cliops.x5u)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return cliExitKey
+	}
+	attestVal := signAttestation(&SignAttrs{OrigTN: cliops.origtn, Trunk: cliops.trunk, Attest: cliops.attest})
+	payload := secsipid.SJWTPayload{
+		ATTest: attestVal,
+		Dest: secsipid.SJWTDest{
+			TN: []string{cliops.desttn},
+		},
+		Mky: mky,
+		Orig: secsipid.SJWTOrig{
+			TN: cliops.origtn,
+		},
+		OrigID: cliops.origid,
+		Extra:  claims,
+	}
+	var token, compact string
+	switch cliops.pptform {
+	case "full":
+		token, ret, err = secsipid.SJWTGetIdentityPayload(payload, x5uVal, prvkeyPath)
+	case "compact", "both":
+		token, compact, ret, err = secsipid.SJWTGetIdentityPayloadForms(payload, x5uVal, prvkeyPath)
+	default:
+		fmt.Printf("error: invalid passport form: %s\n", cliops.pptform)
+		return cliExitArgs
+	}
+
+	emitEvent(&EventRecord{Event: "sign", Code: ret, OrigTN: cliops.origtn, DestTN: cliops.desttn,
+		OrigID: identityPayload(token).OrigID, CallID: cliops.callid, Message: errorMessage(err)}, "", "")
 
 	if err != nil {
 		fmt.Printf("error: %v\n", err)
-		return -1
+		return ret
+	}
+	checked := token
+	if cliops.pptform == "compact" {
+		checked = compact
+	}
+	if ret = cliIdentitySizeCheck(checked); ret != 0 {
+		return ret
+	}
+	origidStoreSign(token, cliops.callid, "", meta)
+	cpsPublish(cliops.origtn, cliops.desttn, token)
+	if cliops.pptform != "compact" {
+		fmt.Printf("%s\n", token)
+	}
+	if cliops.pptform != "full" {
+		fmt.Printf("%s\n", compact)
 	}
-	fmt.Printf("%s\n", token)
 	return 0
 }
 
@@ -229,7 +837,7 @@ func secsipidxCLISign() int {
 
 	if len(cliops.fprvkey) <= 0 {
 		fmt.Printf("path to private key not provided\n")
-		return -1
+		return cliExitArgs
 	}
 
 	useStruct = false
@@ -242,7 +850,7 @@ func secsipidxCLISign() int {
 			if err != nil {
 				fmt.Printf("Failed to parse header json\n")
 				fmt.Println(err)
-				return -1
+				return cliExitArgs
 			}
 			useStruct = true
 		} else {
@@ -254,7 +862,7 @@ func secsipidxCLISign() int {
 			if err != nil {
 				fmt.Printf("Failed to parse header json\n")
 				fmt.Println(err)
-				return -1
+				return cliExitArgs
 			}
 			useStruct = true
 		} else {
@@ -280,7 +888,7 @@ func secsipidxCLISign() int {
 			if err != nil {
 				fmt.Printf("Failed to parse payload json\n")
 				fmt.Println(err)
-				return -1
+				return cliExitArgs
 			}
 			useStruct = true
 		} else {
@@ -292,23 +900,37 @@ func secsipidxCLISign() int {
 			if err != nil {
 				fmt.Printf("Failed to parse payload json\n")
 				fmt.Println(err)
-				return -1
+				return cliExitArgs
 			}
 			useStruct = true
 		} else {
 			sPayload = cliops.payload
 		}
 	} else {
+		var mky []secsipid.SJWTMky
+		if mky, _, err = secsipid.SJWTParseMky(cliops.mky); err != nil {
+			fmt.Printf("Failed to parse mky value\n")
+			fmt.Println(err)
+			return cliExitArgs
+		}
+		var claims map[string]interface{}
+		if claims, err = parseClaims(cliops.claims); err != nil {
+			fmt.Printf("Failed to parse claims json\n")
+			fmt.Println(err)
+			return cliExitArgs
+		}
 		payload = secsipid.SJWTPayload{
 			ATTest: cliops.attest,
 			Dest: secsipid.SJWTDest{
 				TN: []string{cliops.desttn},
 			},
 			IAT: int64(cliops.iat),
+			Mky: mky,
 			Orig: secsipid.SJWTOrig{
 				TN: cliops.origtn,
 			},
 			OrigID: cliops.origid,
+			Extra:  claims,
 		}
 		if payload.IAT == 0 {
 			payload.IAT = time.Now().Unix()
@@ -320,19 +942,20 @@ func secsipidxCLISign() int {
 		if cliops.verbosity > 0 {
 			fmt.Printf("Signing using the structures build from parameter values\n")
 		}
-		prvkey, _ := ioutil.ReadFile(cliops.fprvkey)
-		var ecdsaPrvKey *ecdsa.PrivateKey
+		prvkey, _ := secsipid.SJWTReadPrvKey(signPrvKey())
+		var prvKey interface{}
 
-		if ecdsaPrvKey, _, err = secsipid.SJWTParseECPrivateKeyFromPEM(prvkey); err != nil {
-			fmt.Printf("Unable to parse ECDSA private key: %v\n", err)
-			return -1
+		if prvKey, _, err = secsipid.SJWTParsePrivateKeyFromPEM(prvkey); err != nil {
+			fmt.Printf("Unable to parse private key: %v\n", err)
+			return cliExitKey
 		}
-		token = secsipid.SJWTEncode(header, payload, ecdsaPrvKey)
+		header.X5u = secsipid.SJWTSignX5u(header.X5u, prvkey, header.Ppt, payload.ATTest)
+		token = secsipid.SJWTEncode(header, payload, prvKey)
 	} else {
 		if cliops.verbosity > 0 {
 			fmt.Printf("Signing using the JSON documents from parameters\n")
 		}
-		token, _, _ = secsipid.SJWTEncodeText(sHeader, sPayload, cliops.fprvkey)
+		token, _, _ = secsipid.SJWTEncodeText(sHeader, sPayload, signPrvKey())
 	}
 	fmt.Printf("%s\n", token)
 
@@ -349,12 +972,75 @@ func secsipidxCLICheck() int {
 		sIdentity = string(vIdentity)
 	} else if len(cliops.identity) > 0 {
 		sIdentity = cliops.identity
+	} else if cpsClient != nil && len(cliops.origtn) > 0 && len(cliops.desttn) > 0 {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Retrieving identity from call placement service\n")
+		}
+		sIdentity, ret, err = cpsClient.CheckCall(cliops.origtn, cliops.desttn, cliops.expire, cliops.fpubkey, cliops.timeout)
+		if err != nil {
+			fmt.Printf("error message: %v\n", err)
+		}
+		return ret
 	} else {
 		fmt.Printf("Identity value not provided\n")
-		return -1
+		return cliExitArgs
+	}
+	if secsipid.SJWTIdentityIsCompact(sIdentity) {
+		if len(cliops.pptclaims) == 0 {
+			fmt.Printf("Claims for identity in compact form not provided\n")
+			return cliExitArgs
+		}
+		if sIdentity, ret, err = secsipid.SJWTIdentityExpand(sIdentity, []byte(cliops.pptclaims)); err != nil {
+			fmt.Printf("error message: %v\n", err)
+			return ret
+		}
 	}
 
-	ret, err = secsipid.SJWTCheckFullIdentity(sIdentity, cliops.expire, cliops.fpubkey, cliops.timeout)
+	info, ret, err := checkFullIdentityInfo(context.Background(), sIdentity)
+	if ret == 0 && len(cliops.mky) > 0 {
+		ret, err = checkMky(sIdentity, cliops.mky)
+	}
+	recordFailure("cli", sIdentity, info, ret, err)
+
+	payload := identityPayload(sIdentity)
+	if ret == 0 && cliops.printclaims {
+		jclaims, _ := json.MarshalIndent(payload, "", "  ")
+		fmt.Printf("%s\n", jclaims)
+	}
+	if ret == 0 && dnoFlagged(payload.Orig.TN) {
+		fmt.Printf("flagged: orig tn in do-not-originate list (%d)\n", secsipid.SJWTRetErrPolicyDNO)
+	}
+	if spc, carrier := identityCarrier(info); len(spc) > 0 {
+		fmt.Printf("carrier: %s (spc: %s)\n", carrier, spc)
+	}
+	if finalURL := identityFinalURL(sIdentity); len(finalURL) > 0 {
+		fmt.Printf("x5u redirected to: %s\n", finalURL)
+	}
+	if ret == 0 {
+		for i, subject := range identityCertChain(info) {
+			fmt.Printf("chain %d: %s\n", i, subject)
+		}
+		if rev := identityRevocation(info); rev != nil {
+			fmt.Printf("revocation: crl=%s ocsp=%s\n", revocationStatus(rev.CRL), revocationStatus(rev.OCSP))
+			for _, warning := range rev.Warnings {
+				fmt.Printf("revocation warning: %s\n", warning)
+			}
+		}
+	}
+	if treatment := checkTreatment(sIdentity, ret); len(treatment) > 0 {
+		fmt.Printf("treatment: %s\n", treatment)
+	}
+	if ret == 0 || checkUnavailable(ret) {
+		if av := checkAnalytics(sIdentity, cliops.callid, checkResultName(ret), ret); av != nil {
+			if len(av.Error) > 0 {
+				fmt.Printf("analytics: error: %s\n", av.Error)
+			} else {
+				fmt.Printf("analytics: %s (score: %g, label: %s)\n", av.Verdict, av.Score, av.Label)
+			}
+		}
+	}
+	emitEvent(&EventRecord{Event: "check", Code: ret, OrigTN: payload.Orig.TN, DestTN: strings.Join(payload.Dest.TN, ","),
+		OrigID: payload.OrigID, CallID: cliops.callid, Message: errorMessage(err)}, "", "")
 
 	if err != nil {
 		fmt.Printf("error message: %v\n", err)
@@ -362,53 +1048,267 @@ func secsipidxCLICheck() int {
 	return ret
 }
 
+// identityPayload - decode the payload of identity value without verifying it,
+// returns an empty structure if it cannot be decoded
+func identityPayload(identityVal string) *secsipid.SJWTPayload {
+	payload := &secsipid.SJWTPayload{}
+	btoken := strings.Split(strings.Split(strings.TrimSpace(identityVal), ";")[0], ".")
+	if len(btoken) != 3 {
+		return payload
+	}
+	vPayload, err := secsipid.SJWTBase64DecodeString(btoken[1])
+	if err != nil {
+		return payload
+	}
+	json.Unmarshal([]byte(vPayload), payload)
+	return payload
+}
+
+// dnoFlagged - true if do-not-originate list is used in flag mode and tn is listed
+func dnoFlagged(tn string) bool {
+	return len(cliops.dnofile) > 0 && cliops.dnomode == "flag" && secsipid.SJWTDNOListed(tn)
+}
+
+// parseClaims - additional claims from JSON object, nil if the value is empty
+func parseClaims(claimsVal string) (map[string]interface{}, error) {
+	if len(strings.TrimSpace(claimsVal)) == 0 {
+		return nil, nil
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(claimsVal), &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkFullIdentity - check the identity with -timeout being the deadline of
+// the whole verification, bounding all the fetches done for it
+func checkFullIdentity(identityVal string) (int, error) {
+	return checkFullIdentityContext(context.Background(), identityVal)
+}
+
+// checkFullIdentityContext - check the identity like checkFullIdentity(),
+// within the deadline of the context if it is earlier
+func checkFullIdentityContext(ctx context.Context, identityVal string) (int, error) {
+	_, ret, err := checkFullIdentityInfo(ctx, identityVal)
+	return ret, err
+}
+
+// checkFullIdentityInfo - check the identity like checkFullIdentityContext(),
+// returning the details of the verification (the certificate, the chain and
+// the revocation decisions) to report them without fetching them again
+func checkFullIdentityInfo(ctx context.Context, identityVal string) (*secsipid.SJWTCheckInfo, int, error) {
+	if cliops.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cliops.timeout)*time.Second)
+		defer cancel()
+	}
+	return secsipid.SJWTCheckFullIdentityInfo(ctx, identityVal, cliops.expire, cliops.fpubkey, cliops.timeout)
+}
+
+// checkMky - check that the fingerprints are asserted by the mky claim of identity
+func checkMky(identityVal string, mkyVal string) (int, error) {
+	mky, ret, err := secsipid.SJWTParseMky(mkyVal)
+	if err != nil {
+		return ret, err
+	}
+	return secsipid.SJWTCheckMky(identityVal, mky)
+}
+
+// errorMessage - the message of the error or empty string if it is nil
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 func httpHandleV1Check(w http.ResponseWriter, r *http.Request) {
 	var ret int
 
-	fmt.Printf("incoming request for identity check ...\n")
+	httpLogf(r, "incoming request for identity check ...\n")
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		fmt.Printf("error reading body: %v", err)
-		http.Error(w, "cannot read body", http.StatusBadRequest)
+		httpLogf(r, "error reading body: %v", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
 		return
 	}
-	ret, err = secsipid.SJWTCheckFullIdentity(string(body), cliops.expire, cliops.fpubkey, cliops.timeout)
+	identityVal, err := httpRequestIdentity(r, body)
+	if err != nil {
+		httpLogf(r, "invalid json body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+	budget, err := httpVerifyTimeout(r)
+	if err != nil {
+		httpLogf(r, "%v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+		return
+	}
+	info, ret, err := httpCheckFullIdentity(r, identityVal, budget)
+	if ret == 0 && len(r.Header.Get("X-Mky")) > 0 {
+		ret, err = checkMky(identityVal, r.Header.Get("X-Mky"))
+	}
+	recordFailureQueue("http", identityVal, info, ret, err)
+
+	if eventsEnabled() {
+		payload := identityPayload(identityVal)
+		srcAddr, dstAddr := httpRequestAddrs(r)
+		emitEvent(&EventRecord{Event: "check", Code: ret, OrigTN: payload.Orig.TN, DestTN: strings.Join(payload.Dest.TN, ","),
+			OrigID: payload.OrigID, CallID: httpRequestCallID(r), ReqID: httpRequestID(r), Message: errorMessage(err)}, srcAddr, dstAddr)
+	}
 
+	verdict := httpVerdict(w, r, identityVal, ret)
+	treatment := httpTreatment(w, r, identityVal, ret)
+	spc, carrier := identityCarrier(info)
+	finalURL := identityFinalURL(identityVal)
+	if len(finalURL) > 0 {
+		httpLogf(r, "x5u redirected to: %s\n", finalURL)
+	}
+	if err != nil && checkUnavailable(ret) {
+		httpLogf(r, "unable to check identity: %v (spc: %s, carrier: %s)\n", err, spc, carrier)
+		httpWriteResult(w, r, checkResultUnavailable, &CheckResult{Result: checkResultUnavailable, Code: ret,
+			Verdict: verdict, SPC: spc, Carrier: carrier, X5uFinal: finalURL, Treatment: treatment,
+			Analytics: httpAnalytics(w, r, identityVal, ret)})
+		return
+	}
 	if err != nil {
-		fmt.Printf("failed checking identity: %v\n", err)
-		http.Error(w, "FAILED\n", http.StatusInternalServerError)
+		httpLogf(r, "failed checking identity: %v (spc: %s, carrier: %s)\n", err, spc, carrier)
+		httpError(w, http.StatusInternalServerError, httpErrCheckFailed, ret, err.Error())
 		return
 	}
-	fmt.Printf("valid identity - return code: %d\n", ret)
-	fmt.Fprintf(w, "OK\n")
+	httpLogf(r, "valid identity - return code: %d (spc: %s, carrier: %s)\n", ret, spc, carrier)
+	if dnoFlagged(identityPayload(identityVal).Orig.TN) {
+		w.Header().Set("X-DNO-Listed", strconv.Itoa(secsipid.SJWTRetErrPolicyDNO))
+	}
+	revocation := identityRevocation(info)
+	if revocation != nil && len(revocation.Warnings) > 0 {
+		httpLogf(r, "revocation check warnings: %s\n", strings.Join(revocation.Warnings, "; "))
+	}
+	httpWriteResult(w, r, "OK", &CheckResult{Result: "OK", Code: ret, Verdict: verdict, SPC: spc, Carrier: carrier,
+		X5uFinal: finalURL, Treatment: treatment, Chain: identityCertChain(info), Revocation: revocation,
+		Analytics: httpAnalytics(w, r, identityVal, ret)})
 }
 
 func httpHandleV1SignCSV(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("incoming request for building identity ...\n")
+	httpLogf(r, "incoming request for building identity ...\n")
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		fmt.Printf("error reading body: %v\n", err)
-		http.Error(w, "cannot read body", http.StatusBadRequest)
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
 		return
 	}
 
-	token := strings.Split(strings.TrimSpace(string(body)), ",")
-	if len(token) < 5 {
-		fmt.Printf("too few tokens in input body: %d\n", len(token))
-		http.Error(w, "too few tokens", http.StatusBadRequest)
+	token, err := httpRequestSignTokens(r, body)
+	if err != nil || len(token) < 5 {
+		httpLogf(r, "too few tokens in input body: %d\n", len(token))
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "too few tokens")
 		return
 	}
 
 	var hdr string
-	hdr, _, err = secsipid.SJWTGetIdentity(token[0], token[1], token[2], token[3], token[4], cliops.fprvkey)
+	var ret int
+	claims, err := parseClaims(r.Header.Get("X-Claims"))
+	if err != nil {
+		httpLogf(r, "invalid claims header: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid claims header")
+		return
+	}
+	meta, err := origidParseMeta(r.Header.Get("X-Origid-Meta"))
+	if err != nil {
+		httpLogf(r, "%v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid origid metadata header")
+		return
+	}
+	var mky []secsipid.SJWTMky
+	if len(token) > 5 {
+		if mky, ret, err = secsipid.SJWTParseMky(token[5]); err != nil {
+			httpLogf(r, "invalid mky token: (%d) %v\n", ret, err)
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid mky token")
+			return
+		}
+	}
+	prvkeyPath, x5uVal, err := signKey(httpSignKeyName(r), httpSignX5u(r, token[4]))
+	if err != nil {
+		httpLogf(r, "invalid signing key: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+		return
+	}
+	form, err := httpPassportForm(r)
+	if err != nil {
+		httpLogf(r, "%v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+		return
+	}
+	attestVal := signAttestation(httpSignAttrs(r, token[0], token[2]))
+	payload := secsipid.SJWTPayload{
+		ATTest: attestVal,
+		Dest: secsipid.SJWTDest{
+			TN: []string{token[1]},
+		},
+		Mky: mky,
+		Orig: secsipid.SJWTOrig{
+			TN: token[0],
+		},
+		OrigID: token[3],
+		Extra:  claims,
+	}
+	var compact string
+	if form == "full" {
+		hdr, ret, err = secsipid.SJWTGetIdentityPayload(payload, x5uVal, prvkeyPath)
+	} else {
+		hdr, compact, ret, err = secsipid.SJWTGetIdentityPayloadForms(payload, x5uVal, prvkeyPath)
+	}
+
+	if eventsEnabled() {
+		srcAddr, dstAddr := httpRequestAddrs(r)
+		emitEvent(&EventRecord{Event: "sign", Code: ret, OrigTN: token[0], DestTN: token[1],
+			OrigID: identityPayload(hdr).OrigID, CallID: httpRequestCallID(r), ReqID: httpRequestID(r), Message: errorMessage(err)}, srcAddr, dstAddr)
+	}
+
+	if err != nil {
+		httpLogf(r, "failed building identity: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	origidStoreSign(hdr, httpRequestCallID(r), httpRequestID(r), meta)
+	cpsPublish(token[0], token[1], hdr)
+
+	switch form {
+	case "compact":
+		httpWriteIdentity(w, r, compact, &IdentityResult{Identity: compact})
+	case "both":
+		httpWriteIdentity(w, r, hdr+"\n"+compact, &IdentityResult{Identity: hdr, Compact: compact})
+	default:
+		httpWriteIdentity(w, r, hdr, &IdentityResult{Identity: hdr})
+	}
+
+}
+
+func httpHandleV1CheckOOB(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for out-of-band identity check ...\n")
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		fmt.Printf("error reading body: %v", err)
-		http.Error(w, "cannot read body", http.StatusBadRequest)
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
 		return
 	}
 
-	fmt.Fprintf(w, "%s\n", hdr)
+	token, err := httpRequestSignTokens(r, body)
+	if err != nil || len(token) < 2 {
+		httpLogf(r, "too few tokens in input body: %d\n", len(token))
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "too few tokens")
+		return
+	}
 
+	_, ret, err := cpsClient.CheckCall(token[0], token[1], cliops.expire, cliops.fpubkey, cliops.timeout)
+	if err != nil {
+		httpLogf(r, "failed checking out-of-band identity: %v\n", err)
+		httpError(w, http.StatusInternalServerError, httpErrCheckFailed, ret, err.Error())
+		return
+	}
+	httpLogf(r, "valid out-of-band identity - return code: %d\n", ret)
+	httpWriteResult(w, r, "OK", &CheckResult{Result: "OK", Code: ret})
 }
 
 func startHTTPServices() chan error {
@@ -443,13 +1343,31 @@ func startHTTPServices() chan error {
 func main() {
 	var ret int
 
-	flag.Parse()
+	if !cliParseSubcommand(os.Args[1:]) {
+		flag.Parse()
+	}
 
 	if cliops.version {
 		fmt.Printf("%s v%s\n", filepath.Base(os.Args[0]), secsipidxVersion)
+		if len(secsipidxGitCommit) > 0 {
+			fmt.Printf("git commit: %s - build date: %s\n", secsipidxGitCommit, secsipidxBuildDate)
+		}
+		if secsipid.SJWTFIPSEnabled() {
+			fmt.Printf("fips crypto backend: %s\n", secsipid.SJWTFIPSBackend())
+		}
 		os.Exit(1)
 	}
 
+	if cliops.fips {
+		if !secsipid.SJWTFIPSEnabled() {
+			log.Printf("FIPS mode required, but no FIPS 140 validated crypto backend is active")
+			os.Exit(1)
+		}
+		if cliops.verbosity > 0 {
+			log.Printf("FIPS mode with crypto backend: %s", secsipid.SJWTFIPSBackend())
+		}
+	}
+
 	if cliops.ltest {
 		localTest()
 		os.Exit(1)
@@ -458,6 +1376,28 @@ func main() {
 	if len(cliops.cachedir) > 0 {
 		secsipid.SetURLFileCacheOptions(cliops.cachedir, cliops.cacheexpire)
 	}
+	if cliops.cacheinteg {
+		secsipid.SJWTLibOptSetN("CacheIntegrity", 1)
+	}
+	secsipid.SJWTLibOptSetN("CacheMaxEntries", cliops.cachemaxent)
+	secsipid.SJWTLibOptSetN("CacheMaxSize", cliops.cachemaxkb)
+	secsipid.SJWTLibOptSetN("CacheRevalidate", cliops.cachereval)
+	secsipid.SJWTLibOptSetN("CacheStaleIfError", cliops.cachestale)
+	if len(cliops.cachedir) > 0 && cliops.cachejanit > 0 {
+		go func() {
+			for range time.Tick(time.Duration(cliops.cachejanit) * time.Second) {
+				if removed := secsipid.SJWTURLCacheCleanup(); removed > 0 && cliops.verbosity > 0 {
+					log.Printf("removed %d cached certificates", removed)
+				}
+			}
+		}()
+	}
+	if len(cliops.cachekey) > 0 {
+		if secsipid.SJWTLibOptSetS("CacheKeyFile", cliops.cachekey) != secsipid.SJWTRetOK {
+			log.Printf("unable to load the cache key file: %s", cliops.cachekey)
+			os.Exit(1)
+		}
+	}
 
 	if len(cliops.cafile) > 0 {
 		secsipid.SJWTLibOptSetS("CertCAFile", cliops.cafile)
@@ -468,16 +1408,452 @@ func main() {
 	if len(cliops.crlfile) > 0 {
 		secsipid.SJWTLibOptSetS("CertCRLFile", cliops.crlfile)
 	}
+	if cliops.crlrefresh > 0 {
+		secsipid.SJWTLibOptSetN("CRLRefresh", cliops.crlrefresh)
+	}
+	if len(cliops.ocspshared) > 0 {
+		if secsipid.SJWTLibOptSetS("OCSPShared", cliops.ocspshared) != secsipid.SJWTRetOK {
+			log.Printf("invalid address of the OCSP shared cache: %s", cliops.ocspshared)
+			os.Exit(1)
+		}
+	}
+	for _, rp := range []struct{ option, flag, value string }{
+		{"CRLPolicy", "crl-policy", cliops.crlpolicy},
+		{"OCSPPolicy", "ocsp-policy", cliops.ocsppolicy},
+	} {
+		switch rp.value {
+		case "hard-fail":
+			secsipid.SJWTLibOptSetN(rp.option, secsipid.RevPolicyHardFail)
+		case "soft-fail":
+			secsipid.SJWTLibOptSetN(rp.option, secsipid.RevPolicySoftFail)
+		case "skip":
+			secsipid.SJWTLibOptSetN(rp.option, secsipid.RevPolicySkip)
+		default:
+			log.Printf("invalid value for -%s: %s", rp.flag, rp.value)
+			os.Exit(1)
+		}
+	}
+	if cliops.shortlived > 0 {
+		secsipid.SJWTLibOptSetN("CertShortLived", cliops.shortlived)
+	}
+	switch cliops.certpolicy {
+	case "off":
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyOff)
+	case "lenient":
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyLenient)
+	case "strict":
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyStrict)
+	default:
+		log.Printf("invalid certificate policy mode: %s", cliops.certpolicy)
+		os.Exit(1)
+	}
+	secsipid.SJWTLibOptSetS("CertPolicyOIDs", cliops.certpoloids)
+	secsipid.SJWTLibOptSetS("CertPolicyEKU", cliops.certpoleku)
 	if cliops.certverify > 0 {
 		secsipid.SJWTLibOptSetN("CertVerify", cliops.certverify)
 	}
+	if cliops.aiafetch {
+		secsipid.SJWTLibOptSetN("CertAIAFetch", 1)
+	}
+	secsipid.SJWTLibOptSetN("CertAIAMax", cliops.aiamax)
+	if len(cliops.aiahosts) > 0 {
+		secsipid.SJWTLibOptSetS("CertAIAHosts", cliops.aiahosts)
+	}
+	if len(cliops.spc) > 0 {
+		secsipid.SJWTLibOptSetS("SPC", cliops.spc)
+	}
 	if len(cliops.x5u) > 0 {
 		secsipid.SJWTLibOptSetS("x5u", cliops.x5u)
 	}
+	if secsipid.SJWTLibOptSetS("SignerAlgs", cliops.signeralgs) != secsipid.SJWTRetOK {
+		log.Printf("invalid list of signature algorithms: %s", cliops.signeralgs)
+		os.Exit(1)
+	}
+	if len(cliops.x5tcert) > 0 {
+		if ret := secsipid.SJWTLibOptSetS("X5tCertFile", cliops.x5tcert); ret != secsipid.SJWTRetOK {
+			log.Printf("unable to load the certificate for x5t#S256 from: %s", cliops.x5tcert)
+			os.Exit(1)
+		}
+	}
+	if err := loadFinalizeCert(); err != nil {
+		log.Printf("unable to load the certificate for finalize: %v", err)
+		os.Exit(1)
+	}
+
+	if len(cliops.dnofile) > 0 {
+		if ret := secsipid.SJWTLibOptSetS("DNOFile", cliops.dnofile); ret != secsipid.SJWTRetOK {
+			log.Printf("unable to load do-not-originate list from: %s", cliops.dnofile)
+			os.Exit(1)
+		}
+		switch cliops.dnomode {
+		case "reject":
+			secsipid.SJWTLibOptSetN("DNOReject", 1)
+		case "flag":
+		default:
+			log.Printf("invalid do-not-originate mode: %s", cliops.dnomode)
+			os.Exit(1)
+		}
+	}
+	if cliops.idsizepol != "warn" && cliops.idsizepol != "fail" {
+		log.Printf("invalid identity size policy: %s", cliops.idsizepol)
+		os.Exit(1)
+	}
+
+	if len(cliops.pinfile) > 0 {
+		if ret := secsipid.SJWTLibOptSetS("PinFile", cliops.pinfile); ret != secsipid.SJWTRetOK {
+			log.Printf("unable to load the pinned public keys from: %s", cliops.pinfile)
+			os.Exit(1)
+		}
+		switch cliops.pinpolicy {
+		case "":
+			log.Printf("the policy for the pinned public keys must be set with -pin-policy")
+			os.Exit(1)
+		case "fallback":
+			secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyFallback)
+		case "enforce":
+			secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyEnforce)
+		default:
+			log.Printf("invalid pin policy: %s", cliops.pinpolicy)
+			os.Exit(1)
+		}
+	}
+
+	secsipid.SJWTLibOptSetN("FetchIPFamily", cliops.ipfamily)
+	secsipid.SJWTLibOptSetN("FetchIPPrefer", cliops.ipprefer)
+	secsipid.SJWTLibOptSetN("FetchHappyEyeballs", cliops.happyeyes)
+	if cliops.fetchsrv {
+		secsipid.SJWTLibOptSetN("FetchSRV", 1)
+	}
+	if len(cliops.dnsservers) > 0 {
+		secsipid.SJWTLibOptSetS("DNSServers", cliops.dnsservers)
+	}
+	if cliops.dnscache {
+		secsipid.SJWTLibOptSetN("DNSCache", 1)
+	}
+	secsipid.SJWTLibOptSetS("FetchUserAgent", cliops.useragent)
+	secsipid.SJWTLibOptSetN("FetchRedirects", cliops.fetchredir)
+	if cliops.redirstrict {
+		secsipid.SJWTLibOptSetN("FetchRedirectStrict", 1)
+	}
+	if len(cliops.fetchhdrs) > 0 {
+		hdrsData, err := os.ReadFile(cliops.fetchhdrs)
+		if err != nil {
+			log.Printf("unable to read the fetch headers file: %v", err)
+			os.Exit(1)
+		}
+		if secsipid.SJWTLibOptSetS("FetchHeaders", string(hdrsData)) != secsipid.SJWTRetOK {
+			log.Printf("invalid headers in the fetch headers file: %s", cliops.fetchhdrs)
+			os.Exit(1)
+		}
+	}
+	if len(cliops.repoauth) > 0 {
+		if ret := secsipid.SJWTLibOptSetS("RepoAuthFile", cliops.repoauth); ret != secsipid.SJWTRetOK {
+			log.Printf("unable to load the repository credentials from: %s", cliops.repoauth)
+			os.Exit(1)
+		}
+	}
+
+	secsipid.SJWTLibOptSetN("IdentityMaxLen", cliops.idmaxlen)
+	secsipid.SJWTLibOptSetN("SegmentMaxLen", cliops.segmaxlen)
+	secsipid.SJWTLibOptSetN("DestTNMax", cliops.desttnmax)
+	secsipid.SJWTLibOptSetN("IATSkew", cliops.iatskew)
+	secsipid.SJWTLibOptSetN("ExpireShaken", cliops.expshaken)
+	secsipid.SJWTLibOptSetN("ExpireDiv", cliops.expdiv)
+	secsipid.SJWTLibOptSetN("ExpireRcd", cliops.exprcd)
+	secsipid.SJWTLibOptSetN("ResultCacheTTL", cliops.rescachettl)
+	secsipid.SJWTLibOptSetN("ResultCacheMax", cliops.rescachemax)
+	chaosInit()
+
+	if cliops.canonjson {
+		secsipid.SJWTLibOptSetN("CanonicalJSON", 1)
+	}
+	if cliops.rcdiverify {
+		secsipid.SJWTLibOptSetN("RcdiVerify", 1)
+	}
+
+	if len(cliops.tnlookup) > 0 {
+		var err error
+		tnLookup, err = NewTNLookup(cliops.tnlookup, cliops.tnlookupexp, cliops.timeout, cliops.tnlookupatt, cliops.tnlookupfb)
+		if err != nil {
+			log.Printf("unable to initialize tn lookup (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if len(cliops.cvturl) > 0 {
+		var err error
+		analytics, err = NewAnalytics(cliops.cvturl, cliops.cvtexpire, cliops.cvttimeout)
+		if err != nil {
+			log.Printf("unable to initialize call analytics (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(cliops.attestmtx) > 0 {
+		var err error
+		attestMatrix, err = LoadAttestMatrix(cliops.attestmtx)
+		if err != nil {
+			log.Printf("unable to load attestation matrix (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := noIdentityInit(cliops.noidentity, cliops.noidexcept); err != nil {
+		log.Printf("unable to set no identity policy (error: %v)", err)
+		os.Exit(1)
+	}
+
+	if len(cliops.treatment) > 0 {
+		var err error
+		treatmentPolicy, err = LoadTreatmentPolicy(cliops.treatment)
+		if err != nil {
+			log.Printf("unable to load treatment policy (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if len(cliops.pptpolicy) > 0 {
+		var err error
+		pptPolicy, err = LoadPptPolicy(cliops.pptpolicy)
+		if err != nil {
+			log.Printf("unable to load ppt policy (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(cliops.carrierfile) > 0 {
+		var err error
+		carrierNames, err = LoadCarrierNames(cliops.carrierfile)
+		if err != nil {
+			log.Printf("unable to load carrier names (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(cliops.cpsurl) > 0 {
+		var err error
+		// the requests are signed with the service key, if set, otherwise
+		// with the STI key (kept for the existing deployments)
+		cpsKey, cpsX5u := cliops.fprvkey, cliops.x5u
+		if len(cliops.servicekey) > 0 {
+			if err = serviceKeyCheck(cliops.servicekey); err != nil {
+				log.Printf("invalid service key (error: %v)", err)
+				os.Exit(1)
+			}
+			cpsKey, cpsX5u = cliops.servicekey, cliops.servicex5u
+		}
+		if len(cpsX5u) == 0 {
+			cpsX5u = "https://127.0.0.1/cert.pem"
+		}
+		prvkey, _ := secsipid.SJWTReadPrvKey(cpsKey)
+		cpsX5u = secsipid.SJWTSignX5u(cpsX5u, prvkey, "", "")
+		cpsClient, err = NewCPSClient(cliops.cpsurl, cpsKey, cpsX5u, cliops.timeout)
+		if err != nil {
+			log.Printf("unable to initialize cps client (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+
+	if cliops.fprvkey == "-" || strings.HasPrefix(cliops.fprvkey, "fd:") {
+		// read the key only once at startup, the stream cannot be read again
+		if _, err := secsipid.SJWTReadPrvKey(cliops.fprvkey); err != nil {
+			log.Printf("unable to read private key from %s (error: %v)", cliops.fprvkey, err)
+			os.Exit(1)
+		}
+	}
+
+	// the keys command writes the key files instead of loading them
+	if len(cliops.keysop) == 0 {
+		if err := keysInit(); err != nil {
+			log.Printf("unable to load the signing keys (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if len(cliops.keyringfile) > 0 {
+		var err error
+		if keyring, err = LoadKeyring(cliops.keyringfile); err != nil {
+			log.Printf("unable to load keyring (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if len(cliops.fixtures) > 0 {
+		if err := fixturesInit(cliops.fixtures); err != nil {
+			log.Printf("unable to set up the fixtures (error: %v)", err)
+			os.Exit(1)
+		}
+		fmt.Printf("serving fixtures from directory: %s\n", fixtures.Dir)
+	}
+	if len(cliops.tenantsfile) > 0 {
+		var err error
+		if tenants, err = LoadTenants(cliops.tenantsfile); err != nil {
+			log.Printf("unable to load tenants (error: %v)", err)
+			os.Exit(1)
+		}
+		if err = quotaInit(); err != nil {
+			log.Printf("unable to load the quota counters (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if err := signRateInit(); err != nil {
+		log.Printf("unable to set the signing rate (error: %v)", err)
+		os.Exit(1)
+	}
+
+	for _, prvkeyPath := range []string{cliops.servicekey, cliops.verdictkey} {
+		if err := serviceKeyCheck(prvkeyPath); err != nil {
+			log.Printf("invalid service key (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if verdictKey := serviceKeyPath(cliops.verdictkey); len(verdictKey) > 0 {
+		cliops.verdictx5u = serviceX5u(cliops.verdictx5u)
+		if err := verdictInit(verdictKey); err != nil {
+			log.Printf("unable to load verdict key from %s (error: %v)", verdictKey, err)
+			os.Exit(1)
+		}
+	}
+
+	if len(cliops.otelurl) > 0 {
+		var err error
+		otelExporter, err = NewOTelExporter(cliops.otelurl, cliops.otelservice)
+		if err != nil {
+			log.Printf("unable to initialize otel exporter (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if cliops.latency {
+		latencyInit()
+	}
+	latencyInstallHook()
+
+	if len(cliops.hepsrv) > 0 {
+		var err error
+		queueSize := 0
+		if len(cliops.httpsrv) > 0 {
+			queueSize = hepQueueSize
+		}
+		hepClient, err = NewHEPClient(cliops.hepsrv, cliops.hepproto, cliops.hepid, cliops.heppass, queueSize)
+		if err != nil {
+			log.Printf("unable to initialize hep client (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(cliops.dbdsn) > 0 {
+		var err error
+		dbStore, err = NewDBStore(cliops.dbdriver, cliops.dbdsn)
+		if err != nil {
+			log.Printf("unable to initialize database store (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+	if cliops.origidstor {
+		if dbStore == nil {
+			log.Printf("the origid store requires the database (-db-dsn)")
+			os.Exit(1)
+		}
+		if err := dbStore.InitOrigIDs(); err != nil {
+			log.Printf("unable to initialize origid store (error: %v)", err)
+			os.Exit(1)
+		}
+	}
+
+	if cliops.dbquery {
+		os.Exit(secsipidxCLIDBQuery())
+	}
+	if cliops.origidlook {
+		os.Exit(secsipidxCLIOrigID())
+	}
 
 	if (len(cliops.httpsrv) > 0) || (len(cliops.httpssrv) > 0 && len(cliops.httpspubkey) > 0 && len(cliops.httpsprvkey) > 0) {
-		http.HandleFunc("/v1/check", httpHandleV1Check)
-		http.HandleFunc("/v1/sign-csv", httpHandleV1SignCSV)
+		if err := limitsInit(); err != nil {
+			log.Printf("unable to set the limits (error: %v)", err)
+			os.Exit(1)
+		}
+		if carrierNames != nil && cliops.carrierrefr > 0 {
+			carrierNames.StartRefresh(cliops.carrierrefr)
+		}
+		if cliops.chaos {
+			http.HandleFunc("/v1/chaos", httpV1Handler(httpHandleV1Chaos))
+		}
+		if cliops.stats {
+			statsStore = NewStatsStore(cliops.statsmax)
+			http.HandleFunc("/v1/stats", httpV1Handler(httpHandleV1Stats))
+			http.HandleFunc("/v1/stats/ca", httpV1Handler(httpHandleV1StatsCA))
+		}
+		if cliops.selfcheck > 0 {
+			selfCheckStart(cliops.selfcheck)
+			http.HandleFunc("/v1/self-check", httpV1Handler(httpHandleV1SelfCheck))
+		}
+		if urls := parseProbeURLs(cliops.probeurls); len(urls) > 0 {
+			if cliops.probeintvl <= 0 {
+				log.Printf("invalid probe interval: %d", cliops.probeintvl)
+				os.Exit(1)
+			}
+			probeStart(urls, cliops.probeintvl)
+			http.HandleFunc("/v1/probes", httpV1Handler(httpHandleV1Probes))
+		}
+		if len(cliops.degradwarn) > 0 {
+			thresholds, err := parseDegradedThresholds(cliops.degradwarn)
+			if err != nil {
+				log.Printf("%v", err)
+				os.Exit(1)
+			}
+			degradedMonitor = NewDegradedMonitor(thresholds, cliops.degradwin)
+			degradedMonitor.Start()
+		}
+		if cliops.stats || cliops.selfcheck > 0 || cliops.latency || (cliops.certverify&secsipid.CertVerifyOptOCSP) != 0 ||
+			quotaStore != nil || degradedMonitor != nil || len(probeURLs) > 0 || verifyLimiter != nil || signRateLimiter != nil {
+			http.HandleFunc("/metrics", httpHandleMetrics)
+		}
+		tenantRoutes["check"] = httpStatsHandler("check", httpLimitHandler(httpTenantHandler(false, httpHandleV1Check)))
+		tenantRoutes["sign-csv"] = httpStatsHandler("sign", httpTenantHandler(true, httpQuotaHandler(httpSignRateHandler(true, httpHandleV1SignCSV))))
+		tenantRoutes["sign"] = tenantRoutes["sign-csv"]
+		tenantRoutes["div"] = httpStatsHandler("sign", httpTenantHandler(true, httpQuotaHandler(httpSignRateHandler(true, httpHandleV1Div))))
+		tenantRoutes["redirect"] = httpStatsHandler("sign", httpTenantHandler(true, httpQuotaHandler(httpSignRateHandler(true, httpHandleV1Redirect))))
+		tenantRoutes["sign-connected-csv"] = httpStatsHandler("sign", httpTenantHandler(true, httpQuotaHandler(httpSignRateHandler(true, httpHandleV1SignConnectedCSV))))
+		tenantRoutes["check-connected"] = httpStatsHandler("check", httpLimitHandler(httpTenantHandler(false, httpHandleV1CheckConnected)))
+		tenantRoutes["resign"] = httpStatsHandler("sign", httpTenantHandler(true, httpQuotaHandler(httpSignRateHandler(false, httpHandleV1Resign))))
+		http.HandleFunc("/v1/check", httpV1Handler(tenantRoutes["check"]))
+		http.HandleFunc("/v1/sign-csv", httpV1Handler(tenantRoutes["sign-csv"]))
+		http.HandleFunc("/v1/div", httpV1Handler(tenantRoutes["div"]))
+		http.HandleFunc("/v1/redirect", httpV1Handler(tenantRoutes["redirect"]))
+		if tenants != nil {
+			http.HandleFunc("/v1/tenants/", httpV1Handler(httpHandleV1Tenants))
+		}
+		if len(keyCerts) > 0 {
+			http.HandleFunc("/v1/certs/", httpV1Handler(httpHandleV1Certs))
+		}
+		if fixtures != nil {
+			http.HandleFunc("/v1/fixtures", httpV1Handler(httpHandleV1Fixtures))
+			http.HandleFunc("/v1/fixtures/", httpV1Handler(httpHandleV1Fixtures))
+		}
+		http.HandleFunc("/v1/resign", httpV1Handler(tenantRoutes["resign"]))
+		http.HandleFunc("/v1/prepare", httpV1Handler(httpStatsHandler("sign", httpTenantHandler(true, httpQuotaHandler(httpSignRateHandler(true, httpHandleV1Prepare))))))
+		if len(finalizeCert) > 0 {
+			http.HandleFunc("/v1/finalize", httpV1Handler(httpStatsHandler("sign", httpTenantHandler(true, httpHandleV1Finalize))))
+		}
+		http.HandleFunc("/v1/check-chain", httpV1Handler(httpStatsHandler("check", httpLimitHandler(httpTenantHandler(false, httpHandleV1CheckChain)))))
+		http.HandleFunc("/v1/check-identities", httpV1Handler(httpStatsHandler("check", httpLimitHandler(httpTenantHandler(false, httpHandleV1CheckIdentities)))))
+		http.HandleFunc("/v1/sign-connected-csv", httpV1Handler(tenantRoutes["sign-connected-csv"]))
+		http.HandleFunc("/v1/check-connected", httpV1Handler(tenantRoutes["check-connected"]))
+		http.HandleFunc("/v1/check-pubkey", httpV1Handler(httpStatsHandler("check", httpLimitHandler(httpTenantHandler(false, httpHandleV1CheckPubKey)))))
+		http.HandleFunc("/v1/introspect", httpV1Handler(httpStatsHandler("check", httpLimitHandler(httpTenantHandler(false, httpHandleV1Introspect)))))
+		http.HandleFunc("/v1/rcdi", httpV1Handler(httpHandleV1Rcdi))
+		if origidStoreEnabled() {
+			http.HandleFunc("/v1/origid/", httpV1Handler(httpAdminHandler(httpHandleV1OrigID)))
+		}
+		jobStore = NewJobStore(cliops.jobsworkers, cliops.jobsret, cliops.jobsmax)
+		http.HandleFunc("/v1/jobs", httpV1Handler(httpTenantHandler(false, httpHandleV1Jobs)))
+		http.HandleFunc("/v1/jobs/", httpV1Handler(httpTenantHandler(false, httpHandleV1Jobs)))
+		http.HandleFunc("/v1/openapi.json", httpV1Handler(httpHandleV1OpenAPI))
+		http.HandleFunc("/v1/version", httpV1Handler(httpHandleV1Version))
+		http.HandleFunc("/v1/trust-store", httpV1Handler(httpHandleV1TrustStore))
+		if cpsClient != nil {
+			http.HandleFunc("/v1/check-oob", httpV1Handler(httpStatsHandler("check", httpLimitHandler(httpHandleV1CheckOOB))))
+		}
+		if cliops.cpssrv {
+			cpsStore = NewCPSStore(cliops.cpssrvret, cliops.cpssrvkey, cliops.cpssrvmax)
+			http.HandleFunc("/v1/cps/passports/", httpV1Handler(httpHandleV1CPSPassports))
+		}
 		if len(cliops.httpdir) > 0 {
 			fmt.Printf("serving files over http from directory: %s\n", cliops.httpdir)
 			http.Handle("/v1/pub/", http.StripPrefix("/v1/pub/", http.FileServer(http.Dir(cliops.httpdir))))
@@ -485,15 +1861,35 @@ func main() {
 		fmt.Printf("starting http services ...\n")
 
 		errchan := startHTTPServices()
-		select {
-		case err := <-errchan:
-			log.Printf("unable to start http services due to (error: %v)", err)
-		}
-		os.Exit(1)
+		ret = serviceWait(errchan)
+		quotaSave()
+		os.Exit(ret)
 	}
 
 	ret = 0
-	if cliops.check {
+	if len(cliops.report) > 0 || len(cliops.fcdr) > 0 {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with summary report\n")
+		}
+		ret = secsipidxCLIReport()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.fpcap) > 0 {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with capture file check\n")
+		}
+		ret = secsipidxCLIPcap()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.batch) > 0 && (cliops.check || cliops.signfull) {
+		op := "check"
+		if cliops.signfull {
+			op = "sign"
+		}
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with batch %s command\n", op)
+		}
+		ret = secsipidxCLIBatch(op)
+		os.Exit(cliExitCode(ret))
+	} else if cliops.check {
 		if cliops.verbosity > 0 {
 			fmt.Printf("Running with check command\n")
 		}
@@ -503,22 +1899,145 @@ func main() {
 		} else {
 			fmt.Printf("not-ok\n")
 		}
-		os.Exit(ret)
+		os.Exit(cliExitCode(ret))
 	} else if cliops.signfull {
 		if cliops.verbosity > 0 {
 			fmt.Printf("Running with sign-full command\n")
 		}
 		ret = secsipidxCLISignFull()
-		os.Exit(ret)
+		os.Exit(cliExitCode(ret))
+	} else if cliops.signconn {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with sign-connected command\n")
+		}
+		ret = secsipidxCLISignConnected()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.checkconn {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with check-connected command\n")
+		}
+		ret = secsipidxCLICheckConnected()
+		if ret == 0 {
+			fmt.Printf("ok\n")
+		} else {
+			fmt.Printf("not-ok\n")
+		}
+		os.Exit(cliExitCode(ret))
+	} else if cliops.rcdi {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with rcdi command\n")
+		}
+		ret = secsipidxCLIRcdi()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.checkchain {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with check-chain command\n")
+		}
+		ret = secsipidxCLICheckChain()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.checkids {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with check-identities command\n")
+		}
+		ret = secsipidxCLICheckIdentities()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.prepare {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with prepare command\n")
+		}
+		ret = secsipidxCLIPrepare()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.finalize {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with finalize command\n")
+		}
+		ret = secsipidxCLIFinalize()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.resign {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with resign command\n")
+		}
+		ret = secsipidxCLIResign()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.redirect {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with redirect command\n")
+		}
+		ret = secsipidxCLIRedirect()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.div {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with div command\n")
+		}
+		ret = secsipidxCLIDiv()
+		os.Exit(cliExitCode(ret))
 	} else if cliops.sign {
 		if cliops.verbosity > 0 {
 			fmt.Printf("Running with sign command\n")
 		}
 		ret = secsipidxCLISign()
-		os.Exit(ret)
+		os.Exit(cliExitCode(ret))
+	} else if cliops.certinfo {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with cert command\n")
+		}
+		ret = secsipidxCLICert()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.watchdir) > 0 {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with watch command\n")
+		}
+		ret = secsipidxCLIWatch()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.replay) > 0 {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with replay command\n")
+		}
+		ret = secsipidxCLIReplay()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.diff {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with diff command\n")
+		}
+		ret = secsipidxCLIDiff()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.cacheop) > 0 {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with cache command\n")
+		}
+		ret = secsipidxCLICache()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.fuzz {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with fuzz command\n")
+		}
+		ret = secsipidxCLIFuzz()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.codes) > 0 {
+		ret = secsipidxCLICodes()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.completion) > 0 {
+		ret = secsipidxCLICompletion()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.serviceop) > 0 {
+		ret = secsipidxCLIService()
+		os.Exit(cliExitCode(ret))
+	} else if len(cliops.keysop) > 0 {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with keys command\n")
+		}
+		ret = secsipidxCLIKeys()
+		os.Exit(cliExitCode(ret))
+	} else if cliops.keygen {
+		if cliops.verbosity > 0 {
+			fmt.Printf("Running with keygen command\n")
+		}
+		ret = secsipidxCLIKeygen()
+		os.Exit(cliExitCode(ret))
 	} else {
 		fmt.Printf("%s v%s\n", filepath.Base(os.Args[0]), secsipidxVersion)
+		fmt.Printf("subcommands: %s\n", cliSubcommandNames(", "))
 		fmt.Printf("run '%s --help' to see the options\n", filepath.Base(os.Args[0]))
 	}
-	os.Exit(ret)
+	os.Exit(cliExitCode(ret))
 }
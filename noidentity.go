@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// results for the calls without Identity header
+const (
+	noIdentityError = "error"
+	noIdentityNoTN  = "no-tn-validation"
+)
+
+// result value of the calls without Identity header classified as not
+// validated (ATIS-1000074 verstat No-TN-Validation)
+const checkResultNoTN = "NO-TN-VALIDATION"
+
+// noIdentityPolicy - the result for the calls without Identity header, with
+// the sources (IP addresses, networks or trunk names) for which the other
+// result is used
+type noIdentityPolicy struct {
+	mode    string
+	nets    []*net.IPNet
+	sources map[string]bool
+}
+
+var noIdentity = &noIdentityPolicy{mode: noIdentityError}
+
+// noIdentityInit - set the result for the calls without Identity header and
+// the comma separated list of the exception sources
+func noIdentityInit(mode string, except string) error {
+	if mode != noIdentityError && mode != noIdentityNoTN {
+		return fmt.Errorf("invalid no identity mode: %s", mode)
+	}
+	p := &noIdentityPolicy{mode: mode, sources: map[string]bool{}}
+	for _, source := range strings.Split(except, ",") {
+		source = strings.TrimSpace(source)
+		if len(source) == 0 {
+			continue
+		}
+		if _, ipnet, err := net.ParseCIDR(source); err == nil {
+			p.nets = append(p.nets, ipnet)
+		} else if ip := net.ParseIP(source); ip != nil {
+			p.nets = append(p.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		} else {
+			p.sources[strings.ToLower(source)] = true
+		}
+	}
+	noIdentity = p
+	return nil
+}
+
+// excepted - true if the source (address with or without port, or trunk
+// name) is in the list of exceptions
+func (p *noIdentityPolicy) excepted(source string) bool {
+	if len(source) == 0 {
+		return false
+	}
+	if p.sources[strings.ToLower(source)] {
+		return true
+	}
+	host := source
+	if h, _, err := net.SplitHostPort(source); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, ipnet := range p.nets {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// noIdentityResult - the result and the return code for a call without
+// Identity header, the exceptions are matched against any of the sources
+func noIdentityResult(sources ...string) (string, int) {
+	mode := noIdentity.mode
+	excepted := false
+	for _, source := range sources {
+		excepted = excepted || noIdentity.excepted(source)
+	}
+	if excepted {
+		if mode == noIdentityError {
+			mode = noIdentityNoTN
+		} else {
+			mode = noIdentityError
+		}
+	}
+	if mode == noIdentityNoTN {
+		return checkResultNoTN, secsipid.SJWTRetErrSIPHdrEmpty
+	}
+	return "FAILED", secsipid.SJWTRetErrSIPHdrEmpty
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// ocspWriteMetrics - the statistics of the OCSP checks and the staleness of
+// the cached OCSP responses in the Prometheus text format, if OCSP checks are
+// enabled
+func ocspWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	if (cliops.certverify & secsipid.CertVerifyOptOCSP) == 0 {
+		return
+	}
+	stats := secsipid.SJWTOCSPCacheStats()
+	counter := func(name string, help string) string {
+		family := name
+		if openMetrics {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, help, family)
+		return name
+	}
+	name := counter("secsipidx_ocsp_lookups_total", "OCSP responses used, by source (memory, shared cache or responder).")
+	fmt.Fprintf(w, "%s{source=\"memory\"} %d\n", name, stats.LocalHits)
+	fmt.Fprintf(w, "%s{source=\"shared\"} %d\n", name, stats.SharedHits)
+	fmt.Fprintf(w, "%s{source=\"responder\"} %d\n", name, stats.Fetches)
+	name = counter("secsipidx_ocsp_failures_total", "OCSP requests failed or with invalid responses.")
+	fmt.Fprintf(w, "%s %d\n", name, stats.Failures)
+	name = counter("secsipidx_ocsp_shared_errors_total", "Failed operations with the shared cache of OCSP responses.")
+	fmt.Fprintf(w, "%s %d\n", name, stats.SharedErrors)
+	fmt.Fprintf(w, "# HELP secsipidx_ocsp_cached_responses OCSP responses kept in memory.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_ocsp_cached_responses gauge\nsecsipidx_ocsp_cached_responses %d\n", stats.Entries)
+	fmt.Fprintf(w, "# HELP secsipidx_ocsp_response_max_age_seconds Time since the thisUpdate of the oldest cached OCSP response.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_ocsp_response_max_age_seconds gauge\nsecsipidx_ocsp_response_max_age_seconds %d\n", stats.MaxAge)
+	fmt.Fprintf(w, "# HELP secsipidx_ocsp_response_min_remaining_seconds Time until the closest nextUpdate of the cached OCSP responses.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_ocsp_response_min_remaining_seconds gauge\nsecsipidx_ocsp_response_min_remaining_seconds %d\n", stats.MinRemaining)
+}
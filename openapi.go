@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// openapiSchema - the JSON schema of the value, built from the type and the
+// json tags of the struct fields, so it follows the types used by the API
+func openapiSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return openapiSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": openapiSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openapiSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+			if len(tag[0]) == 0 || tag[0] == "-" {
+				continue
+			}
+			props[tag[0]] = openapiSchema(t.Field(i).Type)
+			if len(tag) == 1 && t.Field(i).Type.Kind() != reflect.Ptr {
+				required = append(required, tag[0])
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": props}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
+
+func openapiRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// openapiBody - request body or response content with JSON and optionally
+// plain text alternative
+func openapiBody(schema map[string]interface{}, text bool) map[string]interface{} {
+	content := map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+	if text {
+		content["text/plain"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+	return map[string]interface{}{"content": content}
+}
+
+func openapiResponse(description string, body map[string]interface{}) map[string]interface{} {
+	resp := map[string]interface{}{"description": description}
+	if body != nil {
+		resp["content"] = body["content"]
+	}
+	return resp
+}
+
+func openapiHeader(name string, description string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "in": "header", "required": false,
+		"description": description, "schema": map[string]interface{}{"type": "string"}}
+}
+
+func openapiPathParam(name string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "in": "path", "required": true,
+		"schema": map[string]interface{}{"type": "string"}}
+}
+
+// openapiOperation - operation with the common error responses
+func openapiOperation(summary string, params []interface{}, reqBody map[string]interface{},
+	okStatus string, okResp map[string]interface{}) map[string]interface{} {
+	errResp := openapiResponse("error response", openapiBody(openapiRef("ErrorResponse"), false))
+	reqID := openapiHeader("X-Request-ID", "request id for correlation, generated if not provided, returned in the response")
+	op := map[string]interface{}{
+		"summary":    summary,
+		"parameters": append([]interface{}{reqID}, params...),
+		"responses": map[string]interface{}{
+			okStatus:  okResp,
+			"default": errResp,
+		},
+	}
+	if reqBody != nil {
+		reqBody["required"] = true
+		op["requestBody"] = reqBody
+	}
+	return op
+}
+
+// openapiDocument - the OpenAPI 3 document describing the HTTP API
+func openapiDocument() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	for name, v := range map[string]interface{}{
+		"CheckResult":        CheckResult{},
+		"IdentityResult":     IdentityResult{},
+		"IdentityRequest":    IdentityRequest{},
+		"PubKeyCheckRequest": PubKeyCheckRequest{},
+		"IntrospectResult":   IntrospectResult{},
+		"FixturesInfo":       FixturesInfo{},
+		"SignRequest":        SignRequest{},
+		"DivRequest":         DivRequest{},
+		"DivResponse":        DivResponse{},
+		"RedirectRequest":    RedirectRequest{},
+		"DivChainRequest":    DivChainRequest{},
+		"DivChainResult":     secsipid.SJWTDivChainResult{},
+		"IdentitiesRequest":  IdentitiesRequest{},
+		"Prepared":           secsipid.SJWTPrepared{},
+		"FinalizeRequest":    FinalizeRequest{},
+		"PptResult":          PptResult{},
+		"RcdiRequest":        RcdiRequest{},
+		"RcdiResponse":       RcdiResponse{},
+		"JobRequest":         JobRequest{},
+		"JobStatus":          JobStatus{},
+		"JobItemResult":      JobItemResult{},
+		"CPSPassports":       CPSPassports{},
+		"ErrorResponse":      ErrorResponse{},
+		"VersionInfo":        VersionInfo{},
+		"StatsResult":        StatsResult{},
+		"CAStatsResult":      CAStatsResult{},
+		"ResignRequest":      ResignRequest{},
+		"SelfCheckResult":    SelfCheckResult{},
+		"ProbeResult":        ProbeResult{},
+		"OrigIDRecord":       OrigIDRecord{},
+		"TrustStore":         secsipid.SJWTTrustStore{},
+	} {
+		schemas[name] = openapiSchema(reflect.TypeOf(v))
+	}
+	errSchema := schemas["ErrorResponse"].(map[string]interface{})["properties"].(map[string]interface{})
+	errSchema["error"] = map[string]interface{}{"type": "string", "enum": []string{httpErrBadRequest,
+		httpErrNotFound, httpErrMethod, httpErrUnauthorized, httpErrQuota, httpErrUnavailable, httpErrOverloaded, httpErrCheckFailed, httpErrSignFailed}}
+	errSchema["code"] = map[string]interface{}{"type": "integer",
+		"description": "return code of the library, -1 for request errors"}
+	errSchema["check"] = map[string]interface{}{"type": "string", "enum": []string{"certificate",
+		"header", "payload", "freshness", "signature", "identity", "fetch", "policy"}}
+
+	checkBody := openapiBody(openapiRef("IdentityRequest"), true)
+	checkResp := openapiResponse("valid identity", openapiBody(openapiRef("CheckResult"), true))
+	signBody := openapiBody(openapiRef("SignRequest"), true)
+	signResp := openapiResponse("identity header value", openapiBody(openapiRef("IdentityResult"), true))
+	callID := openapiHeader("X-Call-ID", "call id for the events, returned in the response")
+	keyName := openapiHeader("X-Key-Name", "name of the keyring key for signing")
+
+	paths := map[string]interface{}{
+		"/v1/check": map[string]interface{}{"post": openapiOperation("check the identity",
+			[]interface{}{callID, openapiHeader("X-Mky", "expected media key fingerprints"),
+				openapiHeader("X-Verify-Timeout", "verification budget (e.g., '500ms'), bounded by the server maximum"),
+				openapiHeader("X-Passport-Claims", "payload claims as JSON object for the identity in compact form")}, checkBody, "200", checkResp)},
+		"/v1/sign-csv": map[string]interface{}{"post": openapiOperation("generate the identity, the text body is 'OrigTN,DestTN,ATTEST,OrigID,X5U[,MKY]'",
+			[]interface{}{callID, openapiHeader("X-Claims", "custom claims as JSON object"),
+				openapiHeader("X-API-Key", "api key for attestation matrix"),
+				openapiHeader("X-Source-Trunk", "source trunk for attestation matrix"), keyName,
+				openapiHeader("X-Passport-Form", "form of the identity: full (default), compact or both")}, signBody, "200", signResp)},
+		"/v1/div": map[string]interface{}{"post": openapiOperation("generate the diversion identity", []interface{}{keyName},
+			openapiBody(openapiRef("DivRequest"), false), "200", openapiResponse("identity header values", openapiBody(openapiRef("DivResponse"), false)))},
+		"/v1/redirect": map[string]interface{}{"post": openapiOperation("generate the identities for the INVITE recursed on a 3xx redirect", []interface{}{keyName},
+			openapiBody(openapiRef("RedirectRequest"), false), "200", openapiResponse("identity header values", openapiBody(openapiRef("DivResponse"), false)))},
+		"/v1/resign": map[string]interface{}{"post": openapiOperation("re-issue the identity signed by this service with a fresh iat and optionally a new origid",
+			[]interface{}{openapiHeader("X-Orig-ID", "new origid, for text body")}, openapiBody(openapiRef("ResignRequest"), true), "200", signResp)},
+		"/v1/prepare": map[string]interface{}{"post": openapiOperation("build the canonical header and payload JSON and the signing input of the identity without signing it, the body is like for /v1/sign-csv",
+			[]interface{}{openapiHeader("X-Claims", "custom claims as JSON object"), keyName}, signBody, "200",
+			openapiResponse("PASSporT to be signed", openapiBody(openapiRef("Prepared"), false)))},
+		"/v1/finalize": map[string]interface{}{"post": openapiOperation("build the identity from the signing input given by /v1/prepare and its ES256 signature, verified with the certificate of -finalize-cert (enabled with it or -x5t-cert), the text body is 'SigningInput,Signature'",
+			nil, openapiBody(openapiRef("FinalizeRequest"), true), "200", signResp)},
+		"/v1/tenants/{id}/{op}": map[string]interface{}{"post": openapiOperation("run the operation (sign, sign-csv, check, div, redirect, sign-connected-csv, check-connected) for the tenant (enabled with -tenants), status 429 if the signing quota or rate is exceeded",
+			[]interface{}{openapiPathParam("id"), openapiPathParam("op"), openapiHeader("X-API-Key", "api key of the tenant")}, nil, "200",
+			openapiResponse("result of the operation", nil))},
+		"/v1/check-chain": map[string]interface{}{"post": openapiOperation("check the diversion chain", nil,
+			openapiBody(openapiRef("DivChainRequest"), false), "200", openapiResponse("chain check result", openapiBody(openapiRef("DivChainResult"), false)))},
+		"/v1/check-identities": map[string]interface{}{"post": openapiOperation("check all identities of a call against the ppt policy of the source trunk",
+			[]interface{}{callID, openapiHeader("X-Source-Trunk", "source trunk of the call")},
+			openapiBody(openapiRef("IdentitiesRequest"), false), "200", openapiResponse("ppt policy result", openapiBody(openapiRef("PptResult"), false)))},
+		"/v1/sign-connected-csv": map[string]interface{}{"post": openapiOperation("generate the connected identity, the text body is 'CallerTN,ConnectedTN,ATTEST,OrigID,X5U'",
+			[]interface{}{callID, keyName}, signBody, "200", signResp)},
+		"/v1/check-connected": map[string]interface{}{"post": openapiOperation("check the connected identity",
+			[]interface{}{callID, openapiHeader("X-Caller-TN", "caller number"), openapiHeader("X-Connected-TN", "expected connected number")},
+			checkBody, "200", checkResp)},
+		"/v1/check-pubkey": map[string]interface{}{"post": openapiOperation("check the identity against the public key or the certificate of the request, without fetching the x5u",
+			[]interface{}{callID}, openapiBody(openapiRef("PubKeyCheckRequest"), false), "200", checkResp)},
+		"/v1/introspect": map[string]interface{}{"post": openapiOperation("introspect the identity (like RFC 7662), the form body has the 'token' parameter",
+			[]interface{}{callID, openapiHeader("X-Verify-Timeout", "verification budget (e.g., '500ms'), bounded by the server maximum"),
+				openapiHeader("X-Passport-Claims", "payload claims as JSON object for the identity in compact form")},
+			checkBody, "200", openapiResponse("introspection result, active if the identity is valid", openapiBody(openapiRef("IntrospectResult"), false)))},
+		"/v1/fixtures": map[string]interface{}{"get": openapiOperation("get the list of the test fixtures (enabled with -fixtures)",
+			nil, nil, "200", openapiResponse("fixtures", openapiBody(openapiRef("FixturesInfo"), false)))},
+		"/v1/fixtures/{name}.pem": map[string]interface{}{"get": openapiOperation("get the certificate of the test fixture, ca.pem for the test CA (enabled with -fixtures)",
+			[]interface{}{openapiPathParam("name")}, nil, "200", openapiResponse("certificate", map[string]interface{}{"content": map[string]interface{}{
+				"application/x-pem-file": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}}))},
+		"/v1/rcdi": map[string]interface{}{"post": openapiOperation("compute or verify the rcdi digest of a resource", nil,
+			openapiBody(openapiRef("RcdiRequest"), false), "200", openapiResponse("rcdi digest", openapiBody(openapiRef("RcdiResponse"), false)))},
+		"/v1/jobs": map[string]interface{}{"post": openapiOperation("submit a batch job", nil,
+			openapiBody(openapiRef("JobRequest"), false), "202", openapiResponse("job accepted", openapiBody(openapiRef("JobStatus"), false)))},
+		"/v1/jobs/{id}": map[string]interface{}{"get": openapiOperation("get the status and the results of the batch job",
+			[]interface{}{openapiPathParam("id")}, nil, "200", openapiResponse("job status", openapiBody(openapiRef("JobStatus"), false)))},
+		"/v1/jobs/{id}/results": map[string]interface{}{"get": openapiOperation("stream the results of the batch job as JSON lines",
+			[]interface{}{openapiPathParam("id")}, nil, "200", openapiResponse("job results", map[string]interface{}{"content": map[string]interface{}{
+				"application/x-ndjson": map[string]interface{}{"schema": openapiRef("JobItemResult")}}}))},
+		"/v1/check-oob": map[string]interface{}{"post": openapiOperation("check the out-of-band identity (enabled with -cps-url), the text body is 'OrigTN,DestTN'",
+			nil, map[string]interface{}{"content": map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}},
+			"200", checkResp)},
+		"/v1/cps/passports/{dest}/{orig}": map[string]interface{}{
+			"get": openapiOperation("retrieve the passports of the call (enabled with -cps-srv)",
+				[]interface{}{openapiPathParam("dest"), openapiPathParam("orig")}, nil, "200",
+				openapiResponse("passports", openapiBody(openapiRef("CPSPassports"), false))),
+			"post": openapiOperation("publish the passports of the call (enabled with -cps-srv)",
+				[]interface{}{openapiPathParam("dest"), openapiPathParam("orig")}, openapiBody(openapiRef("CPSPassports"), false),
+				"201", openapiResponse("passports stored", nil)),
+		},
+		"/v1/version": map[string]interface{}{"get": openapiOperation("get the version, the build information, the FIPS crypto backend, the enabled backends and the library options",
+			nil, nil, "200", openapiResponse("version information", openapiBody(openapiRef("VersionInfo"), false)))},
+		"/v1/trust-store": map[string]interface{}{"get": openapiOperation("get the CA certificates (subject, expiry, source file) and the CRL used for verifying the certificates",
+			nil, nil, "200", openapiResponse("trust store", openapiBody(openapiRef("TrustStore"), true)))},
+		"/v1/origid/{origid}": map[string]interface{}{"get": openapiOperation("get the call metadata stored for the origid of a signed identity (enabled with -origid-store)",
+			[]interface{}{openapiPathParam("origid"), openapiHeader("X-API-Key", "api key given by -admin-key")}, nil, "200", openapiResponse("origid record", openapiBody(openapiRef("OrigIDRecord"), false)))},
+		"/v1/certs/{keyid}.pem": map[string]interface{}{"get": openapiOperation("get the certificate of the signing key (enabled with -fcert)",
+			[]interface{}{openapiPathParam("keyid")}, nil, "200", openapiResponse("certificate", map[string]interface{}{"content": map[string]interface{}{
+				"application/x-pem-file": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}}))},
+		"/v1/stats": map[string]interface{}{
+			"get": openapiOperation("get the sign and check statistics per source IP and API key fingerprint (enabled with -stats)",
+				nil, nil, "200", openapiResponse("statistics", openapiBody(openapiRef("StatsResult"), false))),
+			"delete": openapiOperation("reset the statistics (enabled with -stats)", nil, nil, "204", openapiResponse("statistics reset", nil)),
+		},
+		"/v1/stats/ca": map[string]interface{}{
+			"get": openapiOperation("get the verifications and the failures per issuing CA and SPC (enabled with -stats)",
+				nil, nil, "200", openapiResponse("statistics per CA", openapiBody(openapiRef("CAStatsResult"), false))),
+			"delete": openapiOperation("reset the statistics per CA (enabled with -stats)", nil, nil, "204", openapiResponse("statistics reset", nil)),
+		},
+		"/v1/self-check": map[string]interface{}{"get": openapiOperation("get the result of the last self-check (enabled with -self-check-interval)",
+			nil, nil, "200", openapiResponse("self-check passed", openapiBody(openapiRef("SelfCheckResult"), false)))},
+		"/v1/probes": map[string]interface{}{"get": openapiOperation("get the results of the last probes of the partner certificate repositories (enabled with -probe-urls)",
+			nil, nil, "200", openapiResponse("probe results", openapiBody(map[string]interface{}{"type": "array", "items": openapiRef("ProbeResult")}, false)))},
+		"/metrics": map[string]interface{}{"get": map[string]interface{}{"summary": "the statistics, the self-check and probe results and the latency histograms in the Prometheus text format (enabled with -stats, -self-check-interval, -probe-urls, -latency-metrics or OCSP checks)",
+			"responses": map[string]interface{}{"200": map[string]interface{}{"description": "metrics"}}}},
+		"/v1/openapi.json": map[string]interface{}{"get": map[string]interface{}{"summary": "the OpenAPI document",
+			"responses": map[string]interface{}{"200": map[string]interface{}{"description": "OpenAPI document"}}}},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "secsipidx",
+			"version": secsipidxVersion,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+func httpHandleV1OpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openapiDocument())
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// OrigIDRecord - the call metadata stored for the origid of a signed
+// identity, for answering the traceback requests
+type OrigIDRecord struct {
+	OrigID string          `json:"origid"`
+	TS     int64           `json:"ts"`
+	OrigTN string          `json:"origtn"`
+	DestTN string          `json:"desttn"`
+	Attest string          `json:"attest"`
+	CallID string          `json:"callid,omitempty"`
+	ReqID  string          `json:"requestid,omitempty"`
+	Meta   json.RawMessage `json:"meta,omitempty"`
+}
+
+var dbOrigIDSchema = []string{
+	`CREATE TABLE IF NOT EXISTS secsipidx_origids (
+		origid VARCHAR(128) PRIMARY KEY,
+		ts BIGINT NOT NULL,
+		origtn VARCHAR(64) NOT NULL DEFAULT '',
+		desttn VARCHAR(255) NOT NULL DEFAULT '',
+		attest VARCHAR(2) NOT NULL DEFAULT '',
+		callid VARCHAR(255) NOT NULL DEFAULT '',
+		requestid VARCHAR(128) NOT NULL DEFAULT '',
+		meta TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS secsipidx_origids_ts_idx ON secsipidx_origids (ts)`,
+}
+
+// origidStoreEnabled - true if the origids of the signed identities are stored
+func origidStoreEnabled() bool {
+	return cliops.origidstor && dbStore != nil
+}
+
+// InitOrigIDs - create the table of the origids if it does not exist
+func (s *DBStore) InitOrigIDs() error {
+	for _, q := range dbOrigIDSchema {
+		if _, err := s.db.Exec(q); err != nil {
+			return fmt.Errorf("failed to init origid schema: %v", err)
+		}
+	}
+	return nil
+}
+
+// InsertOrigID - store the record of the origid, the first one is kept if
+// the origid is used again
+func (s *DBStore) InsertOrigID(rec *OrigIDRecord) error {
+	_, err := s.db.Exec(s.rebind(`INSERT INTO secsipidx_origids
+		(origid, ts, origtn, desttn, attest, callid, requestid, meta)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (origid) DO NOTHING`),
+		rec.OrigID, rec.TS, rec.OrigTN, rec.DestTN, rec.Attest, rec.CallID, rec.ReqID, string(rec.Meta))
+	return err
+}
+
+// LookupOrigID - load the record of the origid, nil if it is not stored
+func (s *DBStore) LookupOrigID(origid string) (*OrigIDRecord, error) {
+	rec := &OrigIDRecord{}
+	var meta string
+	err := s.db.QueryRow(s.rebind(`SELECT origid, ts, origtn, desttn, attest, callid, requestid, meta
+		FROM secsipidx_origids WHERE origid = ?`), origid).Scan(&rec.OrigID, &rec.TS, &rec.OrigTN,
+		&rec.DestTN, &rec.Attest, &rec.CallID, &rec.ReqID, &meta)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(meta) > 0 {
+		rec.Meta = json.RawMessage(meta)
+	}
+	return rec, nil
+}
+
+// origidParseMeta - the call metadata for the origid store, which has to be
+// a JSON object, nil if empty
+func origidParseMeta(metaVal string) (json.RawMessage, error) {
+	metaVal = strings.TrimSpace(metaVal)
+	if len(metaVal) == 0 {
+		return nil, nil
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal([]byte(metaVal), &meta); err != nil {
+		return nil, fmt.Errorf("invalid origid metadata: %v", err)
+	}
+	return json.RawMessage(metaVal), nil
+}
+
+// origidStoreSign - store the origid of the signed identity with the call
+// metadata, errors are only logged
+func origidStoreSign(identityVal string, callID string, reqID string, meta json.RawMessage) {
+	if !origidStoreEnabled() {
+		return
+	}
+	payload := identityPayload(identityVal)
+	if len(payload.OrigID) == 0 {
+		return
+	}
+	rec := &OrigIDRecord{OrigID: payload.OrigID, TS: time.Now().Unix(), OrigTN: payload.Orig.TN,
+		DestTN: strings.Join(payload.Dest.TN, ","), Attest: payload.ATTest, CallID: callID, ReqID: reqID, Meta: meta}
+	if err := dbStore.InsertOrigID(rec); err != nil {
+		log.Printf("failed to store origid in database: %v", err)
+	}
+}
+
+// httpHandleV1OrigID - GET /v1/origid/<origid> for the call metadata stored
+// for the origid of a signed identity
+func httpHandleV1OrigID(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	origid := strings.TrimPrefix(r.URL.Path, "/v1/origid/")
+	if len(origid) == 0 {
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "origid not provided")
+		return
+	}
+	rec, err := dbStore.LookupOrigID(origid)
+	if err != nil {
+		httpLogf(r, "failed to load origid: %v\n", err)
+		httpError(w, http.StatusServiceUnavailable, httpErrUnavailable, secsipid.SJWTRetErr, "origid store not available")
+		return
+	}
+	if rec == nil {
+		httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "origid not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// secsipidxCLIOrigID - print the call metadata stored for the origid
+func secsipidxCLIOrigID() int {
+	if !origidStoreEnabled() {
+		fmt.Printf("origid store not configured\n")
+		return cliExitArgs
+	}
+	if len(cliops.origid) == 0 {
+		fmt.Printf("origid not provided\n")
+		return cliExitArgs
+	}
+	rec, err := dbStore.LookupOrigID(cliops.origid)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return -1
+	}
+	if rec == nil {
+		fmt.Printf("origid not found: %s\n", cliops.origid)
+		return cliExitFailure
+	}
+	jrec, _ := json.Marshal(rec)
+	fmt.Printf("%s\n", jrec)
+	return 0
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenTelemetry span kinds and status codes (OTLP)
+const (
+	otelKindInternal = 1
+	otelKindServer   = 2
+	otelStatusOK     = 1
+	otelStatusError  = 2
+)
+
+type otelValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otelAttr struct {
+	Key   string    `json:"key"`
+	Value otelValue `json:"value"`
+}
+
+type otelStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// OTelSpan - span in the OTLP/JSON format
+type OTelSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otelAttr `json:"attributes,omitempty"`
+	Status       otelStatus `json:"status"`
+}
+
+// OTelExporter - exporter of the spans to an OpenTelemetry collector using
+// OTLP over HTTP with JSON encoding, the spans are sent in batches
+type OTelExporter struct {
+	endpoint   string
+	service    string
+	httpClient *http.Client
+	spans      chan *OTelSpan
+}
+
+var otelExporter *OTelExporter = nil
+
+// otelBatchSize - maximum number of spans sent in one request
+const otelBatchSize = 512
+
+// NewOTelExporter - endpoint is the URL of the traces resource of the collector,
+// like 'http://127.0.0.1:4318/v1/traces'
+func NewOTelExporter(endpoint string, service string) (*OTelExporter, error) {
+	if !strings.HasPrefix(endpoint, "https://") && !strings.HasPrefix(endpoint, "http://") {
+		return nil, fmt.Errorf("invalid otel endpoint: %s", endpoint)
+	}
+	e := &OTelExporter{
+		endpoint:   endpoint,
+		service:    service,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		spans:      make(chan *OTelSpan, 4*otelBatchSize),
+	}
+	go e.run()
+	return e, nil
+}
+
+func otelRandomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// otelTraceParent - trace id and parent span id from W3C traceparent header
+func otelTraceParent(value string) (string, string) {
+	tokens := strings.Split(strings.TrimSpace(value), "-")
+	if len(tokens) != 4 || len(tokens[1]) != 32 || len(tokens[2]) != 16 {
+		return "", ""
+	}
+	if _, err := hex.DecodeString(tokens[1] + tokens[2]); err != nil {
+		return "", ""
+	}
+	return tokens[1], tokens[2]
+}
+
+// StartSpan - new span, in a new trace if traceID is empty
+func (e *OTelExporter) StartSpan(name string, kind int, traceID string, parentID string) *OTelSpan {
+	if len(traceID) == 0 {
+		traceID, parentID = otelRandomID(16), ""
+	}
+	return &OTelSpan{
+		TraceID:      traceID,
+		SpanID:       otelRandomID(8),
+		ParentSpanID: parentID,
+		Name:         name,
+		Kind:         kind,
+		Start:        strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+}
+
+// SetAttr - add the attribute to the span
+func (span *OTelSpan) SetAttr(key string, value string) {
+	span.Attributes = append(span.Attributes, otelAttr{Key: key, Value: otelValue{StringValue: value}})
+}
+
+// EndSpan - set the end time and the status of the span and queue it for
+// export; the span is dropped if the queue is full
+func (e *OTelExporter) EndSpan(span *OTelSpan, err error) {
+	span.End = strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err != nil {
+		span.Status = otelStatus{Code: otelStatusError, Message: err.Error()}
+	} else {
+		span.Status = otelStatus{Code: otelStatusOK}
+	}
+	select {
+	case e.spans <- span:
+	default:
+	}
+}
+
+// StartLibSpan - new span for an operation of the library, with attributes
+func (e *OTelExporter) StartLibSpan(name string, attrs map[string]string) *OTelSpan {
+	span := e.StartSpan(name, otelKindInternal, "", "")
+	for k, v := range attrs {
+		span.SetAttr(k, v)
+	}
+	return span
+}
+
+func (e *OTelExporter) run() {
+	ticker := time.NewTicker(5 * time.Second)
+	var batch []*OTelSpan
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) < otelBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.export(batch); err != nil {
+			log.Printf("failed to export spans: %v", err)
+		}
+		batch = nil
+	}
+}
+
+func (e *OTelExporter) export(spans []*OTelSpan) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otelAttr{{Key: "service.name", Value: otelValue{StringValue: e.service}},
+					{Key: "service.version", Value: otelValue{StringValue: secsipidxVersion}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "secsipidx"},
+				"spans": spans,
+			}},
+		}},
+	})
+	resp, err := e.httpClient.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("otel status error: %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// httpStatusWriter - response writer keeping the status code
+type httpStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *httpStatusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush --
+func (w *httpStatusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// otelHTTPSpan - start the server span for the http request, child of the
+// span from traceparent header if provided; returns the function to end it
+func otelHTTPSpan(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	traceID, parentID := otelTraceParent(r.Header.Get("traceparent"))
+	span := otelExporter.StartSpan(r.Method+" "+r.URL.Path, otelKindServer, traceID, parentID)
+	span.SetAttr("http.method", r.Method)
+	span.SetAttr("http.target", r.URL.Path)
+	span.SetAttr("http.request_id", httpRequestID(r))
+	if callID := httpRequestCallID(r); len(callID) > 0 {
+		span.SetAttr("sip.call_id", callID)
+	}
+	w.Header().Set("traceparent", "00-"+span.TraceID+"-"+span.SpanID+"-01")
+	sw := &httpStatusWriter{ResponseWriter: w, status: http.StatusOK}
+	return sw, func() {
+		span.SetAttr("http.status_code", strconv.Itoa(sw.status))
+		var err error
+		if sw.status >= 500 {
+			err = fmt.Errorf("http status %d", sw.status)
+		}
+		otelExporter.EndSpan(span, err)
+	}
+}
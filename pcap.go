@@ -0,0 +1,578 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// link layer types of the captures
+const (
+	pcapLinkNull     = 0
+	pcapLinkEthernet = 1
+	pcapLinkRaw      = 101
+	pcapLinkLoop     = 108
+	pcapLinkSLL      = 113
+	pcapLinkIPv4     = 228
+	pcapLinkIPv6     = 229
+	pcapLinkSLL2     = 276
+)
+
+// PcapPacket - a packet of the capture, with its link layer type
+type PcapPacket struct {
+	Time     time.Time
+	LinkType uint32
+	Data     []byte
+}
+
+// pcapReadPackets - the packets of the capture file, in pcap or pcapng format
+func pcapReadPackets(filePath string) ([]PcapPacket, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 24 {
+		return nil, errors.New("capture file too short")
+	}
+	if binary.BigEndian.Uint32(data) == 0x0A0D0D0A {
+		return pcapngReadPackets(data)
+	}
+	var order binary.ByteOrder
+	nano := false
+	switch binary.LittleEndian.Uint32(data) {
+	case 0xA1B2C3D4:
+		order = binary.LittleEndian
+	case 0xA1B23C4D:
+		order, nano = binary.LittleEndian, true
+	case 0xD4C3B2A1:
+		order = binary.BigEndian
+	case 0x4D3CB2A1:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, errors.New("unknown capture file format")
+	}
+	linkType := order.Uint32(data[20:]) & 0x0FFFFFFF
+	var packets []PcapPacket
+	for offset := 24; offset+16 <= len(data); {
+		sec, frac := order.Uint32(data[offset:]), order.Uint32(data[offset+4:])
+		caplen := int(order.Uint32(data[offset+8:]))
+		offset += 16
+		if offset+caplen > len(data) {
+			break
+		}
+		nsec := int64(frac) * 1000
+		if nano {
+			nsec = int64(frac)
+		}
+		packets = append(packets, PcapPacket{Time: time.Unix(int64(sec), nsec), LinkType: linkType,
+			Data: data[offset : offset+caplen]})
+		offset += caplen
+	}
+	return packets, nil
+}
+
+// pcapngReadPackets - the packets of the enhanced and simple packet blocks,
+// with the timestamps in microseconds (the default resolution)
+func pcapngReadPackets(data []byte) ([]PcapPacket, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	var linkTypes []uint32
+	var packets []PcapPacket
+	for offset := 0; offset+12 <= len(data); {
+		if binary.BigEndian.Uint32(data[offset:]) == 0x0A0D0D0A {
+			// section header, with the byte order magic
+			order = binary.LittleEndian
+			if binary.BigEndian.Uint32(data[offset+8:]) == 0x1A2B3C4D {
+				order = binary.BigEndian
+			}
+			linkTypes = nil
+		}
+		btype := order.Uint32(data[offset:])
+		blen := int(order.Uint32(data[offset+4:]))
+		if blen < 12 || offset+blen > len(data) {
+			return packets, errors.New("invalid pcapng block")
+		}
+		body := data[offset+8 : offset+blen-4]
+		switch btype {
+		case 1:
+			if len(body) >= 2 {
+				linkTypes = append(linkTypes, uint32(order.Uint16(body)))
+			}
+		case 6:
+			if len(body) >= 20 {
+				ifID := int(order.Uint32(body))
+				ts := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+				caplen := int(order.Uint32(body[12:]))
+				if ifID < len(linkTypes) && 20+caplen <= len(body) {
+					packets = append(packets, PcapPacket{Time: time.Unix(int64(ts/1000000), int64(ts%1000000)*1000),
+						LinkType: linkTypes[ifID], Data: body[20 : 20+caplen]})
+				}
+			}
+		case 3:
+			if len(body) >= 4 && len(linkTypes) > 0 {
+				packets = append(packets, PcapPacket{LinkType: linkTypes[0], Data: body[4:]})
+			}
+		}
+		offset += blen
+	}
+	return packets, nil
+}
+
+// pcapIPPayload - the IP packet out of the link layer frame
+func pcapIPPayload(pkt *PcapPacket) []byte {
+	data := pkt.Data
+	etherType := uint16(0)
+	switch pkt.LinkType {
+	case pcapLinkEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		for (etherType == 0x8100 || etherType == 0x88A8) && len(data) >= 4 {
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case pcapLinkSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case pcapLinkSLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data), data[20:]
+	case pcapLinkNull, pcapLinkLoop:
+		if len(data) < 4 {
+			return nil
+		}
+		return data[4:]
+	case pcapLinkRaw, pcapLinkIPv4, pcapLinkIPv6:
+		return data
+	default:
+		return nil
+	}
+	if etherType != 0x0800 && etherType != 0x86DD {
+		return nil
+	}
+	return data
+}
+
+// pcapFlow - transport payload of an IP packet, with the addresses
+type pcapFlow struct {
+	proto   byte
+	src     string
+	dst     string
+	seq     uint32
+	payload []byte
+}
+
+type pcapFragments struct {
+	parts map[int][]byte
+	total int
+}
+
+// pcapDecoder - decode the IP packets, reassembling the fragments and the TCP
+// streams (in order segments only)
+type pcapDecoder struct {
+	fragments map[string]*pcapFragments
+	streams   map[string]*bytes.Buffer
+	nextSeq   map[string]uint32
+}
+
+func newPcapDecoder() *pcapDecoder {
+	return &pcapDecoder{fragments: map[string]*pcapFragments{}, streams: map[string]*bytes.Buffer{},
+		nextSeq: map[string]uint32{}}
+}
+
+// reassemble - add the fragment and return the full payload when complete
+func (d *pcapDecoder) reassemble(key string, offset int, more bool, payload []byte) []byte {
+	frag, ok := d.fragments[key]
+	if !ok {
+		frag = &pcapFragments{parts: map[int][]byte{}, total: -1}
+		d.fragments[key] = frag
+	}
+	frag.parts[offset] = payload
+	if !more {
+		frag.total = offset + len(payload)
+	}
+	if frag.total < 0 {
+		return nil
+	}
+	full := make([]byte, 0, frag.total)
+	for len(full) < frag.total {
+		part, ok := frag.parts[len(full)]
+		if !ok || len(part) == 0 {
+			return nil
+		}
+		full = append(full, part...)
+	}
+	delete(d.fragments, key)
+	return full
+}
+
+// decodeIP - the transport payload of the IP packet, nil if not complete or
+// not UDP or TCP
+func (d *pcapDecoder) decodeIP(data []byte) *pcapFlow {
+	if len(data) < 1 {
+		return nil
+	}
+	var proto byte
+	var srcIP, dstIP net.IP
+	var payload []byte
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return nil
+		}
+		ihl := int(data[0]&0x0F) * 4
+		if ihl < 20 || ihl > len(data) {
+			return nil
+		}
+		total := int(binary.BigEndian.Uint16(data[2:]))
+		if total > len(data) || total < ihl {
+			total = len(data)
+		}
+		proto, srcIP, dstIP, payload = data[9], net.IP(data[12:16]), net.IP(data[16:20]), data[ihl:total]
+		flags := binary.BigEndian.Uint16(data[6:])
+		if flags&0x3FFF != 0 {
+			key := fmt.Sprintf("%s/%s/%d/%d", srcIP, dstIP, binary.BigEndian.Uint16(data[4:]), proto)
+			if payload = d.reassemble(key, int(flags&0x1FFF)*8, flags&0x2000 != 0, payload); payload == nil {
+				return nil
+			}
+		}
+	case 6:
+		if len(data) < 40 {
+			return nil
+		}
+		proto, srcIP, dstIP = data[6], net.IP(data[8:24]), net.IP(data[24:40])
+		end := 40 + int(binary.BigEndian.Uint16(data[4:]))
+		if end > len(data) {
+			end = len(data)
+		}
+		payload = data[40:end]
+		// extension headers: hop-by-hop, routing, fragment, destination options
+		for (proto == 0 || proto == 43 || proto == 44 || proto == 60) && len(payload) >= 8 {
+			if proto == 44 {
+				fragOffset := binary.BigEndian.Uint16(payload[2:])
+				key := fmt.Sprintf("%s/%s/%d", srcIP, dstIP, binary.BigEndian.Uint32(payload[4:]))
+				proto = payload[0]
+				if payload = d.reassemble(key, int(fragOffset&0xFFF8), fragOffset&1 != 0, payload[8:]); payload == nil {
+					return nil
+				}
+				continue
+			}
+			hlen := (int(payload[1]) + 1) * 8
+			if hlen > len(payload) {
+				return nil
+			}
+			proto, payload = payload[0], payload[hlen:]
+		}
+	default:
+		return nil
+	}
+	switch proto {
+	case 17:
+		if len(payload) < 8 {
+			return nil
+		}
+		return &pcapFlow{proto: proto, payload: payload[8:],
+			src: net.JoinHostPort(srcIP.String(), strconv.Itoa(int(binary.BigEndian.Uint16(payload)))),
+			dst: net.JoinHostPort(dstIP.String(), strconv.Itoa(int(binary.BigEndian.Uint16(payload[2:]))))}
+	case 6:
+		if len(payload) < 20 || int(payload[12]>>4)*4 > len(payload) {
+			return nil
+		}
+		return &pcapFlow{proto: proto, payload: payload[int(payload[12]>>4)*4:], seq: binary.BigEndian.Uint32(payload[4:]),
+			src: net.JoinHostPort(srcIP.String(), strconv.Itoa(int(binary.BigEndian.Uint16(payload)))),
+			dst: net.JoinHostPort(dstIP.String(), strconv.Itoa(int(binary.BigEndian.Uint16(payload[2:]))))}
+	}
+	return nil
+}
+
+// sipMessages - the SIP messages of the transport payload; for TCP, the
+// payload is appended to the stream and the complete messages are removed
+func (d *pcapDecoder) sipMessages(flow *pcapFlow) [][]byte {
+	if flow.proto == 17 {
+		return [][]byte{flow.payload}
+	}
+	key := flow.src + ">" + flow.dst
+	if len(flow.payload) == 0 {
+		return nil
+	}
+	if next, ok := d.nextSeq[key]; ok && int32(flow.seq-next) < 0 {
+		// retransmission
+		return nil
+	}
+	d.nextSeq[key] = flow.seq + uint32(len(flow.payload))
+	stream, ok := d.streams[key]
+	if !ok {
+		stream = &bytes.Buffer{}
+		d.streams[key] = stream
+	}
+	stream.Write(flow.payload)
+	var msgs [][]byte
+	for {
+		buf := stream.Bytes()
+		hdrEnd := bytes.Index(buf, []byte("\r\n\r\n"))
+		if hdrEnd < 0 {
+			break
+		}
+		msg := sipParseMessage(buf[:hdrEnd+4])
+		clen, _ := strconv.Atoi(msg.Header("Content-Length"))
+		if clen < 0 {
+			// invalid message, the rest of the stream cannot be delimited
+			stream.Reset()
+			break
+		}
+		if clen > len(buf)-hdrEnd-4 {
+			break
+		}
+		msgs = append(msgs, append([]byte(nil), buf[:hdrEnd+4+clen]...))
+		stream.Next(hdrEnd + 4 + clen)
+	}
+	return msgs
+}
+
+// SIPMessage - start line and headers of a SIP message
+type SIPMessage struct {
+	StartLine string
+	Headers   map[string][]string
+}
+
+// sipCompactNames - the full names of the compact header forms
+var sipCompactNames = map[string]string{"i": "call-id", "f": "from", "t": "to", "l": "content-length", "y": "identity"}
+
+// sipParseMessage - parse the start line and the headers, the names are
+// stored in lower case and the compact forms are expanded
+func sipParseMessage(data []byte) *SIPMessage {
+	msg := &SIPMessage{Headers: map[string][]string{}}
+	hdrEnd := bytes.Index(data, []byte("\r\n\r\n"))
+	if hdrEnd >= 0 {
+		data = data[:hdrEnd]
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(lines) > 0 && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			// header folding
+			lines[len(lines)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return msg
+	}
+	msg.StartLine = lines[0]
+	for _, line := range lines[1:] {
+		pos := strings.Index(line, ":")
+		if pos <= 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:pos]))
+		if fullName, ok := sipCompactNames[name]; ok {
+			name = fullName
+		}
+		msg.Headers[name] = append(msg.Headers[name], strings.TrimSpace(line[pos+1:]))
+	}
+	return msg
+}
+
+// Header - the first value of the header, by full name
+func (m *SIPMessage) Header(name string) string {
+	if values := m.Headers[strings.ToLower(name)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// PcapCheckResult - the result of checking an Identity of a SIP INVITE from
+// the capture
+type PcapCheckResult struct {
+	Time      string `json:"time"`
+	Src       string `json:"src"`
+	Dst       string `json:"dst"`
+	CallID    string `json:"callid"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Ppt       string `json:"ppt,omitempty"`
+	Attest    string `json:"attest,omitempty"`
+	OrigTN    string `json:"origtn,omitempty"`
+	DestTN    string `json:"desttn,omitempty"`
+	OrigMatch bool   `json:"origmatch"`
+	DestMatch bool   `json:"destmatch"`
+	Result    string `json:"result"`
+	Code      int    `json:"code"`
+	Check     string `json:"check,omitempty"`
+	Message   string `json:"message,omitempty"`
+
+	identity string
+	spc      string
+	time     time.Time
+}
+
+// sipHeaderTN - the telephone number of the From or To header value, empty
+// if the user part is not a number
+func sipHeaderTN(hdrVal string) string {
+	tn, _, _, err := secsipid.SJWTParseRedirectTarget(hdrVal)
+	if err != nil {
+		return ""
+	}
+	return tn
+}
+
+// pcapCheckInvite - check the Identity header values of the INVITE
+func pcapCheckInvite(pkt *PcapPacket, flow *pcapFlow, msg *SIPMessage) []*PcapCheckResult {
+	from, to := msg.Header("From"), msg.Header("To")
+	fromTN, toTN := sipHeaderTN(from), sipHeaderTN(to)
+	var identityVals []string
+	for _, hdrVal := range msg.Headers["identity"] {
+		// Identity values can be also comma separated in the same header
+		for _, identityVal := range strings.Split(hdrVal, ",") {
+			if len(strings.TrimSpace(identityVal)) > 0 {
+				identityVals = append(identityVals, strings.TrimSpace(identityVal))
+			}
+		}
+	}
+	base := PcapCheckResult{Time: pkt.Time.UTC().Format(time.RFC3339Nano), Src: flow.src, Dst: flow.dst,
+		CallID: msg.Header("Call-ID"), From: from, To: to, time: pkt.Time}
+	if len(identityVals) == 0 {
+		res := base
+		res.Result, res.Code = noIdentityResult(flow.src, msg.Header("X-Source-Trunk"))
+		res.Message = "no identity header"
+		res.Check = secsipid.SJWTRetClass(res.Code)
+		return []*PcapCheckResult{&res}
+	}
+	var results []*PcapCheckResult
+	for _, identityVal := range identityVals {
+		res := base
+		res.identity = identityVal
+		info, ret, err := checkFullIdentityInfo(context.Background(), identityVal)
+		res.spc = identityCertSPC(info)
+		if parts, _, perr := secsipid.SJWTParseIdentityParts(identityVal); perr == nil {
+			res.Ppt = parts.Header.Ppt
+		}
+		payload := identityPayload(identityVal)
+		res.Attest, res.OrigTN = payload.ATTest, payload.Orig.TN
+		res.DestTN = strings.Join(payload.Dest.TN, ",")
+		res.OrigMatch = len(fromTN) > 0 && fromTN == strings.TrimPrefix(payload.Orig.TN, "+")
+		for _, tn := range payload.Dest.TN {
+			res.DestMatch = res.DestMatch || (len(toTN) > 0 && toTN == strings.TrimPrefix(tn, "+"))
+		}
+		res.Result, res.Code = "OK", ret
+		if ret != secsipid.SJWTRetOK {
+			res.Result, res.Check, res.Message = "FAILED", secsipid.SJWTRetClass(ret), errorMessage(err)
+			if checkUnavailable(ret) {
+				res.Result = checkResultUnavailable
+			}
+		}
+		results = append(results, &res)
+	}
+	return results
+}
+
+// pcapCheckFile - check the Identity of the SIP INVITEs of the capture, only
+// the ones with the Call-ID if not empty; the retransmissions are skipped
+func pcapCheckFile(filePath string, callID string) ([]*PcapCheckResult, error) {
+	packets, err := pcapReadPackets(filePath)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(packets, func(i, j int) bool { return packets[i].Time.Before(packets[j].Time) })
+	decoder := newPcapDecoder()
+	seen := map[string]bool{}
+	var results []*PcapCheckResult
+	for i := range packets {
+		ipData := pcapIPPayload(&packets[i])
+		if ipData == nil {
+			continue
+		}
+		flow := decoder.decodeIP(ipData)
+		if flow == nil {
+			continue
+		}
+		for _, data := range decoder.sipMessages(flow) {
+			if !bytes.HasPrefix(data, []byte("INVITE ")) {
+				continue
+			}
+			msg := sipParseMessage(data)
+			msgCallID := msg.Header("Call-ID")
+			if len(callID) > 0 && msgCallID != callID {
+				continue
+			}
+			key := msgCallID + "|" + msg.Header("CSeq") + "|" + strings.Join(msg.Headers["identity"], ",")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			results = append(results, pcapCheckInvite(&packets[i], flow, msg)...)
+		}
+	}
+	return results, nil
+}
+
+// pcapWriteReport - write the results as JSON document
+func pcapWriteReport(w io.Writer, results []*PcapCheckResult) error {
+	if results == nil {
+		results = []*PcapCheckResult{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
+
+// secsipidxCLIPcap - check the identities of the INVITEs from the capture file,
+// writing the report to stdout or to the file given with -pcap-report
+func secsipidxCLIPcap() int {
+	results, err := pcapCheckFile(cliops.fpcap, cliops.callid)
+	if err != nil {
+		fmt.Printf("failed to read the capture file: %v\n", err)
+		return -1
+	}
+	out := io.Writer(os.Stdout)
+	if len(cliops.pcapreport) > 0 {
+		f, err := os.Create(cliops.pcapreport)
+		if err != nil {
+			fmt.Printf("failed to create the report file: %v\n", err)
+			return -1
+		}
+		defer f.Close()
+		out = f
+	}
+	if err = pcapWriteReport(out, results); err != nil {
+		fmt.Printf("failed to write the report: %v\n", err)
+		return -1
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(os.Stderr, "no SIP INVITE found in: %s\n", cliops.fpcap)
+		return -1
+	}
+	failed := 0
+	for _, res := range results {
+		if res.Code != secsipid.SJWTRetOK && res.Result == "FAILED" {
+			failed++
+		}
+	}
+	if cliops.verbosity > 0 {
+		fmt.Fprintf(os.Stderr, "checked identities: %d, failed: %d\n", len(results), failed)
+	}
+	if failed > 0 {
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// testIPv4 - IPv4 packet from 10.0.0.1 to 10.0.0.2, with the fragment flags
+// and offset (in units of 8 bytes)
+func testIPv4(proto byte, id uint16, flags uint16, payload []byte) []byte {
+	pkt := make([]byte, 20, 20+len(payload))
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:], uint16(20+len(payload)))
+	binary.BigEndian.PutUint16(pkt[4:], id)
+	binary.BigEndian.PutUint16(pkt[6:], flags)
+	pkt[8], pkt[9] = 64, proto
+	copy(pkt[12:], []byte{10, 0, 0, 1})
+	copy(pkt[16:], []byte{10, 0, 0, 2})
+	return append(pkt, payload...)
+}
+
+// testIPv6 - IPv6 packet from ::1 to ::2
+func testIPv6(proto byte, payload []byte) []byte {
+	pkt := make([]byte, 40, 40+len(payload))
+	pkt[0] = 0x60
+	binary.BigEndian.PutUint16(pkt[4:], uint16(len(payload)))
+	pkt[6], pkt[7] = proto, 64
+	pkt[23], pkt[39] = 1, 2
+	return append(pkt, payload...)
+}
+
+func testUDP(payload []byte) []byte {
+	hdr := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(hdr, 5060)
+	binary.BigEndian.PutUint16(hdr[2:], 5080)
+	binary.BigEndian.PutUint16(hdr[4:], uint16(8+len(payload)))
+	return append(hdr, payload...)
+}
+
+func testTCP(seq uint32, payload []byte) []byte {
+	hdr := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(hdr, 5060)
+	binary.BigEndian.PutUint16(hdr[2:], 5080)
+	binary.BigEndian.PutUint32(hdr[4:], seq)
+	hdr[12] = 5 << 4
+	return append(hdr, payload...)
+}
+
+func testEthernet(etherType uint16, payload []byte) []byte {
+	hdr := make([]byte, 14, 14+len(payload))
+	binary.BigEndian.PutUint16(hdr[12:], etherType)
+	return append(hdr, payload...)
+}
+
+// testPcapFile - capture file in pcap format (microseconds, little endian)
+// with the ethernet frames
+func testPcapFile(t *testing.T, frames ...[]byte) string {
+	data := make([]byte, 24)
+	binary.LittleEndian.PutUint32(data, 0xA1B2C3D4)
+	binary.LittleEndian.PutUint16(data[4:], 2)
+	binary.LittleEndian.PutUint16(data[6:], 4)
+	binary.LittleEndian.PutUint32(data[16:], 65535)
+	binary.LittleEndian.PutUint32(data[20:], pcapLinkEthernet)
+	for i, frame := range frames {
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec, uint32(1700000000+i))
+		binary.LittleEndian.PutUint32(rec[8:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(rec[12:], uint32(len(frame)))
+		data = append(append(data, rec...), frame...)
+	}
+	filePath := filepath.Join(t.TempDir(), "capture.pcap")
+	os.WriteFile(filePath, data, 0640)
+	return filePath
+}
+
+const testInvite = "INVITE sip:493022222222@example.com SIP/2.0\r\n" +
+	"Call-ID: pcap-test-1\r\n" +
+	"CSeq: 1 INVITE\r\n" +
+	"From: <sip:+493011111111@example.com>;tag=1\r\n" +
+	"To: <sip:493022222222@example.com>\r\n" +
+	"Content-Length: 0\r\n\r\n"
+
+func TestPcapIPPayload(t *testing.T) {
+	ipData := testIPv4(17, 1, 0, testUDP([]byte("SIP")))
+	vlan := append([]byte{0, 1, 0x08, 0x00}, ipData...)
+	sll := append(make([]byte, 16), ipData...)
+	binary.BigEndian.PutUint16(sll[14:], 0x0800)
+	sll2 := append(make([]byte, 20), ipData...)
+	binary.BigEndian.PutUint16(sll2, 0x0800)
+
+	for _, tc := range []struct {
+		name     string
+		linkType uint32
+		data     []byte
+		expected []byte
+	}{
+		{"ethernet", pcapLinkEthernet, testEthernet(0x0800, ipData), ipData},
+		{"ethernet with vlan tag", pcapLinkEthernet, testEthernet(0x8100, vlan), ipData},
+		{"linux cooked", pcapLinkSLL, sll, ipData},
+		{"linux cooked v2", pcapLinkSLL2, sll2, ipData},
+		{"loopback", pcapLinkNull, append([]byte{2, 0, 0, 0}, ipData...), ipData},
+		{"raw ip", pcapLinkRaw, ipData, ipData},
+		{"truncated ethernet header", pcapLinkEthernet, make([]byte, 13), nil},
+		{"truncated linux cooked header", pcapLinkSLL, make([]byte, 15), nil},
+		{"truncated loopback header", pcapLinkLoop, make([]byte, 3), nil},
+		{"not ip ethertype", pcapLinkEthernet, testEthernet(0x0806, ipData), nil},
+		{"unknown link type", 147, ipData, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			expect(pcapIPPayload(&PcapPacket{LinkType: tc.linkType, Data: tc.data})).ToEqual(tc.expected)
+		})
+	}
+}
+
+func TestPcapDecodeIP(t *testing.T) {
+	sip := []byte(testInvite)
+	badOffset := testTCP(1, sip)
+	badOffset[12] = 15 << 4
+	shortIHL := testIPv4(17, 1, 0, testUDP(sip))
+	shortIHL[0] = 0x44
+	longIHL := testIPv4(17, 1, 0, make([]byte, 20))
+	longIHL[0] = 0x4F
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		proto   byte
+		src     string
+		payload []byte
+	}{
+		{"ipv4 udp", testIPv4(17, 1, 0, testUDP(sip)), 17, "10.0.0.1:5060", sip},
+		{"ipv4 tcp", testIPv4(6, 1, 0, testTCP(1, sip)), 6, "10.0.0.1:5060", sip},
+		{"ipv6 udp", testIPv6(17, testUDP(sip)), 17, "[::1]:5060", sip},
+		{"ipv6 udp after extension header", testIPv6(0, append([]byte{17, 0, 0, 0, 0, 0, 0, 0}, testUDP(sip)...)),
+			17, "[::1]:5060", sip},
+		{"ipv4 total length beyond data", testIPv4(17, 1, 0, testUDP(sip))[:60], 17, "10.0.0.1:5060", sip[:32]},
+		{"empty packet", nil, 0, "", nil},
+		{"truncated ipv4 header", testIPv4(17, 1, 0, nil)[:19], 0, "", nil},
+		{"truncated ipv6 header", testIPv6(17, nil)[:39], 0, "", nil},
+		{"ipv4 header length below minimum", shortIHL, 0, "", nil},
+		{"ipv4 header length beyond packet", longIHL, 0, "", nil},
+		{"truncated udp header", testIPv4(17, 1, 0, []byte{0x13, 0xc4, 0x13}), 0, "", nil},
+		{"truncated tcp header", testIPv4(6, 1, 0, testTCP(1, nil)[:19]), 0, "", nil},
+		{"tcp data offset beyond segment", testIPv4(6, 1, 0, badOffset[:40]), 0, "", nil},
+		{"truncated ipv6 extension header", testIPv6(0, []byte{17, 4, 0, 0, 0, 0, 0, 0}), 0, "", nil},
+		{"not udp or tcp", testIPv4(1, 1, 0, []byte{8, 0, 0, 0, 0, 0, 0, 0}), 0, "", nil},
+		{"unknown ip version", append([]byte{0x55}, make([]byte, 39)...), 0, "", nil},
+		{"first fragment only", testIPv4(17, 1, 0x2000, testUDP(sip)[:64]), 0, "", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			flow := newPcapDecoder().decodeIP(tc.data)
+			if tc.payload == nil {
+				expect(flow == nil).ToBe(true)
+				return
+			}
+			expect(flow == nil).ToBe(false)
+			expect(flow.proto).ToBe(tc.proto)
+			expect(flow.src).ToBe(tc.src)
+			expect(string(flow.payload)).ToBe(string(tc.payload))
+		})
+	}
+
+	t.Run("ipv4 fragments reassembled in any order", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		datagram := testUDP(sip)
+		decoder := newPcapDecoder()
+		expect(decoder.decodeIP(testIPv4(17, 7, 8, datagram[64:])) == nil).ToBe(true)
+		flow := decoder.decodeIP(testIPv4(17, 7, 0x2000, datagram[:64]))
+		expect(flow == nil).ToBe(false)
+		expect(string(flow.payload)).ToBe(testInvite)
+	})
+}
+
+func TestPcapSIPMessages(t *testing.T) {
+	sip := []byte(testInvite)
+	withBody := []byte("INVITE sip:b@example.com SIP/2.0\r\nContent-Length: 4\r\n\r\nv=0\n")
+	negative := []byte("INVITE sip:b@example.com SIP/2.0\r\nContent-Length: -4\r\n\r\nv=0\n")
+
+	for _, tc := range []struct {
+		name     string
+		segments [][]byte
+		seqs     []uint32
+		expected []string
+	}{
+		{"one message", [][]byte{sip}, []uint32{1}, []string{testInvite}},
+		{"message split over segments", [][]byte{sip[:30], sip[30:]}, []uint32{1, 31}, []string{testInvite}},
+		{"two messages in one segment", [][]byte{append(append([]byte{}, sip...), withBody...)}, []uint32{1},
+			[]string{testInvite, string(withBody)}},
+		{"retransmitted segment", [][]byte{sip, sip}, []uint32{1, 1}, []string{testInvite}},
+		{"truncated body", [][]byte{withBody[:len(withBody)-2]}, []uint32{1}, nil},
+		{"no end of headers", [][]byte{sip[:len(sip)-2]}, []uint32{1}, nil},
+		{"negative content length", [][]byte{negative}, []uint32{1}, nil},
+		{"message after negative content length", [][]byte{negative, sip}, []uint32{1, uint32(1 + len(negative))},
+			[]string{testInvite}},
+		{"content length beyond int range", [][]byte{[]byte("INVITE sip:b@example.com SIP/2.0\r\n" +
+			"Content-Length: 9223372036854775807\r\n\r\n")}, []uint32{1}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			decoder := newPcapDecoder()
+			var msgs []string
+			for i, segment := range tc.segments {
+				for _, msg := range decoder.sipMessages(&pcapFlow{proto: 6, src: "a", dst: "b", seq: tc.seqs[i], payload: segment}) {
+					msgs = append(msgs, string(msg))
+				}
+			}
+			expect(msgs).ToEqual(tc.expected)
+		})
+	}
+}
+
+func TestSIPParseMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		data       string
+		identities []string
+		callID     string
+	}{
+		{"identity header", "INVITE sip:b@example.com SIP/2.0\r\nCall-ID: c1\r\nIdentity: a.b.c;info=<https://x/c.pem>\r\n\r\n",
+			[]string{"a.b.c;info=<https://x/c.pem>"}, "c1"},
+		{"compact forms", "INVITE sip:b@example.com SIP/2.0\r\ni: c2\r\ny: a.b.c\r\n\r\n", []string{"a.b.c"}, "c2"},
+		{"header names in any case", "INVITE sip:b@example.com SIP/2.0\r\nCALL-ID: c3\r\nidentity: a.b.c\r\n\r\n",
+			[]string{"a.b.c"}, "c3"},
+		{"multiple identity headers", "INVITE sip:b@example.com SIP/2.0\r\nIdentity: a.b.c\r\nIdentity: d.e.f\r\n\r\n",
+			[]string{"a.b.c", "d.e.f"}, ""},
+		{"folded identity header", "INVITE sip:b@example.com SIP/2.0\r\nIdentity: a.b.c\r\n  ;info=<https://x/c.pem>\r\n\r\n",
+			[]string{"a.b.c ;info=<https://x/c.pem>"}, ""},
+		{"lines without colon ignored", "INVITE sip:b@example.com SIP/2.0\r\ngarbage\r\n: empty name\r\nIdentity: a.b.c\r\n\r\n",
+			[]string{"a.b.c"}, ""},
+		{"body not parsed", "INVITE sip:b@example.com SIP/2.0\r\nContent-Length: 13\r\n\r\nIdentity: x\r\n", nil, ""},
+		{"empty message", "", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			msg := sipParseMessage([]byte(tc.data))
+			expect(msg.Headers["identity"]).ToEqual(tc.identities)
+			expect(msg.Header("Call-ID")).ToBe(tc.callID)
+		})
+	}
+}
+
+func TestPcapReadPackets(t *testing.T) {
+	frame := testEthernet(0x0800, testIPv4(17, 1, 0, testUDP([]byte(testInvite))))
+
+	t.Run("OK with pcap file", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		packets, err := pcapReadPackets(testPcapFile(t, frame, frame))
+		expect(err).ToBe(nil)
+		expect(len(packets)).ToBe(2)
+		expect(packets[1].Time).ToEqual(time.Unix(1700000001, 0))
+		expect(packets[0].LinkType).ToBe(uint32(pcapLinkEthernet))
+	})
+
+	t.Run("OK with truncated last packet dropped", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		filePath := testPcapFile(t, frame, frame)
+		data, _ := os.ReadFile(filePath)
+		os.WriteFile(filePath, data[:len(data)-10], 0640)
+		packets, err := pcapReadPackets(filePath)
+		expect(err).ToBe(nil)
+		expect(len(packets)).ToBe(1)
+	})
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"too short", make([]byte, 23)},
+		{"unknown format", make([]byte, 24)},
+	} {
+		t.Run("Error with "+tc.name+" file", func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			filePath := filepath.Join(t.TempDir(), "capture.pcap")
+			os.WriteFile(filePath, tc.data, 0640)
+			_, err := pcapReadPackets(filePath)
+			expect(err == nil).ToBe(false)
+		})
+	}
+
+	t.Run("Error with invalid pcapng block", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		data := make([]byte, 28)
+		binary.BigEndian.PutUint32(data, 0x0A0D0D0A)
+		binary.LittleEndian.PutUint32(data[4:], 64)
+		binary.LittleEndian.PutUint32(data[8:], 0x1A2B3C4D)
+		_, err := pcapngReadPackets(data)
+		expect(err == nil).ToBe(false)
+	})
+}
+
+func TestPcapCheckFile(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	prvBytes, _ := x509.MarshalECPrivateKey(key)
+	pubBytes, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubkeyPath := filepath.Join(t.TempDir(), "pubkey.pem")
+	os.WriteFile(pubkeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}), 0640)
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem",
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes}))
+
+	fpubkey, expire := cliops.fpubkey, cliops.expire
+	cliops.fpubkey, cliops.expire = pubkeyPath, 300
+	defer func() { cliops.fpubkey, cliops.expire = fpubkey, expire }()
+
+	invite := func(callID string, identities ...string) []byte {
+		msg := "INVITE sip:493022222222@example.com SIP/2.0\r\nCall-ID: " + callID + "\r\nCSeq: 1 INVITE\r\n" +
+			"From: <sip:+493011111111@example.com>\r\nTo: <sip:493022222222@example.com>\r\n"
+		for _, identityVal := range identities {
+			msg += "Identity: " + identityVal + "\r\n"
+		}
+		return testEthernet(0x0800, testIPv4(17, 1, 0, testUDP([]byte(msg+"Content-Length: 0\r\n\r\n"))))
+	}
+
+	for _, tc := range []struct {
+		name    string
+		frames  [][]byte
+		results []string
+		codes   []int
+	}{
+		{"valid identity", [][]byte{invite("c1", identity)}, []string{"OK"}, []int{secsipid.SJWTRetOK}},
+		{"retransmitted invite checked once", [][]byte{invite("c1", identity), invite("c1", identity)},
+			[]string{"OK"}, []int{secsipid.SJWTRetOK}},
+		{"comma separated identities", [][]byte{invite("c1", identity+", "+identity)},
+			[]string{"OK", "OK"}, []int{secsipid.SJWTRetOK, secsipid.SJWTRetOK}},
+		{"malformed identity", [][]byte{invite("c1", "not-a-token")},
+			[]string{"FAILED"}, []int{secsipid.SJWTRetErrSIPHdrParse}},
+		{"no identity", [][]byte{invite("c1")}, []string{"FAILED"}, []int{secsipid.SJWTRetErrSIPHdrEmpty}},
+		{"truncated packet", [][]byte{invite("c1", identity)[:30]}, nil, nil},
+		{"malformed packet", [][]byte{testEthernet(0x0800, []byte{0x45, 0, 0})}, nil, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			results, err := pcapCheckFile(testPcapFile(t, tc.frames...), "")
+			expect(err).ToBe(nil)
+			var names []string
+			var codes []int
+			for _, res := range results {
+				names, codes = append(names, res.Result), append(codes, res.Code)
+			}
+			expect(names).ToEqual(tc.results)
+			expect(codes).ToEqual(tc.codes)
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// treatment of the identities with a ppt by the verification policy
+const (
+	pptRequired  = "required"
+	pptOptional  = "optional"
+	pptIgnored   = "ignored"
+	pptForbidden = "forbidden"
+)
+
+// PptRule - the ppt extensions required, optional (verified if present),
+// ignored (not verified) and forbidden for the calls from the trunk, empty
+// or "*" trunk matching any value
+type PptRule struct {
+	Trunk     string   `json:"trunk"`
+	Required  []string `json:"required,omitempty"`
+	Optional  []string `json:"optional,omitempty"`
+	Ignored   []string `json:"ignored,omitempty"`
+	Forbidden []string `json:"forbidden,omitempty"`
+}
+
+// PptPolicy - the ppt verification policy, first matching rule wins; the ppt
+// extensions not listed by the rule are handled as given by Unlisted
+// (ignored or forbidden, default ignored)
+type PptPolicy struct {
+	Rules    []PptRule `json:"rules"`
+	Unlisted string    `json:"unlisted,omitempty"`
+}
+
+// PptStatus - the identities with the ppt extension and their verification
+type PptStatus struct {
+	Ppt    string `json:"ppt"`
+	Policy string `json:"policy"`
+	Count  int    `json:"count"`
+	Status string `json:"status"`
+	Code   int    `json:"code"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PptResult - JSON response of checking the identities of a call with the
+// ppt policy, with the status of each ppt extension of the matched rule or
+// present in the identities
+type PptResult struct {
+	Result string      `json:"result"`
+	Code   int         `json:"code"`
+	Trunk  string      `json:"trunk,omitempty"`
+	Ppts   []PptStatus `json:"ppts"`
+}
+
+// IdentitiesRequest - JSON body of the endpoint checking the identities of a
+// call with the ppt policy
+type IdentitiesRequest struct {
+	Identities []string `json:"identities"`
+}
+
+// pptPolicy - the policy loaded with -ppt-policy, the default one has no
+// rules
+var pptPolicy = &PptPolicy{Unlisted: pptIgnored}
+
+// defaultPptRule - the rule used when no rule matches: shaken required and
+// the other ppt extensions optional
+var defaultPptRule = &PptRule{Required: []string{"shaken"}}
+
+// LoadPptPolicy - load the ppt verification policy from JSON file
+func LoadPptPolicy(filePath string) (*PptPolicy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	p := &PptPolicy{}
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid ppt policy: %v", err)
+	}
+	switch p.Unlisted {
+	case "":
+		p.Unlisted = pptIgnored
+	case pptIgnored, pptForbidden:
+	default:
+		return nil, fmt.Errorf("invalid ppt policy for unlisted ppt: %s", p.Unlisted)
+	}
+	for i, rule := range p.Rules {
+		seen := map[string]bool{}
+		for _, ppts := range [][]string{rule.Required, rule.Optional, rule.Ignored, rule.Forbidden} {
+			for _, ppt := range ppts {
+				if seen[ppt] {
+					return nil, fmt.Errorf("ppt %s listed twice in rule %d", ppt, i)
+				}
+				seen[ppt] = true
+			}
+		}
+	}
+	return p, nil
+}
+
+// rule - the first rule matching the trunk, the default one if none
+func (p *PptPolicy) rule(trunk string) *PptRule {
+	for i := range p.Rules {
+		if attestRuleMatch(p.Rules[i].Trunk, trunk) {
+			return &p.Rules[i]
+		}
+	}
+	return defaultPptRule
+}
+
+// treatment - the treatment of the ppt by the rule
+func (p *PptPolicy) treatment(rule *PptRule, ppt string) string {
+	for _, item := range []struct {
+		ppts      []string
+		treatment string
+	}{{rule.Required, pptRequired}, {rule.Optional, pptOptional}, {rule.Ignored, pptIgnored},
+		{rule.Forbidden, pptForbidden}} {
+		for _, v := range item.ppts {
+			if v == ppt {
+				return item.treatment
+			}
+		}
+	}
+	if rule == defaultPptRule {
+		return pptOptional
+	}
+	return p.Unlisted
+}
+
+// identityPpt - the ppt of the identity header, 'passport' for the base
+// PASSporT without ppt
+func identityPpt(identityVal string) string {
+	parts, _, err := secsipid.SJWTParseIdentityParts(identityVal)
+	if err != nil || len(parts.Header.Ppt) == 0 {
+		return "passport"
+	}
+	return parts.Header.Ppt
+}
+
+// Check - check the identities of the call from the trunk with the policy,
+// verifying the ones with required or optional ppt; the code is the one of
+// the first failure (forbidden ppt, missing required ppt, then failed
+// verification, in the order of the ppt names)
+func (p *PptPolicy) Check(ctx context.Context, identityVals []string, trunk string) *PptResult {
+	rule := p.rule(trunk)
+	statuses := map[string]*PptStatus{}
+	status := func(ppt string) *PptStatus {
+		if st, ok := statuses[ppt]; ok {
+			return st
+		}
+		st := &PptStatus{Ppt: ppt, Policy: p.treatment(rule, ppt), Status: "missing"}
+		statuses[ppt] = st
+		return st
+	}
+	for _, ppt := range rule.Required {
+		status(ppt)
+	}
+	for _, identityVal := range identityVals {
+		st := status(identityPpt(identityVal))
+		st.Count++
+		switch st.Policy {
+		case pptIgnored:
+			st.Status = "ignored"
+		case pptForbidden:
+			st.Status, st.Code = "forbidden", secsipid.SJWTRetErrPolicyPptForbidden
+		default:
+			if st.Code != secsipid.SJWTRetOK {
+				continue
+			}
+			ret, err := checkFullIdentityContext(ctx, identityVal)
+			st.Status, st.Code, st.Reason = "valid", ret, errorMessage(err)
+			if ret != secsipid.SJWTRetOK {
+				st.Status = "invalid"
+			}
+		}
+	}
+
+	result := &PptResult{Result: "OK", Trunk: trunk}
+	for _, st := range statuses {
+		if st.Status == "missing" && st.Policy == pptRequired {
+			st.Code = secsipid.SJWTRetErrPolicyPptMissing
+		}
+		result.Ppts = append(result.Ppts, *st)
+	}
+	sort.Slice(result.Ppts, func(i, j int) bool { return result.Ppts[i].Ppt < result.Ppts[j].Ppt })
+	for _, code := range []int{secsipid.SJWTRetErrPolicyPptForbidden, secsipid.SJWTRetErrPolicyPptMissing} {
+		for _, st := range result.Ppts {
+			if result.Code == secsipid.SJWTRetOK && st.Code == code {
+				result.Code = code
+			}
+		}
+	}
+	for _, st := range result.Ppts {
+		if result.Code == secsipid.SJWTRetOK && st.Code != secsipid.SJWTRetOK {
+			result.Code = st.Code
+		}
+	}
+	if result.Code != secsipid.SJWTRetOK {
+		result.Result = "FAILED"
+	}
+	return result
+}
+
+// httpHandleV1CheckIdentities - POST /v1/check-identities to check the
+// identities of a call with the ppt policy for the trunk of X-Source-Trunk
+func httpHandleV1CheckIdentities(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for identities check ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	idsReq := IdentitiesRequest{}
+	if err = json.Unmarshal(body, &idsReq); err != nil {
+		httpLogf(r, "invalid identities request body\n")
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+	result := pptPolicy.Check(r.Context(), idsReq.Identities, r.Header.Get("X-Source-Trunk"))
+	httpLogf(r, "identities checked - result: %s, code: %d\n", result.Result, result.Code)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// secsipidxCLICheckIdentities - check the identities of the call from the
+// trunk with the ppt policy, printing the result as JSON
+func secsipidxCLICheckIdentities() int {
+	identityVals := readIdentityList()
+	if len(identityVals) == 0 {
+		fmt.Printf("Identity value not provided\n")
+		return cliExitArgs
+	}
+	result := pptPolicy.Check(context.Background(), identityVals, cliops.trunk)
+	jresult, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Printf("%s\n", jresult)
+	return result.Code
+}
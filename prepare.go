@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// FinalizeRequest - JSON body of the finalize endpoint
+type FinalizeRequest struct {
+	SigningInput string `json:"signinginput"`
+	Signature    string `json:"signature"`
+}
+
+// finalizeCert - the certificate of the signer for verifying the signatures
+// to finalize, the finalize endpoint is enabled only if it is set
+var finalizeCert []byte
+
+// loadFinalizeCert - load the certificate given by -finalize-cert or, if not
+// set, by -x5t-cert
+func loadFinalizeCert() error {
+	certPath := cliops.finalcert
+	if len(certPath) == 0 {
+		certPath = cliops.x5tcert
+	}
+	if len(certPath) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
+	}
+	finalizeCert = data
+	return nil
+}
+
+// preparePayload - the shaken payload from the parameters of the identity
+func preparePayload(origTN string, destTN string, attestVal string, origID string, mkyVal string,
+	claimsVal string) (*secsipid.SJWTPayload, error) {
+	mky, _, err := secsipid.SJWTParseMky(mkyVal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mky: %v", err)
+	}
+	claims, err := parseClaims(claimsVal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims: %v", err)
+	}
+	return &secsipid.SJWTPayload{
+		ATTest: attestVal,
+		Dest: secsipid.SJWTDest{
+			TN: []string{destTN},
+		},
+		Mky: mky,
+		Orig: secsipid.SJWTOrig{
+			TN: origTN,
+		},
+		OrigID: origID,
+		Extra:  claims,
+	}, nil
+}
+
+// httpHandleV1Prepare - build the PASSporT of the identity without signing
+// it, the body being like for /v1/sign-csv
+func httpHandleV1Prepare(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for preparing identity ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+
+	token, err := httpRequestSignTokens(r, body)
+	if err != nil || len(token) < 5 {
+		httpLogf(r, "too few tokens in input body: %d\n", len(token))
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "too few tokens")
+		return
+	}
+	mkyVal := ""
+	if len(token) > 5 {
+		mkyVal = token[5]
+	}
+	attestVal := signAttestation(httpSignAttrs(r, token[0], token[2]))
+	payload, err := preparePayload(token[0], token[1], attestVal, token[3], mkyVal, r.Header.Get("X-Claims"))
+	if err != nil {
+		httpLogf(r, "%v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+		return
+	}
+	_, x5uVal, err := signKey(httpSignKeyName(r), httpSignX5u(r, token[4]))
+	if err != nil {
+		httpLogf(r, "invalid signing key: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, err.Error())
+		return
+	}
+
+	prepared, ret, err := secsipid.SJWTPrepareIdentityPayload(*payload, x5uVal)
+	if err != nil {
+		httpLogf(r, "failed preparing identity: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prepared)
+}
+
+// secsipidxCLIPrepare - print the PASSporT of the identity built from the
+// parameters, without signing it
+func secsipidxCLIPrepare() int {
+	attestVal := signAttestation(&SignAttrs{OrigTN: cliops.origtn, Trunk: cliops.trunk, Attest: cliops.attest})
+	payload, err := preparePayload(cliops.origtn, cliops.desttn, attestVal, cliops.origid, cliops.mky, cliops.claims)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return cliExitArgs
+	}
+	payload.IAT = int64(cliops.iat)
+	_, x5uVal, err := signKey(cliops.keyname, cliops.x5u)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return cliExitKey
+	}
+	prepared, ret, err := secsipid.SJWTPrepareIdentityPayload(*payload, x5uVal)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return ret
+	}
+	jprepared, _ := json.MarshalIndent(prepared, "", "  ")
+	fmt.Printf("%s\n", jprepared)
+	return 0
+}
+
+// httpHandleV1Finalize - build the identity from the signing input and its
+// signature, given as JSON body (FinalizeRequest) or as text body
+// 'SigningInput,Signature'
+func httpHandleV1Finalize(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for finalizing identity ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	finalizeReq := FinalizeRequest{}
+	if httpRequestJSON(r) {
+		if err = json.Unmarshal(body, &finalizeReq); err != nil {
+			httpLogf(r, "invalid json body: %v\n", err)
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+			return
+		}
+	} else if token := strings.Split(strings.TrimSpace(string(body)), ","); len(token) == 2 {
+		finalizeReq.SigningInput = token[0]
+		finalizeReq.Signature = token[1]
+	}
+	if len(finalizeReq.SigningInput) == 0 || len(finalizeReq.Signature) == 0 {
+		httpLogf(r, "missing signing input or signature\n")
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "missing signing input or signature")
+		return
+	}
+	identityVal, ret, err := secsipid.SJWTFinalizeIdentity(finalizeReq.SigningInput, finalizeReq.Signature, finalizeCert)
+	if err != nil {
+		httpLogf(r, "failed finalizing identity: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	httpLogf(r, "identity finalized\n")
+	httpWriteIdentity(w, r, identityVal, &IdentityResult{Identity: identityVal})
+}
+
+// secsipidxCLIFinalize - print the identity built from the signing input and
+// its signature
+func secsipidxCLIFinalize() int {
+	if len(finalizeCert) == 0 {
+		fmt.Printf("certificate of the signer not provided\n")
+		return cliExitArgs
+	}
+	if len(cliops.siginput) == 0 || len(cliops.signature) == 0 {
+		fmt.Printf("signing input or signature not provided\n")
+		return cliExitArgs
+	}
+	identityVal, ret, err := secsipid.SJWTFinalizeIdentity(cliops.siginput, cliops.signature, finalizeCert)
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	if ret = cliIdentitySizeCheck(identityVal); ret != 0 {
+		return ret
+	}
+	fmt.Printf("%s\n", identityVal)
+	return 0
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// probeMaxBody - the maximum size of the response body read by the probes
+const probeMaxBody = 64 * 1024
+
+// ProbeResult - the result of the last probe of a partner certificate
+// repository URL
+type ProbeResult struct {
+	URL      string `json:"url"`
+	OK       bool   `json:"ok"`
+	Code     int    `json:"code"`
+	Reason   string `json:"reason"`
+	Error    string `json:"error,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Expire   int64  `json:"expire,omitempty"`
+	Time     int64  `json:"time"`
+	Duration int64  `json:"duration"`
+	Failures int    `json:"failures"`
+}
+
+var (
+	probeMu      sync.Mutex
+	probeResults = map[string]*ProbeResult{}
+	probeURLs    []string
+)
+
+// probeCert - the first certificate of the response body, nil if it
+// does not have a PEM certificate
+func probeCert(body []byte) *x509.Certificate {
+	block, _ := pem.Decode(body)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil
+	}
+	certVal, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return certVal
+}
+
+// probeRun - fetch the URL without using the cache; a base URL is reachable
+// with any response not being a server error, a certificate URL must return
+// a certificate that is valid according to the -cert-verify options
+func probeRun(urlVal string) *ProbeResult {
+	start := time.Now()
+	result := &ProbeResult{URL: urlVal, Time: start.Unix()}
+	ret, err := func() (int, error) {
+		client := http.Client{Timeout: time.Duration(cliops.timeout) * time.Second}
+		resp, err := client.Get(urlVal)
+		if err != nil {
+			return secsipid.SJWTRetErrHTTPGet, fmt.Errorf("http get failure: %v", err)
+		}
+		defer resp.Body.Close()
+		result.Status = resp.StatusCode
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return secsipid.SJWTRetErrHTTPStatusCode, fmt.Errorf("http status error: %v", resp.StatusCode)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return secsipid.SJWTRetOK, nil
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, probeMaxBody))
+		if err != nil {
+			return secsipid.SJWTRetErrHTTPReadBody, fmt.Errorf("read http body failure: %v", err)
+		}
+		certVal := probeCert(body)
+		if certVal == nil {
+			return secsipid.SJWTRetOK, nil
+		}
+		result.Expire = certVal.NotAfter.Unix()
+		return secsipid.SJWTPubKeyVerify(body)
+	}()
+	result.Code, result.Reason = ret, secsipid.SJWTRetName(ret)
+	result.OK = err == nil && ret == secsipid.SJWTRetOK
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Duration = time.Since(start).Milliseconds()
+	return result
+}
+
+// probeStart - probe periodically the URLs of the partner certificate
+// repositories, in daemon mode
+func probeStart(urls []string, interval int) {
+	probeURLs = urls
+	go func() {
+		for {
+			for _, urlVal := range urls {
+				result := probeRun(urlVal)
+				probeMu.Lock()
+				last := probeResults[urlVal]
+				if !result.OK {
+					if last != nil {
+						result.Failures = last.Failures
+					}
+					result.Failures++
+					log.Printf("probe failed for %s (code: %d, error: %s)", urlVal, result.Code, result.Error)
+				} else if last != nil && !last.OK {
+					log.Printf("probe ok again for %s", urlVal)
+				}
+				probeResults[urlVal] = result
+				probeMu.Unlock()
+			}
+			time.Sleep(time.Duration(interval) * time.Second)
+		}
+	}()
+}
+
+// parseProbeURLs - the comma separated list of URLs
+func parseProbeURLs(val string) []string {
+	var urls []string
+	for _, urlVal := range strings.Split(val, ",") {
+		if urlVal = strings.TrimSpace(urlVal); len(urlVal) > 0 {
+			urls = append(urls, urlVal)
+		}
+	}
+	return urls
+}
+
+// probeSnapshot - the results of the last probes, in the order of the URLs,
+// without the ones not probed yet
+func probeSnapshot() []ProbeResult {
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	results := []ProbeResult{}
+	for _, urlVal := range probeURLs {
+		if result, ok := probeResults[urlVal]; ok {
+			results = append(results, *result)
+		}
+	}
+	return results
+}
+
+// httpHandleV1Probes - GET /v1/probes for the results of the last probes
+func httpHandleV1Probes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(probeSnapshot())
+}
+
+// probeWriteMetrics - the results of the last probes in the Prometheus text
+// format
+func probeWriteMetrics(w http.ResponseWriter) {
+	results := probeSnapshot()
+	if len(probeURLs) == 0 {
+		return
+	}
+	metrics := []struct {
+		Name  string
+		Help  string
+		Value func(result *ProbeResult) string
+	}{
+		{"secsipidx_probe_ok", "Result of the last probe of the certificate repository (1 - ok, 0 - failed).",
+			func(result *ProbeResult) string {
+				if result.OK {
+					return "1"
+				}
+				return "0"
+			}},
+		{"secsipidx_probe_duration_seconds", "Duration of the last probe of the certificate repository.",
+			func(result *ProbeResult) string { return fmt.Sprintf("%g", float64(result.Duration)/1000) }},
+		{"secsipidx_probe_failures", "Consecutive failures of the probes of the certificate repository.",
+			func(result *ProbeResult) string { return fmt.Sprint(result.Failures) }},
+		{"secsipidx_probe_cert_expiry_timestamp_seconds", "Expiry time of the certificate returned by the probe.",
+			func(result *ProbeResult) string { return fmt.Sprint(result.Expire) }},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.Name, m.Help, m.Name)
+		for i := range results {
+			if m.Name == "secsipidx_probe_cert_expiry_timestamp_seconds" && results[i].Expire == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%s{url=%q} %s\n", m.Name, results[i].URL, m.Value(&results[i]))
+		}
+	}
+}
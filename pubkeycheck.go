@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// PubKeyCheckRequest - JSON body of the check endpoint with inline public key
+type PubKeyCheckRequest struct {
+	Identity string `json:"identity"`
+	// Claims - the PASSporT claims for the identity in compact form
+	Claims json.RawMessage `json:"claims,omitempty"`
+	// PubKey - the public key or the certificate (PEM) to verify against
+	PubKey string `json:"pubkey"`
+}
+
+// httpHandleV1CheckPubKey - check the identity against the public key or the
+// certificate given in the request, without fetching the x5u (like -fpubkey
+// for the CLI), intended for lab testing; the result is not signed as verdict
+func httpHandleV1CheckPubKey(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for identity check with public key ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	checkReq := PubKeyCheckRequest{}
+	if err = json.Unmarshal(body, &checkReq); err != nil {
+		httpLogf(r, "invalid json body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+	if len(checkReq.PubKey) == 0 {
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "public key not provided")
+		return
+	}
+	identityVal, err := httpExpandIdentity(r, checkReq.Identity, checkReq.Claims)
+	if err != nil {
+		httpLogf(r, "invalid identity: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+
+	ret, err := secsipid.SJWTCheckFullIdentityPubKey(identityVal, cliops.expire, checkReq.PubKey)
+
+	if eventsEnabled() {
+		payload := identityPayload(identityVal)
+		srcAddr, dstAddr := httpRequestAddrs(r)
+		emitEvent(&EventRecord{Event: "check-pubkey", Code: ret, OrigTN: payload.Orig.TN, DestTN: strings.Join(payload.Dest.TN, ","),
+			OrigID: payload.OrigID, CallID: httpRequestCallID(r), ReqID: httpRequestID(r), Message: errorMessage(err)}, srcAddr, dstAddr)
+	}
+
+	if err != nil {
+		httpLogf(r, "failed checking identity with public key: (%d) %v\n", ret, err)
+		httpError(w, http.StatusInternalServerError, httpErrCheckFailed, ret, err.Error())
+		return
+	}
+	httpLogf(r, "valid identity with public key - return code: %d\n", ret)
+	httpWriteResult(w, r, "OK", &CheckResult{Result: "OK", Code: ret})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// quotaSaveInterval - the interval to save the changed counters to file
+const quotaSaveInterval = 10 * time.Second
+
+// QuotaCounter - the signing requests of a tenant in the current day and
+// month (UTC)
+type QuotaCounter struct {
+	Day     string `json:"day"`
+	Daily   int64  `json:"daily"`
+	Month   string `json:"month"`
+	Monthly int64  `json:"monthly"`
+}
+
+// QuotaStore - the quota counters per tenant, persisted to file
+type QuotaStore struct {
+	mu       sync.Mutex
+	filePath string
+	counters map[string]*QuotaCounter
+	dirty    bool
+}
+
+var quotaStore *QuotaStore = nil
+
+// NewQuotaStore - create the store, loading the counters from the file (if
+// the path is not empty and the file exists)
+func NewQuotaStore(filePath string) (*QuotaStore, error) {
+	qs := &QuotaStore{filePath: filePath, counters: map[string]*QuotaCounter{}}
+	if len(filePath) == 0 {
+		return qs, nil
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return qs, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &qs.counters); err != nil {
+		return nil, fmt.Errorf("invalid quota file: %v", err)
+	}
+	return qs, nil
+}
+
+// counter - the counter of the tenant, reset at the change of day or month
+func (qs *QuotaStore) counter(tenantID string, now time.Time) *QuotaCounter {
+	qc, ok := qs.counters[tenantID]
+	if !ok {
+		qc = &QuotaCounter{}
+		qs.counters[tenantID] = qc
+	}
+	if day := now.Format("2006-01-02"); qc.Day != day {
+		qc.Day, qc.Daily = day, 0
+	}
+	if month := now.Format("2006-01"); qc.Month != month {
+		qc.Month, qc.Monthly = month, 0
+	}
+	return qc
+}
+
+// exceeded - the seconds until the exceeded quota of the tenant is reset, 0
+// if the quotas are not exceeded
+func (qc *QuotaCounter) exceeded(tenant *Tenant, now time.Time) int64 {
+	if tenant.MonthlyQuota > 0 && qc.Monthly >= tenant.MonthlyQuota {
+		next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		return int64(next.Sub(now).Seconds()) + 1
+	}
+	if tenant.DailyQuota > 0 && qc.Daily >= tenant.DailyQuota {
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return int64(next.Sub(now).Seconds()) + 1
+	}
+	return 0
+}
+
+// Check - true if the tenant is within the quotas, otherwise return the
+// seconds until the exceeded quota is reset; nothing is counted
+func (qs *QuotaStore) Check(tenant *Tenant) (bool, int64) {
+	now := time.Now().UTC()
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if retryAfter := qs.counter(tenant.ID, now).exceeded(tenant, now); retryAfter > 0 {
+		return false, retryAfter
+	}
+	return true, 0
+}
+
+// Reserve - count the signing request of the tenant if it is within the
+// quotas, otherwise return the seconds until the exceeded quota is reset
+func (qs *QuotaStore) Reserve(tenant *Tenant) (bool, int64) {
+	now := time.Now().UTC()
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qc := qs.counter(tenant.ID, now)
+	if retryAfter := qc.exceeded(tenant, now); retryAfter > 0 {
+		return false, retryAfter
+	}
+	qc.Daily++
+	qc.Monthly++
+	qs.dirty = true
+	return true, 0
+}
+
+// Release - discount the reserved request of the tenant, which failed
+func (qs *QuotaStore) Release(tenant *Tenant) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qc := qs.counter(tenant.ID, time.Now().UTC())
+	if qc.Daily > 0 {
+		qc.Daily--
+	}
+	if qc.Monthly > 0 {
+		qc.Monthly--
+	}
+	qs.dirty = true
+}
+
+// Save - write the counters to the file, if they were changed
+func (qs *QuotaStore) Save() error {
+	qs.mu.Lock()
+	if !qs.dirty || len(qs.filePath) == 0 {
+		qs.mu.Unlock()
+		return nil
+	}
+	data, _ := json.MarshalIndent(qs.counters, "", "  ")
+	qs.dirty = false
+	qs.mu.Unlock()
+
+	// written to a temporary file first, to not corrupt the counters on crash
+	tmpPath := qs.filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, qs.filePath)
+}
+
+// Snapshot - a copy of the counters, by tenant id
+func (qs *QuotaStore) Snapshot() map[string]QuotaCounter {
+	now := time.Now().UTC()
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	out := make(map[string]QuotaCounter, len(qs.counters))
+	for tenantID := range qs.counters {
+		out[tenantID] = *qs.counter(tenantID, now)
+	}
+	return out
+}
+
+// quotaInit - create the quota store if any tenant has a quota, saving the
+// counters periodically
+func quotaInit() error {
+	if tenants == nil {
+		return nil
+	}
+	for _, tenant := range tenants.Tenants {
+		if tenant.DailyQuota > 0 || tenant.MonthlyQuota > 0 {
+			var err error
+			if quotaStore, err = NewQuotaStore(cliops.quotafile); err != nil {
+				return err
+			}
+			go func() {
+				for range time.Tick(quotaSaveInterval) {
+					quotaSave()
+				}
+			}()
+			return nil
+		}
+	}
+	return nil
+}
+
+// quotaSave - save the quota counters, if enabled
+func quotaSave() {
+	if quotaStore == nil {
+		return
+	}
+	if err := quotaStore.Save(); err != nil {
+		log.Printf("failed to save the quota counters: %v", err)
+	}
+}
+
+// quotaLimited - true if the signing operations of the tenant are counted
+// for its quotas
+func quotaLimited(tenant *Tenant) bool {
+	return quotaStore != nil && tenant != nil && (tenant.DailyQuota > 0 || tenant.MonthlyQuota > 0)
+}
+
+// httpQuotaExceeded - reply with status 429 to the signing request of the
+// tenant that exceeded its quota
+func httpQuotaExceeded(w http.ResponseWriter, r *http.Request, tenant *Tenant, retryAfter int64) {
+	httpLogf(r, "quota exceeded for tenant: %s\n", tenant.ID)
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	httpError(w, http.StatusTooManyRequests, httpErrQuota, secsipid.SJWTRetErr, "quota exceeded")
+}
+
+// httpQuotaHandler - reject with status 429 the signing requests of the
+// tenants that exceeded their quota, the failed requests are not counted
+func httpQuotaHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenant := httpTenant(r)
+		if !quotaLimited(tenant) || r.Method == "OPTIONS" {
+			h(w, r)
+			return
+		}
+		ok, retryAfter := quotaStore.Reserve(tenant)
+		if !ok {
+			httpQuotaExceeded(w, r, tenant, retryAfter)
+			return
+		}
+		sw := &httpStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r)
+		if sw.status < 200 || sw.status >= 300 {
+			quotaStore.Release(tenant)
+		}
+	}
+}
+
+// quotaWriteMetrics - the quota usage per tenant in the Prometheus text format
+func quotaWriteMetrics(w http.ResponseWriter) {
+	if quotaStore == nil {
+		return
+	}
+	counters := quotaStore.Snapshot()
+	ids := make([]string, 0, len(counters))
+	for tenantID := range counters {
+		ids = append(ids, tenantID)
+	}
+	sort.Strings(ids)
+	fmt.Fprintf(w, "# HELP secsipidx_quota_used Signing requests counted for the quota per tenant and period.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_quota_used gauge\n")
+	for _, tenantID := range ids {
+		fmt.Fprintf(w, "secsipidx_quota_used{tenant=%q,period=\"daily\"} %d\n", tenantID, counters[tenantID].Daily)
+		fmt.Fprintf(w, "secsipidx_quota_used{tenant=%q,period=\"monthly\"} %d\n", tenantID, counters[tenantID].Monthly)
+	}
+}
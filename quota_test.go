@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// testQuotaStore - set the quota store of the daemon, restored at the end of
+// the test
+func testQuotaStore(t *testing.T) *QuotaStore {
+	saved := quotaStore
+	t.Cleanup(func() { quotaStore = saved })
+	quotaStore, _ = NewQuotaStore("")
+	return quotaStore
+}
+
+func TestQuotaStore(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		tenant   Tenant
+		reserved int
+		released int
+		allowed  int
+	}{
+		{"daily quota", Tenant{ID: "t", DailyQuota: 3}, 0, 0, 3},
+		{"monthly quota lower than daily", Tenant{ID: "t", DailyQuota: 5, MonthlyQuota: 2}, 0, 0, 2},
+		{"daily quota partly used", Tenant{ID: "t", DailyQuota: 3}, 2, 0, 1},
+		{"daily quota with released requests", Tenant{ID: "t", DailyQuota: 3}, 3, 2, 2},
+		{"release without reserve", Tenant{ID: "t", DailyQuota: 3}, 0, 2, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			qs, _ := NewQuotaStore("")
+			for i := 0; i < tc.reserved; i++ {
+				qs.Reserve(&tc.tenant)
+			}
+			for i := 0; i < tc.released; i++ {
+				qs.Release(&tc.tenant)
+			}
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				if ok, _ := qs.Reserve(&tc.tenant); ok {
+					allowed++
+				}
+			}
+			expect(allowed).ToBe(tc.allowed)
+			ok, retryAfter := qs.Check(&tc.tenant)
+			expect(ok).ToBe(false)
+			expect(retryAfter > 0).ToBe(true)
+		})
+	}
+
+	t.Run("Counters reset at change of day and month", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		qs, _ := NewQuotaStore("")
+		qs.counters["t"] = &QuotaCounter{Day: "2026-01-31", Daily: 7, Month: "2026-01", Monthly: 70}
+		qc := qs.counter("t", time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC))
+		expect(qc.Daily).ToBe(int64(7))
+		qc = qs.counter("t", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC))
+		expect(*qc).ToEqual(QuotaCounter{Day: "2026-02-01", Daily: 0, Month: "2026-02", Monthly: 0})
+	})
+
+	t.Run("Retry after until end of day or month", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		now := time.Date(2026, 1, 31, 23, 59, 0, 0, time.UTC)
+		qc := &QuotaCounter{Daily: 1, Monthly: 1}
+		expect(qc.exceeded(&Tenant{DailyQuota: 1}, now)).ToBe(int64(61))
+		expect(qc.exceeded(&Tenant{MonthlyQuota: 1}, now)).ToBe(int64(61))
+		expect(qc.exceeded(&Tenant{DailyQuota: 2, MonthlyQuota: 2}, now)).ToBe(int64(0))
+	})
+
+	t.Run("Counters kept across restarts", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		filePath := filepath.Join(t.TempDir(), "quota.json")
+		tenant := &Tenant{ID: "t", DailyQuota: 2}
+		qs, _ := NewQuotaStore(filePath)
+		qs.Reserve(tenant)
+		expect(qs.Save()).ToBe(nil)
+
+		qs, err := NewQuotaStore(filePath)
+		expect(err).ToBe(nil)
+		ok, _ := qs.Reserve(tenant)
+		expect(ok).ToBe(true)
+		ok, _ = qs.Reserve(tenant)
+		expect(ok).ToBe(false)
+	})
+
+	t.Run("Error with invalid quota file", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		filePath := filepath.Join(t.TempDir(), "quota.json")
+		os.WriteFile(filePath, []byte("{"), 0600)
+		_, err := NewQuotaStore(filePath)
+		expect(err == nil).ToBe(false)
+	})
+}
+
+func TestHTTPQuotaHandler(t *testing.T) {
+	testTenants(t, Tenant{ID: "limited", DailyQuota: 1}, Tenant{ID: "unlimited"})
+	qs := testQuotaStore(t)
+	status := http.StatusOK
+	handler := httpQuotaHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	request := func(tenantID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/v1/sign-csv", nil)
+		r.Header.Set("X-Tenant-ID", tenantID)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	t.Run("Failed request not counted", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		status = http.StatusBadRequest
+		expect(request("limited").Code).ToBe(http.StatusBadRequest)
+		expect(qs.Snapshot()["limited"].Daily).ToBe(int64(0))
+	})
+
+	t.Run("Rejected over the quota", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		status = http.StatusOK
+		expect(request("limited").Code).ToBe(http.StatusOK)
+		w := request("limited")
+		expect(w.Code).ToBe(http.StatusTooManyRequests)
+		expect(len(w.Header().Get("Retry-After")) > 0).ToBe(true)
+	})
+
+	t.Run("OK without quota", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		for i := 0; i < 3; i++ {
+			expect(request("unlimited").Code).ToBe(http.StatusOK)
+		}
+	})
+}
+
+func TestJobQuota(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	prvBytes, _ := x509.MarshalECPrivateKey(key)
+	prvkeyPath := filepath.Join(t.TempDir(), "prvkey.pem")
+	os.WriteFile(prvkeyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes}), 0600)
+	fprvkey := cliops.fprvkey
+	cliops.fprvkey = prvkeyPath
+	defer func() { cliops.fprvkey = fprvkey }()
+
+	testTenants(t, Tenant{ID: "limited", DailyQuota: 2})
+	tenant := tenants.byID["limited"]
+	qs := testQuotaStore(t)
+	item := func(signReq SignRequest) json.RawMessage {
+		data, _ := json.Marshal(signReq)
+		return data
+	}
+	valid := item(SignRequest{OrigTN: "493011111111", DestTN: "493022222222", Attest: "A", X5u: "https://certs.example.com/cert.pem"})
+
+	t.Run("Failed item not counted", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		result := jobProcessItem("sign", item(SignRequest{OrigTN: "493011111111", DestTN: "493022222222", Attest: "A",
+			Mky: "invalid"}), &SignAttrs{}, tenant, 0)
+		expect(result.Code).NotToBe(secsipid.SJWTRetOK)
+		expect(qs.Snapshot()["limited"].Daily).ToBe(int64(0))
+	})
+
+	t.Run("Items counted until the quota", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		var codes []int
+		var errors []string
+		for i := 0; i < 3; i++ {
+			result := jobProcessItem("sign", valid, &SignAttrs{}, tenant, i)
+			codes, errors = append(codes, result.Code), append(errors, result.Error)
+		}
+		expect(codes).ToEqual([]int{secsipid.SJWTRetOK, secsipid.SJWTRetOK, secsipid.SJWTRetErr})
+		expect(errors).ToEqual([]string{"", "", "quota exceeded"})
+		expect(qs.Snapshot()["limited"].Daily).ToBe(int64(2))
+	})
+
+	t.Run("Check items not counted", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		result := jobProcessItem("check", json.RawMessage(`"invalid"`), &SignAttrs{}, tenant, 0)
+		expect(result.Error == "quota exceeded").ToBe(false)
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// TokenBucket - the signing operations allowed per second (rate) and at once
+// (burst), the tokens going below zero for the operations delayed until they
+// are refilled
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket - create the bucket full, the burst being at least 1
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// delay - the time until a token is available, after refilling the bucket
+func (tb *TokenBucket) delay(now time.Time) time.Duration {
+	if elapsed := now.Sub(tb.last).Seconds(); elapsed > 0 {
+		tb.tokens = math.Min(tb.burst, tb.tokens+elapsed*tb.rate)
+		tb.last = now
+	}
+	if tb.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// SignRateLimiter - the token buckets of the signing operations, the global
+// one and the ones of the keyring keys (the signing profiles)
+type SignRateLimiter struct {
+	mu      sync.Mutex
+	global  *TokenBucket
+	keys    map[string]*TokenBucket
+	maxWait time.Duration
+
+	delayed  map[string]uint64
+	rejected map[string]uint64
+}
+
+var signRateLimiter *SignRateLimiter = nil
+
+// Reserve - take a token from the global bucket and from the one of the key,
+// returning the time to wait before signing, or false if it is longer than
+// maxWait (no token is taken then)
+func (sl *SignRateLimiter) Reserve(keyName string, maxWait time.Duration) (bool, time.Duration) {
+	return sl.reserve(keyName, maxWait, time.Now())
+}
+
+// buckets - the global bucket and the one of the key, if they are set
+func (sl *SignRateLimiter) buckets(keyName string) []*TokenBucket {
+	buckets := make([]*TokenBucket, 0, 2)
+	if sl.global != nil {
+		buckets = append(buckets, sl.global)
+	}
+	if tb, ok := sl.keys[keyName]; ok {
+		buckets = append(buckets, tb)
+	}
+	return buckets
+}
+
+// reserve - Reserve() at the given time
+func (sl *SignRateLimiter) reserve(keyName string, maxWait time.Duration, now time.Time) (bool, time.Duration) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	buckets := sl.buckets(keyName)
+	wait := time.Duration(0)
+	for _, tb := range buckets {
+		if d := tb.delay(now); d > wait {
+			wait = d
+		}
+	}
+	if maxWait >= 0 && wait > maxWait {
+		sl.rejected[keyName]++
+		return false, wait
+	}
+	for _, tb := range buckets {
+		tb.tokens--
+	}
+	if wait > 0 {
+		sl.delayed[keyName]++
+	}
+	return true, wait
+}
+
+// Cancel - return the tokens taken by the reservation for the key, for the
+// operation that is not done (e.g., the client went away while waiting)
+func (sl *SignRateLimiter) Cancel(keyName string) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	for _, tb := range sl.buckets(keyName) {
+		tb.tokens = math.Min(tb.burst, tb.tokens+1)
+	}
+}
+
+// signRateInit - create the limiter of the signing operations if -sign-rate
+// or the rate of any keyring key is set
+func signRateInit() error {
+	if cliops.signrate < 0 || cliops.signburst < 0 || cliops.signwait < 0 {
+		return fmt.Errorf("invalid signing rate: negative value")
+	}
+	sl := &SignRateLimiter{keys: map[string]*TokenBucket{}, maxWait: time.Duration(cliops.signwait) * time.Millisecond,
+		delayed: map[string]uint64{}, rejected: map[string]uint64{}}
+	if cliops.signrate > 0 {
+		sl.global = NewTokenBucket(cliops.signrate, cliops.signburst)
+	}
+	if keyring != nil {
+		for _, key := range keyring.Keys {
+			if key.Rate > 0 {
+				sl.keys[key.Name] = NewTokenBucket(key.Rate, key.Burst)
+			}
+		}
+	}
+	if sl.global != nil || len(sl.keys) > 0 {
+		signRateLimiter = sl
+	}
+	return nil
+}
+
+// signRateKeyName - the name of the keyring key used for signing with the
+// name given in the request (empty if there is no keyring or no valid key)
+func signRateKeyName(name string) string {
+	if keyring == nil {
+		return ""
+	}
+	key, err := keyring.Select(name, time.Now())
+	if err != nil {
+		return ""
+	}
+	return key.Name
+}
+
+// signRateWait - wait for the signing rate of the key to allow one more
+// operation, used by the batch jobs which are not rejected
+func signRateWait(keyName string) {
+	if signRateLimiter == nil {
+		return
+	}
+	if _, wait := signRateLimiter.Reserve(signRateKeyName(keyName), -1); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// httpSignRateHandler - delay the signing requests over the rate by up to
+// -sign-max-wait and reject with status 429 the ones needing to wait longer;
+// the rate of the keyring key is applied if keyed is true and the tokens of
+// the requests cancelled while waiting are returned
+func httpSignRateHandler(keyed bool, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if signRateLimiter == nil || r.Method == "OPTIONS" {
+			h(w, r)
+			return
+		}
+		keyName := ""
+		if keyed {
+			keyName = signRateKeyName(httpSignKeyName(r))
+		}
+		ok, wait := signRateLimiter.Reserve(keyName, signRateLimiter.maxWait)
+		if !ok {
+			httpLogf(r, "signing rate exceeded for key: %s\n", keyName)
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+			httpError(w, http.StatusTooManyRequests, httpErrRateLimited, secsipid.SJWTRetErr, "signing rate exceeded")
+			return
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				signRateLimiter.Cancel(keyName)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// signRateWriteMetrics - the signing operations delayed and rejected over the
+// rate, per keyring key, in the Prometheus text format
+func signRateWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	if signRateLimiter == nil {
+		return
+	}
+	signRateLimiter.mu.Lock()
+	defer signRateLimiter.mu.Unlock()
+	for _, counter := range []struct {
+		family string
+		help   string
+		values map[string]uint64
+	}{
+		{"secsipidx_sign_rate_delayed_total", "Signing operations delayed by the signing rate.", signRateLimiter.delayed},
+		{"secsipidx_sign_rate_rejected_total", "Signing requests rejected over the signing rate.", signRateLimiter.rejected},
+	} {
+		family := counter.family
+		if openMetrics {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, counter.help, family)
+		keyNames := make([]string, 0, len(counter.values))
+		for keyName := range counter.values {
+			keyNames = append(keyNames, keyName)
+		}
+		sort.Strings(keyNames)
+		for _, keyName := range keyNames {
+			fmt.Fprintf(w, "%s{key=%q} %d\n", counter.family, keyName, counter.values[keyName])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gomagedon/expectate"
+)
+
+// testSignRateLimiter - limiter with the global bucket and the one of the key
+// "a", all full at t0
+func testSignRateLimiter(t0 time.Time, rate float64, burst int, keyRate float64, keyBurst int) *SignRateLimiter {
+	sl := &SignRateLimiter{global: NewTokenBucket(rate, burst), keys: map[string]*TokenBucket{"a": NewTokenBucket(keyRate, keyBurst)},
+		delayed: map[string]uint64{}, rejected: map[string]uint64{}}
+	sl.global.last, sl.keys["a"].last = t0, t0
+	return sl
+}
+
+func TestTokenBucket(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rate  float64
+		burst int
+		want  float64
+	}{
+		{"burst given", 10, 4, 4},
+		{"burst of rate rounded up", 2.5, 0, 3},
+		{"burst at least one", 0.2, 0, 1},
+	} {
+		t.Run("New with "+tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			tb := NewTokenBucket(tc.rate, tc.burst)
+			expect(tb.burst).ToBe(tc.want)
+			expect(tb.tokens).ToBe(tc.want)
+		})
+	}
+
+	t0 := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		delay   time.Duration
+		after   float64
+	}{
+		{"full bucket", 2, 0, 0, 2},
+		{"refill capped at burst", 1, 10 * time.Second, 0, 2},
+		{"refill of half token", 0, 250 * time.Millisecond, 250 * time.Millisecond, 0.5},
+		{"empty bucket", 0, 0, 500 * time.Millisecond, 0},
+		{"negative tokens", -1.5, 0, 1250 * time.Millisecond, -1.5},
+		{"negative tokens partly refilled", -1, 500 * time.Millisecond, 500 * time.Millisecond, 0},
+		{"clock going back", 0, -time.Second, 500 * time.Millisecond, 0},
+	} {
+		t.Run("Delay with "+tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			tb := &TokenBucket{rate: 2, burst: 2, tokens: tc.tokens, last: t0}
+			expect(tb.delay(t0.Add(tc.elapsed))).ToBe(tc.delay)
+			expect(tb.tokens).ToBe(tc.after)
+		})
+	}
+}
+
+func TestSignRateLimiter(t *testing.T) {
+	t0 := time.Unix(1700000000, 0)
+
+	t.Run("Burst then delayed at the rate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		sl := testSignRateLimiter(t0, 2, 2, 100, 100)
+		var waits []time.Duration
+		for i := 0; i < 4; i++ {
+			_, wait := sl.reserve("a", -1, t0)
+			waits = append(waits, wait)
+		}
+		expect(waits).ToEqual([]time.Duration{0, 0, 500 * time.Millisecond, time.Second})
+		expect(sl.delayed["a"]).ToBe(uint64(2))
+	})
+
+	t.Run("Longest wait of the global and key buckets", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		sl := testSignRateLimiter(t0, 100, 100, 1, 1)
+		sl.reserve("a", -1, t0)
+		_, wait := sl.reserve("a", -1, t0)
+		expect(wait).ToBe(time.Second)
+		_, wait = sl.reserve("b", -1, t0)
+		expect(wait).ToBe(time.Duration(0))
+	})
+
+	t.Run("Rejected over max wait without taking tokens", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		sl := testSignRateLimiter(t0, 1, 1, 100, 100)
+		sl.reserve("a", time.Second, t0)
+		ok, wait := sl.reserve("a", 500*time.Millisecond, t0)
+		expect(ok).ToBe(false)
+		expect(wait).ToBe(time.Second)
+		expect(sl.global.tokens).ToBe(float64(0))
+		expect(sl.rejected["a"]).ToBe(uint64(1))
+		ok, _ = sl.reserve("a", time.Second, t0)
+		expect(ok).ToBe(true)
+	})
+
+	t.Run("Cancel returns the tokens up to burst", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		sl := testSignRateLimiter(t0, 1, 1, 1, 2)
+		sl.reserve("a", -1, t0)
+		sl.reserve("a", -1, t0)
+		expect(sl.global.tokens).ToBe(float64(-1))
+		sl.Cancel("a")
+		expect(sl.global.tokens).ToBe(float64(0))
+		expect(sl.keys["a"].tokens).ToBe(float64(1))
+		sl.Cancel("a")
+		sl.Cancel("a")
+		expect(sl.global.tokens).ToBe(float64(1))
+		expect(sl.keys["a"].tokens).ToBe(float64(2))
+	})
+}
+
+func TestHTTPSignRateHandler(t *testing.T) {
+	saved := signRateLimiter
+	defer func() { signRateLimiter = saved }()
+	signRateLimiter = &SignRateLimiter{global: NewTokenBucket(0.1, 1), keys: map[string]*TokenBucket{},
+		maxWait: time.Minute, delayed: map[string]uint64{}, rejected: map[string]uint64{}}
+	called := 0
+	handler := httpSignRateHandler(false, func(w http.ResponseWriter, r *http.Request) {
+		called++
+	})
+
+	t.Run("Tokens returned for the cancelled request", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/resign", nil))
+		expect(called).ToBe(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/resign", nil).WithContext(ctx))
+		expect(called).ToBe(1)
+		// only the refill of the waiting time is in the bucket
+		expect(signRateLimiter.global.tokens < 0.1).ToBe(true)
+		expect(signRateLimiter.global.tokens >= 0).ToBe(true)
+	})
+
+	t.Run("Rejected over max wait", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		signRateLimiter.maxWait = 0
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", "/v1/resign", nil))
+		expect(w.Code).ToBe(http.StatusTooManyRequests)
+		expect(w.Header().Get("Retry-After")).ToBe("10")
+		expect(called).ToBe(1)
+	})
+}
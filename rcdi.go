@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// RcdiRequest - body of the request to compute or verify rcdi digest
+type RcdiRequest struct {
+	Src    string `json:"src"`
+	Alg    string `json:"alg,omitempty"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// RcdiResponse - the computed digest and, if a digest was provided, the verification result
+type RcdiResponse struct {
+	Src    string `json:"src"`
+	Digest string `json:"digest"`
+	Valid  *bool  `json:"valid,omitempty"`
+}
+
+// rcdiCompute - fetch the resource and compute its digest, verifying it
+// against the expected digest if provided
+func rcdiCompute(req *RcdiRequest) (*RcdiResponse, int, error) {
+	data, ret, err := secsipid.SJWTRcdiResource(req.Src, cliops.timeout)
+	if err != nil {
+		return nil, ret, err
+	}
+	alg := req.Alg
+	if len(req.Digest) > 0 {
+		alg = strings.SplitN(req.Digest, "-", 2)[0]
+	}
+	digest, ret, err := secsipid.SJWTRcdiDigest(data, alg)
+	if err != nil {
+		return nil, ret, err
+	}
+	resp := &RcdiResponse{Src: req.Src, Digest: digest}
+	if len(req.Digest) > 0 {
+		valid := (digest == req.Digest)
+		resp.Valid = &valid
+		if !valid {
+			return resp, secsipid.SJWTRetErrJSONPayloadRcdi, fmt.Errorf("rcdi digest mismatch")
+		}
+	}
+	return resp, secsipid.SJWTRetOK, nil
+}
+
+func secsipidxCLIRcdi() int {
+	if len(cliops.rcdisrc) == 0 {
+		fmt.Printf("rcd resource not provided\n")
+		return cliExitArgs
+	}
+	resp, ret, err := rcdiCompute(&RcdiRequest{Src: cliops.rcdisrc, Alg: cliops.rcdialg, Digest: cliops.rcdidigest})
+	if resp != nil {
+		fmt.Printf("%s\n", resp.Digest)
+	}
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+	}
+	return ret
+}
+
+func httpHandleV1Rcdi(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for rcdi digest ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	rcdiReq := RcdiRequest{}
+	if err = json.Unmarshal(body, &rcdiReq); err != nil ||
+		(!strings.HasPrefix(rcdiReq.Src, "http://") && !strings.HasPrefix(rcdiReq.Src, "https://")) {
+		httpLogf(r, "invalid rcdi request body\n")
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+		return
+	}
+
+	resp, ret, err := rcdiCompute(&rcdiReq)
+	if resp == nil {
+		httpLogf(r, "failed computing rcdi digest: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, ret, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// ReplayBundle - the inputs of a failed verification (the identity, the
+// certificate and the library options), recorded to reproduce it offline
+type ReplayBundle struct {
+	Time     int64                  `json:"time"`
+	Source   string                 `json:"source"`
+	Identity string                 `json:"identity"`
+	Cert     string                 `json:"cert,omitempty"`
+	CACerts  string                 `json:"cacerts,omitempty"`
+	Expire   int                    `json:"expire"`
+	Options  map[string]interface{} `json:"options"`
+	Code     int                    `json:"code"`
+	Message  string                 `json:"message,omitempty"`
+}
+
+// recordQueueSize - the number of bundles waiting to be written for the
+// HTTP requests, the new bundles are dropped when it is full
+const recordQueueSize = 64
+
+var (
+	recordMu         sync.Mutex
+	recordCount      = -1
+	recordOnce       sync.Once
+	recordQueue      chan *ReplayBundle
+	recordFullLogged bool
+)
+
+// recordBundle - the bundle of the failed verification, nil if the recording
+// is not enabled or the verification was successful
+func recordBundle(source string, identityVal string, info *secsipid.SJWTCheckInfo, ret int, err error) *ReplayBundle {
+	if len(cliops.recorddir) == 0 || ret == secsipid.SJWTRetOK {
+		return nil
+	}
+	bundle := &ReplayBundle{Time: time.Now().Unix(), Source: source, Identity: identityVal,
+		Expire: cliops.expire, Options: secsipid.SJWTLibOptGetAll(), Code: ret, Message: errorMessage(err)}
+	if info != nil {
+		bundle.Cert = string(info.Cert)
+	}
+	return bundle
+}
+
+// recordWrite - write the bundle to the directory given by -record-dir, with
+// the content of the CA file, unless there are already -record-max bundles
+func recordWrite(bundle *ReplayBundle) {
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if recordCount < 0 {
+		files, _ := filepath.Glob(filepath.Join(cliops.recorddir, "*.json"))
+		recordCount = len(files)
+	}
+	if cliops.recordmax > 0 && recordCount >= cliops.recordmax {
+		if !recordFullLogged {
+			log.Printf("maximum number of verification bundles reached (%d), not recording", cliops.recordmax)
+			recordFullLogged = true
+		}
+		return
+	}
+	if caFile := secsipid.SJWTLibOptGetS("CertCAFile"); len(caFile) > 0 {
+		caCerts, _ := ioutil.ReadFile(caFile)
+		bundle.CACerts = string(caCerts)
+	}
+	data, _ := json.MarshalIndent(bundle, "", "  ")
+	bundlePath := filepath.Join(cliops.recorddir,
+		strconv.FormatInt(time.Now().UnixNano(), 10)+"-"+strconv.Itoa(-bundle.Code)+".json")
+	if err := ioutil.WriteFile(bundlePath, data, 0600); err != nil {
+		log.Printf("failed to record the verification bundle: %v", err)
+		return
+	}
+	recordCount++
+}
+
+// recordFailure - write the bundle of the failed verification to the
+// directory given by -record-dir, if it is set, with the certificate the
+// identity was checked with (none if the check failed before getting it)
+func recordFailure(source string, identityVal string, info *secsipid.SJWTCheckInfo, ret int, err error) {
+	if bundle := recordBundle(source, identityVal, info, ret, err); bundle != nil {
+		recordWrite(bundle)
+	}
+}
+
+// recordFailureQueue - like recordFailure(), but the bundle is written in
+// background, being dropped if too many are waiting
+func recordFailureQueue(source string, identityVal string, info *secsipid.SJWTCheckInfo, ret int, err error) {
+	bundle := recordBundle(source, identityVal, info, ret, err)
+	if bundle == nil {
+		return
+	}
+	recordOnce.Do(func() {
+		recordQueue = make(chan *ReplayBundle, recordQueueSize)
+		go func() {
+			for bundle := range recordQueue {
+				recordWrite(bundle)
+			}
+		}()
+	})
+	select {
+	case recordQueue <- bundle:
+	default:
+	}
+}
+
+// secsipidxCLIReplay - verify again the identity of the recorded bundle, with
+// its certificate and library options, at the time of the recording
+func secsipidxCLIReplay() int {
+	data, err := ioutil.ReadFile(cliops.replay)
+	if err != nil {
+		fmt.Printf("failed to read the bundle: %v\n", err)
+		return -1
+	}
+	bundle := &ReplayBundle{}
+	if err = json.Unmarshal(data, bundle); err != nil {
+		fmt.Printf("invalid bundle: %v\n", err)
+		return -1
+	}
+
+	for name, value := range bundle.Options {
+		if name == "CertCAFile" || name == "CacheDirPath" {
+			continue
+		}
+		if secsipid.SJWTLibOptSetV(fmt.Sprintf("%s=%v", name, value)) != secsipid.SJWTRetOK && cliops.verbosity > 0 {
+			fmt.Printf("unable to set the option %s to %v\n", name, value)
+		}
+	}
+	if len(bundle.CACerts) > 0 {
+		caFile, err := ioutil.TempFile("", "secsipidx-replay-ca")
+		if err != nil {
+			fmt.Printf("failed to write the CA certificates: %v\n", err)
+			return -1
+		}
+		defer os.Remove(caFile.Name())
+		caFile.WriteString(bundle.CACerts)
+		caFile.Close()
+		secsipid.SJWTLibOptSetS("CertCAFile", caFile.Name())
+	}
+	// the clock is moved back to the time of the recording
+	secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{ClockSkew: int(bundle.Time - time.Now().Unix())})
+
+	fmt.Printf("recorded: %s (%d) %s\n", time.Unix(bundle.Time, 0).UTC().Format(time.RFC3339), bundle.Code, bundle.Message)
+	var ret int
+	if len(bundle.Cert) > 0 {
+		ret, err = secsipid.SJWTCheckFullIdentityPubKey(bundle.Identity, bundle.Expire, bundle.Cert)
+	} else {
+		fmt.Printf("no certificate in the bundle, fetching it\n")
+		ret, err = secsipid.SJWTCheckFullIdentity(bundle.Identity, bundle.Expire, "", cliops.timeout)
+	}
+	fmt.Printf("replayed: (%d) %s\n", ret, errorMessage(err))
+	return ret
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestRecordFailure(t *testing.T) {
+	recorddir, recordmax := cliops.recorddir, cliops.recordmax
+	defer func() {
+		cliops.recorddir, cliops.recordmax = recorddir, recordmax
+		recordCount, recordFullLogged = -1, false
+	}()
+
+	for _, tc := range []struct {
+		name      string
+		recordmax int
+		failures  int
+		bundles   int
+	}{
+		{"bundles up to the maximum", 2, 3, 2},
+		{"bundles without maximum", 0, 3, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			cliops.recorddir, cliops.recordmax = t.TempDir(), tc.recordmax
+			recordCount, recordFullLogged = -1, false
+			recordFailure("cli", "a.b.c", nil, secsipid.SJWTRetOK, nil)
+			for i := 0; i < tc.failures; i++ {
+				recordFailure("cli", "a.b.c", nil, secsipid.SJWTRetErrCertInvalid, errors.New("invalid certificate"))
+			}
+			files, _ := filepath.Glob(filepath.Join(cliops.recorddir, "*.json"))
+			expect(len(files)).ToBe(tc.bundles)
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// ReportCounts - the numbers of checked identities, with the failures by
+// return code and the calls without identity classified as not validated
+type ReportCounts struct {
+	Total        int            `json:"total"`
+	Valid        int            `json:"valid"`
+	Failed       int            `json:"failed"`
+	NoValidation int            `json:"novalidation"`
+	Reasons      map[string]int `json:"reasons,omitempty"`
+}
+
+func (c *ReportCounts) add(item *ReportItem) {
+	c.Total++
+	if item.Code == secsipid.SJWTRetOK {
+		c.Valid++
+		return
+	}
+	if item.NoTN {
+		c.NoValidation++
+		return
+	}
+	c.Failed++
+	if c.Reasons == nil {
+		c.Reasons = map[string]int{}
+	}
+	c.Reasons[strconv.Itoa(item.Code)]++
+}
+
+// ReportBucket - the counts for a time interval, starting at Start
+type ReportBucket struct {
+	Start string `json:"start"`
+	ReportCounts
+}
+
+// ReportSummary - the summary of the checked identities, by service provider
+// code of the certificate, by attestation level and by time interval
+type ReportSummary struct {
+	From     string                   `json:"from,omitempty"`
+	To       string                   `json:"to,omitempty"`
+	Bucket   int                      `json:"bucket"`
+	Totals   ReportCounts             `json:"totals"`
+	BySPC    map[string]*ReportCounts `json:"byspc"`
+	ByAttest map[string]*ReportCounts `json:"byattest"`
+	Buckets  []*ReportBucket          `json:"buckets"`
+}
+
+// ReportItem - the result of checking an identity, for the summary, with the
+// service provider code of the certificate it was checked with
+type ReportItem struct {
+	Time     time.Time
+	Identity string
+	Code     int
+	NoTN     bool
+	SPC      string
+}
+
+// reportSummarize - count the results
+func reportSummarize(items []*ReportItem, bucket int) *ReportSummary {
+	summary := &ReportSummary{Bucket: bucket, BySPC: map[string]*ReportCounts{},
+		ByAttest: map[string]*ReportCounts{}, Buckets: []*ReportBucket{}}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Time.Before(items[j].Time) })
+	buckets := map[int64]*ReportBucket{}
+	for _, item := range items {
+		summary.Totals.add(item)
+		spc := item.SPC
+		if len(spc) == 0 {
+			spc = "unknown"
+		}
+		if summary.BySPC[spc] == nil {
+			summary.BySPC[spc] = &ReportCounts{}
+		}
+		summary.BySPC[spc].add(item)
+		attest := identityPayload(item.Identity).ATTest
+		if len(attest) == 0 {
+			attest = "unknown"
+		}
+		if summary.ByAttest[attest] == nil {
+			summary.ByAttest[attest] = &ReportCounts{}
+		}
+		summary.ByAttest[attest].add(item)
+		if item.Time.IsZero() {
+			continue
+		}
+		start := item.Time.Unix() - item.Time.Unix()%int64(bucket)
+		b, ok := buckets[start]
+		if !ok {
+			b = &ReportBucket{Start: time.Unix(start, 0).UTC().Format(time.RFC3339)}
+			buckets[start] = b
+			summary.Buckets = append(summary.Buckets, b)
+		}
+		b.add(item)
+		if len(summary.From) == 0 {
+			summary.From = item.Time.UTC().Format(time.RFC3339)
+		}
+		summary.To = item.Time.UTC().Format(time.RFC3339)
+	}
+	return summary
+}
+
+// reportReasons - the failure reasons as 'code=count' items separated by
+// space, sorted by code
+func reportReasons(reasons map[string]int) string {
+	codes := make([]string, 0, len(reasons))
+	for code := range reasons {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	items := make([]string, 0, len(codes))
+	for _, code := range codes {
+		items = append(items, fmt.Sprintf("%s=%d", code, reasons[code]))
+	}
+	return strings.Join(items, " ")
+}
+
+// reportWriteCSV - write the summary as CSV, with one row per group key
+func reportWriteCSV(w io.Writer, summary *ReportSummary) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"group", "key", "total", "valid", "failed", "novalidation", "reasons"})
+	row := func(group string, key string, c *ReportCounts) {
+		writer.Write([]string{group, key, strconv.Itoa(c.Total), strconv.Itoa(c.Valid), strconv.Itoa(c.Failed),
+			strconv.Itoa(c.NoValidation), reportReasons(c.Reasons)})
+	}
+	row("total", "", &summary.Totals)
+	for _, group := range []struct {
+		name   string
+		counts map[string]*ReportCounts
+	}{{"spc", summary.BySPC}, {"attest", summary.ByAttest}} {
+		keys := make([]string, 0, len(group.counts))
+		for key := range group.counts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			row(group.name, key, group.counts[key])
+		}
+	}
+	for _, b := range summary.Buckets {
+		row("bucket", b.Start, &b.ReportCounts)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// reportWrite - write the summary in the format (json or csv)
+func reportWrite(w io.Writer, summary *ReportSummary, format string) error {
+	if format == "csv" {
+		return reportWriteCSV(w, summary)
+	}
+	jsummary, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", jsummary)
+	return err
+}
+
+// reportParseTime - the time given as unix timestamp or in RFC 3339 format
+func reportParseTime(val string) (time.Time, error) {
+	val = strings.TrimSpace(val)
+	if secs, err := strconv.ParseFloat(val, 64); err == nil {
+		return time.Unix(int64(secs), int64((secs-float64(int64(secs)))*1e9)), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time value: %s", val)
+}
+
+// reportReadCDR - check the identities of the CDR export, a CSV file with a
+// header row naming the 'identity' and optionally the 'time' and 'source'
+// columns, the source being matched against the no identity exceptions
+func reportReadCDR(filePath string) ([]*ReportItem, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	identityCol, timeCol, sourceCol := -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "identity":
+			identityCol = i
+		case "time":
+			timeCol = i
+		case "source":
+			sourceCol = i
+		}
+	}
+	if identityCol < 0 {
+		return nil, errors.New("no identity column in the header row")
+	}
+	var items []*ReportItem
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if identityCol >= len(record) {
+			continue
+		}
+		item := &ReportItem{Identity: strings.TrimSpace(record[identityCol])}
+		if timeCol >= 0 && timeCol < len(record) {
+			if item.Time, err = reportParseTime(record[timeCol]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+		if len(item.Identity) == 0 {
+			source := ""
+			if sourceCol >= 0 && sourceCol < len(record) {
+				source = strings.TrimSpace(record[sourceCol])
+			}
+			var result string
+			result, item.Code = noIdentityResult(source)
+			item.NoTN = result == checkResultNoTN
+		} else {
+			info, ret, _ := checkFullIdentityInfo(context.Background(), item.Identity)
+			item.Code, item.SPC = ret, identityCertSPC(info)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// secsipidxCLIReport - write the summary report of checking the identities
+// from the capture file or from the CDR export
+func secsipidxCLIReport() int {
+	if cliops.reportbuck <= 0 {
+		fmt.Printf("invalid report bucket: %d\n", cliops.reportbuck)
+		return cliExitArgs
+	}
+	if len(cliops.report) > 0 && cliops.report != "json" && cliops.report != "csv" {
+		fmt.Printf("invalid report format: %s\n", cliops.report)
+		return cliExitArgs
+	}
+	if len(cliops.fpcap) == 0 && len(cliops.fcdr) == 0 {
+		fmt.Printf("no capture file or CDR export provided\n")
+		return cliExitArgs
+	}
+	var items []*ReportItem
+	if len(cliops.fpcap) > 0 {
+		results, err := pcapCheckFile(cliops.fpcap, cliops.callid)
+		if err != nil {
+			fmt.Printf("failed to read the capture file: %v\n", err)
+			return -1
+		}
+		for _, res := range results {
+			items = append(items, &ReportItem{Time: res.time, Identity: res.identity, Code: res.Code,
+				NoTN: res.Result == checkResultNoTN, SPC: res.spc})
+		}
+	}
+	if len(cliops.fcdr) > 0 {
+		cdrItems, err := reportReadCDR(cliops.fcdr)
+		if err != nil {
+			fmt.Printf("failed to read the CDR file: %v\n", err)
+			return -1
+		}
+		items = append(items, cdrItems...)
+	}
+	out := io.Writer(os.Stdout)
+	if len(cliops.reportfile) > 0 {
+		f, err := os.Create(cliops.reportfile)
+		if err != nil {
+			fmt.Printf("failed to create the report file: %v\n", err)
+			return -1
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := reportWrite(out, reportSummarize(items, cliops.reportbuck), cliops.report); err != nil {
+		fmt.Printf("failed to write the report: %v\n", err)
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// ResignRequest - JSON body of the request to re-issue the identity
+type ResignRequest struct {
+	Identity string `json:"identity"`
+	OrigID   string `json:"origid,omitempty"`
+}
+
+// resignIdentity - re-issue the identity with the signing key, it can be
+// signed with the previous key after the cutover to the next key
+func resignIdentity(identityVal string, origID string) (string, int, error) {
+	prvkey, err := secsipid.SJWTReadPrvKey(signPrvKey())
+	if err != nil {
+		return "", secsipid.SJWTRetErrFileRead, err
+	}
+	return secsipid.SJWTResignIdentityPrvKeys(identityVal, cliops.resignage, origID, prvkey, prevPrvKey(), cliops.x5u)
+}
+
+func secsipidxCLIResign() int {
+	var sIdentity string
+	if len(cliops.fidentity) > 0 {
+		vIdentity, _ := ioutil.ReadFile(cliops.fidentity)
+		sIdentity = strings.TrimSpace(string(vIdentity))
+	} else if len(cliops.identity) > 0 {
+		sIdentity = cliops.identity
+	} else {
+		fmt.Printf("Identity value not provided\n")
+		return cliExitArgs
+	}
+	identityVal, ret, err := resignIdentity(sIdentity, cliops.origid)
+	if err != nil {
+		fmt.Printf("error: (%d) %v\n", ret, err)
+		return ret
+	}
+	fmt.Printf("%s\n", identityVal)
+	return 0
+}
+
+// httpHandleV1Resign - re-issue the identity signed by this service with a
+// fresh iat and optionally a new origid, given as JSON body (ResignRequest)
+// or as text body with the origid in X-Orig-ID header
+func httpHandleV1Resign(w http.ResponseWriter, r *http.Request) {
+	httpLogf(r, "incoming request for re-signing identity ...\n")
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpLogf(r, "error reading body: %v\n", err)
+		httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "cannot read body")
+		return
+	}
+	resignReq := ResignRequest{}
+	if httpRequestJSON(r) {
+		if err = json.Unmarshal(body, &resignReq); err != nil {
+			httpLogf(r, "invalid json body: %v\n", err)
+			httpError(w, http.StatusBadRequest, httpErrBadRequest, secsipid.SJWTRetErr, "invalid body")
+			return
+		}
+	} else {
+		resignReq.Identity = string(body)
+		resignReq.OrigID = r.Header.Get("X-Orig-ID")
+	}
+	identityVal, ret, err := resignIdentity(resignReq.Identity, resignReq.OrigID)
+	if err != nil {
+		httpLogf(r, "failed re-signing identity: (%d) %v\n", ret, err)
+		httpError(w, http.StatusBadRequest, httpErrSignFailed, ret, err.Error())
+		return
+	}
+	httpLogf(r, "identity re-signed\n")
+	httpWriteIdentity(w, r, identityVal, &IdentityResult{Identity: identityVal})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sdWatchdog - in-flight http requests, the watchdog keep-alive is not sent
+// while one of them is stalled for longer than the watchdog interval
+type sdWatchdog struct {
+	mu       sync.Mutex
+	next     uint64
+	inflight map[uint64]time.Time
+	interval time.Duration
+}
+
+type sdWatchdogKey struct{}
+
+var sdwatchdog *sdWatchdog
+
+// sdNotify - send the state to systemd over the NOTIFY_SOCKET, it does
+// nothing if the daemon is not started by systemd with Type=notify
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if len(socketPath) == 0 {
+		return nil
+	}
+	if socketPath[0] == '@' {
+		// abstract socket
+		socketPath = "\x00" + socketPath[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval - the watchdog interval set by systemd (WatchdogSec) or
+// 0 if it is not enabled for this process
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdNotifyReady - notify systemd that the http services are started and
+// start sending the watchdog keep-alives if the watchdog is enabled
+func sdNotifyReady() {
+	if err := sdNotify("READY=1\nSTATUS=serving http requests"); err != nil {
+		log.Printf("failed to notify systemd (error: %v)", err)
+		return
+	}
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	sdwatchdog = &sdWatchdog{inflight: make(map[uint64]time.Time), interval: interval}
+	log.Printf("systemd watchdog enabled with interval: %v", interval)
+	go sdwatchdog.run()
+}
+
+func (wd *sdWatchdog) run() {
+	ticker := time.NewTicker(wd.interval / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if stalled := wd.stalled(); stalled > 0 {
+			log.Printf("systemd watchdog keep-alive skipped - stalled requests: %d", stalled)
+			continue
+		}
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			log.Printf("failed to send systemd watchdog keep-alive (error: %v)", err)
+		}
+	}
+}
+
+// stalled - the number of requests in progress for longer than the interval
+func (wd *sdWatchdog) stalled() int {
+	now := time.Now()
+	stalled := 0
+	wd.mu.Lock()
+	for _, started := range wd.inflight {
+		if now.Sub(started) > wd.interval {
+			stalled++
+		}
+	}
+	wd.mu.Unlock()
+	return stalled
+}
+
+// sdWatchdogTrack - track the request while it is processed, returning the
+// request with the tracking id and the function to call when it is done
+func sdWatchdogTrack(r *http.Request) (*http.Request, func()) {
+	wd := sdwatchdog
+	if wd == nil {
+		return r, func() {}
+	}
+	wd.mu.Lock()
+	wd.next++
+	id := wd.next
+	wd.inflight[id] = time.Now()
+	wd.mu.Unlock()
+	done := func() {
+		wd.mu.Lock()
+		delete(wd.inflight, id)
+		wd.mu.Unlock()
+	}
+	return r.WithContext(context.WithValue(r.Context(), sdWatchdogKey{}, id)), done
+}
+
+// sdWatchdogRelease - stop tracking a request that is expected to last long
+// (e.g., streaming the results of a job)
+func sdWatchdogRelease(r *http.Request) {
+	wd := sdwatchdog
+	if wd == nil {
+		return
+	}
+	if id, ok := r.Context().Value(sdWatchdogKey{}).(uint64); ok {
+		wd.mu.Lock()
+		delete(wd.inflight, id)
+		wd.mu.Unlock()
+	}
+}
@@ -0,0 +1,169 @@
+package secsipid
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// timeout (in seconds) of fetching the issuer certificates from AIA
+const aiaFetchTimeout = 5
+
+// maximum number of AIA URLs kept in the cache of the issuer certificates
+const aiaCacheLimit = 1000
+
+// issuer certificates fetched from the AIA caIssuers URLs, by URL
+var aiaCache = struct {
+	sync.Mutex
+	certs map[string][]*x509.Certificate
+}{certs: map[string][]*x509.Certificate{}}
+
+// SJWTAIACacheFlush - remove the issuer certificates fetched from AIA URLs
+func SJWTAIACacheFlush() {
+	aiaCache.Lock()
+	aiaCache.certs = map[string][]*x509.Certificate{}
+	aiaCache.Unlock()
+}
+
+// sjwtAIAAllowed - true if the issuer certificates can be fetched from the
+// URL, it must be http or https and, if CertAIAHosts is set, its host must be
+// in the list
+func sjwtAIAAllowed(urlVal string) bool {
+	u, err := url.Parse(urlVal)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Hostname()) == 0 {
+		return false
+	}
+	if len(globalLibOptions.aiaHosts) == 0 {
+		return true
+	}
+	for _, host := range strings.Split(globalLibOptions.aiaHosts, ",") {
+		if strings.EqualFold(strings.TrimSpace(host), u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// sjwtAIAParseCerts - the certificates of the AIA response, which is either a
+// DER encoded certificate or PEM encoded certificates
+func sjwtAIAParseCerts(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate in AIA response")
+	}
+	return certs, nil
+}
+
+// sjwtAIAFetch - the issuer certificates from the AIA URL, from the cache or
+// fetched like the x5u content
+func sjwtAIAFetch(ctx context.Context, urlVal string) ([]*x509.Certificate, error) {
+	aiaCache.Lock()
+	certs, ok := aiaCache.certs[urlVal]
+	aiaCache.Unlock()
+	if ok {
+		return certs, nil
+	}
+	end := sjwtSpan("secsipid.aia", "url", urlVal)
+	fetchEnd := sjwtSpan("secsipid.fetch", "url", urlVal)
+	data, _, _, err := sjwtGetURLContent(ctx, urlVal, aiaFetchTimeout)
+	fetchEnd(err)
+	if err == nil {
+		certs, err = sjwtAIAParseCerts(data)
+	}
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	aiaCache.Lock()
+	if len(aiaCache.certs) >= aiaCacheLimit {
+		aiaCache.certs = map[string][]*x509.Certificate{}
+	}
+	aiaCache.certs[urlVal] = certs
+	aiaCache.Unlock()
+	return certs, nil
+}
+
+// sjwtAIAIssuers - the issuer certificates of the certificate, fetched in
+// parallel from all its allowed AIA caIssuers URLs
+func sjwtAIAIssuers(ctx context.Context, certVal *x509.Certificate) []*x509.Certificate {
+	var urls []string
+	for _, urlVal := range certVal.IssuingCertificateURL {
+		if sjwtAIAAllowed(urlVal) {
+			urls = append(urls, urlVal)
+		}
+	}
+	results := make([][]*x509.Certificate, len(urls))
+	var wg sync.WaitGroup
+	for i, urlVal := range urls {
+		wg.Add(1)
+		go func(i int, urlVal string) {
+			defer wg.Done()
+			results[i], _ = sjwtAIAFetch(ctx, urlVal)
+		}(i, urlVal)
+	}
+	wg.Wait()
+	var issuers []*x509.Certificate
+	for _, certs := range results {
+		for _, cert := range certs {
+			if cert.IsCA {
+				issuers = append(issuers, cert)
+			}
+		}
+	}
+	return issuers
+}
+
+// sjwtAIAVerify - verify the certificate with the intermediates completed by
+// the issuers fetched from the AIA URLs, going up the chain for at most
+// CertAIAMax levels; err is the error of the verification without them
+func sjwtAIAVerify(ctx context.Context, certVal *x509.Certificate, opts x509.VerifyOptions, err error) ([][]*x509.Certificate, error) {
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	current := certVal
+	for i := 0; i < globalLibOptions.aiaMax; i++ {
+		issuers := sjwtAIAIssuers(ctx, current)
+		if len(issuers) == 0 {
+			break
+		}
+		for _, issuer := range issuers {
+			opts.Intermediates.AddCert(issuer)
+		}
+		var chains [][]*x509.Certificate
+		if chains, err = certVal.Verify(opts); err == nil {
+			return chains, nil
+		}
+		current = issuers[0]
+		if bytes.Equal(current.RawIssuer, current.RawSubject) {
+			break
+		}
+	}
+	return nil, err
+}
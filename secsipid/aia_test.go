@@ -0,0 +1,93 @@
+package secsipid_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func generateAIACert(template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestAIAFetch(t *testing.T) {
+	var interDER []byte
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(interDER)
+	}))
+	defer server.Close()
+
+	caTemplate := func(serial int64, name string) *x509.Certificate {
+		return &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: name},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0), IsCA: true,
+			BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature}
+	}
+	root, rootKey := generateAIACert(caTemplate(1, "AIA Root"), nil, nil)
+	inter, interKey := generateAIACert(caTemplate(2, "AIA Intermediate"), root, rootKey)
+	interDER = inter.Raw
+	leaf, _ := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "AIA Leaf"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0),
+		KeyUsage: x509.KeyUsageDigitalSignature, IssuingCertificateURL: []string{server.URL + "/inter.der"}}, inter, interKey)
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+
+	os.WriteFile("dummyAIARoot.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0640)
+	defer os.Remove("dummyAIARoot.pem")
+	secsipid.SJWTLibOptSetS("CertCAFile", "dummyAIARoot.pem")
+	defer secsipid.SJWTLibOptSetS("CertCAFile", "")
+	secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA)
+	defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+	defer secsipid.SJWTLibOptSetN("CertAIAFetch", 0)
+	defer secsipid.SJWTLibOptSetS("CertAIAHosts", "")
+
+	t.Run("ErrCertInvalid without AIA fetching", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertInvalid)
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(0))
+	})
+
+	t.Run("ErrCertInvalid with AIA host not allowed", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertAIAFetch", 1)
+		secsipid.SJWTLibOptSetS("CertAIAHosts", "certs.example.com")
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertInvalid)
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(0))
+	})
+
+	t.Run("OK with AIA fetching and cached issuer", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertAIAFetch", 1)
+		secsipid.SJWTLibOptSetS("CertAIAHosts", "")
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		ret, _ = secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(1))
+		secsipid.SJWTAIACacheFlush()
+	})
+}
@@ -0,0 +1,124 @@
+package secsipid
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// suffix of the files with the digests of the cached certificates
+const cacheDigestSuffix = ".sha256"
+
+// key for signing the digests of the cached certificates (HMAC-SHA256)
+var cacheKey = struct {
+	sync.RWMutex
+	key []byte
+}{}
+
+// SJWTCacheKeyLoad - load the key for signing the digests of the cached
+// certificates, the white spaces at the end of the file are ignored
+func SJWTCacheKeyLoad(filePath string) (int, error) {
+	var key []byte
+	if len(filePath) > 0 {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return SJWTRetErrFileRead, err
+		}
+		key = []byte(strings.TrimRight(string(data), " \t\r\n"))
+		if len(key) == 0 {
+			return SJWTRetErrFileRead, errors.New("empty cache key")
+		}
+	}
+	cacheKey.Lock()
+	cacheKey.key = key
+	cacheKey.Unlock()
+	return SJWTRetOK, nil
+}
+
+// sjwtCacheDigest - the digest of the cached content, signed with the cache
+// key if it is set
+func sjwtCacheDigest(data []byte) string {
+	cacheKey.RLock()
+	key := cacheKey.key
+	cacheKey.RUnlock()
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// sjwtCacheCheckDigest - check the cached content against the digest stored
+// next to it
+func sjwtCacheCheckDigest(filePath string, data []byte) error {
+	digest, err := os.ReadFile(filePath + cacheDigestSuffix)
+	if err != nil {
+		return errors.New("no digest for cached content")
+	}
+	if !hmac.Equal([]byte(strings.TrimSpace(string(digest))), []byte(sjwtCacheDigest(data))) {
+		return errors.New("digest mismatch for cached content")
+	}
+	return nil
+}
+
+// SJWTCacheFileVerify - check the cache file against its digest
+func SJWTCacheFileVerify(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return sjwtCacheCheckDigest(filePath, data)
+}
+
+// SJWTCacheFileAux - true if the file of the cache directory is not a cached
+// content, but a digest, the validators or a temporary file
+func SJWTCacheFileAux(name string) bool {
+	return strings.HasSuffix(name, cacheDigestSuffix) || strings.HasSuffix(name, cacheValidatorsSuffix) ||
+		strings.HasPrefix(name, ".tmp-")
+}
+
+// sjwtCacheRemove - remove the cached content, its digest and validators
+func sjwtCacheRemove(filePath string) {
+	sjwtCacheRemoveFiles(filePath)
+	sjwtCacheRemoved(filePath)
+}
+
+// sjwtCacheRemoveFiles - remove the files of the cache entry, without
+// updating the index
+func sjwtCacheRemoveFiles(filePath string) {
+	os.Remove(filePath)
+	os.Remove(filePath + cacheDigestSuffix)
+	os.Remove(filePath + cacheValidatorsSuffix)
+}
+
+// sjwtCacheWriteFile - write the file atomically, through a temporary file
+// renamed at the end, so the readers never get truncated content
+func sjwtCacheWriteFile(filePath string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(filePath), ".tmp-"+filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0640)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
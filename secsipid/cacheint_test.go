@@ -0,0 +1,79 @@
+package secsipid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCacheIntegrity(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write([]byte("certificate content"))
+	}))
+	defer server.Close()
+
+	cacheDir, _ := os.MkdirTemp("", "secsipid-cache")
+	defer os.RemoveAll(cacheDir)
+	secsipid.SetURLFileCacheOptions(cacheDir, 3600)
+	defer secsipid.SetURLFileCacheOptions("", 0)
+	secsipid.SJWTLibOptSetN("CacheIntegrity", 1)
+	defer secsipid.SJWTLibOptSetN("CacheIntegrity", 0)
+
+	urlVal := server.URL + "/cert.pem"
+	filePath := secsipid.SJWTGetURLCacheFilePath(urlVal)
+
+	t.Run("OK with digest stored and checked", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		data, ret, _ := secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(data)).ToBe("certificate content")
+		digest, _ := os.ReadFile(filePath + ".sha256")
+		expect(strings.HasPrefix(string(digest), "sha256:")).ToBe(true)
+
+		data, ret, _ = secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(data)).ToBe("certificate content")
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(1))
+	})
+
+	t.Run("OK with tampered content fetched again", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile(filePath, []byte("tampered content"), 0640)
+		data, ret, _ := secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(data)).ToBe("certificate content")
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(2))
+	})
+
+	t.Run("OK with signed digest and without digest fetched again", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		keyPath := cacheDir + ".key"
+		os.WriteFile(keyPath, []byte("secret\n"), 0600)
+		defer os.Remove(keyPath)
+		expect(secsipid.SJWTLibOptSetS("CacheKeyFile", keyPath)).ToBe(secsipid.SJWTRetOK)
+		defer secsipid.SJWTCacheKeyLoad("")
+
+		// the digest without key does not match anymore
+		_, ret, _ := secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(3))
+		digest, _ := os.ReadFile(filePath + ".sha256")
+		expect(strings.HasPrefix(string(digest), "hmac-sha256:")).ToBe(true)
+
+		os.Remove(filePath + ".sha256")
+		_, ret, _ = secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(4))
+	})
+}
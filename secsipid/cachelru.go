@@ -0,0 +1,164 @@
+package secsipid
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sjwtCacheEntry - cached certificate in the index of the cache directory
+type sjwtCacheEntry struct {
+	path string
+	size int64
+}
+
+// index of the cache directory, for the size limits, with the entries in
+// the order of their last use (the least recently used at front)
+var cacheIndex = struct {
+	sync.Mutex
+	dir     string
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+}{}
+
+// sjwtCacheLimited - true if there is a limit for the cache directory
+func sjwtCacheLimited() bool {
+	return globalLibOptions.cacheMaxEnt > 0 || globalLibOptions.cacheMaxSize > 0
+}
+
+// sjwtCacheIndexLoad - build the index from the files of the cache directory,
+// ordered by modification time, if not done yet for it (lock must be held)
+func sjwtCacheIndexLoad() {
+	if cacheIndex.lru != nil && cacheIndex.dir == globalLibOptions.cacheDirPath {
+		return
+	}
+	cacheIndex.dir = globalLibOptions.cacheDirPath
+	cacheIndex.lru = list.New()
+	cacheIndex.entries = map[string]*list.Element{}
+	cacheIndex.size = 0
+	files, err := ioutil.ReadDir(cacheIndex.dir)
+	if err != nil {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files {
+		if f.IsDir() || SJWTCacheFileAux(f.Name()) {
+			continue
+		}
+		filePath := filepath.Join(cacheIndex.dir, f.Name())
+		cacheIndex.entries[filePath] = cacheIndex.lru.PushBack(&sjwtCacheEntry{path: filePath, size: f.Size()})
+		cacheIndex.size += f.Size()
+	}
+}
+
+// sjwtCacheIndexReset - build the index again at next use, when the limits
+// are changed
+func sjwtCacheIndexReset() {
+	cacheIndex.Lock()
+	cacheIndex.lru = nil
+	cacheIndex.Unlock()
+}
+
+// sjwtCacheIndexRemove - remove the entry from the index (lock must be held)
+func sjwtCacheIndexRemove(filePath string) {
+	if elem, ok := cacheIndex.entries[filePath]; ok {
+		cacheIndex.size -= elem.Value.(*sjwtCacheEntry).size
+		cacheIndex.lru.Remove(elem)
+		delete(cacheIndex.entries, filePath)
+	}
+}
+
+// sjwtCacheEvict - remove the least recently used entries while the cache is
+// over the limits (lock must be held)
+func sjwtCacheEvict() int {
+	removed := 0
+	for cacheIndex.lru.Len() > 0 {
+		if (globalLibOptions.cacheMaxEnt <= 0 || cacheIndex.lru.Len() <= globalLibOptions.cacheMaxEnt) &&
+			(globalLibOptions.cacheMaxSize <= 0 || cacheIndex.size <= int64(globalLibOptions.cacheMaxSize)*1024) {
+			break
+		}
+		entry := cacheIndex.lru.Front().Value.(*sjwtCacheEntry)
+		sjwtCacheIndexRemove(entry.path)
+		sjwtCacheRemoveFiles(entry.path)
+		removed++
+	}
+	return removed
+}
+
+// sjwtCacheUsed - mark the cache entry as the most recently used one
+func sjwtCacheUsed(filePath string) {
+	if !sjwtCacheLimited() {
+		return
+	}
+	cacheIndex.Lock()
+	defer cacheIndex.Unlock()
+	sjwtCacheIndexLoad()
+	if elem, ok := cacheIndex.entries[filePath]; ok {
+		cacheIndex.lru.MoveToBack(elem)
+	}
+}
+
+// sjwtCacheStored - add the written cache entry to the index, evicting the
+// least recently used ones if the cache is over the limits
+func sjwtCacheStored(filePath string, size int64) {
+	if !sjwtCacheLimited() {
+		return
+	}
+	cacheIndex.Lock()
+	defer cacheIndex.Unlock()
+	sjwtCacheIndexLoad()
+	sjwtCacheIndexRemove(filePath)
+	cacheIndex.entries[filePath] = cacheIndex.lru.PushBack(&sjwtCacheEntry{path: filePath, size: size})
+	cacheIndex.size += size
+	sjwtCacheEvict()
+}
+
+// sjwtCacheRemoved - remove the entry from the index, after its files were
+// removed
+func sjwtCacheRemoved(filePath string) {
+	cacheIndex.Lock()
+	defer cacheIndex.Unlock()
+	if cacheIndex.lru != nil {
+		sjwtCacheIndexRemove(filePath)
+	}
+}
+
+// SJWTURLCacheCleanup - remove the expired entries of the cache directory and
+// the least recently used ones over the size limits, as well as the temporary
+// files left by interrupted writes; returns the number of removed entries
+func SJWTURLCacheCleanup() int {
+	if len(globalLibOptions.cacheDirPath) == 0 {
+		return 0
+	}
+	files, err := ioutil.ReadDir(globalLibOptions.cacheDirPath)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	tnow := time.Now()
+	for _, f := range files {
+		if f.IsDir() || int(tnow.Sub(f.ModTime()).Seconds()) <= globalLibOptions.cacheExpire {
+			continue
+		}
+		filePath := filepath.Join(globalLibOptions.cacheDirPath, f.Name())
+		if strings.HasPrefix(f.Name(), ".tmp-") {
+			os.Remove(filePath)
+		} else if !SJWTCacheFileAux(f.Name()) && !sjwtCacheKept(filePath, f.ModTime()) {
+			sjwtCacheRemove(filePath)
+			removed++
+		}
+	}
+	if sjwtCacheLimited() {
+		cacheIndex.Lock()
+		sjwtCacheIndexLoad()
+		removed += sjwtCacheEvict()
+		cacheIndex.Unlock()
+	}
+	return removed
+}
@@ -0,0 +1,55 @@
+package secsipid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCacheLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("certificate content for " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	cacheDir, _ := os.MkdirTemp("", "secsipid-cache")
+	defer os.RemoveAll(cacheDir)
+	secsipid.SetURLFileCacheOptions(cacheDir, 3600)
+	defer secsipid.SetURLFileCacheOptions("", 0)
+
+	cached := func(name string) bool {
+		_, err := os.Stat(secsipid.SJWTGetURLCacheFilePath(server.URL + "/" + name))
+		return err == nil
+	}
+
+	t.Run("OK with least recently used entry evicted", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CacheMaxEntries", 2)
+		defer secsipid.SJWTLibOptSetN("CacheMaxEntries", 0)
+
+		secsipid.SJWTGetURLContent(server.URL+"/a.pem", 5)
+		secsipid.SJWTGetURLContent(server.URL+"/b.pem", 5)
+		// a.pem is used again from the cache, b.pem becomes the least recently used
+		secsipid.SJWTGetURLContent(server.URL+"/a.pem", 5)
+		secsipid.SJWTGetURLContent(server.URL+"/c.pem", 5)
+		expect(cached("a.pem")).ToBe(true)
+		expect(cached("b.pem")).ToBe(false)
+		expect(cached("c.pem")).ToBe(true)
+	})
+
+	t.Run("OK with cleanup of expired entries", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		old := time.Now().Add(-2 * time.Hour)
+		os.Chtimes(secsipid.SJWTGetURLCacheFilePath(server.URL+"/a.pem"), old, old)
+		expect(secsipid.SJWTURLCacheCleanup()).ToBe(1)
+		expect(cached("a.pem")).ToBe(false)
+		expect(cached("c.pem")).ToBe(true)
+	})
+}
@@ -0,0 +1,128 @@
+package secsipid
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// suffix of the files with the validators (ETag and Last-Modified) of the
+// cached certificates
+const cacheValidatorsSuffix = ".validators"
+
+// sjwtCacheKept - true if the expired cache file has to be kept, to be
+// revalidated or to be used when the repository cannot be contacted
+func sjwtCacheKept(filePath string, modTime time.Time) bool {
+	return sjwtCacheRevalidable(filePath, modTime) || sjwtCacheStaleUsable(modTime)
+}
+
+// sjwtCacheStaleUsable - true if the expired cache file can be used when the
+// repository cannot be contacted: it expired less than CacheStaleIfError
+// seconds ago
+func sjwtCacheStaleUsable(modTime time.Time) bool {
+	if globalLibOptions.cacheStale <= 0 {
+		return false
+	}
+	return int(time.Since(modTime).Seconds()) <= globalLibOptions.cacheExpire+globalLibOptions.cacheStale
+}
+
+// sjwtCacheStaleContent - the content of the expired cache file of the URL,
+// if it can be used after the fetch failed (nil otherwise); the file is left
+// expired, to be fetched again by the next requests
+func sjwtCacheStaleContent(urlVal string) []byte {
+	filePath := SJWTGetURLCacheFilePath(urlVal)
+	fileStat, err := os.Stat(filePath)
+	if err != nil || !sjwtCacheStaleUsable(fileStat.ModTime()) {
+		return nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	if globalLibOptions.cacheInteg != 0 && sjwtCacheCheckDigest(filePath, data) != nil {
+		return nil
+	}
+	sjwtCacheUsed(filePath)
+	return data
+}
+
+// sjwtCacheRevalidable - true if the expired cache file can still be
+// revalidated with a conditional request: it expired less than CacheRevalidate
+// seconds ago and it has validators
+func sjwtCacheRevalidable(filePath string, modTime time.Time) bool {
+	if globalLibOptions.cacheReval <= 0 {
+		return false
+	}
+	age := int(time.Since(modTime).Seconds())
+	if age > globalLibOptions.cacheExpire+globalLibOptions.cacheReval {
+		return false
+	}
+	_, err := os.Stat(filePath + cacheValidatorsSuffix)
+	return err == nil
+}
+
+// sjwtCacheValidators - the ETag and Last-Modified values stored for the
+// expired cache file, if it can be revalidated
+func sjwtCacheValidators(filePath string) (string, string) {
+	fileStat, err := os.Stat(filePath)
+	if err != nil || !sjwtCacheRevalidable(filePath, fileStat.ModTime()) {
+		return "", ""
+	}
+	data, err := os.ReadFile(filePath + cacheValidatorsSuffix)
+	if err != nil {
+		return "", ""
+	}
+	etag, lastModified := "", ""
+	for _, line := range strings.Split(string(data), "\n") {
+		nameVal := strings.SplitN(line, ":", 2)
+		if len(nameVal) != 2 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(nameVal[0])) {
+		case "etag":
+			etag = strings.TrimSpace(nameVal[1])
+		case "last-modified":
+			lastModified = strings.TrimSpace(nameVal[1])
+		}
+	}
+	return etag, lastModified
+}
+
+// sjwtCacheSetValidators - store the validators of the response next to the
+// cache file, removing the old ones if the response has none
+func sjwtCacheSetValidators(filePath string, header http.Header) {
+	var lines []string
+	if etag := header.Get("ETag"); len(etag) > 0 {
+		lines = append(lines, "ETag: "+etag)
+	}
+	if lastModified := header.Get("Last-Modified"); len(lastModified) > 0 {
+		lines = append(lines, "Last-Modified: "+lastModified)
+	}
+	if len(lines) == 0 {
+		os.Remove(filePath + cacheValidatorsSuffix)
+		return
+	}
+	sjwtCacheWriteFile(filePath+cacheValidatorsSuffix, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// sjwtCacheRevalidated - the content of the expired cache file confirmed by
+// the repository as not modified, which is valid again for the expire time
+func sjwtCacheRevalidated(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if globalLibOptions.cacheInteg != 0 {
+		if err = sjwtCacheCheckDigest(filePath, data); err != nil {
+			sjwtCacheRemove(filePath)
+			return nil, err
+		}
+	}
+	tnow := time.Now()
+	if err = os.Chtimes(filePath, tnow, tnow); err != nil {
+		return nil, err
+	}
+	sjwtCacheUsed(filePath)
+	return data, nil
+}
@@ -0,0 +1,88 @@
+package secsipid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCacheRevalidate(t *testing.T) {
+	var downloads, notModified int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Write([]byte("certificate content"))
+	}))
+	defer server.Close()
+
+	cacheDir, _ := os.MkdirTemp("", "secsipid-cachereval")
+	defer os.RemoveAll(cacheDir)
+	secsipid.SetURLFileCacheOptions(cacheDir, 3600)
+	defer secsipid.SetURLFileCacheOptions("", 0)
+	secsipid.SJWTLibOptSetN("CacheRevalidate", 3600)
+	defer secsipid.SJWTLibOptSetN("CacheRevalidate", 0)
+
+	urlVal := server.URL + "/cert.pem"
+	expire := func() {
+		old := time.Now().Add(-2 * time.Hour)
+		os.Chtimes(secsipid.SJWTGetURLCacheFilePath(urlVal), old, old)
+	}
+
+	t.Run("OK with expired entry revalidated", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		data, ret, _ := secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(data)).ToBe("certificate content")
+		expire()
+		// kept by the cleanup, as it can be revalidated
+		expect(secsipid.SJWTURLCacheCleanup()).ToBe(0)
+
+		before := secsipid.SJWTFetchGetStats()
+		data, ret, _ = secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(data)).ToBe("certificate content")
+		expect(atomic.LoadInt32(&downloads)).ToBe(int32(1))
+		expect(atomic.LoadInt32(&notModified)).ToBe(int32(1))
+		expect(secsipid.SJWTFetchGetStats().Revalidated - before.Revalidated).ToBe(uint64(1))
+
+		// valid again, served from the cache
+		secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(atomic.LoadInt32(&notModified)).ToBe(int32(1))
+	})
+
+	t.Run("OK with full fetch if the cached content is gone", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expire()
+		os.Truncate(secsipid.SJWTGetURLCacheFilePath(urlVal), 0)
+		secsipid.SJWTLibOptSetN("CacheIntegrity", 1)
+		defer secsipid.SJWTLibOptSetN("CacheIntegrity", 0)
+
+		data, ret, _ := secsipid.SJWTGetURLContent(urlVal, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(data)).ToBe("certificate content")
+		expect(atomic.LoadInt32(&downloads)).ToBe(int32(2))
+	})
+
+	t.Run("OK with expired entry removed when revalidation is disabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CacheRevalidate", 0)
+		defer secsipid.SJWTLibOptSetN("CacheRevalidate", 3600)
+
+		expire()
+		expect(secsipid.SJWTURLCacheCleanup()).ToBe(1)
+	})
+}
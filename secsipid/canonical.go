@@ -0,0 +1,39 @@
+package secsipid
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// SJWTCanonicalJSON - serialize the JSON document in the deterministic form of
+// RFC 8225: members ordered lexicographically, without insignificant white
+// spaces and line breaks; the numbers are kept as they are in the input
+func SJWTCanonicalJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(out.Bytes(), "\n"), nil
+}
+
+// sjwtCanonicalText - the canonical form of the JSON text if the library
+// option is set, otherwise the text without the leading and trailing spaces
+func sjwtCanonicalText(jsonText string, errRet int) (string, int, error) {
+	if globalLibOptions.canonJSON == 0 {
+		return strings.TrimSpace(jsonText), SJWTRetOK, nil
+	}
+	data, err := SJWTCanonicalJSON([]byte(jsonText))
+	if err != nil {
+		return "", errRet, err
+	}
+	return string(data), SJWTRetOK, nil
+}
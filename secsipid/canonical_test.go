@@ -0,0 +1,43 @@
+package secsipid_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Run("OK with ordered members and no white spaces", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		data, err := secsipid.SJWTCanonicalJSON([]byte(`{ "orig": {"tn": "1"}, "iat": 1669380000,
+			"dest": {"tn": ["2"]}, "attest": "A", "rcd": {"nam": "A&B <Corp>", "icn": "https://a.b/logo.png"}}`))
+		expect(err).ToBe(nil)
+		expect(string(data)).ToBe(`{"attest":"A","dest":{"tn":["2"]},"iat":1669380000,"orig":{"tn":"1"},"rcd":{"icn":"https://a.b/logo.png","nam":"A&B <Corp>"}}`)
+	})
+
+	t.Run("OK with reproducible signing input", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prvkey, _, _ := generateECKeyPEMs()
+		secsipid.SJWTLibOptSetN("CanonicalJSON", 1)
+		defer secsipid.SJWTLibOptSetN("CanonicalJSON", 0)
+
+		token1, _, _ := secsipid.SJWTEncodeTextWithPrvKey(`{"typ":"passport", "alg":"ES256"}`, `{"orig":{"tn":"1"}, "iat":10}`, string(prvkey))
+		token2, _, _ := secsipid.SJWTEncodeTextWithPrvKey(`{"alg":"ES256","typ":"passport"}`, `{"iat":10,"orig":{"tn":"1"}}`, string(prvkey))
+		expect(strings.Join(strings.Split(token1, ".")[:2], ".")).ToBe(strings.Join(strings.Split(token2, ".")[:2], "."))
+	})
+
+	t.Run("ErrJSONPayloadParse with invalid payload", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prvkey, _, _ := generateECKeyPEMs()
+		secsipid.SJWTLibOptSetN("CanonicalJSON", 1)
+		defer secsipid.SJWTLibOptSetN("CanonicalJSON", 0)
+
+		_, ret, _ := secsipid.SJWTEncodeTextWithPrvKey(`{"alg":"ES256"}`, `{"iat":`, string(prvkey))
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadParse)
+	})
+}
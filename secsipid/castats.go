@@ -0,0 +1,104 @@
+package secsipid
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"sort"
+	"sync"
+)
+
+// caStatsMaxEntries - the maximum number of tracked issuer and SPC pairs,
+// the verifications with the other ones being counted for the issuer 'other'
+const caStatsMaxEntries = 1000
+
+// caStatsOther - the issuer used above the maximum number of tracked pairs
+const caStatsOther = "other"
+
+// SJWTCAStats - the number of the identity verifications with certificates
+// of an issuing CA and a service provider code, with the failed ones and
+// the failures per return code
+type SJWTCAStats struct {
+	Issuer   string         `json:"issuer"`
+	SPC      string         `json:"spc"`
+	Checks   uint64         `json:"checks"`
+	Failed   uint64         `json:"failed"`
+	Failures map[int]uint64 `json:"failures,omitempty"`
+}
+
+type caStatsKey struct {
+	issuer string
+	spc    string
+}
+
+var caStats = struct {
+	sync.Mutex
+	entries map[caStatsKey]*SJWTCAStats
+}{entries: make(map[caStatsKey]*SJWTCAStats)}
+
+// sjwtCAStatsAdd - count the verification with the certificate (PEM data,
+// leaf first), nothing if the certificate cannot be parsed
+func sjwtCAStatsAdd(certPEM []byte, ret int) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return
+	}
+	certVal, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return
+	}
+	spc, _, _ := SJWTGetCertSPC(certPEM)
+	key := caStatsKey{issuer: certVal.Issuer.String(), spc: spc}
+
+	caStats.Lock()
+	defer caStats.Unlock()
+	cs, ok := caStats.entries[key]
+	if !ok && len(caStats.entries) >= caStatsMaxEntries {
+		key = caStatsKey{issuer: caStatsOther}
+		cs, ok = caStats.entries[key]
+	}
+	if !ok {
+		cs = &SJWTCAStats{Issuer: key.issuer, SPC: key.spc}
+		caStats.entries[key] = cs
+	}
+	cs.Checks++
+	if ret != SJWTRetOK {
+		cs.Failed++
+		if cs.Failures == nil {
+			cs.Failures = make(map[int]uint64)
+		}
+		cs.Failures[ret]++
+	}
+}
+
+// SJWTCAGetStats - the counters of the verifications with certificates
+// fetched from the info URL, per issuing CA and service provider code,
+// sorted by issuer and SPC
+func SJWTCAGetStats() []SJWTCAStats {
+	caStats.Lock()
+	defer caStats.Unlock()
+	stats := make([]SJWTCAStats, 0, len(caStats.entries))
+	for _, cs := range caStats.entries {
+		item := *cs
+		if cs.Failures != nil {
+			item.Failures = make(map[int]uint64, len(cs.Failures))
+			for code, count := range cs.Failures {
+				item.Failures[code] = count
+			}
+		}
+		stats = append(stats, item)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Issuer != stats[j].Issuer {
+			return stats[i].Issuer < stats[j].Issuer
+		}
+		return stats[i].SPC < stats[j].SPC
+	})
+	return stats
+}
+
+// SJWTCAStatsReset - clear the counters per issuing CA and SPC
+func SJWTCAStatsReset() {
+	caStats.Lock()
+	caStats.entries = make(map[caStatsKey]*SJWTCAStats)
+	caStats.Unlock()
+}
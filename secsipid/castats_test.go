@@ -0,0 +1,65 @@
+package secsipid_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func findCAStats(spc string) *secsipid.SJWTCAStats {
+	for _, cs := range secsipid.SJWTCAGetStats() {
+		if cs.SPC == spc {
+			return &cs
+		}
+	}
+	return nil
+}
+
+func TestCAStats(t *testing.T) {
+	prvkey, cert := generateSPCCertPEM("5678")
+	otherPrvkey, _, _ := generateECKeyPEMs()
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	cacheDir, _ := ioutil.TempDir("", "secsipid-castats")
+	defer os.RemoveAll(cacheDir)
+	secsipid.SJWTLibOptSetS("CacheDirPath", cacheDir)
+	defer secsipid.SJWTLibOptSetS("CacheDirPath", "")
+	secsipid.SJWTSetURLCachedContent("http://localhost:5555/castats.pem", cert)
+	secsipid.SJWTCAStatsReset()
+
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "http://localhost:5555/castats.pem", prvkey)
+	invalid, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "http://localhost:5555/castats.pem", otherPrvkey)
+
+	t.Run("OK verification counted by issuer and SPC", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		cs := findCAStats("5678")
+		expect(cs != nil).ToBe(true)
+		expect(cs.Issuer).ToBe("O=Partner\\, Inc.")
+		expect(cs.Checks).ToBe(uint64(1))
+		expect(cs.Failed).ToBe(uint64(0))
+	})
+
+	t.Run("OK invalid signature counted as failure with the return code", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTCheckFullIdentity(invalid, 60, "", 5)
+		expect(ret).NotToBe(secsipid.SJWTRetOK)
+		cs := findCAStats("5678")
+		expect(cs.Checks).ToBe(uint64(2))
+		expect(cs.Failed).ToBe(uint64(1))
+		expect(cs.Failures[ret]).ToBe(uint64(1))
+	})
+
+	t.Run("OK counters cleared by reset", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTCAStatsReset()
+		expect(findCAStats("5678") == nil).ToBe(true)
+	})
+}
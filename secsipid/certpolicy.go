@@ -0,0 +1,93 @@
+package secsipid
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// modes of the policy checks of the signer certificate
+const (
+	CertPolicyOff     = 0
+	CertPolicyLenient = 1
+	CertPolicyStrict  = 2
+)
+
+// SHAKEN certificate policy (ATIS-1000080)
+const CertPolicySHAKEN = "2.16.840.1.114569.1.1.1"
+
+var (
+	oidExtKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidKeyUsage       = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidAnyExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+// sjwtCertExtension - the value of the certificate extension, nil if the
+// certificate does not have it
+func sjwtCertExtension(certVal *x509.Certificate, oid asn1.ObjectIdentifier) []byte {
+	for _, ext := range certVal.Extensions {
+		if ext.Id.Equal(oid) {
+			return ext.Value
+		}
+	}
+	return nil
+}
+
+// sjwtOIDListMatch - true if one of the OIDs is in the comma separated list
+func sjwtOIDListMatch(oids []asn1.ObjectIdentifier, list string) bool {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		for _, oid := range oids {
+			if oid.String() == item {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SJWTCertPolicyCheck - check the key usage, the extended key usage and the
+// certificate policies of the signer certificate: in lenient mode only the
+// extensions present in the certificate are checked, in strict mode they are
+// also required
+func SJWTCertPolicyCheck(certVal *x509.Certificate) (int, error) {
+	mode := globalLibOptions.certPolicy
+	if mode == CertPolicyOff {
+		return SJWTRetOK, nil
+	}
+
+	if sjwtCertExtension(certVal, oidKeyUsage) == nil {
+		if mode == CertPolicyStrict {
+			return SJWTRetErrCertKeyUsage, errors.New("no key usage in certificate")
+		}
+	} else if (certVal.KeyUsage & x509.KeyUsageDigitalSignature) == 0 {
+		return SJWTRetErrCertKeyUsage, errors.New("key usage without digital signature")
+	}
+
+	if len(globalLibOptions.certPolEKU) > 0 {
+		var ekus []asn1.ObjectIdentifier
+		if value := sjwtCertExtension(certVal, oidExtKeyUsage); value == nil {
+			if mode == CertPolicyStrict {
+				return SJWTRetErrCertExtKeyUsage, errors.New("no extended key usage in certificate")
+			}
+		} else if _, err := asn1.Unmarshal(value, &ekus); err != nil {
+			return SJWTRetErrCertExtKeyUsage, fmt.Errorf("invalid extended key usage: %v", err)
+		} else if !sjwtOIDListMatch(ekus, globalLibOptions.certPolEKU) &&
+			!(mode == CertPolicyLenient && sjwtOIDListMatch(ekus, oidAnyExtKeyUsage.String())) {
+			return SJWTRetErrCertExtKeyUsage, errors.New("extended key usage not allowed")
+		}
+	}
+
+	if len(globalLibOptions.certPolOIDs) > 0 {
+		if len(certVal.PolicyIdentifiers) == 0 {
+			if mode == CertPolicyStrict {
+				return SJWTRetErrCertPolicyOID, errors.New("no certificate policy in certificate")
+			}
+		} else if !sjwtOIDListMatch(certVal.PolicyIdentifiers, globalLibOptions.certPolOIDs) {
+			return SJWTRetErrCertPolicyOID, errors.New("certificate policy not allowed")
+		}
+	}
+	return SJWTRetOK, nil
+}
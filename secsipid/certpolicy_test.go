@@ -0,0 +1,74 @@
+package secsipid_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCertPolicyCheck(t *testing.T) {
+	shakenOID := asn1.ObjectIdentifier{2, 16, 840, 1, 114569, 1, 1, 1}
+	leaf := func(keyUsage x509.KeyUsage, ekus []x509.ExtKeyUsage, policies []asn1.ObjectIdentifier) *x509.Certificate {
+		cert, _ := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Policy Leaf"},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0),
+			KeyUsage: keyUsage, ExtKeyUsage: ekus, PolicyIdentifiers: policies}, nil, nil)
+		return cert
+	}
+	defer secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyOff)
+	defer secsipid.SJWTLibOptSetS("CertPolicyEKU", "")
+
+	t.Run("OK with compliant certificate in strict mode", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyStrict)
+		ret, _ := secsipid.SJWTCertPolicyCheck(leaf(x509.KeyUsageDigitalSignature, nil, []asn1.ObjectIdentifier{shakenOID}))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrCertKeyUsage without digital signature", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyLenient)
+		ret, _ := secsipid.SJWTCertPolicyCheck(leaf(x509.KeyUsageKeyEncipherment, nil, []asn1.ObjectIdentifier{shakenOID}))
+		expect(ret).ToBe(secsipid.SJWTRetErrCertKeyUsage)
+	})
+
+	t.Run("ErrCertPolicyOID with other policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyLenient)
+		ret, _ := secsipid.SJWTCertPolicyCheck(leaf(x509.KeyUsageDigitalSignature, nil, []asn1.ObjectIdentifier{{1, 2, 3, 4}}))
+		expect(ret).ToBe(secsipid.SJWTRetErrCertPolicyOID)
+	})
+
+	t.Run("OK with missing policy only in lenient mode", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cert := leaf(x509.KeyUsageDigitalSignature, nil, nil)
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyLenient)
+		ret, _ := secsipid.SJWTCertPolicyCheck(cert)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyStrict)
+		ret, _ = secsipid.SJWTCertPolicyCheck(cert)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertPolicyOID)
+	})
+
+	t.Run("ErrCertExtKeyUsage with required extended key usage", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetS("CertPolicyEKU", "1.3.6.1.5.5.7.3.4")
+		secsipid.SJWTLibOptSetN("CertPolicy", secsipid.CertPolicyStrict)
+		ret, _ := secsipid.SJWTCertPolicyCheck(leaf(x509.KeyUsageDigitalSignature,
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, []asn1.ObjectIdentifier{shakenOID}))
+		expect(ret).ToBe(secsipid.SJWTRetErrCertExtKeyUsage)
+		ret, _ = secsipid.SJWTCertPolicyCheck(leaf(x509.KeyUsageDigitalSignature,
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}, []asn1.ObjectIdentifier{shakenOID}))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+}
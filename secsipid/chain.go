@@ -0,0 +1,117 @@
+package secsipid
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+// sjwtCertChainOrder - the PEM data of the certificate chain with the leaf
+// certificate first, for the x5u bodies that have the full chain in another
+// order; the data is returned unchanged if it has other blocks than
+// certificates or no CA certificate before the leaf one
+func sjwtCertChainOrder(data []byte) []byte {
+	var blocks []*pem.Block
+	leaf := -1
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return data
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return data
+		}
+		if leaf < 0 && !cert.IsCA {
+			leaf = len(blocks)
+		}
+		blocks = append(blocks, block)
+	}
+	if leaf <= 0 {
+		return data
+	}
+	var buf bytes.Buffer
+	pem.Encode(&buf, blocks[leaf])
+	for i, block := range blocks {
+		if i != leaf {
+			pem.Encode(&buf, block)
+		}
+	}
+	return buf.Bytes()
+}
+
+// sjwtOrderCerts - the certificates starting with the leaf one, followed by
+// its issuers up the chain and then by the other certificates
+func sjwtOrderCerts(certs []*x509.Certificate, leaf int) []*x509.Certificate {
+	ordered := []*x509.Certificate{certs[leaf]}
+	used := make([]bool, len(certs))
+	used[leaf] = true
+	for current := certs[leaf]; !bytes.Equal(current.RawIssuer, current.RawSubject); {
+		next := -1
+		for i, cert := range certs {
+			if !used[i] && bytes.Equal(cert.RawSubject, current.RawIssuer) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		used[next] = true
+		current = certs[next]
+		ordered = append(ordered, current)
+	}
+	for i, cert := range certs {
+		if !used[i] {
+			ordered = append(ordered, cert)
+		}
+	}
+	return ordered
+}
+
+// sjwtCertsPEM - the PEM data of the certificates
+func sjwtCertsPEM(certs []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+// SJWTCertChainPEM - the certificates of the PEM data (the other blocks, like
+// private keys, being dropped) as chain for publication at the x5u: the leaf
+// certificate first, followed by its issuers
+func SJWTCertChainPEM(data []byte) ([]byte, int, error) {
+	var certs []*x509.Certificate
+	leaf := -1
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, SJWTRetErrCertInvalid, err
+		}
+		if leaf < 0 && !cert.IsCA {
+			leaf = len(certs)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, SJWTRetErrCertInvalidFormat, errors.New("no PEM encoded certificate")
+	}
+	if leaf < 0 {
+		leaf = 0
+	}
+	return sjwtCertsPEM(sjwtOrderCerts(certs, leaf)), SJWTRetOK, nil
+}
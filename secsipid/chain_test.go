@@ -0,0 +1,95 @@
+package secsipid_test
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestPubKeyVerifyChain(t *testing.T) {
+	caTemplate := func(serial int64, name string) *x509.Certificate {
+		return &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: name},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0), IsCA: true,
+			BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature}
+	}
+	root, rootKey := generateAIACert(caTemplate(1, "Chain Root"), nil, nil)
+	otherRoot, _ := generateAIACert(caTemplate(2, "Other Root"), nil, nil)
+	inter, interKey := generateAIACert(caTemplate(3, "Chain Intermediate"), root, rootKey)
+	leaf, leafKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(4), Subject: pkix.Name{CommonName: "Chain Leaf"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0),
+		KeyUsage: x509.KeyUsageDigitalSignature}, inter, interKey)
+	encode := func(certs ...*x509.Certificate) []byte {
+		var data []byte
+		for _, cert := range certs {
+			data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+		return data
+	}
+
+	os.WriteFile("dummyChainRoot.pem", encode(root), 0640)
+	defer os.Remove("dummyChainRoot.pem")
+	secsipid.SJWTLibOptSetS("CertCAFile", "dummyChainRoot.pem")
+	defer secsipid.SJWTLibOptSetS("CertCAFile", "")
+	secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA)
+	defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	t.Run("OK with full chain", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		chain, ret, _ := secsipid.SJWTPubKeyVerifyChain(encode(leaf, inter, root))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(chain)).ToBe(3)
+		expect(chain[0].Subject.CommonName).ToBe("Chain Leaf")
+		expect(chain[2].Subject.CommonName).ToBe("Chain Root")
+	})
+
+	t.Run("OK with full chain starting with the root", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		chain, ret, _ := secsipid.SJWTPubKeyVerifyChain(encode(root, inter, leaf))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(chain[0].Subject.CommonName).ToBe("Chain Leaf")
+	})
+
+	t.Run("OK with chain of the identity check", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("ResultCacheTTL", 30)
+		defer secsipid.SJWTLibOptSetN("ResultCacheTTL", 0)
+		defer secsipid.SJWTResultCacheFlush()
+		prvBytes, _ := x509.MarshalECPrivateKey(leafKey)
+		prvkey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes})
+		identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "",
+			"https://certs.example.com/cert.pem", prvkey)
+		os.WriteFile("dummyChainLeaf.pem", encode(leaf, inter), 0640)
+		defer os.Remove("dummyChainLeaf.pem")
+
+		info, ret, _ := secsipid.SJWTCheckFullIdentityInfo(context.Background(), identity, 60, "dummyChainLeaf.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(info.Chain)).ToBe(3)
+		expect(info.Chain[0].Subject.CommonName).ToBe("Chain Leaf")
+		expect(string(info.Cert)).ToBe(string(encode(leaf, inter)))
+
+		// the result cache returns the chain of the verification
+		os.Remove("dummyChainLeaf.pem")
+		info, ret, _ = secsipid.SJWTCheckFullIdentityInfo(context.Background(), identity, 60, "dummyChainLeaf.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(info.Chain)).ToBe(3)
+	})
+
+	t.Run("ErrCertInvalid with embedded root not configured", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyChainRoot.pem", encode(otherRoot), 0640)
+		ret, _ := secsipid.SJWTPubKeyVerify(encode(leaf, inter, root))
+		expect(ret).ToBe(secsipid.SJWTRetErrCertInvalid)
+	})
+}
@@ -0,0 +1,61 @@
+package secsipid
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// SJWTChaosOptions - failures injected in the verification for testing the
+// behaviour of the peers with a misbehaving verifier, not to be used in
+// production
+type SJWTChaosOptions struct {
+	// FetchDelay - latency added to the retrieval of the certificates (ms)
+	FetchDelay int `json:"fetchdelay"`
+	// FetchFail - percent of the certificate retrievals that fail
+	FetchFail int `json:"fetchfail"`
+	// ClockSkew - offset of the clock used for verification (seconds)
+	ClockSkew int `json:"clockskew"`
+}
+
+var (
+	chaosMu      sync.RWMutex
+	chaosOptions SJWTChaosOptions
+)
+
+// SJWTSetChaos - set the failures injected in the verification, the zero
+// value disables them
+func SJWTSetChaos(opts SJWTChaosOptions) {
+	chaosMu.Lock()
+	chaosOptions = opts
+	chaosMu.Unlock()
+}
+
+// SJWTGetChaos - the failures injected in the verification
+func SJWTGetChaos() SJWTChaosOptions {
+	chaosMu.RLock()
+	defer chaosMu.RUnlock()
+	return chaosOptions
+}
+
+// sjwtNow - the current time for verification, with the injected clock skew
+func sjwtNow() time.Time {
+	if skew := SJWTGetChaos().ClockSkew; skew != 0 {
+		return time.Now().Add(time.Duration(skew) * time.Second)
+	}
+	return time.Now()
+}
+
+// sjwtChaosFetch - inject the latency and the failure of the certificate
+// retrieval
+func sjwtChaosFetch() (int, error) {
+	opts := SJWTGetChaos()
+	if opts.FetchDelay > 0 {
+		time.Sleep(time.Duration(opts.FetchDelay) * time.Millisecond)
+	}
+	if opts.FetchFail > 0 && rand.Intn(100) < opts.FetchFail {
+		return SJWTRetErrHTTPGet, errors.New("http get failure: injected by chaos options")
+	}
+	return SJWTRetOK, nil
+}
@@ -0,0 +1,42 @@
+package secsipid_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestChaos(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	os.WriteFile("dummyChaosPubKey.pem", pubkey, 0640)
+	defer os.Remove("dummyChaosPubKey.pem")
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+	defer secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+
+	t.Run("ErrJSONPayloadIATExpired with clock skew", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{ClockSkew: 120})
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "dummyChaosPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadIATExpired)
+
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "dummyChaosPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrHTTPGet with fetch failure", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{FetchFail: 100})
+		_, ret, err := secsipid.SJWTGetURLContent("https://certs.example.com/cert.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPGet)
+		expect(getMsgFromErr(err)).ToBe("http get failure: injected by chaos options")
+		expect(secsipid.SJWTRetIsUnavailable(ret)).ToBe(true)
+		expect(secsipid.SJWTRetIsUnavailable(secsipid.SJWTRetErrJSONSignatureInvalid)).ToBe(false)
+	})
+}
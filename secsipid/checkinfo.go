@@ -0,0 +1,51 @@
+package secsipid
+
+import (
+	"context"
+	"crypto/x509"
+)
+
+// SJWTCheckInfo - the details of the identity verification: the certificate
+// (or public key) used for it, the chain it was verified with (from the leaf
+// certificate to the root CA, empty if the chain is not verified) and the
+// decisions of the revocation checks
+type SJWTCheckInfo struct {
+	Cert       []byte
+	Chain      []*x509.Certificate
+	Revocation *SJWTRevocation
+}
+
+// setCert - set the certificate used for the verification, if the details
+// are wanted
+func (info *SJWTCheckInfo) setCert(cert []byte) {
+	if info != nil {
+		info.Cert = cert
+	}
+}
+
+// SJWTCheckFullIdentityInfo - implements the verify of identity like
+// SJWTCheckFullIdentityContext(), returning the details of the verification
+// (also when it fails, with the fields available at that stage); for the
+// results served from the result cache, the details of the verification that
+// was cached are returned
+func SJWTCheckFullIdentityInfo(ctx context.Context, identityVal string, expireVal int, pubkeyPath string,
+	timeoutVal int) (*SJWTCheckInfo, int, error) {
+	if info, ok := sjwtResultCacheGet(identityVal, expireVal, pubkeyPath); ok {
+		end := sjwtSpan("secsipid.check", "secsipid.result_cache", "hit")
+		end(nil)
+		return info, SJWTRetOK, nil
+	}
+	end := sjwtSpan("secsipid.check")
+	sjwtDegradedAdd(&degradedStats.Checks)
+	info := &SJWTCheckInfo{}
+	ret, err := sjwtCheckFullIdentity(ctx, identityVal, expireVal, pubkeyPath, timeoutVal, info)
+	if err == nil && ret == SJWTRetOK {
+		sjwtResultCacheSet(identityVal, expireVal, pubkeyPath, info)
+	}
+	if err == nil && ret != SJWTRetOK {
+		end(errCheckFailed(ret))
+	} else {
+		end(err)
+	}
+	return info, ret, err
+}
@@ -0,0 +1,86 @@
+package secsipid
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// sjwtPayloadClaims - names of the claims mapped to the fields of SJWTPayload
+var sjwtPayloadClaims = func() map[string]bool {
+	claims := make(map[string]bool)
+	t := reflect.TypeOf(SJWTPayload{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) > 0 && name != "-" {
+			claims[name] = true
+		}
+	}
+	return claims
+}()
+
+// sjwtPayloadCallback - function called with the payload before signing
+var sjwtPayloadCallback func(payload *SJWTPayload) error = nil
+
+// SJWTSetPayloadCallback - register the function called with the payload
+// before signing the identity, it can add claims to payload.Extra or update
+// the other fields; if it returns an error, the signing fails
+func SJWTSetPayloadCallback(cb func(payload *SJWTPayload) error) {
+	sjwtPayloadCallback = cb
+}
+
+type sjwtPayloadAlias SJWTPayload
+
+// MarshalJSON - serialize the payload with the extra claims, which cannot
+// overwrite the claims mapped to the fields of the structure
+func (p SJWTPayload) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(sjwtPayloadAlias(p))
+	if err != nil || len(p.Extra) == 0 {
+		return data, err
+	}
+	claims := make(map[string]interface{})
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+	for name, value := range p.Extra {
+		if !sjwtPayloadClaims[name] {
+			claims[name] = value
+		}
+	}
+	return json.Marshal(claims)
+}
+
+// UnmarshalJSON - parse the payload, keeping the unknown claims in Extra
+func (p *SJWTPayload) UnmarshalJSON(data []byte) error {
+	vPayload := sjwtPayloadAlias{}
+	if err := json.Unmarshal(data, &vPayload); err != nil {
+		return err
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	for name := range sjwtPayloadClaims {
+		delete(claims, name)
+	}
+	vPayload.Extra = nil
+	if len(claims) > 0 {
+		vPayload.Extra = claims
+	}
+	*p = SJWTPayload(vPayload)
+	return nil
+}
+
+// SJWTGetIdentityClaims - decode the payload of the identity, with the extra
+// claims in the Extra field; the identity is not verified
+func SJWTGetIdentityClaims(identityVal string) (*SJWTPayload, int, error) {
+	parts, ret, err := SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return nil, ret, err
+	}
+	payload := &SJWTPayload{}
+	if err = json.Unmarshal(parts.Payload, payload); err != nil {
+		return nil, SJWTRetErrJSONPayloadParse, err
+	}
+	return payload, SJWTRetOK, nil
+}
@@ -0,0 +1,70 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCustomClaims(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+
+	t.Run("OK with extra claims preserved", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		payload := secsipid.SJWTPayload{}
+		err := json.Unmarshal([]byte(`{"attest":"B","dest":{"tn":["2"]},"iat":10,"orig":{"tn":"1"},"origid":"abc","sph":"0101"}`), &payload)
+		expect(err).ToBe(nil)
+		expect(payload.ATTest).ToBe("B")
+		expect(payload.Extra).ToEqual(map[string]interface{}{"sph": "0101"})
+
+		data, _ := json.Marshal(payload)
+		expect(string(data)).ToBe(`{"attest":"B","dest":{"tn":["2"]},"iat":10,"orig":{"tn":"1"},"origid":"abc","sph":"0101"}`)
+	})
+
+	t.Run("OK with extra claims not overwriting payload fields", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := secsipid.SJWTGetIdentityPayloadPrvKey(secsipid.SJWTPayload{
+			ATTest: "A",
+			Dest:   secsipid.SJWTDest{TN: []string{"493022222222"}},
+			Orig:   secsipid.SJWTOrig{TN: "493011111111"},
+			Extra:  map[string]interface{}{"attest": "C", "cid": "x1"},
+		}, "", prvkey)
+
+		payload, ret, _ := secsipid.SJWTGetIdentityClaims(identity)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(payload.ATTest).ToBe("A")
+		expect(payload.Extra).ToEqual(map[string]interface{}{"cid": "x1"})
+	})
+
+	t.Run("OK with claims from payload callback", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTSetPayloadCallback(func(payload *secsipid.SJWTPayload) error {
+			payload.Extra = map[string]interface{}{"tenant": "t1"}
+			return nil
+		})
+		defer secsipid.SJWTSetPayloadCallback(nil)
+
+		identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "", prvkey)
+		payload, _, _ := secsipid.SJWTGetIdentityClaims(identity)
+		expect(payload.Extra).ToEqual(map[string]interface{}{"tenant": "t1"})
+	})
+
+	t.Run("ErrJSONPayloadParse with failing payload callback", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTSetPayloadCallback(func(payload *secsipid.SJWTPayload) error {
+			return errors.New("tenant not found")
+		})
+		defer secsipid.SJWTSetPayloadCallback(nil)
+
+		_, ret, err := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadParse)
+		expect(getMsgFromErr(err)).ToBe("tenant not found")
+	})
+}
@@ -0,0 +1,124 @@
+package secsipid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SJWTGetIdentityPayloadPrvKeyForms - build the shaken identity for the
+// payload in both the full form and the compact form (RFC 8224, section 7);
+// the PASSporT is signed once, with canonical JSON and a header that can be
+// rebuilt from the parameters, so the full form is valid for the compact one
+func SJWTGetIdentityPayloadPrvKeyForms(payload SJWTPayload, x5uVal string, prvkeyData []byte) (string, string, int, error) {
+	identityVal, ret, err := sjwtGetIdentityPayload(payload, x5uVal, prvkeyData, true)
+	if err != nil {
+		return "", "", ret, err
+	}
+	compactVal, ret, err := SJWTIdentityCompact(identityVal)
+	if err != nil {
+		return "", "", ret, err
+	}
+	return identityVal, compactVal, SJWTRetOK, nil
+}
+
+// SJWTGetIdentityPayloadForms - like SJWTGetIdentityPayloadPrvKeyForms(),
+// with the path to private key
+func SJWTGetIdentityPayloadForms(payload SJWTPayload, x5uVal string, prvkeyPath string) (string, string, int, error) {
+	prvkey, err := SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return "", "", SJWTRetErrFileRead, fmt.Errorf("Unable to read private key file: %v", err)
+	}
+	return SJWTGetIdentityPayloadPrvKeyForms(payload, x5uVal, prvkey)
+}
+
+// SJWTIdentityIsCompact - true if the Identity header value has the compact
+// form (empty header and payload in the token)
+func SJWTIdentityIsCompact(identityVal string) bool {
+	return strings.HasPrefix(SJWTRemoveWhiteSpaces(identityVal), "..")
+}
+
+// sjwtCompactHeader - the canonical PASSporT header rebuilt from the
+// parameters of the Identity header value
+func sjwtCompactHeader(params []string) (string, error) {
+	header := map[string]string{"alg": "ES256", "ppt": "shaken", "typ": "passport"}
+	for _, param := range params {
+		ptoken := strings.SplitN(param, "=", 2)
+		if len(ptoken) != 2 {
+			continue
+		}
+		switch ptoken[0] {
+		case "info":
+			header["x5u"] = strings.TrimSuffix(strings.TrimPrefix(ptoken[1], "<"), ">")
+		case "alg":
+			header["alg"] = ptoken[1]
+		case "ppt":
+			header["ppt"] = strings.Trim(ptoken[1], "\"")
+		}
+	}
+	if len(header["x5u"]) == 0 {
+		return "", errors.New("missing info parameter")
+	}
+	hdrJSON, _ := json.Marshal(header)
+	canonical, err := SJWTCanonicalJSON(hdrJSON)
+	if err != nil {
+		return "", err
+	}
+	return string(canonical), nil
+}
+
+// SJWTIdentityCompact - the compact form of the Identity header value, with
+// the header and payload removed from the token; the header must be the one
+// rebuilt from the parameters and the JSON must be canonical, otherwise the
+// verifier cannot reconstruct the signed content
+func SJWTIdentityCompact(identityVal string) (string, int, error) {
+	parts, ret, err := SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return "", ret, err
+	}
+	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
+	btoken := strings.Split(hdrtoken[0], ".")
+	rebuilt, err := sjwtCompactHeader(hdrtoken[1:])
+	if err != nil {
+		return "", SJWTRetErrSIPHdrInfo, err
+	}
+	header, _ := SJWTBase64DecodeString(btoken[0])
+	if header != rebuilt {
+		return "", SJWTRetErrJSONHdrParse, errors.New("header cannot be rebuilt from the parameters")
+	}
+	canonical, err := SJWTCanonicalJSON(parts.Payload)
+	if err != nil {
+		return "", SJWTRetErrJSONPayloadParse, err
+	}
+	if !bytes.Equal(canonical, parts.Payload) {
+		return "", SJWTRetErrJSONPayloadParse, errors.New("payload not in canonical form")
+	}
+	hdrtoken[0] = ".." + btoken[2]
+	return strings.Join(hdrtoken, ";"), SJWTRetOK, nil
+}
+
+// SJWTIdentityExpand - the full form of the compact Identity header value,
+// with the header rebuilt from the parameters and the payload from the claims
+// supplied out-of-band (JSON), both in canonical form
+func SJWTIdentityExpand(identityVal string, claimsJSON []byte) (string, int, error) {
+	if ret, err := sjwtCheckLimits(identityVal); err != nil {
+		return "", ret, err
+	}
+	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
+	btoken := strings.Split(hdrtoken[0], ".")
+	if len(btoken) != 3 || len(btoken[0]) > 0 || len(btoken[1]) > 0 || len(btoken[2]) == 0 {
+		return "", SJWTRetErrSIPHdrParse, errors.New("invalid token - must be in compact form")
+	}
+	header, err := sjwtCompactHeader(hdrtoken[1:])
+	if err != nil {
+		return "", SJWTRetErrSIPHdrInfo, err
+	}
+	payload, err := SJWTCanonicalJSON(claimsJSON)
+	if err != nil {
+		return "", SJWTRetErrJSONPayloadParse, err
+	}
+	hdrtoken[0] = SJWTBase64EncodeString(header) + "." + SJWTBase64EncodeString(string(payload)) + "." + btoken[2]
+	return strings.Join(hdrtoken, ";"), SJWTRetOK, nil
+}
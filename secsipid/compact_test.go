@@ -0,0 +1,75 @@
+package secsipid_test
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCompactForm(t *testing.T) {
+	cert, key := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Compact Signer"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}, nil, nil)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	prvBytes, _ := x509.MarshalECPrivateKey(key)
+	prvkey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes})
+	payload := secsipid.SJWTPayload{ATTest: "A", Dest: secsipid.SJWTDest{TN: []string{"493022222222"}},
+		Orig: secsipid.SJWTOrig{TN: "493011111111"}}
+	x5u := "https://certs.example.com/cert.pem?a=1&b=2"
+
+	full, compact, ret, err := secsipid.SJWTGetIdentityPayloadPrvKeyForms(payload, x5u, prvkey)
+	claims, _ := secsipid.SJWTBase64DecodeString(strings.Split(full, ".")[1])
+
+	t.Run("OK with both forms", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(secsipid.SJWTIdentityIsCompact(full)).ToBe(false)
+		expect(secsipid.SJWTIdentityIsCompact(compact)).ToBe(true)
+		expect(strings.SplitN(compact, ".", 3)[2]).ToBe(strings.SplitN(full, ".", 3)[2])
+		ret, err = secsipid.SJWTCheckIdentityPKMode(strings.Split(full, ";")[0], 60, certPEM, 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK with expanded compact form", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expanded, ret, err := secsipid.SJWTIdentityExpand(compact, []byte(" {\n"+claims[1:]))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(expanded).ToBe(full)
+		ret, _ = secsipid.SJWTCheckIdentityPKMode(strings.Split(expanded, ";")[0], 60, certPEM, 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrJSONSignatureInvalid with other claims", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expanded, _, _ := secsipid.SJWTIdentityExpand(compact, []byte(strings.Replace(claims, "493011111111", "493011111112", 1)))
+		ret, _ := secsipid.SJWTCheckIdentityPKMode(strings.Split(expanded, ";")[0], 60, certPEM, 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+
+	t.Run("ErrSIPHdrParse expanding full form", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTIdentityExpand(full, []byte(claims))
+		expect(ret).ToBe(secsipid.SJWTRetErrSIPHdrParse)
+	})
+
+	t.Run("ErrJSONHdrParse with thumbprint in header", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		header := `{"alg":"ES256","ppt":"shaken","typ":"passport","x5t#S256":"abc","x5u":"` + x5u + `"}`
+		token, _, _ := secsipid.SJWTEncodeTextWithPrvKey(header, claims, string(prvkey))
+		_, ret, _ := secsipid.SJWTIdentityCompact(token + ";info=<" + x5u + ">;alg=ES256;ppt=shaken")
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONHdrParse)
+	})
+}
@@ -0,0 +1,57 @@
+package secsipid
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SJWTGetConnectedIdentityPrvKey - build the connected identity to be sent in
+// responses or UPDATE requests, asserting the identity of the answering party:
+// the orig of the PASSporT is the connected number and the dest is the number
+// of the caller (reverse of the call direction)
+func SJWTGetConnectedIdentityPrvKey(callerTN string, connectedTN string, attestVal string, origID string, x5uVal string, prvkeyData []byte) (string, int, error) {
+	return SJWTGetIdentityPrvKey(connectedTN, callerTN, attestVal, origID, x5uVal, prvkeyData)
+}
+
+// SJWTGetConnectedIdentity - like SJWTGetConnectedIdentityPrvKey(), with the path to private key
+func SJWTGetConnectedIdentity(callerTN string, connectedTN string, attestVal string, origID string, x5uVal string, prvkeyPath string) (string, int, error) {
+	prvkey, err := SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return "", SJWTRetErrFileRead, fmt.Errorf("Unable to read private key file: %v", err)
+	}
+	return SJWTGetConnectedIdentityPrvKey(callerTN, connectedTN, attestVal, origID, x5uVal, prvkey)
+}
+
+// SJWTCheckConnectedIdentity - verify the connected identity received in a
+// response or UPDATE request: the dest of the PASSporT has to be the number of
+// the caller and, if connectedTN is not empty, the orig has to be the connected
+// number (it can differ from the called number when the call was retargeted)
+func SJWTCheckConnectedIdentity(identityVal string, callerTN string, connectedTN string, expireVal int, pubkeyPath string, timeoutVal int) (int, error) {
+	ret, err := SJWTCheckFullIdentity(identityVal, expireVal, pubkeyPath, timeoutVal)
+	if ret != SJWTRetOK {
+		return ret, err
+	}
+
+	parts, ret, err := SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return ret, err
+	}
+	payload := SJWTPayload{}
+	if err = json.Unmarshal(parts.Payload, &payload); err != nil {
+		return SJWTRetErrJSONPayloadParse, err
+	}
+	destMatch := false
+	for _, tn := range payload.Dest.TN {
+		if SJWTNormalizeTN(tn) == SJWTNormalizeTN(callerTN) {
+			destMatch = true
+			break
+		}
+	}
+	if !destMatch {
+		return SJWTRetErrConnectedDest, fmt.Errorf("connected identity dest not matching caller %s", callerTN)
+	}
+	if len(connectedTN) > 0 && SJWTNormalizeTN(payload.Orig.TN) != SJWTNormalizeTN(connectedTN) {
+		return SJWTRetErrConnectedOrig, fmt.Errorf("connected identity orig %s not matching %s", payload.Orig.TN, connectedTN)
+	}
+	return SJWTRetOK, nil
+}
@@ -0,0 +1,47 @@
+package secsipid_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCheckConnectedIdentity(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	os.WriteFile("dummyConnPubKey.pem", pubkey, 0640)
+	defer os.Remove("dummyConnPubKey.pem")
+
+	connected, _, _ := secsipid.SJWTGetConnectedIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+
+	t.Run("OK with reversed orig and dest", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, err := secsipid.SJWTCheckConnectedIdentity(connected, "+49 301 111 1111", "493022222222", 60, "dummyConnPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("OK without expected connected number", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTCheckConnectedIdentity(connected, "493011111111", "", 60, "dummyConnPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrConnectedDest with other caller", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, err := secsipid.SJWTCheckConnectedIdentity(connected, "493033333333", "", 60, "dummyConnPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrConnectedDest)
+		expect(getMsgFromErr(err)).ToBe("connected identity dest not matching caller 493033333333")
+	})
+
+	t.Run("ErrConnectedOrig with other connected number", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTCheckConnectedIdentity(connected, "493011111111", "493044444444", 60, "dummyConnPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrConnectedOrig)
+	})
+}
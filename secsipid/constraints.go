@@ -0,0 +1,138 @@
+package secsipid
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// id-pe-JWTClaimConstraints (RFC 8226)
+	oidJWTClaimConstraints = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 27}
+	// id-pe-eJWTClaimConstraints (RFC 9118)
+	oidEnhancedJWTClaimConstraints = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 33}
+)
+
+type asn1JWTClaimValues struct {
+	Claim  string
+	Values []string
+}
+
+type asn1JWTClaimConstraints struct {
+	MustInclude     []string             `asn1:"optional,explicit,tag:0"`
+	PermittedValues []asn1JWTClaimValues `asn1:"optional,explicit,tag:1"`
+	MustExclude     []string             `asn1:"optional,explicit,tag:2"`
+}
+
+// SJWTClaimConstraints - JWT claim constraints from the certificate extension
+// of a delegate or third-party signer
+type SJWTClaimConstraints struct {
+	MustInclude     []string
+	PermittedValues map[string][]string
+	MustExclude     []string
+}
+
+// SJWTGetClaimConstraints - parse the (enhanced) JWT claim constraints extension
+// of the first certificate in PEM data, returns nil if there is no such extension
+func SJWTGetClaimConstraints(certPEM []byte) (*SJWTClaimConstraints, int, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, SJWTRetOK, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, SJWTRetErrCertInvalidFormat, err
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidJWTClaimConstraints) && !ext.Id.Equal(oidEnhancedJWTClaimConstraints) {
+			continue
+		}
+		vConstraints := asn1JWTClaimConstraints{}
+		if _, err = asn1.Unmarshal(ext.Value, &vConstraints); err != nil {
+			return nil, SJWTRetErrCertInvalidFormat, fmt.Errorf("invalid jwt claim constraints: %v", err)
+		}
+		constraints := &SJWTClaimConstraints{
+			MustInclude:     vConstraints.MustInclude,
+			PermittedValues: make(map[string][]string),
+			MustExclude:     vConstraints.MustExclude,
+		}
+		for _, permitted := range vConstraints.PermittedValues {
+			constraints.PermittedValues[permitted.Claim] = permitted.Values
+		}
+		return constraints, SJWTRetOK, nil
+	}
+	return nil, SJWTRetOK, nil
+}
+
+// sjwtClaimValue - the claim value as string, JSON objects and arrays are
+// serialized in compact form with sorted keys
+func sjwtClaimValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// SJWTCheckClaimConstraints - enforce the JWT claim constraints of the signer
+// certificate on the PASSporT payload, all violations are listed in the error
+func SJWTCheckClaimConstraints(certPEM []byte, payloadJSON []byte) (int, error) {
+	constraints, ret, err := SJWTGetClaimConstraints(certPEM)
+	if constraints == nil {
+		return ret, err
+	}
+	claims := make(map[string]interface{})
+	if err = json.Unmarshal(payloadJSON, &claims); err != nil {
+		return SJWTRetErrJSONPayloadParse, err
+	}
+
+	var violations []string
+	for _, name := range constraints.MustInclude {
+		if _, ok := claims[name]; !ok {
+			violations = append(violations, "missing claim "+name)
+		}
+	}
+	for _, name := range constraints.MustExclude {
+		if _, ok := claims[name]; ok {
+			violations = append(violations, "excluded claim "+name)
+		}
+	}
+	for name, permitted := range constraints.PermittedValues {
+		value, ok := claims[name]
+		if !ok {
+			continue
+		}
+		vValue := sjwtClaimValue(value)
+		found := false
+		for _, pValue := range permitted {
+			if pValue == vValue {
+				found = true
+				break
+			}
+		}
+		if !found {
+			violations = append(violations, "not permitted value for claim "+name)
+		}
+	}
+	if len(violations) > 0 {
+		return SJWTRetErrCertConstraints, errors.New("jwt claim constraints violated: " + strings.Join(violations, ", "))
+	}
+	return SJWTRetOK, nil
+}
+
+// sjwtCheckPayloadConstraints - enforce the claim constraints on the base64 encoded payload
+func sjwtCheckPayloadConstraints(certPEM []byte, base64Payload string) (int, error) {
+	end := sjwtSpan("secsipid.claims")
+	payloadJSON, err := SJWTBase64DecodeBytes(base64Payload)
+	if err != nil {
+		end(err)
+		return SJWTRetErrJSONPayloadParse, err
+	}
+	ret, err := SJWTCheckClaimConstraints(certPEM, payloadJSON)
+	end(err)
+	return ret, err
+}
@@ -0,0 +1,88 @@
+package secsipid_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+type testJWTClaimValues struct {
+	Claim  string `asn1:"ia5"`
+	Values []string
+}
+
+type testJWTClaimConstraints struct {
+	MustInclude     []string             `asn1:"optional,explicit,tag:0"`
+	PermittedValues []testJWTClaimValues `asn1:"optional,explicit,tag:1"`
+	MustExclude     []string             `asn1:"optional,explicit,tag:2"`
+}
+
+func generateConstrainedCertPEM(constraints testJWTClaimConstraints) ([]byte, []byte) {
+	prvkey, _, key := generateECKeyPEMs()
+	extValue, _ := asn1.Marshal(constraints)
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2023),
+		Subject:      pkix.Name{Organization: []string{"Delegate, Inc."}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 33}, Value: extValue},
+		},
+	}
+	certBytes, _ := x509.CreateCertificate(rand.Reader, cert, cert, &key.PublicKey, key)
+	return prvkey, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+}
+
+func TestCheckClaimConstraints(t *testing.T) {
+	prvkey, certPEM := generateConstrainedCertPEM(testJWTClaimConstraints{
+		MustInclude: []string{"rcd"},
+		PermittedValues: []testJWTClaimValues{
+			{Claim: "rcd", Values: []string{`{"nam":"Example Corp"}`}},
+		},
+		MustExclude: []string{"mky"},
+	})
+	header := `{"alg":"ES256","ppt":"shaken","typ":"passport","x5u":"https://certs.example.com/cert.pem"}`
+	getToken := func(payload string) string {
+		token, _, _ := secsipid.SJWTEncodeTextWithPrvKey(header, payload, string(prvkey))
+		return token
+	}
+
+	t.Run("OK with permitted rcd", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		token := getToken(`{"attest":"A","dest":{"tn":["493022222222"]},"iat":` + strconv.FormatInt(time.Now().Unix(), 10) +
+			`,"orig":{"tn":"493011111111"},"origid":"abc","rcd":{"nam":"Example Corp"}}`)
+		ret, err := secsipid.SJWTCheckIdentityPKMode(token, 60, string(certPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("ErrCertConstraints with other rcd", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		token := getToken(`{"attest":"A","dest":{"tn":["493022222222"]},"iat":` + strconv.FormatInt(time.Now().Unix(), 10) +
+			`,"orig":{"tn":"493011111111"},"origid":"abc","rcd":{"nam":"Other Corp"}}`)
+		ret, err := secsipid.SJWTCheckIdentityPKMode(token, 60, string(certPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertConstraints)
+		expect(getMsgFromErr(err)).ToBe("jwt claim constraints violated: not permitted value for claim rcd")
+	})
+
+	t.Run("ErrCertConstraints with missing and excluded claims", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		token := getToken(`{"attest":"A","dest":{"tn":["493022222222"]},"iat":` + strconv.FormatInt(time.Now().Unix(), 10) +
+			`,"mky":[],"orig":{"tn":"493011111111"},"origid":"abc"}`)
+		ret, err := secsipid.SJWTCheckIdentityPKMode(token, 60, string(certPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertConstraints)
+		expect(getMsgFromErr(err)).ToBe("jwt claim constraints violated: missing claim rcd, excluded claim mky")
+	})
+}
@@ -0,0 +1,285 @@
+package secsipid
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// index of the serial numbers of the revoked certificates from the CRL file,
+// loaded again only when the file changes
+var crlIndex = struct {
+	sync.RWMutex
+	path    string
+	mtime   time.Time
+	size    int64
+	serials map[string]struct{}
+	info    sjwtCRLInfo
+	gen     int
+}{}
+
+// sjwtCRLInfo - the issuer and the update times of the CRL
+type sjwtCRLInfo struct {
+	issuer     string
+	thisUpdate time.Time
+	nextUpdate time.Time
+}
+
+// DER tags used in the CRL
+const (
+	derTagInteger   = 0x02
+	derTagSequence  = 0x30
+	derTagUTCTime   = 0x17
+	derTagGenTime   = 0x18
+	derTagContext0  = 0xa0
+	derMaxLenOctets = 4
+)
+
+// sjwtDERReadHeader - read the tag and the length of the next DER element
+func sjwtDERReadHeader(r *bufio.Reader) (byte, int64, int64, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if b < 0x80 {
+		return tag, int64(b), 2, nil
+	}
+	octets := int(b & 0x7f)
+	if octets == 0 || octets > derMaxLenOctets {
+		return 0, 0, 0, errors.New("invalid DER length")
+	}
+	var length int64
+	for i := 0; i < octets; i++ {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, 0, 0, err
+		}
+		length = length<<8 | int64(b)
+	}
+	return tag, length, int64(2 + octets), nil
+}
+
+// sjwtDERSkip - skip the content of DER element
+func sjwtDERSkip(r *bufio.Reader, length int64) error {
+	_, err := io.CopyN(ioutil.Discard, r, length)
+	return err
+}
+
+// sjwtCRLSerialKey - the key of the serial number in the index, its
+// big-endian bytes without the leading zeros
+func sjwtCRLSerialKey(serial []byte) string {
+	return string(bytes.TrimLeft(serial, "\x00"))
+}
+
+// sjwtDERReadValue - read the content of DER element, returned with its
+// header for decoding
+func sjwtDERReadValue(r *bufio.Reader, tag byte, length int64) ([]byte, error) {
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{Class: int(tag>>6) & 0x03, Tag: int(tag & 0x1f),
+		IsCompound: tag&0x20 != 0, Bytes: content})
+}
+
+// sjwtCRLParse - the serial numbers of the revoked certificates from the DER
+// encoded CRL, read as stream without building the whole certificate list,
+// and the issuer and the update times
+func sjwtCRLParse(r *bufio.Reader) (map[string]struct{}, *sjwtCRLInfo, error) {
+	serials := map[string]struct{}{}
+	info := &sjwtCRLInfo{}
+	// CertificateList and TBSCertList sequences
+	for i := 0; i < 2; i++ {
+		if tag, _, _, err := sjwtDERReadHeader(r); err != nil || tag != derTagSequence {
+			return nil, nil, errors.New("invalid CRL structure")
+		}
+	}
+	// version and signature are skipped, issuer, thisUpdate and nextUpdate are
+	// decoded, up to the sequence of the revoked certificates (the third one)
+	seqs := 0
+	for {
+		tag, length, _, err := sjwtDERReadHeader(r)
+		if err != nil {
+			return nil, nil, errors.New("invalid CRL structure")
+		}
+		if tag == derTagSequence {
+			seqs++
+			if seqs == 2 {
+				value, err := sjwtDERReadValue(r, tag, length)
+				if err != nil {
+					return nil, nil, err
+				}
+				var rdn pkix.RDNSequence
+				if _, err = asn1.Unmarshal(value, &rdn); err != nil {
+					return nil, nil, errors.New("invalid CRL issuer")
+				}
+				var name pkix.Name
+				name.FillFromRDNSequence(&rdn)
+				info.issuer = name.String()
+				continue
+			}
+			if seqs == 3 {
+				for length > 0 {
+					etag, elength, ehlen, err := sjwtDERReadHeader(r)
+					if err != nil || etag != derTagSequence {
+						return nil, nil, errors.New("invalid CRL entry")
+					}
+					stag, slength, shlen, err := sjwtDERReadHeader(r)
+					if err != nil || stag != derTagInteger || slength > elength-shlen {
+						return nil, nil, errors.New("invalid CRL entry serial number")
+					}
+					serial := make([]byte, slength)
+					if _, err = io.ReadFull(r, serial); err != nil {
+						return nil, nil, err
+					}
+					serials[sjwtCRLSerialKey(serial)] = struct{}{}
+					if err = sjwtDERSkip(r, elength-shlen-slength); err != nil {
+						return nil, nil, err
+					}
+					length -= ehlen + elength
+				}
+				return serials, info, nil
+			}
+		} else if tag == derTagContext0 {
+			// extensions after thisUpdate/nextUpdate, no revoked certificates
+			return serials, info, nil
+		} else if tag == derTagUTCTime || tag == derTagGenTime {
+			value, err := sjwtDERReadValue(r, tag, length)
+			if err != nil {
+				return nil, nil, err
+			}
+			var t time.Time
+			if _, err = asn1.Unmarshal(value, &t); err != nil {
+				return nil, nil, errors.New("invalid CRL update time")
+			}
+			if info.thisUpdate.IsZero() {
+				info.thisUpdate = t
+			} else {
+				info.nextUpdate = t
+			}
+			continue
+		} else if tag != derTagInteger {
+			return nil, nil, fmt.Errorf("unexpected CRL element: 0x%02x", tag)
+		}
+		if err = sjwtDERSkip(r, length); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// sjwtCRLLoad - load the index of the CRL file, in DER or PEM format
+func sjwtCRLLoad(filePath string) (map[string]struct{}, *sjwtCRLInfo, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 64*1024)
+	if head, _ := r.Peek(10); bytes.HasPrefix(head, []byte("-----BEGIN")) {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, nil, errors.New("invalid CRL PEM data")
+		}
+		r = bufio.NewReader(bytes.NewReader(block.Bytes))
+	}
+	return sjwtCRLParse(r)
+}
+
+// sjwtCRLRefresh - load the index again if the CRL file was changed (or
+// always if force is set)
+func sjwtCRLRefresh(force bool) (int, error) {
+	filePath := globalLibOptions.certCRLFile
+	fileStat, err := os.Stat(filePath)
+	if err != nil {
+		return SJWTRetErrCertReadCRLFile, errors.New("failed to read CRL file")
+	}
+	crlIndex.RLock()
+	changed := force || crlIndex.serials == nil || crlIndex.path != filePath ||
+		!crlIndex.mtime.Equal(fileStat.ModTime()) || crlIndex.size != fileStat.Size()
+	crlIndex.RUnlock()
+	if !changed {
+		return SJWTRetOK, nil
+	}
+	serials, info, err := sjwtCRLLoad(filePath)
+	if err != nil {
+		return SJWTRetErrCertReadCRLFile, fmt.Errorf("failed to read CRL file: %v", err)
+	}
+	crlIndex.Lock()
+	crlIndex.path, crlIndex.mtime, crlIndex.size = filePath, fileStat.ModTime(), fileStat.Size()
+	crlIndex.serials = serials
+	crlIndex.info = *info
+	crlIndex.Unlock()
+	return SJWTRetOK, nil
+}
+
+// sjwtCRLRevoked - check the certificate against the index of the CRL file,
+// which is refreshed here only if it is not done periodically (CRLRefresh)
+func sjwtCRLRevoked(certVal *x509.Certificate) (int, error) {
+	crlIndex.RLock()
+	loaded := crlIndex.serials != nil && crlIndex.path == globalLibOptions.certCRLFile
+	crlIndex.RUnlock()
+	if !loaded || globalLibOptions.crlRefresh <= 0 {
+		if ret, err := sjwtCRLRefresh(false); err != nil {
+			return ret, err
+		}
+	}
+	crlIndex.RLock()
+	_, revoked := crlIndex.serials[sjwtCRLSerialKey(certVal.SerialNumber.Bytes())]
+	crlIndex.RUnlock()
+	if revoked {
+		return SJWTRetErrCertRevoked, errors.New("serial number match - certificate is revoked")
+	}
+	return SJWTRetOK, nil
+}
+
+// sjwtCRLRefresher - start the periodic refresh of the CRL index, stopping
+// the previous one
+func sjwtCRLRefresher(interval int) {
+	crlIndex.Lock()
+	crlIndex.gen++
+	gen := crlIndex.gen
+	crlIndex.Unlock()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(time.Duration(interval) * time.Second)
+			crlIndex.RLock()
+			stopped := crlIndex.gen != gen
+			crlIndex.RUnlock()
+			if stopped {
+				return
+			}
+			if len(globalLibOptions.certCRLFile) > 0 {
+				sjwtCRLRefresh(false)
+			}
+		}
+	}()
+}
+
+// SJWTCRLReload - load again the index of the CRL file, out of the
+// verification of the certificates
+func SJWTCRLReload() (int, error) {
+	if len(globalLibOptions.certCRLFile) == 0 {
+		return SJWTRetErrCertNoCRLFile, errors.New("no CRL file")
+	}
+	return sjwtCRLRefresh(true)
+}
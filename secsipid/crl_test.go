@@ -0,0 +1,88 @@
+package secsipid_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCRLIndex(t *testing.T) {
+	root, rootKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "CRL Root"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0), IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature}, nil, nil)
+	// serial number with the high bit set, encoded with a leading zero in DER
+	leafSerial := new(big.Int).SetBytes([]byte{0x80, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07})
+	leaf, _ := generateAIACert(&x509.Certificate{SerialNumber: leafSerial, Subject: pkix.Name{CommonName: "CRL Leaf"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0),
+		KeyUsage: x509.KeyUsageDigitalSignature}, root, rootKey)
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	writeCRL := func(number int64, revokeLeaf bool) {
+		var revoked []pkix.RevokedCertificate
+		for i := int64(1000); i < 6000; i++ {
+			revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(i), RevocationTime: time.Now()})
+		}
+		if revokeLeaf {
+			revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: leafSerial, RevocationTime: time.Now()})
+		}
+		der, _ := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{Number: big.NewInt(number),
+			RevokedCertificates: revoked, ThisUpdate: time.Now(), NextUpdate: time.Now().AddDate(0, 0, 7)}, root, rootKey)
+		os.WriteFile("dummyCRLIndex.crl", pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0640)
+	}
+
+	os.WriteFile("dummyCRLRoot.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0640)
+	defer os.Remove("dummyCRLRoot.pem")
+	defer os.Remove("dummyCRLIndex.crl")
+	secsipid.SJWTLibOptSetS("CertCAFile", "dummyCRLRoot.pem")
+	defer secsipid.SJWTLibOptSetS("CertCAFile", "")
+	secsipid.SJWTLibOptSetS("CertCRLFile", "dummyCRLIndex.crl")
+	defer secsipid.SJWTLibOptSetS("CertCRLFile", "")
+	secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA|secsipid.CertVerifyOptCRL)
+	defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	t.Run("ErrCertRevoked with PEM CRL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		writeCRL(1, true)
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertRevoked)
+	})
+
+	t.Run("OK with CRL file changed", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		writeCRL(2, false)
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK with periodic refresh until reload", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CRLRefresh", 3600)
+		defer secsipid.SJWTLibOptSetN("CRLRefresh", 0)
+		writeCRL(3, true)
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		ret, _ = secsipid.SJWTCRLReload()
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		ret, _ = secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertRevoked)
+	})
+
+	t.Run("ErrCertReadCRLFile with invalid CRL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyCRLIndex.crl", []byte("invalid CRL content"), 0640)
+		ret, _ := secsipid.SJWTCRLReload()
+		expect(ret).ToBe(secsipid.SJWTRetErrCertReadCRLFile)
+	})
+}
@@ -0,0 +1,55 @@
+package secsipid_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestCheckDeadline(t *testing.T) {
+	prvkey, _ := generateSPCCertPEM("1234")
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "http://localhost:5555/cert.pem", prvkey)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	stopTestServer := startTestServer(handler)
+	defer stopTestServer()
+
+	t.Run("ErrHTTPTimeout when the deadline expires while fetching", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		ret, err := secsipid.SJWTCheckFullIdentityContext(ctx, identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPTimeout)
+		expect(err != nil).ToBe(true)
+		expect(time.Since(start) < time.Second).ToBe(true)
+	})
+
+	t.Run("ErrHTTPTimeout when the deadline expired before fetching", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		ret, _ := secsipid.SJWTCheckFullIdentityContext(ctx, identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPTimeout)
+	})
+
+	t.Run("OK timeout reason code is for an unavailable verification", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTRetName(secsipid.SJWTRetErrHTTPTimeout)).ToBe("timeout")
+		expect(secsipid.SJWTRetClass(secsipid.SJWTRetErrHTTPTimeout)).ToBe("fetch")
+		expect(secsipid.SJWTRetIsUnavailable(secsipid.SJWTRetErrHTTPTimeout)).ToBe(true)
+	})
+}
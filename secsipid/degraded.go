@@ -0,0 +1,34 @@
+package secsipid
+
+import (
+	"sync/atomic"
+)
+
+// SJWTDegradedStats - the number of the identity verifications and of the
+// ones done via degraded paths: the certificate only from the cache (the
+// repository not contacted), a revocation check accepted by the soft-fail
+// policy and a pinned key used because the certificate cannot be fetched
+type SJWTDegradedStats struct {
+	Checks   uint64 `json:"checks"`
+	Cache    uint64 `json:"cache"`
+	SoftFail uint64 `json:"softfail"`
+	Pin      uint64 `json:"pin"`
+}
+
+var degradedStats SJWTDegradedStats
+
+// SJWTDegradedGetStats - the counters of the verifications and of the
+// degraded paths, since the start of the process
+func SJWTDegradedGetStats() SJWTDegradedStats {
+	return SJWTDegradedStats{
+		Checks:   atomic.LoadUint64(&degradedStats.Checks),
+		Cache:    atomic.LoadUint64(&degradedStats.Cache),
+		SoftFail: atomic.LoadUint64(&degradedStats.SoftFail),
+		Pin:      atomic.LoadUint64(&degradedStats.Pin),
+	}
+}
+
+// sjwtDegradedAdd - count the verification or the degraded path
+func sjwtDegradedAdd(counter *uint64) {
+	atomic.AddUint64(counter, 1)
+}
@@ -0,0 +1,94 @@
+package secsipid_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestDegradedStats(t *testing.T) {
+	prvkey, cert := generateSPCCertPEM("1234")
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+	defer secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "http://localhost:5555/degraded.pem", prvkey)
+
+	t.Run("OK cache not counted when the certificate is fresh in the cache", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cacheDir, _ := ioutil.TempDir("", "secsipid-degraded")
+		defer os.RemoveAll(cacheDir)
+		secsipid.SJWTLibOptSetS("CacheDirPath", cacheDir)
+		defer secsipid.SJWTLibOptSetS("CacheDirPath", "")
+		secsipid.SJWTSetURLCachedContent("http://localhost:5555/degraded.pem", cert)
+
+		before := secsipid.SJWTDegradedGetStats()
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		after := secsipid.SJWTDegradedGetStats()
+		expect(after.Checks - before.Checks).ToBe(uint64(1))
+		expect(after.Cache - before.Cache).ToBe(uint64(0))
+		expect(after.Pin - before.Pin).ToBe(uint64(0))
+	})
+
+	t.Run("OK cache counted when the expired certificate is used after fetch failure", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cacheDir, _ := ioutil.TempDir("", "secsipid-degraded")
+		defer os.RemoveAll(cacheDir)
+		secsipid.SJWTLibOptSetS("CacheDirPath", cacheDir)
+		defer secsipid.SJWTLibOptSetS("CacheDirPath", "")
+		secsipid.SJWTLibOptSetN("CacheStaleIfError", 86400)
+		defer secsipid.SJWTLibOptSetN("CacheStaleIfError", 0)
+		secsipid.SJWTSetURLCachedContent("http://localhost:5555/degraded.pem", cert)
+		expired := time.Now().Add(-2 * time.Hour)
+		os.Chtimes(secsipid.SJWTGetURLCacheFilePath("http://localhost:5555/degraded.pem"), expired, expired)
+
+		before := secsipid.SJWTDegradedGetStats()
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		after := secsipid.SJWTDegradedGetStats()
+		expect(after.Checks - before.Checks).ToBe(uint64(1))
+		expect(after.Cache - before.Cache).ToBe(uint64(1))
+	})
+
+	t.Run("ErrHTTPGet with expired certificate when stale use is disabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cacheDir, _ := ioutil.TempDir("", "secsipid-degraded")
+		defer os.RemoveAll(cacheDir)
+		secsipid.SJWTLibOptSetS("CacheDirPath", cacheDir)
+		defer secsipid.SJWTLibOptSetS("CacheDirPath", "")
+		secsipid.SJWTSetURLCachedContent("http://localhost:5555/degraded.pem", cert)
+		expired := time.Now().Add(-2 * time.Hour)
+		os.Chtimes(secsipid.SJWTGetURLCacheFilePath("http://localhost:5555/degraded.pem"), expired, expired)
+
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPGet)
+	})
+
+	t.Run("OK pin counted when the repository is unreachable", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyDegradedCert.pem", cert, 0640)
+		os.WriteFile("dummyDegradedPins.txt", []byte("localhost dummyDegradedCert.pem\n"), 0640)
+		defer os.Remove("dummyDegradedCert.pem")
+		defer os.Remove("dummyDegradedPins.txt")
+		secsipid.SJWTLibOptSetS("PinFile", "dummyDegradedPins.txt")
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyFallback)
+		defer secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyNone)
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{FetchFail: 100})
+
+		before := secsipid.SJWTDegradedGetStats()
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		after := secsipid.SJWTDegradedGetStats()
+		expect(after.Checks - before.Checks).ToBe(uint64(1))
+		expect(after.Pin - before.Pin).ToBe(uint64(1))
+		expect(after.Cache - before.Cache).ToBe(uint64(0))
+	})
+}
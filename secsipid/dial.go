@@ -0,0 +1,262 @@
+package secsipid
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// address families for fetching the certificates
+const (
+	IPFamilyAny = 0
+	IPFamilyV4  = 4
+	IPFamilyV6  = 6
+)
+
+var (
+	fetchTransportOnce sync.Once
+	fetchTransport     *http.Transport
+)
+
+// sjwtFetchTransport - the HTTP transport for fetching the certificates,
+// dialing with the address family and SRV options of the library
+func sjwtFetchTransport() *http.Transport {
+	fetchTransportOnce.Do(func() {
+		fetchTransport = http.DefaultTransport.(*http.Transport).Clone()
+		fetchTransport.DialContext = sjwtDialContext
+	})
+	return fetchTransport
+}
+
+// sjwtFetchReset - close the idle connections, so the new ones are made with
+// the updated options
+func sjwtFetchReset() {
+	sjwtFetchTransport().CloseIdleConnections()
+	sjwtRepoAuthReset()
+}
+
+// sjwtParseHeaders - the extra headers for fetching the certificates, one
+// 'Name: value' per line
+func sjwtParseHeaders(val string) (http.Header, error) {
+	hdrs := http.Header{}
+	for _, line := range strings.Split(val, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		pos := strings.Index(line, ":")
+		if pos <= 0 || strings.ContainsAny(strings.TrimSpace(line[:pos]), " \t") {
+			return nil, errors.New("invalid header: " + line)
+		}
+		hdrs.Add(strings.TrimSpace(line[:pos]), strings.TrimSpace(line[pos+1:]))
+	}
+	return hdrs, nil
+}
+
+// sjwtFormatHeaders - the extra headers for fetching the certificates, one
+// per line, sorted by name
+func sjwtFormatHeaders(hdrs http.Header) string {
+	names := make([]string, 0, len(hdrs))
+	for name := range hdrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{}
+	for _, name := range names {
+		for _, value := range hdrs[name] {
+			lines = append(lines, name+": "+value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sjwtSRVService - the SRV service name for the port of the URL, only for the
+// default http and https ports
+func sjwtSRVService(port string) string {
+	switch port {
+	case "443":
+		return "https"
+	case "80":
+		return "http"
+	}
+	return ""
+}
+
+// sjwtDialTargets - the host and port pairs to connect to, from the SRV
+// records if enabled and found, otherwise the address itself
+func sjwtDialTargets(ctx context.Context, host string, port string) []string {
+	service := sjwtSRVService(port)
+	if globalLibOptions.fetchSRV == 0 || len(service) == 0 || net.ParseIP(host) != nil {
+		return []string{net.JoinHostPort(host, port)}
+	}
+	_, srvs, err := sjwtDNSResolver().LookupSRV(ctx, service, "tcp", host)
+	if err != nil || len(srvs) == 0 {
+		return []string{net.JoinHostPort(host, port)}
+	}
+	targets := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		// the records are sorted by priority and randomized by weight
+		targets = append(targets, net.JoinHostPort(srv.Target, strconv.Itoa(int(srv.Port))))
+	}
+	return targets
+}
+
+// sjwtDialAddrs - the IP addresses of the host for the address family, with
+// the preferred family first
+func sjwtDialAddrs(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ipAddrs, err := sjwtLookupIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ipAddr := range ipAddrs {
+			ips = append(ips, ipAddr.IP)
+		}
+	}
+	family := globalLibOptions.ipFamily
+	addrs := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if (family == IPFamilyV4 && ip.To4() == nil) || (family == IPFamilyV6 && ip.To4() != nil) {
+			continue
+		}
+		addrs = append(addrs, ip)
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no address of the configured family for host " + host)
+	}
+	if globalLibOptions.ipPrefer != IPFamilyAny {
+		sort.SliceStable(addrs, func(i, j int) bool {
+			return sjwtIPPreferred(addrs[i]) && !sjwtIPPreferred(addrs[j])
+		})
+	}
+	return addrs, nil
+}
+
+func sjwtIPPreferred(ip net.IP) bool {
+	return (ip.To4() != nil) == (globalLibOptions.ipPrefer == IPFamilyV4)
+}
+
+// sjwtLookupIP - resolve the host to its IPv4 (A) and IPv6 (AAAA) addresses,
+// with the internal resolver if the DNS servers or the DNS cache are set
+func sjwtLookupIP(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if sjwtDNSEnabled() {
+		return sjwtDNSLookup(ctx, host)
+	}
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
+
+// sjwtDialContext - connect to the certificate repository, trying the
+// addresses in order; with Happy Eyeballs, the first address of the other
+// family is tried in parallel if there is no connection after the delay
+func sjwtDialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, target := range sjwtDialTargets(ctx, host, port) {
+		thost, tport, _ := net.SplitHostPort(target)
+		addrs, err := sjwtDialAddrs(ctx, thost)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		primary, fallback := addrs, []net.IP(nil)
+		if globalLibOptions.happyEyes > 0 {
+			primary, fallback = nil, nil
+			for _, ip := range addrs {
+				if (ip.To4() != nil) == (addrs[0].To4() != nil) {
+					primary = append(primary, ip)
+				} else {
+					fallback = append(fallback, ip)
+				}
+			}
+		}
+		conn, err := sjwtDialParallel(ctx, network, primary, fallback, tport)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+type sjwtDialResult struct {
+	conn    net.Conn
+	err     error
+	primary bool
+}
+
+// sjwtDialParallel - dial the primary addresses and, after the Happy Eyeballs
+// delay, the fallback addresses in parallel, returning the first connection
+func sjwtDialParallel(ctx context.Context, network string, primary []net.IP, fallback []net.IP, port string) (net.Conn, error) {
+	if len(fallback) == 0 {
+		return sjwtDialSerial(ctx, network, primary, port)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan sjwtDialResult)
+	dial := func(ips []net.IP, isPrimary bool) {
+		conn, err := sjwtDialSerial(ctx, network, ips, port)
+		select {
+		case results <- sjwtDialResult{conn: conn, err: err, primary: isPrimary}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+	go dial(primary, true)
+	timer := time.NewTimer(time.Duration(globalLibOptions.happyEyes) * time.Millisecond)
+	defer timer.Stop()
+	fallbackStarted := false
+	var firstErr error
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go dial(fallback, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if res.primary && !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				timer.Stop()
+				go dial(fallback, false)
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+// sjwtDialSerial - dial the addresses one after the other
+func sjwtDialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,83 @@
+package secsipid_test
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestFetchIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback not available")
+	}
+	server := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("cert"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+	certURL := "http://" + listener.Addr().String() + "/cert.pem"
+	defer secsipid.SJWTLibOptSetN("FetchIPFamily", secsipid.IPFamilyAny)
+
+	t.Run("OK with literal IPv6 host", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		content, ret, _ := secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(content)).ToBe("cert")
+	})
+
+	t.Run("ErrHTTPGet with IPv4 only", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("FetchIPFamily", secsipid.IPFamilyV4)
+		_, ret, err := secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPGet)
+		expect(strings.Contains(err.Error(), "no address of the configured family")).ToBe(true)
+
+		secsipid.SJWTLibOptSetN("FetchIPFamily", secsipid.IPFamilyV6)
+		_, ret, _ = secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+func TestFetchHeaders(t *testing.T) {
+	var reqHeaders http.Header
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqHeaders = r.Header.Clone()
+		w.Write([]byte("cert"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+	certURL := "http://" + listener.Addr().String() + "/cert.pem"
+	defer secsipid.SJWTLibOptSetS("FetchUserAgent", "")
+	defer secsipid.SJWTLibOptSetS("FetchHeaders", "")
+
+	t.Run("OK with user agent and extra headers", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("FetchUserAgent", "secsipid-test/1.0")).ToBe(secsipid.SJWTRetOK)
+		expect(secsipid.SJWTLibOptSetS("FetchHeaders", "Authorization: Bearer abc\nX-Partner: one\nX-Partner: two")).ToBe(secsipid.SJWTRetOK)
+		_, ret, _ := secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(reqHeaders.Get("User-Agent")).ToBe("secsipid-test/1.0")
+		expect(reqHeaders.Get("Authorization")).ToBe("Bearer abc")
+		expect(strings.Join(reqHeaders.Values("X-Partner"), ",")).ToBe("one,two")
+		expect(secsipid.SJWTLibOptGetS("FetchHeaders")).ToBe("Authorization: Bearer abc\nX-Partner: one\nX-Partner: two")
+	})
+
+	t.Run("Err with invalid header", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("FetchHeaders", "no header")).ToBe(secsipid.SJWTRetErr)
+		expect(secsipid.SJWTLibOptGetS("FetchHeaders")).ToBe("Authorization: Bearer abc\nX-Partner: one\nX-Partner: two")
+	})
+}
@@ -0,0 +1,328 @@
+package secsipid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SJWTDiv - diverting party of div PASSporT (RFC 8946)
+type SJWTDiv struct {
+	TN string `json:"tn"`
+}
+
+// SJWTDivPayload - payload of div PASSporT
+type SJWTDivPayload struct {
+	Dest   SJWTDest `json:"dest"`
+	Div    SJWTDiv  `json:"div"`
+	IAT    int64    `json:"iat"`
+	Orig   SJWTOrig `json:"orig"`
+	OrigID string   `json:"origid,omitempty"`
+}
+
+// SJWTIdentityParts - decoded parts of an Identity header value, not verified
+type SJWTIdentityParts struct {
+	Token   string
+	Info    string
+	Header  SJWTHeader
+	Payload []byte
+}
+
+// SJWTParseIdentityParts - split the Identity header value and decode the JSON
+// header of the token, the payload is returned as JSON document
+func SJWTParseIdentityParts(identityVal string) (*SJWTIdentityParts, int, error) {
+	if ret, err := sjwtCheckLimits(identityVal); err != nil {
+		return nil, ret, err
+	}
+	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
+	btoken := strings.Split(hdrtoken[0], ".")
+	if len(btoken) != 3 {
+		return nil, SJWTRetErrSIPHdrParse, errors.New("invalid token - must contain header, payload and signature")
+	}
+	parts := &SJWTIdentityParts{Token: hdrtoken[0]}
+	for i := 1; i < len(hdrtoken); i++ {
+		ptoken := strings.SplitN(hdrtoken[i], "=", 2)
+		if len(ptoken) == 2 && ptoken[0] == "info" {
+			parts.Info = strings.TrimSuffix(strings.TrimPrefix(ptoken[1], "<"), ">")
+		}
+	}
+	vHeader, err := SJWTBase64DecodeString(btoken[0])
+	if err != nil {
+		return nil, SJWTRetErrJSONHdrParse, err
+	}
+	if err = json.Unmarshal([]byte(vHeader), &parts.Header); err != nil {
+		return nil, SJWTRetErrJSONHdrParse, err
+	}
+	vPayload, err := SJWTBase64DecodeString(btoken[1])
+	if err != nil {
+		return nil, SJWTRetErrJSONPayloadParse, err
+	}
+	parts.Payload = []byte(vPayload)
+	return parts, SJWTRetOK, nil
+}
+
+// sjwtEncodeJSON - encode and sign the header and payload structures
+func sjwtEncodeJSON(header interface{}, payload interface{}, prvkeyData []byte) (string, int, error) {
+	hdrJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", SJWTRetErrJSONHdrParse, err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return "", SJWTRetErrJSONPayloadParse, err
+	}
+	return SJWTEncodeTextWithPrvKey(string(hdrJSON), string(payloadJSON), string(prvkeyData))
+}
+
+// sjwtDivCurrentTarget - the shaken PASSporT out of the Identity header values
+// of the call (one shaken and optionally div ones from previous diversions),
+// the div PASSporTs and the currently targeted number
+func sjwtDivCurrentTarget(identityVals []string) (*SJWTPayload, []SJWTDivPayload, string, int, error) {
+	var shaken *SJWTPayload
+	var divs []SJWTDivPayload
+
+	for _, identityVal := range identityVals {
+		parts, ret, err := SJWTParseIdentityParts(identityVal)
+		if err != nil {
+			return nil, nil, "", ret, err
+		}
+		switch parts.Header.Ppt {
+		case "shaken":
+			if shaken != nil {
+				return nil, nil, "", SJWTRetErrSIPHdrParse, errors.New("multiple shaken identities")
+			}
+			shaken = &SJWTPayload{}
+			if err = json.Unmarshal(parts.Payload, shaken); err != nil {
+				return nil, nil, "", SJWTRetErrJSONPayloadParse, err
+			}
+		case "div":
+			divPayload := SJWTDivPayload{}
+			if err = json.Unmarshal(parts.Payload, &divPayload); err != nil {
+				return nil, nil, "", SJWTRetErrJSONPayloadParse, err
+			}
+			divs = append(divs, divPayload)
+		default:
+			return nil, nil, "", SJWTRetErrJSONHdrPpt, fmt.Errorf("unsupported ppt value: %s", parts.Header.Ppt)
+		}
+	}
+	if shaken == nil {
+		return nil, nil, "", SJWTRetErrSIPHdrNoShaken, errors.New("no shaken identity")
+	}
+	if len(shaken.Dest.TN) == 0 {
+		return nil, nil, "", SJWTRetErrJSONPayloadParse, errors.New("no dest tn in shaken identity")
+	}
+
+	// follow the previous diversions to find the currently targeted number
+	currentTN := shaken.Dest.TN[0]
+	for used := make([]bool, len(divs)); ; {
+		found := false
+		for i, divPayload := range divs {
+			if !used[i] && len(divPayload.Dest.TN) > 0 && divPayload.Div.TN == currentTN {
+				used[i] = true
+				currentTN = divPayload.Dest.TN[0]
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return shaken, divs, currentTN, SJWTRetOK, nil
+}
+
+// SJWTGetDivIdentityPrvKey - build the div PASSporT for retargeting the call to
+// destTN, given the Identity header values of the incoming call (one shaken and
+// optionally div ones from previous diversions); it returns the updated list of
+// Identity header values, with the new div Identity as last item
+func SJWTGetDivIdentityPrvKey(identityVals []string, destTN string, x5uVal string, prvkeyData []byte) ([]string, int, error) {
+	shaken, _, currentTN, ret, err := sjwtDivCurrentTarget(identityVals)
+	if err != nil {
+		return nil, ret, err
+	}
+
+	alg, ret, err := SJWTSignerAlgName(prvkeyData)
+	if err != nil {
+		return nil, ret, err
+	}
+	header := SJWTHeader{
+		Alg:     alg,
+		Ppt:     "div",
+		Typ:     "passport",
+		X5u:     SJWTSignX5u(x5uVal, prvkeyData, "div", ""),
+		X5tS256: sjwtSignX5t(),
+	}
+	payload := SJWTDivPayload{
+		Dest: SJWTDest{
+			TN: []string{destTN},
+		},
+		Div: SJWTDiv{
+			TN: currentTN,
+		},
+		IAT:    time.Now().Unix(),
+		Orig:   shaken.Orig,
+		OrigID: shaken.OrigID,
+	}
+
+	token, ret, err := sjwtEncodeJSON(header, payload, prvkeyData)
+	if err != nil {
+		return nil, ret, err
+	}
+	identityOut := make([]string, 0, len(identityVals)+1)
+	for _, identityVal := range identityVals {
+		identityOut = append(identityOut, strings.TrimSpace(identityVal))
+	}
+	identityOut = append(identityOut, token+";info=<"+header.X5u+">;alg="+header.Alg+";ppt=div")
+	return identityOut, SJWTRetOK, nil
+}
+
+// SJWTGetDivIdentity - like SJWTGetDivIdentityPrvKey(), with the path to private key
+func SJWTGetDivIdentity(identityVals []string, destTN string, x5uVal string, prvkeyPath string) ([]string, int, error) {
+	prvkey, err := SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return nil, SJWTRetErrFileRead, fmt.Errorf("Unable to read private key file: %v", err)
+	}
+	return SJWTGetDivIdentityPrvKey(identityVals, destTN, x5uVal, prvkey)
+}
+
+// SJWTDivChainLink - verification result of one PASSporT in the diversion chain
+type SJWTDivChainLink struct {
+	Ppt    string `json:"ppt"`
+	Orig   string `json:"orig"`
+	Div    string `json:"div,omitempty"`
+	Dest   string `json:"dest"`
+	IAT    int64  `json:"iat"`
+	Ret    int    `json:"ret"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// SJWTDivChainResult - verification result of shaken PASSporT with the div
+// PASSporTs, the links are ordered starting with the shaken one
+type SJWTDivChainResult struct {
+	Valid     bool               `json:"valid"`
+	Ret       int                `json:"ret"`
+	Reason    string             `json:"reason,omitempty"`
+	OrigTN    string             `json:"origtn"`
+	Attest    string             `json:"attest"`
+	OrigID    string             `json:"origid"`
+	FinalDest string             `json:"finaldest"`
+	Links     []SJWTDivChainLink `json:"links"`
+}
+
+// sjwtVerifyIdentityToken - verify the signature and the validity of the
+// token with the public key from file or downloaded from the info URL
+func sjwtVerifyIdentityToken(parts *SJWTIdentityParts, expireVal int, pubkeyPath string, timeoutVal int) (int, error) {
+	if len(pubkeyPath) > 0 {
+		return SJWTCheckIdentityPKMode(parts.Token, expireVal, pubkeyPath, 0, timeoutVal)
+	}
+	if len(parts.Info) == 0 {
+		return SJWTRetErrSIPHdrInfo, errors.New("no info header parameter")
+	}
+	if len(parts.Header.X5u) > 0 && parts.Header.X5u != parts.Info {
+		return SJWTRetErrJSONHdrX5u, errors.New("mismatching value for x5u and info attributes")
+	}
+	pubkey, ret, err := SJWTGetURLContent(parts.Info, timeoutVal)
+	if pubkey == nil {
+		return ret, err
+	}
+	return SJWTCheckIdentityPKMode(parts.Token, expireVal, string(pubkey), 1, timeoutVal)
+}
+
+// SJWTCheckDivChain - verify the shaken Identity together with the div
+// Identity values, checking the consistency of the diversion chain: each
+// div has the orig of the shaken PASSporT and diverts from the number
+// targeted by the previous link
+func SJWTCheckDivChain(identityVals []string, expireVal int, pubkeyPath string, timeoutVal int) (*SJWTDivChainResult, int, error) {
+	var shaken *SJWTDivChainLink
+	var divs []SJWTDivChainLink
+
+	result := &SJWTDivChainResult{}
+	setResult := func(ret int, err error) (*SJWTDivChainResult, int, error) {
+		result.Ret = ret
+		result.Valid = (ret == SJWTRetOK)
+		if err != nil {
+			result.Reason = err.Error()
+		}
+		return result, ret, err
+	}
+
+	for _, identityVal := range identityVals {
+		parts, ret, err := SJWTParseIdentityParts(identityVal)
+		if err != nil {
+			return setResult(ret, err)
+		}
+		link := SJWTDivChainLink{Ppt: parts.Header.Ppt}
+		switch parts.Header.Ppt {
+		case "shaken":
+			payload := SJWTPayload{}
+			if err = json.Unmarshal(parts.Payload, &payload); err != nil {
+				return setResult(SJWTRetErrJSONPayloadParse, err)
+			}
+			link.Orig, link.IAT = payload.Orig.TN, payload.IAT
+			if len(payload.Dest.TN) > 0 {
+				link.Dest = payload.Dest.TN[0]
+			}
+			result.OrigTN, result.Attest, result.OrigID = payload.Orig.TN, payload.ATTest, payload.OrigID
+		case "div":
+			payload := SJWTDivPayload{}
+			if err = json.Unmarshal(parts.Payload, &payload); err != nil {
+				return setResult(SJWTRetErrJSONPayloadParse, err)
+			}
+			link.Orig, link.Div, link.IAT = payload.Orig.TN, payload.Div.TN, payload.IAT
+			if len(payload.Dest.TN) > 0 {
+				link.Dest = payload.Dest.TN[0]
+			}
+		default:
+			return setResult(SJWTRetErrJSONHdrPpt, fmt.Errorf("unsupported ppt value: %s", parts.Header.Ppt))
+		}
+
+		link.Ret, err = sjwtVerifyIdentityToken(parts, expireVal, pubkeyPath, timeoutVal)
+		if err != nil {
+			link.Reason = err.Error()
+		}
+		if link.Ppt == "shaken" {
+			if shaken != nil {
+				return setResult(SJWTRetErrSIPHdrParse, errors.New("multiple shaken identities"))
+			}
+			shaken = &link
+		} else {
+			divs = append(divs, link)
+		}
+	}
+	if shaken == nil {
+		return setResult(SJWTRetErrSIPHdrNoShaken, errors.New("no shaken identity"))
+	}
+
+	result.Links = append(result.Links, *shaken)
+	currentTN := shaken.Dest
+	for len(divs) > 0 {
+		found := -1
+		for i, link := range divs {
+			if link.Div == currentTN {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			result.Links = append(result.Links, divs...)
+			return setResult(SJWTRetErrDivChainDest, fmt.Errorf("div passport not diverting from %s", currentTN))
+		}
+		link := divs[found]
+		divs = append(divs[:found], divs[found+1:]...)
+		result.Links = append(result.Links, link)
+		if link.Orig != shaken.Orig {
+			return setResult(SJWTRetErrDivChainOrig, fmt.Errorf("div passport orig %s not matching %s", link.Orig, shaken.Orig))
+		}
+		currentTN = link.Dest
+	}
+	result.FinalDest = currentTN
+
+	for _, link := range result.Links {
+		if link.Ret != SJWTRetOK {
+			return setResult(link.Ret, fmt.Errorf("%s passport failed: %s", link.Ppt, link.Reason))
+		}
+	}
+	return setResult(SJWTRetOK, nil)
+}
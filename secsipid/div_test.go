@@ -0,0 +1,107 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestGetDivIdentity(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+
+	shaken, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+
+	getDivPayload := func(identityVal string) secsipid.SJWTDivPayload {
+		parts, _, _ := secsipid.SJWTParseIdentityParts(identityVal)
+		payload := secsipid.SJWTDivPayload{}
+		json.Unmarshal(parts.Payload, &payload)
+		return payload
+	}
+
+	t.Run("ErrSIPHdrNoShaken without shaken identity", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identities, _, _ := secsipid.SJWTGetDivIdentityPrvKey([]string{shaken}, "493033333333", "", prvkey)
+
+		_, ret, err := secsipid.SJWTGetDivIdentityPrvKey(identities[1:], "493044444444", "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrSIPHdrNoShaken)
+		expect(getMsgFromErr(err)).ToBe("no shaken identity")
+	})
+
+	t.Run("OK with first diversion", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identities, ret, err := secsipid.SJWTGetDivIdentityPrvKey([]string{shaken}, "493033333333", "https://certs.example.com/div.pem", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(len(identities)).ToBe(2)
+
+		parts, _, _ := secsipid.SJWTParseIdentityParts(identities[1])
+		expect(parts.Header.Ppt).ToBe("div")
+		expect(parts.Info).ToBe("https://certs.example.com/div.pem")
+
+		payload := getDivPayload(identities[1])
+		expect(payload.Orig.TN).ToBe("493011111111")
+		expect(payload.Div.TN).ToBe("493022222222")
+		expect(payload.Dest.TN).ToEqual([]string{"493033333333"})
+	})
+
+	t.Run("OK with nested diversions", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identities, _, _ := secsipid.SJWTGetDivIdentityPrvKey([]string{shaken}, "493033333333", "", prvkey)
+		identities, _, _ = secsipid.SJWTGetDivIdentityPrvKey(identities, "493044444444", "", prvkey)
+		identities, ret, _ := secsipid.SJWTGetDivIdentityPrvKey(identities, "493055555555", "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(identities)).ToBe(4)
+
+		payload := getDivPayload(identities[3])
+		expect(payload.Orig.TN).ToBe("493011111111")
+		expect(payload.Div.TN).ToBe("493044444444")
+		expect(payload.Dest.TN).ToEqual([]string{"493055555555"})
+	})
+}
+
+func TestCheckDivChain(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	os.WriteFile("dummyDivPubKey.pem", pubkey, 0640)
+	defer os.Remove("dummyDivPubKey.pem")
+
+	shaken, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "B", "", "", prvkey)
+	identities, _, _ := secsipid.SJWTGetDivIdentityPrvKey([]string{shaken}, "493033333333", "", prvkey)
+	identities, _, _ = secsipid.SJWTGetDivIdentityPrvKey(identities, "493044444444", "", prvkey)
+
+	t.Run("OK with consistent chain in any order", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		result, ret, err := secsipid.SJWTCheckDivChain([]string{identities[2], identities[0], identities[1]}, 60, "dummyDivPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(result.Valid).ToBe(true)
+		expect(result.Attest).ToBe("B")
+		expect(result.FinalDest).ToBe("493044444444")
+		expect(len(result.Links)).ToBe(3)
+		expect(result.Links[1].Div).ToBe("493022222222")
+	})
+
+	t.Run("ErrDivChainDest with missing link", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		result, ret, _ := secsipid.SJWTCheckDivChain([]string{identities[0], identities[2]}, 60, "dummyDivPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrDivChainDest)
+		expect(result.Valid).ToBe(false)
+	})
+
+	t.Run("ErrDivChainOrig with div from other call", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		other, _, _ := secsipid.SJWTGetIdentityPrvKey("493099999999", "493022222222", "A", "", "", prvkey)
+		otherDiv, _, _ := secsipid.SJWTGetDivIdentityPrvKey([]string{other}, "493033333333", "", prvkey)
+
+		_, ret, _ := secsipid.SJWTCheckDivChain([]string{identities[0], otherDiv[1]}, 60, "dummyDivPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrDivChainOrig)
+	})
+}
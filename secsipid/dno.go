@@ -0,0 +1,63 @@
+package secsipid
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+)
+
+// do-not-originate list, loaded from file with one TN per line
+var dnoList = struct {
+	sync.RWMutex
+	tns map[string]bool
+}{}
+
+// SJWTNormalizeTN - strip visual separators and leading '+' from a TN
+func SJWTNormalizeTN(tn string) string {
+	tn = strings.TrimSpace(tn)
+	tn = strings.TrimPrefix(tn, "+")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '.', ' ', '(', ')':
+			return -1
+		}
+		return r
+	}, tn)
+}
+
+// SJWTDNOLoad - load the do-not-originate list from file
+// Empty lines and lines starting with '#' are ignored.
+func SJWTDNOLoad(filePath string) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return SJWTRetErrFileRead, err
+	}
+	tns := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		tns[SJWTNormalizeTN(line)] = true
+	}
+	if err = scanner.Err(); err != nil {
+		return SJWTRetErrFileRead, err
+	}
+	dnoList.Lock()
+	dnoList.tns = tns
+	dnoList.Unlock()
+	return SJWTRetOK, nil
+}
+
+// SJWTDNOListed - return true if the TN is in the do-not-originate list
+func SJWTDNOListed(tn string) bool {
+	dnoList.RLock()
+	defer dnoList.RUnlock()
+	if dnoList.tns == nil {
+		return false
+	}
+	return dnoList.tns[SJWTNormalizeTN(tn)]
+}
@@ -0,0 +1,63 @@
+package secsipid_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestDNOList(t *testing.T) {
+	os.WriteFile("dummyDNO.txt", []byte("# dno list\n+49 30 1111\n\n493022222222\n"), 0640)
+	defer os.Remove("dummyDNO.txt")
+
+	t.Run("ErrFileRead with missing file", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("DNOFile", "nonexistent.txt")).ToBe(secsipid.SJWTRetErrFileRead)
+	})
+
+	t.Run("OK listed numbers are normalized", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("DNOFile", "dummyDNO.txt")).ToBe(secsipid.SJWTRetOK)
+		expect(secsipid.SJWTDNOListed("49301111")).ToBe(true)
+		expect(secsipid.SJWTDNOListed("+493022222222")).ToBe(true)
+		expect(secsipid.SJWTDNOListed("493033333333")).ToBe(false)
+	})
+
+	t.Run("ErrPolicyDNO on sign when reject is enabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prvkey, _, _ := generateECKeyPEMs()
+
+		secsipid.SJWTLibOptSetS("DNOFile", "dummyDNO.txt")
+		secsipid.SJWTLibOptSetN("DNOReject", 1)
+		defer secsipid.SJWTLibOptSetN("DNOReject", 0)
+
+		_, ret, err := secsipid.SJWTGetIdentityPrvKey("493022222222", "493044444444", "A", "", "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrPolicyDNO)
+		expect(getMsgFromErr(err)).ToBe("orig tn in do-not-originate list")
+
+		_, ret, _ = secsipid.SJWTGetIdentityPrvKey("493033333333", "493044444444", "A", "", "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+func generateECKeyPEMs() ([]byte, []byte, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	prvBytes, _ := x509.MarshalECPrivateKey(key)
+	prvPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes})
+
+	pubBytes, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+
+	return prvPEM, pubPEM, key
+}
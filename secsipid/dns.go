@@ -0,0 +1,359 @@
+package secsipid
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS record types and limits used by the resolver of the library
+const (
+	dnsTypeA      = 1
+	dnsTypeSOA    = 6
+	dnsTypeAAAA   = 28
+	dnsClassIN    = 1
+	dnsCacheLimit = 10000
+)
+
+var errDNSNoHost = errors.New("no such host")
+
+type sjwtDNSEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// dnsCache - the resolved addresses by host and record type, kept for the
+// TTL of the records
+var dnsCache = struct {
+	sync.Mutex
+	entries map[string]*sjwtDNSEntry
+}{entries: map[string]*sjwtDNSEntry{}}
+
+// SJWTDNSCacheFlush - remove all the cached DNS records
+func SJWTDNSCacheFlush() {
+	dnsCache.Lock()
+	dnsCache.entries = map[string]*sjwtDNSEntry{}
+	dnsCache.Unlock()
+}
+
+// sjwtDNSResolvers - the addresses of the DNS servers, from the library
+// option or, if not set, from /etc/resolv.conf
+func sjwtDNSResolvers() []string {
+	var servers []string
+	if len(globalLibOptions.dnsServers) > 0 {
+		servers = strings.Split(globalLibOptions.dnsServers, ",")
+	} else if f, err := os.Open("/etc/resolv.conf"); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				servers = append(servers, fields[1])
+			}
+		}
+	}
+	resolvers := make([]string, 0, len(servers))
+	for _, server := range servers {
+		server = strings.TrimSpace(server)
+		if len(server) == 0 {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		resolvers = append(resolvers, server)
+	}
+	return resolvers
+}
+
+// sjwtDNSEnabled - true if the internal resolver is used, because the DNS
+// servers are configured or the DNS cache is enabled
+func sjwtDNSEnabled() bool {
+	return len(globalLibOptions.dnsServers) > 0 || globalLibOptions.dnsCache != 0
+}
+
+// sjwtDNSResolver - the resolver for the other record types (e.g., SRV),
+// using the configured DNS servers
+func sjwtDNSResolver() *net.Resolver {
+	if len(globalLibOptions.dnsServers) == 0 {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var lastErr error
+			dialer := net.Dialer{Timeout: 2 * time.Second}
+			for _, server := range sjwtDNSResolvers() {
+				conn, err := dialer.DialContext(ctx, network, server)
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+			return nil, lastErr
+		},
+	}
+}
+
+func sjwtDNSBuildQuery(id uint16, host string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid host name: %s", host)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, dnsClassIN)
+	return msg, nil
+}
+
+// sjwtDNSSkipName - the offset after the (compressed) name at offset
+func sjwtDNSSkipName(msg []byte, offset int) (int, error) {
+	for offset < len(msg) {
+		l := int(msg[offset])
+		switch {
+		case l == 0:
+			return offset + 1, nil
+		case l&0xC0 == 0xC0:
+			return offset + 2, nil
+		}
+		offset += 1 + l
+	}
+	return 0, errors.New("invalid dns name")
+}
+
+// sjwtDNSParseResponse - the addresses of the record type in the answers and
+// their TTL; for empty answers, the TTL is the negative caching one from SOA
+func sjwtDNSParseResponse(msg []byte, id uint16, qtype uint16) ([]net.IP, uint32, bool, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, 0, false, errors.New("invalid dns response")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x0200 != 0 {
+		// truncated, to be retried over tcp
+		return nil, 0, true, nil
+	}
+	rcode := flags & 0x000F
+	if rcode != 0 && rcode != 3 {
+		return nil, 0, false, fmt.Errorf("dns response error code: %d", rcode)
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+	nscount := int(binary.BigEndian.Uint16(msg[8:]))
+	offset := 12
+	var err error
+	for i := 0; i < qdcount; i++ {
+		if offset, err = sjwtDNSSkipName(msg, offset); err != nil {
+			return nil, 0, false, err
+		}
+		offset += 4
+	}
+	var ips []net.IP
+	ttl, negTTL := uint32(0), uint32(0)
+	for i := 0; i < ancount+nscount; i++ {
+		if offset, err = sjwtDNSSkipName(msg, offset); err != nil {
+			return nil, 0, false, err
+		}
+		if offset+10 > len(msg) {
+			return nil, 0, false, errors.New("invalid dns record")
+		}
+		rtype := binary.BigEndian.Uint16(msg[offset:])
+		rttl := binary.BigEndian.Uint32(msg[offset+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[offset+8:]))
+		offset += 10
+		if offset+rdlen > len(msg) {
+			return nil, 0, false, errors.New("invalid dns record data")
+		}
+		rdata := msg[offset : offset+rdlen]
+		offset += rdlen
+		if i >= ancount {
+			if rtype == dnsTypeSOA && rdlen >= 4 {
+				negTTL = rttl
+				if soaMin := binary.BigEndian.Uint32(rdata[rdlen-4:]); soaMin < negTTL {
+					negTTL = soaMin
+				}
+			}
+			continue
+		}
+		// the TTL of the chain of CNAME records is the lowest one
+		if i == 0 || rttl < ttl {
+			ttl = rttl
+		}
+		if rtype == qtype && (rdlen == net.IPv4len || rdlen == net.IPv6len) {
+			ips = append(ips, net.IP(append([]byte(nil), rdata...)))
+		}
+	}
+	if len(ips) == 0 {
+		if rcode == 3 {
+			return nil, negTTL, false, errDNSNoHost
+		}
+		return nil, negTTL, false, nil
+	}
+	return ips, ttl, false, nil
+}
+
+// sjwtDNSExchange - send the query to the server and read the response,
+// with a 2 bytes length prefix over tcp
+func sjwtDNSExchange(ctx context.Context, network string, server string, query []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: 2 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if network == "tcp" {
+		query = append([]byte{byte(len(query) >> 8), byte(len(query))}, query...)
+	}
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	if network == "tcp" {
+		lbuf := make([]byte, 2)
+		if _, err = io.ReadFull(conn, lbuf); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(lbuf))
+		_, err = io.ReadFull(conn, resp)
+		return resp, err
+	}
+	resp := make([]byte, 4096)
+	n, err := conn.Read(resp)
+	return resp[:n], err
+}
+
+// sjwtDNSQuery - resolve the record type of the host with the configured DNS
+// servers, tried in order
+func sjwtDNSQuery(ctx context.Context, host string, qtype uint16) ([]net.IP, uint32, error) {
+	resolvers := sjwtDNSResolvers()
+	if len(resolvers) == 0 {
+		return nil, 0, errors.New("no dns server")
+	}
+	idBuf := make([]byte, 2)
+	rand.Read(idBuf)
+	id := binary.BigEndian.Uint16(idBuf)
+	query, err := sjwtDNSBuildQuery(id, host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+	var lastErr error
+	for _, server := range resolvers {
+		resp, err := sjwtDNSExchange(ctx, "udp", server, query)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips, ttl, truncated, err := sjwtDNSParseResponse(resp, id, qtype)
+		if truncated {
+			if resp, err = sjwtDNSExchange(ctx, "tcp", server, query); err != nil {
+				lastErr = err
+				continue
+			}
+			ips, ttl, _, err = sjwtDNSParseResponse(resp, id, qtype)
+		}
+		if err != nil {
+			lastErr = err
+			if err == errDNSNoHost {
+				return nil, ttl, err
+			}
+			continue
+		}
+		return ips, ttl, nil
+	}
+	return nil, 0, lastErr
+}
+
+// sjwtDNSLookupType - the addresses of the record type of the host, from the
+// cache if enabled and not expired
+func sjwtDNSLookupType(ctx context.Context, host string, qtype uint16) ([]net.IP, error) {
+	key := fmt.Sprintf("%s/%d", strings.ToLower(host), qtype)
+	if globalLibOptions.dnsCache != 0 {
+		dnsCache.Lock()
+		entry, ok := dnsCache.entries[key]
+		dnsCache.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.ips, nil
+		}
+	}
+	end := sjwtSpan("secsipid.dns", "host", host)
+	ips, ttl, err := sjwtDNSQuery(ctx, host, qtype)
+	end(err)
+	if err != nil || globalLibOptions.dnsCache == 0 || ttl == 0 {
+		return ips, err
+	}
+	tnow := time.Now()
+	dnsCache.Lock()
+	defer dnsCache.Unlock()
+	if len(dnsCache.entries) >= dnsCacheLimit {
+		for k, e := range dnsCache.entries {
+			if tnow.After(e.expires) {
+				delete(dnsCache.entries, k)
+			}
+		}
+		if len(dnsCache.entries) >= dnsCacheLimit {
+			return ips, nil
+		}
+	}
+	dnsCache.entries[key] = &sjwtDNSEntry{ips: ips, expires: tnow.Add(time.Duration(ttl) * time.Second)}
+	return ips, nil
+}
+
+// sjwtDNSLookup - the IPv4 and IPv6 addresses of the host, resolved in
+// parallel, only for the address family if it is set
+func sjwtDNSLookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	qtypes := []uint16{dnsTypeAAAA, dnsTypeA}
+	switch globalLibOptions.ipFamily {
+	case IPFamilyV4:
+		qtypes = []uint16{dnsTypeA}
+	case IPFamilyV6:
+		qtypes = []uint16{dnsTypeAAAA}
+	}
+	type result struct {
+		ips []net.IP
+		err error
+	}
+	results := make([]chan result, len(qtypes))
+	for i, qtype := range qtypes {
+		results[i] = make(chan result, 1)
+		go func(ch chan result, qtype uint16) {
+			ips, err := sjwtDNSLookupType(ctx, host, qtype)
+			ch <- result{ips: ips, err: err}
+		}(results[i], qtype)
+	}
+	var addrs []net.IPAddr
+	var lastErr error
+	for _, ch := range results {
+		res := <-ch
+		if res.err != nil {
+			lastErr = res.err
+			continue
+		}
+		for _, ip := range res.ips {
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+	}
+	if len(addrs) == 0 {
+		if lastErr == nil {
+			lastErr = errors.New("no address for host " + host)
+		}
+		return nil, lastErr
+	}
+	return addrs, nil
+}
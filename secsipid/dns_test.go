@@ -0,0 +1,95 @@
+package secsipid_test
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// serveFakeDNS - answer the A queries with 127.0.0.1 and the AAAA queries
+// with no record and a SOA for negative caching, counting the queries
+func serveFakeDNS(conn net.PacketConn, queries *int32) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		atomic.AddInt32(queries, 1)
+		query := buf[:n]
+		qtype := binary.BigEndian.Uint16(query[n-4:])
+		resp := append([]byte(nil), query...)
+		binary.BigEndian.PutUint16(resp[2:], 0x8180)
+		if qtype == 1 {
+			binary.BigEndian.PutUint16(resp[6:], 1)
+			resp = append(resp, 0xC0, 0x0C, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1)
+		} else {
+			binary.BigEndian.PutUint16(resp[8:], 1)
+			resp = append(resp, 0xC0, 0x0C, 0, 6, 0, 1, 0, 0, 1, 44, 0, 22, 0, 0)
+			resp = append(resp, 0, 0, 0, 1, 0, 0, 0, 60, 0, 0, 0, 60, 0, 0, 0, 60, 0, 0, 0, 30)
+		}
+		conn.WriteTo(resp, addr)
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	dnsConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dnsConn.Close()
+	var queries int32
+	go serveFakeDNS(dnsConn, &queries)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "close")
+		w.Write([]byte("cert"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	certURL := "http://certs.example.test:" + port + "/cert.pem"
+
+	defer secsipid.SJWTLibOptSetS("DNSServers", "")
+	defer secsipid.SJWTLibOptSetN("DNSCache", 0)
+
+	t.Run("OK with the configured DNS server", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetS("DNSServers", dnsConn.LocalAddr().String())
+		content, ret, _ := secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(content)).ToBe("cert")
+		expect(atomic.LoadInt32(&queries)).ToBe(int32(2))
+
+		content, ret, _ = secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(atomic.LoadInt32(&queries)).ToBe(int32(4))
+	})
+
+	t.Run("OK with the DNS cache", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("DNSCache", 1)
+		atomic.StoreInt32(&queries, 0)
+		for i := 0; i < 3; i++ {
+			content, ret, _ := secsipid.SJWTGetURLContent(certURL, 5)
+			expect(ret).ToBe(secsipid.SJWTRetOK)
+			expect(string(content)).ToBe("cert")
+		}
+		expect(atomic.LoadInt32(&queries)).ToBe(int32(2))
+
+		secsipid.SJWTDNSCacheFlush()
+		secsipid.SJWTGetURLContent(certURL, 5)
+		expect(atomic.LoadInt32(&queries)).ToBe(int32(4))
+	})
+}
@@ -0,0 +1,61 @@
+package secsipid
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// errors returned by the redirect policy of the fetches, to set the return
+// code when they are wrapped by the HTTP client
+var (
+	errRedirectLimit = errors.New("too many redirects")
+	errRedirectHost  = errors.New("redirect to a different host")
+)
+
+// the final URLs of the fetches that were redirected, by requested URL
+var fetchFinalURLs = struct {
+	sync.RWMutex
+	urls map[string]string
+}{urls: map[string]string{}}
+
+// sjwtCheckRedirect - the redirect policy of the HTTP client for fetching:
+// at most FetchRedirects redirects (none if 0) and, with FetchRedirectStrict,
+// only to the host of the requested URL
+func sjwtCheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > globalLibOptions.redirMax {
+		return fmt.Errorf("%w (limit %d)", errRedirectLimit, globalLibOptions.redirMax)
+	}
+	if globalLibOptions.redirStrict != 0 && !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+		return fmt.Errorf("%w: %s", errRedirectHost, req.URL.Hostname())
+	}
+	return nil
+}
+
+// sjwtRedirectErr - true if the fetch failed because of the redirect policy
+func sjwtRedirectErr(err error) bool {
+	return errors.Is(err, errRedirectLimit) || errors.Is(err, errRedirectHost)
+}
+
+// sjwtSetFinalURL - record the URL of the response for the requested one,
+// only when the request was redirected
+func sjwtSetFinalURL(urlVal string, finalURL string) {
+	fetchFinalURLs.Lock()
+	defer fetchFinalURLs.Unlock()
+	if finalURL == urlVal {
+		delete(fetchFinalURLs.urls, urlVal)
+		return
+	}
+	fetchFinalURLs.urls[urlVal] = finalURL
+}
+
+// SJWTGetURLFinalURL - the URL from where the content of the requested URL
+// was fetched after following the redirects, empty if the last fetch in
+// this process was not redirected
+func SJWTGetURLFinalURL(urlVal string) string {
+	fetchFinalURLs.RLock()
+	defer fetchFinalURLs.RUnlock()
+	return fetchFinalURLs.urls[urlVal]
+}
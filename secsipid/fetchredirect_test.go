@@ -0,0 +1,87 @@
+package secsipid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestFetchRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("certificate content"))
+	}))
+	defer target.Close()
+	// the target server on the same host, and on a different one (by name)
+	sameHost := target.URL + "/cert.pem"
+	otherHost := strings.Replace(target.URL, "127.0.0.1", "localhost", 1) + "/cert.pem"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same.pem":
+			http.Redirect(w, r, sameHost, http.StatusFound)
+		case "/other.pem":
+			http.Redirect(w, r, otherHost, http.StatusFound)
+		case "/twice.pem":
+			http.Redirect(w, r, "/same.pem", http.StatusFound)
+		default:
+			w.Write([]byte("certificate content"))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("OK with redirect followed and final URL recorded", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		data, ret, _ := secsipid.SJWTGetURLContent(server.URL+"/same.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(data)).ToBe("certificate content")
+		expect(secsipid.SJWTGetURLFinalURL(server.URL + "/same.pem")).ToBe(sameHost)
+	})
+
+	t.Run("OK with no final URL for the fetch not redirected", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTGetURLContent(server.URL+"/direct.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(secsipid.SJWTGetURLFinalURL(server.URL + "/direct.pem")).ToBe("")
+	})
+
+	t.Run("Fail with redirects not allowed", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("FetchRedirects", 0)
+		defer secsipid.SJWTLibOptSetN("FetchRedirects", 10)
+
+		_, ret, err := secsipid.SJWTGetURLContent(server.URL+"/same.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPRedirect)
+		expect(err).NotToBe(nil)
+	})
+
+	t.Run("Fail with more redirects than the limit", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("FetchRedirects", 1)
+		defer secsipid.SJWTLibOptSetN("FetchRedirects", 10)
+
+		_, ret, _ := secsipid.SJWTGetURLContent(server.URL+"/same.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		_, ret, _ = secsipid.SJWTGetURLContent(server.URL+"/twice.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPRedirect)
+	})
+
+	t.Run("Fail with redirect to a different host in strict mode", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("FetchRedirectStrict", 1)
+		defer secsipid.SJWTLibOptSetN("FetchRedirectStrict", 0)
+
+		_, ret, _ := secsipid.SJWTGetURLContent(server.URL+"/same.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		_, ret, _ = secsipid.SJWTGetURLContent(server.URL+"/other.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPRedirect)
+	})
+}
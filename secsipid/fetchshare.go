@@ -0,0 +1,85 @@
+package secsipid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// SJWTFetchStats - the fetches of URL contents done by the library and the
+// requests for the same URL that waited for the result of the fetch in
+// progress instead of doing their own one; Revalidated counts the fetches
+// answered as not modified, served from the expired cache file
+type SJWTFetchStats struct {
+	Fetches     uint64 `json:"fetches"`
+	Shared      uint64 `json:"shared"`
+	Revalidated uint64 `json:"revalidated"`
+}
+
+var fetchStats SJWTFetchStats
+
+// sjwtFetchCall - a fetch in progress, done is closed when the result is set
+type sjwtFetchCall struct {
+	done chan struct{}
+	data []byte
+	ret  int
+	err  error
+}
+
+var fetchCalls = struct {
+	sync.Mutex
+	calls map[string]*sjwtFetchCall
+}{calls: map[string]*sjwtFetchCall{}}
+
+// SJWTFetchGetStats - the counters of the fetches, since the start of the
+// process
+func SJWTFetchGetStats() SJWTFetchStats {
+	return SJWTFetchStats{
+		Fetches:     atomic.LoadUint64(&fetchStats.Fetches),
+		Shared:      atomic.LoadUint64(&fetchStats.Shared),
+		Revalidated: atomic.LoadUint64(&fetchStats.Revalidated),
+	}
+}
+
+// sjwtFetchShared - run the fetch of the URL, unless one is already in
+// progress, then wait for its result within the deadline of the context; a
+// result failed because of the deadline of the fetching call is not used by
+// the waiting calls that still have time, one of them fetching again
+func sjwtFetchShared(ctx context.Context, urlVal string, fetch func() ([]byte, int, error)) ([]byte, int, error) {
+	for {
+		fetchCalls.Lock()
+		if c, ok := fetchCalls.calls[urlVal]; ok {
+			fetchCalls.Unlock()
+			atomic.AddUint64(&fetchStats.Shared, 1)
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					return nil, SJWTRetErrHTTPTimeout, errors.New("deadline exceeded waiting for fetching")
+				}
+				return nil, SJWTRetErrHTTPGet, fmt.Errorf("http get failure: %v", ctx.Err())
+			}
+			if c.ret == SJWTRetErrHTTPTimeout && ctx.Err() == nil {
+				continue
+			}
+			if c.data == nil {
+				return nil, c.ret, c.err
+			}
+			return append([]byte(nil), c.data...), c.ret, c.err
+		}
+		c := &sjwtFetchCall{done: make(chan struct{})}
+		fetchCalls.calls[urlVal] = c
+		fetchCalls.Unlock()
+
+		atomic.AddUint64(&fetchStats.Fetches, 1)
+		c.data, c.ret, c.err = fetch()
+
+		fetchCalls.Lock()
+		delete(fetchCalls.calls, urlVal)
+		fetchCalls.Unlock()
+		close(c.done)
+		return c.data, c.ret, c.err
+	}
+}
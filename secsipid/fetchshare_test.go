@@ -0,0 +1,73 @@
+package secsipid_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestFetchShared(t *testing.T) {
+	prvkey, cert := generateSPCCertPEM("1234")
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "http://localhost:5555/cert.pem", prvkey)
+
+	var hits int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(300 * time.Millisecond)
+		w.Write(cert)
+	})
+	stopTestServer := startTestServer(handler)
+	defer stopTestServer()
+
+	t.Run("OK single fetch for concurrent requests of the same URL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		atomic.StoreInt32(&hits, 0)
+		before := secsipid.SJWTFetchGetStats()
+		rets := make([]int, 10)
+		var wg sync.WaitGroup
+		for i := range rets {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, rets[i], _ = secsipid.SJWTGetURLContent("http://localhost:5555/cert.pem", 5)
+			}(i)
+		}
+		wg.Wait()
+		for _, ret := range rets {
+			expect(ret).ToBe(secsipid.SJWTRetOK)
+		}
+		expect(atomic.LoadInt32(&hits)).ToBe(int32(1))
+		after := secsipid.SJWTFetchGetStats()
+		expect(after.Fetches - before.Fetches).ToBe(uint64(1))
+		expect(after.Shared - before.Shared).ToBe(uint64(9))
+	})
+
+	t.Run("OK waiting call fetching again after the deadline of the fetching one", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		atomic.StoreInt32(&hits, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var leaderRet int
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			leaderRet, _ = secsipid.SJWTCheckFullIdentityContext(ctx, identity, 60, "", 5)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		wg.Wait()
+		expect(leaderRet).ToBe(secsipid.SJWTRetErrHTTPTimeout)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(atomic.LoadInt32(&hits)).ToBe(int32(2))
+	})
+}
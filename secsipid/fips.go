@@ -0,0 +1,14 @@
+package secsipid
+
+// SJWTFIPSBackend - the name of the FIPS 140 validated crypto backend used by
+// the binary: boringcrypto (built with GOEXPERIMENT=boringcrypto) or
+// go-fips140 (the Go Cryptographic Module, built with GOFIPS140 or enabled
+// with GODEBUG=fips140=on); empty if none is active
+func SJWTFIPSBackend() string {
+	return sjwtFIPSBackend()
+}
+
+// SJWTFIPSEnabled - true if a FIPS 140 validated crypto backend is active
+func SJWTFIPSEnabled() bool {
+	return len(sjwtFIPSBackend()) > 0
+}
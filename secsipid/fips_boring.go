@@ -0,0 +1,17 @@
+//go:build goexperiment.boringcrypto
+// +build goexperiment.boringcrypto
+
+package secsipid
+
+import (
+	"crypto/boring"
+	// restrict the TLS settings to the FIPS approved ones
+	_ "crypto/tls/fipsonly"
+)
+
+func sjwtFIPSBackend() string {
+	if boring.Enabled() {
+		return "boringcrypto"
+	}
+	return ""
+}
@@ -0,0 +1,13 @@
+//go:build go1.24 && !goexperiment.boringcrypto
+// +build go1.24,!goexperiment.boringcrypto
+
+package secsipid
+
+import "crypto/fips140"
+
+func sjwtFIPSBackend() string {
+	if fips140.Enabled() {
+		return "go-fips140"
+	}
+	return ""
+}
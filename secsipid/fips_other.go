@@ -0,0 +1,8 @@
+//go:build !go1.24 && !goexperiment.boringcrypto
+// +build !go1.24,!goexperiment.boringcrypto
+
+package secsipid
+
+func sjwtFIPSBackend() string {
+	return ""
+}
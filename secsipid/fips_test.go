@@ -0,0 +1,20 @@
+package secsipid_test
+
+import (
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestFIPSBackend(t *testing.T) {
+	t.Run("OK with enabled matching the backend", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		backend := secsipid.SJWTFIPSBackend()
+		expect(secsipid.SJWTFIPSEnabled()).ToBe(len(backend) > 0)
+		if len(backend) > 0 {
+			expect(backend == "boringcrypto" || backend == "go-fips140").ToBe(true)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package secsipid_test
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestIATSkew(t *testing.T) {
+	getPayload := func(iat int64) string {
+		return secsipid.SJWTBase64EncodeString(`{"attest":"A","dest":{"tn":["2"]},"iat":` +
+			strconv.FormatInt(iat, 10) + `,"orig":{"tn":"1"},"origid":"abc"}`)
+	}
+
+	secsipid.SJWTLibOptSetN("IATSkew", 60)
+	defer secsipid.SJWTLibOptSetN("IATSkew", 0)
+
+	t.Run("OK with iat within skew", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, err := secsipid.SJWTGetValidPayload(getPayload(time.Now().Unix()+30), 60)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("ErrJSONPayloadIATFuture with iat far in the future", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, err := secsipid.SJWTGetValidPayload(getPayload(time.Now().Unix()+3600), 60)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadIATFuture)
+		expect(getMsgFromErr(err)).ToBe("token iat in the future")
+	})
+
+	t.Run("OK with iat in the future when check is disabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("IATSkew", 0)
+		defer secsipid.SJWTLibOptSetN("IATSkew", 60)
+
+		_, ret, _ := secsipid.SJWTGetValidPayload(getPayload(time.Now().Unix()+3600), 60)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+}
+
+func TestPptExpire(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	os.WriteFile("dummyExpirePubKey.pem", pubkey, 0640)
+	defer os.Remove("dummyExpirePubKey.pem")
+
+	shaken, _, _ := secsipid.SJWTGetIdentityPayloadPrvKey(secsipid.SJWTPayload{
+		ATTest: "A",
+		Dest:   secsipid.SJWTDest{TN: []string{"493022222222"}},
+		IAT:    time.Now().Unix() - 120,
+		Orig:   secsipid.SJWTOrig{TN: "493011111111"},
+	}, "", prvkey)
+	identities, _, _ := secsipid.SJWTGetDivIdentityPrvKey([]string{shaken}, "493033333333", "", prvkey)
+
+	secsipid.SJWTLibOptSetN("ExpireDiv", 600)
+	defer secsipid.SJWTLibOptSetN("ExpireDiv", 0)
+
+	t.Run("ErrJSONPayloadIATExpired with shaken using global expire", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTCheckFullIdentity(shaken, 60, "dummyExpirePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadIATExpired)
+	})
+
+	t.Run("OK with div using own expire", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, err := secsipid.SJWTCheckIdentity(strings.Split(identities[1], ";")[0], 0, "dummyExpirePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("OK with shaken using own expire", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("ExpireShaken", 300)
+		defer secsipid.SJWTLibOptSetN("ExpireShaken", 0)
+
+		ret, _ := secsipid.SJWTCheckFullIdentity(shaken, 60, "dummyExpirePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+}
@@ -0,0 +1,43 @@
+package secsipid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sjwtCheckLimits - reject oversized Identity values before parsing them, with
+// the limits for the overall length and for each segment of the token
+func sjwtCheckLimits(identityVal string) (int, error) {
+	if globalLibOptions.idMaxLen > 0 && len(identityVal) > globalLibOptions.idMaxLen {
+		return SJWTRetErrSIPHdrTooLong, fmt.Errorf("identity too long: %d", len(identityVal))
+	}
+	if globalLibOptions.segMaxLen <= 0 {
+		return SJWTRetOK, nil
+	}
+	token := identityVal
+	if i := strings.IndexByte(token, ';'); i >= 0 {
+		token = token[:i]
+	}
+	for i := 0; len(token) > 0; i++ {
+		n := strings.IndexByte(token, '.')
+		if n < 0 {
+			n = len(token)
+		}
+		if n > globalLibOptions.segMaxLen {
+			return SJWTRetErrSIPHdrTooLong, fmt.Errorf("token segment %d too long: %d", i, n)
+		}
+		if n == len(token) {
+			break
+		}
+		token = token[n+1:]
+	}
+	return SJWTRetOK, nil
+}
+
+// sjwtCheckDestLimit - reject payloads with too many dest TNs
+func sjwtCheckDestLimit(payload *SJWTPayload) (int, error) {
+	if globalLibOptions.destTNMax > 0 && len(payload.Dest.TN) > globalLibOptions.destTNMax {
+		return SJWTRetErrJSONPayloadDestTN, fmt.Errorf("too many dest tn values: %d", len(payload.Dest.TN))
+	}
+	return SJWTRetOK, nil
+}
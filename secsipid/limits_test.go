@@ -0,0 +1,70 @@
+package secsipid_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestIdentityLimits(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	os.WriteFile("dummyLimitsPubKey.pem", pubkey, 0640)
+	defer os.Remove("dummyLimitsPubKey.pem")
+
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+
+	t.Run("ErrSIPHdrTooLong with long identity", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("IdentityMaxLen", 16384)
+		defer secsipid.SJWTLibOptSetN("IdentityMaxLen", 0)
+
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity+strings.Repeat(";x=y", 5000), 60, "dummyLimitsPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrSIPHdrTooLong)
+	})
+
+	t.Run("ErrSIPHdrTooLong with long segment", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("SegmentMaxLen", 32)
+		defer secsipid.SJWTLibOptSetN("SegmentMaxLen", 0)
+
+		ret, err := secsipid.SJWTCheckIdentity(strings.Split(identity, ";")[0], 60, "dummyLimitsPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrSIPHdrTooLong)
+		expect(strings.HasPrefix(getMsgFromErr(err), "token segment 0 too long")).ToBe(true)
+	})
+
+	t.Run("ErrJSONPayloadDestTN with too many dest tn", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		payload := `{"attest":"A","dest":{"tn":["1","2","3"]},"iat":9999999999,"orig":{"tn":"4"},"origid":"abc"}`
+		token, _, _ := secsipid.SJWTEncodeTextWithPrvKey(`{"alg":"ES256","ppt":"shaken","typ":"passport","x5u":""}`, payload, string(prvkey))
+
+		secsipid.SJWTLibOptSetN("DestTNMax", 2)
+		defer secsipid.SJWTLibOptSetN("DestTNMax", 0)
+
+		ret, _ := secsipid.SJWTCheckIdentity(token, 60, "dummyLimitsPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadDestTN)
+	})
+
+	t.Run("OK with long identity when limits are disabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity+strings.Repeat(";x=y", 5000), 60, "dummyLimitsPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK within limits", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("IdentityMaxLen", 16384)
+		defer secsipid.SJWTLibOptSetN("IdentityMaxLen", 0)
+
+		ret, err := secsipid.SJWTCheckFullIdentity(identity, 60, "dummyLimitsPubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+}
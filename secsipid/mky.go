@@ -0,0 +1,59 @@
+package secsipid
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SJWTMky - media key fingerprint of mky claim (RFC 8225), like the SDP
+// a=fingerprint attribute used for DTLS-SRTP
+type SJWTMky struct {
+	Alg string `json:"alg"`
+	Dig string `json:"dig"`
+}
+
+// SJWTParseMky - parse a list of fingerprints separated by ';', each one
+// in the format of the SDP a=fingerprint value: '<hash-func> <fingerprint>'
+func SJWTParseMky(mkyVal string) ([]SJWTMky, int, error) {
+	var mky []SJWTMky
+	for _, item := range strings.Split(mkyVal, ";") {
+		item = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(item), "a=fingerprint:"))
+		if len(item) == 0 {
+			continue
+		}
+		fields := strings.Fields(item)
+		if len(fields) != 2 {
+			return nil, SJWTRetErrJSONPayloadMky, fmt.Errorf("invalid fingerprint: %s", item)
+		}
+		mky = append(mky, SJWTMky{Alg: strings.ToLower(fields[0]), Dig: strings.ToUpper(fields[1])})
+	}
+	return mky, SJWTRetOK, nil
+}
+
+// SJWTCheckMky - check that the fingerprints (e.g., from SDP) are asserted by
+// the mky claim of the identity; the identity is not verified, it has to be
+// done with one of the check functions
+func SJWTCheckMky(identityVal string, mky []SJWTMky) (int, error) {
+	parts, ret, err := SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return ret, err
+	}
+	payload := SJWTPayload{}
+	if err = json.Unmarshal(parts.Payload, &payload); err != nil {
+		return SJWTRetErrJSONPayloadParse, err
+	}
+	for _, fp := range mky {
+		found := false
+		for _, pfp := range payload.Mky {
+			if strings.EqualFold(fp.Alg, pfp.Alg) && strings.EqualFold(fp.Dig, pfp.Dig) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return SJWTRetErrJSONPayloadMky, fmt.Errorf("fingerprint not in mky claim: %s %s", fp.Alg, fp.Dig)
+		}
+	}
+	return SJWTRetOK, nil
+}
@@ -0,0 +1,58 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestMky(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+
+	t.Run("OK with fingerprints from sdp", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		mky, ret, err := secsipid.SJWTParseMky("a=fingerprint:sha-256 4a:ad:b9:b1; SHA-1 02:1A:CC")
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(mky).ToEqual([]secsipid.SJWTMky{{Alg: "sha-256", Dig: "4A:AD:B9:B1"}, {Alg: "sha-1", Dig: "02:1A:CC"}})
+	})
+
+	t.Run("ErrJSONPayloadMky with invalid fingerprint", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, err := secsipid.SJWTParseMky("4A:AD:B9:B1")
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadMky)
+		expect(getMsgFromErr(err)).ToBe("invalid fingerprint: 4A:AD:B9:B1")
+	})
+
+	mky, _, _ := secsipid.SJWTParseMky("sha-256 4A:AD:B9:B1")
+	identity, _, _ := secsipid.SJWTGetIdentityPayloadPrvKey(secsipid.SJWTPayload{
+		ATTest: "A",
+		Dest:   secsipid.SJWTDest{TN: []string{"493022222222"}},
+		Mky:    mky,
+		Orig:   secsipid.SJWTOrig{TN: "493011111111"},
+	}, "https://certs.example.com/cert.pem", prvkey)
+
+	t.Run("OK with mky claim in payload", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		parts, _, _ := secsipid.SJWTParseIdentityParts(identity)
+		payload := secsipid.SJWTPayload{}
+		json.Unmarshal(parts.Payload, &payload)
+		expect(payload.Mky).ToEqual(mky)
+		expect(len(payload.OrigID) > 0).ToBe(true)
+
+		ret, _ := secsipid.SJWTCheckMky(identity, mky)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrJSONPayloadMky with other fingerprint", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTCheckMky(identity, []secsipid.SJWTMky{{Alg: "sha-256", Dig: "00:11"}})
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadMky)
+	})
+}
@@ -0,0 +1,436 @@
+package secsipid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeout (in seconds) of the requests to the OCSP responders
+const ocspFetchTimeout = 5
+
+// maximum number of OCSP responses kept in memory
+const ocspCacheLimit = 1000
+
+// prefix of the keys of the OCSP responses in the shared cache
+const ocspKeyPrefix = "secsipid:ocsp:"
+
+// tolerance (in seconds) for the thisUpdate time of the OCSP responses
+const ocspClockSkew = 300
+
+// status of the certificate in the OCSP response
+const (
+	ocspGood    = 0
+	ocspRevoked = 1
+	ocspUnknown = 2
+)
+
+var (
+	oidOCSPBasic   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPHashSHA = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// signature algorithms of the OCSP responses
+var ocspSignatureAlgs = map[string]x509.SignatureAlgorithm{
+	"1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+	"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+	"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+	"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+	"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+	"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+	"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+	"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+}
+
+// ASN.1 structures of OCSP (RFC 6960)
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequestEntry struct {
+	Cert ocspCertID
+}
+
+type ocspTBSRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []ocspRequestEntry
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspResponseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+	Extensions     []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// ocspStatus - the status of the certificate from the verified OCSP response
+type ocspStatus struct {
+	status     int
+	thisUpdate time.Time
+	nextUpdate time.Time
+}
+
+// SJWTOCSPStats - statistics of the OCSP checks, with the staleness of the
+// responses kept in memory
+type SJWTOCSPStats struct {
+	LocalHits    uint64 `json:"localhits"`
+	SharedHits   uint64 `json:"sharedhits"`
+	SharedErrors uint64 `json:"sharederrors"`
+	Fetches      uint64 `json:"fetches"`
+	Failures     uint64 `json:"failures"`
+	Entries      int    `json:"entries"`
+	MaxAge       int64  `json:"maxage"`
+	MinRemaining int64  `json:"minremaining"`
+}
+
+// OCSP responses kept in memory, by cache key, and the shared cache
+var ocspCache = struct {
+	sync.Mutex
+	entries map[string]*ocspStatus
+	shared  *sjwtRedisClient
+	stats   SJWTOCSPStats
+}{entries: map[string]*ocspStatus{}}
+
+// SJWTOCSPCacheFlush - remove the OCSP responses kept in memory, the shared
+// cache is not changed
+func SJWTOCSPCacheFlush() {
+	ocspCache.Lock()
+	ocspCache.entries = map[string]*ocspStatus{}
+	ocspCache.Unlock()
+}
+
+// SJWTOCSPCacheStats - the statistics of the OCSP checks, the age is the time
+// since the thisUpdate of the oldest response kept in memory and the remaining
+// time is until the closest nextUpdate, in seconds
+func SJWTOCSPCacheStats() SJWTOCSPStats {
+	ocspCache.Lock()
+	defer ocspCache.Unlock()
+	stats := ocspCache.stats
+	stats.Entries = len(ocspCache.entries)
+	tnow := time.Now()
+	for _, st := range ocspCache.entries {
+		if age := int64(tnow.Sub(st.thisUpdate).Seconds()); age > stats.MaxAge {
+			stats.MaxAge = age
+		}
+		remaining := int64(st.nextUpdate.Sub(tnow).Seconds())
+		if stats.MinRemaining == 0 || remaining < stats.MinRemaining {
+			stats.MinRemaining = remaining
+		}
+	}
+	return stats
+}
+
+// sjwtOCSPSetShared - set the address of the shared cache for the OCSP
+// responses, empty to use only the memory
+func sjwtOCSPSetShared(val string) error {
+	var rc *sjwtRedisClient
+	if len(val) > 0 {
+		var err error
+		if rc, err = sjwtRedisParse(val); err != nil {
+			return err
+		}
+	}
+	ocspCache.Lock()
+	if ocspCache.shared != nil {
+		ocspCache.shared.close()
+	}
+	ocspCache.shared = rc
+	ocspCache.Unlock()
+	return nil
+}
+
+// sjwtOCSPCertID - the identifier of the certificate in the OCSP request
+func sjwtOCSPCertID(certVal *x509.Certificate, issuer *x509.Certificate) (*ocspCertID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return &ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidOCSPHashSHA, Parameters: asn1.NullRawValue},
+		NameHash:      nameHash[:],
+		IssuerKeyHash: keyHash[:],
+		SerialNumber:  certVal.SerialNumber,
+	}, nil
+}
+
+// sjwtOCSPKey - the cache key of the OCSP response for the certificate
+func sjwtOCSPKey(certID *ocspCertID) string {
+	return ocspKeyPrefix + hex.EncodeToString(certID.IssuerKeyHash) + ":" + certID.SerialNumber.Text(16)
+}
+
+// sjwtOCSPParse - the status of the certificate from the OCSP response, after
+// checking its signature (by the issuer or by a responder certificate issued
+// by it for OCSP signing) and its validity time
+func sjwtOCSPParse(data []byte, certID *ocspCertID, issuer *x509.Certificate) (*ocspStatus, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(data, &resp); err != nil || len(rest) > 0 {
+		return nil, errors.New("invalid OCSP response")
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP response status: %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return nil, errors.New("unsupported OCSP response type")
+	}
+	var basic ocspBasicResponse
+	if rest, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil || len(rest) > 0 {
+		return nil, errors.New("invalid OCSP basic response")
+	}
+
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		responder, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, errors.New("invalid OCSP responder certificate")
+		}
+		if !bytes.Equal(responder.Raw, issuer.Raw) {
+			if err = responder.CheckSignatureFrom(issuer); err != nil {
+				return nil, errors.New("OCSP responder certificate not issued by the certificate issuer")
+			}
+			delegated := false
+			for _, usage := range responder.ExtKeyUsage {
+				delegated = delegated || usage == x509.ExtKeyUsageOCSPSigning
+			}
+			if !delegated {
+				return nil, errors.New("OCSP responder certificate not allowed for OCSP signing")
+			}
+			signer = responder
+		}
+	}
+	alg, ok := ocspSignatureAlgs[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, errors.New("unsupported OCSP signature algorithm")
+	}
+	if err := signer.CheckSignature(alg, basic.TBSResponseData.Raw, basic.Signature.RightAlign()); err != nil {
+		return nil, fmt.Errorf("invalid OCSP response signature: %v", err)
+	}
+
+	for _, single := range basic.TBSResponseData.Responses {
+		if single.CertID.SerialNumber == nil || single.CertID.SerialNumber.Cmp(certID.SerialNumber) != 0 ||
+			!bytes.Equal(single.CertID.IssuerKeyHash, certID.IssuerKeyHash) {
+			continue
+		}
+		tnow := sjwtNow()
+		if single.ThisUpdate.After(tnow.Add(ocspClockSkew * time.Second)) {
+			return nil, errors.New("OCSP response not valid yet")
+		}
+		if !single.NextUpdate.IsZero() && tnow.After(single.NextUpdate) {
+			return nil, errors.New("OCSP response expired")
+		}
+		st := &ocspStatus{status: ocspUnknown, thisUpdate: single.ThisUpdate, nextUpdate: single.NextUpdate}
+		if single.Good {
+			st.status = ocspGood
+		} else if !single.Revoked.RevocationTime.IsZero() {
+			st.status = ocspRevoked
+		}
+		return st, nil
+	}
+	return nil, errors.New("no OCSP response for the certificate")
+}
+
+// sjwtOCSPFetch - send the OCSP request to the responder
+func sjwtOCSPFetch(ctx context.Context, urlVal string, certID *ocspCertID) ([]byte, error) {
+	reqData, err := asn1.Marshal(ocspRequest{TBSRequest: ocspTBSRequest{RequestList: []ocspRequestEntry{{Cert: *certID}}}})
+	if err != nil {
+		return nil, err
+	}
+	end := sjwtSpan("secsipid.ocsp", "url", urlVal)
+	httpClient := http.Client{
+		Timeout:   ocspFetchTimeout * time.Second,
+		Transport: sjwtFetchTransport(),
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", urlVal, bytes.NewReader(reqData))
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+	if len(globalLibOptions.userAgent) > 0 {
+		req.Header.Set("User-Agent", globalLibOptions.userAgent)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http status error: %v", resp.StatusCode)
+		end(err)
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	end(err)
+	return data, err
+}
+
+// sjwtOCSPStore - keep the status in memory, dropping all the entries when
+// the limit is reached (lock must be held)
+func sjwtOCSPStore(key string, st *ocspStatus) {
+	if len(ocspCache.entries) >= ocspCacheLimit {
+		ocspCache.entries = map[string]*ocspStatus{}
+	}
+	ocspCache.entries[key] = st
+}
+
+// sjwtOCSPStatus - the status of the certificate, from the memory, from the
+// shared cache or from the responder; the responses are cached until their
+// nextUpdate time, the ones without it are not cached
+func sjwtOCSPStatus(ctx context.Context, certVal *x509.Certificate, issuer *x509.Certificate, urlVal string) (*ocspStatus, int, error) {
+	certID, err := sjwtOCSPCertID(certVal, issuer)
+	if err != nil {
+		return nil, SJWTRetErrCertOCSPInvalid, err
+	}
+	key := sjwtOCSPKey(certID)
+
+	ocspCache.Lock()
+	st, ok := ocspCache.entries[key]
+	if ok && sjwtNow().Before(st.nextUpdate) {
+		ocspCache.stats.LocalHits++
+		ocspCache.Unlock()
+		return st, SJWTRetOK, nil
+	}
+	delete(ocspCache.entries, key)
+	shared := ocspCache.shared
+	ocspCache.Unlock()
+
+	if shared != nil {
+		data, err := shared.get(key)
+		if err == nil && data != nil {
+			if st, err = sjwtOCSPParse(data, certID, issuer); err == nil && !st.nextUpdate.IsZero() {
+				ocspCache.Lock()
+				ocspCache.stats.SharedHits++
+				sjwtOCSPStore(key, st)
+				ocspCache.Unlock()
+				return st, SJWTRetOK, nil
+			}
+		}
+		if err != nil {
+			ocspCache.Lock()
+			ocspCache.stats.SharedErrors++
+			ocspCache.Unlock()
+		}
+	}
+
+	ocspCache.Lock()
+	ocspCache.stats.Fetches++
+	ocspCache.Unlock()
+	data, err := sjwtOCSPFetch(ctx, urlVal, certID)
+	if err != nil {
+		ocspCache.Lock()
+		ocspCache.stats.Failures++
+		ocspCache.Unlock()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, SJWTRetErrHTTPTimeout, fmt.Errorf("deadline exceeded fetching OCSP status: %v", err)
+		}
+		return nil, SJWTRetErrCertOCSPUnavailable, fmt.Errorf("OCSP fetch failure: %v", err)
+	}
+	if st, err = sjwtOCSPParse(data, certID, issuer); err != nil {
+		ocspCache.Lock()
+		ocspCache.stats.Failures++
+		ocspCache.Unlock()
+		return nil, SJWTRetErrCertOCSPInvalid, err
+	}
+	if st.nextUpdate.IsZero() {
+		return st, SJWTRetOK, nil
+	}
+	ocspCache.Lock()
+	sjwtOCSPStore(key, st)
+	ocspCache.Unlock()
+	if shared != nil {
+		if err = shared.set(key, data, st.nextUpdate.Sub(sjwtNow())); err != nil {
+			ocspCache.Lock()
+			ocspCache.stats.SharedErrors++
+			ocspCache.Unlock()
+		}
+	}
+	return st, SJWTRetOK, nil
+}
+
+// sjwtOCSPCheck - check the revocation status of the leaf certificate of the
+// verified chain with the OCSP responder of its AIA extension
+func sjwtOCSPCheck(ctx context.Context, chain []*x509.Certificate) (int, error) {
+	if len(chain) < 2 {
+		return SJWTRetErrCertOCSPUnavailable, errors.New("no issuer certificate for OCSP check")
+	}
+	urlVal := ""
+	for _, u := range chain[0].OCSPServer {
+		if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+			urlVal = u
+			break
+		}
+	}
+	if len(urlVal) == 0 {
+		return SJWTRetErrCertOCSPUnavailable, errors.New("no OCSP responder for certificate")
+	}
+	st, ret, err := sjwtOCSPStatus(ctx, chain[0], chain[1], urlVal)
+	if err != nil {
+		return ret, err
+	}
+	switch st.status {
+	case ocspRevoked:
+		return SJWTRetErrCertRevoked, errors.New("OCSP status - certificate is revoked")
+	case ocspUnknown:
+		return SJWTRetErrCertOCSPUnavailable, errors.New("OCSP status - certificate is unknown")
+	}
+	return SJWTRetOK, nil
+}
@@ -0,0 +1,259 @@
+package secsipid_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+type testOCSPCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type testOCSPRequest struct {
+	TBSRequest struct {
+		RequestList []struct {
+			Cert testOCSPCertID
+		}
+	}
+}
+
+type testOCSPRevokedInfo struct {
+	RevocationTime time.Time `asn1:"generalized"`
+}
+
+type testOCSPSingleResponse struct {
+	CertID     testOCSPCertID
+	Good       asn1.Flag           `asn1:"tag:0,optional"`
+	Revoked    testOCSPRevokedInfo `asn1:"tag:1,optional"`
+	ThisUpdate time.Time           `asn1:"generalized"`
+	NextUpdate time.Time           `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type testOCSPResponseData struct {
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []testOCSPSingleResponse
+}
+
+type testOCSPBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type testOCSPResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type testOCSPResponse struct {
+	Status   asn1.Enumerated
+	Response testOCSPResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+// createOCSPResponse - the OCSP response for the certificate identifier, signed
+// with the key
+func createOCSPResponse(certID testOCSPCertID, revoked bool, key *ecdsa.PrivateKey) []byte {
+	single := testOCSPSingleResponse{CertID: certID, ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour)}
+	if revoked {
+		single.Revoked.RevocationTime = time.Now().Add(-time.Hour)
+	} else {
+		single.Good = true
+	}
+	keyID, _ := asn1.Marshal(certID.IssuerKeyHash)
+	tbs, _ := asn1.Marshal(testOCSPResponseData{
+		ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyID},
+		ProducedAt:  time.Now(), Responses: []testOCSPSingleResponse{single}})
+	digest := sha256.Sum256(tbs)
+	sig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	basic, _ := asn1.Marshal(testOCSPBasicResponse{TBSResponseData: asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: len(sig) * 8}})
+	resp, _ := asn1.Marshal(testOCSPResponse{Response: testOCSPResponseBytes{
+		ResponseType: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}, Response: basic}})
+	return resp
+}
+
+// startFakeRedis - a server for the GET and SET commands of Redis
+func startFakeRedis(t *testing.T) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	store := map[string]string{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					line, err := rd.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					args := make([]string, n)
+					for i := range args {
+						line, _ = rd.ReadString('\n')
+						size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+						buf := make([]byte, size+2)
+						if _, err = io.ReadFull(rd, buf); err != nil {
+							return
+						}
+						args[i] = string(buf[:size])
+					}
+					mu.Lock()
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						if val, ok := store[args[1]]; ok {
+							conn.Write([]byte("$" + strconv.Itoa(len(val)) + "\r\n" + val + "\r\n"))
+						} else {
+							conn.Write([]byte("$-1\r\n"))
+						}
+					case "SET":
+						store[args[1]] = args[2]
+						conn.Write([]byte("+OK\r\n"))
+					default:
+						conn.Write([]byte("-ERR unknown command\r\n"))
+					}
+					mu.Unlock()
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func TestOCSPCheck(t *testing.T) {
+	root, rootKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "OCSP Root"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0), IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature}, nil, nil)
+	_, otherKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "OCSP Other"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0)}, nil, nil)
+
+	var fetches int32
+	var mode atomic.Value
+	mode.Store("ok")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		data, _ := ioutil.ReadAll(r.Body)
+		var req testOCSPRequest
+		asn1.Unmarshal(data, &req)
+		certID := req.TBSRequest.RequestList[0].Cert
+		switch mode.Load().(string) {
+		case "down":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "badsig":
+			w.Write(createOCSPResponse(certID, false, otherKey))
+		default:
+			w.Write(createOCSPResponse(certID, certID.SerialNumber.Int64() == 666, rootKey))
+		}
+	}))
+	defer server.Close()
+
+	leafPEM := func(serial int64) []byte {
+		leaf, _ := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: "OCSP Leaf"},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0),
+			KeyUsage: x509.KeyUsageDigitalSignature, OCSPServer: []string{server.URL}}, root, rootKey)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	}
+
+	os.WriteFile("dummyOCSPRoot.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0640)
+	defer os.Remove("dummyOCSPRoot.pem")
+	secsipid.SJWTLibOptSetS("CertCAFile", "dummyOCSPRoot.pem")
+	defer secsipid.SJWTLibOptSetS("CertCAFile", "")
+	secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA|secsipid.CertVerifyOptOCSP)
+	defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+	defer secsipid.SJWTOCSPCacheFlush()
+
+	t.Run("OK with good status cached in memory", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		cert := leafPEM(100)
+		ret, _ := secsipid.SJWTPubKeyVerify(cert)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		ret, _ = secsipid.SJWTPubKeyVerify(cert)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(atomic.LoadInt32(&fetches)).ToBe(int32(1))
+		stats := secsipid.SJWTOCSPCacheStats()
+		expect(stats.LocalHits).ToBe(uint64(1))
+		expect(stats.MaxAge >= 60).ToBe(true)
+	})
+
+	t.Run("ErrCertRevoked with revoked status", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, err := secsipid.SJWTPubKeyVerify(leafPEM(666))
+		expect(ret).ToBe(secsipid.SJWTRetErrCertRevoked)
+		expect(err.Error()).ToBe("OCSP status - certificate is revoked")
+	})
+
+	t.Run("OK with response from the shared cache", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		addr, stop := startFakeRedis(t)
+		defer stop()
+		expect(secsipid.SJWTLibOptSetS("OCSPShared", "redis://"+addr+"/0")).ToBe(secsipid.SJWTRetOK)
+		defer secsipid.SJWTLibOptSetS("OCSPShared", "")
+
+		cert := leafPEM(200)
+		start := atomic.LoadInt32(&fetches)
+		ret, _ := secsipid.SJWTPubKeyVerify(cert)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		secsipid.SJWTOCSPCacheFlush()
+		ret, _ = secsipid.SJWTPubKeyVerify(cert)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(atomic.LoadInt32(&fetches)).ToBe(start + 1)
+		expect(secsipid.SJWTOCSPCacheStats().SharedHits).ToBe(uint64(1))
+	})
+
+	t.Run("ErrCertOCSPInvalid with invalid signature", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		mode.Store("badsig")
+		defer mode.Store("ok")
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM(300))
+		expect(ret).ToBe(secsipid.SJWTRetErrCertOCSPInvalid)
+	})
+
+	t.Run("ErrCertOCSPUnavailable with responder failure", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		mode.Store("down")
+		defer mode.Store("ok")
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM(400))
+		expect(ret).ToBe(secsipid.SJWTRetErrCertOCSPUnavailable)
+		expect(secsipid.SJWTRetIsUnavailable(ret)).ToBe(true)
+	})
+}
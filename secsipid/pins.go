@@ -0,0 +1,193 @@
+package secsipid
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// policies for the pinned public keys
+const (
+	PinPolicyNone     = 0
+	PinPolicyFallback = 1
+	PinPolicyEnforce  = 2
+)
+
+type sjwtPinnedKey struct {
+	pem []byte
+	der []byte
+	key *ecdsa.PublicKey
+}
+
+// pinned public keys of the partners, by x5u host or by "spc:" followed by
+// the service provider code
+var pinList = struct {
+	sync.RWMutex
+	keys map[string]*sjwtPinnedKey
+}{}
+
+// SJWTPinLoad - load the pinned public keys from file, with one pin per line
+// given as the x5u host (or spc:<code>) and the path to the public key or the
+// certificate (PEM format). Empty lines and lines starting with '#' are ignored.
+func SJWTPinLoad(filePath string) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return SJWTRetErrFileRead, err
+	}
+	keys := make(map[string]*sjwtPinnedKey)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return SJWTRetErrFileRead, fmt.Errorf("invalid pin line: %s", line)
+		}
+		pemData, err := os.ReadFile(fields[1])
+		if err != nil {
+			return SJWTRetErrFileRead, err
+		}
+		ecdsaPubKey, ret, err := SJWTParseECPublicKeyFromPEM(pemData)
+		if err != nil {
+			return ret, fmt.Errorf("invalid pinned key %s: %v", fields[1], err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(ecdsaPubKey)
+		if err != nil {
+			return SJWTRetErrCertInvalidEC, err
+		}
+		keys[strings.ToLower(fields[0])] = &sjwtPinnedKey{pem: pemData, der: der, key: ecdsaPubKey}
+	}
+	if err = scanner.Err(); err != nil {
+		return SJWTRetErrFileRead, err
+	}
+	pinList.Lock()
+	pinList.keys = keys
+	pinList.Unlock()
+	return SJWTRetOK, nil
+}
+
+func sjwtPinGet(name string) *sjwtPinnedKey {
+	pinList.RLock()
+	defer pinList.RUnlock()
+	return pinList.keys[strings.ToLower(name)]
+}
+
+func sjwtPinHost(x5uVal string) string {
+	u, err := url.Parse(x5uVal)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// service provider codes of the certificates fetched from the x5u hosts, for
+// using the pins of the service provider codes when the hosts are unreachable
+var pinHostSPC = struct {
+	sync.RWMutex
+	spcs map[string]string
+}{spcs: make(map[string]string)}
+
+// sjwtPinLearnSPC - keep the service provider code of the certificate fetched
+// from the x5u host
+func sjwtPinLearnSPC(x5uVal string, certPEM []byte) {
+	if globalLibOptions.pinPolicy < PinPolicyFallback {
+		return
+	}
+	spc, _, _ := SJWTGetCertSPC(certPEM)
+	if len(spc) == 0 {
+		return
+	}
+	host := strings.ToLower(sjwtPinHost(x5uVal))
+	pinHostSPC.Lock()
+	pinHostSPC.spcs[host] = spc
+	pinHostSPC.Unlock()
+}
+
+// sjwtPinFetchUnavailable - true if the certificate could not be fetched
+// because the repository is unreachable or failing (transport errors,
+// timeouts and 5xx status codes), not because it was refused or invalid
+func sjwtPinFetchUnavailable(ret int, err error) bool {
+	switch ret {
+	case SJWTRetErrHTTPGet, SJWTRetErrHTTPTimeout:
+		return true
+	case SJWTRetErrHTTPStatusCode:
+		var statusErr *sjwtHTTPStatusError
+		return errors.As(err, &statusErr) && statusErr.code >= 500
+	}
+	return false
+}
+
+// sjwtPinIsCert - true if the pinned PEM data is a certificate, not only a
+// public key
+func sjwtPinIsCert(pemData []byte) bool {
+	block, _ := pem.Decode(pemData)
+	return block != nil && block.Type == "CERTIFICATE"
+}
+
+// sjwtPinFallback - the pinned public key to verify the token when the
+// certificate cannot be fetched because the repository is unavailable: the
+// one of the x5u host, otherwise the one of the service provider code of the
+// certificate last fetched from the x5u host
+func sjwtPinFallback(x5uVal string, ret int, err error) []byte {
+	if globalLibOptions.pinPolicy < PinPolicyFallback || !sjwtPinFetchUnavailable(ret, err) {
+		return nil
+	}
+	host := strings.ToLower(sjwtPinHost(x5uVal))
+	if len(host) == 0 {
+		return nil
+	}
+	if pin := sjwtPinGet(host); pin != nil {
+		return pin.pem
+	}
+	pinHostSPC.RLock()
+	spc := pinHostSPC.spcs[host]
+	pinHostSPC.RUnlock()
+	if len(spc) == 0 {
+		return nil
+	}
+	if pin := sjwtPinGet("spc:" + spc); pin != nil {
+		return pin.pem
+	}
+	return nil
+}
+
+// sjwtPinCheck - with the enforce policy, the public key of the fetched
+// certificate must match the one pinned for the x5u host or for the service
+// provider code of the certificate
+func sjwtPinCheck(x5uVal string, certPEM []byte) (int, error) {
+	if globalLibOptions.pinPolicy < PinPolicyEnforce {
+		return SJWTRetOK, nil
+	}
+	names := []string{sjwtPinHost(x5uVal)}
+	if spc, _, _ := SJWTGetCertSPC(certPEM); len(spc) > 0 {
+		names = append(names, "spc:"+spc)
+	}
+	for _, name := range names {
+		pin := sjwtPinGet(name)
+		if pin == nil {
+			continue
+		}
+		ecdsaPubKey, ret, err := SJWTParseECPublicKeyFromPEM(certPEM)
+		if err != nil {
+			return ret, err
+		}
+		der, err := x509.MarshalPKIXPublicKey(ecdsaPubKey)
+		if err != nil {
+			return SJWTRetErrCertInvalidEC, err
+		}
+		if !bytes.Equal(der, pin.der) {
+			return SJWTRetErrCertPinMismatch, fmt.Errorf("public key not matching the one pinned for %s", name)
+		}
+	}
+	return SJWTRetOK, nil
+}
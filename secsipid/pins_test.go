@@ -0,0 +1,179 @@
+package secsipid_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func generateSPCCertPEM(spc string) ([]byte, []byte) {
+	prvkey, _, key := generateECKeyPEMs()
+	spcValue, _ := asn1.MarshalWithParams(spc, "ia5")
+	extValue, _ := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: spcValue}})
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2024),
+		Subject:      pkix.Name{Organization: []string{"Partner, Inc."}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 26}, Value: extValue},
+		},
+	}
+	certBytes, _ := x509.CreateCertificate(rand.Reader, cert, cert, &key.PublicKey, key)
+	return prvkey, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+}
+
+func TestPinnedKeys(t *testing.T) {
+	prvkey, cert := generateSPCCertPEM("1234")
+	_, otherPubkey, _ := generateECKeyPEMs()
+	os.WriteFile("dummyPinCert.pem", cert, 0640)
+	os.WriteFile("dummyPinOther.pem", otherPubkey, 0640)
+	defer os.Remove("dummyPinCert.pem")
+	defer os.Remove("dummyPinOther.pem")
+	defer os.Remove("dummyPins.txt")
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+	defer secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyNone)
+	defer secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "http://localhost:5555/cert.pem", prvkey)
+
+	t.Run("OK service provider code of the certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		spc, ret, _ := secsipid.SJWTGetCertSPC(cert)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(spc).ToBe("1234")
+	})
+
+	t.Run("ErrFileRead with invalid pin line", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyPins.txt", []byte("localhost\n"), 0640)
+		expect(secsipid.SJWTLibOptSetS("PinFile", "dummyPins.txt")).ToBe(secsipid.SJWTRetErrFileRead)
+	})
+
+	t.Run("OK with host pin when the repository is unreachable", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyPins.txt", []byte("# pins\nlocalhost dummyPinCert.pem\n"), 0640)
+		expect(secsipid.SJWTLibOptSetS("PinFile", "dummyPins.txt")).ToBe(secsipid.SJWTRetOK)
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{FetchFail: 100})
+
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyNone)
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPGet)
+
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyFallback)
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK with spc pin of the x5u host when the repository is unreachable", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyPins.txt", []byte("spc:5678 dummyPinOther.pem\nspc:1234 dummyPinCert.pem\n"), 0640)
+		secsipid.SJWTLibOptSetS("PinFile", "dummyPins.txt")
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyFallback)
+		otherHost, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "",
+			"http://127.0.0.1:5555/cert.pem", prvkey)
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{FetchFail: 100})
+		ret, _ := secsipid.SJWTCheckFullIdentity(otherHost, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPGet)
+
+		// the service provider code of the x5u host is known after fetching its certificate
+		shutdown := startTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(cert)
+		}))
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		shutdown()
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{FetchFail: 100})
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		ret, _ = secsipid.SJWTCheckFullIdentity(otherHost, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPGet)
+	})
+
+	t.Run("Pin used only when the repository is unavailable", func(t *testing.T) {
+		os.WriteFile("dummyPins.txt", []byte("localhost dummyPinCert.pem\n"), 0640)
+		secsipid.SJWTLibOptSetS("PinFile", "dummyPins.txt")
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyFallback)
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+
+		for _, tc := range []struct {
+			name   string
+			status int
+			ret    int
+		}{
+			{"ErrHTTPStatusCode with not found", http.StatusNotFound, secsipid.SJWTRetErrHTTPStatusCode},
+			{"ErrHTTPStatusCode with forbidden", http.StatusForbidden, secsipid.SJWTRetErrHTTPStatusCode},
+			{"OK with service unavailable", http.StatusServiceUnavailable, secsipid.SJWTRetOK},
+			{"OK with internal server error", http.StatusInternalServerError, secsipid.SJWTRetOK},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				expect := expectate.Expect(t)
+
+				shutdown := startTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(tc.status)
+				}))
+				defer shutdown()
+				ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+				expect(ret).ToBe(tc.ret)
+			})
+		}
+	})
+
+	t.Run("ErrCertExpired with expired pinned certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyPins.txt", []byte("localhost dummyPinCert.pem\n"), 0640)
+		secsipid.SJWTLibOptSetS("PinFile", "dummyPins.txt")
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyFallback)
+		secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptTimeOnly)
+		defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{FetchFail: 100})
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{FetchFail: 100, ClockSkew: 7200})
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 86400, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertExpired)
+	})
+
+	t.Run("ErrCertPinMismatch with enforce policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		shutdown := startTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(cert)
+		}))
+		defer shutdown()
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+
+		os.WriteFile("dummyPins.txt", []byte("spc:1234 dummyPinOther.pem\n"), 0640)
+		secsipid.SJWTLibOptSetS("PinFile", "dummyPins.txt")
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyFallback)
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		secsipid.SJWTLibOptSetN("PinPolicy", secsipid.PinPolicyEnforce)
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertPinMismatch)
+
+		os.WriteFile("dummyPins.txt", []byte("localhost dummyPinCert.pem\n"), 0640)
+		secsipid.SJWTLibOptSetS("PinFile", "dummyPins.txt")
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+}
@@ -0,0 +1,445 @@
+package secsipid
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"unicode/utf16"
+)
+
+// PKCS#12 (RFC 7292) structures, for importing the key and the certificate
+// chain of a bundle; the encryption with PBES2 (PBKDF2 with AES or 3DES, the
+// default of recent openssl versions) and with the legacy SHA1 and 3DES
+// scheme are supported, not the legacy RC2 one
+
+type p12PFX struct {
+	Version  int
+	AuthSafe p12ContentInfo
+	MacData  p12MacData `asn1:"optional"`
+}
+
+type p12ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type p12MacData struct {
+	Mac        p12DigestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type p12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type p12EncryptedData struct {
+	Version              int
+	EncryptedContentInfo p12EncryptedContentInfo
+}
+
+type p12EncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type p12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue  `asn1:"tag:0,explicit"`
+	Attributes []p12Attribute `asn1:"set,optional"`
+}
+
+type p12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type p12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type p12EncryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type p12PBEParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type p12PBES2Params struct {
+	KDF    pkix.AlgorithmIdentifier
+	Scheme pkix.AlgorithmIdentifier
+}
+
+type p12PBKDF2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+var (
+	oidP12Data          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidP12EncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidP12KeyBag        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidP12ShroudedKey   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidP12CertBag       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidP12X509Cert      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidP12SHA3DES       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidP12SHARC2        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidP12PBES2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidP12PBKDF2        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidP12DESEDE3CBC    = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidP12AES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidP12AES192CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidP12AES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// p12Hash - the hash function of the digest or HMAC algorithm
+func p12Hash(oid asn1.ObjectIdentifier) func() hash.Hash {
+	switch oid.String() {
+	case "1.3.14.3.2.26", "1.2.840.113549.2.7":
+		return sha1.New
+	case "2.16.840.1.101.3.4.2.1", "1.2.840.113549.2.9":
+		return sha256.New
+	case "2.16.840.1.101.3.4.2.2", "1.2.840.113549.2.10":
+		return sha512.New384
+	case "2.16.840.1.101.3.4.2.3", "1.2.840.113549.2.11":
+		return sha512.New
+	}
+	return nil
+}
+
+// p12BMPPassword - the password as BMPString with the trailing zeros, for
+// the key derivation of PKCS#12
+func p12BMPPassword(password string) []byte {
+	var buf bytes.Buffer
+	for _, c := range utf16.Encode([]rune(password)) {
+		buf.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	buf.Write([]byte{0, 0})
+	return buf.Bytes()
+}
+
+// p12KDF - the key derivation of PKCS#12 (RFC 7292, appendix B.2), the id
+// being 1 for the key, 2 for the IV and 3 for the MAC key
+func p12KDF(hfn func() hash.Hash, salt []byte, password []byte, iterations int, id byte, size int) []byte {
+	v := hfn().BlockSize()
+	fill := func(b []byte) []byte {
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	var I []byte
+	if len(salt) > 0 {
+		I = append(I, fill(salt)...)
+	}
+	if len(password) > 0 {
+		I = append(I, fill(password)...)
+	}
+	D := bytes.Repeat([]byte{id}, v)
+	var out []byte
+	for {
+		h := hfn()
+		h.Write(D)
+		h.Write(I)
+		A := h.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			h.Reset()
+			h.Write(A)
+			A = h.Sum(A[:0])
+		}
+		out = append(out, A...)
+		if len(out) >= size {
+			return out[:size]
+		}
+		B := new(big.Int).SetBytes(fill(A))
+		B.Add(B, big.NewInt(1))
+		for j := 0; j < len(I); j += v {
+			Ij := new(big.Int).SetBytes(I[j : j+v])
+			b := Ij.Add(Ij, B).Bytes()
+			if len(b) > v {
+				b = b[len(b)-v:]
+			}
+			for k := j; k < j+v; k++ {
+				I[k] = 0
+			}
+			copy(I[j+v-len(b):j+v], b)
+		}
+	}
+}
+
+// p12PBKDF2 - the key derivation of PKCS#5 (RFC 8018, section 5.2)
+func p12PBKDF2(hfn func() hash.Hash, password []byte, salt []byte, iterations int, size int) []byte {
+	prf := hmac.New(hfn, password)
+	var out []byte
+	for block := 1; len(out) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		U := prf.Sum(nil)
+		T := append([]byte(nil), U...)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(U)
+			U = prf.Sum(U[:0])
+			for x := range T {
+				T[x] ^= U[x]
+			}
+		}
+		out = append(out, T...)
+	}
+	return out[:size]
+}
+
+// p12Decrypt - decrypt the content with the password based encryption
+func p12Decrypt(alg pkix.AlgorithmIdentifier, data []byte, password string, bmpPassword []byte) ([]byte, int, error) {
+	var block cipher.Block
+	var iv []byte
+	var err error
+
+	switch {
+	case alg.Algorithm.Equal(oidP12SHA3DES):
+		params := p12PBEParams{}
+		if _, err = asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, SJWTRetErrPrvKeyInvalidFormat, err
+		}
+		key := p12KDF(sha1.New, params.Salt, bmpPassword, params.Iterations, 1, 24)
+		iv = p12KDF(sha1.New, params.Salt, bmpPassword, params.Iterations, 2, 8)
+		if block, err = des.NewTripleDESCipher(key); err != nil {
+			return nil, SJWTRetErrPrvKeyInvalidFormat, err
+		}
+	case alg.Algorithm.Equal(oidP12PBES2):
+		params := p12PBES2Params{}
+		if _, err = asn1.Unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, SJWTRetErrPrvKeyInvalidFormat, err
+		}
+		if !params.KDF.Algorithm.Equal(oidP12PBKDF2) {
+			return nil, SJWTRetErrPrvKeyInvalidFormat, fmt.Errorf("unsupported key derivation: %s", params.KDF.Algorithm)
+		}
+		kdfParams := p12PBKDF2Params{}
+		if _, err = asn1.Unmarshal(params.KDF.Parameters.FullBytes, &kdfParams); err != nil {
+			return nil, SJWTRetErrPrvKeyInvalidFormat, err
+		}
+		hfn := sha1.New
+		if len(kdfParams.PRF.Algorithm) > 0 {
+			if hfn = p12Hash(kdfParams.PRF.Algorithm); hfn == nil {
+				return nil, SJWTRetErrPrvKeyInvalidFormat, fmt.Errorf("unsupported key derivation hash: %s", kdfParams.PRF.Algorithm)
+			}
+		}
+		keyLen := 0
+		switch {
+		case params.Scheme.Algorithm.Equal(oidP12AES128CBC):
+			keyLen = 16
+		case params.Scheme.Algorithm.Equal(oidP12AES192CBC), params.Scheme.Algorithm.Equal(oidP12DESEDE3CBC):
+			keyLen = 24
+		case params.Scheme.Algorithm.Equal(oidP12AES256CBC):
+			keyLen = 32
+		default:
+			return nil, SJWTRetErrPrvKeyInvalidFormat, fmt.Errorf("unsupported encryption: %s", params.Scheme.Algorithm)
+		}
+		if _, err = asn1.Unmarshal(params.Scheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, SJWTRetErrPrvKeyInvalidFormat, err
+		}
+		key := p12PBKDF2(hfn, []byte(password), kdfParams.Salt, kdfParams.Iterations, keyLen)
+		if params.Scheme.Algorithm.Equal(oidP12DESEDE3CBC) {
+			block, err = des.NewTripleDESCipher(key)
+		} else {
+			block, err = aes.NewCipher(key)
+		}
+		if err != nil {
+			return nil, SJWTRetErrPrvKeyInvalidFormat, err
+		}
+	case alg.Algorithm.Equal(oidP12SHARC2):
+		return nil, SJWTRetErrPrvKeyInvalidFormat, errors.New("unsupported legacy RC2 encryption - export the bundle with AES")
+	default:
+		return nil, SJWTRetErrPrvKeyInvalidFormat, fmt.Errorf("unsupported encryption: %s", alg.Algorithm)
+	}
+
+	bs := block.BlockSize()
+	if len(iv) != bs || len(data) == 0 || len(data)%bs != 0 {
+		return nil, SJWTRetErrPrvKeyInvalidFormat, errors.New("invalid size of encrypted data")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > bs || !bytes.Equal(out[len(out)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, SJWTRetErrPrvKeyInvalid, errors.New("decryption failed - invalid password")
+	}
+	return out[:len(out)-pad], SJWTRetOK, nil
+}
+
+// p12VerifyMac - check the integrity of the bundle, returning the password
+// in the form that matched (for the empty password, being either only the
+// trailing zeros or nothing)
+func p12VerifyMac(macData *p12MacData, content []byte, password string) ([]byte, int, error) {
+	bmpPassword := p12BMPPassword(password)
+	if len(macData.Mac.Algorithm.Algorithm) == 0 {
+		return bmpPassword, SJWTRetOK, nil
+	}
+	hfn := p12Hash(macData.Mac.Algorithm.Algorithm)
+	if hfn == nil {
+		return nil, SJWTRetErrPrvKeyInvalidFormat, fmt.Errorf("unsupported MAC algorithm: %s", macData.Mac.Algorithm.Algorithm)
+	}
+	candidates := [][]byte{bmpPassword}
+	if len(password) == 0 {
+		candidates = append(candidates, nil)
+	}
+	for _, candidate := range candidates {
+		key := p12KDF(hfn, macData.MacSalt, candidate, macData.Iterations, 3, hfn().Size())
+		mac := hmac.New(hfn, key)
+		mac.Write(content)
+		if hmac.Equal(mac.Sum(nil), macData.Mac.Digest) {
+			return candidate, SJWTRetOK, nil
+		}
+	}
+	return nil, SJWTRetErrPrvKeyInvalid, errors.New("MAC verification failed - invalid password")
+}
+
+// SJWTParsePKCS12 - extract the private key and the certificate chain from
+// the PKCS#12 bundle; the key is returned PEM encoded (SEC1 for EC keys,
+// otherwise PKCS8), nil if the bundle has none, and the chain as PEM data with
+// the certificate of the key first, followed by its issuers
+func SJWTParsePKCS12(data []byte, password string) ([]byte, []byte, int, error) {
+	pfx := p12PFX{}
+	if _, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, nil, SJWTRetErrPrvKeyInvalidFormat, fmt.Errorf("invalid PKCS#12 bundle: %v", err)
+	}
+	if pfx.Version != 3 || !pfx.AuthSafe.ContentType.Equal(oidP12Data) {
+		return nil, nil, SJWTRetErrPrvKeyInvalidFormat, errors.New("invalid PKCS#12 bundle - only password integrity mode is supported")
+	}
+	var content []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &content); err != nil {
+		return nil, nil, SJWTRetErrPrvKeyInvalidFormat, err
+	}
+	bmpPassword, ret, err := p12VerifyMac(&pfx.MacData, content, password)
+	if err != nil {
+		return nil, nil, ret, err
+	}
+
+	var authSafe []p12ContentInfo
+	if _, err = asn1.Unmarshal(content, &authSafe); err != nil {
+		return nil, nil, SJWTRetErrPrvKeyInvalidFormat, err
+	}
+	var keys [][]byte
+	var certs []*x509.Certificate
+	for _, ci := range authSafe {
+		var safeContents []byte
+		switch {
+		case ci.ContentType.Equal(oidP12Data):
+			if _, err = asn1.Unmarshal(ci.Content.Bytes, &safeContents); err != nil {
+				return nil, nil, SJWTRetErrPrvKeyInvalidFormat, err
+			}
+		case ci.ContentType.Equal(oidP12EncryptedData):
+			encData := p12EncryptedData{}
+			if _, err = asn1.Unmarshal(ci.Content.Bytes, &encData); err != nil {
+				return nil, nil, SJWTRetErrPrvKeyInvalidFormat, err
+			}
+			if safeContents, ret, err = p12Decrypt(encData.EncryptedContentInfo.ContentEncryptionAlgorithm,
+				encData.EncryptedContentInfo.EncryptedContent, password, bmpPassword); err != nil {
+				return nil, nil, ret, err
+			}
+		default:
+			return nil, nil, SJWTRetErrPrvKeyInvalidFormat, fmt.Errorf("unsupported content type: %s", ci.ContentType)
+		}
+		var bags []p12SafeBag
+		if _, err = asn1.Unmarshal(safeContents, &bags); err != nil {
+			return nil, nil, SJWTRetErrPrvKeyInvalidFormat, err
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidP12KeyBag):
+				keys = append(keys, bag.Value.Bytes)
+			case bag.ID.Equal(oidP12ShroudedKey):
+				encKey := p12EncryptedPrivateKeyInfo{}
+				if _, err = asn1.Unmarshal(bag.Value.Bytes, &encKey); err != nil {
+					return nil, nil, SJWTRetErrPrvKeyInvalidFormat, err
+				}
+				keyDer, ret, err := p12Decrypt(encKey.Algorithm, encKey.EncryptedData, password, bmpPassword)
+				if err != nil {
+					return nil, nil, ret, err
+				}
+				keys = append(keys, keyDer)
+			case bag.ID.Equal(oidP12CertBag):
+				certBag := p12CertBag{}
+				if _, err = asn1.Unmarshal(bag.Value.Bytes, &certBag); err != nil {
+					return nil, nil, SJWTRetErrCertInvalidFormat, err
+				}
+				if !certBag.ID.Equal(oidP12X509Cert) {
+					continue
+				}
+				cert, err := x509.ParseCertificate(certBag.Data)
+				if err != nil {
+					return nil, nil, SJWTRetErrCertInvalid, err
+				}
+				certs = append(certs, cert)
+			}
+		}
+	}
+	if len(keys) > 1 {
+		return nil, nil, SJWTRetErrPrvKeyInvalidFormat, errors.New("more than one private key in PKCS#12 bundle")
+	}
+
+	var keyPEM []byte
+	leaf := -1
+	if len(keys) == 1 {
+		prvKey, err := x509.ParsePKCS8PrivateKey(keys[0])
+		if err != nil {
+			return nil, nil, SJWTRetErrPrvKeyInvalid, err
+		}
+		pubDer, err := x509.MarshalPKIXPublicKey(prvKey.(crypto.Signer).Public())
+		if err != nil {
+			return nil, nil, SJWTRetErrPrvKeyInvalid, err
+		}
+		for i, cert := range certs {
+			if certDer, _ := x509.MarshalPKIXPublicKey(cert.PublicKey); bytes.Equal(certDer, pubDer) {
+				leaf = i
+				break
+			}
+		}
+		if len(certs) > 0 && leaf < 0 {
+			return nil, nil, SJWTRetErrCertInvalid, errors.New("no certificate for the private key in PKCS#12 bundle")
+		}
+		if ecKey, ok := prvKey.(*ecdsa.PrivateKey); ok {
+			der, _ := x509.MarshalECPrivateKey(ecKey)
+			keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		} else {
+			keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keys[0]})
+		}
+	}
+	if len(certs) == 0 {
+		return keyPEM, nil, SJWTRetOK, nil
+	}
+	if leaf < 0 {
+		leaf = 0
+		for i, cert := range certs {
+			if !cert.IsCA {
+				leaf = i
+				break
+			}
+		}
+	}
+	return keyPEM, sjwtCertsPEM(sjwtOrderCerts(certs, leaf)), SJWTRetOK, nil
+}
@@ -0,0 +1,126 @@
+package secsipid_test
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// PKCS#12 bundles exported by openssl 3 with the password 'secret', having a
+// P-256 key, its certificate (CN=Test Leaf) and the CA one (CN=Test CA):
+// with the default encryption (PBES2, AES-256 and HMAC-SHA256) and with the
+// legacy one (SHA1 and 3DES)
+const p12Modern = `MIIFXAIBAzCCBRIGCSqGSIb3DQEHAaCCBQMEggT/MIIE+zCCA7IGCSqGSIb3DQEHBqCCA6MwggOfAgEAMIIDmAYJKoZIhvcNAQcB
+MFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAjHjTQtm7jEmQICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEELnK
+N1CZXJUGB/O6tA83ueaAggMwpGURQ8gYeihwNgfRDOhJ7BLAdgn07ScX1QbWnNLXWGqhXVupKGgl/F+anxRhjUkk4V0NJPs30jYP
+pJ0UgVS5ky3g5YbmsTmxL2bqRspBU16VVvJGJzs/umBoBDsNbm2MXIbkDXGHVaGWSXLZVOia41Ju8z1bS0JuiiXvRcLBXMKz10zz
+uLPyYutz6UY3zU3xxXCUlYrt5n3E6mg3Nz5robvYVWZ408gSNCJEc2QuwOtyQCFdb9EIoKvYpS6nsdaiPsuVZYbrdYoY7WNllZVT
+2Egx1OZKPuEEwFYSQDmvUMR8Ktj5zgwauQtHDLcR9WCGNtEbIT/7GyFfFPjAWv7SXhh5uV1JV/902w8RTZsUlkgb6jUOQrqKR5Wb
+TmO1RxgKxDakwn9xxIcIPoWvyfq4BW4QlGXeFrJiwJzyku6pJPJmu4kqLH69lPbF55At34HJJGN1x1bFr/CdFUcRMOEVJkRbjl72
+r60dK0WVmNW77Q7gRfN/Ep8mgG+DEHHJTB1yZZa07TMtl0H6mFvLsf87zVi+igcuVQzzj+McKWY7kNWRv1x1pzdLoFd4j6KkmRZa
+pCJHZQnWDWtbJRl919T04u7ILHiNW+jiMYxWvwTfi5pJ04zglwMg6g5w99LHjHO/z2phZ2u7VRj1tnxdZwAlRsZSmtV/62t+NgeC
+DBYax/taImD63vOswRL9czo64ZlS6g4eTtkeXm30zsgh1scwsGneyYLenQVosfgzyOGURTxGb+oSHRjR72e/YwBSjACCzs2MKLf9
+LUYLl6Af6ycMMXHJrbA9yHBe5ro3WNRMj9200ykwAUqiUcAeqCg93QV0/lzKakj/a6OS5jD0gPygIM8uqzMy2G/Pcvdj3ZW9abIy
+1MC/OK6JvqDhqrpeSJ0fO7zuh87tvSOQDJeZLaYD2h1qmXtSWrv7OIfI9u5PaPY2aRfNuI8MAuVK3VyCe9NCy6d+0IdSsphEj12K
+Spofp3XmU9QTAODsaqqj24yOcA5NR/Ow/mwlGdTjLuYDPZxuKrckCKEeNEvuX58iNcCmZUivAXkhPyf772p0PzwwYbqqxSRuo1A4
+DukW+xttD11KMIIBQQYJKoZIhvcNAQcBoIIBMgSCAS4wggEqMIIBJgYLKoZIhvcNAQwKAQKgge8wgewwVwYJKoZIhvcNAQUNMEow
+KQYJKoZIhvcNAQUMMBwECLms8MAsuXSxAgIIADAMBggqhkiG9w0CCQUAMB0GCWCGSAFlAwQBKgQQS739hQb53NG73407P96KJASB
+kNeEI6JZd+jFQmcfTfanzlf53ttG79jluXQB/sjP2kJKMxdBXxU82s92+8WkecWAOKnuBRzDL93Dqjt7WOJ+OynIZ6NhJ2vsNSe+
+lg7hyGEbO6ROZM9sMZGVmnut/nGhZ4OfxENNwqDpE4dkjUHKwCbxQtbLvASZpEpxPW4L2+xuoUeWYd8TTSRfe6O7vIkryzElMCMG
+CSqGSIb3DQEJFTEWBBS3C56lOcg1Bn+UkjWj3CMeIRHz/DBBMDEwDQYJYIZIAWUDBAIBBQAEIMwCAhLrTVJslwxjt+aYxT+XTvqR
+5b24i9pihP5bDhSPBAjRXcpLlKmpWQICCAA=`
+
+const p12Legacy = `MIIE0gIBAzCCBJgGCSqGSIb3DQEHAaCCBIkEggSFMIIEgTCCA3cGCSqGSIb3DQEHBqCCA2gwggNkAgEAMIIDXQYJKoZIhvcNAQcB
+MBwGCiqGSIb3DQEMAQMwDgQICDw7UTFVh1oCAggAgIIDMHXVabKzXs7+v+Aa3McmD+IQXMimeyeNkOzlznFe+o/v4EW7FiK9EAra
+gUeVKPoEpiRlJ/SW6cneMg4D+SgPvmNvNC9pd9lMHtDk9fUK5Qzfp2eVwbN8QKZ/jomAp9AYkcw4a6T4531H3lnW2sMX5YSt+ZlA
+RxiyvpBnu59jPIwf7bsbm+uLBcOENnUAqW6jZstGUiT+uz9Et5/RjHGg546Mya5OT6fgDyYv2XiDbPEPabIlWZq+YWQ8EEHf15Fa
+vbLn3qcYRiWdwtGXcxDtfxkDij7OgiqHbs2fiacGOc+S2x/zkO8mHbPX/l+GXHgKJhaaho3RSBhd8LYsOHuhhjIdhRHFnvyLOmd0
+xieBPwCxmJ8c1tx+7/C8e9fbKDcClcw9B+0PLEMNAIVq2Sfnhf7koDj5xFRr7roglW4cX1wH9mkRbKlKzrosDbXih6d07ymcY8P+
+GzVRI1OyQqZG94wCde3frIyJOy6QAVqjj2eJq7S2463ncqMuymCq3g+9+dEMY2t2hi+Pqv2rw+2zSjuFtQ8e66BSZCvxUqKBjsl9
+H2vRS0yqQQnjq7js9ldXFBBnkZvKQh5AS4og18Gqu1XRMiKE7szmwRTIwiFyeGOBkozUUiOn1rHx6+kLP6avUXqyPBfFe24jwhFv
+HLXajhSUV/uOMtcbTgZ9PKZSyVbwjrGZZNCa5GU1pAKrhdhMz+oClLj5suNmlMtQiOTEHNSu7o2385UrB2vcA7l01frJljhX9/rd
+2KM620dbJ5fMKtFxsDkfLJQjhXd+AVk/TPVnA8ZI08rRCBHAiZ3WvIC37gvCoMdXtO53MvOhmHD1UyUbZpujAp8n+1F4Mo6EW/cu
+w7OuN4xKCWywigSJunYJ4sjXRfwQRzYjDJEK6qMhfDMBAeaejv2I/y76PBcR3FLziePoqoi3JNX2+dzOmGU0/tFgOZMakxbtczxs
+EuiaJpWY4xFAisGprNqn23WXW0eSyzabnFzEm3aK/Yg0oeyD+toEJ+foi8lH5r3H8cWx1ZwEh7JMx0OVuIhl0vexNj8I/tkq59D/
+qWDrPitRAuwOcIuSwC0Y7ECYwqgokfOSzjCCAQIGCSqGSIb3DQEHAaCB9ASB8TCB7jCB6wYLKoZIhvcNAQwKAQKggbQwgbEwHAYK
+KoZIhvcNAQwBAzAOBAg6MK/4AJsAWgICCAAEgZCiSXHNKnTJbdUkvju/i3371B4YxlAu7OIbtvsTs+eCLdSRmH1bx7swAk2AdypP
+KM+cETd0dK/JJ471ZngVywfg88rxPvH24h6XQMq1PLgPprGW8VZh5p1i4DHa9sfar+aaq0mHls3NKadXQvl/Ibv2kY56ZVl2HBFk
+sLGOxQvpByhqxHjD9IJSSN17nrCszSkxJTAjBgkqhkiG9w0BCRUxFgQUtwuepTnINQZ/lJI1o9wjHiER8/wwMTAhMAkGBSsOAwIa
+BQAEFM8jJMUpdmcf/PSN5pgamqNI6Ob4BAhdTdt2+YKmNQICCAA=`
+
+func TestParsePKCS12(t *testing.T) {
+	decode := func(val string) []byte {
+		data, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(val, "\n", ""))
+		return data
+	}
+	subjects := func(chain []byte) []string {
+		var names []string
+		for block, rest := pem.Decode(chain); block != nil; block, rest = pem.Decode(rest) {
+			cert, _ := x509.ParseCertificate(block.Bytes)
+			names = append(names, cert.Subject.CommonName)
+		}
+		return names
+	}
+
+	for name, bundle := range map[string]string{"default": p12Modern, "legacy": p12Legacy} {
+		t.Run("OK with "+name+" encryption", func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			prvkey, chain, ret, err := secsipid.SJWTParsePKCS12(decode(bundle), "secret")
+			expect(ret).ToBe(secsipid.SJWTRetOK)
+			expect(err).ToBe(nil)
+			expect(subjects(chain)).ToEqual([]string{"Test Leaf", "Test CA"})
+
+			keyID, _, _ := secsipid.SJWTKeyID(prvkey)
+			certKeyID, _, _ := secsipid.SJWTPubKeyID(chain)
+			expect(len(keyID) > 0).ToBe(true)
+			expect(keyID).ToBe(certKeyID)
+		})
+	}
+
+	t.Run("ErrPrvKeyInvalid with wrong password", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, _, ret, err := secsipid.SJWTParsePKCS12(decode(p12Modern), "wrong")
+		expect(ret).ToBe(secsipid.SJWTRetErrPrvKeyInvalid)
+		expect(getMsgFromErr(err)).ToBe("MAC verification failed - invalid password")
+	})
+
+	t.Run("ErrPrvKeyInvalidFormat with PEM data", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prvkey, _, _ := generateECKeyPEMs()
+		_, _, ret, _ := secsipid.SJWTParsePKCS12(prvkey, "secret")
+		expect(ret).ToBe(secsipid.SJWTRetErrPrvKeyInvalidFormat)
+	})
+}
+
+func TestCertChainPEM(t *testing.T) {
+	_, chain, _, _ := secsipid.SJWTParsePKCS12(func() []byte {
+		data, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(p12Modern, "\n", ""))
+		return data
+	}(), "secret")
+	certs := strings.SplitAfter(string(chain), "-----END CERTIFICATE-----\n")
+	prvkey, _, _ := generateECKeyPEMs()
+
+	t.Run("OK with leaf first and other blocks dropped", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		out, ret, err := secsipid.SJWTCertChainPEM([]byte(certs[1] + string(prvkey) + certs[0]))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(string(out)).ToBe(string(chain))
+	})
+
+	t.Run("ErrCertInvalidFormat without certificates", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTCertChainPEM(prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertInvalidFormat)
+	})
+}
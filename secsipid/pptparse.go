@@ -0,0 +1,127 @@
+package secsipid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SJWTRph - resource priority claim of rph PASSporT (RFC 8443)
+type SJWTRph struct {
+	Auth []string `json:"auth"`
+}
+
+// SJWTRphPayload - payload of rph PASSporT
+type SJWTRphPayload struct {
+	Dest SJWTDest `json:"dest"`
+	IAT  int64    `json:"iat"`
+	Orig SJWTOrig `json:"orig"`
+	Rph  SJWTRph  `json:"rph"`
+}
+
+// SJWTRcdPayload - payload of rcd PASSporT (RFC 9795)
+type SJWTRcdPayload struct {
+	Crn  string   `json:"crn,omitempty"`
+	Dest SJWTDest `json:"dest"`
+	IAT  int64    `json:"iat"`
+	Orig SJWTOrig `json:"orig"`
+	RCD  SJWTRcd  `json:"rcd"`
+	// RCDI - integrity digests of rcd members, keyed by JSON pointer (e.g., "/icn")
+	RCDI map[string]string `json:"rcdi,omitempty"`
+}
+
+// sjwtParsePptPayload - decode the JSON payload, checking the common claims
+func sjwtParsePptPayload(data []byte, payload interface{}, dest *SJWTDest, orig *SJWTOrig) (int, error) {
+	if len(data) == 0 {
+		return SJWTRetErrJSONPayloadParse, errors.New("empty payload")
+	}
+	if err := json.Unmarshal(data, payload); err != nil {
+		return SJWTRetErrJSONPayloadParse, fmt.Errorf("invalid payload: %s", err.Error())
+	}
+	if len(dest.TN) == 0 {
+		return SJWTRetErrJSONPayloadDestTN, errors.New("no dest tn in payload")
+	}
+	if len(orig.TN) == 0 {
+		return SJWTRetErrJSONPayloadParse, errors.New("no orig tn in payload")
+	}
+	return SJWTRetOK, nil
+}
+
+// sjwtParsePptIdentity - the payload of the identity, which must have the ppt
+// in the header; the identity is not verified
+func sjwtParsePptIdentity(identityVal string, ppt string) ([]byte, int, error) {
+	parts, ret, err := SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return nil, ret, err
+	}
+	if parts.Header.Ppt != ppt {
+		return nil, SJWTRetErrJSONHdrPpt, fmt.Errorf("invalid ppt value: %s (expected %s)", parts.Header.Ppt, ppt)
+	}
+	return parts.Payload, SJWTRetOK, nil
+}
+
+// SJWTParseDivPayload - decode the JSON payload of div PASSporT
+func SJWTParseDivPayload(data []byte) (*SJWTDivPayload, int, error) {
+	payload := &SJWTDivPayload{}
+	if ret, err := sjwtParsePptPayload(data, payload, &payload.Dest, &payload.Orig); err != nil {
+		return nil, ret, err
+	}
+	if len(payload.Div.TN) == 0 {
+		return nil, SJWTRetErrJSONPayloadParse, errors.New("no div tn in payload")
+	}
+	return payload, SJWTRetOK, nil
+}
+
+// SJWTParseRphPayload - decode the JSON payload of rph PASSporT
+func SJWTParseRphPayload(data []byte) (*SJWTRphPayload, int, error) {
+	payload := &SJWTRphPayload{}
+	if ret, err := sjwtParsePptPayload(data, payload, &payload.Dest, &payload.Orig); err != nil {
+		return nil, ret, err
+	}
+	if len(payload.Rph.Auth) == 0 {
+		return nil, SJWTRetErrJSONPayloadParse, errors.New("no rph auth in payload")
+	}
+	return payload, SJWTRetOK, nil
+}
+
+// SJWTParseRcdPayload - decode the JSON payload of rcd PASSporT
+func SJWTParseRcdPayload(data []byte) (*SJWTRcdPayload, int, error) {
+	payload := &SJWTRcdPayload{}
+	if ret, err := sjwtParsePptPayload(data, payload, &payload.Dest, &payload.Orig); err != nil {
+		return nil, ret, err
+	}
+	if len(payload.RCD.Nam) == 0 {
+		return nil, SJWTRetErrJSONPayloadParse, errors.New("no rcd nam in payload")
+	}
+	return payload, SJWTRetOK, nil
+}
+
+// SJWTParseDivIdentity - decode the payload of the div identity; the identity
+// is not verified
+func SJWTParseDivIdentity(identityVal string) (*SJWTDivPayload, int, error) {
+	data, ret, err := sjwtParsePptIdentity(identityVal, "div")
+	if err != nil {
+		return nil, ret, err
+	}
+	return SJWTParseDivPayload(data)
+}
+
+// SJWTParseRphIdentity - decode the payload of the rph identity; the identity
+// is not verified
+func SJWTParseRphIdentity(identityVal string) (*SJWTRphPayload, int, error) {
+	data, ret, err := sjwtParsePptIdentity(identityVal, "rph")
+	if err != nil {
+		return nil, ret, err
+	}
+	return SJWTParseRphPayload(data)
+}
+
+// SJWTParseRcdIdentity - decode the payload of the rcd identity; the identity
+// is not verified
+func SJWTParseRcdIdentity(identityVal string) (*SJWTRcdPayload, int, error) {
+	data, ret, err := sjwtParsePptIdentity(identityVal, "rcd")
+	if err != nil {
+		return nil, ret, err
+	}
+	return SJWTParseRcdPayload(data)
+}
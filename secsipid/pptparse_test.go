@@ -0,0 +1,80 @@
+package secsipid_test
+
+import (
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestParsePptPayloads(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+
+	getIdentity := func(ppt string, payloadJSON string) string {
+		token, _, _ := secsipid.SJWTEncodeTextWithPrvKey(`{"alg":"ES256","ppt":"`+ppt+`","typ":"passport","x5u":"https://certs.example.com/cert.pem"}`,
+			payloadJSON, string(prvkey))
+		return token + ";info=<https://certs.example.com/cert.pem>;alg=ES256;ppt=" + ppt
+	}
+
+	t.Run("OK with div identity", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		shaken, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+		identities, _, _ := secsipid.SJWTGetDivIdentityPrvKey([]string{shaken}, "493033333333", "", prvkey)
+
+		payload, ret, err := secsipid.SJWTParseDivIdentity(identities[1])
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(payload.Orig.TN).ToBe("493011111111")
+		expect(payload.Div.TN).ToBe("493022222222")
+		expect(payload.Dest.TN).ToEqual([]string{"493033333333"})
+
+		_, ret, _ = secsipid.SJWTParseDivIdentity(shaken)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONHdrPpt)
+	})
+
+	t.Run("OK with rph identity", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identityVal := getIdentity("rph", `{"dest":{"tn":["493022222222"]},"iat":1700000000,"orig":{"tn":"493011111111"},"rph":{"auth":["ets.0"]}}`)
+
+		payload, ret, err := secsipid.SJWTParseRphIdentity(identityVal)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(payload.Rph.Auth).ToEqual([]string{"ets.0"})
+		expect(payload.IAT).ToBe(int64(1700000000))
+	})
+
+	t.Run("OK with rcd identity", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identityVal := getIdentity("rcd", `{"crn":"Support","dest":{"tn":["493022222222"]},"iat":1700000000,"orig":{"tn":"493011111111"},`+
+			`"rcd":{"nam":"Example Corp","icn":"https://example.com/logo.png"},"rcdi":{"/icn":"sha256-abc"}}`)
+
+		payload, ret, err := secsipid.SJWTParseRcdIdentity(identityVal)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(payload.Crn).ToBe("Support")
+		expect(payload.RCD.Nam).ToBe("Example Corp")
+		expect(payload.RCD.Icn).ToBe("https://example.com/logo.png")
+		expect(payload.RCDI["/icn"]).ToBe("sha256-abc")
+	})
+
+	t.Run("ErrJSONPayloadParse with missing extension claim", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, err := secsipid.SJWTParseRphPayload([]byte(`{"dest":{"tn":["493022222222"]},"iat":1700000000,"orig":{"tn":"493011111111"}}`))
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadParse)
+		expect(getMsgFromErr(err)).ToBe("no rph auth in payload")
+
+		_, ret, _ = secsipid.SJWTParseRcdPayload([]byte(`{"dest":{"tn":["493022222222"]},"iat":1700000000,"orig":{"tn":"493011111111"},"rcd":{}}`))
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadParse)
+	})
+
+	t.Run("ErrJSONPayloadDestTN without dest tn", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTParseDivPayload([]byte(`{"dest":{"tn":[]},"div":{"tn":"493022222222"},"iat":1700000000,"orig":{"tn":"493011111111"}}`))
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadDestTN)
+	})
+}
@@ -0,0 +1,145 @@
+package secsipid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// SJWTPrepared - the shaken PASSporT built but not signed, the signature of
+// the signing input being done elsewhere (e.g., by a HSM) with ES256
+type SJWTPrepared struct {
+	// Header, Payload - the canonical JSON of the PASSporT header and payload
+	Header  string `json:"header"`
+	Payload string `json:"payload"`
+	// SigningInput - the base64url encoded header and payload joined by '.'
+	SigningInput string `json:"signinginput"`
+	Alg          string `json:"alg"`
+	Ppt          string `json:"ppt"`
+	X5u          string `json:"x5u"`
+}
+
+// SJWTPrepareIdentityPayload - build the canonical header and payload of the
+// shaken PASSporT and the signing input, without signing it; the iat is set to
+// current time and the origid is generated if they are not provided
+func SJWTPrepareIdentityPayload(payload SJWTPayload, x5uVal string) (*SJWTPrepared, int, error) {
+	if globalLibOptions.dnoReject != 0 && SJWTDNOListed(payload.Orig.TN) {
+		return nil, SJWTRetErrPolicyDNO, errors.New("orig tn in do-not-originate list")
+	}
+	header := SJWTHeader{
+		Alg:     "ES256",
+		Ppt:     "shaken",
+		Typ:     "passport",
+		X5u:     SJWTSignX5u(x5uVal, nil, "shaken", payload.ATTest),
+		X5tS256: sjwtSignX5t(),
+	}
+	if ret, err := sjwtFillPayload(&payload); err != nil {
+		return nil, ret, err
+	}
+
+	hdrJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, SJWTRetErrJSONHdrParse, err
+	}
+	if hdrJSON, err = SJWTCanonicalJSON(hdrJSON); err != nil {
+		return nil, SJWTRetErrJSONHdrParse, err
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, SJWTRetErrJSONPayloadParse, err
+	}
+	if payloadJSON, err = SJWTCanonicalJSON(payloadJSON); err != nil {
+		return nil, SJWTRetErrJSONPayloadParse, err
+	}
+	return &SJWTPrepared{
+		Header:       string(hdrJSON),
+		Payload:      string(payloadJSON),
+		SigningInput: SJWTBase64EncodeString(string(hdrJSON)) + "." + SJWTBase64EncodeString(string(payloadJSON)),
+		Alg:          header.Alg,
+		Ppt:          header.Ppt,
+		X5u:          header.X5u,
+	}, SJWTRetOK, nil
+}
+
+// sjwtES256RawSignature - the ES256 signature with the r and s values
+// concatenated, converted from the DER encoding if it has not this form
+func sjwtES256RawSignature(sig []byte) ([]byte, int, error) {
+	if len(sig) == 64 {
+		return sig, SJWTRetOK, nil
+	}
+	var ecSig struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(sig, &ecSig); err != nil || len(rest) > 0 {
+		return nil, SJWTRetErrJSONSignatureSize, errors.New("signature must have the r and s values concatenated or be DER encoded")
+	}
+	if ecSig.R.Sign() <= 0 || ecSig.S.Sign() <= 0 || ecSig.R.BitLen() > 256 || ecSig.S.BitLen() > 256 {
+		return nil, SJWTRetErrJSONSignatureSize, errors.New("invalid r and s values of the signature")
+	}
+	raw := make([]byte, 64)
+	ecSig.R.FillBytes(raw[:32])
+	ecSig.S.FillBytes(raw[32:])
+	return raw, SJWTRetOK, nil
+}
+
+// SJWTFinalizeIdentity - build the Identity header value from the signing
+// input given by SJWTPrepareIdentityPayload() and its ES256 signature done
+// elsewhere, base64url (or base64) encoded with the r and s values
+// concatenated (as in JWS) or DER encoded; the signature is verified with the public key of the
+// certificate of the signer
+func SJWTFinalizeIdentity(signingInput string, signature string, certPEM []byte) (string, int, error) {
+	btoken := strings.Split(strings.TrimSpace(signingInput), ".")
+	if len(btoken) != 2 {
+		return "", SJWTRetErrSIPHdrParse, errors.New("invalid signing input - must contain header and payload")
+	}
+	vHeader, err := SJWTBase64DecodeBytes(btoken[0])
+	if err != nil {
+		return "", SJWTRetErrJSONHdrParse, err
+	}
+	header := SJWTHeader{}
+	if err = json.Unmarshal(vHeader, &header); err != nil {
+		return "", SJWTRetErrJSONHdrParse, err
+	}
+	if header.Alg != "ES256" {
+		return "", SJWTRetErrJSONHdrAlg, errors.New("invalid value for alg in json header - must be ES256")
+	}
+	if len(header.Ppt) == 0 {
+		return "", SJWTRetErrJSONHdrPpt, errors.New("no ppt in json header")
+	}
+	if len(header.X5u) == 0 {
+		return "", SJWTRetErrJSONHdrX5u, errors.New("no x5u in json header")
+	}
+	vPayload, err := SJWTBase64DecodeBytes(btoken[1])
+	if err != nil || !json.Valid(vPayload) {
+		return "", SJWTRetErrJSONPayloadParse, errors.New("invalid payload of signing input")
+	}
+
+	pubkey, ret, err := SJWTParsePublicKeyFromPEM(certPEM)
+	if err != nil {
+		return "", ret, err
+	}
+	if eckey, ok := pubkey.(*ecdsa.PublicKey); !ok || eckey.Curve != elliptic.P256() {
+		return "", SJWTRetErrCertInvalidEC, errors.New("certificate key not usable by ES256")
+	}
+	signature = strings.NewReplacer("+", "-", "/", "_").Replace(strings.TrimRight(strings.TrimSpace(signature), "="))
+	sig, err := SJWTBase64DecodeBytes(signature)
+	if err != nil {
+		return "", SJWTRetErrJSONSignatureNob64, err
+	}
+	if sig, ret, err = sjwtES256RawSignature(sig); err != nil {
+		return "", ret, err
+	}
+	sigVal := SJWTBase64EncodeBytes(sig)
+	if ret, err = SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], sigVal, pubkey); err != nil {
+		return "", ret, err
+	}
+	if ret, err = sjwtCheckThumbprint(btoken[0], certPEM); err != nil {
+		return "", ret, err
+	}
+	return btoken[0] + "." + btoken[1] + "." + sigVal + ";info=<" + header.X5u + ">;alg=" + header.Alg +
+		";ppt=" + header.Ppt, SJWTRetOK, nil
+}
@@ -0,0 +1,118 @@
+package secsipid_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestPrepareIdentity(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	payload := secsipid.SJWTPayload{ATTest: "A", Dest: secsipid.SJWTDest{TN: []string{"493022222222"}},
+		Orig: secsipid.SJWTOrig{TN: "493011111111"}, OrigID: "abc"}
+
+	t.Run("OK with external signature of signing input", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prepared, ret, err := secsipid.SJWTPrepareIdentityPayload(payload, "https://certs.example.com/cert.pem")
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(prepared.Header).ToBe(`{"alg":"ES256","ppt":"shaken","typ":"passport","x5u":"https://certs.example.com/cert.pem"}`)
+		expect(strings.HasPrefix(prepared.Payload, `{"attest":"A","dest":{"tn":["493022222222"]},"iat":`)).ToBe(true)
+		expect(prepared.SigningInput).ToBe(secsipid.SJWTBase64EncodeString(prepared.Header) + "." +
+			secsipid.SJWTBase64EncodeString(prepared.Payload))
+
+		key, _, _ := secsipid.SJWTParsePrivateKeyFromPEM(prvkey)
+		signature, _, _ := secsipid.SJWTSignWithPrvKey(prepared.SigningInput, key)
+		ret, err = secsipid.SJWTCheckIdentityPKMode(prepared.SigningInput+"."+signature, 60, string(pubkey), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("OK with default x5u", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prepared, ret, _ := secsipid.SJWTPrepareIdentityPayload(payload, "")
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(prepared.X5u).ToBe("https://127.0.0.1/cert.pem")
+	})
+
+	t.Run("ErrPolicyDNO with orig tn in do-not-originate list", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyPrepareDNO.txt", []byte("493011111111\n"), 0640)
+		defer os.Remove("dummyPrepareDNO.txt")
+
+		secsipid.SJWTLibOptSetS("DNOFile", "dummyPrepareDNO.txt")
+		secsipid.SJWTLibOptSetN("DNOReject", 1)
+		defer secsipid.SJWTLibOptSetN("DNOReject", 0)
+
+		_, ret, _ := secsipid.SJWTPrepareIdentityPayload(payload, "")
+		expect(ret).ToBe(secsipid.SJWTRetErrPolicyDNO)
+	})
+}
+
+func TestFinalizeIdentity(t *testing.T) {
+	prvkey, pubkey, key := generateECKeyPEMs()
+	_, otherPubkey, _ := generateECKeyPEMs()
+	payload := secsipid.SJWTPayload{ATTest: "A", Dest: secsipid.SJWTDest{TN: []string{"493022222222"}},
+		Orig: secsipid.SJWTOrig{TN: "493011111111"}}
+	prepared, _, _ := secsipid.SJWTPrepareIdentityPayload(payload, "https://certs.example.com/cert.pem")
+
+	t.Run("OK with signature as r and s values", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		parsedKey, _, _ := secsipid.SJWTParsePrivateKeyFromPEM(prvkey)
+		signature, _, _ := secsipid.SJWTSignWithPrvKey(prepared.SigningInput, parsedKey)
+
+		identityVal, ret, err := secsipid.SJWTFinalizeIdentity(prepared.SigningInput, signature, pubkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(identityVal).ToBe(prepared.SigningInput + "." + signature +
+			";info=<https://certs.example.com/cert.pem>;alg=ES256;ppt=shaken")
+		ret, _ = secsipid.SJWTCheckFullIdentityPubKey(identityVal, 60, string(pubkey))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK with DER encoded signature", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		digest := sha256.Sum256([]byte(prepared.SigningInput))
+		sig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+
+		_, ret, err := secsipid.SJWTFinalizeIdentity(prepared.SigningInput, base64.StdEncoding.EncodeToString(sig), pubkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("ErrJSONSignatureInvalid with other key", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		parsedKey, _, _ := secsipid.SJWTParsePrivateKeyFromPEM(prvkey)
+		signature, _, _ := secsipid.SJWTSignWithPrvKey(prepared.SigningInput, parsedKey)
+
+		_, ret, _ := secsipid.SJWTFinalizeIdentity(prepared.SigningInput, signature, otherPubkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+
+	t.Run("ErrJSONSignatureSize with invalid signature", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTFinalizeIdentity(prepared.SigningInput, secsipid.SJWTBase64EncodeString("short"), pubkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONSignatureSize)
+	})
+
+	t.Run("ErrSIPHdrParse with identity as signing input", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTFinalizeIdentity(prepared.SigningInput+".abc", "abc", pubkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrSIPHdrParse)
+	})
+}
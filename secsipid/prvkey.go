@@ -0,0 +1,61 @@
+package secsipid
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// private keys read from stdin or inherited file descriptors, kept in memory
+// because these sources can be read only once
+var prvKeyStreams = struct {
+	sync.Mutex
+	keys map[string][]byte
+}{keys: map[string][]byte{}}
+
+// SJWTReadPrvKey - read the private key from the location, which is a file path,
+// '-' for stdin, 'fd:N' for an inherited file descriptor or 'cred:NAME' for a
+// systemd credential (set with LoadCredential= in the unit file)
+func SJWTReadPrvKey(prvkeyPath string) ([]byte, error) {
+	if prvkeyPath == "-" || strings.HasPrefix(prvkeyPath, "fd:") {
+		prvKeyStreams.Lock()
+		defer prvKeyStreams.Unlock()
+		if data, ok := prvKeyStreams.keys[prvkeyPath]; ok {
+			return data, nil
+		}
+		f := os.Stdin
+		if prvkeyPath != "-" {
+			fd, err := strconv.Atoi(strings.TrimPrefix(prvkeyPath, "fd:"))
+			if err != nil || fd < 0 {
+				return nil, errors.New("invalid private key file descriptor")
+			}
+			f = os.NewFile(uintptr(fd), prvkeyPath)
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			return nil, errors.New("empty private key")
+		}
+		prvKeyStreams.keys[prvkeyPath] = data
+		return data, nil
+	}
+	if strings.HasPrefix(prvkeyPath, "cred:") {
+		credDir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if len(credDir) == 0 {
+			return nil, errors.New("no systemd credentials directory")
+		}
+		credName := strings.TrimPrefix(prvkeyPath, "cred:")
+		if len(credName) == 0 || strings.ContainsRune(credName, '/') {
+			return nil, errors.New("invalid systemd credential name")
+		}
+		return os.ReadFile(filepath.Join(credDir, credName))
+	}
+	return os.ReadFile(prvkeyPath)
+}
@@ -0,0 +1,55 @@
+package secsipid_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestReadPrvKey(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+
+	t.Run("OK with file descriptor read only once", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		r, w, _ := os.Pipe()
+		w.Write(prvkey)
+		w.Close()
+
+		fdPath := "fd:" + strconv.Itoa(int(r.Fd()))
+		data, err := secsipid.SJWTReadPrvKey(fdPath)
+		expect(err).ToBe(nil)
+		expect(string(data)).ToBe(string(prvkey))
+
+		data, err = secsipid.SJWTReadPrvKey(fdPath)
+		expect(err).ToBe(nil)
+		expect(string(data)).ToBe(string(prvkey))
+	})
+
+	t.Run("OK with systemd credential", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.Mkdir("dummyCreds", 0750)
+		defer os.RemoveAll("dummyCreds")
+		os.WriteFile("dummyCreds/stir-key", prvkey, 0600)
+		os.Setenv("CREDENTIALS_DIRECTORY", "dummyCreds")
+		defer os.Unsetenv("CREDENTIALS_DIRECTORY")
+
+		data, err := secsipid.SJWTReadPrvKey("cred:stir-key")
+		expect(err).ToBe(nil)
+		expect(string(data)).ToBe(string(prvkey))
+
+		_, err = secsipid.SJWTReadPrvKey("cred:../stir-key")
+		expect(getMsgFromErr(err)).ToBe("invalid systemd credential name")
+	})
+
+	t.Run("Error without credentials directory", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, err := secsipid.SJWTReadPrvKey("cred:stir-key")
+		expect(getMsgFromErr(err)).ToBe("no systemd credentials directory")
+	})
+}
@@ -0,0 +1,113 @@
+package secsipid
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+// SJWTRcd - rich call data claim (RFC 9795)
+type SJWTRcd struct {
+	Nam string          `json:"nam"`
+	Icn string          `json:"icn,omitempty"`
+	Jcl string          `json:"jcl,omitempty"`
+	Jcd json.RawMessage `json:"jcd,omitempty"`
+}
+
+func sjwtRcdiHash(alg string) hash.Hash {
+	switch alg {
+	case "sha256":
+		return sha256.New()
+	case "sha384":
+		return sha512.New384()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
+
+// SJWTRcdiDigest - integrity digest of the resource content, in the format
+// used by rcdi claim: '<alg>-<base64 of hash>'; alg is sha256 (default), sha384 or sha512
+func SJWTRcdiDigest(data []byte, alg string) (string, int, error) {
+	if len(alg) == 0 {
+		alg = "sha256"
+	}
+	h := sjwtRcdiHash(alg)
+	if h == nil {
+		return "", SJWTRetErr, fmt.Errorf("unsupported rcdi hash algorithm: %s", alg)
+	}
+	h.Write(data)
+	return alg + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil)), SJWTRetOK, nil
+}
+
+// SJWTRcdiVerifyData - check the resource content against the rcdi digest
+func SJWTRcdiVerifyData(data []byte, digest string) (int, error) {
+	alg := strings.SplitN(digest, "-", 2)[0]
+	vDigest, ret, err := SJWTRcdiDigest(data, alg)
+	if err != nil {
+		return ret, err
+	}
+	if vDigest != digest {
+		return SJWTRetErrJSONPayloadRcdi, fmt.Errorf("rcdi digest mismatch: %s", digest)
+	}
+	return SJWTRetOK, nil
+}
+
+// SJWTRcdiResource - content of the resource referenced by rcd, from http(s)
+// URL (using the certificates cache) or from local file
+func SJWTRcdiResource(src string, timeoutVal int) ([]byte, int, error) {
+	return sjwtRcdiResource(context.Background(), src, timeoutVal)
+}
+
+func sjwtRcdiResource(ctx context.Context, src string, timeoutVal int) ([]byte, int, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		end := sjwtSpan("secsipid.fetch", "url", src)
+		data, _, ret, err := sjwtGetURLContent(ctx, src, timeoutVal)
+		end(err)
+		return data, ret, err
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(src, "file://"))
+	if err != nil {
+		return nil, SJWTRetErrFileRead, err
+	}
+	return data, SJWTRetOK, nil
+}
+
+// SJWTRcdiCheck - fetch the externally hosted rcd resources (icn and jcl)
+// and verify them against the rcdi digests of the payload
+func SJWTRcdiCheck(payload *SJWTPayload, timeoutVal int) (int, error) {
+	return sjwtRcdiCheck(context.Background(), payload, timeoutVal)
+}
+
+func sjwtRcdiCheck(ctx context.Context, payload *SJWTPayload, timeoutVal int) (int, error) {
+	if payload.RCD == nil {
+		return SJWTRetOK, nil
+	}
+	resources := map[string]string{
+		"/icn": payload.RCD.Icn,
+		"/jcl": payload.RCD.Jcl,
+	}
+	for pointer, src := range resources {
+		if len(src) == 0 {
+			continue
+		}
+		digest, ok := payload.RCDI[pointer]
+		if !ok {
+			return SJWTRetErrJSONPayloadRcdi, fmt.Errorf("no rcdi digest for %s", pointer)
+		}
+		data, ret, err := sjwtRcdiResource(ctx, src, timeoutVal)
+		if err != nil {
+			return ret, err
+		}
+		if ret, err = SJWTRcdiVerifyData(data, digest); err != nil {
+			return ret, fmt.Errorf("%s: %v", pointer, err)
+		}
+	}
+	return SJWTRetOK, nil
+}
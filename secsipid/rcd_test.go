@@ -0,0 +1,55 @@
+package secsipid_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestRcdi(t *testing.T) {
+	os.WriteFile("dummyRcdLogo.png", []byte("dummy logo"), 0640)
+	defer os.Remove("dummyRcdLogo.png")
+
+	t.Run("OK with sha256 digest", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		digest, ret, err := secsipid.SJWTRcdiDigest([]byte("dummy logo"), "")
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+		expect(digest).ToBe("sha256-Ezpuud0pTeu0UZfXoEWl8xsND4Ko6JOTmByAv7fuNyI=")
+	})
+
+	t.Run("ErrJSONPayloadRcdi with modified resource", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		digest, _, _ := secsipid.SJWTRcdiDigest([]byte("dummy logo"), "sha384")
+		ret, _ := secsipid.SJWTRcdiVerifyData([]byte("other logo"), digest)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadRcdi)
+	})
+
+	t.Run("OK with rcdi of icn", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		digest, _, _ := secsipid.SJWTRcdiDigest([]byte("dummy logo"), "")
+		payload := &secsipid.SJWTPayload{
+			RCD:  &secsipid.SJWTRcd{Nam: "Example", Icn: "dummyRcdLogo.png"},
+			RCDI: map[string]string{"/icn": digest},
+		}
+		ret, err := secsipid.SJWTRcdiCheck(payload, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("ErrJSONPayloadRcdi without rcdi of icn", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		payload := &secsipid.SJWTPayload{
+			RCD: &secsipid.SJWTRcd{Nam: "Example", Icn: "dummyRcdLogo.png"},
+		}
+		ret, err := secsipid.SJWTRcdiCheck(payload, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadRcdi)
+		expect(getMsgFromErr(err)).ToBe("no rcdi digest for /icn")
+	})
+}
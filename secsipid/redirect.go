@@ -0,0 +1,158 @@
+package secsipid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// policies for the Identity of the INVITE recursed on a 3xx redirect
+const (
+	RedirectPolicyDiv    = 0
+	RedirectPolicyResign = 1
+	RedirectPolicyKeep   = 2
+)
+
+// SJWTParseRedirectTarget - the number targeted by the Contact of the 3xx
+// response (sip, sips or tel URI, with or without angle brackets), without
+// '+' and visual separators, and the Identity header values embedded as URI
+// headers (RFC 8946 section 7)
+func SJWTParseRedirectTarget(contactVal string) (string, []string, int, error) {
+	uri := strings.TrimSpace(contactVal)
+	if start := strings.Index(uri, "<"); start >= 0 {
+		end := strings.Index(uri[start:], ">")
+		if end < 0 {
+			return "", nil, SJWTRetErrRedirectTarget, errors.New("invalid contact uri")
+		}
+		uri = uri[start+1 : start+end]
+	}
+	var identityVals []string
+	if pos := strings.Index(uri, "?"); pos >= 0 {
+		for _, hdr := range strings.Split(uri[pos+1:], "&") {
+			hparts := strings.SplitN(hdr, "=", 2)
+			if len(hparts) != 2 || !strings.EqualFold(hparts[0], "Identity") {
+				continue
+			}
+			identityVal, err := url.QueryUnescape(hparts[1])
+			if err != nil {
+				return "", nil, SJWTRetErrRedirectTarget, fmt.Errorf("invalid identity uri header: %v", err)
+			}
+			identityVals = append(identityVals, identityVal)
+		}
+		uri = uri[:pos]
+	}
+	var user string
+	lcURI := strings.ToLower(uri)
+	switch {
+	case strings.HasPrefix(lcURI, "tel:"):
+		user = uri[4:]
+	case strings.HasPrefix(lcURI, "sip:"), strings.HasPrefix(lcURI, "sips:"):
+		user = uri[strings.Index(uri, ":")+1:]
+		pos := strings.LastIndex(user, "@")
+		if pos < 0 {
+			return "", nil, SJWTRetErrRedirectTarget, errors.New("no user part in contact uri")
+		}
+		user = user[:pos]
+	default:
+		return "", nil, SJWTRetErrRedirectTarget, errors.New("unsupported contact uri scheme")
+	}
+	if pos := strings.Index(user, ";"); pos >= 0 {
+		user = user[:pos]
+	}
+	tn := strings.TrimPrefix(strings.NewReplacer("-", "", ".", "", "(", "", ")", "").Replace(user), "+")
+	if len(tn) == 0 || strings.Trim(tn, "0123456789") != "" {
+		return "", nil, SJWTRetErrRedirectTarget, fmt.Errorf("contact uri user is not a telephone number: %s", user)
+	}
+	return tn, identityVals, SJWTRetOK, nil
+}
+
+// sjwtRedirectEmbeddedDiv - the div Identity embedded in the Contact by the
+// redirecting server, if it diverts from currentTN to destTN
+func sjwtRedirectEmbeddedDiv(identityVals []string, currentTN string, destTN string) string {
+	for _, identityVal := range identityVals {
+		parts, _, err := SJWTParseIdentityParts(identityVal)
+		if err != nil || parts.Header.Ppt != "div" {
+			continue
+		}
+		divPayload := SJWTDivPayload{}
+		if err = json.Unmarshal(parts.Payload, &divPayload); err != nil {
+			continue
+		}
+		if divPayload.Div.TN == currentTN && len(divPayload.Dest.TN) > 0 && divPayload.Dest.TN[0] == destTN {
+			return strings.TrimSpace(identityVal)
+		}
+	}
+	return ""
+}
+
+// SJWTGetRedirectIdentityPrvKey - build the Identity header values for the
+// INVITE recursed on a 3xx redirect to contactVal, given the Identity header
+// values of the original INVITE:
+//   - if the Contact targets the same number, the values are not changed
+//   - if the Contact has a div Identity (from the redirecting server) for
+//     the new target, it is added
+//   - otherwise, with RedirectPolicyDiv a new div Identity is added, with
+//     RedirectPolicyResign the shaken Identity (signed with the private key
+//     and not older than maxAge) is re-issued with the new dest and with
+//     RedirectPolicyKeep the values are not changed
+func SJWTGetRedirectIdentityPrvKey(identityVals []string, contactVal string, policy int, maxAge int,
+	x5uVal string, prvkeyData []byte) ([]string, int, error) {
+	destTN, contactIdentities, ret, err := SJWTParseRedirectTarget(contactVal)
+	if err != nil {
+		return nil, ret, err
+	}
+	_, divs, currentTN, ret, err := sjwtDivCurrentTarget(identityVals)
+	if err != nil {
+		return nil, ret, err
+	}
+	identityOut := make([]string, 0, len(identityVals)+1)
+	for _, identityVal := range identityVals {
+		identityOut = append(identityOut, strings.TrimSpace(identityVal))
+	}
+	if destTN == currentTN {
+		return identityOut, SJWTRetOK, nil
+	}
+	if divIdentity := sjwtRedirectEmbeddedDiv(contactIdentities, currentTN, destTN); len(divIdentity) > 0 {
+		return append(identityOut, divIdentity), SJWTRetOK, nil
+	}
+
+	switch policy {
+	case RedirectPolicyDiv:
+		return SJWTGetDivIdentityPrvKey(identityVals, destTN, x5uVal, prvkeyData)
+	case RedirectPolicyResign:
+		if len(divs) > 0 {
+			return nil, SJWTRetErrSIPHdrParse, errors.New("cannot re-sign the shaken identity of a diverted call")
+		}
+		for i, identityVal := range identityOut {
+			parts, ret, err := SJWTParseIdentityParts(identityVal)
+			if err != nil {
+				return nil, ret, err
+			}
+			if parts.Header.Ppt != "shaken" {
+				continue
+			}
+			claims := map[string]interface{}{"dest": SJWTDest{TN: []string{destTN}}}
+			identityOut[i], ret, err = sjwtResignIdentity(identityVal, maxAge, claims, prvkeyData, nil, "")
+			if err != nil {
+				return nil, ret, err
+			}
+		}
+		return identityOut, SJWTRetOK, nil
+	case RedirectPolicyKeep:
+		return identityOut, SJWTRetOK, nil
+	}
+	return nil, SJWTRetErr, fmt.Errorf("unknown redirect policy: %d", policy)
+}
+
+// SJWTGetRedirectIdentity - like SJWTGetRedirectIdentityPrvKey(), with the
+// path to private key
+func SJWTGetRedirectIdentity(identityVals []string, contactVal string, policy int, maxAge int,
+	x5uVal string, prvkeyPath string) ([]string, int, error) {
+	prvkey, err := SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return nil, SJWTRetErrFileRead, fmt.Errorf("Unable to read private key file: %v", err)
+	}
+	return SJWTGetRedirectIdentityPrvKey(identityVals, contactVal, policy, maxAge, x5uVal, prvkey)
+}
@@ -0,0 +1,115 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestParseRedirectTarget(t *testing.T) {
+	t.Run("OK with sip uri", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		tn, identities, ret, _ := secsipid.SJWTParseRedirectTarget("\"Office\" <sip:+49-30-3333.3333@gw.example.com;user=phone>;q=0.5")
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(tn).ToBe("493033333333")
+		expect(len(identities)).ToBe(0)
+	})
+
+	t.Run("OK with tel uri", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		tn, _, ret, _ := secsipid.SJWTParseRedirectTarget("tel:+493033333333;phone-context=example.com")
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(tn).ToBe("493033333333")
+	})
+
+	t.Run("ErrRedirectTarget without telephone number", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, _, ret, _ := secsipid.SJWTParseRedirectTarget("<sip:alice@example.com>")
+		expect(ret).ToBe(secsipid.SJWTRetErrRedirectTarget)
+
+		_, _, ret, _ = secsipid.SJWTParseRedirectTarget("<http://example.com/>")
+		expect(ret).ToBe(secsipid.SJWTRetErrRedirectTarget)
+	})
+}
+
+func TestGetRedirectIdentity(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+	otherPrvkey, _, _ := generateECKeyPEMs()
+
+	shaken, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+
+	getPayload := func(identityVal string) map[string]interface{} {
+		parts, _, _ := secsipid.SJWTParseIdentityParts(identityVal)
+		payload := map[string]interface{}{}
+		json.Unmarshal(parts.Payload, &payload)
+		return payload
+	}
+
+	t.Run("OK unchanged for the same number", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identities, ret, _ := secsipid.SJWTGetRedirectIdentityPrvKey([]string{shaken}, "<sip:+493022222222@other.example.com>",
+			secsipid.RedirectPolicyDiv, 60, "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(identities).ToEqual([]string{shaken})
+	})
+
+	t.Run("OK with div policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identities, ret, _ := secsipid.SJWTGetRedirectIdentityPrvKey([]string{shaken}, "<sip:+493033333333@gw.example.com>",
+			secsipid.RedirectPolicyDiv, 60, "https://certs.example.com/div.pem", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(identities)).ToBe(2)
+		payload := getPayload(identities[1])
+		expect(payload["div"]).ToEqual(map[string]interface{}{"tn": "493022222222"})
+		expect(payload["dest"]).ToEqual(map[string]interface{}{"tn": []interface{}{"493033333333"}})
+	})
+
+	t.Run("OK with div identity in contact", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		divIdentities, _, _ := secsipid.SJWTGetDivIdentityPrvKey([]string{shaken}, "493044444444", "", otherPrvkey)
+		contact := "<sip:+493044444444@gw.example.com?Identity=" + url.QueryEscape(divIdentities[1]) + ">"
+		identities, ret, _ := secsipid.SJWTGetRedirectIdentityPrvKey([]string{shaken}, contact,
+			secsipid.RedirectPolicyKeep, 60, "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(identities).ToEqual(divIdentities)
+	})
+
+	t.Run("OK with resign policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identities, ret, _ := secsipid.SJWTGetRedirectIdentityPrvKey([]string{shaken}, "tel:+493055555555",
+			secsipid.RedirectPolicyResign, 60, "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(identities)).ToBe(1)
+		payload := getPayload(identities[0])
+		expect(payload["dest"]).ToEqual(map[string]interface{}{"tn": []interface{}{"493055555555"}})
+		expect(payload["orig"]).ToEqual(map[string]interface{}{"tn": "493011111111"})
+		expect(payload["attest"]).ToBe("A")
+	})
+
+	t.Run("ErrJSONSignatureInvalid with resign policy for other key", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTGetRedirectIdentityPrvKey([]string{shaken}, "tel:+493055555555",
+			secsipid.RedirectPolicyResign, 60, "", otherPrvkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+
+	t.Run("OK unchanged with keep policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identities, ret, _ := secsipid.SJWTGetRedirectIdentityPrvKey([]string{shaken}, "tel:+493055555555",
+			secsipid.RedirectPolicyKeep, 60, "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(identities).ToEqual([]string{shaken})
+	})
+}
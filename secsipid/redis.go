@@ -0,0 +1,171 @@
+package secsipid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeout (in seconds) of the operations with the shared cache (Redis)
+const redisTimeout = 2
+
+// sjwtRedisClient - minimal client of the shared cache (Redis), with one
+// connection used by all the operations
+type sjwtRedisClient struct {
+	mu       sync.Mutex
+	addr     string
+	password string
+	db       int
+	conn     net.Conn
+	rd       *bufio.Reader
+}
+
+// sjwtRedisParse - the client for the address of the shared cache, either
+// 'host:port' or 'redis://[:password@]host:port[/db]'
+func sjwtRedisParse(val string) (*sjwtRedisClient, error) {
+	if !strings.Contains(val, "://") {
+		if _, _, err := net.SplitHostPort(val); err != nil {
+			return nil, err
+		}
+		return &sjwtRedisClient{addr: val}, nil
+	}
+	u, err := url.Parse(val)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" || len(u.Host) == 0 {
+		return nil, errors.New("invalid redis URL")
+	}
+	rc := &sjwtRedisClient{addr: u.Host}
+	if u.Port() == "" {
+		rc.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		rc.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); len(db) > 0 {
+		if rc.db, err = strconv.Atoi(db); err != nil {
+			return nil, errors.New("invalid redis database")
+		}
+	}
+	return rc, nil
+}
+
+// connect - open the connection, authenticating and selecting the database
+// if set (lock must be held)
+func (rc *sjwtRedisClient) connect() error {
+	conn, err := net.DialTimeout("tcp", rc.addr, redisTimeout*time.Second)
+	if err != nil {
+		return err
+	}
+	rc.conn = conn
+	rc.rd = bufio.NewReader(conn)
+	if len(rc.password) > 0 {
+		_, err = rc.command("AUTH", rc.password)
+	}
+	if err == nil && rc.db > 0 {
+		_, err = rc.command("SELECT", strconv.Itoa(rc.db))
+	}
+	if err != nil {
+		conn.Close()
+		rc.conn = nil
+	}
+	return err
+}
+
+// command - send the command and read the reply (lock must be held)
+func (rc *sjwtRedisClient) command(args ...string) (interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(redisTimeout * time.Second))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.conn, sb.String()); err != nil {
+		return nil, err
+	}
+	return rc.reply()
+}
+
+// reply - read the reply, the bulk strings are returned as []byte and the
+// missing values as nil
+func (rc *sjwtRedisClient) reply() (interface{}, error) {
+	line, err := rc.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis error: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(rc.rd, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, errors.New("unsupported redis reply")
+}
+
+// do - run the command, connecting first if needed; the connection is closed
+// on errors, to be opened again by the next command
+func (rc *sjwtRedisClient) do(args ...string) (interface{}, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.conn == nil {
+		if err := rc.connect(); err != nil {
+			return nil, err
+		}
+	}
+	res, err := rc.command(args...)
+	if err != nil && !strings.HasPrefix(err.Error(), "redis error:") {
+		rc.conn.Close()
+		rc.conn = nil
+	}
+	return res, err
+}
+
+// get - the value of the key, nil if it is not set
+func (rc *sjwtRedisClient) get(key string) ([]byte, error) {
+	res, err := rc.do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := res.([]byte)
+	return data, nil
+}
+
+// set - set the value of the key, expiring after ttl
+func (rc *sjwtRedisClient) set(key string, data []byte, ttl time.Duration) error {
+	_, err := rc.do("SET", key, string(data), "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	return err
+}
+
+// close - close the connection
+func (rc *sjwtRedisClient) close() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.conn != nil {
+		rc.conn.Close()
+		rc.conn = nil
+	}
+}
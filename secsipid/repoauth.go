@@ -0,0 +1,167 @@
+package secsipid
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+type sjwtRepoAuth struct {
+	bearer    string
+	transport *http.Transport
+}
+
+// credentials for the private certificate repositories, by x5u host
+var repoAuthList = struct {
+	sync.RWMutex
+	hosts map[string]*sjwtRepoAuth
+}{}
+
+// SJWTRepoAuthLoad - load the credentials for the private certificate
+// repositories from file, with one x5u host per line followed by attributes
+// given as name=value:
+//   - bearer - the token for the Authorization header
+//   - bearer-file - the path to the file with the token
+//   - cert, key - the paths to the client certificate and its private key
+//     (PEM format) for mTLS
+//   - ca - the path to the CA certificates (PEM format) to validate the
+//     certificate of the repository server, instead of the system ones
+//
+// Empty lines and lines starting with '#' are ignored.
+func SJWTRepoAuthLoad(filePath string) (int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return SJWTRetErrFileRead, err
+	}
+	hosts := make(map[string]*sjwtRepoAuth)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return SJWTRetErrFileRead, fmt.Errorf("invalid repository credentials line: %s", line)
+		}
+		attrs := make(map[string]string)
+		for _, field := range fields[1:] {
+			pos := strings.Index(field, "=")
+			if pos <= 0 {
+				return SJWTRetErrFileRead, fmt.Errorf("invalid repository credentials attribute: %s", field)
+			}
+			attrs[field[:pos]] = field[pos+1:]
+		}
+		auth, err := sjwtRepoAuthNew(attrs)
+		if err != nil {
+			return SJWTRetErrFileRead, fmt.Errorf("invalid credentials for %s: %v", fields[0], err)
+		}
+		hosts[strings.ToLower(fields[0])] = auth
+	}
+	if err = scanner.Err(); err != nil {
+		return SJWTRetErrFileRead, err
+	}
+	repoAuthList.Lock()
+	oldHosts := repoAuthList.hosts
+	repoAuthList.hosts = hosts
+	repoAuthList.Unlock()
+	for _, auth := range oldHosts {
+		if auth.transport != nil {
+			auth.transport.CloseIdleConnections()
+		}
+	}
+	return SJWTRetOK, nil
+}
+
+func sjwtRepoAuthNew(attrs map[string]string) (*sjwtRepoAuth, error) {
+	auth := &sjwtRepoAuth{}
+	for name, value := range attrs {
+		switch name {
+		case "bearer":
+			auth.bearer = value
+		case "bearer-file":
+			token, err := os.ReadFile(value)
+			if err != nil {
+				return nil, err
+			}
+			auth.bearer = strings.TrimSpace(string(token))
+		case "cert", "key", "ca":
+		default:
+			return nil, fmt.Errorf("unknown attribute: %s", name)
+		}
+	}
+	if len(attrs["cert"]) == 0 && len(attrs["key"]) == 0 && len(attrs["ca"]) == 0 {
+		return auth, nil
+	}
+	tlsConfig := &tls.Config{}
+	if len(attrs["cert"]) > 0 || len(attrs["key"]) > 0 {
+		clientCert, err := tls.LoadX509KeyPair(attrs["cert"], attrs["key"])
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	if len(attrs["ca"]) > 0 {
+		caData, err := os.ReadFile(attrs["ca"])
+		if err != nil {
+			return nil, err
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no CA certificate in %s", attrs["ca"])
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	auth.transport = sjwtFetchTransport().Clone()
+	auth.transport.TLSClientConfig = tlsConfig
+	return auth, nil
+}
+
+func sjwtRepoAuthGet(urlVal string) *sjwtRepoAuth {
+	u, err := url.Parse(urlVal)
+	if err != nil {
+		return nil
+	}
+	repoAuthList.RLock()
+	defer repoAuthList.RUnlock()
+	return repoAuthList.hosts[strings.ToLower(u.Hostname())]
+}
+
+// sjwtRepoAuthTransport - the HTTP transport for fetching from the URL, with
+// the client certificate of its host if set
+func sjwtRepoAuthTransport(urlVal string) *http.Transport {
+	if auth := sjwtRepoAuthGet(urlVal); auth != nil && auth.transport != nil {
+		return auth.transport
+	}
+	return sjwtFetchTransport()
+}
+
+// sjwtRepoAuthHeader - add the Authorization header with the bearer token of
+// the host, only over https
+func sjwtRepoAuthHeader(req *http.Request) {
+	if req.URL.Scheme != "https" {
+		return
+	}
+	if auth := sjwtRepoAuthGet(req.URL.String()); auth != nil && len(auth.bearer) > 0 {
+		req.Header.Set("Authorization", "Bearer "+auth.bearer)
+	}
+}
+
+// sjwtRepoAuthReset - close the idle connections of the transports with
+// client certificates
+func sjwtRepoAuthReset() {
+	repoAuthList.RLock()
+	defer repoAuthList.RUnlock()
+	for _, auth := range repoAuthList.hosts {
+		if auth.transport != nil {
+			auth.transport.CloseIdleConnections()
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package secsipid_test
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestRepoAuth(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.Header.Get("Authorization") != "Bearer abc123" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("cert"))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	certURL := server.URL + "/cert.pem"
+
+	clientKey, clientCert := generateSPCCertPEM("1234")
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	os.WriteFile("dummyRepoClientKey.pem", clientKey, 0640)
+	os.WriteFile("dummyRepoClientCert.pem", clientCert, 0640)
+	os.WriteFile("dummyRepoCA.pem", serverCA, 0640)
+	os.WriteFile("dummyRepoToken.txt", []byte("abc123\n"), 0640)
+	defer os.Remove("dummyRepoClientKey.pem")
+	defer os.Remove("dummyRepoClientCert.pem")
+	defer os.Remove("dummyRepoCA.pem")
+	defer os.Remove("dummyRepoToken.txt")
+	defer os.Remove("dummyRepoAuth.txt")
+
+	t.Run("ErrHTTPGet without credentials", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPGet)
+	})
+
+	t.Run("ErrFileRead with unknown attribute", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyRepoAuth.txt", []byte("127.0.0.1 password=abc\n"), 0640)
+		ret, _ := secsipid.SJWTRepoAuthLoad("dummyRepoAuth.txt")
+		expect(ret).ToBe(secsipid.SJWTRetErrFileRead)
+	})
+
+	t.Run("ErrHTTPStatusCode without bearer token", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyRepoAuth.txt", []byte("# private repository\n"+
+			"127.0.0.1 cert=dummyRepoClientCert.pem key=dummyRepoClientKey.pem ca=dummyRepoCA.pem\n"), 0640)
+		expect(secsipid.SJWTLibOptSetS("RepoAuthFile", "dummyRepoAuth.txt")).ToBe(secsipid.SJWTRetOK)
+		_, ret, _ := secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrHTTPStatusCode)
+	})
+
+	t.Run("OK with client certificate and bearer token", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyRepoAuth.txt", []byte("127.0.0.1 cert=dummyRepoClientCert.pem key=dummyRepoClientKey.pem "+
+			"ca=dummyRepoCA.pem bearer-file=dummyRepoToken.txt\n"), 0640)
+		expect(secsipid.SJWTLibOptSetS("RepoAuthFile", "dummyRepoAuth.txt")).ToBe(secsipid.SJWTRetOK)
+		content, ret, _ := secsipid.SJWTGetURLContent(certURL, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(string(content)).ToBe("cert")
+	})
+
+	os.WriteFile("dummyRepoAuth.txt", []byte{}, 0640)
+	secsipid.SJWTLibOptSetS("RepoAuthFile", "dummyRepoAuth.txt")
+}
@@ -0,0 +1,129 @@
+package secsipid
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sjwtResultCache - the successful results of the full identity checks, kept
+// for a short time to skip verifying again the same identity (e.g., forked
+// calls or retransmissions)
+type sjwtResultCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]sjwtResultCacheEntry
+	crlMod  time.Time
+}
+
+// sjwtResultCacheEntry - the cached result, with the details of the
+// verification
+type sjwtResultCacheEntry struct {
+	expires time.Time
+	info    *SJWTCheckInfo
+}
+
+var resultCache = sjwtResultCache{entries: map[[sha256.Size]byte]sjwtResultCacheEntry{}}
+
+func sjwtResultCacheKey(identityVal string, expireVal int, pubkeyPath string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strconv.Itoa(expireVal) + "|" + pubkeyPath + "|" + SJWTRemoveWhiteSpaces(identityVal)))
+}
+
+// sjwtResultCacheCRLMod - the modification time of the CRL file, if the CRL
+// check is enabled
+func sjwtResultCacheCRLMod() time.Time {
+	if (globalLibOptions.certVerify&CertVerifyOptCRL) == 0 || len(globalLibOptions.certCRLFile) == 0 {
+		return time.Time{}
+	}
+	fi, err := os.Stat(globalLibOptions.certCRLFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// SJWTResultCacheFlush - remove all the cached check results
+func SJWTResultCacheFlush() {
+	resultCache.mu.Lock()
+	resultCache.entries = map[[sha256.Size]byte]sjwtResultCacheEntry{}
+	resultCache.mu.Unlock()
+}
+
+// sjwtResultCacheGet - the details of the verification and true if the
+// identity was successfully checked before and the cached result is not expired
+func sjwtResultCacheGet(identityVal string, expireVal int, pubkeyPath string) (*SJWTCheckInfo, bool) {
+	if globalLibOptions.resCacheTTL <= 0 {
+		return nil, false
+	}
+	crlMod := sjwtResultCacheCRLMod()
+	key := sjwtResultCacheKey(identityVal, expireVal, pubkeyPath)
+
+	resultCache.mu.Lock()
+	defer resultCache.mu.Unlock()
+	if !crlMod.Equal(resultCache.crlMod) {
+		// the revocation list was updated, the identities must be checked again
+		resultCache.entries = map[[sha256.Size]byte]sjwtResultCacheEntry{}
+		resultCache.crlMod = crlMod
+		return nil, false
+	}
+	entry, ok := resultCache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if sjwtNow().After(entry.expires) {
+		delete(resultCache.entries, key)
+		return nil, false
+	}
+	return entry.info, true
+}
+
+// sjwtResultCacheSet - cache the successful result of checking the identity,
+// until the end of its freshness window, but no longer than the result cache
+// TTL and the certificate cache expire (the revocation refresh interval)
+func sjwtResultCacheSet(identityVal string, expireVal int, pubkeyPath string, info *SJWTCheckInfo) {
+	if globalLibOptions.resCacheTTL <= 0 {
+		return
+	}
+	ttl := int64(globalLibOptions.resCacheTTL)
+	if len(pubkeyPath) == 0 && globalLibOptions.cacheExpire > 0 && int64(globalLibOptions.cacheExpire) < ttl {
+		ttl = int64(globalLibOptions.cacheExpire)
+	}
+	btoken := strings.Split(strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")[0], ".")
+	if len(btoken) != 3 {
+		return
+	}
+	decodedPayload, err := SJWTBase64DecodeString(btoken[1])
+	if err != nil {
+		return
+	}
+	payload := SJWTPayload{}
+	if err = json.Unmarshal([]byte(decodedPayload), &payload); err != nil {
+		return
+	}
+	now := sjwtNow().Unix()
+	if fresh := payload.IAT + int64(sjwtPptExpire(btoken[0], expireVal)) - now; fresh < ttl {
+		ttl = fresh
+	}
+	if ttl <= 0 {
+		return
+	}
+	key := sjwtResultCacheKey(identityVal, expireVal, pubkeyPath)
+
+	resultCache.mu.Lock()
+	defer resultCache.mu.Unlock()
+	if globalLibOptions.resCacheMax > 0 && len(resultCache.entries) >= globalLibOptions.resCacheMax {
+		tnow := sjwtNow()
+		for k, entry := range resultCache.entries {
+			if tnow.After(entry.expires) {
+				delete(resultCache.entries, k)
+			}
+		}
+		if len(resultCache.entries) >= globalLibOptions.resCacheMax {
+			return
+		}
+	}
+	resultCache.entries[key] = sjwtResultCacheEntry{expires: time.Unix(now+ttl, 0), info: info}
+}
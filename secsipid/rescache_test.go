@@ -0,0 +1,66 @@
+package secsipid_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestResultCache(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+	secsipid.SJWTLibOptSetN("ResultCacheTTL", 30)
+	defer secsipid.SJWTLibOptSetN("ResultCacheTTL", 0)
+
+	identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+
+	t.Run("OK with cached result", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyResCachePubKey.pem", pubkey, 0640)
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "dummyResCachePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		// the identity is not verified again, the public key is not needed
+		os.Remove("dummyResCachePubKey.pem")
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "dummyResCachePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("Checked again after flush", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTResultCacheFlush()
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "dummyResCachePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrFileRead)
+	})
+
+	t.Run("Not cached after freshness window", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		os.WriteFile("dummyResCachePubKey.pem", pubkey, 0640)
+		defer os.Remove("dummyResCachePubKey.pem")
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 0, "dummyResCachePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		os.Remove("dummyResCachePubKey.pem")
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 0, "dummyResCachePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrFileRead)
+	})
+	t.Run("Not cached after freshness window of verification clock", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTResultCacheFlush()
+		os.WriteFile("dummyResCachePubKey.pem", pubkey, 0640)
+		ret, _ := secsipid.SJWTCheckFullIdentity(identity, 60, "dummyResCachePubKey.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{ClockSkew: 120})
+		defer secsipid.SJWTSetChaos(secsipid.SJWTChaosOptions{})
+		ret, _ = secsipid.SJWTCheckFullIdentity(identity, 60, "dummyResCachePubKey.pem", 5)
+		os.Remove("dummyResCachePubKey.pem")
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadIATExpired)
+	})
+}
@@ -0,0 +1,119 @@
+package secsipid
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SJWTResignIdentityPrvKey - re-issue the Identity header value previously
+// signed with the private key, with a fresh iat and the new origid (if not
+// empty), preserving the other claims and the header parameters; the token
+// is verified with the public key of the private key and it must not be
+// older than maxAge seconds
+func SJWTResignIdentityPrvKey(identityVal string, maxAge int, origID string, prvkeyData []byte) (string, int, error) {
+	return SJWTResignIdentityPrvKeys(identityVal, maxAge, origID, prvkeyData, nil, "")
+}
+
+// SJWTResignIdentityPrvKeys - like SJWTResignIdentityPrvKey(), but the token
+// can be also signed with the previous key (during key rotation), in which
+// case the x5u is replaced with x5uVal (resolved like for signing)
+func SJWTResignIdentityPrvKeys(identityVal string, maxAge int, origID string, prvkeyData []byte,
+	prevkeyData []byte, x5uVal string) (string, int, error) {
+	claims := map[string]interface{}{}
+	if len(origID) > 0 {
+		claims["origid"] = origID
+	}
+	return sjwtResignIdentity(identityVal, maxAge, claims, prvkeyData, prevkeyData, x5uVal)
+}
+
+// sjwtResignIdentity - re-issue the Identity header value with a fresh iat
+// and the claims replaced with the given values
+func sjwtResignIdentity(identityVal string, maxAge int, claims map[string]interface{}, prvkeyData []byte,
+	prevkeyData []byte, x5uVal string) (string, int, error) {
+	parts, ret, err := SJWTParseIdentityParts(identityVal)
+	if err != nil {
+		return "", ret, err
+	}
+	prvKey, ret, err := SJWTParsePrivateKeyFromPEM(prvkeyData)
+	if err != nil {
+		return "", ret, err
+	}
+	btoken := strings.Split(parts.Token, ".")
+	if _, ret, err = SJWTGetValidPayload(btoken[1], maxAge); err != nil {
+		return "", ret, err
+	}
+	rotated := false
+	if ret, err = SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], btoken[2], prvKey.(crypto.Signer).Public()); err != nil {
+		if len(prevkeyData) == 0 {
+			return "", ret, err
+		}
+		prevKey, pret, perr := SJWTParsePrivateKeyFromPEM(prevkeyData)
+		if perr != nil {
+			return "", pret, perr
+		}
+		if ret, err = SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], btoken[2], prevKey.(crypto.Signer).Public()); err != nil {
+			return "", ret, err
+		}
+		rotated = true
+	}
+
+	// decode to generic values to keep the claims unknown to the library
+	header := map[string]interface{}{}
+	decodedHeader, _ := SJWTBase64DecodeString(btoken[0])
+	if err = json.Unmarshal([]byte(decodedHeader), &header); err != nil {
+		return "", SJWTRetErrJSONHdrParse, err
+	}
+	payload := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(parts.Payload))
+	decoder.UseNumber()
+	if err = decoder.Decode(&payload); err != nil {
+		return "", SJWTRetErrJSONPayloadParse, err
+	}
+	payload["iat"] = time.Now().Unix()
+	for name, value := range claims {
+		payload[name] = value
+	}
+	newX5u := ""
+	if rotated {
+		// signed with the previous key, the x5u must reference the certificate of the new key
+		attest, _ := payload["attest"].(string)
+		newX5u = SJWTSignX5u(x5uVal, prvkeyData, parts.Header.Ppt, attest)
+		header["x5u"] = newX5u
+		header["alg"] = sjwtSignerAlgForKey(prvKey).Name()
+		if x5t := sjwtSignX5t(); len(x5t) > 0 {
+			header["x5t#S256"] = x5t
+		} else {
+			delete(header, "x5t#S256")
+		}
+	}
+
+	token, ret, err := sjwtEncodeJSON(header, payload, prvkeyData)
+	if err != nil {
+		return "", ret, err
+	}
+	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
+	hdrtoken[0] = token
+	if len(newX5u) > 0 {
+		for i := 1; i < len(hdrtoken); i++ {
+			if strings.HasPrefix(hdrtoken[i], "info=") {
+				hdrtoken[i] = "info=<" + newX5u + ">"
+			} else if strings.HasPrefix(hdrtoken[i], "alg=") {
+				hdrtoken[i] = "alg=" + header["alg"].(string)
+			}
+		}
+	}
+	return strings.Join(hdrtoken, ";"), SJWTRetOK, nil
+}
+
+// SJWTResignIdentity - re-issue the Identity header value, with the private
+// key read from prvkeyPath
+func SJWTResignIdentity(identityVal string, maxAge int, origID string, prvkeyPath string) (string, int, error) {
+	prvkey, err := SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return "", SJWTRetErrFileRead, err
+	}
+	return SJWTResignIdentityPrvKey(identityVal, maxAge, origID, prvkey)
+}
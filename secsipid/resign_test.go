@@ -0,0 +1,77 @@
+package secsipid_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestResignIdentity(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+
+	token, _, _ := secsipid.SJWTEncodeTextWithPrvKey(`{"alg":"ES256","ppt":"shaken","typ":"passport","x5u":"https://certs.example.com/cert.pem"}`,
+		`{"attest":"A","dest":{"tn":["493022222222"]},"iat":1000,"orig":{"tn":"493011111111"},"origid":"old-id","custom":"kept"}`, string(prvkey))
+	identity := token + ";info=<https://certs.example.com/cert.pem>;alg=ES256;ppt=shaken"
+
+	t.Run("ErrJSONPayloadIATExpired with old token", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := secsipid.SJWTResignIdentityPrvKey(identity, 60, "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONPayloadIATExpired)
+	})
+
+	t.Run("OK with fresh iat and new origid", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "old-id", "https://certs.example.com/cert.pem", prvkey)
+		resigned, ret, err := secsipid.SJWTResignIdentityPrvKey(identity, 3600, "new-id", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+
+		parts, _, _ := secsipid.SJWTParseIdentityParts(resigned)
+		expect(parts.Info).ToBe("https://certs.example.com/cert.pem")
+		payload := secsipid.SJWTPayload{}
+		json.Unmarshal(parts.Payload, &payload)
+		expect(payload.OrigID).ToBe("new-id")
+		expect(payload.Orig.TN).ToBe("493011111111")
+	})
+
+	t.Run("OK with unknown claims preserved", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		resigned, ret, _ := secsipid.SJWTResignIdentityPrvKey(identity, 1<<40, "", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		parts, _, _ := secsipid.SJWTParseIdentityParts(resigned)
+		payload := map[string]interface{}{}
+		json.Unmarshal(parts.Payload, &payload)
+		expect(payload["custom"]).ToBe("kept")
+		expect(payload["origid"]).ToBe("old-id")
+		expect(payload["iat"] != float64(1000)).ToBe(true)
+	})
+
+	t.Run("ErrJSONSignatureInvalid with token of other key", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		otherkey, _, _ := generateECKeyPEMs()
+		_, ret, _ := secsipid.SJWTResignIdentityPrvKey(identity, 1<<40, "", otherkey)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+
+	t.Run("OK with token of previous key after rotation", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		nextkey, _, _ := generateECKeyPEMs()
+		nextID, _, _ := secsipid.SJWTKeyID(nextkey)
+		resigned, ret, _ := secsipid.SJWTResignIdentityPrvKeys(identity, 1<<40, "", nextkey, prvkey, "https://certs.example.com/{keyid}.pem")
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+
+		parts, _, _ := secsipid.SJWTParseIdentityParts(resigned)
+		expect(parts.Header.X5u).ToBe("https://certs.example.com/" + nextID + ".pem")
+		expect(parts.Info).ToBe(parts.Header.X5u)
+		_, ret, _ = secsipid.SJWTResignIdentityPrvKey(resigned, 60, "", nextkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+}
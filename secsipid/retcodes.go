@@ -0,0 +1,134 @@
+package secsipid
+
+// SJWTRetCode - a return code with its stable name, the class of the check
+// it belongs to and the description, the same for the library errors, the
+// CLI, the HTTP JSON errors and the metrics labels
+type SJWTRetCode struct {
+	Code        int    `json:"code"`
+	Name        string `json:"name"`
+	Class       string `json:"class,omitempty"`
+	Description string `json:"description"`
+}
+
+// sjwtRetCodes - the registry of the return codes, the names must not be
+// changed once released
+var sjwtRetCodes = []SJWTRetCode{
+	{Code: SJWTRetOK, Name: "ok", Description: "success"},
+	{Code: SJWTRetErr, Name: "error", Description: "generic error"},
+	{Code: SJWTRetErrCertInvalid, Name: "cert_invalid", Description: "certificate not valid"},
+	{Code: SJWTRetErrCertInvalidFormat, Name: "cert_invalid_format", Description: "certificate with invalid format"},
+	{Code: SJWTRetErrCertExpired, Name: "cert_expired", Description: "certificate expired"},
+	{Code: SJWTRetErrCertBeforeValidity, Name: "cert_before_validity", Description: "certificate not yet valid"},
+	{Code: SJWTRetErrCertProcessing, Name: "cert_processing", Description: "certificate processing failure"},
+	{Code: SJWTRetErrCertNoCAFile, Name: "cert_no_ca_file", Description: "CA file not set"},
+	{Code: SJWTRetErrCertReadCAFile, Name: "cert_read_ca_file", Description: "CA file cannot be read"},
+	{Code: SJWTRetErrCertNoCAInter, Name: "cert_no_ca_inter", Description: "intermediate CA file not set"},
+	{Code: SJWTRetErrCertReadCAInter, Name: "cert_read_ca_inter", Description: "intermediate CA file cannot be read"},
+	{Code: SJWTRetErrCertNoCRLFile, Name: "cert_no_crl_file", Description: "CRL file not set"},
+	{Code: SJWTRetErrCertReadCRLFile, Name: "cert_read_crl_file", Description: "CRL file cannot be read"},
+	{Code: SJWTRetErrCertRevoked, Name: "cert_revoked", Description: "certificate revoked"},
+	{Code: SJWTRetErrCertInvalidEC, Name: "cert_invalid_ec", Description: "certificate public key not EC or not usable"},
+	{Code: SJWTRetErrCertConstraints, Name: "cert_constraints", Description: "identity not allowed by the certificate constraints"},
+	{Code: SJWTRetErrCertPinMismatch, Name: "cert_pin_mismatch", Description: "certificate not matching the pinned key"},
+	{Code: SJWTRetErrCertOCSPUnavailable, Name: "cert_ocsp_unavailable", Description: "OCSP responder not available"},
+	{Code: SJWTRetErrCertOCSPInvalid, Name: "cert_ocsp_invalid", Description: "invalid OCSP response"},
+	{Code: SJWTRetErrCertKeyUsage, Name: "cert_key_usage", Description: "certificate without digital signature key usage"},
+	{Code: SJWTRetErrCertExtKeyUsage, Name: "cert_ext_key_usage", Description: "certificate extended key usage not allowed"},
+	{Code: SJWTRetErrCertPolicyOID, Name: "cert_policy_oid", Description: "certificate policy not allowed"},
+	{Code: SJWTRetErrPrvKeyInvalid, Name: "prvkey_invalid", Description: "private key not valid"},
+	{Code: SJWTRetErrPrvKeyInvalidFormat, Name: "prvkey_invalid_format", Description: "private key with invalid format or not EC"},
+	{Code: SJWTRetErrJSONHdrParse, Name: "json_hdr_parse", Description: "JSON header parse failure"},
+	{Code: SJWTRetErrJSONHdrAlg, Name: "json_hdr_alg", Description: "JSON header alg not allowed"},
+	{Code: SJWTRetErrJSONHdrPpt, Name: "json_hdr_ppt", Description: "JSON header ppt not allowed"},
+	{Code: SJWTRetErrJSONHdrTyp, Name: "json_hdr_typ", Description: "JSON header typ not allowed"},
+	{Code: SJWTRetErrJSONHdrX5u, Name: "json_hdr_x5u", Description: "JSON header x5u not matching the info URL"},
+	{Code: SJWTRetErrJSONHdrX5t, Name: "json_hdr_x5t", Description: "JSON header x5t#S256 not matching the certificate"},
+	{Code: SJWTRetErrJSONPayloadParse, Name: "json_payload_parse", Description: "JSON payload parse failure"},
+	{Code: SJWTRetErrJSONPayloadIATExpired, Name: "json_payload_iat_expired", Description: "iat expired"},
+	{Code: SJWTRetErrJSONPayloadRcdi, Name: "json_payload_rcdi", Description: "rcdi not matching the rcd"},
+	{Code: SJWTRetErrJSONPayloadMky, Name: "json_payload_mky", Description: "mky not matching the media keys"},
+	{Code: SJWTRetErrJSONPayloadDestTN, Name: "json_payload_dest_tn", Description: "dest tn not valid or too many"},
+	{Code: SJWTRetErrJSONPayloadIATFuture, Name: "json_payload_iat_future", Description: "iat in the future"},
+	{Code: SJWTRetErrJSONSignatureInvalid, Name: "json_signature_invalid", Description: "signature not valid"},
+	{Code: SJWTRetErrJSONSignatureHashing, Name: "json_signature_hashing", Description: "signature hashing failure"},
+	{Code: SJWTRetErrJSONSignatureSize, Name: "json_signature_size", Description: "signature with invalid size"},
+	{Code: SJWTRetErrJSONSignatureFailure, Name: "json_signature_failure", Description: "signing failure"},
+	{Code: SJWTRetErrJSONSignatureNob64, Name: "json_signature_nob64", Description: "signature not base64 encoded"},
+	{Code: SJWTRetErrSIPHdrParse, Name: "sip_hdr_parse", Description: "identity header parse failure"},
+	{Code: SJWTRetErrSIPHdrAlg, Name: "sip_hdr_alg", Description: "identity header alg not allowed"},
+	{Code: SJWTRetErrSIPHdrPpt, Name: "sip_hdr_ppt", Description: "identity header ppt not allowed"},
+	{Code: SJWTRetErrSIPHdrEmpty, Name: "sip_hdr_empty", Description: "identity header empty"},
+	{Code: SJWTRetErrSIPHdrInfo, Name: "sip_hdr_info", Description: "identity header info missing or not valid"},
+	{Code: SJWTRetErrSIPHdrNoShaken, Name: "sip_hdr_no_shaken", Description: "no shaken identity header"},
+	{Code: SJWTRetErrSIPHdrTooLong, Name: "sip_hdr_too_long", Description: "identity header too long"},
+	{Code: SJWTRetErrDivChainOrig, Name: "div_chain_orig", Description: "div orig not matching the shaken identity"},
+	{Code: SJWTRetErrDivChainDest, Name: "div_chain_dest", Description: "div dest not matching the previous identity"},
+	{Code: SJWTRetErrRedirectTarget, Name: "redirect_target", Description: "redirect target not valid"},
+	{Code: SJWTRetErrConnectedDest, Name: "connected_dest", Description: "connected identity dest not matching the caller"},
+	{Code: SJWTRetErrConnectedOrig, Name: "connected_orig", Description: "connected identity orig not matching the call"},
+	{Code: SJWTRetErrHTTPInvalidURL, Name: "http_invalid_url", Description: "invalid URL"},
+	{Code: SJWTRetErrHTTPGet, Name: "http_get", Description: "HTTP get failure"},
+	{Code: SJWTRetErrHTTPStatusCode, Name: "http_status_code", Description: "HTTP response status code not 200"},
+	{Code: SJWTRetErrHTTPReadBody, Name: "http_read_body", Description: "HTTP response body read failure"},
+	{Code: SJWTRetErrHTTPTimeout, Name: "timeout", Description: "deadline of the verification exceeded"},
+	{Code: SJWTRetErrHTTPRedirect, Name: "http_redirect", Description: "HTTP redirect not allowed"},
+	{Code: SJWTRetErrFileRead, Name: "file_read", Description: "file read failure"},
+	{Code: SJWTRetErrPolicyDNO, Name: "policy_dno", Description: "orig tn in the do-not-originate list"},
+	{Code: SJWTRetErrPolicyPptMissing, Name: "policy_ppt_missing", Description: "identity with required ppt missing"},
+	{Code: SJWTRetErrPolicyPptForbidden, Name: "policy_ppt_forbidden", Description: "identity with forbidden ppt present"},
+}
+
+// SJWTRetClass - the class of the check for the return code (certificate,
+// header, freshness, payload, signature, identity, fetch, policy), empty
+// for success and generic errors
+func SJWTRetClass(ret int) string {
+	switch {
+	case ret <= -100 && ret > -200:
+		return "certificate"
+	case ret <= -200 && ret > -230:
+		return "header"
+	case ret == SJWTRetErrJSONPayloadIATExpired || ret == SJWTRetErrJSONPayloadIATFuture:
+		return "freshness"
+	case ret <= -230 && ret > -250:
+		return "payload"
+	case ret <= -250 && ret > -300:
+		return "signature"
+	case ret <= -300 && ret > -400:
+		return "identity"
+	case ret <= -400 && ret > -500:
+		return "fetch"
+	case ret <= -500 && ret > -600:
+		return "policy"
+	}
+	return ""
+}
+
+// SJWTRetCodes - the registry of the return codes, sorted by descending code
+func SJWTRetCodes() []SJWTRetCode {
+	codes := make([]SJWTRetCode, len(sjwtRetCodes))
+	for i, rc := range sjwtRetCodes {
+		rc.Class = SJWTRetClass(rc.Code)
+		codes[i] = rc
+	}
+	return codes
+}
+
+// SJWTRetName - the name of the return code, 'unknown' if not in the registry
+func SJWTRetName(ret int) string {
+	for _, rc := range sjwtRetCodes {
+		if rc.Code == ret {
+			return rc.Name
+		}
+	}
+	return "unknown"
+}
+
+// SJWTRetByName - the return code for the name, false if not in the registry
+func SJWTRetByName(name string) (int, bool) {
+	for _, rc := range sjwtRetCodes {
+		if rc.Name == name {
+			return rc.Code, true
+		}
+	}
+	return SJWTRetErr, false
+}
@@ -0,0 +1,44 @@
+package secsipid_test
+
+import (
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestRetCodes(t *testing.T) {
+	t.Run("OK names and codes are unique", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		names := map[string]bool{}
+		codes := map[int]bool{}
+		for _, rc := range secsipid.SJWTRetCodes() {
+			expect(names[rc.Name]).ToBe(false)
+			expect(codes[rc.Code]).ToBe(false)
+			names[rc.Name] = true
+			codes[rc.Code] = true
+		}
+	})
+
+	t.Run("OK name and code lookups", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTRetName(secsipid.SJWTRetErrJSONSignatureInvalid)).ToBe("json_signature_invalid")
+		expect(secsipid.SJWTRetName(-999)).ToBe("unknown")
+		ret, ok := secsipid.SJWTRetByName("cert_expired")
+		expect(ok).ToBe(true)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertExpired)
+		_, ok = secsipid.SJWTRetByName("no_such_code")
+		expect(ok).ToBe(false)
+	})
+
+	t.Run("OK classes of the checks", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTRetClass(secsipid.SJWTRetErrJSONPayloadIATExpired)).ToBe("freshness")
+		expect(secsipid.SJWTRetClass(secsipid.SJWTRetErrCertRevoked)).ToBe("certificate")
+		expect(secsipid.SJWTRetClass(secsipid.SJWTRetErrHTTPGet)).ToBe("fetch")
+		expect(secsipid.SJWTRetClass(secsipid.SJWTRetOK)).ToBe("")
+	})
+}
@@ -0,0 +1,123 @@
+package secsipid
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+// policies for the revocation checks (CRL and OCSP)
+const (
+	RevPolicyHardFail = 0
+	RevPolicySoftFail = 1
+	RevPolicySkip     = 2
+	// internal policy for the short-lived certificates, not checked
+	revPolicyShortLived = 3
+)
+
+// decisions of the revocation checks
+const (
+	RevStatusGood       = "good"
+	RevStatusRevoked    = "revoked"
+	RevStatusFailed     = "failed"
+	RevStatusSoftFail   = "soft-fail"
+	RevStatusSkipped    = "skipped"
+	RevStatusShortLived = "short-lived"
+)
+
+// SJWTRevocation - the decisions of the revocation checks of the certificate,
+// with the warnings for the checks accepted by the soft-fail policy
+type SJWTRevocation struct {
+	CRL      string   `json:"crl,omitempty"`
+	OCSP     string   `json:"ocsp,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// set - set the decision of the CRL or OCSP check, if the result is wanted
+func (rev *SJWTRevocation) set(kind string, status string) {
+	if rev == nil {
+		return
+	}
+	if kind == "crl" {
+		rev.CRL = status
+	} else {
+		rev.OCSP = status
+	}
+}
+
+// sjwtRevocationCheck - run the CRL or OCSP check with its policy: with skip
+// the check is not done, with soft-fail the certificate is accepted when its
+// status cannot be obtained (a warning is added), with hard-fail it is rejected
+func sjwtRevocationCheck(kind string, policy int, rev *SJWTRevocation, check func() (int, error)) (int, error) {
+	if policy == RevPolicySkip {
+		rev.set(kind, RevStatusSkipped)
+		return SJWTRetOK, nil
+	}
+	if policy == revPolicyShortLived {
+		rev.set(kind, RevStatusShortLived)
+		return SJWTRetOK, nil
+	}
+	ret, err := check()
+	switch {
+	case err == nil:
+		rev.set(kind, RevStatusGood)
+	case ret == SJWTRetErrCertRevoked:
+		rev.set(kind, RevStatusRevoked)
+	case policy == RevPolicySoftFail && SJWTRetIsUnavailable(ret):
+		rev.set(kind, RevStatusSoftFail)
+		if rev != nil {
+			rev.Warnings = append(rev.Warnings, kind+": "+err.Error())
+		}
+		return SJWTRetOK, nil
+	default:
+		rev.set(kind, RevStatusFailed)
+	}
+	return ret, err
+}
+
+// sjwtRevocationPolicy - the policy of the revocation check for the
+// certificate, the short-lived certificates (validity period not longer than
+// CertShortLived seconds) are not checked
+func sjwtRevocationPolicy(policy int, certVal *x509.Certificate) int {
+	if globalLibOptions.shortLived > 0 && policy != RevPolicySkip &&
+		certVal.NotAfter.Sub(certVal.NotBefore) <= time.Duration(globalLibOptions.shortLived)*time.Second {
+		return revPolicyShortLived
+	}
+	return policy
+}
+
+// SJWTCertShortLived - true if the validity period of the certificate is not
+// longer than the threshold for the short-lived certificates (CertShortLived)
+func SJWTCertShortLived(certVal *x509.Certificate) bool {
+	return sjwtRevocationPolicy(RevPolicyHardFail, certVal) == revPolicyShortLived
+}
+
+// sjwtCRLCheck - check the certificate against the CRL file
+func sjwtCRLCheck(certVal *x509.Certificate) (int, error) {
+	if len(globalLibOptions.certCRLFile) <= 0 {
+		return SJWTRetErrCertNoCRLFile, errors.New("no CRL file")
+	}
+	return sjwtCRLRevoked(certVal)
+}
+
+// SJWTPubKeyVerifyRevocation - verify the certificate like SJWTPubKeyVerify(),
+// returning the decisions of the revocation checks (empty for the checks that
+// are not enabled)
+func SJWTPubKeyVerifyRevocation(pubKey []byte) (*SJWTRevocation, int, error) {
+	_, rev, ret, err := sjwtPubKeyVerifyRevocation(context.Background(), pubKey)
+	return rev, ret, err
+}
+
+// sjwtPubKeyVerifyRevocation - verify the certificate, returning the chain
+// used for it and the decisions of the revocation checks
+func sjwtPubKeyVerifyRevocation(ctx context.Context, pubKey []byte) ([]*x509.Certificate, *SJWTRevocation, int, error) {
+	rev := &SJWTRevocation{}
+	if globalLibOptions.certVerify == 0 {
+		return nil, rev, SJWTRetOK, nil
+	}
+	end := sjwtSpan("secsipid.cert_verify")
+	chain, ret, err := sjwtPubKeyVerify(ctx, sjwtCertChainOrder(pubKey), rev)
+	end(err)
+	return chain, rev, ret, err
+}
@@ -0,0 +1,158 @@
+package secsipid_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestRevocationPolicy(t *testing.T) {
+	root, rootKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Revocation Root"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0), IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature}, nil, nil)
+	leaf, leafKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(10), Subject: pkix.Name{CommonName: "Revocation Leaf"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0),
+		KeyUsage: x509.KeyUsageDigitalSignature, OCSPServer: []string{"http://127.0.0.1:1/ocsp"}}, root, rootKey)
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+
+	os.WriteFile("dummyRevocationRoot.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0640)
+	defer os.Remove("dummyRevocationRoot.pem")
+	secsipid.SJWTLibOptSetS("CertCAFile", "dummyRevocationRoot.pem")
+	defer secsipid.SJWTLibOptSetS("CertCAFile", "")
+	secsipid.SJWTLibOptSetS("CertCRLFile", "dummyRevocationMissing.crl")
+	defer secsipid.SJWTLibOptSetS("CertCRLFile", "")
+	secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA|secsipid.CertVerifyOptCRL)
+	defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+	defer secsipid.SJWTLibOptSetN("CRLPolicy", secsipid.RevPolicyHardFail)
+	defer secsipid.SJWTLibOptSetN("OCSPPolicy", secsipid.RevPolicyHardFail)
+
+	t.Run("ErrCertReadCRLFile with hard-fail policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		rev, ret, _ := secsipid.SJWTPubKeyVerifyRevocation(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertReadCRLFile)
+		expect(rev.CRL).ToBe(secsipid.RevStatusFailed)
+	})
+
+	t.Run("OK with soft-fail policy and warning", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CRLPolicy", secsipid.RevPolicySoftFail)
+		rev, ret, _ := secsipid.SJWTPubKeyVerifyRevocation(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(rev.CRL).ToBe(secsipid.RevStatusSoftFail)
+		expect(len(rev.Warnings)).ToBe(1)
+	})
+
+	t.Run("OK with soft-fail decision of the identity check", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		prvBytes, _ := x509.MarshalECPrivateKey(leafKey)
+		identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "",
+			"https://certs.example.com/cert.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes}))
+		os.WriteFile("dummyRevocationLeaf.pem", leafPEM, 0640)
+		defer os.Remove("dummyRevocationLeaf.pem")
+		info, ret, _ := secsipid.SJWTCheckFullIdentityInfo(context.Background(), identity, 60, "dummyRevocationLeaf.pem", 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(info.Revocation.CRL).ToBe(secsipid.RevStatusSoftFail)
+		expect(len(info.Revocation.Warnings)).ToBe(1)
+	})
+
+	t.Run("OK with skip policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CRLPolicy", secsipid.RevPolicySkip)
+		rev, ret, _ := secsipid.SJWTPubKeyVerifyRevocation(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(rev.CRL).ToBe(secsipid.RevStatusSkipped)
+		expect(len(rev.Warnings)).ToBe(0)
+	})
+
+	t.Run("OK with OCSP soft-fail policy independent of CRL", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA|secsipid.CertVerifyOptCRL|secsipid.CertVerifyOptOCSP)
+		secsipid.SJWTLibOptSetN("CRLPolicy", secsipid.RevPolicyHardFail)
+		secsipid.SJWTLibOptSetN("OCSPPolicy", secsipid.RevPolicySoftFail)
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertReadCRLFile)
+
+		secsipid.SJWTLibOptSetN("CRLPolicy", secsipid.RevPolicySkip)
+		rev, ret, _ := secsipid.SJWTPubKeyVerifyRevocation(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(rev.CRL).ToBe(secsipid.RevStatusSkipped)
+		expect(rev.OCSP).ToBe(secsipid.RevStatusSoftFail)
+	})
+
+	t.Run("ErrCertRevoked with soft-fail policy", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		der, _ := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{Number: big.NewInt(1),
+			RevokedCertificates: []pkix.RevokedCertificate{{SerialNumber: big.NewInt(10), RevocationTime: time.Now()}},
+			ThisUpdate:          time.Now(), NextUpdate: time.Now().AddDate(0, 0, 7)}, root, rootKey)
+		os.WriteFile("dummyRevocation.crl", der, 0640)
+		defer os.Remove("dummyRevocation.crl")
+		secsipid.SJWTLibOptSetS("CertCRLFile", "dummyRevocation.crl")
+		secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA|secsipid.CertVerifyOptCRL)
+		secsipid.SJWTLibOptSetN("CRLPolicy", secsipid.RevPolicySoftFail)
+		rev, ret, _ := secsipid.SJWTPubKeyVerifyRevocation(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertRevoked)
+		expect(rev.CRL).ToBe(secsipid.RevStatusRevoked)
+	})
+}
+
+func TestRevocationShortLived(t *testing.T) {
+	root, rootKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Short-Lived Root"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0), IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature}, nil, nil)
+	leaf, _ := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(20), Subject: pkix.Name{CommonName: "Short-Lived Leaf"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(71 * time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature}, root, rootKey)
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+
+	os.WriteFile("dummyShortLivedRoot.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0640)
+	defer os.Remove("dummyShortLivedRoot.pem")
+	secsipid.SJWTLibOptSetS("CertCAFile", "dummyShortLivedRoot.pem")
+	defer secsipid.SJWTLibOptSetS("CertCAFile", "")
+	secsipid.SJWTLibOptSetS("CertCRLFile", "dummyShortLivedMissing.crl")
+	defer secsipid.SJWTLibOptSetS("CertCRLFile", "")
+	secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA|secsipid.CertVerifyOptCRL)
+	defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	t.Run("ErrCertReadCRLFile without threshold", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertReadCRLFile)
+		expect(secsipid.SJWTCertShortLived(leaf)).ToBe(false)
+	})
+
+	t.Run("OK with validity period below threshold", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertShortLived", 72*3600)
+		defer secsipid.SJWTLibOptSetN("CertShortLived", 0)
+		rev, ret, _ := secsipid.SJWTPubKeyVerifyRevocation(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(rev.CRL).ToBe(secsipid.RevStatusShortLived)
+		expect(secsipid.SJWTCertShortLived(leaf)).ToBe(true)
+	})
+
+	t.Run("ErrCertReadCRLFile with validity period above threshold", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertShortLived", 24*3600)
+		defer secsipid.SJWTLibOptSetN("CertShortLived", 0)
+		ret, _ := secsipid.SJWTPubKeyVerify(leafPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertReadCRLFile)
+	})
+}
@@ -1,23 +1,24 @@
 package secsipid
 
 import (
-	"crypto"
+	"bytes"
+	"context"
 	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/big"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unicode"
 
@@ -43,6 +44,13 @@ const (
 	SJWTRetErrCertReadCRLFile     = -111
 	SJWTRetErrCertRevoked         = -112
 	SJWTRetErrCertInvalidEC       = -114
+	SJWTRetErrCertConstraints     = -115
+	SJWTRetErrCertPinMismatch     = -116
+	SJWTRetErrCertOCSPUnavailable = -117
+	SJWTRetErrCertOCSPInvalid     = -118
+	SJWTRetErrCertKeyUsage        = -119
+	SJWTRetErrCertExtKeyUsage     = -120
+	SJWTRetErrCertPolicyOID       = -121
 	SJWTRetErrPrvKeyInvalid       = -151
 	SJWTRetErrPrvKeyInvalidFormat = -152
 	SJWTRetErrPrvKeyInvalidEC     = -152
@@ -52,33 +60,65 @@ const (
 	SJWTRetErrJSONHdrPpt            = -203
 	SJWTRetErrJSONHdrTyp            = -204
 	SJWTRetErrJSONHdrX5u            = -205
+	SJWTRetErrJSONHdrX5t            = -206
 	SJWTRetErrJSONPayloadParse      = -231
 	SJWTRetErrJSONPayloadIATExpired = -232
+	SJWTRetErrJSONPayloadRcdi       = -233
+	SJWTRetErrJSONPayloadMky        = -234
+	SJWTRetErrJSONPayloadDestTN     = -235
+	SJWTRetErrJSONPayloadIATFuture  = -236
 	SJWTRetErrJSONSignatureInvalid  = -251
 	SJWTRetErrJSONSignatureHashing  = -252
 	SJWTRetErrJSONSignatureSize     = -253
 	SJWTRetErrJSONSignatureFailure  = -254
 	SJWTRetErrJSONSignatureNob64    = -255
 	// identity SIP header errors: -300..-399
-	SJWTRetErrSIPHdrParse = -301
-	SJWTRetErrSIPHdrAlg   = -302
-	SJWTRetErrSIPHdrPpt   = -303
-	SJWTRetErrSIPHdrEmpty = -304
-	SJWTRetErrSIPHdrInfo  = -305
+	SJWTRetErrSIPHdrParse    = -301
+	SJWTRetErrSIPHdrAlg      = -302
+	SJWTRetErrSIPHdrPpt      = -303
+	SJWTRetErrSIPHdrEmpty    = -304
+	SJWTRetErrSIPHdrInfo     = -305
+	SJWTRetErrSIPHdrNoShaken = -306
+	SJWTRetErrSIPHdrTooLong  = -307
+	SJWTRetErrDivChainOrig   = -311
+	SJWTRetErrDivChainDest   = -312
+	SJWTRetErrRedirectTarget = -313
+	SJWTRetErrConnectedDest  = -321
+	SJWTRetErrConnectedOrig  = -322
 	// http and file operations errors: -400..-499
 	SJWTRetErrHTTPInvalidURL = -401
 	SJWTRetErrHTTPGet        = -402
 	SJWTRetErrHTTPStatusCode = -403
 	SJWTRetErrHTTPReadBody   = -404
+	SJWTRetErrHTTPTimeout    = -405
+	SJWTRetErrHTTPRedirect   = -406
 	SJWTRetErrFileRead       = -451
+	// policy errors: -500..-599
+	SJWTRetErrPolicyDNO          = -501
+	SJWTRetErrPolicyPptMissing   = -502
+	SJWTRetErrPolicyPptForbidden = -503
 )
 
+// SJWTRetIsUnavailable - true if the return code is for a verification that
+// could not be performed (e.g., certificate repository or CRL unavailable),
+// not for a verification that failed
+func SJWTRetIsUnavailable(ret int) bool {
+	switch ret {
+	case SJWTRetErrCertNoCRLFile, SJWTRetErrCertReadCRLFile, SJWTRetErrCertOCSPUnavailable,
+		SJWTRetErrHTTPGet, SJWTRetErrHTTPStatusCode, SJWTRetErrHTTPReadBody, SJWTRetErrHTTPTimeout:
+		return true
+	}
+	return false
+}
+
 // SJWTHeader - header for JWT
 type SJWTHeader struct {
 	Alg string `json:"alg"`
 	Ppt string `json:"ppt"`
 	Typ string `json:"typ"`
 	X5u string `json:"x5u"`
+	// X5tS256 - thumbprint of the signer certificate (optional)
+	X5tS256 string `json:"x5t#S256,omitempty"`
 }
 
 // SJWTDest --
@@ -93,11 +133,17 @@ type SJWTOrig struct {
 
 // SJWTPayload - JWT payload
 type SJWTPayload struct {
-	ATTest string   `json:"attest"`
-	Dest   SJWTDest `json:"dest"`
-	IAT    int64    `json:"iat"`
-	Orig   SJWTOrig `json:"orig"`
-	OrigID string   `json:"origid"`
+	ATTest string    `json:"attest"`
+	Dest   SJWTDest  `json:"dest"`
+	IAT    int64     `json:"iat"`
+	Mky    []SJWTMky `json:"mky,omitempty"`
+	Orig   SJWTOrig  `json:"orig"`
+	OrigID string    `json:"origid"`
+	RCD    *SJWTRcd  `json:"rcd,omitempty"`
+	// RCDI - integrity digests of rcd members, keyed by JSON pointer (e.g., "/icn")
+	RCDI map[string]string `json:"rcdi,omitempty"`
+	// Extra - additional claims, not part of the fields above
+	Extra map[string]interface{} `json:"-"`
 }
 
 type SJWTLibOptions struct {
@@ -109,6 +155,50 @@ type SJWTLibOptions struct {
 	certVerify   int
 	attrsVerify  int
 	x5u          string
+	dnoFile      string
+	dnoReject    int
+	rcdiVerify   int
+	canonJSON    int
+	idMaxLen     int
+	segMaxLen    int
+	destTNMax    int
+	iatSkew      int
+	pptExpire    map[string]int
+	resCacheTTL  int
+	resCacheMax  int
+	spc          string
+	pinFile      string
+	pinPolicy    int
+	ipFamily     int
+	ipPrefer     int
+	happyEyes    int
+	fetchSRV     int
+	dnsServers   string
+	dnsCache     int
+	userAgent    string
+	fetchHdrs    http.Header
+	redirMax     int
+	redirStrict  int
+	repoAuthFile string
+	aiaFetch     int
+	aiaMax       int
+	aiaHosts     string
+	cacheInteg   int
+	cacheKeyFile string
+	cacheMaxEnt  int
+	cacheMaxSize int
+	cacheReval   int
+	cacheStale   int
+	crlRefresh   int
+	ocspShared   string
+	crlPolicy    int
+	ocspPolicy   int
+	shortLived   int
+	certPolicy   int
+	certPolEKU   string
+	certPolOIDs  string
+	x5tCertFile  string
+	signerAlgs   string
 }
 
 const (
@@ -118,6 +208,7 @@ const (
 	CertVerifyOptInterCA  = (1 << 3)
 	CertVerifyOptCRL      = (1 << 4)
 	CertVerifyOptTimeOnly = (1 << 5)
+	CertVerifyOptOCSP     = (1 << 6)
 )
 
 var globalLibOptions = SJWTLibOptions{
@@ -129,13 +220,52 @@ var globalLibOptions = SJWTLibOptions{
 	certVerify:   0,
 	attrsVerify:  1,
 	x5u:          "https://127.0.0.1/cert.pem",
+	dnoFile:      "",
+	dnoReject:    0,
+	rcdiVerify:   0,
+	canonJSON:    0,
+	idMaxLen:     0,
+	segMaxLen:    0,
+	destTNMax:    0,
+	iatSkew:      0,
+	pptExpire:    map[string]int{},
+	resCacheTTL:  0,
+	resCacheMax:  10000,
+	spc:          "",
+	pinFile:      "",
+	pinPolicy:    PinPolicyNone,
+	ipFamily:     IPFamilyAny,
+	ipPrefer:     IPFamilyAny,
+	happyEyes:    300,
+	fetchSRV:     0,
+	dnsServers:   "",
+	dnsCache:     0,
+	userAgent:    "",
+	fetchHdrs:    http.Header{},
+	redirMax:     10,
+	redirStrict:  0,
+	repoAuthFile: "",
+	aiaFetch:     0,
+	aiaMax:       3,
+	aiaHosts:     "",
+	cacheInteg:   0,
+	cacheKeyFile: "",
+	cacheMaxEnt:  0,
+	cacheMaxSize: 0,
+	cacheReval:   0,
+	cacheStale:   0,
+	crlRefresh:   0,
+	ocspShared:   "",
+	crlPolicy:    RevPolicyHardFail,
+	ocspPolicy:   RevPolicyHardFail,
+	shortLived:   0,
+	certPolicy:   CertPolicyOff,
+	certPolEKU:   "",
+	certPolOIDs:  CertPolicySHAKEN,
+	x5tCertFile:  "",
+	signerAlgs:   "ES256",
 }
 
-var (
-	sES256KeyBits = 256
-	sES256KeySize = 32
-)
-
 // SetFileCacheOptions --
 func SetURLFileCacheOptions(path string, expire int) {
 	globalLibOptions.cacheDirPath = path
@@ -144,6 +274,7 @@ func SetURLFileCacheOptions(path string, expire int) {
 
 // SJWTLibOptSetS --
 func SJWTLibOptSetS(optname string, optval string) int {
+	SJWTResultCacheFlush()
 	switch optname {
 	case "CacheDirPath":
 		globalLibOptions.cacheDirPath = optval
@@ -160,12 +291,82 @@ func SJWTLibOptSetS(optname string, optval string) int {
 	case "x5u":
 		globalLibOptions.x5u = optval
 		return SJWTRetOK
+	case "SPC":
+		globalLibOptions.spc = optval
+		return SJWTRetOK
+	case "DNOFile":
+		if ret, _ := SJWTDNOLoad(optval); ret != SJWTRetOK {
+			return ret
+		}
+		globalLibOptions.dnoFile = optval
+		return SJWTRetOK
+	case "PinFile":
+		if ret, _ := SJWTPinLoad(optval); ret != SJWTRetOK {
+			return ret
+		}
+		globalLibOptions.pinFile = optval
+		return SJWTRetOK
+	case "X5tCertFile":
+		if ret, _ := SJWTX5tLoad(optval); ret != SJWTRetOK {
+			return ret
+		}
+		globalLibOptions.x5tCertFile = optval
+		return SJWTRetOK
+	case "SignerAlgs":
+		if err := sjwtSignerAlgsValidate(optval); err != nil {
+			return SJWTRetErr
+		}
+		globalLibOptions.signerAlgs = optval
+		return SJWTRetOK
+	case "DNSServers":
+		globalLibOptions.dnsServers = optval
+		SJWTDNSCacheFlush()
+		sjwtFetchReset()
+		return SJWTRetOK
+	case "FetchUserAgent":
+		globalLibOptions.userAgent = optval
+		return SJWTRetOK
+	case "FetchHeaders":
+		hdrs, err := sjwtParseHeaders(optval)
+		if err != nil {
+			return SJWTRetErr
+		}
+		globalLibOptions.fetchHdrs = hdrs
+		return SJWTRetOK
+	case "RepoAuthFile":
+		if ret, _ := SJWTRepoAuthLoad(optval); ret != SJWTRetOK {
+			return ret
+		}
+		globalLibOptions.repoAuthFile = optval
+		return SJWTRetOK
+	case "CertAIAHosts":
+		globalLibOptions.aiaHosts = optval
+		return SJWTRetOK
+	case "CacheKeyFile":
+		if ret, _ := SJWTCacheKeyLoad(optval); ret != SJWTRetOK {
+			return ret
+		}
+		globalLibOptions.cacheKeyFile = optval
+		return SJWTRetOK
+	case "OCSPShared":
+		if err := sjwtOCSPSetShared(optval); err != nil {
+			return SJWTRetErr
+		}
+		globalLibOptions.ocspShared = optval
+		return SJWTRetOK
+	case "CertPolicyEKU":
+		globalLibOptions.certPolEKU = optval
+		return SJWTRetOK
+	case "CertPolicyOIDs":
+		globalLibOptions.certPolOIDs = optval
+		return SJWTRetOK
 	}
 	return SJWTRetErr
 }
 
 // SJWTLibOptSetN --
 func SJWTLibOptSetN(optname string, optval int) int {
+	SJWTResultCacheFlush()
 	switch optname {
 	case "CacheExpires":
 		globalLibOptions.cacheExpire = optval
@@ -176,6 +377,105 @@ func SJWTLibOptSetN(optname string, optval int) int {
 	case "AttrsVerify":
 		globalLibOptions.attrsVerify = optval
 		return SJWTRetOK
+	case "DNOReject":
+		globalLibOptions.dnoReject = optval
+		return SJWTRetOK
+	case "RcdiVerify":
+		globalLibOptions.rcdiVerify = optval
+		return SJWTRetOK
+	case "CanonicalJSON":
+		globalLibOptions.canonJSON = optval
+		return SJWTRetOK
+	case "IdentityMaxLen":
+		globalLibOptions.idMaxLen = optval
+		return SJWTRetOK
+	case "SegmentMaxLen":
+		globalLibOptions.segMaxLen = optval
+		return SJWTRetOK
+	case "DestTNMax":
+		globalLibOptions.destTNMax = optval
+		return SJWTRetOK
+	case "IATSkew":
+		globalLibOptions.iatSkew = optval
+		return SJWTRetOK
+	case "ExpireShaken", "ExpireDiv", "ExpireRcd":
+		globalLibOptions.pptExpire[strings.ToLower(strings.TrimPrefix(optname, "Expire"))] = optval
+		return SJWTRetOK
+	case "ResultCacheTTL":
+		globalLibOptions.resCacheTTL = optval
+		return SJWTRetOK
+	case "ResultCacheMax":
+		globalLibOptions.resCacheMax = optval
+		return SJWTRetOK
+	case "PinPolicy":
+		globalLibOptions.pinPolicy = optval
+		return SJWTRetOK
+	case "FetchIPFamily":
+		globalLibOptions.ipFamily = optval
+		sjwtFetchReset()
+		return SJWTRetOK
+	case "FetchIPPrefer":
+		globalLibOptions.ipPrefer = optval
+		sjwtFetchReset()
+		return SJWTRetOK
+	case "FetchHappyEyeballs":
+		globalLibOptions.happyEyes = optval
+		sjwtFetchReset()
+		return SJWTRetOK
+	case "FetchRedirects":
+		globalLibOptions.redirMax = optval
+		return SJWTRetOK
+	case "FetchRedirectStrict":
+		globalLibOptions.redirStrict = optval
+		return SJWTRetOK
+	case "FetchSRV":
+		globalLibOptions.fetchSRV = optval
+		sjwtFetchReset()
+		return SJWTRetOK
+	case "DNSCache":
+		globalLibOptions.dnsCache = optval
+		SJWTDNSCacheFlush()
+		sjwtFetchReset()
+		return SJWTRetOK
+	case "CertAIAFetch":
+		globalLibOptions.aiaFetch = optval
+		return SJWTRetOK
+	case "CertAIAMax":
+		globalLibOptions.aiaMax = optval
+		return SJWTRetOK
+	case "CacheIntegrity":
+		globalLibOptions.cacheInteg = optval
+		return SJWTRetOK
+	case "CacheMaxEntries":
+		globalLibOptions.cacheMaxEnt = optval
+		sjwtCacheIndexReset()
+		return SJWTRetOK
+	case "CacheRevalidate":
+		globalLibOptions.cacheReval = optval
+		return SJWTRetOK
+	case "CacheStaleIfError":
+		globalLibOptions.cacheStale = optval
+		return SJWTRetOK
+	case "CacheMaxSize":
+		globalLibOptions.cacheMaxSize = optval
+		sjwtCacheIndexReset()
+		return SJWTRetOK
+	case "CRLRefresh":
+		globalLibOptions.crlRefresh = optval
+		sjwtCRLRefresher(optval)
+		return SJWTRetOK
+	case "CRLPolicy":
+		globalLibOptions.crlPolicy = optval
+		return SJWTRetOK
+	case "OCSPPolicy":
+		globalLibOptions.ocspPolicy = optval
+		return SJWTRetOK
+	case "CertShortLived":
+		globalLibOptions.shortLived = optval
+		return SJWTRetOK
+	case "CertPolicy":
+		globalLibOptions.certPolicy = optval
+		return SJWTRetOK
 	}
 	return SJWTRetErr
 }
@@ -189,20 +489,154 @@ func SJWTLibOptGetN(optname string) int {
 		return globalLibOptions.certVerify
 	case "AttrsVerify":
 		return globalLibOptions.attrsVerify
+	case "DNOReject":
+		return globalLibOptions.dnoReject
+	case "RcdiVerify":
+		return globalLibOptions.rcdiVerify
+	case "CanonicalJSON":
+		return globalLibOptions.canonJSON
+	case "IdentityMaxLen":
+		return globalLibOptions.idMaxLen
+	case "SegmentMaxLen":
+		return globalLibOptions.segMaxLen
+	case "DestTNMax":
+		return globalLibOptions.destTNMax
+	case "IATSkew":
+		return globalLibOptions.iatSkew
+	case "ExpireShaken", "ExpireDiv", "ExpireRcd":
+		return globalLibOptions.pptExpire[strings.ToLower(strings.TrimPrefix(optname, "Expire"))]
+	case "ResultCacheTTL":
+		return globalLibOptions.resCacheTTL
+	case "ResultCacheMax":
+		return globalLibOptions.resCacheMax
+	case "PinPolicy":
+		return globalLibOptions.pinPolicy
+	case "FetchIPFamily":
+		return globalLibOptions.ipFamily
+	case "FetchIPPrefer":
+		return globalLibOptions.ipPrefer
+	case "FetchHappyEyeballs":
+		return globalLibOptions.happyEyes
+	case "FetchSRV":
+		return globalLibOptions.fetchSRV
+	case "FetchRedirects":
+		return globalLibOptions.redirMax
+	case "FetchRedirectStrict":
+		return globalLibOptions.redirStrict
+	case "DNSCache":
+		return globalLibOptions.dnsCache
+	case "CertAIAFetch":
+		return globalLibOptions.aiaFetch
+	case "CertAIAMax":
+		return globalLibOptions.aiaMax
+	case "CacheIntegrity":
+		return globalLibOptions.cacheInteg
+	case "CacheMaxEntries":
+		return globalLibOptions.cacheMaxEnt
+	case "CacheMaxSize":
+		return globalLibOptions.cacheMaxSize
+	case "CacheRevalidate":
+		return globalLibOptions.cacheReval
+	case "CacheStaleIfError":
+		return globalLibOptions.cacheStale
+	case "CRLRefresh":
+		return globalLibOptions.crlRefresh
+	case "CRLPolicy":
+		return globalLibOptions.crlPolicy
+	case "OCSPPolicy":
+		return globalLibOptions.ocspPolicy
+	case "CertShortLived":
+		return globalLibOptions.shortLived
+	case "CertPolicy":
+		return globalLibOptions.certPolicy
 	}
 	return SJWTRetErr
 }
 
+// SJWTLibOptGetS --
+func SJWTLibOptGetS(optname string) string {
+	switch optname {
+	case "CacheDirPath":
+		return globalLibOptions.cacheDirPath
+	case "CertCAFile":
+		return globalLibOptions.certCAFile
+	case "CertCRLFile":
+		return globalLibOptions.certCRLFile
+	case "CertCAInter":
+		return globalLibOptions.certCAInter
+	case "x5u":
+		return globalLibOptions.x5u
+	case "SPC":
+		return globalLibOptions.spc
+	case "DNOFile":
+		return globalLibOptions.dnoFile
+	case "PinFile":
+		return globalLibOptions.pinFile
+	case "DNSServers":
+		return globalLibOptions.dnsServers
+	case "FetchUserAgent":
+		return globalLibOptions.userAgent
+	case "FetchHeaders":
+		return sjwtFormatHeaders(globalLibOptions.fetchHdrs)
+	case "RepoAuthFile":
+		return globalLibOptions.repoAuthFile
+	case "CertAIAHosts":
+		return globalLibOptions.aiaHosts
+	case "CacheKeyFile":
+		return globalLibOptions.cacheKeyFile
+	case "OCSPShared":
+		return globalLibOptions.ocspShared
+	case "CertPolicyEKU":
+		return globalLibOptions.certPolEKU
+	case "CertPolicyOIDs":
+		return globalLibOptions.certPolOIDs
+	case "X5tCertFile":
+		return globalLibOptions.x5tCertFile
+	case "SignerAlgs":
+		return globalLibOptions.signerAlgs
+	}
+	return ""
+}
+
+// SJWTLibOptGetAll - the values of all library options, by name
+func SJWTLibOptGetAll() map[string]interface{} {
+	opts := map[string]interface{}{}
+	for _, optname := range []string{"CacheDirPath", "CertCAFile", "CertCRLFile", "CertCAInter",
+		"x5u", "SPC", "DNOFile", "PinFile", "DNSServers", "FetchUserAgent", "FetchHeaders", "RepoAuthFile",
+		"CertAIAHosts", "CacheKeyFile", "OCSPShared", "CertPolicyEKU", "CertPolicyOIDs",
+		"X5tCertFile", "SignerAlgs"} {
+		opts[optname] = SJWTLibOptGetS(optname)
+	}
+	for _, optname := range []string{"CacheExpires", "CertVerify", "AttrsVerify", "DNOReject",
+		"RcdiVerify", "CanonicalJSON", "IdentityMaxLen", "SegmentMaxLen", "DestTNMax", "IATSkew",
+		"ExpireShaken", "ExpireDiv", "ExpireRcd", "ResultCacheTTL", "ResultCacheMax", "PinPolicy",
+		"FetchIPFamily", "FetchIPPrefer", "FetchHappyEyeballs", "FetchSRV", "FetchRedirects",
+		"FetchRedirectStrict", "DNSCache", "CertAIAFetch", "CertAIAMax", "CacheIntegrity", "CacheMaxEntries", "CacheMaxSize", "CacheRevalidate", "CacheStaleIfError", "CRLRefresh",
+		"CRLPolicy", "OCSPPolicy", "CertShortLived", "CertPolicy"} {
+		opts[optname] = SJWTLibOptGetN(optname)
+	}
+	return opts
+}
+
 // SJWTLibOptSetV --
 func SJWTLibOptSetV(optnameval string) int {
 	optArray := strings.SplitN(optnameval, "=", 2)
 	optName := optArray[0]
 	optVal := optArray[1]
 	switch optName {
-	case "CacheExpires", "CertVerify":
+	case "CacheExpires", "CertVerify", "DNOReject", "RcdiVerify", "CanonicalJSON",
+		"IdentityMaxLen", "SegmentMaxLen", "DestTNMax", "IATSkew",
+		"ExpireShaken", "ExpireDiv", "ExpireRcd", "ResultCacheTTL", "ResultCacheMax", "PinPolicy",
+		"FetchIPFamily", "FetchIPPrefer", "FetchHappyEyeballs", "FetchSRV", "FetchRedirects",
+		"FetchRedirectStrict", "DNSCache",
+		"CertAIAFetch", "CertAIAMax", "CacheIntegrity", "CacheMaxEntries", "CacheMaxSize", "CacheRevalidate", "CacheStaleIfError", "CRLRefresh",
+		"CRLPolicy", "OCSPPolicy", "CertShortLived", "CertPolicy":
 		intVal, _ := strconv.Atoi(optVal)
 		return SJWTLibOptSetN(optName, intVal)
-	case "CacheDirPath", "CertCAFile", "CertCAInter", "CertCRLFile":
+	case "CacheDirPath", "CertCAFile", "CertCAInter", "CertCRLFile", "DNOFile", "x5u", "SPC", "PinFile",
+		"DNSServers", "FetchUserAgent", "FetchHeaders", "RepoAuthFile", "CertAIAHosts",
+		"CacheKeyFile", "OCSPShared", "CertPolicyEKU", "CertPolicyOIDs", "X5tCertFile",
+		"SignerAlgs":
 		return SJWTLibOptSetS(optName, optVal)
 	}
 	return SJWTRetErr
@@ -219,21 +653,54 @@ func SJWTRemoveWhiteSpaces(s string) string {
 	return string(rout)
 }
 
-// SJWTRemoveWhiteSpaces --
+// SJWTGetURLCacheFilePath - path of the cache file for the URL, the characters
+// not allowed in file names on Windows are replaced as well on that platform
 func SJWTGetURLCacheFilePath(urlVal string) string {
 	filePath := strings.Replace(urlVal, "://", "_", -1)
 	filePath = strings.Replace(filePath, "/", "_", -1)
+	if runtime.GOOS == "windows" {
+		filePath = strings.NewReplacer(":", "_", "\\", "_", "?", "_", "*", "_", "\"", "_",
+			"<", "_", ">", "_", "|", "_").Replace(filePath)
+	}
 	if len(globalLibOptions.cacheDirPath) > 0 {
-		filePath = globalLibOptions.cacheDirPath + "/" + filePath
+		filePath = filepath.Join(globalLibOptions.cacheDirPath, filePath)
 	}
 	return filePath
 }
 
 // SJWTPubKeyVerify -
 func SJWTPubKeyVerify(pubKey []byte) (int, error) {
+	return sjwtPubKeyVerifyContext(context.Background(), pubKey, nil)
+}
+
+// sjwtPubKeyVerifyContext - SJWTPubKeyVerify() with the AIA and OCSP fetches
+// bounded by the deadline of the context, setting the verified chain and the
+// decisions of the revocation checks in the details of the verification
+func sjwtPubKeyVerifyContext(ctx context.Context, pubKey []byte, info *SJWTCheckInfo) (int, error) {
+	chain, rev, ret, err := sjwtPubKeyVerifyRevocation(ctx, pubKey)
+	if rev.CRL == RevStatusSoftFail || rev.OCSP == RevStatusSoftFail {
+		sjwtDegradedAdd(&degradedStats.SoftFail)
+	}
+	if info != nil {
+		info.Chain, info.Revocation = chain, rev
+	}
+	return ret, err
+}
+
+// SJWTPubKeyVerifyChain - verify the certificate like SJWTPubKeyVerify(),
+// returning the chain used for it, from the leaf certificate to the root CA
+// (only the leaf certificate if the chain is not verified)
+func SJWTPubKeyVerifyChain(pubKey []byte) ([]*x509.Certificate, int, error) {
 	if globalLibOptions.certVerify == 0 {
-		return SJWTRetOK, nil
+		return nil, SJWTRetOK, nil
 	}
+	end := sjwtSpan("secsipid.cert_verify")
+	chain, ret, err := sjwtPubKeyVerify(context.Background(), sjwtCertChainOrder(pubKey), nil)
+	end(err)
+	return chain, ret, err
+}
+
+func sjwtPubKeyVerify(ctx context.Context, pubKey []byte, rev *SJWTRevocation) ([]*x509.Certificate, int, error) {
 
 	var certVal *x509.Certificate
 	var certInter []*x509.Certificate
@@ -256,32 +723,38 @@ func SJWTPubKeyVerify(pubKey []byte) (int, error) {
 		// Parse the block as an x509 certificate.
 		blockCert, err := x509.ParseCertificate(block.Bytes)
 		if blockCert == nil {
-			return SJWTRetErrCertInvalidFormat, err
+			return nil, SJWTRetErrCertInvalidFormat, err
 		}
 
 		// If this was the first block then it represents the public certificate,
 		// otherwise it is an intermediate certificate.
+		// The embedded self-signed roots are not used, the chain has to be
+		// anchored at the configured root CAs.
 		if certVal == nil {
 			certVal = blockCert
-		} else {
+		} else if !bytes.Equal(blockCert.RawIssuer, blockCert.RawSubject) {
 			certInter = append(certInter, blockCert)
 		}
 	}
 
 	if certVal == nil {
-		return SJWTRetErrCertInvalidFormat, errors.New("failed to parse certificate PEM")
+		return nil, SJWTRetErrCertInvalidFormat, errors.New("failed to parse certificate PEM")
 	}
 
 	if (globalLibOptions.certVerify & (CertVerifyOptTime | CertVerifyOptTimeOnly)) != 0 {
-		if !time.Now().Before(certVal.NotAfter) {
-			return SJWTRetErrCertExpired, errors.New("certificate expired")
-		} else if !time.Now().After(certVal.NotBefore) {
-			return SJWTRetErrCertBeforeValidity, errors.New("certificate not valid yet")
+		if !sjwtNow().Before(certVal.NotAfter) {
+			return nil, SJWTRetErrCertExpired, errors.New("certificate expired")
+		} else if !sjwtNow().After(certVal.NotBefore) {
+			return nil, SJWTRetErrCertBeforeValidity, errors.New("certificate not valid yet")
 		}
 	}
 
+	if ret, err := SJWTCertPolicyCheck(certVal); err != nil {
+		return nil, ret, err
+	}
+
 	if (globalLibOptions.certVerify & CertVerifyOptTimeOnly) != 0 {
-		return SJWTRetOK, nil
+		return []*x509.Certificate{certVal}, SJWTRetOK, nil
 	}
 
 	rootCAs = nil
@@ -290,50 +763,50 @@ func SJWTPubKeyVerify(pubKey []byte) (int, error) {
 		// Get the SystemCertPool
 		rootCAs, err = SystemCertPool()
 		if rootCAs == nil {
-			return SJWTRetErrCertProcessing, err
+			return nil, SJWTRetErrCertProcessing, err
 		}
 	}
 	if (globalLibOptions.certVerify & CertVerifyOptCustCA) != 0 {
 		if len(globalLibOptions.certCAFile) <= 0 {
-			return SJWTRetErrCertNoCAFile, errors.New("no custom CA file")
+			return nil, SJWTRetErrCertNoCAFile, errors.New("no custom CA file")
 		}
 
 		if rootCAs == nil {
 			rootCAs = x509.NewCertPool()
 			if rootCAs == nil {
-				return SJWTRetErrCertProcessing, errors.New("no new CA cert pool")
+				return nil, SJWTRetErrCertProcessing, errors.New("no new CA cert pool")
 			}
 		}
 		var certsCA []byte
 		// Read in the cert file
 		certsCA, err = os.ReadFile(globalLibOptions.certCAFile)
 		if err != nil {
-			return SJWTRetErrCertReadCAFile, errors.New("failed to read CA file")
+			return nil, SJWTRetErrCertReadCAFile, errors.New("failed to read CA file")
 		}
 
 		// Append our cert to the system pool
 		if ok := rootCAs.AppendCertsFromPEM(certsCA); !ok {
-			return SJWTRetErrCertProcessing, errors.New("failed to append CA file")
+			return nil, SJWTRetErrCertProcessing, errors.New("failed to append CA file")
 		}
 	}
 	if (globalLibOptions.certVerify & CertVerifyOptInterCA) != 0 {
 		if len(globalLibOptions.certCAInter) <= 0 {
-			return SJWTRetErrCertNoCAInter, errors.New("no intermediate CA file")
+			return nil, SJWTRetErrCertNoCAInter, errors.New("no intermediate CA file")
 		}
 		interCAs = x509.NewCertPool()
 		if interCAs == nil {
-			return SJWTRetErrCertProcessing, errors.New("no new CA intermediate cert pool")
+			return nil, SJWTRetErrCertProcessing, errors.New("no new CA intermediate cert pool")
 		}
 		var certsCA []byte
 		// Read in the cert file
 		certsCA, err = os.ReadFile(globalLibOptions.certCAInter)
 		if err != nil {
-			return SJWTRetErrCertReadCAInter, errors.New("failed to read intermediate CA file")
+			return nil, SJWTRetErrCertReadCAInter, errors.New("failed to read intermediate CA file")
 		}
 
 		// Append our cert to the system pool
 		if ok := interCAs.AppendCertsFromPEM(certsCA); !ok {
-			return SJWTRetErrCertProcessing, errors.New("failed to append intermediate CA file")
+			return nil, SJWTRetErrCertProcessing, errors.New("failed to append intermediate CA file")
 		}
 	}
 
@@ -343,7 +816,7 @@ func SJWTPubKeyVerify(pubKey []byte) (int, error) {
 			interCAs = x509.NewCertPool()
 		}
 		if interCAs == nil {
-			return SJWTRetErrCertProcessing, errors.New("no new CA intermediate cert pool")
+			return nil, SJWTRetErrCertProcessing, errors.New("no new CA intermediate cert pool")
 		}
 		// Append our certs
 		for _, iCert := range certInter {
@@ -355,33 +828,41 @@ func SJWTPubKeyVerify(pubKey []byte) (int, error) {
 		Roots:         rootCAs,
 		Intermediates: interCAs,
 		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		CurrentTime:   sjwtNow(),
 	}
 
-	if _, err = certVal.Verify(opts); err != nil {
-		return SJWTRetErrCertInvalid, err
+	chains, err := certVal.Verify(opts)
+	if err != nil {
+		if _, ok := err.(x509.UnknownAuthorityError); !ok || globalLibOptions.aiaFetch == 0 {
+			return nil, SJWTRetErrCertInvalid, err
+		}
+		if chains, err = sjwtAIAVerify(ctx, certVal, opts, err); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, SJWTRetErrHTTPTimeout, fmt.Errorf("deadline exceeded building the chain: %v", err)
+			}
+			return nil, SJWTRetErrCertInvalid, err
+		}
 	}
 
 	if (globalLibOptions.certVerify & CertVerifyOptCRL) != 0 {
-		if len(globalLibOptions.certCRLFile) <= 0 {
-			return SJWTRetErrCertNoCRLFile, errors.New("no CRL file")
-		}
-		var rootCRL *pkix.CertificateList
-		rootCRL = nil
-		var certsCRLData []byte
-		// Read in the cert file
-		certsCRLData, err = os.ReadFile(globalLibOptions.certCRLFile)
+		ret, err := sjwtRevocationCheck("crl", sjwtRevocationPolicy(globalLibOptions.crlPolicy, certVal), rev, func() (int, error) {
+			return sjwtCRLCheck(certVal)
+		})
 		if err != nil {
-			return SJWTRetErrCertReadCRLFile, errors.New("failed to read CRL file")
+			return nil, ret, err
 		}
-		rootCRL, err = x509.ParseCRL(certsCRLData)
-		for _, revoked := range rootCRL.TBSCertList.RevokedCertificates {
-			if certVal.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
-				return SJWTRetErrCertRevoked, errors.New("serial number match - certificate is revoked")
-			}
+	}
+
+	if (globalLibOptions.certVerify & CertVerifyOptOCSP) != 0 {
+		ret, err := sjwtRevocationCheck("ocsp", sjwtRevocationPolicy(globalLibOptions.ocspPolicy, certVal), rev, func() (int, error) {
+			return sjwtOCSPCheck(ctx, chains[0])
+		})
+		if err != nil {
+			return nil, ret, err
 		}
 	}
 
-	return SJWTRetOK, nil
+	return chains[0], SJWTRetOK, nil
 }
 
 // SJWTParseECPrivateKeyFromPEM Parse PEM encoded Elliptic Curve Private Key Structure
@@ -481,55 +962,184 @@ func SJWTGetURLCachedContent(urlVal string) ([]byte, error) {
 	}
 	tnow := time.Now()
 	if int(tnow.Sub(fileStat.ModTime()).Seconds()) > globalLibOptions.cacheExpire {
-		os.Remove(filePath)
+		// kept to be revalidated with a conditional request or to be used if
+		// the repository cannot be contacted
+		if !sjwtCacheKept(filePath, fileStat.ModTime()) {
+			sjwtCacheRemove(filePath)
+		}
 		return nil, nil
 	}
-	return os.ReadFile(filePath)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	// tampered or truncated content is discarded, to be fetched again
+	if globalLibOptions.cacheInteg != 0 {
+		if err = sjwtCacheCheckDigest(filePath, data); err != nil {
+			sjwtCacheRemove(filePath)
+			return nil, err
+		}
+	}
+	sjwtCacheUsed(filePath)
+	return data, nil
 }
 
 // SJWTSetURLCachedContent --
 func SJWTSetURLCachedContent(urlVal string, data []byte) error {
 	filePath := SJWTGetURLCacheFilePath(urlVal)
 
-	return ioutil.WriteFile(filePath, data, 0640)
+	if err := sjwtCacheWriteFile(filePath, data); err != nil {
+		return err
+	}
+	if globalLibOptions.cacheInteg != 0 {
+		if err := sjwtCacheWriteFile(filePath+cacheDigestSuffix, []byte(sjwtCacheDigest(data)+"\n")); err != nil {
+			return err
+		}
+	}
+	sjwtCacheStored(filePath, int64(len(data)))
+	return nil
 }
 
 // SJWTGetURLContent --
 func SJWTGetURLContent(urlVal string, timeoutVal int) ([]byte, int, error) {
+	end := sjwtSpan("secsipid.fetch", "url", urlVal)
+	data, _, ret, err := sjwtGetURLContent(context.Background(), urlVal, timeoutVal)
+	end(err)
+	return data, ret, err
+}
+
+// sjwtGetCertContent - the certificate for verifying the identity, like
+// SJWTGetURLContent(), counting when it is only from the expired cache entry
+// because the repository cannot be contacted
+func sjwtGetCertContent(ctx context.Context, urlVal string, timeoutVal int) ([]byte, int, error) {
+	end := sjwtSpan("secsipid.fetch", "url", urlVal)
+	data, stale, ret, err := sjwtGetURLContent(ctx, urlVal, timeoutVal)
+	end(err)
+	if stale {
+		sjwtDegradedAdd(&degradedStats.Cache)
+	}
+	return data, ret, err
+}
+
+// sjwtGetURLContent - the content of the URL, from the cache if available or
+// fetched within the timeout and the deadline of the context; the returned
+// flag is set when the fetch failed and the expired cache entry is used
+func sjwtGetURLContent(ctx context.Context, urlVal string, timeoutVal int) ([]byte, bool, int, error) {
 	if len(urlVal) == 0 {
-		return nil, SJWTRetErrHTTPInvalidURL, errors.New("no URL value")
+		return nil, false, SJWTRetErrHTTPInvalidURL, errors.New("no URL value")
 	}
 
 	if !(strings.HasPrefix(urlVal, "http://") || strings.HasPrefix(urlVal, "https://")) {
-		return nil, SJWTRetErrHTTPInvalidURL, errors.New("invalid URL value")
+		return nil, false, SJWTRetErrHTTPInvalidURL, errors.New("invalid URL value")
+	}
+
+	if ret, err := sjwtChaosFetch(); err != nil {
+		return nil, false, ret, err
 	}
 
 	if len(globalLibOptions.cacheDirPath) > 0 {
+		end := sjwtSpan("secsipid.cache", "url", urlVal)
 		cdata, cerr := SJWTGetURLCachedContent(urlVal)
+		end(cerr)
 		if cdata != nil {
-			return cdata, SJWTRetOK, cerr
+			return cdata, false, SJWTRetOK, cerr
 		}
 	}
+	var data []byte
+	ret, err := SJWTRetErrHTTPTimeout, errors.New("deadline exceeded before fetching")
+	if ctx.Err() != context.DeadlineExceeded {
+		// the concurrent requests for the same URL are served by a single fetch
+		data, ret, err = sjwtFetchShared(ctx, urlVal, func() ([]byte, int, error) {
+			return sjwtFetchURL(ctx, urlVal, timeoutVal)
+		})
+	}
+	if err != nil && len(globalLibOptions.cacheDirPath) > 0 {
+		if sdata := sjwtCacheStaleContent(urlVal); sdata != nil {
+			return sdata, true, SJWTRetOK, nil
+		}
+	}
+	return data, false, ret, err
+}
+
+// sjwtHTTPStatusError - the status code of the response was not 200
+type sjwtHTTPStatusError struct {
+	code int
+}
+
+func (e *sjwtHTTPStatusError) Error() string {
+	return fmt.Sprintf("http status error: %v", e.code)
+}
+
+// sjwtFetchURL - fetch the content of the URL, storing it in the cache
+func sjwtFetchURL(ctx context.Context, urlVal string, timeoutVal int) ([]byte, int, error) {
 	httpClient := http.Client{
-		Timeout: time.Duration(timeoutVal) * time.Second,
+		Timeout:       time.Duration(timeoutVal) * time.Second,
+		Transport:     sjwtRepoAuthTransport(urlVal),
+		CheckRedirect: sjwtCheckRedirect,
 	}
-	resp, err := httpClient.Get(urlVal)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlVal, nil)
 	if err != nil {
+		return nil, SJWTRetErrHTTPInvalidURL, fmt.Errorf("invalid URL value: %v", err)
+	}
+	for name, values := range globalLibOptions.fetchHdrs {
+		req.Header[name] = values
+	}
+	if len(globalLibOptions.userAgent) > 0 {
+		req.Header.Set("User-Agent", globalLibOptions.userAgent)
+	}
+	sjwtRepoAuthHeader(req)
+	filePath := ""
+	if len(globalLibOptions.cacheDirPath) > 0 {
+		filePath = SJWTGetURLCacheFilePath(urlVal)
+		if etag, lastModified := sjwtCacheValidators(filePath); len(etag) > 0 || len(lastModified) > 0 {
+			if len(etag) > 0 {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if len(lastModified) > 0 {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, SJWTRetErrHTTPTimeout, fmt.Errorf("deadline exceeded fetching: %v", err)
+		}
+		if sjwtRedirectErr(err) {
+			return nil, SJWTRetErrHTTPRedirect, fmt.Errorf("redirect not allowed: %v", err)
+		}
 		return nil, SJWTRetErrHTTPGet, fmt.Errorf("http get failure: %v", err)
 	}
 	defer resp.Body.Close()
+	sjwtSetFinalURL(urlVal, resp.Request.URL.String())
+
+	if resp.StatusCode == http.StatusNotModified && len(filePath) > 0 &&
+		len(req.Header.Get("If-None-Match")+req.Header.Get("If-Modified-Since")) > 0 {
+		if data, err := sjwtCacheRevalidated(filePath); err == nil {
+			atomic.AddUint64(&fetchStats.Revalidated, 1)
+			return data, SJWTRetOK, nil
+		}
+		// the cached content is gone or corrupted, fetch it again in full
+		sjwtCacheRemove(filePath)
+		return sjwtFetchURL(ctx, urlVal, timeoutVal)
+	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, SJWTRetErrHTTPStatusCode, fmt.Errorf("http status error: %v", resp.StatusCode)
+		return nil, SJWTRetErrHTTPStatusCode, &sjwtHTTPStatusError{code: resp.StatusCode}
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, SJWTRetErrHTTPTimeout, fmt.Errorf("deadline exceeded reading: %v", err)
+		}
 		return nil, SJWTRetErrHTTPReadBody, fmt.Errorf("read http body failure: %v", err)
 	}
 
-	if len(globalLibOptions.cacheDirPath) > 0 {
-		SJWTSetURLCachedContent(urlVal, data)
+	if len(filePath) > 0 {
+		if SJWTSetURLCachedContent(urlVal, data) == nil && globalLibOptions.cacheReval > 0 {
+			sjwtCacheSetValidators(filePath, resp.Header)
+		}
 	}
 
 	return data, SJWTRetOK, nil
@@ -551,16 +1161,56 @@ func SJWTGetValidPayload(base64Payload string, expireVal int) (*SJWTPayload, int
 		return nil, SJWTRetErrJSONPayloadParse, fmt.Errorf("invalid payload: %s", err.Error())
 	}
 
-	if payload.IAT == 0 || time.Now().Unix() > payload.IAT+int64(expireVal) {
+	if ret, err := sjwtCheckDestLimit(&payload); err != nil {
+		return nil, ret, err
+	}
+
+	if payload.IAT == 0 || sjwtNow().Unix() > payload.IAT+int64(expireVal) {
 		return nil, SJWTRetErrJSONPayloadIATExpired, errors.New("expired token")
 	}
 
+	if globalLibOptions.iatSkew > 0 && payload.IAT > sjwtNow().Unix()+int64(globalLibOptions.iatSkew) {
+		return nil, SJWTRetErrJSONPayloadIATFuture, errors.New("token iat in the future")
+	}
+
+	if globalLibOptions.dnoReject != 0 && SJWTDNOListed(payload.Orig.TN) {
+		return nil, SJWTRetErrPolicyDNO, errors.New("orig tn in do-not-originate list")
+	}
+
 	return &payload, SJWTRetOK, nil
 }
 
-// SJWTVerifyWithPubKey - implements the verify
-// For this verify method, key must be an ecdsa.PublicKey struct
+// sjwtPptExpire - the expire value for the ppt of the base64 encoded header,
+// if it is set in the library options, otherwise the expire value given
+func sjwtPptExpire(base64Header string, expireVal int) int {
+	if len(globalLibOptions.pptExpire) == 0 {
+		return expireVal
+	}
+	decodedHeader, err := SJWTBase64DecodeString(base64Header)
+	if err != nil {
+		return expireVal
+	}
+	header := SJWTHeader{}
+	if err = json.Unmarshal([]byte(decodedHeader), &header); err != nil {
+		return expireVal
+	}
+	if pptExpire := globalLibOptions.pptExpire[header.Ppt]; pptExpire > 0 {
+		return pptExpire
+	}
+	return expireVal
+}
+
+// SJWTVerifyWithPubKey - implements the verify with the signature algorithm
+// of the alg header field (ES256 if not set), the key must be a public key
+// usable by it (e.g., *ecdsa.PublicKey for ES256)
 func SJWTVerifyWithPubKey(signingString string, signature string, key interface{}) (int, error) {
+	end := sjwtSpan("secsipid.verify")
+	ret, err := sjwtVerifyWithPubKey(signingString, signature, key)
+	end(err)
+	return ret, err
+}
+
+func sjwtVerifyWithPubKey(signingString string, signature string, key interface{}) (int, error) {
 	var err error
 
 	var sig []byte
@@ -568,84 +1218,50 @@ func SJWTVerifyWithPubKey(signingString string, signature string, key interface{
 		return SJWTRetErrJSONSignatureNob64, err
 	}
 
-	var ecdsaKey *ecdsa.PublicKey
-	switch k := key.(type) {
-	case *ecdsa.PublicKey:
-		ecdsaKey = k
-	default:
-		return SJWTRetErrCertInvalidFormat, errors.New("invalid key type")
-	}
-
-	if len(sig) != 2*sES256KeySize {
-		return SJWTRetErrJSONSignatureSize, errors.New("ECDSA signature size verification failed")
-	}
-
-	r := big.NewInt(0).SetBytes(sig[:sES256KeySize])
-	s := big.NewInt(0).SetBytes(sig[sES256KeySize:])
-
-	if !crypto.SHA256.Available() {
-		return SJWTRetErrJSONSignatureHashing, errors.New("hashing function unavailable")
-	}
-	hasher := crypto.SHA256.New()
-	hasher.Write([]byte(signingString))
-
-	if verifystatus := ecdsa.Verify(ecdsaKey, hasher.Sum(nil), r, s); verifystatus == true {
-		return SJWTRetOK, nil
+	alg, ret, err := sjwtSignerAlg(sjwtSigningAlg(signingString))
+	if err != nil {
+		return ret, err
 	}
-	return SJWTRetErrJSONSignatureInvalid, errors.New("ECDSA verification failed")
+	return alg.Verify(signingString, sig, key)
 }
 
-// SJWTSignWithPrvKey - implements the signing
-// For this signing method, key must be an ecdsa.PrivateKey struct
+// SJWTSignWithPrvKey - implements the signing with the signature algorithm
+// of the alg header field (ES256 if not set), the key must be a private key
+// usable by it (e.g., *ecdsa.PrivateKey for ES256)
 func SJWTSignWithPrvKey(signingString string, key interface{}) (string, int, error) {
-	var ecdsaKey *ecdsa.PrivateKey
-	switch k := key.(type) {
-	case *ecdsa.PrivateKey:
-		ecdsaKey = k
-	default:
-		return "", SJWTRetErrPrvKeyInvalidEC, errors.New("invalid key type")
-	}
+	end := sjwtSpan("secsipid.sign")
+	sig, ret, err := sjwtSignWithPrvKey(signingString, key)
+	end(err)
+	return sig, ret, err
+}
 
-	if !crypto.SHA256.Available() {
-		return "", SJWTRetErrJSONSignatureHashing, errors.New("hashing function not available")
+func sjwtSignWithPrvKey(signingString string, key interface{}) (string, int, error) {
+	alg, ret, err := sjwtSignerAlg(sjwtSigningAlg(signingString))
+	if err != nil {
+		return "", ret, err
 	}
-
-	hasher := crypto.SHA256.New()
-	hasher.Write([]byte(signingString))
-
-	r, s, err := ecdsa.Sign(rand.Reader, ecdsaKey, hasher.Sum(nil))
-	if err == nil {
-		curveBits := ecdsaKey.Curve.Params().BitSize
-
-		if sES256KeyBits != curveBits {
-			return "", SJWTRetErrJSONSignatureSize, errors.New("invalid key size")
-		}
-
-		keyBytes := curveBits / 8
-		if curveBits%8 > 0 {
-			keyBytes++
-		}
-
-		rBytes := r.Bytes()
-		rBytesPadded := make([]byte, keyBytes)
-		copy(rBytesPadded[keyBytes-len(rBytes):], rBytes)
-
-		sBytes := s.Bytes()
-		sBytesPadded := make([]byte, keyBytes)
-		copy(sBytesPadded[keyBytes-len(sBytes):], sBytes)
-
-		out := append(rBytesPadded, sBytesPadded...)
-
-		return SJWTBase64EncodeBytes(out), SJWTRetOK, nil
+	sig, ret, err := alg.Sign(signingString, key)
+	if err != nil {
+		return "", ret, err
 	}
-	return "", SJWTRetErrJSONSignatureFailure, err
+	return SJWTBase64EncodeBytes(sig), SJWTRetOK, nil
 }
 
 // SJWTEncode - encode payload to JWT
 func SJWTEncode(header SJWTHeader, payload SJWTPayload, prvkey interface{}) string {
+	return sjwtEncode(header, payload, prvkey, globalLibOptions.canonJSON != 0)
+}
+
+// sjwtEncode - encode and sign the header and payload, with canonical JSON
+// if the flag is set
+func sjwtEncode(header SJWTHeader, payload SJWTPayload, prvkey interface{}, canonical bool) string {
 	str, _ := json.Marshal(header)
-	jwthdr := SJWTBase64EncodeString(string(str))
 	encodedPayload, _ := json.Marshal(payload)
+	if canonical {
+		str, _ = SJWTCanonicalJSON(str)
+		encodedPayload, _ = SJWTCanonicalJSON(encodedPayload)
+	}
+	jwthdr := SJWTBase64EncodeString(string(str))
 	signingValue := jwthdr + "." +
 		SJWTBase64EncodeString(string(encodedPayload))
 	signatureValue, _, _ := SJWTSignWithPrvKey(signingValue, prvkey)
@@ -684,17 +1300,23 @@ func SJWTEncodeText(headerJSON string, payloadJSON string, prvkeyPath string) (s
 	var ret int
 	var err error
 	var signatureValue string
-	var ecdsaPrvKey *ecdsa.PrivateKey
+	var privateKey interface{}
 
-	prvkey, _ := os.ReadFile(prvkeyPath)
+	prvkey, _ := SJWTReadPrvKey(prvkeyPath)
 
-	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkey); err != nil {
+	if privateKey, ret, err = SJWTParsePrivateKeyFromPEM(prvkey); err != nil {
 		return "", ret, err
 	}
 
-	signingValue := SJWTBase64EncodeString(strings.TrimSpace(headerJSON)) +
-		"." + SJWTBase64EncodeString(strings.TrimSpace(payloadJSON))
-	signatureValue, ret, err = SJWTSignWithPrvKey(signingValue, ecdsaPrvKey)
+	if headerJSON, ret, err = sjwtCanonicalText(headerJSON, SJWTRetErrJSONHdrParse); err != nil {
+		return "", ret, err
+	}
+	if payloadJSON, ret, err = sjwtCanonicalText(payloadJSON, SJWTRetErrJSONPayloadParse); err != nil {
+		return "", ret, err
+	}
+	signingValue := SJWTBase64EncodeString(headerJSON) +
+		"." + SJWTBase64EncodeString(payloadJSON)
+	signatureValue, ret, err = SJWTSignWithPrvKey(signingValue, privateKey)
 	if err != nil {
 		return "", ret, fmt.Errorf("failed to build signature: %v", err)
 	}
@@ -706,15 +1328,21 @@ func SJWTEncodeTextWithPrvKey(headerJSON string, payloadJSON string, prvkeyData
 	var ret int
 	var err error
 	var signatureValue string
-	var ecdsaPrvKey *ecdsa.PrivateKey
+	var privateKey interface{}
 
-	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM([]byte(prvkeyData)); err != nil {
+	if privateKey, ret, err = SJWTParsePrivateKeyFromPEM([]byte(prvkeyData)); err != nil {
 		return "", ret, err
 	}
 
-	signingValue := SJWTBase64EncodeString(strings.TrimSpace(headerJSON)) +
-		"." + SJWTBase64EncodeString(strings.TrimSpace(payloadJSON))
-	signatureValue, ret, err = SJWTSignWithPrvKey(signingValue, ecdsaPrvKey)
+	if headerJSON, ret, err = sjwtCanonicalText(headerJSON, SJWTRetErrJSONHdrParse); err != nil {
+		return "", ret, err
+	}
+	if payloadJSON, ret, err = sjwtCanonicalText(payloadJSON, SJWTRetErrJSONPayloadParse); err != nil {
+		return "", ret, err
+	}
+	signingValue := SJWTBase64EncodeString(headerJSON) +
+		"." + SJWTBase64EncodeString(payloadJSON)
+	signatureValue, ret, err = SJWTSignWithPrvKey(signingValue, privateKey)
 	if err != nil {
 		return "", ret, fmt.Errorf("failed to build signature: %v", err)
 	}
@@ -735,7 +1363,7 @@ func SJWTCheckAttributes(bToken string, paramInfo string) (int, error) {
 	if err != nil {
 		return SJWTRetErrJSONHdrParse, err
 	}
-	if len(header.Alg) > 0 && header.Alg != "ES256" {
+	if len(header.Alg) > 0 && !SJWTSignerAlgEnabled(header.Alg) {
 		return SJWTRetErrJSONHdrAlg, fmt.Errorf("invalid value for alg in json header")
 	}
 	if len(header.Ppt) > 0 && header.Ppt != "shaken" {
@@ -752,19 +1380,28 @@ func SJWTCheckAttributes(bToken string, paramInfo string) (int, error) {
 
 // SJWTCheckIdentityPKMode - implements the verify of identity
 func SJWTCheckIdentityPKMode(identityVal string, expireVal int, pubkeyVal string, pubkeyMode int, timeoutVal int) (int, error) {
+	return sjwtCheckIdentityPKMode(context.Background(), identityVal, expireVal, pubkeyVal, pubkeyMode, timeoutVal, nil)
+}
+
+func sjwtCheckIdentityPKMode(ctx context.Context, identityVal string, expireVal int, pubkeyVal string, pubkeyMode int, timeoutVal int,
+	info *SJWTCheckInfo) (int, error) {
 	var err error
 	var ret int
-	var ecdsaPubKey *ecdsa.PublicKey
+	var publicKey interface{}
 	var pubkey []byte
 	var payload *SJWTPayload
 
+	if ret, err = sjwtCheckLimits(identityVal); err != nil {
+		return ret, err
+	}
+
 	token := strings.Split(strings.TrimSpace(identityVal), ".")
 
 	if len(token) != 3 {
 		return SJWTRetErrSIPHdrParse, fmt.Errorf("invalid token - must contain header, payload and signature")
 	}
 
-	payload, ret, err = SJWTGetValidPayload(token[1], expireVal)
+	payload, ret, err = SJWTGetValidPayload(token[1], sjwtPptExpire(token[0], expireVal))
 	if err != nil {
 		return ret, err
 	}
@@ -773,7 +1410,7 @@ func SJWTCheckIdentityPKMode(identityVal string, expireVal int, pubkeyVal string
 		pubkey = []byte(pubkeyVal)
 	} else {
 		if strings.HasPrefix(pubkeyVal, "http://") || strings.HasPrefix(pubkeyVal, "https://") {
-			pubkey, ret, err = SJWTGetURLContent(pubkeyVal, timeoutVal)
+			pubkey, ret, err = sjwtGetCertContent(ctx, pubkeyVal, timeoutVal)
 		} else if strings.HasPrefix(pubkeyVal, "file://") {
 			fileUrl, _ := url.Parse(pubkeyVal)
 			pubkey, err = os.ReadFile(fileUrl.Path)
@@ -787,16 +1424,27 @@ func SJWTCheckIdentityPKMode(identityVal string, expireVal int, pubkeyVal string
 		}
 	}
 
-	ret, err = SJWTPubKeyVerify(pubkey)
+	pubkey = sjwtCertChainOrder(pubkey)
+	info.setCert(pubkey)
+	ret, err = sjwtPubKeyVerifyContext(ctx, pubkey, info)
 	if ret != SJWTRetOK {
 		return ret, err
 	}
 
-	if ecdsaPubKey, ret, err = SJWTParseECPublicKeyFromPEM(pubkey); err != nil {
+	if publicKey, ret, err = SJWTParsePublicKeyFromPEM(pubkey); err != nil {
 		return ret, err
 	}
-	ret, err = SJWTVerifyWithPubKey(token[0]+"."+token[1], token[2], ecdsaPubKey)
+	ret, err = SJWTVerifyWithPubKey(token[0]+"."+token[1], token[2], publicKey)
 	if err == nil {
+		if ret, err = sjwtCheckThumbprint(token[0], pubkey); err != nil {
+			return ret, err
+		}
+		if ret, err = sjwtCheckPayloadConstraints(pubkey, token[1]); err != nil {
+			return ret, err
+		}
+		if globalLibOptions.rcdiVerify != 0 {
+			return sjwtRcdiCheck(ctx, payload, timeoutVal)
+		}
 		return SJWTRetOK, nil
 	}
 
@@ -815,7 +1463,7 @@ func SJWTGetValidInfoAttr(hdrtoken []string) (string, int, error) {
 		ptoken := strings.Split(hdrtoken[i], "=")
 		if len(ptoken) == 2 {
 			if ptoken[0] == "alg" {
-				if ptoken[1] != "ES256" {
+				if !SJWTSignerAlgEnabled(ptoken[1]) {
 					return "", SJWTRetErrSIPHdrAlg, fmt.Errorf("invalid value for alg header parameter")
 				}
 			} else if ptoken[0] == "ppt" {
@@ -839,13 +1487,35 @@ func SJWTGetValidInfoAttr(hdrtoken []string) (string, int, error) {
 
 // SJWTCheckFullIdentity - implements the verify of identity
 func SJWTCheckFullIdentity(identityVal string, expireVal int, pubkeyPath string, timeoutVal int) (int, error) {
+	return SJWTCheckFullIdentityContext(context.Background(), identityVal, expireVal, pubkeyPath, timeoutVal)
+}
+
+// SJWTCheckFullIdentityContext - implements the verify of identity like
+// SJWTCheckFullIdentity(), the deadline of the context bounding all the
+// fetches (x5u, AIA, OCSP and rcd resources) done for it, besides the
+// timeout of each one; when it is exceeded, SJWTRetErrHTTPTimeout is returned
+func SJWTCheckFullIdentityContext(ctx context.Context, identityVal string, expireVal int, pubkeyPath string, timeoutVal int) (int, error) {
+	_, ret, err := SJWTCheckFullIdentityInfo(ctx, identityVal, expireVal, pubkeyPath, timeoutVal)
+	return ret, err
+}
+
+// errCheckFailed - the error of the failed check without error, for tracing
+func errCheckFailed(ret int) error {
+	return fmt.Errorf("check failed with code %d", ret)
+}
+
+func sjwtCheckFullIdentity(ctx context.Context, identityVal string, expireVal int, pubkeyPath string, timeoutVal int,
+	info *SJWTCheckInfo) (int, error) {
 	if len(pubkeyPath) == 0 {
-		return SJWTCheckFullIdentityURL(identityVal, expireVal, timeoutVal)
+		return sjwtCheckFullIdentityURL(ctx, identityVal, expireVal, timeoutVal, info)
+	}
+	if ret, err := sjwtCheckLimits(identityVal); err != nil {
+		return ret, err
 	}
 
 	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
 
-	ret, err := SJWTCheckIdentity(hdrtoken[0], expireVal, pubkeyPath, timeoutVal)
+	ret, err := sjwtCheckIdentityPKMode(ctx, hdrtoken[0], expireVal, pubkeyPath, 0, timeoutVal, info)
 	if ret != 0 {
 		return ret, err
 	}
@@ -870,11 +1540,25 @@ func SJWTCheckFullIdentity(identityVal string, expireVal int, pubkeyPath string,
 
 // SJWTCheckFullIdentityURL - implements the verify of identity using URL
 func SJWTCheckFullIdentityURL(identityVal string, expireVal int, timeoutVal int) (int, error) {
-	var ecdsaPubKey *ecdsa.PublicKey
-	var ret int
-	var err error
+	return sjwtCheckFullIdentityURL(context.Background(), identityVal, expireVal, timeoutVal, nil)
+}
+
+func sjwtCheckFullIdentityURL(ctx context.Context, identityVal string, expireVal int, timeoutVal int,
+	info *SJWTCheckInfo) (ret int, err error) {
+	var publicKey interface{}
 	var pubkey []byte
 
+	// counted per issuing CA and SPC once the certificate is available
+	defer func() {
+		if pubkey != nil {
+			sjwtCAStatsAdd(pubkey, ret)
+		}
+	}()
+
+	if ret, err = sjwtCheckLimits(identityVal); err != nil {
+		return ret, err
+	}
+
 	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
 
 	if len(hdrtoken) <= 1 {
@@ -887,18 +1571,37 @@ func SJWTCheckFullIdentityURL(identityVal string, expireVal int, timeoutVal int)
 		return ret, err
 	}
 
-	pubkey, ret, err = SJWTGetURLContent(paramInfo, timeoutVal)
+	pubkey, ret, err = sjwtGetCertContent(ctx, paramInfo, timeoutVal)
 
 	if pubkey == nil {
-		return ret, err
-	}
-
-	ret, err = SJWTPubKeyVerify(pubkey)
-	if ret != SJWTRetOK {
-		return ret, err
+		if pubkey = sjwtPinFallback(paramInfo, ret, err); pubkey == nil {
+			return ret, err
+		}
+		end := sjwtSpan("secsipid.pin", "url", paramInfo)
+		end(nil)
+		sjwtDegradedAdd(&degradedStats.Pin)
+		info.setCert(pubkey)
+		// the pinned public keys are trusted by configuration, the pinned
+		// certificates are verified like the fetched ones
+		if sjwtPinIsCert(pubkey) {
+			if ret, err = sjwtPubKeyVerifyContext(ctx, pubkey, info); ret != SJWTRetOK {
+				return ret, err
+			}
+		}
+	} else {
+		pubkey = sjwtCertChainOrder(pubkey)
+		info.setCert(pubkey)
+		sjwtPinLearnSPC(paramInfo, pubkey)
+		if ret, err = sjwtPinCheck(paramInfo, pubkey); err != nil {
+			return ret, err
+		}
+		ret, err = sjwtPubKeyVerifyContext(ctx, pubkey, info)
+		if ret != SJWTRetOK {
+			return ret, err
+		}
 	}
 
-	if ecdsaPubKey, ret, err = SJWTParseECPublicKeyFromPEM(pubkey); err != nil {
+	if publicKey, ret, err = SJWTParsePublicKeyFromPEM(pubkey); err != nil {
 		return ret, err
 	}
 
@@ -913,21 +1616,38 @@ func SJWTCheckFullIdentityURL(identityVal string, expireVal int, timeoutVal int)
 	}
 
 	var payload *SJWTPayload
-	payload, ret, err = SJWTGetValidPayload(btoken[1], expireVal)
+	payload, ret, err = SJWTGetValidPayload(btoken[1], sjwtPptExpire(btoken[0], expireVal))
 	if payload == nil || err != nil {
 		return ret, err
 	}
 
-	ret, err = SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], btoken[2], ecdsaPubKey)
+	ret, err = SJWTVerifyWithPubKey(btoken[0]+"."+btoken[1], btoken[2], publicKey)
 	if err != nil {
 		return ret, err
 	}
 
+	if ret, err = sjwtCheckThumbprint(btoken[0], pubkey); err != nil {
+		return ret, err
+	}
+
+	if ret, err = sjwtCheckPayloadConstraints(pubkey, btoken[1]); err != nil {
+		return ret, err
+	}
+
+	if globalLibOptions.rcdiVerify != 0 {
+		if ret, err = sjwtRcdiCheck(ctx, payload, timeoutVal); err != nil {
+			return ret, err
+		}
+	}
+
 	return SJWTCheckAttributes(btoken[0], paramInfo)
 }
 
 // SJWTCheckFullIdentityPubKey - implements the verify of identity using public key
 func SJWTCheckFullIdentityPubKey(identityVal string, expireVal int, pubkeyVal string) (int, error) {
+	if ret, err := sjwtCheckLimits(identityVal); err != nil {
+		return ret, err
+	}
 	hdrtoken := strings.Split(SJWTRemoveWhiteSpaces(identityVal), ";")
 
 	ret, err := SJWTCheckIdentityPKMode(hdrtoken[0], expireVal, pubkeyVal, 1, 5)
@@ -955,56 +1675,97 @@ func SJWTCheckFullIdentityPubKey(identityVal string, expireVal int, pubkeyVal st
 
 // SJWTGetIdentityPrvKey --
 func SJWTGetIdentityPrvKey(origTN string, destTN string, attestVal string, origID string, x5uVal string, prvkeyData []byte) (string, int, error) {
-	var ret int
-	var err error
-	var vOrigID string
-
-	header := SJWTHeader{
-		Alg: "ES256",
-		Ppt: "shaken",
-		Typ: "passport",
-		X5u: globalLibOptions.x5u,
-	}
-	if len(x5uVal) > 0 {
-		header.X5u = x5uVal
-	}
-	if len(origID) > 0 {
-		vOrigID = origID
-	} else {
-		vuuid := uuid.New()
-		vOrigID = vuuid.String()
-	}
-
 	payload := SJWTPayload{
 		ATTest: attestVal,
 		Dest: SJWTDest{
 			TN: []string{destTN},
 		},
-		IAT: time.Now().Unix(),
 		Orig: SJWTOrig{
 			TN: origTN,
 		},
-		OrigID: vOrigID,
+		OrigID: origID,
+	}
+	return SJWTGetIdentityPayloadPrvKey(payload, x5uVal, prvkeyData)
+}
+
+// SJWTGetIdentityPayloadPrvKey - build the shaken identity for the payload,
+// allowing to set the optional claims (e.g., mky); the iat is set to current
+// time and the origid is generated if they are not provided
+func SJWTGetIdentityPayloadPrvKey(payload SJWTPayload, x5uVal string, prvkeyData []byte) (string, int, error) {
+	return sjwtGetIdentityPayload(payload, x5uVal, prvkeyData, false)
+}
+
+// sjwtGetIdentityPayload - build the Identity header value, for the compact
+// form the header is limited to what can be rebuilt from the parameters and
+// the JSON is canonical
+func sjwtGetIdentityPayload(payload SJWTPayload, x5uVal string, prvkeyData []byte, compact bool) (string, int, error) {
+	var ret int
+	var err error
+
+	if globalLibOptions.dnoReject != 0 && SJWTDNOListed(payload.Orig.TN) {
+		return "", SJWTRetErrPolicyDNO, errors.New("orig tn in do-not-originate list")
 	}
 
-	var ecdsaPrvKey *ecdsa.PrivateKey
-	if ecdsaPrvKey, ret, err = SJWTParseECPrivateKeyFromPEM(prvkeyData); err != nil {
-		return "", ret, fmt.Errorf("Unable to parse ECDSA private key: %v", err)
+	var privateKey interface{}
+	if privateKey, ret, err = SJWTParsePrivateKeyFromPEM(prvkeyData); err != nil {
+		return "", ret, fmt.Errorf("Unable to parse private key: %v", err)
 	}
-	token := SJWTEncode(header, payload, ecdsaPrvKey)
+
+	header := SJWTHeader{
+		Alg:     sjwtSignerAlgForKey(privateKey).Name(),
+		Ppt:     "shaken",
+		Typ:     "passport",
+		X5u:     SJWTSignX5u(x5uVal, prvkeyData, "shaken", payload.ATTest),
+		X5tS256: sjwtSignX5t(),
+	}
+	if compact {
+		header.X5tS256 = ""
+	}
+	if ret, err = sjwtFillPayload(&payload); err != nil {
+		return "", ret, err
+	}
+
+	token := sjwtEncode(header, payload, privateKey, compact || globalLibOptions.canonJSON != 0)
 
 	if len(token) > 0 {
-		return token + ";info=<" + header.X5u + ">;alg=ES256;ppt=shaken", SJWTRetOK, nil
+		return token + ";info=<" + header.X5u + ">;alg=" + header.Alg + ";ppt=shaken", SJWTRetOK, nil
 	}
 	return "", SJWTRetErrSIPHdrEmpty, errors.New("empty result")
 }
 
+// sjwtFillPayload - run the payload callback and set the origid and the iat
+// if they are not provided
+func sjwtFillPayload(payload *SJWTPayload) (int, error) {
+	if sjwtPayloadCallback != nil {
+		if err := sjwtPayloadCallback(payload); err != nil {
+			return SJWTRetErrJSONPayloadParse, err
+		}
+	}
+	if len(payload.OrigID) == 0 {
+		vuuid := uuid.New()
+		payload.OrigID = vuuid.String()
+	}
+	if payload.IAT == 0 {
+		payload.IAT = time.Now().Unix()
+	}
+	return SJWTRetOK, nil
+}
+
+// SJWTGetIdentityPayload - like SJWTGetIdentityPayloadPrvKey(), with the path to private key
+func SJWTGetIdentityPayload(payload SJWTPayload, x5uVal string, prvkeyPath string) (string, int, error) {
+	prvkey, err := SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return "", SJWTRetErrFileRead, fmt.Errorf("Unable to read private key file: %v", err)
+	}
+	return SJWTGetIdentityPayloadPrvKey(payload, x5uVal, prvkey)
+}
+
 // SJWTGetIdentity --
 func SJWTGetIdentity(origTN string, destTN string, attestVal string, origID string, x5uVal string, prvkeyPath string) (string, int, error) {
 	var prvkey []byte
 	var err error
 
-	prvkey, err = os.ReadFile(prvkeyPath)
+	prvkey, err = SJWTReadPrvKey(prvkeyPath)
 	if err != nil {
 		return "", SJWTRetErrFileRead, fmt.Errorf("Unable to read private key file: %v", err)
 	}
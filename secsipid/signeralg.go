@@ -0,0 +1,347 @@
+package secsipid
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// SJWTSignerAlg - signature algorithm of the PASSporT, identified by the value
+// of the alg header field; the algorithms are used only when they are enabled
+// with the SignerAlgs option
+type SJWTSignerAlg interface {
+	// Name - the value of the alg header field
+	Name() string
+	// KeyMatch - true if the private or public key can be used by the algorithm
+	KeyMatch(key interface{}) bool
+	// Sign - the signature of the signing string with the private key
+	Sign(signingString string, key interface{}) ([]byte, int, error)
+	// Verify - check the signature of the signing string with the public key
+	Verify(signingString string, sig []byte, key interface{}) (int, error)
+}
+
+var signerAlgs = struct {
+	sync.RWMutex
+	algs map[string]SJWTSignerAlg
+}{algs: map[string]SJWTSignerAlg{}}
+
+func init() {
+	for _, alg := range []SJWTSignerAlg{
+		&sjwtAlgECDSA{name: "ES256", hash: crypto.SHA256, bits: 256},
+		&sjwtAlgECDSA{name: "ES384", hash: crypto.SHA384, bits: 384},
+		&sjwtAlgEdDSA{},
+		&sjwtAlgRSA{},
+	} {
+		SJWTSignerAlgRegister(alg)
+	}
+}
+
+// SJWTSignerAlgRegister - add the signature algorithm, replacing the one with
+// the same name
+func SJWTSignerAlgRegister(alg SJWTSignerAlg) {
+	signerAlgs.Lock()
+	signerAlgs.algs[alg.Name()] = alg
+	signerAlgs.Unlock()
+}
+
+// sjwtSignerAlgsValidate - check that all the algorithms of the comma separated
+// list are registered
+func sjwtSignerAlgsValidate(list string) error {
+	signerAlgs.RLock()
+	defer signerAlgs.RUnlock()
+	for _, name := range strings.Split(list, ",") {
+		if _, ok := signerAlgs.algs[strings.TrimSpace(name)]; !ok {
+			return fmt.Errorf("unknown signature algorithm: %s", name)
+		}
+	}
+	return nil
+}
+
+// sjwtSignerAlgsEnabled - the enabled signature algorithms, in the order of the
+// SignerAlgs option
+func sjwtSignerAlgsEnabled() []SJWTSignerAlg {
+	var algs []SJWTSignerAlg
+	signerAlgs.RLock()
+	defer signerAlgs.RUnlock()
+	for _, name := range strings.Split(globalLibOptions.signerAlgs, ",") {
+		if alg, ok := signerAlgs.algs[strings.TrimSpace(name)]; ok {
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// SJWTSignerAlgEnabled - true if the signature algorithm is enabled
+func SJWTSignerAlgEnabled(name string) bool {
+	for _, alg := range sjwtSignerAlgsEnabled() {
+		if alg.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sjwtSignerAlg - the enabled signature algorithm, ES256 if the name is empty
+func sjwtSignerAlg(name string) (SJWTSignerAlg, int, error) {
+	if len(name) == 0 {
+		name = "ES256"
+	}
+	for _, alg := range sjwtSignerAlgsEnabled() {
+		if alg.Name() == name {
+			return alg, SJWTRetOK, nil
+		}
+	}
+	return nil, SJWTRetErrJSONHdrAlg, fmt.Errorf("signature algorithm not enabled: %s", name)
+}
+
+// sjwtSignerAlgForKey - the first enabled signature algorithm that can use the
+// private or public key
+func sjwtSignerAlgForKey(key interface{}) SJWTSignerAlg {
+	for _, alg := range sjwtSignerAlgsEnabled() {
+		if alg.KeyMatch(key) {
+			return alg
+		}
+	}
+	return nil
+}
+
+// sjwtSigningAlg - the alg header field of the signing string, empty if it
+// cannot be decoded
+func sjwtSigningAlg(signingString string) string {
+	base64Header := signingString
+	if i := strings.Index(signingString, "."); i >= 0 {
+		base64Header = signingString[:i]
+	}
+	headerJSON, err := SJWTBase64DecodeBytes(base64Header)
+	if err != nil {
+		return ""
+	}
+	header := SJWTHeader{}
+	if err = json.Unmarshal(headerJSON, &header); err != nil {
+		return ""
+	}
+	return header.Alg
+}
+
+// SJWTSignerAlgName - the name of the enabled signature algorithm for the
+// private key (PEM format), to be set in the alg header field when signing
+func SJWTSignerAlgName(prvkeyData []byte) (string, int, error) {
+	prvKey, ret, err := SJWTParsePrivateKeyFromPEM(prvkeyData)
+	if err != nil {
+		return "", ret, err
+	}
+	return sjwtSignerAlgForKey(prvKey).Name(), SJWTRetOK, nil
+}
+
+// SJWTParsePrivateKeyFromPEM - parse the PEM encoded private key (SEC1, PKCS1
+// or PKCS8), which must be usable by one of the enabled signature algorithms
+func SJWTParsePrivateKeyFromPEM(key []byte) (interface{}, int, error) {
+	var err error
+
+	var block *pem.Block
+	if block, _ = pem.Decode(key); block == nil {
+		return nil, SJWTRetErrPrvKeyInvalidFormat, errors.New("key must be PEM encoded")
+	}
+
+	var parsedKey interface{}
+	if parsedKey, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+		if parsedKey, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			if parsedKey, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				return nil, SJWTRetErrPrvKeyInvalid, err
+			}
+		}
+	}
+	if sjwtSignerAlgForKey(parsedKey) == nil {
+		return nil, SJWTRetErrPrvKeyInvalidEC, errors.New("private key not usable by the enabled signature algorithms")
+	}
+	return parsedKey, SJWTRetOK, nil
+}
+
+// SJWTParsePublicKeyFromPEM - parse the PEM encoded public key or certificate,
+// whose key must be usable by one of the enabled signature algorithms
+func SJWTParsePublicKeyFromPEM(key []byte) (interface{}, int, error) {
+	var err error
+
+	var block *pem.Block
+	if block, _ = pem.Decode(key); block == nil {
+		return nil, SJWTRetErrCertInvalidFormat, errors.New("key must be PEM encoded")
+	}
+
+	var parsedKey interface{}
+	if parsedKey, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			parsedKey = cert.PublicKey
+		} else {
+			return nil, SJWTRetErrCertInvalid, err
+		}
+	}
+	if sjwtSignerAlgForKey(parsedKey) == nil {
+		return nil, SJWTRetErrCertInvalidEC, errors.New("public key not usable by the enabled signature algorithms")
+	}
+	return parsedKey, SJWTRetOK, nil
+}
+
+// sjwtAlgECDSA - ECDSA signature with the r and s values concatenated (ES256
+// and ES384)
+type sjwtAlgECDSA struct {
+	name string
+	hash crypto.Hash
+	bits int
+}
+
+func (a *sjwtAlgECDSA) Name() string {
+	return a.name
+}
+
+func (a *sjwtAlgECDSA) KeyMatch(key interface{}) bool {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		return k.Curve.Params().BitSize == a.bits
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize == a.bits
+	}
+	return false
+}
+
+func (a *sjwtAlgECDSA) digest(signingString string) ([]byte, int, error) {
+	if !a.hash.Available() {
+		return nil, SJWTRetErrJSONSignatureHashing, errors.New("hashing function not available")
+	}
+	hasher := a.hash.New()
+	hasher.Write([]byte(signingString))
+	return hasher.Sum(nil), SJWTRetOK, nil
+}
+
+func (a *sjwtAlgECDSA) Sign(signingString string, key interface{}) ([]byte, int, error) {
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, SJWTRetErrPrvKeyInvalidEC, errors.New("invalid key type")
+	}
+	if ecdsaKey.Curve.Params().BitSize != a.bits {
+		return nil, SJWTRetErrJSONSignatureSize, errors.New("invalid key size")
+	}
+	digest, ret, err := a.digest(signingString)
+	if err != nil {
+		return nil, ret, err
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, ecdsaKey, digest)
+	if err != nil {
+		return nil, SJWTRetErrJSONSignatureFailure, err
+	}
+	keyBytes := (a.bits + 7) / 8
+	out := make([]byte, 2*keyBytes)
+	r.FillBytes(out[:keyBytes])
+	s.FillBytes(out[keyBytes:])
+	return out, SJWTRetOK, nil
+}
+
+func (a *sjwtAlgECDSA) Verify(signingString string, sig []byte, key interface{}) (int, error) {
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return SJWTRetErrCertInvalidFormat, errors.New("invalid key type")
+	}
+	keyBytes := (a.bits + 7) / 8
+	if len(sig) != 2*keyBytes {
+		return SJWTRetErrJSONSignatureSize, errors.New("ECDSA signature size verification failed")
+	}
+	digest, ret, err := a.digest(signingString)
+	if err != nil {
+		return ret, err
+	}
+	r := big.NewInt(0).SetBytes(sig[:keyBytes])
+	s := big.NewInt(0).SetBytes(sig[keyBytes:])
+	if ecdsa.Verify(ecdsaKey, digest, r, s) {
+		return SJWTRetOK, nil
+	}
+	return SJWTRetErrJSONSignatureInvalid, errors.New("ECDSA verification failed")
+}
+
+// sjwtAlgEdDSA - Ed25519 signature (EdDSA)
+type sjwtAlgEdDSA struct{}
+
+func (a *sjwtAlgEdDSA) Name() string {
+	return "EdDSA"
+}
+
+func (a *sjwtAlgEdDSA) KeyMatch(key interface{}) bool {
+	switch key.(type) {
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return true
+	}
+	return false
+}
+
+func (a *sjwtAlgEdDSA) Sign(signingString string, key interface{}) ([]byte, int, error) {
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, SJWTRetErrPrvKeyInvalid, errors.New("invalid key type")
+	}
+	return ed25519.Sign(edKey, []byte(signingString)), SJWTRetOK, nil
+}
+
+func (a *sjwtAlgEdDSA) Verify(signingString string, sig []byte, key interface{}) (int, error) {
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return SJWTRetErrCertInvalidFormat, errors.New("invalid key type")
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return SJWTRetErrJSONSignatureSize, errors.New("EdDSA signature size verification failed")
+	}
+	if ed25519.Verify(edKey, []byte(signingString), sig) {
+		return SJWTRetOK, nil
+	}
+	return SJWTRetErrJSONSignatureInvalid, errors.New("EdDSA verification failed")
+}
+
+// sjwtAlgRSA - RSASSA-PKCS1-v1_5 signature with SHA-256 (RS256), meant only
+// for interoperability tests
+type sjwtAlgRSA struct{}
+
+func (a *sjwtAlgRSA) Name() string {
+	return "RS256"
+}
+
+func (a *sjwtAlgRSA) KeyMatch(key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey, *rsa.PublicKey:
+		return true
+	}
+	return false
+}
+
+func (a *sjwtAlgRSA) Sign(signingString string, key interface{}) ([]byte, int, error) {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, SJWTRetErrPrvKeyInvalid, errors.New("invalid key type")
+	}
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signingString))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest.Sum(nil))
+	if err != nil {
+		return nil, SJWTRetErrJSONSignatureFailure, err
+	}
+	return sig, SJWTRetOK, nil
+}
+
+func (a *sjwtAlgRSA) Verify(signingString string, sig []byte, key interface{}) (int, error) {
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return SJWTRetErrCertInvalidFormat, errors.New("invalid key type")
+	}
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signingString))
+	if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest.Sum(nil), sig); err != nil {
+		return SJWTRetErrJSONSignatureInvalid, errors.New("RSA verification failed")
+	}
+	return SJWTRetOK, nil
+}
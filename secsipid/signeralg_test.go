@@ -0,0 +1,133 @@
+package secsipid_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+// testAlgHS256 - HMAC signature with the key given as bytes, registered to
+// test the extension of the signature algorithms
+type testAlgHS256 struct{}
+
+func (a testAlgHS256) Name() string { return "HS256" }
+
+func (a testAlgHS256) KeyMatch(key interface{}) bool {
+	_, ok := key.([]byte)
+	return ok
+}
+
+func (a testAlgHS256) Sign(signingString string, key interface{}) ([]byte, int, error) {
+	mac := hmac.New(sha256.New, key.([]byte))
+	mac.Write([]byte(signingString))
+	return mac.Sum(nil), secsipid.SJWTRetOK, nil
+}
+
+func (a testAlgHS256) Verify(signingString string, sig []byte, key interface{}) (int, error) {
+	expected, _, _ := a.Sign(signingString, key)
+	if !hmac.Equal(sig, expected) {
+		return secsipid.SJWTRetErrJSONSignatureInvalid, errors.New("HMAC verification failed")
+	}
+	return secsipid.SJWTRetOK, nil
+}
+
+func TestSignerAlgs(t *testing.T) {
+	certPEM := func(pubKey interface{}, prvKey interface{}) []byte {
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Signer Alg"},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+		der, _ := x509.CreateCertificate(rand.Reader, template, template, pubKey, prvKey)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	sign := func(prvkey []byte) (string, int, error) {
+		identity, ret, err := secsipid.SJWTGetIdentityPayloadPrvKey(secsipid.SJWTPayload{ATTest: "A",
+			Dest: secsipid.SJWTDest{TN: []string{"493022222222"}}, Orig: secsipid.SJWTOrig{TN: "493011111111"}},
+			"https://certs.example.com/cert.pem", prvkey)
+		return identity, ret, err
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	ecPrvPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER})
+	ecCertPEM := certPEM(&ecKey.PublicKey, ecKey)
+
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	edPrvPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER})
+	edCertPEM := certPEM(edPub, edKey)
+
+	defer secsipid.SJWTLibOptSetS("SignerAlgs", "ES256")
+
+	t.Run("ErrPrvKeyInvalidEC with ES384 key in strict mode", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, ret, _ := sign(ecPrvPEM)
+		expect(ret).ToBe(secsipid.SJWTRetErrPrvKeyInvalidEC)
+	})
+
+	t.Run("OK with ES384 enabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("SignerAlgs", "ES256,ES384")).ToBe(secsipid.SJWTRetOK)
+		identity, ret, _ := sign(ecPrvPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(strings.Contains(identity, ";alg=ES384;")).ToBe(true)
+		ret, err := secsipid.SJWTCheckIdentityPKMode(strings.Split(identity, ";")[0], 60, string(ecCertPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+
+		secsipid.SJWTLibOptSetS("SignerAlgs", "ES256")
+		ret, _ = secsipid.SJWTCheckIdentityPKMode(strings.Split(identity, ";")[0], 60, string(ecCertPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrCertInvalidEC)
+	})
+
+	t.Run("OK with EdDSA enabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("SignerAlgs", "EdDSA")).ToBe(secsipid.SJWTRetOK)
+		identity, ret, _ := sign(edPrvPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(strings.Contains(identity, ";alg=EdDSA;")).ToBe(true)
+		ret, _ = secsipid.SJWTCheckIdentityPKMode(strings.Split(identity, ";")[0], 60, string(edCertPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("ErrJSONHdrAlg with algorithm not enabled", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetS("SignerAlgs", "ES256")
+		signingString := secsipid.SJWTBase64EncodeString(`{"alg":"ES384","typ":"passport"}`) + "." +
+			secsipid.SJWTBase64EncodeString(`{}`)
+		_, ret, _ := secsipid.SJWTSignWithPrvKey(signingString, ecKey)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONHdrAlg)
+	})
+
+	t.Run("OK with registered algorithm", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("SignerAlgs", "ES256,HS256")).ToBe(secsipid.SJWTRetErr)
+		secsipid.SJWTSignerAlgRegister(testAlgHS256{})
+		expect(secsipid.SJWTLibOptSetS("SignerAlgs", "ES256,HS256")).ToBe(secsipid.SJWTRetOK)
+		signingString := secsipid.SJWTBase64EncodeString(`{"alg":"HS256","typ":"passport"}`) + "." +
+			secsipid.SJWTBase64EncodeString(`{}`)
+		sig, ret, _ := secsipid.SJWTSignWithPrvKey(signingString, []byte("secret"))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		ret, _ = secsipid.SJWTVerifyWithPubKey(signingString, sig, []byte("secret"))
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		ret, _ = secsipid.SJWTVerifyWithPubKey(signingString, sig, []byte("other"))
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+	})
+}
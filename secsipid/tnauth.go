@@ -0,0 +1,45 @@
+package secsipid
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+)
+
+// TNAuthList certificate extension (RFC 8226)
+var oidTNAuthList = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 26}
+
+// SJWTGetCertSPC - the service provider code from the TNAuthList extension
+// of the leaf certificate in PEM data, empty if there is no such extension
+func SJWTGetCertSPC(certPEM []byte) (string, int, error) {
+	block, _ := pem.Decode(sjwtCertChainOrder(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", SJWTRetOK, nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", SJWTRetErrCertInvalidFormat, err
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTNAuthList) {
+			continue
+		}
+		var entries []asn1.RawValue
+		if _, err = asn1.Unmarshal(ext.Value, &entries); err != nil {
+			return "", SJWTRetErrCertInvalidFormat, err
+		}
+		for _, entry := range entries {
+			// TNEntry ::= CHOICE { spc [0] ServiceProviderCode, ... }
+			if entry.Class != asn1.ClassContextSpecific || entry.Tag != 0 {
+				continue
+			}
+			var spc string
+			if _, err = asn1.UnmarshalWithParams(entry.Bytes, &spc, "ia5"); err != nil {
+				return "", SJWTRetErrCertInvalidFormat, errors.New("invalid service provider code")
+			}
+			return spc, SJWTRetOK, nil
+		}
+	}
+	return "", SJWTRetOK, nil
+}
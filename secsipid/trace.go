@@ -0,0 +1,29 @@
+package secsipid
+
+// SJWTSpanHook - callback invoked at the start of an operation of the library
+// (e.g., fetching the certificate, validating the chain, signing, verifying),
+// with the name of the operation and its attributes; it returns the function
+// invoked at the end of the operation, with the error if it failed
+type SJWTSpanHook func(name string, attrs map[string]string) func(err error)
+
+var sjwtSpanHook SJWTSpanHook = nil
+
+// SJWTSetSpanHook - set the callback for tracing the operations, nil to disable
+func SJWTSetSpanHook(hook SJWTSpanHook) {
+	sjwtSpanHook = hook
+}
+
+func sjwtSpanNop(err error) {}
+
+// sjwtSpan - start the span for the operation, the attributes are given as
+// pairs of name and value
+func sjwtSpan(name string, attrs ...string) func(err error) {
+	if sjwtSpanHook == nil {
+		return sjwtSpanNop
+	}
+	attrMap := map[string]string{}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		attrMap[attrs[i]] = attrs[i+1]
+	}
+	return sjwtSpanHook(name, attrMap)
+}
@@ -0,0 +1,49 @@
+package secsipid_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestSpanHook(t *testing.T) {
+	prvkey, pubkey, _ := generateECKeyPEMs()
+	os.WriteFile("dummyTracePubKey.pem", pubkey, 0640)
+	defer os.Remove("dummyTracePubKey.pem")
+	secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	var spans []string
+	var failed []string
+	secsipid.SJWTSetSpanHook(func(name string, attrs map[string]string) func(err error) {
+		spans = append(spans, name)
+		return func(err error) {
+			if err != nil {
+				failed = append(failed, name)
+			}
+		}
+	})
+	defer secsipid.SJWTSetSpanHook(nil)
+
+	t.Run("OK with sign and check spans", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		spans, failed = nil, nil
+		identity, _, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "A", "", "https://certs.example.com/cert.pem", prvkey)
+		expect(spans).ToEqual([]string{"secsipid.sign"})
+
+		spans = nil
+		secsipid.SJWTCheckFullIdentity(identity, 60, "dummyTracePubKey.pem", 5)
+		expect(spans).ToEqual([]string{"secsipid.check", "secsipid.verify", "secsipid.claims"})
+		expect(len(failed)).ToBe(0)
+	})
+
+	t.Run("Failed check span", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		spans, failed = nil, nil
+		secsipid.SJWTCheckFullIdentity("invalid", 60, "dummyTracePubKey.pem", 5)
+		expect(failed).ToEqual([]string{"secsipid.check"})
+	})
+}
@@ -0,0 +1,150 @@
+package secsipid
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SJWTTrustCert - a CA certificate of the trust store, with the file (or
+// the AIA URL) it was loaded from
+type SJWTTrustCert struct {
+	Subject  string `json:"subject"`
+	Issuer   string `json:"issuer"`
+	Serial   string `json:"serial"`
+	NotAfter int64  `json:"expire"`
+	Expired  bool   `json:"expired,omitempty"`
+	Source   string `json:"source"`
+}
+
+// SJWTTrustCRL - the CRL used for the revocation checks
+type SJWTTrustCRL struct {
+	Issuer     string `json:"issuer"`
+	ThisUpdate int64  `json:"thisupdate"`
+	NextUpdate int64  `json:"nextupdate,omitempty"`
+	Revoked    int    `json:"revoked"`
+	Source     string `json:"source"`
+}
+
+// SJWTTrustStore - the trust anchors and the intermediate certificates used
+// for verifying the certificates, according to the CertVerify option
+type SJWTTrustStore struct {
+	CertVerify    int             `json:"certverify"`
+	Roots         []SJWTTrustCert `json:"roots"`
+	Intermediates []SJWTTrustCert `json:"intermediates"`
+	CRL           *SJWTTrustCRL   `json:"crl,omitempty"`
+}
+
+// sjwtTrustCerts - the certificates of the PEM data loaded from the source
+func sjwtTrustCerts(data []byte, source string) []SJWTTrustCert {
+	var certs []SJWTTrustCert
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certVal, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, sjwtTrustCert(certVal, source))
+	}
+}
+
+// sjwtTrustCert - the details of the certificate loaded from the source
+func sjwtTrustCert(certVal *x509.Certificate, source string) SJWTTrustCert {
+	return SJWTTrustCert{Subject: certVal.Subject.String(), Issuer: certVal.Issuer.String(),
+		Serial: certVal.SerialNumber.Text(16), NotAfter: certVal.NotAfter.Unix(),
+		Expired: !sjwtNow().Before(certVal.NotAfter), Source: source}
+}
+
+// sjwtTrustSystemCerts - the system CA certificates, looked up like for
+// loadSystemRoots()
+func sjwtTrustSystemCerts() []SJWTTrustCert {
+	var certs []SJWTTrustCert
+	files := certFiles
+	if f := os.Getenv(certFileEnv); f != "" {
+		files = []string{f}
+	}
+	for _, file := range files {
+		if data, err := os.ReadFile(file); err == nil {
+			certs = append(certs, sjwtTrustCerts(data, file)...)
+			break
+		}
+	}
+	dirs := certDirectories
+	if d := os.Getenv(certDirEnv); d != "" {
+		dirs = strings.Split(d, ":")
+	}
+	for _, directory := range dirs {
+		fis, err := readUniqueDirectoryEntries(directory)
+		if err != nil {
+			continue
+		}
+		for _, fi := range fis {
+			file := filepath.Join(directory, fi.Name())
+			if data, err := os.ReadFile(file); err == nil {
+				certs = append(certs, sjwtTrustCerts(data, file)...)
+			}
+		}
+	}
+	return certs
+}
+
+// SJWTGetTrustStore - the CA certificates (from the system, the CA file, the
+// intermediate CA file and fetched from the AIA URLs) and the CRL currently
+// used for verifying the certificates
+func SJWTGetTrustStore() (*SJWTTrustStore, int, error) {
+	ts := &SJWTTrustStore{CertVerify: globalLibOptions.certVerify, Roots: []SJWTTrustCert{},
+		Intermediates: []SJWTTrustCert{}}
+	if (globalLibOptions.certVerify & CertVerifyOptSysCA) != 0 {
+		ts.Roots = append(ts.Roots, sjwtTrustSystemCerts()...)
+	}
+	if (globalLibOptions.certVerify&CertVerifyOptCustCA) != 0 && len(globalLibOptions.certCAFile) > 0 {
+		data, err := os.ReadFile(globalLibOptions.certCAFile)
+		if err != nil {
+			return nil, SJWTRetErrCertReadCAFile, errors.New("failed to read CA file")
+		}
+		ts.Roots = append(ts.Roots, sjwtTrustCerts(data, globalLibOptions.certCAFile)...)
+	}
+	if (globalLibOptions.certVerify&CertVerifyOptInterCA) != 0 && len(globalLibOptions.certCAInter) > 0 {
+		data, err := os.ReadFile(globalLibOptions.certCAInter)
+		if err != nil {
+			return nil, SJWTRetErrCertReadCAInter, errors.New("failed to read intermediate CA file")
+		}
+		ts.Intermediates = append(ts.Intermediates, sjwtTrustCerts(data, globalLibOptions.certCAInter)...)
+	}
+	aiaCache.Lock()
+	aiaURLs := make([]string, 0, len(aiaCache.certs))
+	for urlVal := range aiaCache.certs {
+		aiaURLs = append(aiaURLs, urlVal)
+	}
+	sort.Strings(aiaURLs)
+	for _, urlVal := range aiaURLs {
+		for _, certVal := range aiaCache.certs[urlVal] {
+			ts.Intermediates = append(ts.Intermediates, sjwtTrustCert(certVal, urlVal))
+		}
+	}
+	aiaCache.Unlock()
+
+	if (globalLibOptions.certVerify&CertVerifyOptCRL) != 0 && len(globalLibOptions.certCRLFile) > 0 {
+		if ret, err := sjwtCRLRefresh(false); err != nil {
+			return nil, ret, err
+		}
+		crlIndex.RLock()
+		ts.CRL = &SJWTTrustCRL{Issuer: crlIndex.info.issuer, ThisUpdate: crlIndex.info.thisUpdate.Unix(),
+			Revoked: len(crlIndex.serials), Source: crlIndex.path}
+		if !crlIndex.info.nextUpdate.IsZero() {
+			ts.CRL.NextUpdate = crlIndex.info.nextUpdate.Unix()
+		}
+		crlIndex.RUnlock()
+	}
+	return ts, SJWTRetOK, nil
+}
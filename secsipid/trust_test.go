@@ -0,0 +1,69 @@
+package secsipid_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestGetTrustStore(t *testing.T) {
+	root, rootKey := generateAIACert(&x509.Certificate{SerialNumber: big.NewInt(7), Subject: pkix.Name{CommonName: "Trust Root"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().AddDate(1, 0, 0), IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign}, nil, nil)
+	nextUpdate := time.Now().AddDate(0, 0, 7).Truncate(time.Second)
+	revoked := []pkix.RevokedCertificate{{SerialNumber: big.NewInt(100), RevocationTime: time.Now()}}
+	der, _ := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{Number: big.NewInt(1),
+		RevokedCertificates: revoked, ThisUpdate: time.Now(), NextUpdate: nextUpdate}, root, rootKey)
+	os.WriteFile("dummyTrustRoot.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0640)
+	os.WriteFile("dummyTrust.crl", der, 0640)
+	defer os.Remove("dummyTrustRoot.pem")
+	defer os.Remove("dummyTrust.crl")
+	secsipid.SJWTLibOptSetS("CertCAFile", "dummyTrustRoot.pem")
+	defer secsipid.SJWTLibOptSetS("CertCAFile", "")
+	secsipid.SJWTLibOptSetS("CertCRLFile", "dummyTrust.crl")
+	defer secsipid.SJWTLibOptSetS("CertCRLFile", "")
+	defer secsipid.SJWTLibOptSetN("CertVerify", 0)
+
+	t.Run("OK empty without certificate verification", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertVerify", 0)
+		ts, ret, _ := secsipid.SJWTGetTrustStore()
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(ts.Roots)).ToBe(0)
+		expect(ts.CRL == nil).ToBe(true)
+	})
+
+	t.Run("OK with custom CA and CRL files", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA|secsipid.CertVerifyOptCRL)
+		ts, ret, _ := secsipid.SJWTGetTrustStore()
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(len(ts.Roots)).ToBe(1)
+		expect(ts.Roots[0].Subject).ToBe("CN=Trust Root")
+		expect(ts.Roots[0].Source).ToBe("dummyTrustRoot.pem")
+		expect(ts.Roots[0].Expired).ToBe(false)
+		expect(ts.CRL.Issuer).ToBe("CN=Trust Root")
+		expect(ts.CRL.Revoked).ToBe(1)
+		expect(ts.CRL.NextUpdate).ToBe(nextUpdate.Unix())
+		expect(ts.CRL.Source).ToBe("dummyTrust.crl")
+	})
+
+	t.Run("ErrCertReadCAFile with missing CA file", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		secsipid.SJWTLibOptSetN("CertVerify", secsipid.CertVerifyOptCustCA)
+		secsipid.SJWTLibOptSetS("CertCAFile", "dummyTrustMissing.pem")
+		_, ret, _ := secsipid.SJWTGetTrustStore()
+		expect(ret).ToBe(secsipid.SJWTRetErrCertReadCAFile)
+	})
+}
@@ -0,0 +1,80 @@
+package secsipid
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// thumbprint added to the header of the signed PASSporTs
+var signX5t = struct {
+	sync.RWMutex
+	value string
+}{}
+
+// SJWTCertThumbprint - the x5t#S256 thumbprint of the certificate, being the
+// base64url encoded SHA-256 digest of the DER of the leaf certificate
+func SJWTCertThumbprint(certPEM []byte) (string, int, error) {
+	block, _ := pem.Decode(sjwtCertChainOrder(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", SJWTRetErrCertInvalidFormat, errors.New("certificate must be PEM encoded")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return SJWTBase64EncodeBytes(sum[:]), SJWTRetOK, nil
+}
+
+// SJWTX5tLoad - load the certificate whose thumbprint is added as x5t#S256 to
+// the header when signing, the empty path disables it
+func SJWTX5tLoad(filePath string) (int, error) {
+	value := ""
+	if len(filePath) > 0 {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return SJWTRetErrFileRead, err
+		}
+		var ret int
+		if value, ret, err = SJWTCertThumbprint(data); err != nil {
+			return ret, err
+		}
+	}
+	signX5t.Lock()
+	signX5t.value = value
+	signX5t.Unlock()
+	return SJWTRetOK, nil
+}
+
+// sjwtSignX5t - the thumbprint to add to the header when signing
+func sjwtSignX5t() string {
+	signX5t.RLock()
+	defer signX5t.RUnlock()
+	return signX5t.value
+}
+
+// sjwtCheckThumbprint - check the x5t#S256 of the header, if present, against
+// the certificate used to verify the signature
+func sjwtCheckThumbprint(base64Header string, certPEM []byte) (int, error) {
+	headerJSON, err := SJWTBase64DecodeBytes(base64Header)
+	if err != nil {
+		return SJWTRetErrJSONHdrParse, err
+	}
+	header := SJWTHeader{}
+	if err = json.Unmarshal(headerJSON, &header); err != nil {
+		return SJWTRetErrJSONHdrParse, err
+	}
+	if len(header.X5tS256) == 0 {
+		return SJWTRetOK, nil
+	}
+	thumbprint, ret, err := SJWTCertThumbprint(certPEM)
+	if err != nil {
+		return ret, err
+	}
+	if thumbprint != header.X5tS256 {
+		return SJWTRetErrJSONHdrX5t, fmt.Errorf("mismatching x5t#S256 thumbprint - header (%s) certificate (%s)",
+			header.X5tS256, thumbprint)
+	}
+	return SJWTRetOK, nil
+}
@@ -0,0 +1,99 @@
+package secsipid_test
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestX5tThumbprint(t *testing.T) {
+	template := func(serial int64) *x509.Certificate {
+		return &x509.Certificate{SerialNumber: big.NewInt(serial), Subject: pkix.Name{CommonName: "Thumbprint Signer"},
+			NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	}
+	cert, key := generateAIACert(template(1), nil, nil)
+	other, _ := generateAIACert(template(2), nil, nil)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	otherPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.Raw})
+	prvBytes, _ := x509.MarshalECPrivateKey(key)
+	prvkey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes})
+
+	os.WriteFile("dummyThumbprint.pem", certPEM, 0640)
+	defer os.Remove("dummyThumbprint.pem")
+
+	sign := func() string {
+		identity, _, _ := secsipid.SJWTGetIdentityPayloadPrvKey(secsipid.SJWTPayload{ATTest: "A",
+			Dest: secsipid.SJWTDest{TN: []string{"493022222222"}}, Orig: secsipid.SJWTOrig{TN: "493011111111"}},
+			"https://certs.example.com/cert.pem", prvkey)
+		return strings.Split(identity, ";")[0]
+	}
+	headerOf := func(token string) string {
+		header, _ := secsipid.SJWTBase64DecodeString(strings.Split(token, ".")[0])
+		return header
+	}
+
+	t.Run("OK with thumbprint of the certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		sum := sha256.Sum256(cert.Raw)
+		thumbprint, ret, _ := secsipid.SJWTCertThumbprint(certPEM)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(thumbprint).ToBe(base64.RawURLEncoding.EncodeToString(sum[:]))
+	})
+
+	t.Run("OK without thumbprint in header", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		token := sign()
+		expect(strings.Contains(headerOf(token), "x5t#S256")).ToBe(false)
+		ret, _ := secsipid.SJWTCheckIdentityPKMode(token, 60, string(otherPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONSignatureInvalid)
+		ret, _ = secsipid.SJWTCheckIdentityPKMode(token, 60, string(certPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+	})
+
+	t.Run("OK with matching thumbprint added when signing", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("X5tCertFile", "dummyThumbprint.pem")).ToBe(secsipid.SJWTRetOK)
+		defer secsipid.SJWTLibOptSetS("X5tCertFile", "")
+		thumbprint, _, _ := secsipid.SJWTCertThumbprint(certPEM)
+		token := sign()
+		expect(strings.Contains(headerOf(token), `"x5t#S256":"`+thumbprint+`"`)).ToBe(true)
+		ret, err := secsipid.SJWTCheckIdentityPKMode(token, 60, string(certPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		expect(err).ToBe(nil)
+	})
+
+	t.Run("ErrJSONHdrX5t with thumbprint of other certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		thumbprint, _, _ := secsipid.SJWTCertThumbprint(otherPEM)
+		header := `{"alg":"ES256","ppt":"shaken","typ":"passport","x5u":"https://certs.example.com/cert.pem","x5t#S256":"` +
+			thumbprint + `"}`
+		payload := `{"attest":"A","dest":{"tn":["493022222222"]},"iat":` + strconv.FormatInt(time.Now().Unix(), 10) +
+			`,"orig":{"tn":"493011111111"},"origid":"abc"}`
+		token, _, _ := secsipid.SJWTEncodeTextWithPrvKey(header, payload, string(prvkey))
+		ret, err := secsipid.SJWTCheckIdentityPKMode(token, 60, string(certPEM), 1, 5)
+		expect(ret).ToBe(secsipid.SJWTRetErrJSONHdrX5t)
+		expect(strings.Contains(err.Error(), thumbprint)).ToBe(true)
+	})
+
+	t.Run("ErrFileRead with missing certificate", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(secsipid.SJWTLibOptSetS("X5tCertFile", "dummyThumbprintMissing.pem")).ToBe(secsipid.SJWTRetErrFileRead)
+		expect(secsipid.SJWTLibOptGetS("X5tCertFile")).ToBe("")
+	})
+}
@@ -0,0 +1,66 @@
+package secsipid
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+)
+
+// SJWTKeyID - the identifier of the signing key, made of the first 16 hex
+// digits of the SHA-256 digest of its DER encoded public key
+func SJWTKeyID(prvkeyData []byte) (string, int, error) {
+	prvKey, ret, err := SJWTParsePrivateKeyFromPEM(prvkeyData)
+	if err != nil {
+		return "", ret, err
+	}
+	return sjwtKeyID(prvKey.(crypto.Signer).Public())
+}
+
+// SJWTPubKeyID - the identifier of the signing key, given the public key or
+// the certificate (PEM format)
+func SJWTPubKeyID(pubkeyData []byte) (string, int, error) {
+	pubKey, ret, err := SJWTParsePublicKeyFromPEM(pubkeyData)
+	if err != nil {
+		return "", ret, err
+	}
+	return sjwtKeyID(pubKey)
+}
+
+func sjwtKeyID(pubkey interface{}) (string, int, error) {
+	der, err := x509.MarshalPKIXPublicKey(pubkey)
+	if err != nil {
+		return "", SJWTRetErrCertInvalidEC, err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), SJWTRetOK, nil
+}
+
+// SJWTResolveX5u - replace the variables of the x5u template, given as
+// {name}, with their values; the unknown variables are kept
+func SJWTResolveX5u(x5uTmpl string, vars map[string]string) string {
+	if !strings.Contains(x5uTmpl, "{") {
+		return x5uTmpl
+	}
+	for name, value := range vars {
+		x5uTmpl = strings.ReplaceAll(x5uTmpl, "{"+name+"}", value)
+	}
+	return x5uTmpl
+}
+
+// SJWTSignX5u - the x5u value for signing the token with the private key,
+// resolving the template variables {spc}, {keyid}, {ppt} and {attest}
+func SJWTSignX5u(x5uVal string, prvkeyData []byte, ppt string, attest string) string {
+	if len(x5uVal) == 0 {
+		x5uVal = globalLibOptions.x5u
+	}
+	if !strings.Contains(x5uVal, "{") {
+		return x5uVal
+	}
+	vars := map[string]string{"spc": globalLibOptions.spc, "ppt": ppt, "attest": attest}
+	if keyID, _, err := SJWTKeyID(prvkeyData); err == nil {
+		vars["keyid"] = keyID
+	}
+	return SJWTResolveX5u(x5uVal, vars)
+}
@@ -0,0 +1,41 @@
+package secsipid_test
+
+import (
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestSignX5u(t *testing.T) {
+	prvkey, _, _ := generateECKeyPEMs()
+	keyID, _, _ := secsipid.SJWTKeyID(prvkey)
+	secsipid.SJWTLibOptSetS("SPC", "1234")
+	defer secsipid.SJWTLibOptSetS("SPC", "")
+
+	t.Run("OK with key id of 16 hex digits", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		expect(len(keyID)).ToBe(16)
+		otherkey, _, _ := generateECKeyPEMs()
+		otherID, _, _ := secsipid.SJWTKeyID(otherkey)
+		expect(otherID != keyID).ToBe(true)
+	})
+
+	t.Run("OK with resolved template", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, ret, _ := secsipid.SJWTGetIdentityPrvKey("493011111111", "493022222222", "B", "", "https://certs.example.com/{spc}/{keyid}-{attest}.pem", prvkey)
+		expect(ret).ToBe(secsipid.SJWTRetOK)
+		parts, _, _ := secsipid.SJWTParseIdentityParts(identity)
+		expect(parts.Header.X5u).ToBe("https://certs.example.com/1234/" + keyID + "-B.pem")
+		expect(parts.Info).ToBe(parts.Header.X5u)
+	})
+
+	t.Run("OK with unknown variable kept", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		x5u := secsipid.SJWTResolveX5u("https://certs.example.com/{spc}/{other}.pem", map[string]string{"spc": "1234"})
+		expect(x5u).ToBe("https://certs.example.com/1234/{other}.pem")
+	})
+}
@@ -0,0 +1,150 @@
+// Package secsipidclient provides a client for the HTTP API of the secsipidx
+// daemon, to sign and check the Identity header values.
+package secsipidclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SignRequest - the attributes of the call to sign
+type SignRequest struct {
+	OrigTN string `json:"origtn"`
+	DestTN string `json:"desttn"`
+	Attest string `json:"attest"`
+	OrigID string `json:"origid,omitempty"`
+	X5u    string `json:"x5u,omitempty"`
+	Mky    string `json:"mky,omitempty"`
+}
+
+// Error - error returned by the daemon, with the error identifier, the
+// return code of the library and the failed check
+type Error struct {
+	Status  int    `json:"-"`
+	ID      string `json:"error"`
+	Code    int    `json:"code"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message"`
+	Check   string `json:"check,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code: %d): %s", e.ID, e.Code, e.Message)
+}
+
+// Client - client for the secsipidx daemon, safe for concurrent use; the
+// connections to the daemon are kept alive and reused
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// APIKey - value for X-API-Key header, if not empty
+	APIKey string
+	// Retries - number of times the request is retried on connection errors
+	// and when the daemon is unavailable
+	Retries int
+	// RetryWait - duration to wait before retrying the request
+	RetryWait time.Duration
+}
+
+// NewClient - baseURL is the address of the daemon, like 'http://127.0.0.1:8090',
+// and timeout is the limit for each request (in seconds)
+func NewClient(baseURL string, timeout int) (*Client, error) {
+	if !strings.HasPrefix(baseURL, "https://") && !strings.HasPrefix(baseURL, "http://") {
+		return nil, fmt.Errorf("invalid daemon url: %s", baseURL)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 100
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: time.Duration(timeout) * time.Second, Transport: transport},
+		Retries:    2,
+		RetryWait:  100 * time.Millisecond,
+	}, nil
+}
+
+// retryStatus - true if the request can be retried for the response status
+func retryStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+func (c *Client) do(path string, body interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		if i > 0 {
+			time.Sleep(c.RetryWait)
+		}
+		req, err := http.NewRequest("POST", c.baseURL+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if len(c.APIKey) > 0 {
+			req.Header.Set("X-API-Key", c.APIKey)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if i < c.Retries {
+				continue
+			}
+			return fmt.Errorf("request failure: %v", err)
+		}
+		rdata, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("read body failure: %v", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			if err = json.Unmarshal(rdata, result); err != nil {
+				return fmt.Errorf("invalid response: %v", err)
+			}
+			return nil
+		}
+		if retryStatus(resp.StatusCode) && i < c.Retries {
+			continue
+		}
+		errResp := &Error{Status: resp.StatusCode}
+		if json.Unmarshal(rdata, errResp) != nil || len(errResp.ID) == 0 {
+			return fmt.Errorf("status error: %v", resp.StatusCode)
+		}
+		return errResp
+	}
+}
+
+// Sign - get the Identity header value for the call
+func (c *Client) Sign(signReq *SignRequest) (string, error) {
+	result := struct {
+		Identity string `json:"identity"`
+	}{}
+	if err := c.do("/v1/sign-csv", signReq, &result); err != nil {
+		return "", err
+	}
+	return result.Identity, nil
+}
+
+// Check - verify the Identity header value, returning the code of the library
+// (0 if valid); for failed checks, the error is of type *Error
+func (c *Client) Check(identityVal string) (int, error) {
+	result := struct {
+		Result string `json:"result"`
+		Code   int    `json:"code"`
+	}{}
+	err := c.do("/v1/check", map[string]string{"identity": identityVal}, &result)
+	if err != nil {
+		if errResp, ok := err.(*Error); ok {
+			return errResp.Code, err
+		}
+		return -1, err
+	}
+	return result.Code, nil
+}
@@ -0,0 +1,64 @@
+package secsipidclient_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipidclient"
+	"github.com/gomagedon/expectate"
+)
+
+func TestClient(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/v1/sign-csv":
+			signReq := secsipidclient.SignRequest{}
+			json.NewDecoder(r.Body).Decode(&signReq)
+			w.Write([]byte(`{"identity":"` + signReq.OrigTN + `.` + signReq.DestTN + `"}`))
+		case "/v1/check":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"check_failed","code":-232,"message":"expired token","check":"freshness"}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	client, _ := secsipidclient.NewClient(srv.URL, 5)
+	client.RetryWait = 0
+
+	t.Run("OK with sign", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		identity, err := client.Sign(&secsipidclient.SignRequest{OrigTN: "493011111111", DestTN: "493022222222", Attest: "A"})
+		expect(err).ToBe(nil)
+		expect(identity).ToBe("493011111111.493022222222")
+	})
+
+	t.Run("Error with failed check", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		ret, err := client.Check("eyJhbGciOiJFUzI1NiIs")
+		expect(ret).ToBe(-232)
+		errResp, ok := err.(*secsipidclient.Error)
+		expect(ok).ToBe(true)
+		expect(errResp.ID).ToBe("check_failed")
+		expect(errResp.Check).ToBe("freshness")
+	})
+
+	t.Run("Retries when unavailable", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		down, _ := secsipidclient.NewClient(srv.URL+"/down", 5)
+		down.RetryWait = 0
+
+		calls = 0
+		_, err := down.Sign(&secsipidclient.SignRequest{})
+		expect(err).NotToBe(nil)
+		expect(calls).ToBe(3)
+	})
+}
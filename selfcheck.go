@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// SelfCheckResult - the result of signing a synthetic identity with the
+// active key and verifying it with the certificate fetched from its x5u
+type SelfCheckResult struct {
+	OK       bool   `json:"ok"`
+	Code     int    `json:"code"`
+	Error    string `json:"error,omitempty"`
+	X5u      string `json:"x5u"`
+	Time     int64  `json:"time"`
+	Duration int64  `json:"duration"`
+	Failures int    `json:"failures"`
+}
+
+var (
+	selfCheckMu   sync.Mutex
+	selfCheckLast *SelfCheckResult
+)
+
+// selfCheckFetch - fetch the certificate without using the cache, to detect
+// immediately the failures of the publication
+func selfCheckFetch(x5u string) ([]byte, int, error) {
+	client := http.Client{Timeout: time.Duration(cliops.timeout) * time.Second}
+	resp, err := client.Get(x5u)
+	if err != nil {
+		return nil, secsipid.SJWTRetErrHTTPGet, fmt.Errorf("http get failure: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, secsipid.SJWTRetErrHTTPStatusCode, fmt.Errorf("http status error: %v", resp.StatusCode)
+	}
+	cert, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, secsipid.SJWTRetErrHTTPReadBody, fmt.Errorf("read http body failure: %v", err)
+	}
+	return cert, secsipid.SJWTRetOK, nil
+}
+
+// selfCheckRun - sign the synthetic identity and verify it
+func selfCheckRun() *SelfCheckResult {
+	start := time.Now()
+	result := &SelfCheckResult{Time: start.Unix()}
+	ret, err := func() (int, error) {
+		prvkey, err := secsipid.SJWTReadPrvKey(signPrvKey())
+		if err != nil {
+			return secsipid.SJWTRetErrFileRead, err
+		}
+		identityVal, ret, err := secsipid.SJWTGetIdentityPrvKey("10000000000", "10000000000", "A", "self-check", cliops.x5u, prvkey)
+		if err != nil {
+			return ret, err
+		}
+		parts, ret, err := secsipid.SJWTParseIdentityParts(identityVal)
+		if err != nil {
+			return ret, err
+		}
+		result.X5u = parts.Info
+		cert, ret, err := selfCheckFetch(parts.Info)
+		if err != nil {
+			return ret, err
+		}
+		return secsipid.SJWTCheckFullIdentityPubKey(identityVal, cliops.expire, string(cert))
+	}()
+	result.Code = ret
+	result.OK = err == nil && ret == secsipid.SJWTRetOK
+	if err != nil {
+		result.Error = err.Error()
+	} else if ret != secsipid.SJWTRetOK {
+		result.Error = fmt.Sprintf("check failed with code %d", ret)
+	}
+	result.Duration = time.Since(start).Milliseconds()
+	return result
+}
+
+// selfCheckStart - run the self-check periodically in daemon mode
+func selfCheckStart(interval int) {
+	go func() {
+		for {
+			result := selfCheckRun()
+			selfCheckMu.Lock()
+			if !result.OK {
+				if selfCheckLast != nil {
+					result.Failures = selfCheckLast.Failures
+				}
+				result.Failures++
+				log.Printf("self-check failed for x5u %s (code: %d, error: %s)", result.X5u, result.Code, result.Error)
+			} else if selfCheckLast != nil && !selfCheckLast.OK {
+				log.Printf("self-check ok again for x5u %s", result.X5u)
+			}
+			selfCheckLast = result
+			selfCheckMu.Unlock()
+			time.Sleep(time.Duration(interval) * time.Second)
+		}
+	}()
+}
+
+// selfCheckResult - the result of the last self-check, nil if not run yet
+func selfCheckResult() *SelfCheckResult {
+	selfCheckMu.Lock()
+	defer selfCheckMu.Unlock()
+	return selfCheckLast
+}
+
+// httpHandleV1SelfCheck - GET /v1/self-check for the result of the last
+// self-check, with status 503 if it failed
+func httpHandleV1SelfCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	result := selfCheckResult()
+	if result == nil {
+		httpError(w, http.StatusServiceUnavailable, httpErrUnavailable, secsipid.SJWTRetErr, "self-check not run yet")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !result.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// selfCheckWriteMetrics - the result of the last self-check in the
+// Prometheus text format
+func selfCheckWriteMetrics(w http.ResponseWriter) {
+	result := selfCheckResult()
+	if result == nil {
+		return
+	}
+	ok := 0
+	if result.OK {
+		ok = 1
+	}
+	fmt.Fprintf(w, "# HELP secsipidx_self_check_ok Result of the last self-check (1 - ok, 0 - failed).\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_self_check_ok gauge\nsecsipidx_self_check_ok %d\n", ok)
+	fmt.Fprintf(w, "# HELP secsipidx_self_check_timestamp_seconds Time of the last self-check.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_self_check_timestamp_seconds gauge\nsecsipidx_self_check_timestamp_seconds %d\n", result.Time)
+	fmt.Fprintf(w, "# HELP secsipidx_self_check_failures Consecutive failures of the self-check.\n")
+	fmt.Fprintf(w, "# TYPE secsipidx_self_check_failures gauge\nsecsipidx_self_check_failures %d\n", result.Failures)
+}
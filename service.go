@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// signalWait - wait for the http services to fail or for the termination
+// signal, returning the exit code
+func signalWait(errchan chan error) int {
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
+	sdNotifyReady()
+	select {
+	case err := <-errchan:
+		log.Printf("unable to start http services due to (error: %v)", err)
+		return 1
+	case sig := <-sigchan:
+		log.Printf("stopping http services on signal: %v", sig)
+		sdNotify("STOPPING=1")
+		return 0
+	}
+}
+
+func secsipidxCLIService() int {
+	switch cliops.serviceop {
+	case "install", "remove", "start", "stop":
+	default:
+		fmt.Printf("invalid service action: %s (install, remove, start or stop)\n", cliops.serviceop)
+		return cliExitArgs
+	}
+	var args []string
+	if len(cliops.subargs) > 1 {
+		args = cliops.subargs[1:]
+	}
+	if err := serviceControl(cliops.serviceop, cliops.servicename, args); err != nil {
+		fmt.Printf("service %s failed: %v\n", cliops.serviceop, err)
+		return -1
+	}
+	fmt.Printf("service %s: %s done\n", cliops.servicename, cliops.serviceop)
+	return 0
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+// serviceWait - wait for the http services to stop
+func serviceWait(errchan chan error) int {
+	return signalWait(errchan)
+}
+
+// serviceControl - the service manager is available only on Windows, the
+// other platforms use their init system (e.g., systemd)
+func serviceControl(action string, name string, args []string) error {
+	return errors.New("windows service is not supported on this platform")
+}
@@ -0,0 +1,97 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// winService - handler of the requests from the Windows service manager
+type winService struct {
+	errchan chan error
+}
+
+// Execute - run until the service is stopped or the http services fail
+func (ws *winService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-ws.errchan:
+			log.Printf("unable to start http services due to (error: %v)", err)
+			changes <- svc.Status{State: svc.StopPending}
+			return false, 1
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				return false, 0
+			}
+		}
+	}
+}
+
+// serviceWait - wait for the http services to stop, under the control of the
+// service manager when started as Windows service
+func serviceWait(errchan chan error) int {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return signalWait(errchan)
+	}
+	if err = svc.Run(cliops.servicename, &winService{errchan: errchan}); err != nil {
+		log.Printf("windows service failed (error: %v)", err)
+		return 1
+	}
+	return 0
+}
+
+// serviceControl - install, remove, start or stop the Windows service, the
+// installed service runs the serve subcommand with the given options
+func serviceControl(action string, name string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if action == "install" {
+		exePath, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		s, err := m.CreateService(name, exePath, mgr.Config{
+			DisplayName: "secsipidx",
+			Description: "STIR/SHAKEN identity signing and verification service",
+			StartType:   mgr.StartAutomatic,
+		}, append([]string{"serve", "-service-name", name}, args...)...)
+		if err != nil {
+			return err
+		}
+		s.Close()
+		return nil
+	}
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	switch action {
+	case "remove":
+		return s.Delete()
+	case "start":
+		return s.Start()
+	case "stop":
+		_, err = s.Control(svc.Stop)
+		return err
+	}
+	return fmt.Errorf("invalid service action: %s", action)
+}
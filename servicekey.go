@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// serviceKeyPath - the path to the key for the signatures which are not
+// PASSporTs (verdicts, CPS requests): the dedicated one if set, otherwise
+// the service key
+func serviceKeyPath(dedicated string) string {
+	if len(dedicated) > 0 {
+		return dedicated
+	}
+	return cliops.servicekey
+}
+
+// serviceX5u - the x5u for the signatures with the service key, the
+// dedicated one if set
+func serviceX5u(dedicated string) string {
+	if len(dedicated) > 0 {
+		return dedicated
+	}
+	return cliops.servicex5u
+}
+
+// stiKeyPaths - the paths to the STI keys for signing the PASSporTs
+func stiKeyPaths() []string {
+	paths := []string{cliops.fprvkey, cliops.fprvkeynext}
+	if keyring != nil {
+		for _, key := range keyring.Keys {
+			paths = append(paths, key.PrvKey)
+		}
+	}
+	return paths
+}
+
+// serviceKeyCheck - check that the service key is not one of the STI keys,
+// these being allowed by the CA policy only for signing the PASSporTs
+func serviceKeyCheck(prvkeyPath string) error {
+	if len(prvkeyPath) == 0 {
+		return nil
+	}
+	prvkey, err := secsipid.SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return err
+	}
+	keyID, _, err := secsipid.SJWTKeyID(prvkey)
+	if err != nil {
+		return fmt.Errorf("invalid service key %s: %v", prvkeyPath, err)
+	}
+	for _, stiPath := range stiKeyPaths() {
+		if len(stiPath) == 0 {
+			continue
+		}
+		stiKey, err := secsipid.SJWTReadPrvKey(stiPath)
+		if err != nil {
+			continue
+		}
+		if stiKeyID, _, err := secsipid.SJWTKeyID(stiKey); err == nil && stiKeyID == keyID {
+			return fmt.Errorf("service key %s is the STI signing key %s", prvkeyPath, stiPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// result value of the checks that could not be performed, when soft-fail is
+// enabled
+const checkResultUnavailable = "UNAVAILABLE"
+
+// checkUnavailable - true if soft-fail is enabled and the identity could not
+// be verified because of an infrastructure error (e.g., certificate repository
+// down), instead of failing the verification
+func checkUnavailable(ret int) bool {
+	return cliops.softfail && secsipid.SJWTRetIsUnavailable(ret)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// statsOtherClient - the client name used for the requests of the clients
+// above the maximum number of tracked clients
+const statsOtherClient = "other"
+
+// ClientStats - the volumes of the sign and check requests of a client
+type ClientStats struct {
+	Sign          uint64  `json:"sign"`
+	SignFailed    uint64  `json:"signfailed"`
+	SignFailRate  float64 `json:"signfailrate"`
+	Check         uint64  `json:"check"`
+	CheckFailed   uint64  `json:"checkfailed"`
+	CheckFailRate float64 `json:"checkfailrate"`
+	LastSeen      string  `json:"lastseen"`
+	lastSeen      time.Time
+}
+
+// StatsResult - JSON response of the stats endpoint
+type StatsResult struct {
+	Since  string                  `json:"since"`
+	IP     map[string]*ClientStats `json:"ip"`
+	APIKey map[string]*ClientStats `json:"apikey"`
+	Tenant map[string]*ClientStats `json:"tenant"`
+}
+
+// StatsStore - the statistics per source IP, per API key and per tenant
+type StatsStore struct {
+	mu         sync.Mutex
+	since      time.Time
+	maxClients int
+	byIP       map[string]*ClientStats
+	byAPIKey   map[string]*ClientStats
+	byTenant   map[string]*ClientStats
+}
+
+var statsStore *StatsStore
+
+// NewStatsStore - create the store, tracking up to maxClients per client
+// type (0 - no limit)
+func NewStatsStore(maxClients int) *StatsStore {
+	return &StatsStore{
+		since:      time.Now(),
+		maxClients: maxClients,
+		byIP:       make(map[string]*ClientStats),
+		byAPIKey:   make(map[string]*ClientStats),
+		byTenant:   make(map[string]*ClientStats),
+	}
+}
+
+// statsAPIKeyID - the API key is not exposed, but its SHA-256 fingerprint
+func statsAPIKeyID(apikey string) string {
+	sum := sha256.Sum256([]byte(apikey))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+func (st *StatsStore) client(clients map[string]*ClientStats, name string) *ClientStats {
+	cs, ok := clients[name]
+	if ok {
+		return cs
+	}
+	if st.maxClients > 0 && len(clients) >= st.maxClients {
+		name = statsOtherClient
+		if cs, ok = clients[name]; ok {
+			return cs
+		}
+	}
+	cs = &ClientStats{}
+	clients[name] = cs
+	return cs
+}
+
+// Add - count the request of the operation (sign or check) for the source IP,
+// the API key and the tenant (if provided)
+func (st *StatsStore) Add(op string, srcIP string, apikey string, tenant string, failed bool) {
+	now := time.Now()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	clients := []*ClientStats{st.client(st.byIP, srcIP)}
+	if len(apikey) > 0 {
+		clients = append(clients, st.client(st.byAPIKey, statsAPIKeyID(apikey)))
+	}
+	if len(tenant) > 0 {
+		clients = append(clients, st.client(st.byTenant, tenant))
+	}
+	for _, cs := range clients {
+		cs.lastSeen = now
+		switch op {
+		case "sign":
+			cs.Sign++
+			if failed {
+				cs.SignFailed++
+			}
+		case "check":
+			cs.Check++
+			if failed {
+				cs.CheckFailed++
+			}
+		}
+	}
+}
+
+func statsFailRate(failed uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
+
+func statsCopy(clients map[string]*ClientStats) map[string]*ClientStats {
+	out := make(map[string]*ClientStats, len(clients))
+	for name, cs := range clients {
+		c := *cs
+		c.SignFailRate = statsFailRate(c.SignFailed, c.Sign)
+		c.CheckFailRate = statsFailRate(c.CheckFailed, c.Check)
+		c.LastSeen = c.lastSeen.UTC().Format(time.RFC3339)
+		out[name] = &c
+	}
+	return out
+}
+
+// Snapshot - a copy of the statistics, with the failure rates
+func (st *StatsStore) Snapshot() *StatsResult {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return &StatsResult{
+		Since:  st.since.UTC().Format(time.RFC3339),
+		IP:     statsCopy(st.byIP),
+		APIKey: statsCopy(st.byAPIKey),
+		Tenant: statsCopy(st.byTenant),
+	}
+}
+
+// Reset - clear the statistics
+func (st *StatsStore) Reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.since = time.Now()
+	st.byIP = make(map[string]*ClientStats)
+	st.byAPIKey = make(map[string]*ClientStats)
+	st.byTenant = make(map[string]*ClientStats)
+}
+
+// httpStatsHandler - count the requests of the operation for the client,
+// the request failed if the response status is not 2xx
+func httpStatsHandler(op string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if statsStore == nil || r.Method == "OPTIONS" {
+			h(w, r)
+			return
+		}
+		sw := &httpStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r)
+		srcIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			srcIP = r.RemoteAddr
+		}
+		tenantID := ""
+		if tenant := httpTenant(r); tenant != nil {
+			tenantID = tenant.ID
+		}
+		statsStore.Add(op, srcIP, r.Header.Get("X-API-Key"), tenantID, sw.status < 200 || sw.status >= 300)
+	}
+}
+
+// httpHandleV1Stats - GET /v1/stats for the statistics per client, DELETE
+// /v1/stats to reset them
+func httpHandleV1Stats(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statsStore.Snapshot())
+	case "DELETE":
+		httpLogf(r, "resetting the statistics\n")
+		statsStore.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+	}
+}
+
+func statsWriteMetric(w http.ResponseWriter, name string, clientType string, clients map[string]*ClientStats,
+	value func(cs *ClientStats) uint64) {
+	names := make([]string, 0, len(clients))
+	for name := range clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, client := range names {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, clientType, client, value(clients[client]))
+	}
+}
+
+// statsWriteMetrics - the statistics per client in the Prometheus text format,
+// with the names of the counter families without suffix for OpenMetrics
+func statsWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	stats := statsStore.Snapshot()
+	metrics := []struct {
+		Name  string
+		Help  string
+		Value func(cs *ClientStats) uint64
+	}{
+		{"secsipidx_sign_requests_total", "Sign requests per client.", func(cs *ClientStats) uint64 { return cs.Sign }},
+		{"secsipidx_sign_failures_total", "Failed sign requests per client.", func(cs *ClientStats) uint64 { return cs.SignFailed }},
+		{"secsipidx_check_requests_total", "Check requests per client.", func(cs *ClientStats) uint64 { return cs.Check }},
+		{"secsipidx_check_failures_total", "Failed check requests per client.", func(cs *ClientStats) uint64 { return cs.CheckFailed }},
+	}
+	for _, m := range metrics {
+		family := m.Name
+		if openMetrics {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, m.Help, family)
+		statsWriteMetric(w, m.Name, "ip", stats.IP, m.Value)
+		statsWriteMetric(w, m.Name, "apikey", stats.APIKey, m.Value)
+		statsWriteMetric(w, m.Name, "tenant", stats.Tenant, m.Value)
+	}
+}
+
+// fetchWriteMetrics - the counters of the fetches of the URL contents and of
+// the requests served by a fetch in progress in the Prometheus text format
+func fetchWriteMetrics(w http.ResponseWriter, openMetrics bool) {
+	stats := secsipid.SJWTFetchGetStats()
+	for _, m := range []struct {
+		Name  string
+		Help  string
+		Value uint64
+	}{
+		{"secsipidx_fetches_total", "Fetches of certificates and other URL contents.", stats.Fetches},
+		{"secsipidx_fetches_shared_total", "Requests for a URL served by the fetch in progress for it.", stats.Shared},
+		{"secsipidx_fetches_revalidated_total", "Fetches answered as not modified, served from the expired cached content.", stats.Revalidated},
+	} {
+		family := m.Name
+		if openMetrics {
+			family = strings.TrimSuffix(family, "_total")
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", family, m.Help, family, m.Name, m.Value)
+	}
+}
+
+// httpHandleMetrics - GET /metrics for the statistics per client, the result
+// of the self-check and the latency histograms in the Prometheus text format,
+// or in the OpenMetrics format (with exemplars) if accepted by the client
+func httpHandleMetrics(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+	if statsStore != nil {
+		statsWriteMetrics(w, openMetrics)
+		caStatsWriteMetrics(w, openMetrics)
+	}
+	selfCheckWriteMetrics(w)
+	probeWriteMetrics(w)
+	quotaWriteMetrics(w)
+	limitWriteMetrics(w, openMetrics)
+	signRateWriteMetrics(w, openMetrics)
+	degradedWriteMetrics(w, openMetrics)
+	latencyWriteMetrics(w, openMetrics)
+	ocspWriteMetrics(w, openMetrics)
+	fetchWriteMetrics(w, openMetrics)
+	if openMetrics {
+		fmt.Fprintf(w, "# EOF\n")
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBStore - database sink for sign and check records
+type DBStore struct {
+	db     *sql.DB
+	driver string
+}
+
+// DBRecord - sign or check record loaded from database
+type DBRecord struct {
+	ID int64 `json:"id"`
+	TS int64 `json:"ts"`
+	EventRecord
+}
+
+// DBQuery - filters for loading records from database
+type DBQuery struct {
+	OrigTN string
+	DestTN string
+	OrigID string
+	Since  int64
+	Until  int64
+	Limit  int
+}
+
+var dbStore *DBStore = nil
+
+var dbSchema = []string{
+	`CREATE TABLE IF NOT EXISTS secsipidx_records (
+		id %s,
+		ts BIGINT NOT NULL,
+		event VARCHAR(16) NOT NULL,
+		code INTEGER NOT NULL,
+		result VARCHAR(16) NOT NULL,
+		origtn VARCHAR(64) NOT NULL DEFAULT '',
+		desttn VARCHAR(255) NOT NULL DEFAULT '',
+		origid VARCHAR(128) NOT NULL DEFAULT '',
+		callid VARCHAR(255) NOT NULL DEFAULT '',
+		requestid VARCHAR(128) NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS secsipidx_records_origid_idx ON secsipidx_records (origid)`,
+	`CREATE INDEX IF NOT EXISTS secsipidx_records_origtn_idx ON secsipidx_records (origtn)`,
+	`CREATE INDEX IF NOT EXISTS secsipidx_records_desttn_idx ON secsipidx_records (desttn)`,
+	`CREATE INDEX IF NOT EXISTS secsipidx_records_ts_idx ON secsipidx_records (ts)`,
+	// the destination numbers of the records, one row for each of them
+	`CREATE TABLE IF NOT EXISTS secsipidx_record_desttns (
+		record_id BIGINT NOT NULL REFERENCES secsipidx_records (id) ON DELETE CASCADE,
+		desttn VARCHAR(64) NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS secsipidx_record_desttns_desttn_idx ON secsipidx_record_desttns (desttn)`,
+}
+
+// dbUpgrade - changes for the tables created by older versions, the errors
+// are ignored because the columns may exist already
+var dbUpgrade = []string{
+	`ALTER TABLE secsipidx_records ADD COLUMN requestid VARCHAR(128) NOT NULL DEFAULT ''`,
+}
+
+// NewDBStore - open the database and create the table if it does not exist
+func NewDBStore(driver string, dsn string) (*DBStore, error) {
+	var idCol string
+	switch driver {
+	case "sqlite3":
+		idCol = "INTEGER PRIMARY KEY AUTOINCREMENT"
+	case "postgres":
+		idCol = "BIGSERIAL PRIMARY KEY"
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database (driver not built in?): %v", err)
+	}
+	for i, q := range dbSchema {
+		if i == 0 {
+			q = fmt.Sprintf(q, idCol)
+		}
+		if _, err = db.Exec(q); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to init database schema: %v", err)
+		}
+	}
+	for _, q := range dbUpgrade {
+		db.Exec(q)
+	}
+	return &DBStore{db: db, driver: driver}, nil
+}
+
+// rebind - replace the '?' placeholders with '$N' for postgres
+func (s *DBStore) rebind(q string) string {
+	if s.driver != "postgres" {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Insert - store the event record, with each of its destination numbers
+// (comma separated in the event) in the secsipidx_record_desttns table
+func (s *DBStore) Insert(ev *EventRecord, ts time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id int64
+	if err = tx.QueryRow(s.rebind(`INSERT INTO secsipidx_records
+		(ts, event, code, result, origtn, desttn, origid, callid, requestid, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		ts.Unix(), ev.Event, ev.Code, ev.Result, ev.OrigTN, ev.DestTN, ev.OrigID, ev.CallID, ev.ReqID,
+		ev.Message).Scan(&id); err != nil {
+		return err
+	}
+	for _, destTN := range strings.Split(ev.DestTN, ",") {
+		if len(destTN) == 0 {
+			continue
+		}
+		if _, err = tx.Exec(s.rebind(`INSERT INTO secsipidx_record_desttns (record_id, desttn) VALUES (?, ?)`),
+			id, destTN); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Query - load the records matching the filters, newest first
+func (s *DBStore) Query(fq *DBQuery) ([]DBRecord, error) {
+	var conds []string
+	var args []interface{}
+
+	if len(fq.OrigTN) > 0 {
+		conds = append(conds, "origtn = ?")
+		args = append(args, fq.OrigTN)
+	}
+	if len(fq.DestTN) > 0 {
+		// the records stored by older versions have only the desttn column
+		conds = append(conds, "(desttn = ? OR id IN (SELECT record_id FROM secsipidx_record_desttns WHERE desttn = ?))")
+		args = append(args, fq.DestTN, fq.DestTN)
+	}
+	if len(fq.OrigID) > 0 {
+		conds = append(conds, "origid = ?")
+		args = append(args, fq.OrigID)
+	}
+	if fq.Since > 0 {
+		conds = append(conds, "ts >= ?")
+		args = append(args, fq.Since)
+	}
+	if fq.Until > 0 {
+		conds = append(conds, "ts <= ?")
+		args = append(args, fq.Until)
+	}
+	q := "SELECT id, ts, event, code, result, origtn, desttn, origid, callid, requestid, message FROM secsipidx_records"
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	q += " ORDER BY ts DESC, id DESC"
+	if fq.Limit > 0 {
+		q += " LIMIT " + strconv.Itoa(fq.Limit)
+	}
+
+	rows, err := s.db.Query(s.rebind(q), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []DBRecord
+	for rows.Next() {
+		var rec DBRecord
+		if err = rows.Scan(&rec.ID, &rec.TS, &rec.Event, &rec.Code, &rec.Result, &rec.OrigTN,
+			&rec.DestTN, &rec.OrigID, &rec.CallID, &rec.ReqID, &rec.Message); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// dbStoreEvent - store the event if the database sink is enabled, errors are only logged
+func dbStoreEvent(ev *EventRecord) {
+	if dbStore == nil {
+		return
+	}
+	if err := dbStore.Insert(ev, time.Now()); err != nil {
+		log.Printf("failed to store event in database: %v", err)
+	}
+}
+
+// secsipidxCLIDBQuery - print the stored records matching the cli filters
+func secsipidxCLIDBQuery() int {
+	if dbStore == nil {
+		fmt.Printf("database not configured\n")
+		return cliExitArgs
+	}
+	records, err := dbStore.Query(&DBQuery{
+		OrigTN: cliops.origtn,
+		DestTN: cliops.desttn,
+		OrigID: cliops.origid,
+		Since:  int64(cliops.dbsince),
+		Until:  int64(cliops.dbuntil),
+		Limit:  cliops.dblimit,
+	})
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return -1
+	}
+	for _, rec := range records {
+		jrec, _ := json.Marshal(rec)
+		fmt.Printf("%s\n", jrec)
+	}
+	return 0
+}
@@ -0,0 +1,7 @@
+//go:build postgres
+// +build postgres
+
+package main
+
+// postgres database driver, enabled by building with: go build -tags postgres
+import _ "github.com/lib/pq"
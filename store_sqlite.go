@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// sqlite3 database driver, enabled by building with: go build -tags sqlite
+import _ "github.com/mattn/go-sqlite3"
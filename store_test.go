@@ -0,0 +1,47 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gomagedon/expectate"
+)
+
+func TestDBStoreQuery(t *testing.T) {
+	store, err := NewDBStore("sqlite3", filepath.Join(t.TempDir(), "records.db"))
+	if err != nil {
+		t.Fatalf("failed to open the database: %v", err)
+	}
+	now := time.Now()
+	store.Insert(&EventRecord{Event: "check", Result: "OK", OrigTN: "493011111111", DestTN: "493022222222"}, now)
+	store.Insert(&EventRecord{Event: "check", Result: "OK", OrigTN: "493011111111",
+		DestTN: "493022222222,493033333333"}, now)
+	// record stored by an older version, without the destination numbers table
+	store.db.Exec(`INSERT INTO secsipidx_records (ts, event, code, result, origtn, desttn)
+		VALUES (?, 'sign', 0, 'OK', '493011111111', '493044444444')`, now.Unix())
+
+	for _, tc := range []struct {
+		name    string
+		query   DBQuery
+		records int
+	}{
+		{"single destination number", DBQuery{DestTN: "493022222222"}, 2},
+		{"one of several destination numbers", DBQuery{DestTN: "493033333333"}, 1},
+		{"destination number of older record", DBQuery{DestTN: "493044444444"}, 1},
+		{"destination numbers joined", DBQuery{DestTN: "493022222222,493033333333"}, 1},
+		{"destination and origination numbers", DBQuery{OrigTN: "493011111111", DestTN: "493033333333"}, 1},
+		{"unknown destination number", DBQuery{DestTN: "493055555555"}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			records, err := store.Query(&tc.query)
+			expect(err).ToBe(nil)
+			expect(len(records)).ToBe(tc.records)
+		})
+	}
+}
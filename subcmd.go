@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// CLISubcommand - subcommand of the command line interface, with the names of
+// the options it accepts (shared with the legacy flat options)
+type CLISubcommand struct {
+	Name        string
+	Args        string
+	Description string
+	Flags       [][]string
+	Setup       func(args []string)
+}
+
+// groups of options accepted by the subcommands
+var (
+	cliFlagsCommon = []string{"verbosity", "vl", "timeout", "otel-url", "otel-service", "fips"}
+	cliFlagsCert   = []string{"cache-dir", "cache-expire", "cache-integrity", "cache-key-file",
+		"cache-max-entries", "cache-max-size", "cache-janitor", "cache-revalidate", "cache-stale-if-error", "ca-file", "ca-inter", "crl-file", "crl-refresh", "ocsp-shared", "crl-policy", "ocsp-policy", "short-lived-max", "cert-policy", "cert-policy-oids", "cert-policy-eku", "cert-verify",
+		"aia-fetch", "aia-max", "aia-hosts", "result-chain",
+		"pin-file", "pin-policy", "fetch-ip-family", "fetch-ip-prefer", "fetch-happy-eyeballs", "fetch-srv",
+		"dns-servers", "dns-cache", "fetch-user-agent", "fetch-headers-file",
+		"fetch-redirects", "fetch-redirect-strict", "repo-auth-file"}
+	cliFlagsEvents = []string{"hep-srv", "hep-proto", "hep-id", "hep-pass", "call-id", "db-driver", "db-dsn", "origid-store"}
+	cliFlagsBatch  = []string{"batch", "batch-order", "jobs", "sign-rate", "sign-burst"}
+	cliFlagsSign   = []string{"fprvkey", "k", "fprvkey-next", "key-cutover", "keyring", "key-name", "x5u", "x5t-cert", "spc", "attest", "a", "orig-tn", "o", "dest-tn", "d", "iat",
+		"orig-id", "mky", "claims", "canonical-json", "alg", "signer-algs", "ppt", "typ", "dno-file", "dno-mode",
+		"tn-lookup", "tn-lookup-expire", "tn-lookup-attest", "tn-lookup-fallback", "attest-matrix", "trunk", "cps-url", "cps-publish", "service-key", "service-x5u", "passport-form",
+		"identity-size-budget", "identity-size-policy"}
+	cliFlagsCheck = []string{"identity", "fidentity", "fpubkey", "p", "expire", "expire-shaken", "expire-div",
+		"expire-rcd", "identity-max-len", "segment-max-len", "dest-tn-max", "iat-skew", "rcdi-verify", "dno-file",
+		"dno-mode", "result-cache-ttl", "result-cache-max", "carrier-file", "carrier-refresh",
+		"treatment-policy", "no-identity", "no-identity-except",
+		"soft-fail", "signer-algs", "passport-claims", "record-dir", "record-max", "ppt-policy", "cvt-url", "cvt-expire", "cvt-timeout"}
+	cliFlagsServe = []string{"http-srv", "H", "https-srv", "https-pubkey", "https-prvkey", "http-dir",
+		"cors-origins", "cors-methods", "cors-headers", "cors-max-age", "http-max-body", "jobs-workers", "jobs-retention",
+		"jobs-max-items", "resign-max-age", "fcert", "fcert-next", "self-check-interval", "probe-urls", "probe-interval", "cps-srv", "cps-srv-retention",
+		"cps-srv-max-call", "cps-srv-max", "service-name", "verdict-key", "verdict-x5u", "verdict-iss", "service-key", "service-x5u", "stats",
+		"stats-max-clients", "latency-metrics", "verify-timeout-max", "fixtures", "fixtures-dir", "fixtures-url", "tenants", "admin-key", "quota-file", "degraded-warn", "degraded-window",
+		"mem-limit", "max-verifications", "max-queued", "finalize-cert", "sign-rate", "sign-burst", "sign-max-wait"}
+)
+
+var cliSubcommands = []*CLISubcommand{
+	{Name: "sign", Description: "build the identity header value from the individual parameter values",
+		Flags: [][]string{cliFlagsSign, cliFlagsEvents, cliFlagsBatch, {"origid-meta"}},
+		Setup: func(args []string) { cliops.signfull = true }},
+	{Name: "verify", Args: "[identity]", Description: "check the identity header value",
+		Flags: [][]string{cliFlagsCheck, cliFlagsCert, cliFlagsEvents, cliFlagsBatch, {"mky", "print-claims", "orig-tn", "o", "dest-tn", "d", "cps-url", "service-key", "service-x5u",
+			"fpcap", "pcap-report", "fcdr", "report", "report-bucket", "report-file"}},
+		Setup: func(args []string) {
+			cliops.check = true
+			if len(args) > 0 && len(cliops.identity) == 0 && len(cliops.fidentity) == 0 {
+				cliops.identity = args[0]
+			}
+		}},
+	{Name: "serve", Description: "run the http services for signing and checking identity values",
+		Flags: [][]string{cliFlagsServe, cliFlagsSign, cliFlagsCheck, cliFlagsCert, cliFlagsEvents},
+		Setup: func(args []string) {
+			if len(cliops.httpsrv) == 0 && len(cliops.httpssrv) == 0 {
+				cliops.httpsrv = ":8090"
+			}
+		}},
+	{Name: "div", Description: "add div identity for retargeting the call in identity to dest-tn",
+		Flags: [][]string{{"identity", "fidentity", "fprvkey", "k", "fprvkey-next", "key-cutover", "keyring", "key-name", "x5u", "x5t-cert", "spc", "signer-algs", "dest-tn", "d"}},
+		Setup: func(args []string) { cliops.div = true }},
+	{Name: "redirect", Description: "build the identities for the INVITE recursed on a 3xx redirect to redirect-target",
+		Flags: [][]string{{"identity", "fidentity", "fprvkey", "k", "fprvkey-next", "key-cutover", "keyring", "key-name", "x5u", "x5t-cert", "spc", "redirect-target",
+			"redirect-policy", "resign-max-age"}, cliFlagsCheck, cliFlagsCert},
+		Setup: func(args []string) { cliops.redirect = true }},
+	{Name: "prepare", Description: "build the canonical header and payload JSON and the signing input of the identity, without signing it",
+		Flags: [][]string{{"keyring", "key-name", "x5u", "x5t-cert", "spc", "attest", "a", "orig-tn", "o", "dest-tn", "d", "iat",
+			"orig-id", "mky", "claims", "dno-file", "dno-mode", "attest-matrix", "trunk"}},
+		Setup: func(args []string) { cliops.prepare = true }},
+	{Name: "finalize", Description: "build the identity from the signing input and its ES256 signature done elsewhere, verifying the signature with the certificate of the signer",
+		Flags: [][]string{{"signing-input", "signature", "finalize-cert", "x5t-cert"}},
+		Setup: func(args []string) { cliops.finalize = true }},
+	{Name: "resign", Description: "re-issue the identity signed with fprvkey, with a fresh iat and the orig-id if set",
+		Flags: [][]string{{"identity", "fidentity", "fprvkey", "k", "fprvkey-next", "key-cutover", "x5u", "x5t-cert", "spc", "signer-algs", "orig-id", "resign-max-age"}},
+		Setup: func(args []string) { cliops.resign = true }},
+	{Name: "watch", Args: "<dir>", Description: "check the identity files dropped into the spool directory, moving them to the pass or fail subdirectory with a result file",
+		Flags: [][]string{cliFlagsCheck, cliFlagsCert, cliFlagsEvents, {"watch-dir", "watch-interval"}},
+		Setup: func(args []string) {
+			if len(args) > 0 && len(cliops.watchdir) == 0 {
+				cliops.watchdir = args[0]
+			}
+		}},
+	{Name: "check-chain", Description: "check the shaken and div identities as diversion chain",
+		Flags: [][]string{cliFlagsCheck, cliFlagsCert},
+		Setup: func(args []string) { cliops.checkchain = true }},
+	{Name: "check-identities", Description: "check the identities of the call from trunk with the ppt policy (required, optional, ignored and forbidden ppt)",
+		Flags: [][]string{cliFlagsCheck, cliFlagsCert, {"trunk"}},
+		Setup: func(args []string) { cliops.checkids = true }},
+	{Name: "sign-connected", Description: "build connected identity of the answering party dest-tn for the call from orig-tn",
+		Flags: [][]string{cliFlagsSign, cliFlagsEvents},
+		Setup: func(args []string) { cliops.signconn = true }},
+	{Name: "check-connected", Description: "check connected identity for the call from orig-tn, answered by dest-tn if set",
+		Flags: [][]string{cliFlagsCheck, cliFlagsCert, cliFlagsEvents, {"orig-tn", "o", "dest-tn", "d"}},
+		Setup: func(args []string) { cliops.checkconn = true }},
+	{Name: "rcdi", Description: "compute rcdi digest of rcd resource, verifying it if rcdi-digest is set",
+		Flags: [][]string{{"rcdi-src", "rcdi-alg", "rcdi-digest"}},
+		Setup: func(args []string) { cliops.rcdi = true }},
+	{Name: "records", Description: "print stored records filtered by orig-tn, dest-tn, orig-id, db-since and db-until",
+		Flags: [][]string{{"db-driver", "db-dsn", "orig-tn", "o", "dest-tn", "d", "orig-id", "db-since", "db-until", "db-limit"}},
+		Setup: func(args []string) { cliops.dbquery = true }},
+	{Name: "origid", Args: "[origid]", Description: "print the call metadata stored for the origid of a signed identity",
+		Flags: [][]string{{"db-driver", "db-dsn", "orig-id"}},
+		Setup: func(args []string) {
+			cliops.origidlook, cliops.origidstor = true, true
+			if len(args) > 0 && len(cliops.origid) == 0 {
+				cliops.origid = args[0]
+			}
+		}},
+	{Name: "service", Args: "install|remove|start|stop [serve options]",
+		Description: "manage the Windows service, installed to run the serve subcommand with the given options",
+		Flags:       [][]string{{"service-name"}},
+		Setup: func(args []string) {
+			cliops.serviceop = "none"
+			if len(args) > 0 {
+				cliops.serviceop = args[0]
+			}
+		}},
+	{Name: "cert", Args: "<cert.pem>", Description: "print the certificate details and the result of its verification",
+		Flags: [][]string{cliFlagsCert},
+		Setup: func(args []string) { cliops.certinfo = true }},
+	{Name: "diff", Args: "<identity-a> <identity-b>",
+		Description: "print the differences of the headers, claims and parameters of two identities and their check results",
+		Flags:       [][]string{cliFlagsCheck, cliFlagsCert},
+		Setup:       func(args []string) { cliops.diff = true }},
+	{Name: "cache", Args: "list|purge", Description: "list the cached certificates or remove the expired (or tampered) ones",
+		Flags: [][]string{{"cache-dir", "cache-expire", "cache-integrity", "cache-key-file"}},
+		Setup: func(args []string) { cliops.cacheop = "list" }},
+	{Name: "keygen", Description: "generate the private and public keys (ES256), written to fprvkey and fpubkey",
+		Flags: [][]string{{"fprvkey", "k", "fpubkey", "p"}},
+		Setup: func(args []string) { cliops.keygen = true }},
+	{Name: "keys", Args: "import|export|fingerprints <file>",
+		Description: "import the key and the certificate chain of a PKCS#12 bundle, export the certificate chain for publication or print the fingerprints",
+		Flags:       [][]string{{"fprvkey", "k", "fcert", "p12-password"}},
+		Setup:       func(args []string) { cliops.keysop = "-" }},
+	{Name: "fuzz", Description: "verify structurally mutated passports, reporting the crashes and the inconsistent verdicts",
+		Flags: [][]string{{"fuzz-iterations", "fuzz-seed", "fuzz-out", "expire", "identity-max-len", "segment-max-len", "dest-tn-max", "signer-algs"}},
+		Setup: func(args []string) { cliops.fuzz = true }},
+	{Name: "codes", Args: "[text|json]", Description: "print the return codes with their names, classes and descriptions",
+		Setup: func(args []string) {
+			cliops.codes = "text"
+			if len(args) > 0 {
+				cliops.codes = args[0]
+			}
+		}},
+	{Name: "completion", Args: "bash|zsh|fish", Description: "print the shell completion script",
+		Setup: func(args []string) {
+			cliops.completion = "bash"
+			if len(args) > 0 {
+				cliops.completion = args[0]
+			}
+		}},
+	{Name: "version", Description: "print version",
+		Setup: func(args []string) { cliops.version = true }},
+}
+
+// cliSubcommandsUsage - print the list of the subcommands
+func cliSubcommandsUsage() {
+	fmt.Fprintf(os.Stderr, "Subcommands (run '%s <subcommand> -h' for their options):\n", filepath.Base(os.Args[0]))
+	for _, sc := range cliSubcommands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", sc.Name, sc.Description)
+	}
+	fmt.Fprintf(os.Stderr, "Legacy options:\n")
+}
+
+// cliSubcommandFlags - names of the options accepted by the subcommand
+func cliSubcommandFlags(sc *CLISubcommand) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, group := range append(sc.Flags, cliFlagsCommon) {
+		for _, name := range group {
+			if flag.Lookup(name) != nil && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// cliParseSubcommand - parse the options of the subcommand given as first
+// argument; returns false if the first argument is not a subcommand
+func cliParseSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	var sc *CLISubcommand
+	for _, v := range cliSubcommands {
+		if v.Name == args[0] {
+			sc = v
+		}
+	}
+	if sc == nil {
+		return false
+	}
+
+	fs := flag.NewFlagSet(sc.Name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [options] %s\n", filepath.Base(os.Args[0]), sc.Name, sc.Args)
+		fmt.Fprintf(os.Stderr, "    %s\n", sc.Description)
+		fs.VisitAll(func(f *flag.Flag) {
+			if !cliFlagHidden(f.Name) {
+				cliPrintFlag(os.Stderr, f)
+			}
+		})
+		os.Exit(1)
+	}
+	for _, name := range append(cliSubcommandFlags(sc), cliFlagsHidden...) {
+		f := flag.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	fs.Parse(args[1:])
+	cliops.subargs = fs.Args()
+	sc.Setup(fs.Args())
+	if sc.Name == "cache" && fs.NArg() > 0 {
+		cliops.cacheop = fs.Arg(0)
+	}
+	if sc.Name == "keys" && fs.NArg() > 0 {
+		// the options can follow the operation
+		cliops.keysop = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+		cliops.subargs = append([]string{cliops.keysop}, fs.Args()...)
+	}
+	return true
+}
+
+// secsipidxCLICodes - print the registry of the return codes, as table or JSON
+func secsipidxCLICodes() int {
+	codes := secsipid.SJWTRetCodes()
+	switch cliops.codes {
+	case "json":
+		data, _ := json.MarshalIndent(codes, "", "  ")
+		fmt.Println(string(data))
+	case "text":
+		for _, rc := range codes {
+			fmt.Printf("%5d  %-26s %-12s %s\n", rc.Code, rc.Name, rc.Class, rc.Description)
+		}
+	default:
+		fmt.Printf("unknown codes output format: %s\n", cliops.codes)
+		return cliExitArgs
+	}
+	return 0
+}
+
+func secsipidxCLIKeygen() int {
+	prvkeyPath, pubkeyPath := cliops.fprvkey, cliops.fpubkey
+	if len(prvkeyPath) == 0 {
+		prvkeyPath = "ec256-private.pem"
+	}
+	if len(pubkeyPath) == 0 {
+		pubkeyPath = "ec256-public.pem"
+	}
+	prvkey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		fmt.Printf("failed to generate key: %v\n", err)
+		return -1
+	}
+	prvDer, _ := x509.MarshalECPrivateKey(prvkey)
+	pubDer, _ := x509.MarshalPKIXPublicKey(&prvkey.PublicKey)
+	prvPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvDer})
+	if err = os.WriteFile(prvkeyPath, prvPEM, 0600); err != nil {
+		fmt.Printf("failed to write private key: %v\n", err)
+		return -1
+	}
+	if err = os.WriteFile(pubkeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}), 0644); err != nil {
+		fmt.Printf("failed to write public key: %v\n", err)
+		return -1
+	}
+	keyID, _, _ := secsipid.SJWTKeyID(prvPEM)
+	fmt.Printf("private key: %s\npublic key: %s\nkey id: %s\n", prvkeyPath, pubkeyPath, keyID)
+	return 0
+}
+
+func secsipidxCLICert() int {
+	if len(cliops.subargs) == 0 {
+		fmt.Printf("path to certificate not provided\n")
+		return cliExitArgs
+	}
+	data, err := ioutil.ReadFile(cliops.subargs[0])
+	if err != nil {
+		fmt.Printf("failed to read certificate: %v\n", err)
+		return -1
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		fmt.Printf("invalid certificate format\n")
+		return -1
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		fmt.Printf("failed to parse certificate: %v\n", err)
+		return -1
+	}
+	fmt.Printf("subject: %s\n", cert.Subject)
+	fmt.Printf("issuer: %s\n", cert.Issuer)
+	fmt.Printf("serial: %s\n", cert.SerialNumber)
+	fmt.Printf("not before: %s\n", cert.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Printf("not after: %s\n", cert.NotAfter.UTC().Format(time.RFC3339))
+	if secsipid.SJWTLibOptGetN("CertVerify") == 0 {
+		return 0
+	}
+	chain, ret, err := secsipid.SJWTPubKeyVerifyChain(data)
+	if err != nil {
+		fmt.Printf("verification failed: %v\n", err)
+	} else {
+		fmt.Printf("verification: ok\n")
+		for i, subject := range certChainSubjects(chain) {
+			fmt.Printf("chain %d: %s\n", i, subject)
+		}
+	}
+	return ret
+}
+
+func secsipidxCLICache() int {
+	if len(cliops.cachedir) == 0 {
+		fmt.Printf("cache directory not provided\n")
+		return cliExitArgs
+	}
+	if cliops.cacheop != "list" && cliops.cacheop != "purge" {
+		fmt.Printf("invalid cache operation: %s\n", cliops.cacheop)
+		return cliExitArgs
+	}
+	entries, err := ioutil.ReadDir(cliops.cachedir)
+	if err != nil {
+		fmt.Printf("failed to read cache directory: %v\n", err)
+		return -1
+	}
+	tnow := time.Now()
+	for _, entry := range entries {
+		if entry.IsDir() || secsipid.SJWTCacheFileAux(entry.Name()) {
+			continue
+		}
+		filePath := filepath.Join(cliops.cachedir, entry.Name())
+		age := int(tnow.Sub(entry.ModTime()).Seconds())
+		expired := age > cliops.cacheexpire
+		tampered := cliops.cacheinteg && secsipid.SJWTCacheFileVerify(filePath) != nil
+		if cliops.cacheop == "purge" {
+			if expired || tampered {
+				os.Remove(filePath)
+				os.Remove(filePath + ".sha256")
+				os.Remove(filePath + ".validators")
+				fmt.Printf("removed: %s\n", entry.Name())
+			}
+			continue
+		}
+		state := "valid"
+		if expired {
+			state = "expired"
+		} else if tampered {
+			state = "tampered"
+		}
+		fmt.Printf("%s\t%d\t%ds\t%s\n", entry.Name(), entry.Size(), age, state)
+	}
+	return 0
+}
+
+// cliSubcommandNames - names of the subcommands joined with the separator
+func cliSubcommandNames(sep string) string {
+	var names []string
+	for _, sc := range cliSubcommands {
+		names = append(names, sc.Name)
+	}
+	return strings.Join(names, sep)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// Tenant - the signing profile of a tenant (the keyring key and the x5u), the
+// API keys allowed to use it (no authentication if empty) and the signing
+// quotas (0 - no limit)
+type Tenant struct {
+	ID           string   `json:"id"`
+	APIKeys      []string `json:"apikeys,omitempty"`
+	KeyName      string   `json:"keyname,omitempty"`
+	X5u          string   `json:"x5u,omitempty"`
+	DailyQuota   int64    `json:"dailyquota,omitempty"`
+	MonthlyQuota int64    `json:"monthlyquota,omitempty"`
+}
+
+// Tenants - the tenants served by the daemon, by id
+type Tenants struct {
+	Tenants []Tenant `json:"tenants"`
+
+	byID map[string]*Tenant
+}
+
+var tenants *Tenants = nil
+
+// tenantRoutes - the handlers of the operations of /v1/tenants/{id}/{op}
+var tenantRoutes = map[string]http.HandlerFunc{}
+
+// LoadTenants - load the tenants from JSON file, checking that their keys are
+// in the keyring
+func LoadTenants(filePath string) (*Tenants, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tenants{}
+	if err = json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("invalid tenants: %v", err)
+	}
+	t.byID = map[string]*Tenant{}
+	for i := range t.Tenants {
+		tenant := &t.Tenants[i]
+		if len(tenant.ID) == 0 || strings.ContainsAny(tenant.ID, "/ \t") {
+			return nil, fmt.Errorf("invalid id for tenant %d", i)
+		}
+		if _, ok := t.byID[tenant.ID]; ok {
+			return nil, fmt.Errorf("duplicate tenant id: %s", tenant.ID)
+		}
+		if len(tenant.KeyName) > 0 {
+			if keyring == nil {
+				return nil, fmt.Errorf("no keyring for key of tenant %s", tenant.ID)
+			}
+			if _, ok := keyring.byName[tenant.KeyName]; !ok {
+				return nil, fmt.Errorf("unknown key %s of tenant %s", tenant.KeyName, tenant.ID)
+			}
+		}
+		t.byID[tenant.ID] = tenant
+	}
+	return t, nil
+}
+
+// httpTenant - the tenant of the request, given by the X-Tenant-ID header or
+// by the path of /v1/tenants/{id}/{op}; nil if none is given
+func httpTenant(r *http.Request) *Tenant {
+	if tenants == nil {
+		return nil
+	}
+	return tenants.byID[r.Header.Get("X-Tenant-ID")]
+}
+
+// authorized - true if the API key is allowed for the tenant
+func (tenant *Tenant) authorized(apikey string) bool {
+	if len(tenant.APIKeys) == 0 {
+		return true
+	}
+	for _, key := range tenant.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apikey)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// httpTenantHandler - reject the requests for an unknown tenant or without an
+// API key (X-API-Key) allowed for the tenant; the signing requests (signing
+// is true) without tenant are rejected, for not signing with the keys of the
+// tenants without authentication
+func httpTenantHandler(signing bool, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := r.Header.Get("X-Tenant-ID")
+		if tenants == nil || r.Method == "OPTIONS" || (len(tenantID) == 0 && !signing) {
+			h(w, r)
+			return
+		}
+		if len(tenantID) == 0 {
+			httpLogf(r, "signing request without tenant\n")
+			httpError(w, http.StatusUnauthorized, httpErrUnauthorized, secsipid.SJWTRetErr, "tenant required")
+			return
+		}
+		tenant := httpTenant(r)
+		if tenant == nil {
+			httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "unknown tenant")
+			return
+		}
+		if !tenant.authorized(r.Header.Get("X-API-Key")) {
+			httpLogf(r, "unauthorized request for tenant: %s\n", tenant.ID)
+			httpError(w, http.StatusUnauthorized, httpErrUnauthorized, secsipid.SJWTRetErr, "unauthorized")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// httpHandleV1Tenants - POST /v1/tenants/{id}/{op}, with op being one of the
+// v1 operations (sign is an alias of sign-csv), for the tenant
+func httpHandleV1Tenants(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/tenants/"), "/")
+	if len(path) != 2 {
+		httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "unknown operation")
+		return
+	}
+	h, ok := tenantRoutes[path[1]]
+	if !ok {
+		httpError(w, http.StatusNotFound, httpErrNotFound, secsipid.SJWTRetErr, "unknown operation")
+		return
+	}
+	r.Header.Set("X-Tenant-ID", path[0])
+	h(w, r)
+}
+
+// httpSignKeyName - the name of the keyring key for signing, the one of the
+// tenant with -tenants, otherwise given by the X-Key-Name header
+func httpSignKeyName(r *http.Request) string {
+	if tenants != nil {
+		if tenant := httpTenant(r); tenant != nil {
+			return tenant.KeyName
+		}
+		return ""
+	}
+	return r.Header.Get("X-Key-Name")
+}
+
+// httpSignX5u - the x5u for signing, the one of the tenant if none is given
+// in the request
+func httpSignX5u(r *http.Request, x5uVal string) string {
+	if tenant := httpTenant(r); tenant != nil && len(x5uVal) == 0 {
+		return tenant.X5u
+	}
+	return x5uVal
+}
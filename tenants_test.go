@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gomagedon/expectate"
+)
+
+// testTenants - set the tenants of the daemon, restored at the end of the test
+func testTenants(t *testing.T, list ...Tenant) {
+	saved := tenants
+	t.Cleanup(func() { tenants = saved })
+	tenants = &Tenants{Tenants: list, byID: map[string]*Tenant{}}
+	for i := range tenants.Tenants {
+		tenants.byID[tenants.Tenants[i].ID] = &tenants.Tenants[i]
+	}
+}
+
+func TestHTTPTenantHandler(t *testing.T) {
+	testTenants(t, Tenant{ID: "reseller-a", APIKeys: []string{"secret-a"}, KeyName: "carrier-a"})
+	var keyName string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		keyName = httpSignKeyName(r)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		signing bool
+		headers map[string]string
+		status  int
+		keyName string
+	}{
+		{"signing with tenant", true, map[string]string{"X-Tenant-ID": "reseller-a", "X-API-Key": "secret-a"},
+			http.StatusOK, "carrier-a"},
+		{"signing with tenant ignores key name", true, map[string]string{"X-Tenant-ID": "reseller-a",
+			"X-API-Key": "secret-a", "X-Key-Name": "carrier-b"}, http.StatusOK, "carrier-a"},
+		{"signing without tenant", true, map[string]string{"X-Key-Name": "carrier-a"}, http.StatusUnauthorized, ""},
+		{"signing with wrong api key", true, map[string]string{"X-Tenant-ID": "reseller-a", "X-API-Key": "secret-b"},
+			http.StatusUnauthorized, ""},
+		{"signing for unknown tenant", true, map[string]string{"X-Tenant-ID": "reseller-b"}, http.StatusNotFound, ""},
+		{"check without tenant", false, map[string]string{"X-Key-Name": "carrier-a"}, http.StatusOK, ""},
+		{"check with wrong api key", false, map[string]string{"X-Tenant-ID": "reseller-a"}, http.StatusUnauthorized, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			keyName = ""
+			r := httptest.NewRequest("POST", "/v1/sign-csv", nil)
+			for name, value := range tc.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			httpTenantHandler(tc.signing, handler)(w, r)
+			expect(w.Code).ToBe(tc.status)
+			expect(keyName).ToBe(tc.keyName)
+		})
+	}
+
+	t.Run("key name header without tenants", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		tenants = nil
+		r := httptest.NewRequest("POST", "/v1/sign-csv", nil)
+		r.Header.Set("X-Key-Name", "carrier-b")
+		w := httptest.NewRecorder()
+		httpTenantHandler(true, handler)(w, r)
+		expect(w.Code).ToBe(http.StatusOK)
+		expect(keyName).ToBe("carrier-b")
+	})
+}
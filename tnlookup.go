@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TN classification values returned by the lookup hook
+const (
+	tnClassOwned    = "owned"
+	tnClassCustomer = "customer"
+	tnClassUnknown  = "unknown"
+)
+
+type tnLookupEntry struct {
+	class   string
+	expires time.Time
+}
+
+// TNLookup - hook to classify the orig TN via HTTP callout or helper program
+type TNLookup struct {
+	target  string
+	expire  time.Duration
+	timeout time.Duration
+	attest  map[string]string
+	// fallback - attestation level if the lookup fails or the class is not mapped
+	fallback string
+	mu       sync.Mutex
+	cache    map[string]tnLookupEntry
+}
+
+var tnLookup *TNLookup = nil
+
+// NewTNLookup - target is an http(s) URL (with optional {tn} placeholder) or
+// exec:/path/to/helper; attestMap is a list like 'owned=A,customer=B,unknown=C'
+func NewTNLookup(target string, expire int, timeout int, attestMap string, fallback string) (*TNLookup, error) {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") &&
+		!strings.HasPrefix(target, "exec:") {
+		return nil, fmt.Errorf("invalid tn lookup target: %s", target)
+	}
+	attest := make(map[string]string)
+	for _, item := range strings.Split(attestMap, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid tn lookup attestation map item: %s", item)
+		}
+		attest[kv[0]] = kv[1]
+	}
+	if fallback != "A" && fallback != "B" && fallback != "C" {
+		return nil, fmt.Errorf("invalid tn lookup fallback attestation: %s", fallback)
+	}
+	return &TNLookup{
+		target:   target,
+		expire:   time.Duration(expire) * time.Second,
+		timeout:  time.Duration(timeout) * time.Second,
+		attest:   attest,
+		fallback: fallback,
+		cache:    make(map[string]tnLookupEntry),
+	}, nil
+}
+
+func (l *TNLookup) fetch(tn string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	if strings.HasPrefix(l.target, "exec:") {
+		out, err := exec.CommandContext(ctx, strings.TrimPrefix(l.target, "exec:"), tn).Output()
+		if err != nil {
+			return "", fmt.Errorf("tn lookup helper failure: %v", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	urlVal := l.target
+	if strings.Contains(urlVal, "{tn}") {
+		urlVal = strings.Replace(urlVal, "{tn}", url.QueryEscape(tn), -1)
+	} else if strings.Contains(urlVal, "?") {
+		urlVal += "&tn=" + url.QueryEscape(tn)
+	} else {
+		urlVal += "?tn=" + url.QueryEscape(tn)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", urlVal, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("tn lookup http failure: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("tn lookup http status error: %v", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Classify - return the classification of the TN, using the cached value if not expired
+func (l *TNLookup) Classify(tn string) (string, error) {
+	l.mu.Lock()
+	entry, ok := l.cache[tn]
+	l.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.class, nil
+	}
+
+	class, err := l.fetch(tn)
+	if err != nil {
+		return "", err
+	}
+	if class != tnClassOwned && class != tnClassCustomer {
+		class = tnClassUnknown
+	}
+	if l.expire > 0 {
+		l.mu.Lock()
+		l.cache[tn] = tnLookupEntry{class: class, expires: time.Now().Add(l.expire)}
+		l.mu.Unlock()
+	}
+	return class, nil
+}
+
+// Attestation - the attestation level for the TN based on its classification,
+// the fallback value is returned if the lookup fails or the class is not mapped
+func (l *TNLookup) Attestation(tn string) string {
+	class, err := l.Classify(tn)
+	if err != nil {
+		log.Printf("failed to classify tn %s: %v", tn, err)
+		return l.fallback
+	}
+	if attest, ok := l.attest[class]; ok {
+		return attest
+	}
+	return l.fallback
+}
+
+// signAttestation - the attestation level to be used for signing
+func signAttestation(attrs *SignAttrs) string {
+	if attestMatrix != nil {
+		return attestMatrix.Decide(attrs)
+	}
+	if tnLookup != nil {
+		return tnLookup.Attestation(attrs.OrigTN)
+	}
+	return attrs.Attest
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gomagedon/expectate"
+)
+
+func TestTNLookupAttestation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch tn := strings.TrimPrefix(r.URL.Path, "/tn/"); tn {
+		case "493011111111":
+			w.Write([]byte("owned"))
+		case "493022222222":
+			w.Write([]byte("customer"))
+		case "493033333333":
+			w.Write([]byte("other"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name      string
+		attestMap string
+		fallback  string
+		tn        string
+		attest    string
+	}{
+		{"owned number", "owned=A,customer=B,unknown=C", "C", "493011111111", "A"},
+		{"customer number", "owned=A,customer=B,unknown=C", "C", "493022222222", "B"},
+		{"unknown class", "owned=A,customer=B,unknown=C", "C", "493033333333", "C"},
+		{"class not mapped", "owned=A", "B", "493022222222", "B"},
+		{"lookup failure", "owned=A,customer=B,unknown=C", "C", "493044444444", "C"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expect := expectate.Expect(t)
+
+			l, err := NewTNLookup(server.URL+"/tn/{tn}", 0, 5, tc.attestMap, tc.fallback)
+			expect(err).ToBe(nil)
+			expect(l.Attestation(tc.tn)).ToBe(tc.attest)
+		})
+	}
+
+	t.Run("Error with invalid fallback", func(t *testing.T) {
+		expect := expectate.Expect(t)
+
+		_, err := NewTNLookup(server.URL, 0, 5, "owned=A", "D")
+		expect(err == nil).ToBe(false)
+	})
+}
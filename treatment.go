@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// call treatments recommended for the result of checking the identity
+const (
+	treatmentAllow     = "allow"
+	treatmentFlag      = "flag"
+	treatmentVoicemail = "divert-to-voicemail"
+	treatmentBlock     = "block"
+)
+
+// CheckAttrs - attributes of a check result used to decide the treatment
+type CheckAttrs struct {
+	Code        int
+	Attest      string
+	DNO         bool
+	Unavailable bool
+}
+
+// TreatmentRule - one rule of the treatment policy, empty or "*" fields match
+// any value
+type TreatmentRule struct {
+	Result    string `json:"result"`
+	Check     string `json:"check"`
+	Code      *int   `json:"code"`
+	Attest    string `json:"attest"`
+	DNO       bool   `json:"dno"`
+	Treatment string `json:"treatment"`
+}
+
+// TreatmentPolicy - call treatment policy, first matching rule wins
+type TreatmentPolicy struct {
+	Rules   []TreatmentRule `json:"rules"`
+	Default string          `json:"default"`
+}
+
+var treatmentPolicy *TreatmentPolicy = nil
+
+// LoadTreatmentPolicy - load the treatment policy from JSON file
+func LoadTreatmentPolicy(filePath string) (*TreatmentPolicy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	p := &TreatmentPolicy{}
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid treatment policy: %v", err)
+	}
+	for i, rule := range p.Rules {
+		if !validTreatment(rule.Treatment) {
+			return nil, fmt.Errorf("invalid treatment in rule %d: %s", i, rule.Treatment)
+		}
+	}
+	if len(p.Default) > 0 && !validTreatment(p.Default) {
+		return nil, fmt.Errorf("invalid default treatment: %s", p.Default)
+	}
+	return p, nil
+}
+
+func validTreatment(v string) bool {
+	return v == treatmentAllow || v == treatmentFlag || v == treatmentVoicemail || v == treatmentBlock
+}
+
+// Decide - the treatment for the check result; without matching rule and
+// default, the valid and the unavailable identities are allowed and the other
+// ones flagged
+func (p *TreatmentPolicy) Decide(attrs *CheckAttrs) string {
+	result := "OK"
+	if attrs.Unavailable {
+		result = checkResultUnavailable
+	} else if attrs.Code != 0 {
+		result = "FAILED"
+	}
+	check := secsipid.SJWTRetClass(attrs.Code)
+	for _, rule := range p.Rules {
+		if !attestRuleMatch(rule.Result, result) || !attestRuleMatch(rule.Check, check) ||
+			!attestRuleMatch(rule.Attest, attrs.Attest) {
+			continue
+		}
+		if (rule.Code != nil && *rule.Code != attrs.Code) || (rule.DNO && !attrs.DNO) {
+			continue
+		}
+		return rule.Treatment
+	}
+	if len(p.Default) > 0 {
+		return p.Default
+	}
+	if attrs.Code != 0 && !attrs.Unavailable {
+		return treatmentFlag
+	}
+	return treatmentAllow
+}
+
+// checkTreatment - the recommended treatment for the result of checking the
+// identity, empty if no treatment policy
+func checkTreatment(identityVal string, ret int) string {
+	if treatmentPolicy == nil {
+		return ""
+	}
+	payload := identityPayload(identityVal)
+	return treatmentPolicy.Decide(&CheckAttrs{Code: ret, Attest: payload.ATTest, DNO: dnoFlagged(payload.Orig.TN),
+		Unavailable: checkUnavailable(ret)})
+}
+
+// httpTreatment - set the X-Treatment response header with the recommended
+// treatment, returning it to be added in the JSON result
+func httpTreatment(w http.ResponseWriter, r *http.Request, identityVal string, ret int) string {
+	treatment := checkTreatment(identityVal, ret)
+	if len(treatment) == 0 {
+		return ""
+	}
+	httpLogf(r, "recommended treatment: %s (code: %d)\n", treatment, ret)
+	w.Header().Set("X-Treatment", treatment)
+	return treatment
+}
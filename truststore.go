@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// trustStoreText - the trust store with one line per certificate and CRL
+func trustStoreText(ts *secsipid.SJWTTrustStore) string {
+	var lines []string
+	for _, group := range []struct {
+		kind  string
+		certs []secsipid.SJWTTrustCert
+	}{{"root", ts.Roots}, {"intermediate", ts.Intermediates}} {
+		for _, cert := range group.certs {
+			lines = append(lines, fmt.Sprintf("%s: %s (expire: %s, source: %s)", group.kind, cert.Subject,
+				time.Unix(cert.NotAfter, 0).UTC().Format(time.RFC3339), cert.Source))
+		}
+	}
+	if ts.CRL != nil {
+		nextUpdate := "none"
+		if ts.CRL.NextUpdate > 0 {
+			nextUpdate = time.Unix(ts.CRL.NextUpdate, 0).UTC().Format(time.RFC3339)
+		}
+		lines = append(lines, fmt.Sprintf("crl: %s (revoked: %d, next update: %s, source: %s)", ts.CRL.Issuer,
+			ts.CRL.Revoked, nextUpdate, ts.CRL.Source))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// httpHandleV1TrustStore - GET /v1/trust-store, the CA certificates and the
+// CRL used by the verifier at runtime
+func httpHandleV1TrustStore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	ts, ret, err := secsipid.SJWTGetTrustStore()
+	if err != nil {
+		httpLogf(r, "failed to get the trust store: (%d) %v\n", ret, err)
+		httpError(w, http.StatusInternalServerError, httpErrUnavailable, ret, err.Error())
+		return
+	}
+	httpWriteResult(w, r, trustStoreText(ts), ts)
+}
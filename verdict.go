@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// VerdictHeader - JWS header of the signed verdict
+type VerdictHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	X5u string `json:"x5u,omitempty"`
+}
+
+// VerdictPayload - JWS payload of the signed verdict, the identity is bound
+// by its SHA-256 digest
+type VerdictPayload struct {
+	Iat      int64    `json:"iat"`
+	Iss      string   `json:"iss,omitempty"`
+	Result   string   `json:"result"`
+	Code     int      `json:"code"`
+	Check    string   `json:"check,omitempty"`
+	Identity string   `json:"idhash"`
+	OrigTN   string   `json:"origtn,omitempty"`
+	DestTN   []string `json:"desttn,omitempty"`
+	ReqID    string   `json:"requestid,omitempty"`
+}
+
+// verdictPrvKey - the service key for signing the verdicts, loaded at startup
+var verdictPrvKey string
+
+// verdictInit - load and validate the service key for signing the verdicts
+func verdictInit(prvkeyPath string) error {
+	prvkey, err := secsipid.SJWTReadPrvKey(prvkeyPath)
+	if err != nil {
+		return err
+	}
+	if _, _, err = secsipid.SJWTParseECPrivateKeyFromPEM(prvkey); err != nil {
+		return err
+	}
+	verdictPrvKey = string(prvkey)
+	return nil
+}
+
+// verdictSign - build the signed verdict for the result of checking the identity
+func verdictSign(r *http.Request, identityVal string, ret int) (string, error) {
+	header := VerdictHeader{Alg: "ES256", Typ: "verdict+jwt", X5u: cliops.verdictx5u}
+	idhash := sha256.Sum256([]byte(identityVal))
+	payload := VerdictPayload{Iat: time.Now().Unix(), Iss: cliops.verdictiss, Result: "OK", Code: ret,
+		Identity: secsipid.SJWTBase64EncodeBytes(idhash[:]), ReqID: httpRequestID(r)}
+	if ret != secsipid.SJWTRetOK {
+		payload.Result = "FAILED"
+		payload.Check = secsipid.SJWTRetClass(ret)
+	}
+	idpayload := identityPayload(identityVal)
+	payload.OrigTN = idpayload.Orig.TN
+	payload.DestTN = idpayload.Dest.TN
+
+	headerJSON, _ := json.Marshal(header)
+	payloadJSON, _ := json.Marshal(payload)
+	verdict, _, err := secsipid.SJWTEncodeTextWithPrvKey(string(headerJSON), string(payloadJSON), verdictPrvKey)
+	return verdict, err
+}
+
+// httpVerdict - set the X-Verdict response header with the signed verdict,
+// returning it to be added in the JSON result
+func httpVerdict(w http.ResponseWriter, r *http.Request, identityVal string, ret int) string {
+	if len(verdictPrvKey) == 0 {
+		return ""
+	}
+	verdict, err := verdictSign(r, identityVal, ret)
+	if err != nil {
+		httpLogf(r, "failed signing the verdict: %v\n", err)
+		return ""
+	}
+	w.Header().Set("X-Verdict", verdict)
+	return verdict
+}
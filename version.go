@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// build information, set at build time with:
+// -ldflags "-X main.secsipidxGitCommit=... -X main.secsipidxBuildDate=..."
+var (
+	secsipidxGitCommit = ""
+	secsipidxBuildDate = ""
+)
+
+// VersionInfo - response of the version endpoint
+type VersionInfo struct {
+	Version     string                 `json:"version"`
+	GitCommit   string                 `json:"gitcommit"`
+	BuildDate   string                 `json:"builddate"`
+	GoVersion   string                 `json:"goversion"`
+	FIPS        bool                   `json:"fips"`
+	FIPSBackend string                 `json:"fipsbackend,omitempty"`
+	Backends    []string               `json:"backends"`
+	LibOptions  map[string]interface{} `json:"liboptions"`
+}
+
+// versionBackends - the optional backends enabled in this instance
+func versionBackends() []string {
+	backends := []string{}
+	if hepClient != nil {
+		backends = append(backends, "hep")
+	}
+	if dbStore != nil {
+		backends = append(backends, "db:"+cliops.dbdriver)
+	}
+	if cpsClient != nil {
+		backends = append(backends, "cps-client")
+	}
+	if cpsStore != nil {
+		backends = append(backends, "cps-server")
+	}
+	if len(cliops.tnlookup) > 0 {
+		backends = append(backends, "tn-lookup")
+	}
+	if len(secsipid.SJWTLibOptGetS("OCSPShared")) > 0 {
+		backends = append(backends, "ocsp-shared:redis")
+	}
+	return backends
+}
+
+// versionRedactedOpts - the library options with credentials (the redis URL
+// with the password, the headers of the fetches) or with the paths of the
+// secret files, not returned in clear
+var versionRedactedOpts = []string{"OCSPShared", "FetchHeaders", "RepoAuthFile", "CacheKeyFile"}
+
+// versionLibOptions - the values of the library options, the ones of
+// versionRedactedOpts being replaced by "redacted" if set
+func versionLibOptions() map[string]interface{} {
+	opts := secsipid.SJWTLibOptGetAll()
+	for _, optname := range versionRedactedOpts {
+		if val, ok := opts[optname].(string); ok && len(val) > 0 {
+			opts[optname] = "redacted"
+		}
+	}
+	return opts
+}
+
+func httpHandleV1Version(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, httpErrMethod, secsipid.SJWTRetErr, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&VersionInfo{
+		Version:     secsipidxVersion,
+		GitCommit:   secsipidxGitCommit,
+		BuildDate:   secsipidxBuildDate,
+		GoVersion:   runtime.Version(),
+		FIPS:        secsipid.SJWTFIPSEnabled(),
+		FIPSBackend: secsipid.SJWTFIPSBackend(),
+		Backends:    versionBackends(),
+		LibOptions:  versionLibOptions(),
+	})
+}
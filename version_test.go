@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/asipto/secsipidx/secsipid"
+	"github.com/gomagedon/expectate"
+)
+
+func TestVersionLibOptions(t *testing.T) {
+	expect := expectate.Expect(t)
+
+	secsipid.SJWTLibOptSetS("FetchHeaders", "Authorization: Bearer secret")
+	defer secsipid.SJWTLibOptSetS("FetchHeaders", "")
+	secsipid.SJWTLibOptSetS("FetchUserAgent", "secsipidx-test")
+	defer secsipid.SJWTLibOptSetS("FetchUserAgent", "")
+
+	opts := versionLibOptions()
+	expect(opts["FetchHeaders"]).ToBe("redacted")
+	expect(opts["RepoAuthFile"]).ToBe("")
+	expect(opts["FetchUserAgent"]).ToBe("secsipidx-test")
+}
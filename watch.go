@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/asipto/secsipidx/secsipid"
+)
+
+// watchMinAge - the files modified more recently are not processed yet, they
+// may still be written
+const watchMinAge = time.Second
+
+// subdirectories of the spool directory for the checked files
+const (
+	watchPassDir = "pass"
+	watchFailDir = "fail"
+)
+
+// watchResultSuffix - suffix of the result file written next to the checked file
+const watchResultSuffix = ".result.json"
+
+// WatchResult - the result of checking the identity of a spool file, written
+// as JSON sidecar file
+type WatchResult struct {
+	File      string `json:"file"`
+	Time      string `json:"time"`
+	Result    string `json:"result"`
+	Code      int    `json:"code"`
+	Reason    string `json:"reason"`
+	Check     string `json:"check,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Attest    string `json:"attest,omitempty"`
+	OrigTN    string `json:"origtn,omitempty"`
+	DestTN    string `json:"desttn,omitempty"`
+	OrigID    string `json:"origid,omitempty"`
+	Treatment string `json:"treatment,omitempty"`
+}
+
+// watchCheckFile - check the identity in the file (the whole content, or
+// the first line with the 'Identity:' header name removed)
+func watchCheckFile(filePath string) *WatchResult {
+	res := &WatchResult{File: filepath.Base(filePath), Time: time.Now().UTC().Format(time.RFC3339)}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		res.Result, res.Code, res.Message = "FAILED", secsipid.SJWTRetErrFileRead, err.Error()
+		res.Reason = secsipid.SJWTRetName(res.Code)
+		return res
+	}
+	identityVal := strings.TrimSpace(strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)[0])
+	if len(identityVal) > 9 && strings.EqualFold(identityVal[:9], "identity:") {
+		identityVal = strings.TrimSpace(identityVal[9:])
+	}
+	var ret int
+	if len(identityVal) == 0 {
+		ret, err = secsipid.SJWTRetErrSIPHdrEmpty, fmt.Errorf("no identity in file")
+	} else if secsipid.SJWTIdentityIsCompact(identityVal) && len(cliops.pptclaims) > 0 {
+		identityVal, ret, err = secsipid.SJWTIdentityExpand(identityVal, []byte(cliops.pptclaims))
+	}
+	if ret == secsipid.SJWTRetOK {
+		var info *secsipid.SJWTCheckInfo
+		info, ret, err = checkFullIdentityInfo(context.Background(), identityVal)
+		recordFailure("watch", identityVal, info, ret, err)
+	}
+	payload := identityPayload(identityVal)
+	res.Attest, res.OrigTN, res.OrigID = payload.ATTest, payload.Orig.TN, payload.OrigID
+	res.DestTN = strings.Join(payload.Dest.TN, ",")
+	res.Result, res.Code, res.Reason = "OK", ret, secsipid.SJWTRetName(ret)
+	if ret != secsipid.SJWTRetOK {
+		res.Result, res.Check, res.Message = "FAILED", secsipid.SJWTRetClass(ret), errorMessage(err)
+		if checkUnavailable(ret) {
+			res.Result = checkResultUnavailable
+		}
+	}
+	res.Treatment = checkTreatment(identityVal, ret)
+	emitEvent(&EventRecord{Event: "check", Code: ret, OrigTN: res.OrigTN, DestTN: res.DestTN,
+		OrigID: res.OrigID, CallID: cliops.callid, Message: res.Message}, "", "")
+	return res
+}
+
+// watchProcessFile - check the file and move it to the pass or fail
+// subdirectory, with the result file next to it
+func watchProcessFile(dirPath string, name string) error {
+	res := watchCheckFile(filepath.Join(dirPath, name))
+	target := filepath.Join(dirPath, watchFailDir)
+	if res.Code == secsipid.SJWTRetOK {
+		target = filepath.Join(dirPath, watchPassDir)
+	}
+	data, _ := json.MarshalIndent(res, "", "  ")
+	// the result is written first, the checked file showing up in the
+	// subdirectory only when the result is available
+	if err := ioutil.WriteFile(filepath.Join(target, name+watchResultSuffix), append(data, '\n'), 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(dirPath, name), filepath.Join(target, name)); err != nil {
+		return err
+	}
+	if len(res.Message) > 0 {
+		log.Printf("%s: %s (%d) %s", name, res.Result, res.Code, res.Message)
+	} else {
+		log.Printf("%s: %s (%d)", name, res.Result, res.Code)
+	}
+	return nil
+}
+
+// watchScan - process the files of the spool directory, skipping the hidden
+// ones, the temporary ones and the ones still being written
+func watchScan(dirPath string) {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		log.Printf("failed to read the spool directory: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, fi := range entries {
+		name := fi.Name()
+		if !fi.Mode().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".tmp") ||
+			now.Sub(fi.ModTime()) < watchMinAge {
+			continue
+		}
+		if err := watchProcessFile(dirPath, name); err != nil {
+			log.Printf("%s: failed to process: %v", name, err)
+		}
+	}
+}
+
+// secsipidxCLIWatch - watch the spool directory until the termination signal
+func secsipidxCLIWatch() int {
+	if cliops.watchintvl <= 0 {
+		fmt.Printf("invalid watch interval: %d\n", cliops.watchintvl)
+		return cliExitArgs
+	}
+	for _, sub := range []string{watchPassDir, watchFailDir} {
+		if err := os.MkdirAll(filepath.Join(cliops.watchdir, sub), 0750); err != nil {
+			fmt.Printf("failed to create the %s directory: %v\n", sub, err)
+			return -1
+		}
+	}
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(time.Duration(cliops.watchintvl) * time.Second)
+	defer ticker.Stop()
+	log.Printf("watching the spool directory: %s", cliops.watchdir)
+	for {
+		watchScan(cliops.watchdir)
+		select {
+		case sig := <-sigchan:
+			log.Printf("stopping watching on signal: %v", sig)
+			return 0
+		case <-ticker.C:
+		}
+	}
+}